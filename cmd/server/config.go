@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+// redacted replaces the secrets of the configuration printed by config show.
+const redacted = "<redacted>"
+
+// runConfig implements the config subcommand, whose only command is show.
+func runConfig(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintf(stderr, "Usage:\n")
+		fmt.Fprintf(stderr, "  %s config show -config <file> [options]\n", os.Args[0])
+		return exitError
+	}
+	return runConfigShow(args[1:], stdout, stderr)
+}
+
+// runConfigShow implements the config show subcommand: it prints the effective
+// configuration, the configuration file with the flags that override it applied and the
+// defaults of unset settings filled in, as YAML or JSON. Tokens are redacted.
+func runConfigShow(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("config show", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Print the effective configuration the server enforces.\n\n")
+		fmt.Fprintf(stderr, "Usage:\n")
+		fmt.Fprintf(stderr, "  %s config show -config <file> [options]\n\n", os.Args[0])
+		fmt.Fprintf(stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	configFile := flags.String("config", "", "Path to configuration file")
+	profile := flags.String("profile", "", "Print the policy of the named profile instead of the whole configuration")
+	asJSON := flags.Bool("json", false, "Print the configuration as JSON instead of YAML")
+	var flagOverrides overrides
+	flagOverrides.register(flags)
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if *configFile == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return exitError
+	}
+
+	cfg, err := config.LoadConfigFromFile(*configFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: failed to load configuration: %v\n", err)
+		return exitError
+	}
+	flagOverrides.apply(cfg)
+	if *profile != "" {
+		if cfg, err = cfg.GetProfile(*profile); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+	effective := cfg.Effective()
+	effective.AuthTokens = redactTokens(effective.AuthTokens)
+	effective.AdminTokens = redactTokens(effective.AdminTokens)
+
+	data, err := json.MarshalIndent(effective, "", "  ")
+	if err == nil && !*asJSON {
+		data, err = jsonToYAML(data)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+	fmt.Fprint(stdout, string(data))
+	if *asJSON {
+		fmt.Fprintln(stdout)
+	}
+	return exitOK
+}
+
+// redactTokens returns a copy of tokens with the secrets replaced.
+func redactTokens(tokens []config.AuthToken) []config.AuthToken {
+	if tokens == nil {
+		return nil
+	}
+	redactedTokens := make([]config.AuthToken, len(tokens))
+	for i, token := range tokens {
+		redactedTokens[i] = config.AuthToken{Token: redacted, Client: token.Client}
+	}
+	return redactedTokens
+}
+
+// jsonToYAML converts JSON to block-style YAML with the keys in the same order.
+func jsonToYAML(data []byte) ([]byte, error) {
+	// JSON is YAML in flow style; decoding it into a node keeps the order of the keys
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	var blockStyle func(n *yaml.Node)
+	blockStyle = func(n *yaml.Node) {
+		n.Style = 0
+		for _, child := range n.Content {
+			blockStyle(child)
+		}
+	}
+	blockStyle(&node)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), encoder.Close()
+}
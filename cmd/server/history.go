@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/history"
+)
+
+// runHistory implements the history subcommand: it prints the executions of the history
+// named by a configuration that pass the filters, most recent first, like the
+// /admin/history endpoint.
+func runHistory(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Print the executions of the history, most recent first.\n\n")
+		fmt.Fprintf(stderr, "Usage:\n")
+		fmt.Fprintf(stderr, "  %s history -config <file> [options]\n\n", os.Args[0])
+		fmt.Fprintf(stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	configFile := flags.String("config", "", "Path to the configuration file naming the history")
+	client := flags.String("client", "", "Only print executions of the named client")
+	command := flags.String("command", "", "Only print executions whose command contains this text")
+	status := flags.String("status", "", "Only print executions that ended this way: succeeded, failed, error or canceled")
+	since := flags.String("since", "", "Only print executions started since a duration ago (e.g. 1h) or an RFC 3339 time")
+	until := flags.String("until", "", "Only print executions started before a duration ago or an RFC 3339 time")
+	limit := flags.Int("n", 20, "Number of executions to print (0 prints all)")
+	asJSON := flags.Bool("json", false, "Print the executions as JSON")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if *configFile == "" || flags.NArg() > 0 || *limit < 0 {
+		flags.Usage()
+		return exitError
+	}
+
+	filter := history.Filter{Client: *client, Command: *command, Limit: *limit}
+	var err error
+	filter.Status, err = history.ParseStatus(*status)
+	if err == nil {
+		filter.Since, err = history.ParseTime("-since", *since)
+	}
+	if err == nil {
+		filter.Until, err = history.ParseTime("-until", *until)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	records, err := queryHistory(*configFile, filter)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if *asJSON {
+		data, _ := json.MarshalIndent(records, "", "  ")
+		fmt.Fprintln(stdout, string(data))
+		return exitOK
+	}
+	for _, record := range records {
+		fmt.Fprintln(stdout, formatRecord(record))
+	}
+	return exitOK
+}
+
+// queryHistory returns the records that match filter in the history of the configuration
+// file path. It does not create the history when the server has not yet.
+func queryHistory(path string, filter history.Filter) ([]history.Record, error) {
+	cfg, err := config.LoadConfigFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if cfg.History == nil || cfg.History.Path == "" {
+		return nil, errors.New("the configuration has no history")
+	}
+	if _, err := os.Stat(cfg.History.Path); err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+
+	store, err := history.Open(cfg.History.Path, history.Retention{
+		MaxRecords: cfg.History.GetMaxRecords(),
+		MaxAge:     cfg.History.GetMaxAge(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	return store.Query(filter)
+}
+
+// formatRecord returns record pretty-printed on one line, like the entries of the audit log
+// printed by logs.
+func formatRecord(record history.Record) string {
+	text := fmt.Sprintf("%s %s %s exit %d in %s (%s): %q",
+		record.StartedAt.Local().Format(time.RFC3339), clientOrDash(record.Client), record.Status,
+		record.ExitCode, record.WorkingDir, record.FinishedAt.Sub(record.StartedAt).Round(time.Millisecond),
+		record.Command)
+	if record.Error != "" {
+		text += ": " + record.Error
+	}
+	return text
+}
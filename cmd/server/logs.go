@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/runner"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+// followInterval is how often logs -f checks the log for new entries.
+const followInterval = 500 * time.Millisecond
+
+// logEntry is an entry of the block or audit log with the fields logs filters on.
+type logEntry struct {
+	time     time.Time
+	client   string
+	commands []string
+	// text is the entry pretty-printed on one line
+	text string
+}
+
+// parseLogLine parses a line of the block log, or of the audit log when audit is set.
+func parseLogLine(line []byte, audit bool) (logEntry, error) {
+	if audit {
+		var record runner.AuditRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return logEntry{}, err
+		}
+		entry := logEntry{time: record.StartedAt, client: record.Client}
+		for _, command := range record.Commands {
+			entry.commands = append(entry.commands, command.Name)
+		}
+		entry.text = fmt.Sprintf("%s %s exit %d in %s (%s): %q",
+			record.StartedAt.Local().Format(time.RFC3339), clientOrDash(record.Client), record.ExitCode,
+			record.WorkingDir, record.FinishedAt.Sub(record.StartedAt).Round(time.Millisecond), record.Script)
+		if record.Error != "" {
+			entry.text += ": " + record.Error
+		}
+		return entry, nil
+	}
+
+	var record validator.BlockRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return logEntry{}, err
+	}
+	command := record.Script
+	if command == "" {
+		command = strings.Join(append([]string{record.Command}, record.Args...), " ")
+	}
+	entry := logEntry{time: record.Time, client: record.Client, commands: []string{record.Command}}
+	entry.text = fmt.Sprintf("%s %s blocked %q in %s: %s",
+		record.Time.Local().Format(time.RFC3339), clientOrDash(record.Client), command, record.WorkDir, record.Reason)
+	if record.Rule != "" {
+		entry.text += " [" + record.Rule + "]"
+	}
+	return entry, nil
+}
+
+// clientOrDash returns client, or "-" for runs of unidentified clients.
+func clientOrDash(client string) string {
+	if client == "" {
+		return "-"
+	}
+	return client
+}
+
+// logFilter selects the log entries logs prints.
+type logFilter struct {
+	since   time.Time
+	command string
+	client  string
+}
+
+// matches reports whether entry passes every filter that is set.
+func (f logFilter) matches(entry logEntry) bool {
+	return (f.since.IsZero() || !entry.time.Before(f.since)) &&
+		(f.command == "" || slices.Contains(entry.commands, f.command)) &&
+		(f.client == "" || entry.client == f.client)
+}
+
+// parseSince parses the value of -since, a duration before now such as "1h" or an RFC 3339
+// time.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -since %q: want a duration such as 1h or an RFC 3339 time", value)
+	}
+	return t, nil
+}
+
+// runLogs implements the logs subcommand: it prints the last entries of the block log or
+// the audit log named by a configuration that pass the filters, pretty-printed or as they
+// are, and with -f keeps printing new entries until interrupted.
+func runLogs(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("logs", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Print the entries of the block log or the audit log.\n\n")
+		fmt.Fprintf(stderr, "Usage:\n")
+		fmt.Fprintf(stderr, "  %s logs (-config <file> | -file <log>) [options]\n\n", os.Args[0])
+		fmt.Fprintf(stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	configFile := flags.String("config", "", "Path to the configuration file naming the logs")
+	profile := flags.String("profile", "", "Read the logs of the named profile instead of the top-level ones")
+	logFile := flags.String("file", "", "Path of the log to read instead of the one named by the configuration")
+	audit := flags.Bool("audit", false, "Read the audit log instead of the block log")
+	since := flags.String("since", "", "Only print entries since a duration ago (e.g. 1h) or an RFC 3339 time")
+	command := flags.String("command", "", "Only print entries of the named command")
+	client := flags.String("client", "", "Only print entries of the named client")
+	lines := flags.Int("n", 20, "Number of entries to print (0 prints all)")
+	follow := flags.Bool("f", false, "Keep printing new entries until interrupted")
+	raw := flags.Bool("json", false, "Print the entries as the JSON lines of the log")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if (*configFile == "") == (*logFile == "") || flags.NArg() > 0 {
+		flags.Usage()
+		return exitError
+	}
+
+	path := *logFile
+	if path == "" {
+		cfg, err := loadPolicy(*configFile, *profile)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return exitError
+		}
+		setting := "blockLogPath"
+		path = cfg.BlockLogPath
+		if *audit {
+			path, setting = cfg.AuditLogPath, "auditLogPath"
+		}
+		if path == "" {
+			fmt.Fprintf(stderr, "Error: the configuration has no %s\n", setting)
+			return exitError
+		}
+	}
+	filter := logFilter{command: *command, client: *client}
+	if *since != "" {
+		t, err := parseSince(*since, time.Now())
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return exitError
+		}
+		filter.since = t
+	}
+
+	// emit prints line if it passes the filter; lines that are not entries are skipped
+	emit := func(line []byte) {
+		entry, err := parseLogLine(line, *audit)
+		if err != nil || !filter.matches(entry) {
+			return
+		}
+		if *raw {
+			fmt.Fprintln(stdout, string(line))
+		} else {
+			fmt.Fprintln(stdout, entry.text)
+		}
+	}
+
+	offset, err := tailLog(path, *lines, filter, *audit, emit)
+	if err != nil && !(*follow && errors.Is(err, os.ErrNotExist)) {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if *follow {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		followLog(ctx, path, offset, emit)
+	}
+	return exitOK
+}
+
+// tailLog passes the last n lines of the log at path that pass filter to emit, all of them
+// when n is 0, and returns the offset after the last complete line.
+func tailLog(path string, n int, filter logFilter, audit bool, emit func(line []byte)) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var matched [][]byte
+	var offset int64
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// A line without its newline is still being written; -f prints it once complete
+			break
+		}
+		offset += int64(len(line))
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		if entry, err := parseLogLine(line, audit); err != nil || !filter.matches(entry) {
+			continue
+		}
+		matched = append(matched, line)
+		if n > 0 && len(matched) > n {
+			matched = matched[1:]
+		}
+	}
+	for _, line := range matched {
+		emit(line)
+	}
+	return offset, nil
+}
+
+// followLog passes the lines appended to the log at path after offset to emit until ctx is
+// done. A log smaller than offset has been rotated or truncated and is read from the start.
+func followLog(ctx context.Context, path string, offset int64, emit func(line []byte)) {
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+	var pending []byte
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			// The log is created on its first entry
+			continue
+		}
+		if info, err := f.Stat(); err == nil && info.Size() < offset {
+			offset, pending = 0, nil
+		}
+		data, err := io.ReadAll(io.NewSectionReader(f, offset, 1<<62))
+		f.Close()
+		if err != nil {
+			continue
+		}
+		offset += int64(len(data))
+		pending = append(pending, data...)
+		for {
+			i := bytes.IndexByte(pending, '\n')
+			if i < 0 {
+				break
+			}
+			emit(pending[:i])
+			pending = pending[i+1:]
+		}
+	}
+}
@@ -4,8 +4,10 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 
+	"github.com/shimizu1995/secure-shell-server/internal/shellcli"
 	"github.com/shimizu1995/secure-shell-server/pkg/config"
 	"github.com/shimizu1995/secure-shell-server/pkg/utils"
 	"github.com/shimizu1995/secure-shell-server/service"
@@ -16,12 +18,41 @@ func main() {
 	os.Exit(exitCode)
 }
 
+// subcommands are the commands run instead of the server when named by the first argument,
+// each given the remaining arguments.
+var subcommands = map[string]func(args []string, stdout, stderr io.Writer) int{
+	"validate": runValidate,
+	"policy":   runPolicy,
+	"config":   runConfig,
+	"logs":     runLogs,
+	"history":  runHistory,
+	"version":  runVersion,
+	"repl":     runREPL,
+	"run": func(args []string, stdout, stderr io.Writer) int {
+		return shellcli.Run(os.Args[0]+" run", args, os.Stdin, stdout, stderr)
+	},
+}
+
 func run() int {
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			return subcommand(os.Args[2:], os.Stdout, os.Stderr)
+		}
+	}
+
 	// Define command-line flags
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Secure Shell Server - MCP Server mode\n\n")
 		fmt.Fprintf(os.Stderr, "Usage:\n")
-		fmt.Fprintf(os.Stderr, "  %s [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s validate -config <file> [options] <command>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s policy test [-config <file>] <suite>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s config show -config <file> [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s logs (-config <file> | -file <log>) [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s history -config <file> [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s repl -config <file> [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s version [-json]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s run -config <file> [options] (-script <script> | -file <file> [args...])\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 	}
@@ -34,6 +65,8 @@ func run() int {
 	configFile := flag.String("config", "", "Path to configuration file")
 	stdio := flag.Bool("stdio", true, "Use stdin/stdout for MCP communication")
 	logPath := flag.String("log", "", "Path to the log file (if empty, no logging occurs)")
+	var flagOverrides overrides
+	flagOverrides.register(flag.CommandLine)
 
 	// Parse the flags
 	flag.Parse()
@@ -54,6 +87,9 @@ func run() int {
 		return 1
 	}
 
+	// Override settings of the configuration with the flags given
+	flagOverrides.apply(cfg)
+
 	// Ensure log directory exists if log path is specified
 	if *logPath != "" {
 		if dirErr := utils.EnsureLogDirectory(*logPath); dirErr != nil {
@@ -62,12 +98,18 @@ func run() int {
 		}
 	}
 
-	// Create server with optional log path
-	mcpServer, err := service.NewServer(cfg, *port, *logPath)
+	// Create server with optional log path, reloading the policy from the configuration
+	// file on SIGHUP and the reload endpoint
+	mcpServer, err := service.NewServerWithOptions(cfg,
+		service.WithPort(*port),
+		service.WithLogPath(*logPath),
+		service.WithConfigPath(*configFile),
+	)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating server: %v\n", err)
 		return 1
 	}
+	defer mcpServer.ReloadOnHangup()()
 
 	// Start the server using stdio or HTTP
 	if *stdio {
@@ -76,7 +118,18 @@ func run() int {
 			return 1
 		}
 	} else {
-		fmt.Printf("Starting MCP server on port %d...\n", *port)
+		scheme := "http"
+		if cfg.TLS != nil {
+			scheme = "https"
+		}
+		switch {
+		case os.Getenv("LISTEN_FDS") != "":
+			fmt.Println("Starting MCP server on the sockets passed by systemd...")
+		case cfg.UnixSocket != nil:
+			fmt.Printf("Starting MCP server on unix socket %s...\n", cfg.UnixSocket.Path)
+		default:
+			fmt.Printf("Starting MCP server on %s://localhost:%d%s...\n", scheme, *port, service.HTTPPath)
+		}
 		if err := mcpServer.Start(); err != nil {
 			fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
 			return 1
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+// overrides are the command-line flags that override settings of the configuration file,
+// shared by the server and the config show subcommand.
+type overrides struct {
+	logFormat   string
+	logLevel    string
+	logTarget   string
+	tlsCert     string
+	tlsKey      string
+	tlsClientCA string
+	authToken   string
+}
+
+// register defines the flags of o in flags.
+func (o *overrides) register(flags *flag.FlagSet) {
+	flags.StringVar(&o.logFormat, "log-format", "", "Format of the log file: text or json (overrides logFormat in the configuration)")
+	flags.StringVar(&o.logLevel, "log-level", "", "Minimum level logged: debug, info, warn or error (overrides logLevel in the configuration)")
+	flags.StringVar(&o.logTarget, "log-target", "", "Where to log: file, syslog or journald (overrides logTarget in the configuration)")
+	flags.StringVar(&o.tlsCert, "tls-cert", "", "Certificate file to serve HTTP over TLS (overrides tls.certFile in the configuration)")
+	flags.StringVar(&o.tlsKey, "tls-key", "", "Private key file of the TLS certificate (overrides tls.keyFile in the configuration)")
+	flags.StringVar(&o.authToken, "auth-token", "", "Token required on HTTP requests, in addition to authTokens in the configuration "+
+		"(default $SECURE_SHELL_AUTH_TOKEN)")
+	flags.StringVar(&o.tlsClientCA, "tls-client-ca", "", "CA file to verify client certificates with (overrides tls.clientCAFile in the configuration)")
+}
+
+// apply overrides the settings of cfg with the flags that were given.
+func (o *overrides) apply(cfg *config.ShellCommandConfig) {
+	// Override the configured log format, level and target if specified
+	if o.logFormat != "" {
+		cfg.LogFormat = o.logFormat
+	}
+	if o.logLevel != "" {
+		cfg.LogLevel = o.logLevel
+	}
+	if o.logTarget != "" {
+		cfg.LogTarget = o.logTarget
+	}
+
+	// Override the configured TLS files if specified
+	if o.tlsCert != "" || o.tlsKey != "" || o.tlsClientCA != "" {
+		if cfg.TLS == nil {
+			cfg.TLS = &config.TLSConfig{}
+		}
+		if o.tlsCert != "" {
+			cfg.TLS.CertFile = o.tlsCert
+		}
+		if o.tlsKey != "" {
+			cfg.TLS.KeyFile = o.tlsKey
+		}
+		if o.tlsClientCA != "" {
+			cfg.TLS.ClientCAFile = o.tlsClientCA
+		}
+	}
+
+	// Accept the token given on the command line or in the environment
+	authToken := o.authToken
+	if authToken == "" {
+		authToken = os.Getenv("SECURE_SHELL_AUTH_TOKEN")
+	}
+	if authToken != "" {
+		cfg.AuthTokens = append(cfg.AuthTokens, config.AuthToken{Token: authToken})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/policytest"
+)
+
+// runPolicy implements the policy subcommand, whose only command is test.
+func runPolicy(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprintf(stderr, "Usage:\n")
+		fmt.Fprintf(stderr, "  %s policy test [-config <file>] <suite>...\n", os.Args[0])
+		return exitError
+	}
+	return runPolicyTest(args[1:], stdout, stderr)
+}
+
+// runPolicyTest implements the policy test subcommand: it runs the cases of test suites
+// against their configuration and prints a report. It returns exitOK when every case
+// passed, exitFailed when any failed and exitError when the suites cannot be run.
+func runPolicyTest(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("policy test", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Check the verdicts of a policy against test suites, JSON or YAML files of cases.\n\n")
+		fmt.Fprintf(stderr, "Usage:\n")
+		fmt.Fprintf(stderr, "  %s policy test [-config <file>] <suite>...\n\n", os.Args[0])
+		fmt.Fprintf(stderr, "Exits 0 when every case passes, 1 when any fails and 2 on errors.\n\n")
+		fmt.Fprintf(stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	configFile := flags.String("config", "", "Path to configuration file (default: the config named by each suite)")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitError
+	}
+
+	failed := 0
+	for i, path := range flags.Args() {
+		suite, err := policytest.Load(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return exitError
+		}
+		configPath := *configFile
+		if configPath == "" {
+			configPath = suite.ConfigPath()
+		}
+		if configPath == "" {
+			fmt.Fprintf(stderr, "Error: %s names no config; give one with -config\n", path)
+			return exitError
+		}
+		cfg, err := config.LoadConfigFromFile(configPath)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error loading configuration: %v\n", err)
+			return exitError
+		}
+
+		if i > 0 {
+			fmt.Fprintln(stdout)
+		}
+		fmt.Fprintf(stdout, "%s (%s)\n", path, configPath)
+		failed += policytest.Report(stdout, suite.Run(cfg))
+	}
+	if failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
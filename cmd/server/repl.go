@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/runner"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+// replCheckPrefix starts a REPL line that is only validated, not run.
+const replCheckPrefix = ":check "
+
+// runREPL implements the repl subcommand: it reads commands from stdin, shows the verdict of
+// the policy on each and runs the allowed ones, keeping the directory, exported variables
+// and functions between lines like a shell.
+func runREPL(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Run commands interactively under a policy, showing its verdict on each.\n\n")
+		fmt.Fprintf(stderr, "Usage:\n")
+		fmt.Fprintf(stderr, "  %s repl -config <file> [options]\n\n", os.Args[0])
+		fmt.Fprintf(stderr, "Enter a command to check and run it, \":check <command>\" to only check it,\n")
+		fmt.Fprintf(stderr, "and \"exit\" or end of input to quit. Ctrl-C stops the running command.\n\n")
+		fmt.Fprintf(stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	configFile := flags.String("config", "", "Path to configuration file")
+	dir := flags.String("dir", "", "Directory to start in (default: workingDir, else the first allowed directory)")
+	profile := flags.String("profile", "", "Use the named profile instead of the top-level policy")
+	logPath := flags.String("log", "", "Path to the log file (if empty, no logging occurs)")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if *configFile == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return exitError
+	}
+
+	cfg, err := loadPolicy(*configFile, *profile)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+	workingDir, err := workingDirectory(cfg, *dir)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+	log, err := logger.NewWithPath(*logPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error creating logger: %v\n", err)
+		return exitError
+	}
+	defer log.Close()
+
+	v := validator.New(cfg, log)
+	r := runner.New(cfg, v, log)
+	session := runner.NewSession(workingDir)
+
+	input := bufio.NewScanner(os.Stdin)
+	for {
+		line, ok := readREPLLine(input, stdout, session.Dir())
+		if !ok {
+			fmt.Fprintln(stdout)
+			return exitOK
+		}
+		switch {
+		case line == "":
+			continue
+		case line == "exit" || line == "quit":
+			return exitOK
+		case strings.HasPrefix(line, replCheckPrefix):
+			command := strings.TrimSpace(strings.TrimPrefix(line, replCheckPrefix))
+			printREPLVerdict(stdout, checkREPLLine(v, command, session.Dir()))
+			continue
+		}
+
+		verdict := checkREPLLine(v, line, session.Dir())
+		printREPLVerdict(stdout, verdict)
+		if !verdict.Allowed {
+			continue
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		result := r.Run(ctx, runner.Request{Command: line, Stdout: stdout, Stderr: stderr, Session: session})
+		stop()
+		switch exitCode := runner.ExitCode(result.Err); exitCode {
+		case 0:
+		case runner.ExitCodeNotRun:
+			fmt.Fprintf(stdout, "error: %v\n", result.Err)
+		default:
+			fmt.Fprintf(stdout, "exit status %d\n", exitCode)
+		}
+	}
+}
+
+// readREPLLine prompts for a line of input, joining lines that end with a backslash to the
+// next. It reports false at the end of input.
+func readREPLLine(input *bufio.Scanner, stdout io.Writer, dir string) (string, bool) {
+	fmt.Fprintf(stdout, "%s$ ", dir)
+	var lines []string
+	for input.Scan() {
+		line, more := strings.CutSuffix(input.Text(), "\\")
+		lines = append(lines, line)
+		if !more {
+			return strings.TrimSpace(strings.Join(lines, "")), true
+		}
+		fmt.Fprint(stdout, "> ")
+	}
+	return "", false
+}
+
+// checkREPLLine returns the verdict of v on running command in dir.
+func checkREPLLine(v *validator.CommandValidator, command, dir string) validator.ValidationResult {
+	if result := v.ValidateDirectory(dir); !result.Allowed {
+		return result
+	}
+	return v.CheckScript(context.Background(), command, dir)
+}
+
+// printREPLVerdict prints a verdict on one line, with the rule that decided it if known.
+func printREPLVerdict(w io.Writer, result validator.ValidationResult) {
+	verdict := "allowed"
+	if !result.Allowed {
+		verdict = "blocked: " + result.Message
+	}
+	if result.Rule != "" {
+		verdict += " (" + result.Rule + ")"
+	}
+	fmt.Fprintln(w, verdict)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+// Exit codes of the subcommands: exitFailed when a command is blocked or a policy test
+// fails, exitError when the command cannot be checked at all.
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitError  = 2
+)
+
+// runValidate implements the validate subcommand: it checks a command against the policy of
+// a configuration file without running it and prints the verdict. It returns exitOK
+// when the command is allowed, exitFailed when it is blocked and exitError when it cannot
+// be checked.
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Check a command against the policy without running it.\n\n")
+		fmt.Fprintf(stderr, "Usage:\n")
+		fmt.Fprintf(stderr, "  %s validate -config <file> [options] <command>\n\n", os.Args[0])
+		fmt.Fprintf(stderr, "Exits 0 when the command is allowed, 1 when it is blocked and 2 on errors.\n\n")
+		fmt.Fprintf(stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	configFile := flags.String("config", "", "Path to configuration file")
+	dir := flags.String("dir", "", "Directory to check the command in (default: workingDir, else the first allowed directory)")
+	profile := flags.String("profile", "", "Check against the named profile instead of the top-level policy")
+	asJSON := flags.Bool("json", false, "Print the verdict as JSON")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+
+	command := strings.Join(flags.Args(), " ")
+	if *configFile == "" || command == "" {
+		flags.Usage()
+		return exitError
+	}
+	cfg, err := loadPolicy(*configFile, *profile)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+	workingDir, err := workingDirectory(cfg, *dir)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	v := validator.New(cfg, logger.New())
+	result := v.ValidateDirectory(workingDir)
+	if result.Allowed {
+		result = v.CheckScript(context.Background(), command, workingDir)
+	}
+
+	if *asJSON {
+		verdict := struct {
+			validator.ValidationResult
+			WorkingDir string `json:"workingDir"`
+		}{result, workingDir}
+		data, _ := json.MarshalIndent(verdict, "", "  ")
+		fmt.Fprintln(stdout, string(data))
+	} else {
+		printVerdict(stdout, result, workingDir)
+	}
+	if !result.Allowed {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// loadPolicy loads the configuration file path and returns its policy, or that of the named
+// profile unless profile is "".
+func loadPolicy(path, profile string) (*config.ShellCommandConfig, error) {
+	cfg, err := config.LoadConfigFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if profile != "" {
+		return cfg.GetProfile(profile)
+	}
+	return cfg, nil
+}
+
+// workingDirectory returns dir as an absolute path or, when it is "", the directory commands
+// of cfg run in by default: its workingDir, else its first allowed directory.
+func workingDirectory(cfg *config.ShellCommandConfig, dir string) (string, error) {
+	switch {
+	case dir != "":
+		return filepath.Abs(dir)
+	case cfg.WorkingDir != "":
+		return cfg.WorkingDir, nil
+	case len(cfg.AllowedDirectories) > 0:
+		return cfg.AllowedDirectories[0], nil
+	}
+	return "", errors.New("no directory given with -dir and no allowed directories configured")
+}
+
+// printVerdict prints a validation result as one "key: value" line per field, like the
+// validate_command tool.
+func printVerdict(w io.Writer, result validator.ValidationResult, workingDir string) {
+	if result.Allowed {
+		fmt.Fprintln(w, "verdict: allowed")
+	} else {
+		fmt.Fprintln(w, "verdict: blocked")
+	}
+	for _, field := range []struct{ key, value string }{
+		{"command", result.Command},
+		{"code", string(result.Code)},
+		{"category", string(result.Category)},
+		{"rule", result.Rule},
+		{"message", result.Message},
+		{"docUrl", result.DocURL},
+	} {
+		if field.value != "" {
+			fmt.Fprintf(w, "%s: %s\n", field.key, field.value)
+		}
+	}
+	fmt.Fprintf(w, "workingDir: %s\n", workingDir)
+}
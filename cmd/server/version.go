@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/version"
+	"github.com/shimizu1995/secure-shell-server/service"
+)
+
+// runVersion implements the version subcommand: it prints the version, commit and build
+// date of the binary.
+func runVersion(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asJSON := flags.Bool("json", false, "Print the version, commit and build date as JSON")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(version.Get(), "", "  ")
+		fmt.Fprintln(stdout, string(data))
+	} else {
+		fmt.Fprintf(stdout, "%s %s\n", service.Name, version.Get())
+	}
+	return exitOK
+}
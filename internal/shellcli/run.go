@@ -0,0 +1,315 @@
+// Package shellcli implements the command line that runs a script under a policy, shared by
+// the secure-shell binary and the run subcommand of the server.
+package shellcli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/runner"
+	"github.com/shimizu1995/secure-shell-server/pkg/utils"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+	"github.com/shimizu1995/secure-shell-server/pkg/version"
+)
+
+// Output formats of Run.
+const (
+	// OutputText passes the script's output through as it is written.
+	OutputText = "text"
+	// OutputJSON prints a Result object once the script finishes.
+	OutputJSON = "json"
+)
+
+// Result is the outcome of a run printed with -output json, with the fields of the results
+// of the run tool.
+type Result struct {
+	RunID string `json:"runId"`
+	// ExitCode is the exit status of the script, or runner.ExitCodeNotRun when it did not
+	// run to completion
+	ExitCode             int    `json:"exitCode"`
+	DurationMs           int64  `json:"durationMs"`
+	Stdout               string `json:"stdout"`
+	Stderr               string `json:"stderr"`
+	StdoutTruncated      bool   `json:"stdoutTruncated"`
+	StderrTruncated      bool   `json:"stderrTruncated"`
+	StdoutRemainingBytes int    `json:"stdoutRemainingBytes"`
+	StderrRemainingBytes int    `json:"stderrRemainingBytes"`
+	// Error is why the script did not run to completion, "" when it did
+	Error string `json:"error,omitempty"`
+	// Blocked holds the verdicts of the commands the policy blocked
+	Blocked []validator.ValidationResult `json:"blocked,omitempty"`
+	// Commands lists the commands that passed validation and were run, in order
+	Commands []runner.ExecutedCommand `json:"commands,omitempty"`
+	// Steps report the status of each top-level command of a script of several
+	Steps []runner.StepResult `json:"steps,omitempty"`
+}
+
+// Run runs the script given by args under the policy of a configuration file and returns the
+// exit code of the process: the script's own exit code, or 1 when it did not run to
+// completion. name is the name of the command in usage messages. The script is read from
+// stdin with -script - or when neither -script nor -file is given and stdin is not a
+// terminal.
+func Run(name string, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	// Define command-line flags
+	scriptStr := flags.String("script", "", "Script string to execute; - reads it from stdin")
+	scriptFile := flags.String("file", "", "Script file to execute; remaining arguments become its positional parameters")
+	maxTime := flags.Int("timeout", config.DefaultExecutionTimeout, "Maximum execution time in seconds")
+	workingDir := flags.String("dir", "", "Working directory for command execution")
+	createDir := flags.Bool("create-dir", false, "Create the working directory if it does not exist")
+	preflight := flags.Bool("preflight", false, "Validate every command of the script before any of it runs")
+	stopOnError := flags.Bool("stop-on-error", false, "Stop the script at its first failing command, like set -e")
+	output := flags.String("output", OutputText, "Output format: text passes the output through, json prints a result object")
+	logPath := flags.String("log", "", "Path to the log file (if empty, no logging occurs)")
+	logFormat := flags.String("log-format", "", "Format of the log file: text or json (overrides logFormat in the configuration)")
+	logLevel := flags.String("log-level", "", "Minimum level logged: debug, info, warn or error (overrides logLevel in the configuration)")
+	logTarget := flags.String("log-target", "", "Where to log: file, syslog or journald (overrides logTarget in the configuration)")
+	configPath := flags.String("config", "", "Path to the configuration file (if empty, uses default configuration)")
+	showVersion := flags.Bool("version", false, "Print the version and exit")
+	var allow, deny commandList
+	flags.Var(&allow, "allow", "Commands to allow in addition to the configuration, comma-separated or repeated")
+	flags.Var(&deny, "deny", "Commands to deny in addition to the configuration, comma-separated or repeated")
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if *showVersion {
+		fmt.Fprintf(stdout, "%s %s\n", filepath.Base(name), version.Get())
+		return 0
+	}
+	if *output != OutputText && *output != OutputJSON {
+		fmt.Fprintf(stderr, "Error: -output must be %s or %s\n", OutputText, OutputJSON)
+		return 1
+	}
+
+	// Ensure log directory exists if log path is specified
+	if *logPath != "" {
+		if err := utils.EnsureLogDirectory(*logPath); err != nil {
+			fmt.Fprintf(stderr, "Error creating log directory: %v\n", err)
+			return 1
+		}
+	}
+
+	// Create config from file or use default
+	var cfg *config.ShellCommandConfig
+	var configErr error
+
+	if *configPath == "" {
+		fmt.Fprintf(stderr, "Error: Configuration file must be specified with -config flag\n")
+		return 1
+	}
+
+	// Load configuration from file
+	cfg, configErr = config.LoadConfigFromFile(*configPath)
+	if configErr != nil {
+		fmt.Fprintf(stderr, "Error loading configuration file: %v\n", configErr)
+		return 1
+	}
+
+	// Override config with command-line flags if specified
+	if *logFormat != "" {
+		cfg.LogFormat = *logFormat
+	}
+	if *logLevel != "" {
+		cfg.LogLevel = *logLevel
+	}
+	if *logTarget != "" {
+		cfg.LogTarget = *logTarget
+	}
+	cfg.MaxExecutionTime = *maxTime
+	// Extend the policy for this run; denied commands stay denied even when allowed
+	for _, cmd := range allow {
+		cfg.AddAllowedCommand(cmd)
+	}
+	for _, cmd := range deny {
+		cfg.AddDeniedCommand(cmd, "")
+	}
+	if *createDir {
+		cfg.CreateWorkingDir = true
+	}
+	if *preflight {
+		cfg.PreflightValidation = true
+	}
+	if *stopOnError {
+		cfg.StopOnError = true
+	}
+
+	// Create logger with optional path
+	log, logErr := logger.Open(logger.Options{
+		Target:   cfg.LogTarget,
+		Path:     *logPath,
+		Rotation: logger.Rotation(cfg.GetLogRotation()),
+		Syslog:   logger.SyslogOptions(cfg.GetSyslog()),
+		Format:   cfg.LogFormat,
+		Level:    cfg.LogLevel,
+		Sinks:    logSinks(cfg.LogSinks),
+	})
+	if logErr != nil {
+		fmt.Fprintf(stderr, "Error creating logger: %v\n", logErr)
+		return 1
+	}
+	defer log.Close()
+
+	// Create validator and runner
+	validatorObj := validator.New(cfg, log)
+	safeRunner := runner.New(cfg, validatorObj, log)
+	var stdoutBuf, stderrBuf bytes.Buffer
+	if *output == OutputJSON {
+		safeRunner.SetOutputs(&stdoutBuf, &stderrBuf)
+	} else {
+		safeRunner.SetOutputs(stdout, stderr)
+	}
+
+	// Create a context with timeout for the entire execution
+	ctx := context.Background()
+	var cancel context.CancelFunc
+	if *maxTime > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(*maxTime)*time.Second)
+		defer cancel()
+	}
+
+	// Execute the requested operation
+	var result runner.RunResult
+	var script string
+	start := time.Now()
+
+	if *scriptStr == "-" || (*scriptStr == "" && *scriptFile == "" && isPiped(stdin)) {
+		// Read one byte over the limit to tell a script of exactly the limit from a longer one
+		data, err := io.ReadAll(io.LimitReader(stdin, int64(cfg.GetMaxScriptSize())+1))
+		if err != nil {
+			fmt.Fprintf(stderr, "Error reading the script from stdin: %v\n", err)
+			return 1
+		}
+		if len(data) > cfg.GetMaxScriptSize() {
+			fmt.Fprintf(stderr, "Error: the script on stdin exceeds the maximum script size of %d bytes\n", cfg.GetMaxScriptSize())
+			return 1
+		}
+		*scriptStr = string(data)
+		if strings.TrimSpace(*scriptStr) == "" {
+			fmt.Fprintf(stderr, "Error: the script on stdin is empty\n")
+			return 1
+		}
+	}
+
+	switch {
+	case *scriptStr != "":
+		// Execute a script string
+		script = *scriptStr
+		result = safeRunner.RunCommand(ctx, script, *workingDir)
+
+	case *scriptFile != "":
+		// Execute a script file
+		result = safeRunner.RunScriptFile(ctx, *scriptFile, flags.Args(), *workingDir)
+
+	default:
+		fmt.Fprintf(stderr, "Error: No command or script specified\n")
+		flags.Usage()
+		return 1
+	}
+
+	// Exit with the script's own exit code; only report errors that stopped the script
+	exitCode := runner.ExitCode(result.Err)
+	if *output == OutputJSON {
+		out := Result{
+			RunID:                result.ID,
+			ExitCode:             exitCode,
+			DurationMs:           time.Since(start).Milliseconds(),
+			Stdout:               stdoutBuf.String(),
+			Stderr:               stderrBuf.String(),
+			StdoutTruncated:      result.Stdout.Truncated,
+			StderrTruncated:      result.Stderr.Truncated,
+			StdoutRemainingBytes: result.Stdout.RemainingBytes,
+			StderrRemainingBytes: result.Stderr.RemainingBytes,
+			Commands:             result.Commands,
+		}
+		if len(result.Steps) > 1 {
+			out.Steps = result.Steps
+		}
+		if exitCode == runner.ExitCodeNotRun {
+			out.Error = result.Err.Error()
+			// The run only reports the error; the verdict gives its rule and code
+			if verdict := blockedVerdict(validatorObj, script, *workingDir); verdict != nil {
+				out.Blocked = []validator.ValidationResult{*verdict}
+			}
+		}
+		data, _ := json.MarshalIndent(out, "", "  ")
+		fmt.Fprintln(stdout, string(data))
+	} else if exitCode == runner.ExitCodeNotRun {
+		fmt.Fprintf(stderr, "Error: %v\n", result.Err)
+	}
+	if exitCode == runner.ExitCodeNotRun {
+		return 1
+	}
+	return exitCode
+}
+
+// commandList is a flag of command names, given as a comma-separated list or by repeating
+// the flag.
+type commandList []string
+
+// String implements flag.Value.
+func (l *commandList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set implements flag.Value.
+func (l *commandList) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			*l = append(*l, name)
+		}
+	}
+	return nil
+}
+
+// isPiped reports whether stdin is a pipe or file rather than a terminal, so a script can be
+// read from it.
+func isPiped(stdin io.Reader) bool {
+	file, ok := stdin.(*os.File)
+	if !ok {
+		return stdin != nil
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+// blockedVerdict returns the verdict of v on script in workingDir when it is blocked, nil
+// when it is allowed or there is no script, e.g. for a script file.
+func blockedVerdict(v *validator.CommandValidator, script, workingDir string) *validator.ValidationResult {
+	if script == "" {
+		return nil
+	}
+	dir, err := filepath.Abs(workingDir)
+	if err != nil {
+		return nil
+	}
+	verdict := v.ValidateDirectory(dir)
+	if verdict.Allowed {
+		verdict = v.CheckScript(context.Background(), script, dir)
+	}
+	if verdict.Allowed {
+		return nil
+	}
+	return &verdict
+}
+
+// logSinks converts the configured log sinks for logger.Open.
+func logSinks(sinks []config.LogSink) []logger.Sink {
+	converted := make([]logger.Sink, len(sinks))
+	for i, sink := range sinks {
+		converted[i] = logger.Sink(sink)
+	}
+	return converted
+}
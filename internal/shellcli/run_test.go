@@ -0,0 +1,108 @@
+package shellcli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/runner"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	assert.NoError(t, os.WriteFile(configPath, []byte(`{
+		"allowedDirectories": ["`+dir+`"],
+		"allowCommands": ["echo"],
+		"denyCommands": [{"command": "rm", "message": "no rm"}]
+	}`), 0o600))
+
+	// run runs the CLI with args and stdin and returns its exit code, stdout and stderr
+	run := func(stdin string, args ...string) (int, string, string) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		code := Run("secure-shell", append([]string{"-config", configPath, "-dir", dir}, args...),
+			strings.NewReader(stdin), &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+
+	t.Run("script from stdin", func(t *testing.T) {
+		code, stdout, _ := run("echo one\necho two\n", "-script", "-")
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "one\ntwo\n", stdout)
+	})
+
+	t.Run("piped script without flags", func(t *testing.T) {
+		code, stdout, _ := run("echo piped\n")
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "piped\n", stdout)
+	})
+
+	t.Run("empty stdin", func(t *testing.T) {
+		code, _, stderr := run("", "-script", "-")
+		assert.Equal(t, 1, code)
+		assert.Contains(t, stderr, "empty")
+	})
+
+	t.Run("allow and deny flags", func(t *testing.T) {
+		code, stdout, _ := run("", "-allow", "pwd,true", "-script", "pwd && true")
+		assert.Equal(t, 0, code)
+		assert.Equal(t, dir+"\n", stdout)
+
+		code, _, stderr := run("", "-deny", "echo", "-script", "echo hi")
+		assert.Equal(t, 1, code)
+		assert.Contains(t, stderr, `"echo" is denied`)
+
+		// Denied commands stay denied
+		code, _, _ = run("", "-allow", "rm", "-script", "rm -rf build")
+		assert.Equal(t, 1, code)
+	})
+
+	t.Run("preflight", func(t *testing.T) {
+		code, stdout, _ := run("", "-script", "echo ok; rm -rf build")
+		assert.Equal(t, 1, code)
+		assert.Equal(t, "ok\n", stdout)
+
+		code, stdout, _ = run("", "-preflight", "-script", "echo ok; rm -rf build")
+		assert.Equal(t, 1, code)
+		assert.Equal(t, "", stdout)
+	})
+
+	t.Run("stop on error", func(t *testing.T) {
+		code, stdout, _ := run("", "-allow", "false", "-script", "false; echo after")
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "after\n", stdout)
+
+		code, stdout, _ = run("", "-allow", "false", "-stop-on-error", "-output", OutputJSON, "-script", "false; echo after")
+		assert.Equal(t, 1, code)
+		var result Result
+		assert.NoError(t, json.Unmarshal([]byte(stdout), &result))
+		assert.Equal(t, 2, len(result.Steps))
+		assert.Equal(t, runner.StepSkipped, result.Steps[1].Status)
+	})
+
+	t.Run("json output", func(t *testing.T) {
+		code, stdout, _ := run("", "-output", OutputJSON, "-script", "echo hi")
+		assert.Equal(t, 0, code)
+		var result Result
+		assert.NoError(t, json.Unmarshal([]byte(stdout), &result))
+		assert.Equal(t, "hi\n", result.Stdout)
+		assert.Equal(t, 0, result.ExitCode)
+		assert.Equal(t, 1, len(result.Commands))
+	})
+
+	t.Run("json output of a blocked script", func(t *testing.T) {
+		code, stdout, _ := run("", "-output", OutputJSON, "-script", "rm -rf build")
+		assert.Equal(t, 1, code)
+		var result Result
+		assert.NoError(t, json.Unmarshal([]byte(stdout), &result))
+		assert.Equal(t, -1, result.ExitCode)
+		assert.Equal(t, 1, len(result.Blocked))
+		assert.Equal(t, "denyCommands[rm]", result.Blocked[0].Rule)
+	})
+}
@@ -4,11 +4,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Default execution timeout in seconds.
 const DefaultExecutionTimeout = 120
 
+// Default time in seconds a cancelled command's process group is given to exit after
+// SIGTERM before it is killed.
+const DefaultKillGracePeriod = 2
+
 // Default max output size in bytes (50KB).
 const DefaultMaxOutputSize = 50 * 1024
 
@@ -16,6 +24,8 @@ const DefaultMaxOutputSize = 50 * 1024
 type DenyCommand struct {
 	Command string `json:"command"`
 	Message string `json:"message,omitempty"`
+	// DocURL links to documentation explaining the denial and its alternatives
+	DocURL string `json:"docUrl,omitempty"`
 }
 
 // SubCommandRule represents a recursive subcommand rule node.
@@ -26,6 +36,8 @@ type SubCommandRule struct {
 	SubCommands     []SubCommandRule `json:"subCommands,omitempty"`
 	DenySubCommands []string         `json:"denySubCommands,omitempty"`
 	Message         string           `json:"message,omitempty"`
+	// DocURL links to documentation for this subcommand (inherited by nested rules without one)
+	DocURL string `json:"docUrl,omitempty"`
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface for SubCommandRule.
@@ -53,6 +65,478 @@ type AllowCommand struct {
 	Command         string           `json:"command"`
 	SubCommands     []SubCommandRule `json:"subCommands,omitempty"`
 	DenySubCommands []string         `json:"denySubCommands,omitempty"`
+	// DenyFlags lists flags that are denied anywhere in the command's arguments (e.g. "-delete" for find)
+	DenyFlags []string `json:"denyFlags,omitempty"`
+	// Message is a custom error message for denied flags
+	Message string `json:"message,omitempty"`
+	// Sha256 is the optional hex-encoded SHA-256 digest the resolved binary must match
+	Sha256 string `json:"sha256,omitempty"`
+	// AllowedHours restricts the command to time ranges like "09:00-18:00" (may wrap past midnight)
+	AllowedHours []string `json:"allowedHours,omitempty"`
+	// AllowedDays restricts the command to weekdays like "Mon" or "Friday"
+	AllowedDays []string `json:"allowedDays,omitempty"`
+	// RateLimit optionally limits how often the command may run
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+	// DocURL links to documentation shown when the command is blocked by one of its rules
+	DocURL string `json:"docUrl,omitempty"`
+	// Timeout is the maximum execution time in seconds for each run of the command, applied in
+	// addition to MaxExecutionTime (0 means only MaxExecutionTime applies)
+	Timeout int `json:"timeout,omitempty"`
+	// PTY runs the command on a pseudo-terminal instead of pipes, for tools that require a TTY.
+	// Its stdout and stderr are merged and it gets no input.
+	PTY bool `json:"pty,omitempty"`
+	// InspectScript controls inspection of awk programs and sed scripts for command execution
+	// and writes outside allowed directories (nil means enabled)
+	InspectScript *bool `json:"inspectScript,omitempty"`
+}
+
+// ScriptInspectionEnabled reports whether awk/sed scripts passed to the command are inspected.
+func (a *AllowCommand) ScriptInspectionEnabled() bool {
+	return a.InspectScript == nil || *a.InspectScript
+}
+
+// RateLimit allows at most Count executions per Per duration (e.g. "1m"), refilled continuously.
+type RateLimit struct {
+	Count int    `json:"count"`
+	Per   string `json:"per"`
+}
+
+// ResourceLimits holds rlimits applied to processes spawned for external commands.
+// Zero values leave the corresponding limit unchanged.
+type ResourceLimits struct {
+	// CPUSeconds is the CPU time limit in seconds (RLIMIT_CPU)
+	CPUSeconds uint64 `json:"cpuSeconds,omitempty"`
+	// MemoryBytes is the maximum size of the address space in bytes (RLIMIT_AS)
+	MemoryBytes uint64 `json:"memoryBytes,omitempty"`
+	// OpenFiles is the maximum number of open file descriptors (RLIMIT_NOFILE)
+	OpenFiles uint64 `json:"openFiles,omitempty"`
+}
+
+// IsSet reports whether any limit is configured.
+func (l *ResourceLimits) IsSet() bool {
+	return l != nil && (l.CPUSeconds > 0 || l.MemoryBytes > 0 || l.OpenFiles > 0)
+}
+
+// DefaultCgroupParent is the cgroup v2 directory transient cgroups are created under by default.
+const DefaultCgroupParent = "/sys/fs/cgroup"
+
+// CgroupConfig configures the transient cgroup v2 each script execution is placed in.
+// Empty or zero limits are left at the kernel default (unlimited).
+type CgroupConfig struct {
+	// Parent is the cgroup v2 directory transient cgroups are created under; it must be
+	// writable by the server (defaults to DefaultCgroupParent)
+	Parent string `json:"parent,omitempty"`
+	// CPUMax is written to cpu.max, e.g. "50000 100000" for half a CPU
+	CPUMax string `json:"cpuMax,omitempty"`
+	// MemoryMax is written to memory.max, in bytes
+	MemoryMax uint64 `json:"memoryMax,omitempty"`
+	// PidsMax is written to pids.max
+	PidsMax uint64 `json:"pidsMax,omitempty"`
+}
+
+// GetParent returns the configured parent cgroup, falling back to DefaultCgroupParent.
+func (c *CgroupConfig) GetParent() string {
+	if c.Parent != "" {
+		return c.Parent
+	}
+	return DefaultCgroupParent
+}
+
+// SeccompConfig configures the seccomp-bpf filter applied to spawned processes.
+type SeccompConfig struct {
+	// DenySyscalls lists system calls that fail with EPERM, by name or by number for the
+	// server's architecture (defaults to DefaultSeccompDenySyscalls when empty)
+	DenySyscalls []string `json:"denySyscalls,omitempty"`
+}
+
+// DefaultSeccompDenySyscalls returns the system calls denied when no denySyscalls are configured:
+// process tracing, mounting, rebooting and kernel module or kernel image loading.
+func DefaultSeccompDenySyscalls() []string {
+	return []string{
+		"ptrace", "mount", "umount2", "reboot",
+		"init_module", "finit_module", "delete_module", "kexec_load", "kexec_file_load",
+	}
+}
+
+// GetDenySyscalls returns the configured denied system calls, falling back to DefaultSeccompDenySyscalls.
+func (c *SeccompConfig) GetDenySyscalls() []string {
+	if len(c.DenySyscalls) > 0 {
+		return c.DenySyscalls
+	}
+	return DefaultSeccompDenySyscalls()
+}
+
+// SandboxConfig configures the namespaces external commands run in. The sandbox's filesystem
+// contains only the allowed directories (read-write), ReadOnlyPaths, a private /tmp, a minimal
+// /dev and the sandbox's own /proc.
+type SandboxConfig struct {
+	// ReadOnlyPaths are bind-mounted read-only so that commands and their libraries can be
+	// found (defaults to DefaultSandboxReadOnlyPaths when empty)
+	ReadOnlyPaths []string `json:"readOnlyPaths,omitempty"`
+	// AllowNetwork keeps the host network instead of an isolated network namespace
+	AllowNetwork bool `json:"allowNetwork,omitempty"`
+}
+
+// DefaultSandboxReadOnlyPaths returns the paths mounted read-only in the sandbox when no
+// readOnlyPaths are configured. Paths that do not exist on the host are skipped.
+func DefaultSandboxReadOnlyPaths() []string {
+	return []string{"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64"}
+}
+
+// GetReadOnlyPaths returns the configured read-only paths, falling back to DefaultSandboxReadOnlyPaths.
+func (c *SandboxConfig) GetReadOnlyPaths() []string {
+	if len(c.ReadOnlyPaths) > 0 {
+		return c.ReadOnlyPaths
+	}
+	return DefaultSandboxReadOnlyPaths()
+}
+
+// Defaults for containerized execution.
+const (
+	DefaultContainerRuntime = "docker"
+	DefaultContainerNetwork = "none"
+)
+
+// ContainerConfig runs every external command in a short-lived container instead of on the
+// host. The allowed directories are bind-mounted at the same paths.
+type ContainerConfig struct {
+	// Runtime is the container CLI to use, e.g. "docker" or "podman", looked up in the server's
+	// PATH (defaults to DefaultContainerRuntime)
+	Runtime string `json:"runtime,omitempty"`
+	// Image is the image commands run in
+	Image string `json:"image"`
+	// Network is the container network (defaults to DefaultContainerNetwork, i.e. no network)
+	Network string `json:"network,omitempty"`
+	// User is the user commands run as (defaults to the server's own uid:gid)
+	User string `json:"user,omitempty"`
+	// ExtraArgs are passed to the runtime's run command before the image, e.g. "--memory=1g"
+	ExtraArgs []string `json:"extraArgs,omitempty"`
+}
+
+// GetRuntime returns the configured container runtime, falling back to DefaultContainerRuntime.
+func (c *ContainerConfig) GetRuntime() string {
+	if c.Runtime != "" {
+		return c.Runtime
+	}
+	return DefaultContainerRuntime
+}
+
+// GetNetwork returns the configured container network, falling back to DefaultContainerNetwork.
+func (c *ContainerConfig) GetNetwork() string {
+	if c.Network != "" {
+		return c.Network
+	}
+	return DefaultContainerNetwork
+}
+
+// Default pseudo-terminal settings for commands with PTY enabled.
+const (
+	DefaultPTYTerm = "xterm-256color"
+	DefaultPTYRows = 24
+	DefaultPTYCols = 80
+)
+
+// PTYConfig configures the pseudo-terminal allocated for commands with PTY enabled.
+type PTYConfig struct {
+	// Term is the value TERM is forced to (defaults to DefaultPTYTerm)
+	Term string `json:"term,omitempty"`
+	// Rows and Cols set the window size (default to DefaultPTYRows and DefaultPTYCols)
+	Rows uint16 `json:"rows,omitempty"`
+	Cols uint16 `json:"cols,omitempty"`
+}
+
+// GetTerm returns the configured TERM value, falling back to DefaultPTYTerm. A nil config
+// uses the defaults.
+func (c *PTYConfig) GetTerm() string {
+	if c != nil && c.Term != "" {
+		return c.Term
+	}
+	return DefaultPTYTerm
+}
+
+// GetRows returns the configured number of rows, falling back to DefaultPTYRows.
+func (c *PTYConfig) GetRows() uint16 {
+	if c != nil && c.Rows > 0 {
+		return c.Rows
+	}
+	return DefaultPTYRows
+}
+
+// GetCols returns the configured number of columns, falling back to DefaultPTYCols.
+func (c *PTYConfig) GetCols() uint16 {
+	if c != nil && c.Cols > 0 {
+		return c.Cols
+	}
+	return DefaultPTYCols
+}
+
+// Default limits of persistent shell sessions.
+const (
+	DefaultMaxSessions        = 16
+	DefaultSessionIdleTimeout = 30 * 60
+	DefaultSessionMaxLifetime = 8 * 60 * 60
+)
+
+// SessionConfig limits persistent shell sessions.
+type SessionConfig struct {
+	// MaxSessions is the number of sessions that may be open at once (defaults to DefaultMaxSessions)
+	MaxSessions int `json:"maxSessions,omitempty"`
+	// IdleTimeout is the time in seconds after its last run a session is closed
+	// (defaults to DefaultSessionIdleTimeout)
+	IdleTimeout int `json:"idleTimeout,omitempty"`
+	// MaxLifetime is the time in seconds after its creation a session is closed
+	// (defaults to DefaultSessionMaxLifetime)
+	MaxLifetime int `json:"maxLifetime,omitempty"`
+}
+
+// GetMaxSessions returns the configured session limit, falling back to DefaultMaxSessions.
+// A nil config uses the defaults.
+func (c *SessionConfig) GetMaxSessions() int {
+	if c != nil && c.MaxSessions > 0 {
+		return c.MaxSessions
+	}
+	return DefaultMaxSessions
+}
+
+// GetIdleTimeout returns the configured idle timeout, falling back to DefaultSessionIdleTimeout.
+func (c *SessionConfig) GetIdleTimeout() time.Duration {
+	if c != nil && c.IdleTimeout > 0 {
+		return time.Duration(c.IdleTimeout) * time.Second
+	}
+	return DefaultSessionIdleTimeout * time.Second
+}
+
+// GetMaxLifetime returns the configured lifetime, falling back to DefaultSessionMaxLifetime.
+func (c *SessionConfig) GetMaxLifetime() time.Duration {
+	if c != nil && c.MaxLifetime > 0 {
+		return time.Duration(c.MaxLifetime) * time.Second
+	}
+	return DefaultSessionMaxLifetime * time.Second
+}
+
+// DefaultQuotaWindow is the length in seconds of a quota window when window is 0.
+const DefaultQuotaWindow = 3600
+
+// QuotaConfig limits the tool calls of each client per time window. A client's window starts
+// with its first call and its usage resets when the window ends.
+type QuotaConfig struct {
+	// Window is the length of a window in seconds (defaults to DefaultQuotaWindow)
+	Window int `json:"window,omitempty"`
+	// MaxCalls is the number of tool calls a client may make per window (0 means unlimited)
+	MaxCalls int `json:"maxCalls,omitempty"`
+	// MaxExecutionSeconds is the total time in seconds a client's tool calls may take per
+	// window (0 means unlimited). A call is stopped when it uses up the rest.
+	MaxExecutionSeconds int `json:"maxExecutionSeconds,omitempty"`
+}
+
+// GetWindow returns the configured window, falling back to DefaultQuotaWindow.
+func (c *QuotaConfig) GetWindow() time.Duration {
+	if c != nil && c.Window > 0 {
+		return time.Duration(c.Window) * time.Second
+	}
+	return DefaultQuotaWindow * time.Second
+}
+
+// Defaults of the execution history retention.
+const (
+	// DefaultHistoryMaxAgeDays is the number of days records are kept when maxAgeDays is 0.
+	DefaultHistoryMaxAgeDays = 30
+	// DefaultHistoryMaxRecords is the number of records kept when maxRecords is 0.
+	DefaultHistoryMaxRecords = 10000
+)
+
+// HistoryConfig configures the persistent execution history.
+type HistoryConfig struct {
+	// Path is the SQLite database the history is stored in
+	Path string `json:"path"`
+	// MaxAgeDays is how many days records are kept (defaults to DefaultHistoryMaxAgeDays)
+	MaxAgeDays int `json:"maxAgeDays,omitempty"`
+	// MaxRecords is the number of records kept, the oldest being dropped first (defaults to
+	// DefaultHistoryMaxRecords)
+	MaxRecords int `json:"maxRecords,omitempty"`
+}
+
+// GetMaxAge returns how long records are kept, falling back to DefaultHistoryMaxAgeDays.
+func (c *HistoryConfig) GetMaxAge() time.Duration {
+	days := DefaultHistoryMaxAgeDays
+	if c != nil && c.MaxAgeDays > 0 {
+		days = c.MaxAgeDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// GetMaxRecords returns the number of records kept, falling back to DefaultHistoryMaxRecords.
+func (c *HistoryConfig) GetMaxRecords() int {
+	if c != nil && c.MaxRecords > 0 {
+		return c.MaxRecords
+	}
+	return DefaultHistoryMaxRecords
+}
+
+// DefaultMaxWriteFileSize is the largest content in bytes write_file accepts when
+// maxFileSize is 0.
+const DefaultMaxWriteFileSize = 1 << 20
+
+// WriteFileConfig limits the files the write_file tool may write, in addition to the
+// allowed, denied and read-only directories.
+type WriteFileConfig struct {
+	// MaxFileSize is the largest content in bytes that may be written (defaults to
+	// DefaultMaxWriteFileSize when 0)
+	MaxFileSize int `json:"maxFileSize,omitempty"`
+	// AllowedExtensions lists the file extensions that may be written, e.g. ".go" or ".md";
+	// all are allowed when empty
+	AllowedExtensions []string `json:"allowedExtensions,omitempty"`
+}
+
+// GetMaxFileSize returns the largest content write_file accepts.
+func (c *WriteFileConfig) GetMaxFileSize() int {
+	if c != nil && c.MaxFileSize > 0 {
+		return c.MaxFileSize
+	}
+	return DefaultMaxWriteFileSize
+}
+
+// IsExtensionAllowed reports whether write_file may write the file path by its extension.
+// Extensions are compared case-insensitively, with or without the leading dot.
+func (c *WriteFileConfig) IsExtensionAllowed(path string) bool {
+	if c == nil || len(c.AllowedExtensions) == 0 {
+		return true
+	}
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	if ext == "" {
+		return false
+	}
+	for _, allowed := range c.AllowedExtensions {
+		if strings.EqualFold(strings.TrimPrefix(allowed, "."), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Defaults of ListDirectoryConfig.
+const (
+	// DefaultListMaxDepth is how deep list_directory descends at most when maxDepth is 0.
+	DefaultListMaxDepth = 5
+	// DefaultListMaxEntries is the most entries list_directory returns at once when
+	// maxEntries is 0.
+	DefaultListMaxEntries = 500
+)
+
+// ListDirectoryConfig limits the list_directory tool.
+type ListDirectoryConfig struct {
+	// MaxDepth is how many levels below the listed directory may be listed (defaults to
+	// DefaultListMaxDepth when 0)
+	MaxDepth int `json:"maxDepth,omitempty"`
+	// MaxEntries is the most entries returned at once (defaults to DefaultListMaxEntries when 0)
+	MaxEntries int `json:"maxEntries,omitempty"`
+}
+
+// GetMaxDepth returns how deep list_directory descends at most.
+func (c *ListDirectoryConfig) GetMaxDepth() int {
+	if c != nil && c.MaxDepth > 0 {
+		return c.MaxDepth
+	}
+	return DefaultListMaxDepth
+}
+
+// GetMaxEntries returns the most entries list_directory returns at once.
+func (c *ListDirectoryConfig) GetMaxEntries() int {
+	if c != nil && c.MaxEntries > 0 {
+		return c.MaxEntries
+	}
+	return DefaultListMaxEntries
+}
+
+// ScriptLimits caps the size of a submitted script, checked when it is parsed. Zero values
+// leave the corresponding limit unset.
+type ScriptLimits struct {
+	// MaxCommands is the number of simple commands the script may contain
+	MaxCommands int `json:"maxCommands,omitempty"`
+	// MaxPipelineStages is the number of commands a single pipeline may have
+	MaxPipelineStages int `json:"maxPipelineStages,omitempty"`
+	// MaxNestingDepth is how deeply compound commands (loops, conditionals, groups,
+	// subshells, functions and command substitutions) may be nested
+	MaxNestingDepth int `json:"maxNestingDepth,omitempty"`
+}
+
+// EnvPolicy restricts the variables of environments injected with SafeRunner.SetEnv and
+// chooses which of the server's variables scripts see by default. Names ending in "*" match
+// every variable with that prefix.
+type EnvPolicy struct {
+	// AllowVars lists the variables that may be set; all variables are allowed when empty
+	AllowVars []string `json:"allowVars,omitempty"`
+	// DenyVars lists variables that are always dropped (defaults to DefaultEnvDenyVars when empty)
+	DenyVars []string `json:"denyVars,omitempty"`
+	// PassVars lists variables of the server's environment passed to scripts in addition to
+	// DefaultEnvPassVars
+	PassVars []string `json:"passVars,omitempty"`
+	// Inherit passes the server's whole environment to scripts instead of a minimal one
+	Inherit bool `json:"inherit,omitempty"`
+}
+
+// DefaultEnvPassVars returns the variables of the server's environment every script sees
+// unless the environment is set explicitly.
+func DefaultEnvPassVars() []string {
+	return []string{"PATH", "HOME", "LANG"}
+}
+
+// BaseEnv returns the environment scripts run with when none is set explicitly, taken from
+// environ, the server's environment: all of it if Inherit is set, otherwise only
+// DefaultEnvPassVars and PassVars. A nil policy passes DefaultEnvPassVars.
+func (p *EnvPolicy) BaseEnv(environ []string) []string {
+	if p != nil && p.Inherit {
+		return environ
+	}
+	passVars := DefaultEnvPassVars()
+	if p != nil {
+		passVars = append(passVars, p.PassVars...)
+	}
+	env := []string{}
+	for _, entry := range environ {
+		name, _, ok := strings.Cut(entry, "=")
+		if ok && matchEnvVar(passVars, name) {
+			env = append(env, entry)
+		}
+	}
+	return env
+}
+
+// DefaultEnvDenyVars returns the variables dropped when no denyVars are configured: those that
+// make the dynamic loader or a shell run code the command did not ask for.
+func DefaultEnvDenyVars() []string {
+	return []string{"LD_PRELOAD", "LD_LIBRARY_PATH", "LD_AUDIT", "BASH_ENV", "ENV"}
+}
+
+// IsVarAllowed reports whether the variable name may appear in an injected environment.
+// A nil policy only applies DefaultEnvDenyVars.
+func (p *EnvPolicy) IsVarAllowed(name string) bool {
+	denyVars := DefaultEnvDenyVars()
+	var allowVars []string
+	if p != nil {
+		if len(p.DenyVars) > 0 {
+			denyVars = p.DenyVars
+		}
+		allowVars = p.AllowVars
+	}
+	if matchEnvVar(denyVars, name) {
+		return false
+	}
+	return len(allowVars) == 0 || matchEnvVar(allowVars, name)
+}
+
+// matchEnvVar reports whether name matches one of the patterns.
+func matchEnvVar(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if pattern == name {
+			return true
+		}
+	}
+	return false
 }
 
 // ShellCommandConfig holds the configuration for shell command permissions.
@@ -62,26 +546,382 @@ type ShellCommandConfig struct {
 	DenyCommands        []DenyCommand  `json:"denyCommands"`
 	DefaultErrorMessage string         `json:"defaultErrorMessage"`
 	BlockLogPath        string         `json:"blockLogPath,omitempty"`
+	// DenyPaths lists files and directories inside the allowed directories that are never
+	// accessible, e.g. credentials
+	DenyPaths []string `json:"denyPaths,omitempty"`
+	// ReadOnlyDirectories lists directories inside the allowed directories whose files may be
+	// read but not opened for writing by redirections
+	ReadOnlyDirectories []string `json:"readOnlyDirectories,omitempty"`
+	// LogFormat is the format of the server log: "text" (default) or "json", one object per line
+	LogFormat string `json:"logFormat,omitempty"`
+	// LogTarget is where the server log is written: "file" (default, the -log path), "syslog"
+	// or "journald"
+	LogTarget string `json:"logTarget,omitempty"`
+	// LogSinks are further destinations of the server log, each with its own target, level
+	// and format
+	LogSinks []LogSink `json:"logSinks,omitempty"`
+	// Syslog sets the facility and tag of the syslog and journald log targets
+	Syslog *SyslogConfig `json:"syslog,omitempty"`
+	// LogRotation rotates the server log and the block log by size and age (nil never rotates)
+	LogRotation *LogRotation `json:"logRotation,omitempty"`
+	// UnixSocket serves the HTTP transport on a unix domain socket instead of the TCP port
+	// (nil listens on the port)
+	UnixSocket *UnixSocketConfig `json:"unixSocket,omitempty"`
+	// TLS serves the HTTP transport over TLS (nil serves plain HTTP)
+	TLS *TLSConfig `json:"tls,omitempty"`
+	// AuthTokens are the tokens the HTTP transport accepts, each naming its client. When
+	// empty, the HTTP transport accepts every request.
+	AuthTokens []AuthToken `json:"authTokens,omitempty"`
+	// OIDC accepts JWT bearer tokens issued by an OpenID Connect provider on the HTTP transport
+	OIDC *OIDCConfig `json:"oidc,omitempty"`
+	// WebSocket serves the WebSocket transport next to the HTTP transport (nil does not)
+	WebSocket *WebSocketConfig `json:"webSocket,omitempty"`
+	// RESTAPI serves the REST API for automation that does not speak MCP next to the HTTP
+	// transport, with the same authentication
+	RESTAPI bool `json:"restApi,omitempty"`
+	// GRPC serves the gRPC transport on a port of its own next to the HTTP transport, with
+	// the same authentication and TLS (nil does not)
+	GRPC *GRPCConfig `json:"grpc,omitempty"`
+	// RequireApproval lists commands that run only once a human approves them, each a command
+	// name optionally followed by the arguments it applies to, e.g. "git push". Calls running
+	// them are queued and return a ticket instead.
+	RequireApproval []string `json:"requireApproval,omitempty"`
+	// AdminTokens are the tokens of the humans who use the admin endpoints, approving or
+	// rejecting queued commands and querying the execution history, each naming its admin.
+	// They must differ from AuthTokens, so clients cannot approve their own commands. When
+	// empty, the admin endpoints are not served.
+	AdminTokens []AuthToken `json:"adminTokens,omitempty"`
+	// AdminAddr is the address the admin endpoints listen on when the server uses the stdio
+	// transport, e.g. "127.0.0.1:8081" (empty serves them only with the HTTP transport)
+	AdminAddr string `json:"adminAddr,omitempty"`
+	// Profiles are named policies that replace this one for the clients mapped to them by
+	// ClientProfiles. Log destinations left empty in a profile are taken from this config;
+	// server settings such as logging, the transport and authentication are ignored in profiles.
+	Profiles map[string]*ShellCommandConfig `json:"profiles,omitempty"`
+	// ClientProfiles maps authenticated client names to the profile that applies to them.
+	// Other clients get the policy of this config.
+	ClientProfiles map[string]string `json:"clientProfiles,omitempty"`
+	// LogLevel is the minimum level of the server log: "debug", "info" (default), "warn" or "error"
+	LogLevel string `json:"logLevel,omitempty"`
+	// History keeps a persistent history of every execution (nil keeps none). It is a server
+	// setting, shared by all profiles.
+	History *HistoryConfig `json:"history,omitempty"`
+	// AuditLogPath is a file every run is recorded in as one JSON line (empty disables the audit log)
+	AuditLogPath string `json:"auditLogPath,omitempty"`
+	// OutputLogDir is a directory the complete stdout and stderr of every run are written to,
+	// regardless of MaxOutputSize (empty disables output logs)
+	OutputLogDir string `json:"outputLogDir,omitempty"`
+	// SpoolDir is a directory the complete stdout and stderr of runs whose output is truncated
+	// are kept in, named in the truncation message (ignored when OutputLogDir is set)
+	SpoolDir string `json:"spoolDir,omitempty"`
 	// MaxExecutionTime is the maximum execution time in seconds (0 means unlimited)
 	MaxExecutionTime int `json:"maxExecutionTime,omitempty"`
+	// MaxCallTimeout is the longest time limit in seconds a call may request for its run,
+	// e.g. with the run tool's timeout_seconds (0 means MaxExecutionTime)
+	MaxCallTimeout int `json:"maxCallTimeout,omitempty"`
 	// MaxOutputSize is the maximum size of command output in bytes (0 means unlimited)
 	MaxOutputSize int `json:"maxOutputSize,omitempty"`
+	// MaxStdoutSize and MaxStderrSize limit the size of each stream in bytes on its own, so a
+	// chatty stdout cannot hide errors (nil means MaxOutputSize applies, 0 means unlimited)
+	MaxStdoutSize *int `json:"maxStdoutSize,omitempty"`
+	MaxStderrSize *int `json:"maxStderrSize,omitempty"`
+	// MaxOutputLines is the maximum number of lines of command output (0 means unlimited);
+	// output is truncated at whichever of MaxOutputSize and MaxOutputLines is reached first
+	MaxOutputLines int `json:"maxOutputLines,omitempty"`
+	// StripANSI removes ANSI color and cursor control sequences from the output before it is
+	// limited
+	StripANSI bool `json:"stripAnsi,omitempty"`
+	// OutputMode is the part of the output kept when it is truncated: OutputModeHead (default),
+	// OutputModeTail or OutputModeHeadTail
+	OutputMode string `json:"outputMode,omitempty"`
+	// KillGracePeriod is the time in seconds between SIGTERM and SIGKILL when a command's
+	// process group is stopped (defaults to DefaultKillGracePeriod when 0)
+	KillGracePeriod int `json:"killGracePeriod,omitempty"`
+	// CreateWorkingDir creates the working directory of a run if it is inside an allowed
+	// directory but does not exist yet
+	CreateWorkingDir bool `json:"createWorkingDir,omitempty"`
+	// PreflightValidation validates every command of a script before any of it runs, so a
+	// script with a blocked command has no effect instead of stopping at that command
+	PreflightValidation bool `json:"preflightValidation,omitempty"`
+	// StopOnError runs scripts with set -e semantics: a script stops at the first command
+	// that fails instead of continuing with the next one
+	StopOnError bool `json:"stopOnError,omitempty"`
+	// WorkingDir is the working directory of sessions that have not set one, an absolute
+	// directory inside the allowed directories. When empty, it is the PWD with UseEnvPwd, or
+	// else the first allowed directory.
+	WorkingDir string `json:"workingDir,omitempty"`
 	// UseEnvPwd uses the PWD environment variable as the default working directory when true
 	UseEnvPwd bool `json:"useEnvPwd,omitempty"`
+	// ResolveCommandPath resolves external commands through PATH before execution and
+	// requires the binary to live in one of TrustedBinaryDirectories
+	ResolveCommandPath bool `json:"resolveCommandPath,omitempty"`
+	// TrustedBinaryDirectories lists directories that resolved binaries must live in
+	// (defaults to DefaultTrustedBinaryDirectories when empty)
+	TrustedBinaryDirectories []string `json:"trustedBinaryDirectories,omitempty"`
+	// Timezone is the IANA time zone used to evaluate allowedHours/allowedDays (empty means local time)
+	Timezone string `json:"timezone,omitempty"`
+	// ResourceLimits sets rlimits on the processes spawned for external commands (Linux only)
+	ResourceLimits *ResourceLimits `json:"resourceLimits,omitempty"`
+	// Cgroup places each script execution in a transient cgroup v2 (Linux only)
+	Cgroup *CgroupConfig `json:"cgroup,omitempty"`
+	// Seccomp applies a seccomp-bpf filter to spawned processes (Linux amd64/arm64 only)
+	Seccomp *SeccompConfig `json:"seccomp,omitempty"`
+	// Sandbox runs external commands in new mount, PID and network namespaces (Linux only)
+	Sandbox *SandboxConfig `json:"sandbox,omitempty"`
+	// Container runs external commands in short-lived Docker or Podman containers
+	Container *ContainerConfig `json:"container,omitempty"`
+	// PTY configures the pseudo-terminal of commands whose allow rule enables pty
+	PTY *PTYConfig `json:"pty,omitempty"`
+	// EnvPolicy filters environments injected with SafeRunner.SetEnv or the run tool's env parameter
+	EnvPolicy *EnvPolicy `json:"envPolicy,omitempty"`
+	// Quota limits the tool calls and their total execution time per client and time window
+	Quota *QuotaConfig `json:"quota,omitempty"`
+	// Session limits the number and lifetime of persistent shell sessions
+	Session *SessionConfig `json:"session,omitempty"`
+	// WriteFile limits the files the write_file tool may write
+	WriteFile *WriteFileConfig `json:"writeFile,omitempty"`
+	// ListDirectory limits the depth and number of entries of the list_directory tool
+	ListDirectory *ListDirectoryConfig `json:"listDirectory,omitempty"`
+	// ScriptLimits caps the number of commands, pipeline stages and nesting depth of scripts
+	ScriptLimits *ScriptLimits `json:"scriptLimits,omitempty"`
+	// MaxScriptSize is the largest script file in bytes RunScriptFile reads (defaults to
+	// DefaultMaxScriptSize when 0)
+	MaxScriptSize int `json:"maxScriptSize,omitempty"`
+	// Shebang is the policy for script files starting with "#!": ShebangIgnore (default),
+	// ShebangReject or ShebangHonor
+	Shebang string `json:"shebang,omitempty"`
+	// MessageTemplates maps validation codes (e.g. "COMMAND_NOT_ALLOWED") to Go text/template
+	// strings used to render the error message returned for blocked commands
+	MessageTemplates map[string]string `json:"messageTemplates,omitempty"`
+}
+
+// DefaultMaxScriptSize is the largest script file RunScriptFile reads when maxScriptSize is 0.
+const DefaultMaxScriptSize = 1 << 20
+
+// LogRotation configures rotation of log files. Its fields match logger.Rotation.
+type LogRotation struct {
+	// MaxSizeMB is the size in megabytes a log may reach before it is rotated (0 means unlimited)
+	MaxSizeMB int `json:"maxSizeMB,omitempty"`
+	// MaxBackups is the number of rotated files kept (0 keeps all)
+	MaxBackups int `json:"maxBackups,omitempty"`
+	// MaxAgeDays is the number of days rotated files are kept (0 keeps them regardless of age)
+	MaxAgeDays int `json:"maxAgeDays,omitempty"`
+	// Compress gzips rotated files
+	Compress bool `json:"compress,omitempty"`
+}
+
+// LogSink is a further destination of the server log. Its fields match logger.Sink.
+type LogSink struct {
+	// Target is "file", "stderr", "syslog", "journald" or "webhook"
+	Target string `json:"target"`
+	// Path is the log file of the file target
+	Path string `json:"path,omitempty"`
+	// URL is the endpoint of the webhook target, which receives each entry as JSON
+	URL string `json:"url,omitempty"`
+	// Format is "text" (default) or "json"
+	Format string `json:"format,omitempty"`
+	// Level is the minimum level written to this sink (default "info")
+	Level string `json:"level,omitempty"`
+}
+
+// SyslogConfig configures the syslog and journald log targets. Its fields match
+// logger.SyslogOptions.
+type SyslogConfig struct {
+	// Facility is the syslog facility name, e.g. "daemon" or "local0" (default "user")
+	Facility string `json:"facility,omitempty"`
+	// Tag identifies the server's entries (default "secure-shell-server")
+	Tag string `json:"tag,omitempty"`
+}
+
+// TLSConfig configures TLS for the HTTP transport.
+type TLSConfig struct {
+	// CertFile is the PEM file of the server certificate, followed by any intermediates
+	CertFile string `json:"certFile"`
+	// KeyFile is the PEM file of the server certificate's private key
+	KeyFile string `json:"keyFile"`
+	// ClientCAFile is a PEM file of the CAs client certificates must be signed by. When set,
+	// clients without a valid certificate are rejected.
+	ClientCAFile string `json:"clientCAFile,omitempty"`
+}
+
+// AuthToken is a token accepted by the HTTP transport as a bearer token or API key.
+type AuthToken struct {
+	// Token is the secret clients send
+	Token string `json:"token"`
+	// Client names the client the token belongs to, e.g. in the block log (default "default")
+	Client string `json:"client,omitempty"`
+}
+
+// OIDCConfig configures the validation of JWT bearer tokens issued by an OpenID Connect or
+// OAuth2 provider.
+type OIDCConfig struct {
+	// Issuer is the provider's issuer URL, which tokens must name in their iss claim
+	Issuer string `json:"issuer"`
+	// Audience is the value tokens must name in their aud claim, e.g. the server's client ID
+	Audience string `json:"audience"`
+	// JWKSURL is the URL of the provider's signing keys (default: the jwks_uri of the
+	// issuer's /.well-known/openid-configuration)
+	JWKSURL string `json:"jwksUrl,omitempty"`
+	// ClientClaim is the claim identifying the client (default "sub")
+	ClientClaim string `json:"clientClaim,omitempty"`
+}
+
+// WebSocketConfig configures the WebSocket transport.
+type WebSocketConfig struct {
+	// AllowedOrigins are the origins, e.g. "https://app.example.com", of the web pages that may
+	// connect. Browsers send the page's origin; connections from other origins than the server's
+	// own are refused unless listed. "*" allows every origin.
+	AllowedOrigins []string `json:"allowedOrigins,omitempty"`
+}
+
+// DefaultUnixSocketMode is the file mode of the unix socket when none is configured, letting
+// only the server's user connect.
+const DefaultUnixSocketMode os.FileMode = 0o600
+
+// UnixSocketConfig configures the unix domain socket of the HTTP transport.
+type UnixSocketConfig struct {
+	// Path is the path of the socket file. A socket left at the path by an earlier run is
+	// replaced; any other file is not.
+	Path string `json:"path"`
+	// Mode is the file mode of the socket in octal, e.g. "0660" to let the server's group
+	// connect (defaults to DefaultUnixSocketMode when empty)
+	Mode string `json:"mode,omitempty"`
+}
+
+// GetMode returns the file mode of the socket, falling back to DefaultUnixSocketMode.
+func (c *UnixSocketConfig) GetMode() (os.FileMode, error) {
+	if c.Mode == "" {
+		return DefaultUnixSocketMode, nil
+	}
+	mode, err := strconv.ParseUint(c.Mode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid unix socket mode %q: want octal permissions such as \"0660\"", c.Mode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// GRPCConfig configures the gRPC transport.
+type GRPCConfig struct {
+	// Port is the port the gRPC transport listens on
+	Port int `json:"port"`
+}
+
+// GetClientClaim returns the claim identifying the client, "sub" by default.
+func (c *OIDCConfig) GetClientClaim() string {
+	if c.ClientClaim != "" {
+		return c.ClientClaim
+	}
+	return "sub"
+}
+
+// GetProfile returns the policy of the named profile, with the log destinations it leaves
+// empty taken from c. It returns an error when the profile does not exist.
+func (c *ShellCommandConfig) GetProfile(name string) (*ShellCommandConfig, error) {
+	profile := c.Profiles[name]
+	if profile == nil {
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+
+	effective := *profile
+	if effective.BlockLogPath == "" {
+		effective.BlockLogPath = c.BlockLogPath
+	}
+	if effective.AuditLogPath == "" {
+		effective.AuditLogPath = c.AuditLogPath
+	}
+	if effective.OutputLogDir == "" {
+		effective.OutputLogDir = c.OutputLogDir
+	}
+	if effective.SpoolDir == "" {
+		effective.SpoolDir = c.SpoolDir
+	}
+	if effective.LogRotation == nil {
+		effective.LogRotation = c.LogRotation
+	}
+	return &effective, nil
+}
+
+// Effective returns a copy of c with the defaults that apply to unset settings filled in,
+// the policy the validator and runner enforce. Profiles are replaced with their effective
+// policies, as returned by GetProfile. c is not modified.
+func (c *ShellCommandConfig) Effective() *ShellCommandConfig {
+	effective := *c
+	effective.MaxCallTimeout = c.GetMaxCallTimeout()
+	stdoutSize, stderrSize := c.GetMaxStdoutSize(), c.GetMaxStderrSize()
+	effective.MaxStdoutSize, effective.MaxStderrSize = &stdoutSize, &stderrSize
+	effective.KillGracePeriod = int(c.GetKillGracePeriod() / time.Second)
+	effective.MaxScriptSize = c.GetMaxScriptSize()
+	if effective.OutputMode == "" {
+		effective.OutputMode = OutputModeHead
+	}
+	if effective.Shebang == "" {
+		effective.Shebang = ShebangIgnore
+	}
+	if effective.ResolveCommandPath {
+		effective.TrustedBinaryDirectories = c.GetTrustedBinaryDirectories()
+	}
+
+	if c.Profiles != nil {
+		effective.Profiles = make(map[string]*ShellCommandConfig, len(c.Profiles))
+		for name := range c.Profiles {
+			profile, _ := c.GetProfile(name)
+			effective.Profiles[name] = profile.Effective()
+		}
+	}
+	return &effective
+}
+
+// Output modes, the part of the output kept when it exceeds MaxOutputSize or MaxOutputLines.
+const (
+	// OutputModeHead keeps the beginning of the output, which is passed on as it is written.
+	OutputModeHead = "head"
+	// OutputModeTail keeps the end of the output, which is passed on when the script finishes.
+	OutputModeTail = "tail"
+	// OutputModeHeadTail keeps the first and the last half of the limits, with a marker of the
+	// omitted size in between; the end is passed on when the script finishes.
+	OutputModeHeadTail = "head+tail"
+)
+
+// Shebang policies for script files.
+const (
+	// ShebangIgnore runs every script file with the built-in shell; the shebang line is a comment.
+	ShebangIgnore = "ignore"
+	// ShebangReject refuses script files that start with a shebang line.
+	ShebangReject = "reject"
+	// ShebangHonor runs script files whose shebang names a shell with the built-in shell, and
+	// others with the named interpreter, which must be an allowed command.
+	ShebangHonor = "honor"
+)
+
+// DefaultTrustedBinaryDirectories returns the directories trusted to hold binaries
+// when resolveCommandPath is enabled and no trustedBinaryDirectories are configured.
+func DefaultTrustedBinaryDirectories() []string {
+	return []string{"/usr/bin", "/usr/local/bin"}
+}
+
+// GetTrustedBinaryDirectories returns the configured trusted binary directories,
+// falling back to DefaultTrustedBinaryDirectories.
+func (c *ShellCommandConfig) GetTrustedBinaryDirectories() []string {
+	if len(c.TrustedBinaryDirectories) > 0 {
+		return c.TrustedBinaryDirectories
+	}
+	return DefaultTrustedBinaryDirectories()
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface for ShellCommandConfig.
 func (c *ShellCommandConfig) UnmarshalJSON(data []byte) error {
-	var raw struct {
-		AllowedDirectories  []string        `json:"allowedDirectories"`
+	// Plain fields are decoded through an alias (to avoid infinite recursion);
+	// fields that need custom handling or defaults shadow them below.
+	type shellCommandConfigAlias ShellCommandConfig
+	raw := struct {
+		*shellCommandConfigAlias
 		AllowCommands       json.RawMessage `json:"allowCommands"`
 		DenyCommands        json.RawMessage `json:"denyCommands"`
 		DefaultErrorMessage string          `json:"defaultErrorMessage"`
-		BlockLogPath        string          `json:"blockLogPath,omitempty"`
 		MaxExecutionTime    *int            `json:"maxExecutionTime"`
 		MaxOutputSize       *int            `json:"maxOutputSize"`
 		UseEnvPwd           *bool           `json:"useEnvPwd,omitempty"`
-	}
+	}{shellCommandConfigAlias: (*shellCommandConfigAlias)(c)}
 
 	if err := json.Unmarshal(data, &raw); err != nil {
 		return err
@@ -99,7 +939,6 @@ func (c *ShellCommandConfig) UnmarshalJSON(data []byte) error {
 		return fmt.Errorf("error unmarshaling deny commands: %w", err)
 	}
 
-	c.AllowedDirectories = raw.AllowedDirectories
 	c.AllowCommands = allowCommands
 	c.DenyCommands = denyCommands
 
@@ -110,8 +949,6 @@ func (c *ShellCommandConfig) UnmarshalJSON(data []byte) error {
 		c.DefaultErrorMessage = "Command not allowed by security policy"
 	}
 
-	c.BlockLogPath = raw.BlockLogPath
-
 	// UseEnvPwd defaults to true unless explicitly set to false
 	if raw.UseEnvPwd != nil {
 		c.UseEnvPwd = *raw.UseEnvPwd
@@ -236,9 +1073,107 @@ func (c *ShellCommandConfig) IsCommandAllowed(cmd string) bool {
 	return false
 }
 
+// GetAllowCommand returns the allow rule for a command, or nil if the command is not allowed.
+func (c *ShellCommandConfig) GetAllowCommand(cmd string) *AllowCommand {
+	for i := range c.AllowCommands {
+		if c.AllowCommands[i].Command == cmd {
+			return &c.AllowCommands[i]
+		}
+	}
+	return nil
+}
+
+// HasPinnedBinaries reports whether any allowed command pins its binary with a checksum.
+func (c *ShellCommandConfig) HasPinnedBinaries() bool {
+	for _, allowed := range c.AllowCommands {
+		if allowed.Sha256 != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasCommandTimeouts reports whether any allowed command has its own timeout.
+func (c *ShellCommandConfig) HasCommandTimeouts() bool {
+	for _, allowed := range c.AllowCommands {
+		if allowed.Timeout > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// GetKillGracePeriod returns the configured kill grace period, falling back to DefaultKillGracePeriod.
+func (c *ShellCommandConfig) GetKillGracePeriod() time.Duration {
+	if c.KillGracePeriod > 0 {
+		return time.Duration(c.KillGracePeriod) * time.Second
+	}
+	return DefaultKillGracePeriod * time.Second
+}
+
+// GetMaxCallTimeout returns the longest time limit in seconds a call may request, falling
+// back to MaxExecutionTime. Zero means unlimited.
+func (c *ShellCommandConfig) GetMaxCallTimeout() int {
+	if c.MaxCallTimeout > 0 {
+		return c.MaxCallTimeout
+	}
+	return c.MaxExecutionTime
+}
+
+// GetMaxScriptSize returns the configured script size limit, falling back to DefaultMaxScriptSize.
+func (c *ShellCommandConfig) GetMaxScriptSize() int {
+	if c.MaxScriptSize > 0 {
+		return c.MaxScriptSize
+	}
+	return DefaultMaxScriptSize
+}
+
+// GetLogRotation returns the configured log rotation; the zero value never rotates.
+func (c *ShellCommandConfig) GetLogRotation() LogRotation {
+	if c.LogRotation != nil {
+		return *c.LogRotation
+	}
+	return LogRotation{}
+}
+
+// GetSyslog returns the configured syslog options; the zero value uses the defaults.
+func (c *ShellCommandConfig) GetSyslog() SyslogConfig {
+	if c.Syslog != nil {
+		return *c.Syslog
+	}
+	return SyslogConfig{}
+}
+
+// GetMaxStdoutSize returns the size limit of stdout, falling back to MaxOutputSize.
+func (c *ShellCommandConfig) GetMaxStdoutSize() int {
+	if c.MaxStdoutSize != nil {
+		return *c.MaxStdoutSize
+	}
+	return c.MaxOutputSize
+}
+
+// GetMaxStderrSize returns the size limit of stderr, falling back to MaxOutputSize.
+func (c *ShellCommandConfig) GetMaxStderrSize() int {
+	if c.MaxStderrSize != nil {
+		return *c.MaxStderrSize
+	}
+	return c.MaxOutputSize
+}
+
 // AddAllowedCommand adds a new command to the allowed commands list.
 func (c *ShellCommandConfig) AddAllowedCommand(cmd string) {
 	if !c.IsCommandAllowed(cmd) {
 		c.AllowCommands = append(c.AllowCommands, AllowCommand{Command: cmd})
 	}
 }
+
+// AddDeniedCommand adds a command to the denied commands list, refused with message (the
+// default error message when "").
+func (c *ShellCommandConfig) AddDeniedCommand(cmd, message string) {
+	for _, denied := range c.DenyCommands {
+		if denied.Command == cmd {
+			return
+		}
+	}
+	c.DenyCommands = append(c.DenyCommands, DenyCommand{Command: cmd, Message: message})
+}
@@ -379,3 +379,186 @@ func TestUnmarshalOmittedUsesDefaults(t *testing.T) {
 		t.Errorf("MaxOutputSize = %d, want %d", cfg.MaxOutputSize, DefaultMaxOutputSize)
 	}
 }
+
+func TestStreamSizeLimits(t *testing.T) {
+	configJSON := `{
+		"allowedDirectories": ["/tmp"],
+		"allowCommands": ["ls"],
+		"denyCommands": [],
+		"maxOutputSize": 1000,
+		"maxStderrSize": 0
+	}`
+
+	var cfg ShellCommandConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		t.Fatalf("Failed to unmarshal config: %v", err)
+	}
+
+	if got := cfg.GetMaxStdoutSize(); got != 1000 {
+		t.Errorf("GetMaxStdoutSize() = %d, want 1000 (maxOutputSize)", got)
+	}
+	if got := cfg.GetMaxStderrSize(); got != 0 {
+		t.Errorf("GetMaxStderrSize() = %d, want 0 (unlimited)", got)
+	}
+}
+
+func TestUnmarshalMessageTemplatesAndDocURLs(t *testing.T) {
+	configJSON := `{
+		"allowedDirectories": ["/tmp"],
+		"allowCommands": [
+			{"command": "git", "docUrl": "https://example.com/git", "subCommands": [
+				{"name": "push", "docUrl": "https://example.com/git-push"}
+			]}
+		],
+		"denyCommands": [{"command": "rm", "docUrl": "https://example.com/rm"}],
+		"messageTemplates": {"COMMAND_NOT_ALLOWED": "command {{.Cmd}} is blocked"}
+	}`
+
+	var cfg ShellCommandConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		t.Fatalf("Failed to unmarshal config: %v", err)
+	}
+
+	if got := cfg.AllowCommands[0].DocURL; got != "https://example.com/git" {
+		t.Errorf("AllowCommands[0].DocURL = %q, want %q", got, "https://example.com/git")
+	}
+	if got := cfg.AllowCommands[0].SubCommands[0].DocURL; got != "https://example.com/git-push" {
+		t.Errorf("SubCommands[0].DocURL = %q, want %q", got, "https://example.com/git-push")
+	}
+	if got := cfg.DenyCommands[0].DocURL; got != "https://example.com/rm" {
+		t.Errorf("DenyCommands[0].DocURL = %q, want %q", got, "https://example.com/rm")
+	}
+	if got := cfg.MessageTemplates["COMMAND_NOT_ALLOWED"]; got != "command {{.Cmd}} is blocked" {
+		t.Errorf("MessageTemplates[COMMAND_NOT_ALLOWED] = %q", got)
+	}
+}
+
+func TestGetProfile(t *testing.T) {
+	configJSON := `{
+		"allowedDirectories": ["/srv"],
+		"allowCommands": ["echo"],
+		"denyCommands": [],
+		"blockLogPath": "/var/log/blocked.log",
+		"profiles": {
+			"ci": {"allowedDirectories": ["/srv/ci"], "allowCommands": ["echo", "make"], "denyCommands": []},
+			"audited": {"allowedDirectories": ["/srv"], "allowCommands": [], "denyCommands": [], "blockLogPath": "/var/log/audited.log"}
+		},
+		"clientProfiles": {"ci-agent": "ci"}
+	}`
+
+	var cfg ShellCommandConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		t.Fatalf("Failed to unmarshal config: %v", err)
+	}
+	if got := cfg.ClientProfiles["ci-agent"]; got != "ci" {
+		t.Errorf("ClientProfiles[ci-agent] = %q, want %q", got, "ci")
+	}
+
+	ci, err := cfg.GetProfile("ci")
+	if err != nil {
+		t.Fatalf("GetProfile(ci) failed: %v", err)
+	}
+	if !ci.IsCommandAllowed("make") || ci.AllowedDirectories[0] != "/srv/ci" {
+		t.Errorf("GetProfile(ci) does not return the profile's policy: %+v", ci)
+	}
+	if ci.BlockLogPath != "/var/log/blocked.log" {
+		t.Errorf("GetProfile(ci).BlockLogPath = %q, want the top-level path", ci.BlockLogPath)
+	}
+	// Profiles are decoded with the same defaults as the top-level config
+	if ci.MaxExecutionTime != DefaultExecutionTimeout {
+		t.Errorf("GetProfile(ci).MaxExecutionTime = %d, want %d", ci.MaxExecutionTime, DefaultExecutionTimeout)
+	}
+	if cfg.Profiles["ci"].BlockLogPath != "" {
+		t.Error("GetProfile modified the profile")
+	}
+
+	audited, err := cfg.GetProfile("audited")
+	if err != nil {
+		t.Fatalf("GetProfile(audited) failed: %v", err)
+	}
+	if audited.BlockLogPath != "/var/log/audited.log" {
+		t.Errorf("GetProfile(audited).BlockLogPath = %q, want the profile's own path", audited.BlockLogPath)
+	}
+
+	if _, err := cfg.GetProfile("missing"); err == nil {
+		t.Error("GetProfile(missing) succeeded, want an error")
+	}
+}
+
+func TestWriteFileConfig(t *testing.T) {
+	var unset *WriteFileConfig
+	if got := unset.GetMaxFileSize(); got != DefaultMaxWriteFileSize {
+		t.Errorf("GetMaxFileSize() = %d, want %d", got, DefaultMaxWriteFileSize)
+	}
+	if !unset.IsExtensionAllowed("script.sh") {
+		t.Error("IsExtensionAllowed() = false without allowedExtensions, want true")
+	}
+
+	cfg := &WriteFileConfig{MaxFileSize: 100, AllowedExtensions: []string{".go", "md"}}
+	if got := cfg.GetMaxFileSize(); got != 100 {
+		t.Errorf("GetMaxFileSize() = %d, want 100", got)
+	}
+	for path, want := range map[string]bool{
+		"main.go":        true,
+		"README.MD":      true,
+		"docs/guide.md":  true,
+		"script.sh":      false,
+		"Makefile":       false,
+		"archive.go.bak": false,
+	} {
+		if got := cfg.IsExtensionAllowed(path); got != want {
+			t.Errorf("IsExtensionAllowed(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestGetMaxCallTimeout(t *testing.T) {
+	cfg := &ShellCommandConfig{MaxExecutionTime: 120}
+	if got := cfg.GetMaxCallTimeout(); got != 120 {
+		t.Errorf("GetMaxCallTimeout() = %d, want MaxExecutionTime 120", got)
+	}
+	cfg.MaxCallTimeout = 600
+	if got := cfg.GetMaxCallTimeout(); got != 600 {
+		t.Errorf("GetMaxCallTimeout() = %d, want 600", got)
+	}
+}
+
+func TestEffective(t *testing.T) {
+	configJSON := `{
+		"allowedDirectories": ["/srv"],
+		"allowCommands": ["echo"],
+		"denyCommands": [],
+		"maxOutputSize": 1000,
+		"maxStderrSize": 0,
+		"resolveCommandPath": true,
+		"blockLogPath": "/var/log/blocked.log",
+		"profiles": {"ci": {"allowedDirectories": ["/srv/ci"], "allowCommands": ["make"], "denyCommands": [], "shebang": "reject"}}
+	}`
+	var cfg ShellCommandConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		t.Fatalf("Failed to unmarshal config: %v", err)
+	}
+
+	effective := cfg.Effective()
+	if effective.MaxCallTimeout != DefaultExecutionTimeout || effective.MaxScriptSize != DefaultMaxScriptSize ||
+		effective.KillGracePeriod != DefaultKillGracePeriod {
+		t.Errorf("Effective() does not fill in the default limits: %+v", effective)
+	}
+	if *effective.MaxStdoutSize != 1000 || *effective.MaxStderrSize != 0 {
+		t.Errorf("Effective() stream limits = %d, %d, want 1000, 0", *effective.MaxStdoutSize, *effective.MaxStderrSize)
+	}
+	if effective.OutputMode != OutputModeHead || effective.Shebang != ShebangIgnore {
+		t.Errorf("Effective() OutputMode, Shebang = %q, %q, want the defaults", effective.OutputMode, effective.Shebang)
+	}
+	if len(effective.TrustedBinaryDirectories) != len(DefaultTrustedBinaryDirectories()) {
+		t.Errorf("Effective().TrustedBinaryDirectories = %v, want the defaults", effective.TrustedBinaryDirectories)
+	}
+
+	ci := effective.Profiles["ci"]
+	if ci.Shebang != ShebangReject || ci.BlockLogPath != "/var/log/blocked.log" || ci.MaxScriptSize != DefaultMaxScriptSize {
+		t.Errorf("Effective() profile = %+v, want its own settings, the top-level log paths and defaults", ci)
+	}
+	if cfg.MaxScriptSize != 0 || cfg.Profiles["ci"].BlockLogPath != "" {
+		t.Error("Effective() modified the config")
+	}
+}
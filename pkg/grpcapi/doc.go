@@ -0,0 +1,5 @@
+// Package grpcapi holds the gRPC service definition of the server, generated from
+// secure_shell.proto, for clients and servers of the gRPC transport.
+package grpcapi
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative secure_shell.proto
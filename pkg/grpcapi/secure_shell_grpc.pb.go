@@ -0,0 +1,215 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: secure_shell.proto
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	SecureShell_RunCommand_FullMethodName   = "/secureshell.v1.SecureShell/RunCommand"
+	SecureShell_Validate_FullMethodName     = "/secureshell.v1.SecureShell/Validate"
+	SecureShell_StreamOutput_FullMethodName = "/secureshell.v1.SecureShell/StreamOutput"
+)
+
+// SecureShellClient is the client API for SecureShell service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// SecureShell runs commands under the server's policy, like the run and validate_command
+// MCP tools.
+type SecureShellClient interface {
+	// RunCommand runs commands and returns their results once all of them finished.
+	RunCommand(ctx context.Context, in *RunRequest, opts ...grpc.CallOption) (*RunResponse, error)
+	// Validate checks whether a command would be allowed, without running it.
+	Validate(ctx context.Context, in *ValidateRequest, opts ...grpc.CallOption) (*ValidateResponse, error)
+	// StreamOutput runs commands like RunCommand, sending their output while they run and
+	// their results last.
+	StreamOutput(ctx context.Context, in *RunRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RunEvent], error)
+}
+
+type secureShellClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSecureShellClient(cc grpc.ClientConnInterface) SecureShellClient {
+	return &secureShellClient{cc}
+}
+
+func (c *secureShellClient) RunCommand(ctx context.Context, in *RunRequest, opts ...grpc.CallOption) (*RunResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RunResponse)
+	err := c.cc.Invoke(ctx, SecureShell_RunCommand_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *secureShellClient) Validate(ctx context.Context, in *ValidateRequest, opts ...grpc.CallOption) (*ValidateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ValidateResponse)
+	err := c.cc.Invoke(ctx, SecureShell_Validate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *secureShellClient) StreamOutput(ctx context.Context, in *RunRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RunEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SecureShell_ServiceDesc.Streams[0], SecureShell_StreamOutput_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RunRequest, RunEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SecureShell_StreamOutputClient = grpc.ServerStreamingClient[RunEvent]
+
+// SecureShellServer is the server API for SecureShell service.
+// All implementations must embed UnimplementedSecureShellServer
+// for forward compatibility.
+//
+// SecureShell runs commands under the server's policy, like the run and validate_command
+// MCP tools.
+type SecureShellServer interface {
+	// RunCommand runs commands and returns their results once all of them finished.
+	RunCommand(context.Context, *RunRequest) (*RunResponse, error)
+	// Validate checks whether a command would be allowed, without running it.
+	Validate(context.Context, *ValidateRequest) (*ValidateResponse, error)
+	// StreamOutput runs commands like RunCommand, sending their output while they run and
+	// their results last.
+	StreamOutput(*RunRequest, grpc.ServerStreamingServer[RunEvent]) error
+	mustEmbedUnimplementedSecureShellServer()
+}
+
+// UnimplementedSecureShellServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSecureShellServer struct{}
+
+func (UnimplementedSecureShellServer) RunCommand(context.Context, *RunRequest) (*RunResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RunCommand not implemented")
+}
+func (UnimplementedSecureShellServer) Validate(context.Context, *ValidateRequest) (*ValidateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Validate not implemented")
+}
+func (UnimplementedSecureShellServer) StreamOutput(*RunRequest, grpc.ServerStreamingServer[RunEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamOutput not implemented")
+}
+func (UnimplementedSecureShellServer) mustEmbedUnimplementedSecureShellServer() {}
+func (UnimplementedSecureShellServer) testEmbeddedByValue()                     {}
+
+// UnsafeSecureShellServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SecureShellServer will
+// result in compilation errors.
+type UnsafeSecureShellServer interface {
+	mustEmbedUnimplementedSecureShellServer()
+}
+
+func RegisterSecureShellServer(s grpc.ServiceRegistrar, srv SecureShellServer) {
+	// If the following call pancis, it indicates UnimplementedSecureShellServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&SecureShell_ServiceDesc, srv)
+}
+
+func _SecureShell_RunCommand_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RunRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SecureShellServer).RunCommand(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SecureShell_RunCommand_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SecureShellServer).RunCommand(ctx, req.(*RunRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SecureShell_Validate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ValidateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SecureShellServer).Validate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SecureShell_Validate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SecureShellServer).Validate(ctx, req.(*ValidateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SecureShell_StreamOutput_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RunRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SecureShellServer).StreamOutput(m, &grpc.GenericServerStream[RunRequest, RunEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SecureShell_StreamOutputServer = grpc.ServerStreamingServer[RunEvent]
+
+// SecureShell_ServiceDesc is the grpc.ServiceDesc for SecureShell service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SecureShell_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "secureshell.v1.SecureShell",
+	HandlerType: (*SecureShellServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RunCommand",
+			Handler:    _SecureShell_RunCommand_Handler,
+		},
+		{
+			MethodName: "Validate",
+			Handler:    _SecureShell_Validate_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamOutput",
+			Handler:       _SecureShell_StreamOutput_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "secure_shell.proto",
+}
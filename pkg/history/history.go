@@ -0,0 +1,308 @@
+// Package history keeps a persistent record of executions, so that what clients ran can
+// be looked up after the server restarts.
+//
+// The history is stored in an embedded SQLite database, one row per execution, inserted as
+// runs finish and deleted when they fall out of the retention. The database is accessed
+// through a pure Go driver, so the server needs no cgo.
+package history
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	// Registers the "sqlite" database/sql driver
+	_ "modernc.org/sqlite"
+)
+
+// filePermissions are the permissions of a newly created history database. Scripts can
+// contain secrets, so only the owner may read it.
+const filePermissions = 0o600
+
+// busyTimeout is how long a statement waits for another connection, such as the history
+// subcommand reading while the server writes, to release the database.
+const busyTimeout = 5 * time.Second
+
+// schema creates the tables and indexes of the history. Times are stored as Unix
+// nanoseconds, 0 for the zero time.
+const schema = `
+CREATE TABLE IF NOT EXISTS executions (
+	seq          INTEGER PRIMARY KEY AUTOINCREMENT,
+	id           TEXT NOT NULL,
+	client       TEXT NOT NULL,
+	started_at   INTEGER NOT NULL,
+	finished_at  INTEGER NOT NULL,
+	working_dir  TEXT NOT NULL,
+	command      TEXT NOT NULL,
+	status       TEXT NOT NULL,
+	exit_code    INTEGER NOT NULL,
+	error        TEXT NOT NULL,
+	stdout_bytes INTEGER NOT NULL,
+	stderr_bytes INTEGER NOT NULL,
+	stdout_log   TEXT NOT NULL,
+	stderr_log   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS executions_started_at ON executions (started_at);
+CREATE INDEX IF NOT EXISTS executions_finished_at ON executions (finished_at);
+CREATE INDEX IF NOT EXISTS executions_client ON executions (client, started_at);
+`
+
+// columns are the columns of a Record, in the order of its fields.
+const columns = "id, client, started_at, finished_at, working_dir, command, status, exit_code, " +
+	"error, stdout_bytes, stderr_bytes, stdout_log, stderr_log"
+
+// Status summarizes how an execution ended.
+type Status string
+
+// Execution statuses.
+const (
+	// StatusSucceeded means the script ran to completion with exit code 0.
+	StatusSucceeded Status = "succeeded"
+	// StatusFailed means the script ran to completion with a non-zero exit code.
+	StatusFailed Status = "failed"
+	// StatusError means the script did not run to completion, e.g. a command was blocked or
+	// it timed out.
+	StatusError Status = "error"
+	// StatusCanceled means the execution was canceled by the client or killed.
+	StatusCanceled Status = "canceled"
+)
+
+// ParseStatus returns the status named by value, which may be empty for any status.
+func ParseStatus(value string) (Status, error) {
+	switch status := Status(value); status {
+	case "", StatusSucceeded, StatusFailed, StatusError, StatusCanceled:
+		return status, nil
+	}
+	return "", fmt.Errorf("invalid status %q: must be succeeded, failed, error or canceled", value)
+}
+
+// ParseTime returns the time named by value, the value of the filter name: an RFC 3339
+// time, or a duration such as "2h" meaning that long ago. An empty value is the zero time.
+func ParseTime(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if ago, err := time.ParseDuration(value); err == nil && ago >= 0 {
+		return time.Now().Add(-ago), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid %s %q: must be an RFC 3339 time or a duration such as 2h", name, value)
+}
+
+// Record is one execution in the history.
+type Record struct {
+	// ID is the run ID of the execution.
+	ID string `json:"id"`
+	// Client identifies the client that requested the execution.
+	Client     string    `json:"client,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	WorkingDir string    `json:"workingDir"`
+	// Command is the shell script as requested.
+	Command  string `json:"command"`
+	Status   Status `json:"status"`
+	ExitCode int    `json:"exitCode"`
+	// Error is the reason the script did not run to completion or exited non-zero.
+	Error string `json:"error,omitempty"`
+	// StdoutBytes and StderrBytes are the sizes of the output, including truncated bytes.
+	StdoutBytes int `json:"stdoutBytes"`
+	StderrBytes int `json:"stderrBytes"`
+	// StdoutLog and StderrLog are the files the complete output was kept in, if any.
+	StdoutLog string `json:"stdoutLog,omitempty"`
+	StderrLog string `json:"stderrLog,omitempty"`
+}
+
+// Retention limits the records a Store keeps. The oldest records are dropped first.
+type Retention struct {
+	// MaxRecords is the number of records kept (0 means unlimited).
+	MaxRecords int
+	// MaxAge is how long after they finished records are kept (0 means forever).
+	MaxAge time.Duration
+}
+
+// Filter selects records in Query. Zero fields match every record.
+type Filter struct {
+	// Client matches records of this client only.
+	Client string
+	// Since and Until match records started in [Since, Until).
+	Since time.Time
+	Until time.Time
+	// Command matches records whose command contains it.
+	Command string
+	// Status matches records with this status only.
+	Status Status
+	// Limit is the largest number of records returned, the most recent ones.
+	Limit int
+}
+
+// Store is a persistent execution history. It is safe for concurrent use.
+type Store struct {
+	db        *sql.DB
+	retention Retention
+}
+
+// Open opens the history database at path, creating it and its directory if needed, and
+// drops the records beyond retention.
+func Open(path string, retention Retention) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	// Create the database with restricted permissions; SQLite gives its journal the same
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, filePermissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	f.Close()
+
+	dsn, err := dataSourceName(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+
+	s := &Store{db: db, retention: retention}
+	if err := s.prune(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// dataSourceName returns the SQLite URI of the database at path, waiting for busy
+// connections and using a write-ahead log so readers do not block the server.
+func dataSourceName(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	uriPath := filepath.ToSlash(abs)
+	if !strings.HasPrefix(uriPath, "/") {
+		// A Windows path such as C:/history.db
+		uriPath = "/" + uriPath
+	}
+	query := url.Values{"_pragma": {
+		fmt.Sprintf("busy_timeout(%d)", busyTimeout.Milliseconds()),
+		"journal_mode(WAL)",
+	}}
+	return (&url.URL{Scheme: "file", Path: uriPath, RawQuery: query.Encode()}).String(), nil
+}
+
+// Add inserts record into the history and drops the records beyond the retention.
+func (s *Store) Add(record Record) error {
+	_, err := s.db.Exec("INSERT INTO executions ("+columns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		record.ID, record.Client, unixNano(record.StartedAt), unixNano(record.FinishedAt), record.WorkingDir,
+		record.Command, string(record.Status), record.ExitCode, record.Error, record.StdoutBytes,
+		record.StderrBytes, record.StdoutLog, record.StderrLog)
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return s.prune()
+}
+
+// prune deletes the records beyond the retention.
+func (s *Store) prune() error {
+	if s.retention.MaxAge > 0 {
+		cutoff := time.Now().Add(-s.retention.MaxAge)
+		if _, err := s.db.Exec("DELETE FROM executions WHERE finished_at < ?", cutoff.UnixNano()); err != nil {
+			return fmt.Errorf("failed to prune history: %w", err)
+		}
+	}
+	if s.retention.MaxRecords > 0 {
+		_, err := s.db.Exec("DELETE FROM executions WHERE seq <= "+
+			"(SELECT seq FROM executions ORDER BY seq DESC LIMIT 1 OFFSET ?)", s.retention.MaxRecords)
+		if err != nil {
+			return fmt.Errorf("failed to prune history: %w", err)
+		}
+	}
+	return nil
+}
+
+// Query returns the records that match filter, most recent first.
+func (s *Store) Query(filter Filter) ([]Record, error) {
+	var where []string
+	var args []any
+	if filter.Client != "" {
+		where, args = append(where, "client = ?"), append(args, filter.Client)
+	}
+	if !filter.Since.IsZero() {
+		where, args = append(where, "started_at >= ?"), append(args, filter.Since.UnixNano())
+	}
+	if !filter.Until.IsZero() {
+		where, args = append(where, "started_at < ?"), append(args, filter.Until.UnixNano())
+	}
+	if filter.Command != "" {
+		// instr matches a plain, case-sensitive substring, unlike LIKE
+		where, args = append(where, "instr(command, ?) > 0"), append(args, filter.Command)
+	}
+	if filter.Status != "" {
+		where, args = append(where, "status = ?"), append(args, string(filter.Status))
+	}
+
+	query := "SELECT " + columns + " FROM executions"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY started_at DESC, seq DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	defer rows.Close()
+	records := []Record{}
+	for rows.Next() {
+		var record Record
+		var startedAt, finishedAt int64
+		var status string
+		if err := rows.Scan(&record.ID, &record.Client, &startedAt, &finishedAt, &record.WorkingDir,
+			&record.Command, &status, &record.ExitCode, &record.Error, &record.StdoutBytes,
+			&record.StderrBytes, &record.StdoutLog, &record.StderrLog); err != nil {
+			return nil, fmt.Errorf("failed to query history: %w", err)
+		}
+		record.StartedAt, record.FinishedAt = fromUnixNano(startedAt), fromUnixNano(finishedAt)
+		record.Status = Status(status)
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	return records, nil
+}
+
+// Close closes the history database. Later calls to Add and Query fail.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// unixNano returns t as Unix nanoseconds, 0 for the zero time.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano returns the time of Unix nanoseconds n, the zero time for 0.
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n).UTC()
+}
@@ -0,0 +1,116 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestStoreQuery(t *testing.T) {
+	// Characters with a meaning in URIs are kept in the path
+	path := filepath.Join(t.TempDir(), "history #1?", "runs.db")
+	s, err := Open(path, Retention{})
+	assert.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	records := []Record{
+		{ID: "1", Client: "alice", Command: "make build", Status: StatusSucceeded, StartedAt: base},
+		{ID: "2", Client: "bob", Command: "make test", Status: StatusFailed, ExitCode: 2, StartedAt: base.Add(time.Minute)},
+		{ID: "3", Client: "alice", Command: "git status", Status: StatusError, ExitCode: -1, StartedAt: base.Add(2 * time.Minute)},
+		{ID: "4", Client: "alice", Command: "make test", Status: StatusFailed, ExitCode: 1, StartedAt: base.Add(3 * time.Minute),
+			FinishedAt: base.Add(4 * time.Minute), WorkingDir: "/srv", Error: "exit status 1", StdoutBytes: 10, StderrBytes: 20,
+			StdoutLog: "/var/log/4.stdout", StderrLog: "/var/log/4.stderr"},
+	}
+	for _, record := range records {
+		assert.NoError(t, s.Add(record))
+	}
+
+	ids := func(records []Record, err error) string {
+		assert.NoError(t, err)
+		var ids []string
+		for _, record := range records {
+			ids = append(ids, record.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+	assert.Equal(t, "4,3,2,1", ids(s.Query(Filter{})))
+	assert.Equal(t, "4,3,1", ids(s.Query(Filter{Client: "alice"})))
+	assert.Equal(t, "4,2", ids(s.Query(Filter{Command: "make test"})))
+	assert.Equal(t, "4,2", ids(s.Query(Filter{Status: StatusFailed})))
+	assert.Equal(t, "3,2", ids(s.Query(Filter{Since: base.Add(time.Minute), Until: base.Add(3 * time.Minute)})))
+	assert.Equal(t, "4,3", ids(s.Query(Filter{Limit: 2})))
+	assert.Equal(t, "", ids(s.Query(Filter{Client: "carol"})))
+
+	// The records survive reopening the store
+	assert.NoError(t, s.Close())
+	reopened, err := Open(path, Retention{})
+	assert.NoError(t, err)
+	t.Cleanup(func() { reopened.Close() })
+	latest, err := reopened.Query(Filter{Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []Record{records[3]}, latest)
+	assert.Equal(t, "4,3,2,1", ids(reopened.Query(Filter{})))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	if filepath.Separator == '/' {
+		assert.Equal(t, os.FileMode(filePermissions), info.Mode().Perm())
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs.db")
+	now := time.Now()
+
+	t.Run("max records", func(t *testing.T) {
+		s, err := Open(path, Retention{MaxRecords: 3})
+		assert.NoError(t, err)
+		defer s.Close()
+		for i := range 10 {
+			assert.NoError(t, s.Add(Record{ID: string(rune('a' + i)), FinishedAt: now}))
+		}
+		records, err := s.Query(Filter{})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, len(records))
+		assert.Equal(t, "j", records[0].ID)
+		assert.Equal(t, "h", records[2].ID)
+	})
+
+	t.Run("max age on open", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "runs.db")
+		s, err := Open(path, Retention{})
+		assert.NoError(t, err)
+		assert.NoError(t, s.Add(Record{ID: "old", FinishedAt: now.Add(-10 * 24 * time.Hour)}))
+		assert.NoError(t, s.Add(Record{ID: "new", FinishedAt: now.Add(-time.Hour)}))
+		assert.NoError(t, s.Close())
+
+		s, err = Open(path, Retention{MaxAge: 7 * 24 * time.Hour})
+		assert.NoError(t, err)
+		defer s.Close()
+		records, err := s.Query(Filter{})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(records))
+		assert.Equal(t, "new", records[0].ID)
+	})
+}
+
+func TestStoreErrors(t *testing.T) {
+	// A file that is not a database, such as a history of an earlier version, is rejected
+	path := filepath.Join(t.TempDir(), "runs.db")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"id":"1","command":"ls","status":"succeeded"}`+"\n"), 0o600))
+	_, err := Open(path, Retention{})
+	assert.Error(t, err)
+
+	s, err := Open(filepath.Join(t.TempDir(), "runs.db"), Retention{})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Add(Record{ID: "1"}))
+	assert.NoError(t, s.Close())
+	assert.Error(t, s.Add(Record{ID: "2"}))
+	_, err = s.Query(Filter{})
+	assert.Error(t, err)
+}
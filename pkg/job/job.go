@@ -0,0 +1,220 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/runner"
+)
+
+// MaxFinishedJobs is the number of finished jobs kept for status and output queries; the
+// oldest finished jobs are forgotten beyond it.
+const MaxFinishedJobs = 100
+
+// ErrNotFound is returned for job IDs that are unknown or have been forgotten.
+var ErrNotFound = errors.New("job not found")
+
+// Status is the state of a job.
+type Status string
+
+// Job states.
+const (
+	// StatusRunning means the script is still running.
+	StatusRunning Status = "running"
+	// StatusCompleted means the script ran to completion; see ExitCode.
+	StatusCompleted Status = "completed"
+	// StatusFailed means the script did not run to completion, e.g. a command was blocked
+	// or it timed out; see Error.
+	StatusFailed Status = "failed"
+	// StatusKilled means the job was stopped with Kill.
+	StatusKilled Status = "killed"
+)
+
+// Info describes a job.
+type Info struct {
+	ID         string
+	Command    string
+	WorkingDir string
+	Status     Status
+	// ExitCode is the script's exit code once it completed, runner.ExitCodeNotRun otherwise.
+	ExitCode int
+	// Error is the reason a failed job did not run to completion.
+	Error      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	// OutputBytes is the amount of output collected so far.
+	OutputBytes int
+}
+
+// job is a script running in the background. Its output is collected with stdout and
+// stderr interleaved in the order they were written.
+type job struct {
+	cancel context.CancelCauseFunc
+
+	mu     sync.Mutex
+	info   Info
+	output []byte
+}
+
+// Manager runs scripts in the background and keeps track of them.
+type Manager struct {
+	mu       sync.Mutex
+	runner   *runner.SafeRunner
+	jobs     map[string]*job
+	finished []string // IDs of finished jobs, oldest first
+}
+
+// NewManager creates a Manager that runs jobs with r.
+func NewManager(r *runner.SafeRunner) *Manager {
+	return &Manager{runner: r, jobs: make(map[string]*job)}
+}
+
+// SetRunner makes later jobs run with r, e.g. after the policy was reloaded. Running jobs
+// keep the runner they started with.
+func (m *Manager) SetRunner(r *runner.SafeRunner) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runner = r
+}
+
+// Start starts running command in workingDir in the background and returns the job's ID.
+// env is the job's environment, with the same meaning as runner.Request.Env. The job is
+// subject to the runner's MaxExecutionTime and MaxOutputSize but not to the caller's context.
+func (m *Manager) Start(command, workingDir string, env []string) string {
+	return m.StartRequest(runner.Request{Command: command, WorkingDir: workingDir, Env: env})
+}
+
+// StartRequest is like Start, but runs req as given. Its ID and outputs are set by the
+// manager.
+func (m *Manager) StartRequest(req runner.Request) string {
+	req.ID = runner.NewRunID()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	j := &job{cancel: cancel, info: Info{
+		ID:         req.ID,
+		Command:    req.Command,
+		WorkingDir: req.WorkingDir,
+		Status:     StatusRunning,
+		ExitCode:   runner.ExitCodeNotRun,
+		StartedAt:  time.Now(),
+	}}
+
+	m.mu.Lock()
+	m.jobs[req.ID] = j
+	r := m.runner
+	m.mu.Unlock()
+
+	req.Stdout, req.Stderr = runner.StreamWriters(func(_ string, chunk []byte) {
+		j.mu.Lock()
+		j.output = append(j.output, chunk...)
+		j.mu.Unlock()
+	})
+	go func() {
+		defer cancel(nil)
+		m.finish(j, r.Run(ctx, req))
+	}()
+	return req.ID
+}
+
+// finish records the result of a job and forgets the oldest finished jobs beyond MaxFinishedJobs.
+func (m *Manager) finish(j *job, result runner.RunResult) {
+	j.mu.Lock()
+	j.info.FinishedAt = time.Now()
+	j.info.ExitCode = runner.ExitCode(result.Err)
+	switch {
+	case errors.Is(result.Err, runner.ErrCanceled):
+		j.info.Status = StatusKilled
+	case j.info.ExitCode == runner.ExitCodeNotRun:
+		j.info.Status = StatusFailed
+		j.info.Error = result.Err.Error()
+	default:
+		j.info.Status = StatusCompleted
+	}
+	id := j.info.ID
+	j.mu.Unlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.finished = append(m.finished, id)
+	for len(m.finished) > MaxFinishedJobs {
+		delete(m.jobs, m.finished[0])
+		m.finished = m.finished[1:]
+	}
+}
+
+// get returns the job with the given ID.
+func (m *Manager) get(id string) (*job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return j, nil
+}
+
+// Status returns the current state of a job.
+func (m *Manager) Status(id string) (Info, error) {
+	j, err := m.get(id)
+	if err != nil {
+		return Info{}, err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info := j.info
+	info.OutputBytes = len(j.output)
+	return info, nil
+}
+
+// Output returns the output a job produced from byte offset on, and the offset to pass to get
+// the output that follows. Polling with the returned offset yields the output incrementally.
+func (m *Manager) Output(id string, offset int) (output string, next int, err error) {
+	j, err := m.get(id)
+	if err != nil {
+		return "", 0, err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if offset < 0 || offset > len(j.output) {
+		return "", 0, fmt.Errorf("offset %d is out of range [0, %d]", offset, len(j.output))
+	}
+	return string(j.output[offset:]), len(j.output), nil
+}
+
+// Kill stops a running job. Its process group receives SIGTERM, then SIGKILL after the
+// configured grace period; the job's status becomes StatusKilled once it has stopped.
+func (m *Manager) Kill(id string) error {
+	j, err := m.get(id)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	status := j.info.Status
+	j.mu.Unlock()
+	if status != StatusRunning {
+		return fmt.Errorf("job %s is not running", id)
+	}
+	// The runner reports runs whose context was cancelled with ErrCanceled as canceled
+	j.cancel(runner.ErrCanceled)
+	return nil
+}
+
+// List returns all known jobs, running and finished, in no particular order.
+func (m *Manager) List() []Info {
+	m.mu.Lock()
+	ids := make([]string, 0, len(m.jobs))
+	for id := range m.jobs {
+		ids = append(ids, id)
+	}
+	m.mu.Unlock()
+
+	infos := make([]Info, 0, len(ids))
+	for _, id := range ids {
+		if info, err := m.Status(id); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
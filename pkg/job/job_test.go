@@ -0,0 +1,155 @@
+package job
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/runner"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func newTestManager(t *testing.T) (*Manager, string) {
+	t.Helper()
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+			{Command: "sleep"},
+			{Command: "exit"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+		KillGracePeriod:     1,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	return NewManager(runner.New(cfg, validator.New(cfg, log), log)), workDir
+}
+
+// waitForStatus polls the job until it leaves StatusRunning.
+func waitForStatus(t *testing.T, m *Manager, id string) Info {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		info, err := m.Status(id)
+		assert.NoError(t, err)
+		if info.Status != StatusRunning {
+			return info
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s is still running", id)
+	return Info{}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	m, workDir := newTestManager(t)
+
+	id := m.Start("echo first; sleep 0.5; echo second >&2; exit 3", workDir, nil)
+
+	info, err := m.Status(id)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusRunning, info.Status)
+	assert.Equal(t, runner.ExitCodeNotRun, info.ExitCode)
+
+	// Output is available while the job runs
+	deadline := time.Now().Add(5 * time.Second)
+	var output string
+	var next int
+	for output == "" && time.Now().Before(deadline) {
+		output, next, err = m.Output(id, 0)
+		assert.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, "first\n", output)
+
+	info = waitForStatus(t, m, id)
+	assert.Equal(t, StatusCompleted, info.Status)
+	assert.Equal(t, 3, info.ExitCode)
+	assert.Equal(t, 13, info.OutputBytes)
+	assert.False(t, info.FinishedAt.IsZero())
+
+	output, next, err = m.Output(id, next)
+	assert.NoError(t, err)
+	assert.Equal(t, "second\n", output)
+	assert.Equal(t, 13, next)
+
+	output, _, err = m.Output(id, next)
+	assert.NoError(t, err)
+	assert.Equal(t, "", output)
+
+	_, _, err = m.Output(id, 100)
+	assert.Error(t, err)
+}
+
+func TestJobFailed(t *testing.T) {
+	m, workDir := newTestManager(t)
+
+	id := m.Start("rm -rf /", workDir, nil)
+	info := waitForStatus(t, m, id)
+	assert.Equal(t, StatusFailed, info.Status)
+	assert.Equal(t, runner.ExitCodeNotRun, info.ExitCode)
+	assert.Contains(t, info.Error, "Command not allowed")
+}
+
+func TestJobKill(t *testing.T) {
+	m, workDir := newTestManager(t)
+
+	id := m.Start("sleep 30", workDir, nil)
+	assert.NoError(t, m.Kill(id))
+
+	info := waitForStatus(t, m, id)
+	assert.Equal(t, StatusKilled, info.Status)
+	assert.True(t, info.FinishedAt.Sub(info.StartedAt) < 5*time.Second)
+
+	assert.Error(t, m.Kill(id))
+}
+
+func TestSetRunner(t *testing.T) {
+	m, workDir := newTestManager(t)
+
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}},
+		DefaultErrorMessage: "Reloaded policy",
+		MaxExecutionTime:    30,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	m.SetRunner(runner.New(cfg, validator.New(cfg, log), log))
+
+	info := waitForStatus(t, m, m.Start("sleep 1", workDir, nil))
+	assert.Equal(t, StatusFailed, info.Status)
+	assert.Contains(t, info.Error, "Reloaded policy")
+}
+
+func TestJobNotFound(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	_, err := m.Status("missing")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	_, _, err = m.Output("missing", 0)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.True(t, errors.Is(m.Kill("missing"), ErrNotFound))
+}
+
+func TestFinishedJobsAreForgotten(t *testing.T) {
+	m, workDir := newTestManager(t)
+
+	ids := make([]string, MaxFinishedJobs+1)
+	for i := range ids {
+		ids[i] = m.Start("echo", workDir, nil)
+		waitForStatus(t, m, ids[i])
+	}
+
+	_, err := m.Status(ids[0])
+	assert.True(t, errors.Is(err, ErrNotFound))
+	_, err = m.Status(ids[len(ids)-1])
+	assert.NoError(t, err)
+	assert.Equal(t, MaxFinishedJobs, len(m.List()))
+}
@@ -0,0 +1,92 @@
+package limiter
+
+import "io"
+
+// ansiState is the position of an ANSIStripper inside an escape sequence.
+type ansiState int
+
+const (
+	ansiText         ansiState = iota // outside any sequence
+	ansiEscape                        // after ESC
+	ansiIntermediate                  // after ESC and intermediate bytes, e.g. ESC ( B
+	ansiCSI                           // inside a control sequence, ESC [ ... final byte
+	ansiString                        // inside an OSC, DCS, APC or PM string
+	ansiStringEscape                  // after ESC inside a string, which ends with ESC \
+)
+
+const (
+	esc = 0x1b
+	bel = 0x07
+)
+
+// ANSIStripper wraps an io.Writer and removes ANSI escape sequences, such as colors and
+// cursor movements, from the data written. Sequences split across writes are recognized.
+type ANSIStripper struct {
+	Writer io.Writer
+	state  ansiState
+	buf    []byte
+}
+
+// NewANSIStripper creates a new ANSIStripper.
+func NewANSIStripper(writer io.Writer) *ANSIStripper {
+	return &ANSIStripper{Writer: writer}
+}
+
+// Write implements the io.Writer interface. It reports all of p as written unless the
+// underlying writer fails.
+func (s *ANSIStripper) Write(p []byte) (int, error) {
+	s.buf = s.buf[:0]
+	for _, c := range p {
+		switch s.state {
+		case ansiText:
+			if c == esc {
+				s.state = ansiEscape
+			} else {
+				s.buf = append(s.buf, c)
+			}
+		case ansiEscape:
+			switch {
+			case c == '[':
+				s.state = ansiCSI
+			case c == ']' || c == 'P' || c == '_' || c == '^' || c == 'X':
+				s.state = ansiString
+			case c >= 0x20 && c <= 0x2f:
+				s.state = ansiIntermediate
+			case c == esc:
+				// A new sequence starts
+			default:
+				s.state = ansiText
+			}
+		case ansiIntermediate:
+			if c < 0x20 || c > 0x2f {
+				s.state = ansiText
+			}
+		case ansiCSI:
+			if c >= 0x40 && c <= 0x7e {
+				s.state = ansiText
+			}
+		case ansiString:
+			switch c {
+			case bel:
+				s.state = ansiText
+			case esc:
+				s.state = ansiStringEscape
+			}
+		case ansiStringEscape:
+			switch c {
+			case '\\':
+				s.state = ansiText
+			case esc:
+			default:
+				s.state = ansiString
+			}
+		}
+	}
+	if len(s.buf) == 0 {
+		return len(p), nil
+	}
+	if _, err := s.Writer.Write(s.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,54 @@
+package limiter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestANSIStripper(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "plain text", input: "hello\nworld\n", want: "hello\nworld\n"},
+		{name: "colors", input: "\x1b[1;31merror\x1b[0m: failed\n", want: "error: failed\n"},
+		{name: "cursor movement", input: "50%\x1b[2K\x1b[1G100%\n", want: "50%100%\n"},
+		{name: "private mode", input: "\x1b[?25lhidden cursor\x1b[?25h", want: "hidden cursor"},
+		{name: "title with BEL", input: "\x1b]0;title\x07text", want: "text"},
+		{name: "hyperlink with ST", input: "\x1b]8;;http://x\x1b\\link\x1b]8;;\x1b\\", want: "link"},
+		{name: "charset selection", input: "\x1b(Bplain", want: "plain"},
+		{name: "two-byte sequence", input: "a\x1b=b\x1b>c", want: "abc"},
+		{name: "carriage returns are kept", input: "a\rb", want: "a\rb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := NewANSIStripper(&buf).Write([]byte(tt.input))
+			assert.NoError(t, err)
+			assert.Equal(t, len(tt.input), n)
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+
+	t.Run("sequences split across writes", func(t *testing.T) {
+		var buf bytes.Buffer
+		s := NewANSIStripper(&buf)
+		for _, b := range []byte("\x1b[38;5;196mred\x1b]0;t\x1b\\ok\x1b[0m") {
+			_, err := s.Write([]byte{b})
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, "redok", buf.String())
+	})
+
+	t.Run("before the limiter", func(t *testing.T) {
+		var buf bytes.Buffer
+		s := NewANSIStripper(NewOutputLimiter(&buf, 5))
+		_, err := s.Write([]byte("\x1b[32mabcde\x1b[0m"))
+		assert.NoError(t, err)
+		assert.Equal(t, "abcde", buf.String())
+	})
+}
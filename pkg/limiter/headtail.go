@@ -0,0 +1,62 @@
+package limiter
+
+import (
+	"fmt"
+	"io"
+)
+
+// NewHeadTailLimiter creates an OutputLimiter that keeps the first half and the last half of
+// maxBytes and maxLines, with a marker of the omitted size in between. The beginning is
+// written as it arrives and the end when Flush is called. A limit of 0 is not applied; with
+// a limit of 1 only the beginning is kept.
+func NewHeadTailLimiter(writer io.Writer, maxBytes int, maxLines int) *OutputLimiter {
+	if maxBytes == 1 || maxLines == 1 {
+		return NewLineLimiter(writer, maxBytes, maxLines)
+	}
+	ol := NewLineLimiter(writer, maxBytes-maxBytes/2, maxLines-maxLines/2)
+	ol.Mode = ModeHeadTail
+	ol.rest = NewTailLimiter(writer, maxBytes/2, maxLines/2)
+	return ol
+}
+
+// writeHeadTail writes p while the beginning has room, and passes the rest to the limiter
+// keeping the end.
+func (ol *OutputLimiter) writeHeadTail(p []byte) (n int, err error) {
+	ol.TotalInputBytes += len(p)
+	rest := p
+	if !ol.headDone {
+		writeLen := ol.allowedLen(p)
+		if writeLen > 0 {
+			written, writeErr := ol.Writer.Write(p[:writeLen])
+			ol.count(p[:written])
+			if written > 0 {
+				ol.lastHeadByte = p[written-1]
+			}
+			err = writeErr
+		}
+		ol.headDone = writeLen < len(p) || ol.limitReached()
+		rest = p[writeLen:]
+	}
+	if ol.headDone {
+		_, _ = ol.rest.Write(rest)
+		ol.Truncated = ol.rest.Truncated
+	}
+	return len(p), err
+}
+
+// flushHeadTail writes the kept end of the output, preceded by a marker if output was
+// omitted between the beginning and the end.
+func (ol *OutputLimiter) flushHeadTail() error {
+	if ol.rest.Truncated {
+		marker := fmt.Sprintf("[... %d bytes omitted%s ...]\n", ol.rest.GetRemainingBytes(), ol.fullOutputNote())
+		if ol.BytesWritten > 0 && ol.lastHeadByte != '\n' {
+			marker = "\n" + marker
+		}
+		if _, err := io.WriteString(ol.Writer, marker); err != nil {
+			return err
+		}
+	}
+	_, err := ol.Writer.Write(ol.rest.tail)
+	ol.rest.tail = nil
+	return err
+}
@@ -1,19 +1,55 @@
 package limiter
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 )
 
-// OutputLimiter wraps an io.Writer and limits the amount of data written.
-// It also keeps track of whether the output was truncated and the total size of the original output.
+// Mode selects which part of the output an OutputLimiter keeps.
+type Mode string
+
+const (
+	// ModeHead keeps the beginning of the output and writes it as it arrives.
+	ModeHead Mode = "head"
+	// ModeTail keeps the end of the output. Nothing is written until Flush.
+	ModeTail Mode = "tail"
+	// ModeHeadTail keeps the beginning and the end of the output. The beginning is written
+	// as it arrives, the end on Flush.
+	ModeHeadTail Mode = "head+tail"
+)
+
+// OutputLimiter wraps an io.Writer and limits the amount of data written, in bytes, in lines
+// or both. It also keeps track of whether the output was truncated and the total size of the
+// original output.
 type OutputLimiter struct {
-	Writer            io.Writer
-	MaxBytes          int
+	Writer   io.Writer
+	MaxBytes int
+	// MaxLines is the number of lines written before the output is truncated; 0 leaves the
+	// number of lines unlimited.
+	MaxLines int
+	// Mode is the part of the output that is kept; the zero value is ModeHead.
+	Mode Mode
+	// BytesWritten and LinesWritten count the output written, or in ModeTail the output
+	// kept to be written by Flush. In ModeHeadTail they count the beginning only.
 	BytesWritten      int
+	LinesWritten      int
 	TotalInputBytes   int
 	Truncated         bool
 	TruncationMessage string
+	// FullOutput is the path of a file holding the complete output, named in the truncation
+	// message when set.
+	FullOutput string
+
+	// tail holds the end of the output in ModeTail, and tailLineLimited reports whether
+	// MaxLines rather than MaxBytes dropped output last
+	tail            []byte
+	tailLineLimited bool
+
+	// In ModeHeadTail, rest keeps the end of the output once the beginning is complete
+	rest         *OutputLimiter
+	headDone     bool
+	lastHeadByte byte
 }
 
 // NewOutputLimiter creates a new OutputLimiter.
@@ -28,9 +64,24 @@ func NewOutputLimiter(writer io.Writer, maxBytes int) *OutputLimiter {
 	}
 }
 
+// NewLineLimiter creates an OutputLimiter that truncates the output after maxLines lines or
+// maxBytes bytes, whichever comes first. A limit of 0 is not applied.
+func NewLineLimiter(writer io.Writer, maxBytes int, maxLines int) *OutputLimiter {
+	ol := NewOutputLimiter(writer, maxBytes)
+	ol.MaxLines = maxLines
+	return ol
+}
+
 // Write implements the io.Writer interface.
-// It stops writing after MaxBytes and marks the output as truncated.
+// It stops writing after MaxBytes or MaxLines and marks the output as truncated.
 func (ol *OutputLimiter) Write(p []byte) (n int, err error) {
+	switch ol.Mode {
+	case ModeTail:
+		return ol.writeTail(p)
+	case ModeHeadTail:
+		return ol.writeHeadTail(p)
+	}
+
 	// Always track the total input size
 	ol.TotalInputBytes += len(p)
 
@@ -40,37 +91,73 @@ func (ol *OutputLimiter) Write(p []byte) (n int, err error) {
 		return len(p), nil
 	}
 
-	remaining := ol.MaxBytes - ol.BytesWritten
-	if remaining <= 0 {
-		// We've reached the limit but haven't marked as truncated yet
-		if !ol.Truncated {
-			// Write the truncation message with remaining size info
-			_, _ = ol.Writer.Write([]byte(ol.getTruncationMessage()))
-			ol.Truncated = true
-		}
-		return len(p), nil
+	writeLen := ol.allowedLen(p)
+	if writeLen == len(p) && !ol.limitReached() {
+		// We can write all bytes
+		written, err := ol.Writer.Write(p)
+		ol.count(p[:written])
+		return written, err
 	}
 
-	var writeLen int
-	if len(p) > remaining {
-		// Write only up to the limit
-		writeLen = remaining
+	// Write only up to the limit
+	if writeLen > 0 {
 		written, writeErr := ol.Writer.Write(p[:writeLen])
-		ol.BytesWritten += written
+		ol.count(p[:written])
 		err = writeErr
+	}
+
+	// Mark as truncated and write the truncation message
+	ol.Truncated = true
+	_, _ = ol.Writer.Write([]byte(ol.getTruncationMessage()))
 
-		// Mark as truncated and write the truncation message
-		ol.Truncated = true
-		_, _ = ol.Writer.Write([]byte(ol.getTruncationMessage()))
+	// Pretend we wrote all bytes to not confuse the caller
+	return len(p), err
+}
 
-		// Pretend we wrote all bytes to not confuse the caller
-		return len(p), err
+// allowedLen returns how much of p may be written before a limit is exceeded.
+func (ol *OutputLimiter) allowedLen(p []byte) int {
+	n := len(p)
+	if ol.MaxBytes > 0 {
+		n = min(n, max(0, ol.MaxBytes-ol.BytesWritten))
 	}
+	if ol.MaxLines > 0 {
+		// Cut after the last line that is allowed
+		lines := ol.LinesWritten
+		for i := range n {
+			if lines == ol.MaxLines {
+				return i
+			}
+			if p[i] == '\n' {
+				lines++
+			}
+		}
+	}
+	return n
+}
+
+// limitReached reports whether a limit has been reached exactly, so that any further
+// output is truncated.
+func (ol *OutputLimiter) limitReached() bool {
+	return (ol.MaxBytes > 0 && ol.BytesWritten >= ol.MaxBytes) ||
+		(ol.MaxLines > 0 && ol.LinesWritten >= ol.MaxLines)
+}
+
+// count records p as written.
+func (ol *OutputLimiter) count(p []byte) {
+	ol.BytesWritten += len(p)
+	ol.LinesWritten += bytes.Count(p, []byte{'\n'})
+}
 
-	// We can write all bytes
-	written, err := ol.Writer.Write(p)
-	ol.BytesWritten += written
-	return written, err
+// Flush writes the output kept in ModeTail and ModeHeadTail, with a note of the output that
+// was dropped. It does nothing in ModeHead, where output is written as it arrives.
+func (ol *OutputLimiter) Flush() error {
+	switch ol.Mode {
+	case ModeTail:
+		return ol.flushTail()
+	case ModeHeadTail:
+		return ol.flushHeadTail()
+	}
+	return nil
 }
 
 // WasTruncated returns whether the output was truncated.
@@ -83,6 +170,9 @@ func (ol *OutputLimiter) GetRemainingBytes() int {
 	if !ol.Truncated {
 		return 0
 	}
+	if ol.Mode == ModeHeadTail {
+		return ol.rest.GetRemainingBytes()
+	}
 	return ol.TotalInputBytes - ol.BytesWritten
 }
 
@@ -90,7 +180,22 @@ func (ol *OutputLimiter) GetRemainingBytes() int {
 // the remaining output size.
 func (ol *OutputLimiter) getTruncationMessage() string {
 	remaining := ol.TotalInputBytes - ol.BytesWritten
-	return fmt.Sprintf("\n\n[Output truncated, exceeded %d bytes limit. %d bytes remaining]\n"+
-		"If you need to view the complete output, consider using commands like tail or modifying your command to ensure the output stays within the limits.",
-		ol.MaxBytes, remaining)
+	limit := fmt.Sprintf("%d bytes", ol.MaxBytes)
+	if ol.MaxLines > 0 && ol.LinesWritten >= ol.MaxLines {
+		limit = fmt.Sprintf("%d lines", ol.MaxLines)
+	}
+	advice := "If you need to view the complete output, consider using commands like tail or modifying your command to ensure the output stays within the limits."
+	if ol.FullOutput != "" {
+		advice = fmt.Sprintf("The complete output is saved in %s.", ol.FullOutput)
+	}
+	return fmt.Sprintf("\n\n[Output truncated, exceeded %s limit. %d bytes remaining]\n%s",
+		limit, remaining, advice)
+}
+
+// fullOutputNote returns a note naming the file with the complete output, or "" without one.
+func (ol *OutputLimiter) fullOutputNote() string {
+	if ol.FullOutput == "" {
+		return ""
+	}
+	return ". The complete output is saved in " + ol.FullOutput
 }
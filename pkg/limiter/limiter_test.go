@@ -177,3 +177,191 @@ func TestOutputLimiterRemainingBytes(t *testing.T) {
 		assert.True(t, strings.Contains(buf.String(), expectedMessage))
 	})
 }
+
+// TestOutputLimiterLines tests the max-lines mode and its combination with the byte limit.
+func TestOutputLimiterLines(t *testing.T) {
+	t.Run("Should truncate after the last allowed line", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		limiter := NewLineLimiter(buf, 0, 2)
+
+		_, err := limiter.Write([]byte("one\ntw"))
+		assert.NoError(t, err)
+		assert.False(t, limiter.WasTruncated())
+
+		n, err := limiter.Write([]byte("o\nthree\nfour\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, 13, n)
+		assert.True(t, limiter.WasTruncated())
+		assert.Equal(t, 2, limiter.LinesWritten)
+		assert.Equal(t, 11, limiter.GetRemainingBytes())
+		assert.True(t, strings.HasPrefix(buf.String(), "one\ntwo\n\n\n[Output truncated, exceeded 2 lines limit. 11 bytes remaining]"))
+	})
+
+	t.Run("Should handle exact line count", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		limiter := NewLineLimiter(buf, 0, 2)
+
+		_, err := limiter.Write([]byte("one\ntwo\n"))
+		assert.NoError(t, err)
+		assert.False(t, limiter.WasTruncated())
+		assert.Equal(t, "one\ntwo\n", buf.String())
+
+		_, err = limiter.Write([]byte("three"))
+		assert.NoError(t, err)
+		assert.True(t, limiter.WasTruncated())
+	})
+
+	t.Run("Should apply whichever limit comes first", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		limiter := NewLineLimiter(buf, 10, 5)
+
+		_, err := limiter.Write([]byte("0123456\n789abc\n"))
+		assert.NoError(t, err)
+		assert.True(t, limiter.WasTruncated())
+		assert.True(t, strings.HasPrefix(buf.String(), "0123456\n78\n\n[Output truncated, exceeded 10 bytes limit. 5 bytes remaining]"))
+	})
+}
+
+// TestOutputLimiterTail tests the mode that keeps the end of the output.
+func TestOutputLimiterTail(t *testing.T) {
+	t.Run("Should write nothing before Flush", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		limiter := NewTailLimiter(buf, 10, 0)
+
+		n, err := limiter.Write([]byte("hello\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, 6, n)
+		assert.Equal(t, "", buf.String())
+
+		assert.NoError(t, limiter.Flush())
+		assert.False(t, limiter.WasTruncated())
+		assert.Equal(t, "hello\n", buf.String())
+	})
+
+	t.Run("Should keep the last bytes", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		limiter := NewTailLimiter(buf, 10, 0)
+
+		for _, chunk := range []string{"0123456789", "abcdef", "ghij"} {
+			_, err := limiter.Write([]byte(chunk))
+			assert.NoError(t, err)
+		}
+		assert.True(t, limiter.WasTruncated())
+		assert.Equal(t, 10, limiter.GetRemainingBytes())
+
+		assert.NoError(t, limiter.Flush())
+		assert.Equal(t, "[Output truncated, exceeded 10 bytes limit. The first 10 bytes were omitted]\nabcdefghij", buf.String())
+	})
+
+	t.Run("Should keep the last lines", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		limiter := NewTailLimiter(buf, 0, 2)
+
+		for _, chunk := range []string{"one\ntwo\nth", "ree\nfour\n", "five"} {
+			_, err := limiter.Write([]byte(chunk))
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, limiter.Flush())
+		assert.Equal(t, "[Output truncated, exceeded 2 lines limit. The first 14 bytes were omitted]\nfour\nfive", buf.String())
+	})
+
+	t.Run("Should cap a long line without a byte limit", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		limiter := NewTailLimiter(buf, 0, 2)
+
+		chunk := bytes.Repeat([]byte("x"), 64<<10)
+		for range 2 * DefaultTailMaxBytes / len(chunk) {
+			_, err := limiter.Write(chunk)
+			assert.NoError(t, err)
+			assert.True(t, len(limiter.tail) <= DefaultTailMaxBytes, "kept %d bytes", len(limiter.tail))
+		}
+		assert.Equal(t, DefaultTailMaxBytes, limiter.GetRemainingBytes())
+		assert.NoError(t, limiter.Flush())
+		assert.True(t, strings.HasPrefix(buf.String(), fmt.Sprintf("[Output truncated, exceeded %d bytes limit.", DefaultTailMaxBytes)))
+	})
+
+	t.Run("Should apply whichever limit keeps less", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		limiter := NewTailLimiter(buf, 8, 3)
+
+		_, err := limiter.Write([]byte("a\nb\nc\nlong line\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, limiter.Flush())
+		assert.Equal(t, "[Output truncated, exceeded 8 bytes limit. The first 8 bytes were omitted]\nng line\n", buf.String())
+	})
+}
+
+// TestOutputLimiterHeadTail tests the mode that keeps the beginning and the end of the output.
+func TestOutputLimiterHeadTail(t *testing.T) {
+	t.Run("Should keep short output unchanged", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		limiter := NewHeadTailLimiter(buf, 20, 0)
+
+		for _, chunk := range []string{"0123456789", "abcdefghij"} {
+			_, err := limiter.Write([]byte(chunk))
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, "0123456789", buf.String())
+		assert.NoError(t, limiter.Flush())
+		assert.False(t, limiter.WasTruncated())
+		assert.Equal(t, "0123456789abcdefghij", buf.String())
+	})
+
+	t.Run("Should omit the middle", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		limiter := NewHeadTailLimiter(buf, 10, 0)
+
+		n, err := limiter.Write([]byte("0123456789abcdefghij"))
+		assert.NoError(t, err)
+		assert.Equal(t, 20, n)
+		assert.True(t, limiter.WasTruncated())
+		assert.Equal(t, 10, limiter.GetRemainingBytes())
+
+		assert.NoError(t, limiter.Flush())
+		assert.Equal(t, "01234\n[... 10 bytes omitted ...]\nfghij", buf.String())
+	})
+
+	t.Run("Should keep whole lines", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		limiter := NewHeadTailLimiter(buf, 0, 4)
+
+		for i := 1; i <= 10; i++ {
+			_, err := fmt.Fprintf(limiter, "line %d\n", i)
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, limiter.Flush())
+		assert.Equal(t, "line 1\nline 2\n[... 42 bytes omitted ...]\nline 9\nline 10\n", buf.String())
+	})
+
+	t.Run("Should keep only the beginning with a limit of 1", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		limiter := NewHeadTailLimiter(buf, 0, 1)
+
+		_, err := limiter.Write([]byte("one\ntwo\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, limiter.Flush())
+		assert.True(t, strings.HasPrefix(buf.String(), "one\n\n\n[Output truncated, exceeded 1 lines limit."))
+	})
+}
+
+func TestOutputLimiterFullOutput(t *testing.T) {
+	for _, mode := range []Mode{ModeHead, ModeTail, ModeHeadTail} {
+		t.Run(string(mode), func(t *testing.T) {
+			var buf bytes.Buffer
+			var ol *OutputLimiter
+			switch mode {
+			case ModeTail:
+				ol = NewTailLimiter(&buf, 10, 0)
+			case ModeHeadTail:
+				ol = NewHeadTailLimiter(&buf, 10, 0)
+			default:
+				ol = NewOutputLimiter(&buf, 10)
+			}
+			ol.FullOutput = "/spool/run.stdout.log"
+			_, err := ol.Write([]byte(strings.Repeat("x", 30)))
+			assert.NoError(t, err)
+			assert.NoError(t, ol.Flush())
+			assert.Contains(t, buf.String(), "The complete output is saved in /spool/run.stdout.log")
+		})
+	}
+}
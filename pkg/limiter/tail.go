@@ -0,0 +1,74 @@
+package limiter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// DefaultTailMaxBytes is the number of bytes a tail limiter keeps when it has no byte limit,
+// so that long lines cannot make the output it keeps grow without bound.
+const DefaultTailMaxBytes = 1 << 20
+
+// NewTailLimiter creates an OutputLimiter that keeps the last maxLines lines and at most the
+// last maxBytes bytes of the output, and writes them when Flush is called. A line limit of 0
+// is not applied; a byte limit of 0 keeps at most DefaultTailMaxBytes.
+func NewTailLimiter(writer io.Writer, maxBytes int, maxLines int) *OutputLimiter {
+	if maxBytes <= 0 {
+		maxBytes = DefaultTailMaxBytes
+	}
+	ol := NewLineLimiter(writer, maxBytes, maxLines)
+	ol.Mode = ModeTail
+	return ol
+}
+
+// writeTail adds p to the kept output and drops what no longer fits from its beginning.
+func (ol *OutputLimiter) writeTail(p []byte) (int, error) {
+	ol.TotalInputBytes += len(p)
+	ol.tail = append(ol.tail, p...)
+	ol.LinesWritten += bytes.Count(p, []byte{'\n'})
+
+	drop := 0
+	if ol.MaxBytes > 0 && len(ol.tail) > ol.MaxBytes {
+		drop = len(ol.tail) - ol.MaxBytes
+		ol.LinesWritten -= bytes.Count(ol.tail[:drop], []byte{'\n'})
+		ol.tailLineLimited = false
+	}
+	if ol.MaxLines > 0 {
+		// A final line without a newline counts too
+		lines := ol.LinesWritten
+		if drop < len(ol.tail) && ol.tail[len(ol.tail)-1] != '\n' {
+			lines++
+		}
+		for ; lines > ol.MaxLines; lines-- {
+			drop += bytes.IndexByte(ol.tail[drop:], '\n') + 1
+			ol.LinesWritten--
+			ol.tailLineLimited = true
+		}
+	}
+
+	if drop > 0 {
+		ol.Truncated = true
+		ol.tail = append(ol.tail[:0], ol.tail[drop:]...)
+	}
+	ol.BytesWritten = len(ol.tail)
+	return len(p), nil
+}
+
+// flushTail writes the kept output, preceded by the truncation message if output was dropped.
+func (ol *OutputLimiter) flushTail() error {
+	if ol.Truncated {
+		limit := fmt.Sprintf("%d bytes", ol.MaxBytes)
+		if ol.tailLineLimited {
+			limit = fmt.Sprintf("%d lines", ol.MaxLines)
+		}
+		message := fmt.Sprintf("[Output truncated, exceeded %s limit. The first %d bytes were omitted%s]\n",
+			limit, ol.GetRemainingBytes(), ol.fullOutputNote())
+		if _, err := io.WriteString(ol.Writer, message); err != nil {
+			return err
+		}
+	}
+	_, err := ol.Writer.Write(ol.tail)
+	ol.tail = nil
+	return err
+}
@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// journalSocket is the socket of the systemd journal's native protocol.
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalWriter writes entries to the systemd journal using its native protocol, one
+// datagram of fields per entry.
+type journalWriter struct {
+	conn     net.Conn
+	facility int
+	tag      string
+}
+
+// dialJournal connects to the journal listening on socket.
+func dialJournal(socket string, opts SyslogOptions) (levelWriter, error) {
+	facility, err := opts.facility()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("unixgram", socket)
+	if err != nil {
+		return nil, err
+	}
+	return &journalWriter{conn: conn, facility: facility, tag: opts.tag()}, nil
+}
+
+// WriteLevel implements levelWriter.
+func (j *journalWriter) WriteLevel(level Level, line string) error {
+	var buf bytes.Buffer
+	appendJournalField(&buf, "MESSAGE", line)
+	appendJournalField(&buf, "PRIORITY", strconv.Itoa(severity(level)))
+	appendJournalField(&buf, "SYSLOG_FACILITY", strconv.Itoa(j.facility))
+	appendJournalField(&buf, "SYSLOG_IDENTIFIER", j.tag)
+	_, err := j.conn.Write(buf.Bytes())
+	return err
+}
+
+// Close implements io.Closer.
+func (j *journalWriter) Close() error {
+	return j.conn.Close()
+}
+
+// appendJournalField appends a field to buf. Values with newlines are length-prefixed.
+func appendJournalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
@@ -1,17 +1,122 @@
 package logger
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os"
+	"slices"
+	"strings"
 	"time"
 )
 
+// Format is the format log entries are written in.
+type Format string
+
+const (
+	// FormatText writes log entries as human-readable lines. It is the default.
+	FormatText Format = "text"
+	// FormatJSON writes each log entry as a JSON object on its own line.
+	FormatJSON Format = "json"
+)
+
+// ParseFormat returns the Format named by s; an empty s is FormatText.
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "", FormatText:
+		return FormatText, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("unknown log format %q", s)
+	}
+}
+
+// Level is the severity of a log entry.
+type Level int
+
+// Levels in increasing severity. Their values are those of the log/slog levels.
+const (
+	LevelDebug = Level(slog.LevelDebug)
+	LevelInfo  = Level(slog.LevelInfo)
+	LevelWarn  = Level(slog.LevelWarn)
+	LevelError = Level(slog.LevelError)
+)
+
+// String returns the name of the level as written in log entries.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
+}
+
+// ParseLevel returns the Level named by s, in any case; an empty s is LevelInfo.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+// Event types of JSON log entries.
+const (
+	EventCommand = "command"
+	EventMessage = "message"
+)
+
+// Entry is a log entry as written in FormatJSON.
+type Entry struct {
+	Time     string   `json:"time"`
+	Level    string   `json:"level"`
+	Event    string   `json:"event"`
+	Message  string   `json:"message,omitempty"`
+	Command  string   `json:"command,omitempty"`
+	Args     []string `json:"args,omitempty"`
+	Decision string   `json:"decision,omitempty"`
+	RunID    string   `json:"runId,omitempty"`
+}
+
 // Logger provides logging functionality.
 type Logger struct {
 	logger *log.Logger
-	file   *os.File
+	file   io.Closer
+	format Format
+	// level is the minimum level logged; the zero value is LevelInfo
+	level Level
+	// target receives the entries instead of logger when logging to syslog or the journal,
+	// which keep the time and level of entries themselves
+	target levelWriter
+	// handler receives the entries as slog records instead of logger; see NewWithHandler
+	handler slog.Handler
+	// sinks receive the entries instead of logger; see NewMulti
+	sinks []*Logger
+}
+
+// levelWriter is a log target with its own severities, such as syslog.
+type levelWriter interface {
+	io.Closer
+	WriteLevel(level Level, line string) error
 }
 
 // New creates a new logger with no output.
@@ -25,13 +130,19 @@ func New() *Logger {
 // NewWithPath creates a new logger that writes to the specified file path.
 // If the path is empty, logs are discarded.
 func NewWithPath(path string) (*Logger, error) {
+	return NewWithRotation(path, Rotation{})
+}
+
+// NewWithRotation creates a new logger that writes to the specified file path and rotates
+// the file as configured. If the path is empty, logs are discarded.
+func NewWithRotation(path string, rotation Rotation) (*Logger, error) {
 	if path == "" {
 		return New(), nil
 	}
 
 	// Open log file (create if not exists, append mode)
 	const filePermission = 0o644 // Read-write for owner, read-only for others
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, filePermission)
+	file, err := OpenRotatingFile(path, filePermission, rotation)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open log file: %w", err)
 	}
@@ -42,6 +153,140 @@ func NewWithPath(path string) (*Logger, error) {
 	}, nil
 }
 
+// NewSyslog creates a new logger that writes to the local syslog daemon.
+func NewSyslog(opts SyslogOptions) (*Logger, error) {
+	target, err := dialSyslog("", "", opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return newWithTarget(target), nil
+}
+
+// NewJournal creates a new logger that writes to the systemd journal.
+func NewJournal(opts SyslogOptions) (*Logger, error) {
+	target, err := dialJournal(journalSocket, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the journal: %w", err)
+	}
+	return newWithTarget(target), nil
+}
+
+// newWithTarget creates a new logger that writes to target.
+func newWithTarget(target levelWriter) *Logger {
+	return &Logger{
+		logger: log.New(io.Discard, "", 0),
+		target: target,
+	}
+}
+
+// Targets a Logger writes to.
+const (
+	// TargetFile writes to a log file, or discards entries without one. It is the default.
+	TargetFile = "file"
+	// TargetStderr writes to standard error.
+	TargetStderr = "stderr"
+	// TargetSyslog writes to the local syslog daemon.
+	TargetSyslog = "syslog"
+	// TargetJournald writes to the systemd journal.
+	TargetJournald = "journald"
+	// TargetWebhook posts each entry as JSON to a URL.
+	TargetWebhook = "webhook"
+)
+
+// Options configure a logger created with Open.
+type Options struct {
+	// Target is TargetFile (default), TargetStderr, TargetSyslog, TargetJournald or TargetWebhook
+	Target string
+	// Path is the log file of TargetFile; entries are discarded without one
+	Path string
+	// URL is the endpoint of TargetWebhook
+	URL string
+	// Rotation rotates the log files of TargetFile
+	Rotation Rotation
+	// Syslog configures TargetSyslog and TargetJournald
+	Syslog SyslogOptions
+	// Format is the name of a Format, parsed with ParseFormat; TargetWebhook always uses JSON
+	Format string
+	// Level is the name of the minimum Level, parsed with ParseLevel
+	Level string
+	// Sinks are destinations every entry is written to as well, each with its own target,
+	// format and level; Rotation and Syslog apply to them too
+	Sinks []Sink
+}
+
+// Sink is an additional destination of a logger created with Open.
+type Sink struct {
+	Target string
+	Path   string
+	URL    string
+	Format string
+	Level  string
+}
+
+// Open creates a logger as configured by opts.
+func Open(opts Options) (*Logger, error) {
+	l, err := openTarget(opts)
+	if err != nil || len(opts.Sinks) == 0 {
+		return l, err
+	}
+
+	sinks := []*Logger{l}
+	for _, sink := range opts.Sinks {
+		s, err := openTarget(Options{
+			Target:   sink.Target,
+			Path:     sink.Path,
+			URL:      sink.URL,
+			Rotation: opts.Rotation,
+			Syslog:   opts.Syslog,
+			Format:   sink.Format,
+			Level:    sink.Level,
+		})
+		if err != nil {
+			for _, opened := range sinks {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("log sink %s: %w", sink.Target, err)
+		}
+		sinks = append(sinks, s)
+	}
+	return NewMulti(sinks...), nil
+}
+
+// openTarget creates a logger for the target of opts, ignoring its sinks.
+func openTarget(opts Options) (*Logger, error) {
+	format, err := ParseFormat(opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	var l *Logger
+	switch opts.Target {
+	case "", TargetFile:
+		l, err = NewWithRotation(opts.Path, opts.Rotation)
+	case TargetStderr:
+		l = NewWithWriter(os.Stderr)
+	case TargetSyslog:
+		l, err = NewSyslog(opts.Syslog)
+	case TargetJournald:
+		l, err = NewJournal(opts.Syslog)
+	case TargetWebhook:
+		l, err = NewWebhook(opts.URL)
+		format = FormatJSON
+	default:
+		err = fmt.Errorf("unknown log target %q", opts.Target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.SetFormat(format)
+	l.SetLevel(level)
+	return l, nil
+}
+
 // NewWithWriter creates a new logger with a specific writer.
 func NewWithWriter(w io.Writer) *Logger {
 	return &Logger{
@@ -49,45 +294,157 @@ func NewWithWriter(w io.Writer) *Logger {
 	}
 }
 
+// SetFormat sets the format of the entries logged from now on. It is meant to be called
+// before the logger is shared.
+func (l *Logger) SetFormat(format Format) {
+	l.format = format
+	if format == FormatJSON {
+		// Entries carry their own timestamp
+		l.logger.SetFlags(0)
+	} else {
+		l.logger.SetFlags(log.LstdFlags)
+	}
+}
+
+// SetLevel sets the minimum level of the entries logged from now on. It is meant to be
+// called before the logger is shared.
+func (l *Logger) SetLevel(level Level) {
+	l.level = level
+}
+
+// Enabled reports whether entries of the given level are logged, to skip building
+// expensive messages.
+func (l *Logger) Enabled(level Level) bool {
+	if l.sinks != nil {
+		return slices.ContainsFunc(l.sinks, func(s *Logger) bool { return s.Enabled(level) })
+	}
+	if l.handler != nil && !l.handler.Enabled(context.Background(), slog.Level(level)) {
+		return false
+	}
+	return level >= l.level
+}
+
 // LogCommandAttempt logs an attempted command execution.
 func (l *Logger) LogCommandAttempt(cmd string, args []string, allowed bool) {
-	status := "ALLOWED"
+	l.LogCommandDecision("", cmd, args, allowed)
+}
+
+// LogCommandDecision logs whether a command of the run with the given ID was allowed, at
+// LevelInfo for allowed and LevelWarn for blocked commands. An empty runID is left out.
+func (l *Logger) LogCommandDecision(runID string, cmd string, args []string, allowed bool) {
+	status, level := "ALLOWED", LevelInfo
 	if !allowed {
-		status = "BLOCKED"
+		status, level = "BLOCKED", LevelWarn
+	}
+	if !l.Enabled(level) {
+		return
 	}
 
-	timestamp := time.Now().Format(time.RFC3339)
-	l.logger.Printf("%s [%s] Command: %s %v\n", timestamp, status, cmd, args)
+	text := fmt.Sprintf("[%s] Command: %s %v", status, cmd, args)
+	if runID != "" {
+		text += fmt.Sprintf(" (run %s)", runID)
+	}
+	l.write(level, text, Entry{
+		Level:    level.String(),
+		Event:    EventCommand,
+		Command:  cmd,
+		Args:     args,
+		Decision: strings.ToLower(status),
+		RunID:    runID,
+	})
 }
 
 // LogErrorf logs an error with formatted message.
 func (l *Logger) LogErrorf(format string, args ...interface{}) {
-	timestamp := time.Now().Format(time.RFC3339)
-	message := fmt.Sprintf(format, args...)
-	l.logger.Printf("%s [ERROR] %s\n", timestamp, message)
+	l.logf(LevelError, format, args...)
 }
 
 // LogError logs an error message.
 func (l *Logger) LogError(message string) {
-	timestamp := time.Now().Format(time.RFC3339)
-	l.logger.Printf("%s [ERROR] %s\n", timestamp, message)
+	l.logMessage(LevelError, message)
+}
+
+// LogWarnf logs a warning with formatted message.
+func (l *Logger) LogWarnf(format string, args ...interface{}) {
+	l.logf(LevelWarn, format, args...)
 }
 
 // LogInfof logs an informational message with formatting.
 func (l *Logger) LogInfof(format string, args ...interface{}) {
-	timestamp := time.Now().Format(time.RFC3339)
-	message := fmt.Sprintf(format, args...)
-	l.logger.Printf("%s [INFO] %s\n", timestamp, message)
+	l.logf(LevelInfo, format, args...)
 }
 
 // LogInfo logs an informational message.
 func (l *Logger) LogInfo(message string) {
-	timestamp := time.Now().Format(time.RFC3339)
-	l.logger.Printf("%s [INFO] %s\n", timestamp, message)
+	l.logMessage(LevelInfo, message)
+}
+
+// LogDebugf logs a troubleshooting message with formatting.
+func (l *Logger) LogDebugf(format string, args ...interface{}) {
+	l.logf(LevelDebug, format, args...)
+}
+
+// logf formats and logs a message at the given level, if it is enabled.
+func (l *Logger) logf(level Level, format string, args ...interface{}) {
+	if l.Enabled(level) {
+		l.logMessage(level, fmt.Sprintf(format, args...))
+	}
+}
+
+// logMessage logs a message at the given level, if it is enabled.
+func (l *Logger) logMessage(level Level, message string) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.write(level, fmt.Sprintf("[%s] %s", level, message), Entry{Level: level.String(), Event: EventMessage, Message: message})
 }
 
-// Close closes the logger's file if it exists.
+// write writes an entry of the given level, as text or as e in FormatJSON.
+func (l *Logger) write(level Level, text string, e Entry) {
+	if l.sinks != nil {
+		for _, sink := range l.sinks {
+			if sink.Enabled(level) {
+				sink.write(level, text, e)
+			}
+		}
+		return
+	}
+	now := time.Now()
+	if l.handler != nil {
+		l.handle(now, level, e)
+		return
+	}
+	if l.format == FormatJSON {
+		e.Time = now.Format(time.RFC3339Nano)
+		data, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+		text = string(data)
+	} else if l.target == nil {
+		text = now.Format(time.RFC3339) + " " + text
+	}
+
+	if l.target != nil {
+		// A failing target has nowhere to report to
+		_ = l.target.WriteLevel(level, text)
+		return
+	}
+	l.logger.Println(text)
+}
+
+// Close closes the logger's file, target or sinks if it has them.
 func (l *Logger) Close() error {
+	if l.sinks != nil {
+		var errs []error
+		for _, sink := range l.sinks {
+			errs = append(errs, sink.Close())
+		}
+		return errors.Join(errs...)
+	}
+	if l.target != nil {
+		return l.target.Close()
+	}
 	if l.file != nil {
 		return l.file.Close()
 	}
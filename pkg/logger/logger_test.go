@@ -2,10 +2,13 @@ package logger
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestLogger_LogCommandAttempt(t *testing.T) {
@@ -233,3 +236,128 @@ func TestNew_NoOutput(_ *testing.T) {
 
 	// If we reached here without errors, the test passed
 }
+
+func TestLogger_JSONFormat(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := NewWithWriter(buf)
+	logger.SetFormat(FormatJSON)
+
+	logger.LogCommandDecision("run-1", "rm", []string{"-rf", "/"}, false)
+	logger.LogErrorf("Parse error: %s", "unexpected EOF")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), buf.String())
+	}
+
+	var command Entry
+	if err := json.Unmarshal([]byte(lines[0]), &command); err != nil {
+		t.Fatalf("command entry is not JSON: %v", err)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, command.Time); err != nil {
+		t.Errorf("time = %q, want an RFC 3339 timestamp", command.Time)
+	}
+	want := Entry{Time: command.Time, Level: "WARN", Event: EventCommand, Command: "rm",
+		Args: []string{"-rf", "/"}, Decision: "blocked", RunID: "run-1"}
+	if !reflect.DeepEqual(command, want) {
+		t.Errorf("command entry = %+v, want %+v", command, want)
+	}
+
+	var message Entry
+	if err := json.Unmarshal([]byte(lines[1]), &message); err != nil {
+		t.Fatalf("message entry is not JSON: %v", err)
+	}
+	if message.Level != "ERROR" || message.Event != EventMessage || message.Message != "Parse error: unexpected EOF" {
+		t.Errorf("message entry = %+v", message)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for input, want := range map[string]Format{"": FormatText, "text": FormatText, "json": FormatJSON} {
+		got, err := ParseFormat(input)
+		if err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("ParseFormat(\"xml\") succeeded, want an error")
+	}
+}
+
+func TestLogger_Level(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := NewWithWriter(buf)
+
+	logger.LogDebugf("hidden by default")
+	if buf.Len() != 0 {
+		t.Errorf("debug message logged at the default level: %q", buf.String())
+	}
+
+	logger.SetLevel(LevelWarn)
+	logger.LogInfof("info")
+	logger.LogCommandAttempt("ls", nil, true)
+	logger.LogCommandAttempt("rm", nil, false)
+	logger.LogWarnf("warning")
+	logger.LogErrorf("error")
+	got := buf.String()
+	for _, unwanted := range []string{"[INFO]", "ALLOWED"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("output = %q, want no %s entries", got, unwanted)
+		}
+	}
+	for _, wanted := range []string{"[BLOCKED] Command: rm", "[WARN] warning", "[ERROR] error"} {
+		if !strings.Contains(got, wanted) {
+			t.Errorf("output = %q, want to contain %q", got, wanted)
+		}
+	}
+
+	buf.Reset()
+	logger.SetLevel(LevelDebug)
+	logger.LogDebugf("value %d", 42)
+	if !strings.Contains(buf.String(), "[DEBUG] value 42") {
+		t.Errorf("output = %q, want a debug entry", buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for input, want := range map[string]Level{"": LevelInfo, "debug": LevelDebug, "INFO": LevelInfo, "warn": LevelWarn, "error": LevelError} {
+		got, err := ParseLevel(input)
+		if err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", input, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(\"verbose\") succeeded, want an error")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	logger, err := Open(Options{Path: path, Format: "json", Level: "warn"})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	logger.LogInfo("hidden")
+	logger.LogWarnf("shown")
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if strings.Contains(string(data), "hidden") || !strings.Contains(string(data), `"message":"shown"`) {
+		t.Errorf("log = %q, want only the warning as JSON", data)
+	}
+
+	for _, opts := range []Options{
+		{Target: "stdout"},
+		{Format: "xml"},
+		{Level: "verbose"},
+		{Target: TargetSyslog, Syslog: SyslogOptions{Facility: "local9"}},
+	} {
+		if _, err := Open(opts); err == nil {
+			t.Errorf("Open(%+v) succeeded, want an error", opts)
+		}
+	}
+}
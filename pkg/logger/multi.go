@@ -0,0 +1,17 @@
+package logger
+
+import (
+	"io"
+	"log"
+)
+
+// NewMulti creates a logger that writes every entry to each of sinks whose level it
+// reaches, so that, for example, errors go to stderr while everything goes to a file.
+// Closing it closes the sinks.
+func NewMulti(sinks ...*Logger) *Logger {
+	return &Logger{
+		logger: log.New(io.Discard, "", 0),
+		sinks:  sinks,
+		level:  LevelDebug,
+	}
+}
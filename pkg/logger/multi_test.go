@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNewMulti(t *testing.T) {
+	all, errorsOnly := &bytes.Buffer{}, &bytes.Buffer{}
+	allLogger := NewWithWriter(all)
+	allLogger.SetLevel(LevelDebug)
+	errorLogger := NewWithWriter(errorsOnly)
+	errorLogger.SetLevel(LevelError)
+	errorLogger.SetFormat(FormatJSON)
+	logger := NewMulti(allLogger, errorLogger)
+
+	if !logger.Enabled(LevelDebug) {
+		t.Error("Enabled(LevelDebug) = false, want true while a sink logs debug entries")
+	}
+	logger.LogDebugf("debug")
+	logger.LogErrorf("failure")
+
+	if got := all.String(); !strings.Contains(got, "[DEBUG] debug") || !strings.Contains(got, "[ERROR] failure") {
+		t.Errorf("first sink = %q, want both entries", got)
+	}
+	if got := errorsOnly.String(); strings.Contains(got, "debug") || !strings.Contains(got, `"message":"failure"`) {
+		t.Errorf("second sink = %q, want only the error as JSON", got)
+	}
+	if NewMulti(errorLogger).Enabled(LevelInfo) {
+		t.Error("Enabled(LevelInfo) = true, want false when no sink logs it")
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var mu sync.Mutex
+	var received []Entry
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var entry Entry
+		if err := json.Unmarshal(body, &entry); err != nil {
+			t.Errorf("webhook body is not JSON: %q", body)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		mu.Lock()
+		received = append(received, entry)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "server.log")
+	logger, err := Open(Options{
+		Path:  path,
+		Sinks: []Sink{{Target: TargetWebhook, URL: server.URL, Level: "warn"}},
+	})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	logger.LogInfo("to the file only")
+	logger.LogCommandDecision("run-1", "rm", nil, false)
+	// Close waits for the queued entries to be posted
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 || received[0].Command != "rm" || received[0].RunID != "run-1" {
+		t.Errorf("webhook received %+v, want the blocked command", received)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "to the file only") || !strings.Contains(string(data), "[BLOCKED]") {
+		t.Errorf("file = %q, want both entries", data)
+	}
+}
+
+func TestOpenSinkErrors(t *testing.T) {
+	for _, sink := range []Sink{
+		{Target: TargetWebhook, URL: "ftp://example.com"},
+		{Target: TargetFile, Path: filepath.Join(t.TempDir(), "missing", "dir", "x.log")},
+		{Target: TargetStderr, Level: "loud"},
+	} {
+		if _, err := Open(Options{Sinks: []Sink{sink}}); err == nil {
+			t.Errorf("Open() with sink %+v succeeded, want an error", sink)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package logger
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the timestamp in the names of rotated files, which sorts by time.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// Rotation configures when a RotatingFile is rotated and how many old files are kept. The
+// zero value never rotates.
+type Rotation struct {
+	// MaxSizeMB is the size in megabytes a file may reach before it is rotated (0 means unlimited)
+	MaxSizeMB int
+	// MaxBackups is the number of rotated files kept (0 keeps all)
+	MaxBackups int
+	// MaxAgeDays is the number of days rotated files are kept (0 keeps them regardless of age)
+	MaxAgeDays int
+	// Compress gzips rotated files
+	Compress bool
+}
+
+// RotatingFile is an append-only file that is renamed to a backup named after the time of
+// rotation, e.g. server-2025-05-01T10-00-00.000.log, once it would grow beyond MaxSizeMB.
+// Backups beyond MaxBackups or older than MaxAgeDays are removed. It is safe for concurrent use.
+type RotatingFile struct {
+	path     string
+	perm     os.FileMode
+	rotation Rotation
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenRotatingFile opens or creates the file at path for appending, creating it with perm.
+func OpenRotatingFile(path string, perm os.FileMode, rotation Rotation) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, perm: perm, rotation: rotation}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	if err := f.removeOldBackups(); err != nil {
+		f.file.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the file at f.path and records its size.
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, f.perm)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// Write implements the io.Writer interface. The file is rotated first if p would make it
+// larger than MaxSizeMB; a single write larger than that still goes to one file.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	maxSize := int64(f.rotation.MaxSizeMB) * 1024 * 1024
+	if maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, fmt.Errorf("failed to rotate %s: %w", f.path, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// rotate renames the file to a backup, starts a new file and removes old backups.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	backup := f.backupPath(time.Now())
+	if err := os.Rename(f.path, backup); err != nil {
+		// Keep writing to the current file
+		return errors.Join(err, f.open())
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	if f.rotation.Compress {
+		if err := compressFile(backup); err != nil {
+			return err
+		}
+	}
+	return f.removeOldBackups()
+}
+
+// backupPath returns the name of the backup of the file rotated at t.
+func (f *RotatingFile) backupPath(t time.Time) string {
+	dir, name := filepath.Split(f.path)
+	ext := filepath.Ext(name)
+	return filepath.Join(dir, strings.TrimSuffix(name, ext)+"-"+t.UTC().Format(backupTimeFormat)+ext)
+}
+
+// backups returns the paths of the file's backups with the times they were rotated at,
+// newest first.
+func (f *RotatingFile) backups() ([]string, []time.Time, error) {
+	dir, name := filepath.Split(f.path)
+	ext := filepath.Ext(name)
+	prefix := strings.TrimSuffix(name, ext) + "-"
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type backup struct {
+		path string
+		time time.Time
+	}
+	var found []backup
+	for _, entry := range entries {
+		stamp, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		stamp = strings.TrimSuffix(stamp, ".gz")
+		stamp, ok = strings.CutSuffix(stamp, ext)
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		found = append(found, backup{path: filepath.Join(dir, entry.Name()), time: t})
+	}
+	slices.SortFunc(found, func(a, b backup) int { return b.time.Compare(a.time) })
+
+	paths := make([]string, len(found))
+	times := make([]time.Time, len(found))
+	for i, b := range found {
+		paths[i], times[i] = b.path, b.time
+	}
+	return paths, times, nil
+}
+
+// removeOldBackups removes the backups beyond MaxBackups and those older than MaxAgeDays.
+func (f *RotatingFile) removeOldBackups() error {
+	if f.rotation.MaxBackups <= 0 && f.rotation.MaxAgeDays <= 0 {
+		return nil
+	}
+	paths, times, err := f.backups()
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().AddDate(0, 0, -f.rotation.MaxAgeDays)
+	var errs []error
+	for i, path := range paths {
+		tooMany := f.rotation.MaxBackups > 0 && i >= f.rotation.MaxBackups
+		tooOld := f.rotation.MaxAgeDays > 0 && times[i].Before(cutoff)
+		if tooMany || tooOld {
+			errs = append(errs, os.Remove(path))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// compressFile replaces the file at path with a gzipped copy named path.gz.
+func compressFile(path string) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path + ".gz")
+		}
+	}()
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	// Windows cannot remove open files
+	src.Close()
+	return os.Remove(path)
+}
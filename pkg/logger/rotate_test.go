@@ -0,0 +1,125 @@
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// halfMB is half the smallest size limit, so that every second write rotates.
+var halfMB = bytes.Repeat([]byte("x"), 512*1024)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.log")
+
+	f, err := OpenRotatingFile(path, 0o644, Rotation{MaxSizeMB: 1, MaxBackups: 1})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile() error = %v", err)
+	}
+	defer f.Close()
+
+	for i := range 5 {
+		if _, err := f.Write(halfMB); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		if i%2 == 1 {
+			// Keep the names of backups apart
+			time.Sleep(2 * time.Millisecond)
+		}
+	}
+
+	// Writes 1-2 and 3-4 filled files; the first of them was removed beyond MaxBackups
+	backups, _, err := f.backups()
+	if err != nil {
+		t.Fatalf("backups() error = %v", err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v, want 1", backups)
+	}
+	if !strings.HasPrefix(filepath.Base(backups[0]), "server-") || filepath.Ext(backups[0]) != ".log" {
+		t.Errorf("backup name = %s, want server-<time>.log", backups[0])
+	}
+	for _, file := range []string{path, backups[0]} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("Stat() error = %v", err)
+		}
+		want := int64(len(halfMB))
+		if file == backups[0] {
+			want *= 2
+		}
+		if info.Size() != want {
+			t.Errorf("size of %s = %d, want %d", file, info.Size(), want)
+		}
+	}
+}
+
+func TestRotatingFileCompress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocked.log")
+
+	f, err := OpenRotatingFile(path, 0o644, Rotation{MaxSizeMB: 1, Compress: true})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile() error = %v", err)
+	}
+	defer f.Close()
+	for range 3 {
+		if _, err := f.Write(halfMB); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	backups, _, err := f.backups()
+	if err != nil || len(backups) != 1 || !strings.HasSuffix(backups[0], ".log.gz") {
+		t.Fatalf("backups = %v, %v, want one .log.gz file", backups, err)
+	}
+	gzFile, err := os.Open(backups[0])
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer gzFile.Close()
+	gz, err := gzip.NewReader(gzFile)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if len(data) != 2*len(halfMB) {
+		t.Errorf("decompressed size = %d, want %d", len(data), 2*len(halfMB))
+	}
+}
+
+func TestRotatingFileMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.log")
+	old := filepath.Join(dir, "server-"+time.Now().AddDate(0, 0, -10).UTC().Format(backupTimeFormat)+".log.gz")
+	recent := filepath.Join(dir, "server-"+time.Now().AddDate(0, 0, -1).UTC().Format(backupTimeFormat)+".log")
+	unrelated := filepath.Join(dir, "server-notes.log")
+	for _, file := range []string{old, recent, unrelated} {
+		if err := os.WriteFile(file, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := OpenRotatingFile(path, 0o644, Rotation{MaxAgeDays: 7})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile() error = %v", err)
+	}
+	defer f.Close()
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("backup older than MaxAgeDays was kept: %v", err)
+	}
+	for _, file := range []string{recent, unrelated} {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("%s was removed: %v", file, err)
+		}
+	}
+}
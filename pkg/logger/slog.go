@@ -0,0 +1,47 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"time"
+)
+
+// NewWithHandler creates a logger that passes its entries to h as slog records, so that an
+// application embedding the runner can route them into its own structured logging. The
+// record's message is the entry's message, or "command allowed" or "command blocked", and
+// its attributes are the other fields of the entry: event, command, args, decision and
+// run_id. Which levels are logged is left to h.
+func NewWithHandler(h slog.Handler) *Logger {
+	return &Logger{
+		logger:  log.New(io.Discard, "", 0),
+		handler: h,
+		level:   LevelDebug,
+	}
+}
+
+// NewSlog creates a logger that writes to l; see NewWithHandler.
+func NewSlog(l *slog.Logger) *Logger {
+	return NewWithHandler(l.Handler())
+}
+
+// handle passes e to the handler as a record.
+func (l *Logger) handle(t time.Time, level Level, e Entry) {
+	message := e.Message
+	attrs := []slog.Attr{slog.String("event", e.Event)}
+	if e.Event == EventCommand {
+		message = "command " + e.Decision
+		attrs = append(attrs,
+			slog.String("command", e.Command),
+			slog.Any("args", e.Args),
+			slog.String("decision", e.Decision))
+		if e.RunID != "" {
+			attrs = append(attrs, slog.String("run_id", e.RunID))
+		}
+	}
+	record := slog.NewRecord(t, slog.Level(level), message, 0)
+	record.AddAttrs(attrs...)
+	// A failing handler has nowhere to report to
+	_ = l.handler.Handle(context.Background(), record)
+}
@@ -0,0 +1,55 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNewWithHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := NewSlog(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	if logger.Enabled(LevelInfo) {
+		t.Error("Enabled(LevelInfo) = true, want the handler's level to apply")
+	}
+	logger.LogInfof("hidden")
+	logger.LogCommandDecision("run-1", "rm", []string{"-rf", "/"}, false)
+	logger.LogErrorf("failed: %d", 1)
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d records, want 2: %q", len(lines), buf.String())
+	}
+
+	var command map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &command); err != nil {
+		t.Fatalf("record is not JSON: %v", err)
+	}
+	want := map[string]any{"level": "WARN", "msg": "command blocked", "event": "command", "command": "rm",
+		"args": []any{"-rf", "/"}, "decision": "blocked", "run_id": "run-1"}
+	for key, value := range want {
+		if got, _ := json.Marshal(command[key]); string(got) != mustJSON(t, value) {
+			t.Errorf("%s = %s, want %s", key, got, mustJSON(t, value))
+		}
+	}
+
+	var message map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &message); err != nil {
+		t.Fatalf("record is not JSON: %v", err)
+	}
+	if message["level"] != "ERROR" || message["msg"] != "failed: 1" || message["event"] != EventMessage {
+		t.Errorf("message record = %v", message)
+	}
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,59 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultSyslogTag is the tag of syslog and journal entries when none is configured.
+const DefaultSyslogTag = "secure-shell-server"
+
+// SyslogOptions configure the syslog and journald targets.
+type SyslogOptions struct {
+	// Facility is the syslog facility name, e.g. "daemon" or "local0" (default "user")
+	Facility string
+	// Tag identifies the entries of this program (default DefaultSyslogTag)
+	Tag string
+}
+
+// facilities maps syslog facility names to their codes.
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6,
+	"news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// facility returns the code of the configured facility.
+func (o SyslogOptions) facility() (int, error) {
+	if o.Facility == "" {
+		return facilities["user"], nil
+	}
+	code, ok := facilities[strings.ToLower(o.Facility)]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog facility %q", o.Facility)
+	}
+	return code, nil
+}
+
+// tag returns the configured tag or DefaultSyslogTag.
+func (o SyslogOptions) tag() string {
+	if o.Tag == "" {
+		return DefaultSyslogTag
+	}
+	return o.Tag
+}
+
+// severity returns the syslog severity of a level.
+func severity(level Level) int {
+	switch {
+	case level >= LevelError:
+		return 3 // err
+	case level >= LevelWarn:
+		return 4 // warning
+	case level >= LevelInfo:
+		return 6 // info
+	default:
+		return 7 // debug
+	}
+}
@@ -0,0 +1,45 @@
+//go:build !windows && !plan9
+
+package logger
+
+import (
+	"log/syslog"
+)
+
+// syslogWriter writes entries to syslog with the severity of their level.
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+// dialSyslog connects to the syslog daemon at addr on network, or to the local daemon if
+// both are empty.
+func dialSyslog(network, addr string, opts SyslogOptions) (levelWriter, error) {
+	facility, err := opts.facility()
+	if err != nil {
+		return nil, err
+	}
+	w, err := syslog.Dial(network, addr, syslog.Priority(facility<<3)|syslog.LOG_INFO, opts.tag())
+	if err != nil {
+		return nil, err
+	}
+	return &syslogWriter{w: w}, nil
+}
+
+// WriteLevel implements levelWriter.
+func (s *syslogWriter) WriteLevel(level Level, line string) error {
+	switch severity(level) {
+	case 3:
+		return s.w.Err(line)
+	case 4:
+		return s.w.Warning(line)
+	case 6:
+		return s.w.Info(line)
+	default:
+		return s.w.Debug(line)
+	}
+}
+
+// Close implements io.Closer.
+func (s *syslogWriter) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,87 @@
+//go:build !windows && !plan9
+
+package logger
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenUnixgram returns a datagram socket in a temporary directory.
+func listenUnixgram(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("ListenUnixgram() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// receive returns the next datagram of conn.
+func receive(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	buf := make([]byte, 4096)
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestSyslogTarget(t *testing.T) {
+	conn := listenUnixgram(t)
+	target, err := dialSyslog("unixgram", conn.LocalAddr().String(), SyslogOptions{Facility: "local3", Tag: "shell"})
+	if err != nil {
+		t.Fatalf("dialSyslog() error = %v", err)
+	}
+	logger := newWithTarget(target)
+	defer logger.Close()
+
+	logger.LogCommandAttempt("rm", []string{"-rf"}, false)
+	got := receive(t, conn)
+	// local3 (19) * 8 + warning (4)
+	if !strings.HasPrefix(got, "<156>") || !strings.Contains(got, "shell[") ||
+		!strings.HasSuffix(strings.TrimSuffix(got, "\n"), "]: [BLOCKED] Command: rm [-rf]") {
+		t.Errorf("syslog message = %q", got)
+	}
+}
+
+func TestJournalTarget(t *testing.T) {
+	conn := listenUnixgram(t)
+	target, err := dialJournal(conn.LocalAddr().String(), SyslogOptions{Facility: "daemon"})
+	if err != nil {
+		t.Fatalf("dialJournal() error = %v", err)
+	}
+	logger := newWithTarget(target)
+	defer logger.Close()
+
+	logger.LogErrorf("Parse error: %s", "bad")
+	want := "MESSAGE=[ERROR] Parse error: bad\nPRIORITY=3\nSYSLOG_FACILITY=3\nSYSLOG_IDENTIFIER=secure-shell-server\n"
+	if got := receive(t, conn); got != want {
+		t.Errorf("journal message = %q, want %q", got, want)
+	}
+
+	// Multi-line messages are sent with their length
+	logger.LogInfo("two\nlines")
+	got := receive(t, conn)
+	wantPrefix := "MESSAGE\n" + string([]byte{16, 0, 0, 0, 0, 0, 0, 0}) + "[INFO] two\nlines\n"
+	if !strings.HasPrefix(got, wantPrefix) {
+		t.Errorf("journal message = %q, want prefix %q", got, wantPrefix)
+	}
+
+	// JSON entries keep their own fields
+	logger.SetFormat(FormatJSON)
+	logger.LogInfo("json")
+	if got := receive(t, conn); !bytes.Contains([]byte(got), []byte(`MESSAGE={"time":`)) {
+		t.Errorf("journal message = %q, want a JSON entry", got)
+	}
+}
@@ -0,0 +1,103 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// webhookQueueSize is the number of entries waiting to be posted before new ones are dropped
+	webhookQueueSize = 1024
+	// webhookTimeout limits each request, so a slow endpoint cannot hold up the queue for long
+	webhookTimeout = 5 * time.Second
+)
+
+// errWebhookQueueFull is returned for entries dropped because the endpoint is behind.
+var errWebhookQueueFull = errors.New("webhook queue is full")
+
+// webhookWriter posts entries to a URL in the background, so that logging never waits for
+// the endpoint.
+type webhookWriter struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	closed  bool
+	entries chan string
+	done    chan struct{}
+}
+
+// NewWebhook creates a new logger that posts each entry as a JSON object to rawURL.
+// Entries are sent in the background and dropped if the endpoint falls too far behind.
+func NewWebhook(rawURL string) (*Logger, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL %q", rawURL)
+	}
+	w := &webhookWriter{
+		url:     rawURL,
+		client:  &http.Client{Timeout: webhookTimeout},
+		entries: make(chan string, webhookQueueSize),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	l := newWithTarget(w)
+	l.SetFormat(FormatJSON)
+	return l, nil
+}
+
+// WriteLevel implements levelWriter by queueing line.
+func (w *webhookWriter) WriteLevel(_ Level, line string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errors.New("webhook is closed")
+	}
+	select {
+	case w.entries <- line:
+		return nil
+	default:
+		return errWebhookQueueFull
+	}
+}
+
+// run posts the queued entries until the queue is closed.
+func (w *webhookWriter) run() {
+	defer close(w.done)
+	for line := range w.entries {
+		// A failing endpoint has nowhere to report to
+		_ = w.post(line)
+	}
+}
+
+// post sends one entry.
+func (w *webhookWriter) post(line string) error {
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewBufferString(line))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Close implements io.Closer. It waits for the queued entries to be posted.
+func (w *webhookWriter) Close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.entries)
+	}
+	w.mu.Unlock()
+	<-w.done
+	return nil
+}
@@ -0,0 +1,239 @@
+// Package policytest runs test cases against a security policy, so that teams can keep
+// unit tests for their policies next to them and check every change.
+//
+// A suite is a JSON or YAML file listing commands with the verdict the policy must give
+// them:
+//
+//	config: policy.json
+//	tests:
+//	  - name: status is fine
+//	    command: git status
+//	    dir: /home/me/project
+//	    expect: allow
+//	  - command: git push --force
+//	    expect: deny
+//	    rule: allowCommands[git].subCommands[push].denyFlags[--force]
+package policytest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+// Expected verdicts of a case.
+const (
+	ExpectAllow = "allow"
+	ExpectDeny  = "deny"
+)
+
+// Suite is a file of test cases.
+type Suite struct {
+	// Config is the configuration file the cases are checked against, relative to the
+	// suite's file. It may be left out when the configuration is given otherwise.
+	Config string `json:"config,omitempty" yaml:"config,omitempty"`
+	// Dir is the directory of cases that do not set their own, relative to the suite's file
+	// (defaults to the configuration's workingDir, else its first allowed directory)
+	Dir   string `json:"dir,omitempty" yaml:"dir,omitempty"`
+	Tests []Case `json:"tests" yaml:"tests"`
+	// path is the file the suite was loaded from
+	path string
+}
+
+// Case is a command and the verdict the policy must give it.
+type Case struct {
+	// Name describes the case in the report (defaults to the command)
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"`
+	Command string `json:"command" yaml:"command"`
+	// Dir is the directory the command is checked in (defaults to the suite's)
+	Dir string `json:"dir,omitempty" yaml:"dir,omitempty"`
+	// Profile checks the command against a profile instead of the top-level policy
+	Profile string `json:"profile,omitempty" yaml:"profile,omitempty"`
+	// Expect is ExpectAllow or ExpectDeny
+	Expect string `json:"expect" yaml:"expect"`
+	// Rule and Code, when set, must match the rule and code of the verdict
+	Rule string `json:"rule,omitempty" yaml:"rule,omitempty"`
+	Code string `json:"code,omitempty" yaml:"code,omitempty"`
+}
+
+// Result is the outcome of a case.
+type Result struct {
+	Case    Case
+	Verdict validator.ValidationResult
+	// Failure describes how the verdict differs from the expected one, "" when it passed
+	Failure string
+}
+
+// Passed reports whether the case passed.
+func (r Result) Passed() bool { return r.Failure == "" }
+
+// Load reads a suite from a JSON file or, with a .yaml or .yml extension, a YAML file, and
+// checks that its cases are complete.
+func Load(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test suite: %w", err)
+	}
+	suite := &Suite{path: path}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, suite)
+	default:
+		err = json.Unmarshal(data, suite)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse test suite %s: %w", path, err)
+	}
+
+	for i, c := range suite.Tests {
+		if c.Command == "" {
+			return nil, fmt.Errorf("%s: test %d has no command", path, i+1)
+		}
+		if c.Expect != ExpectAllow && c.Expect != ExpectDeny {
+			return nil, fmt.Errorf("%s: test %q: expect must be %q or %q, not %q", path, c.name(), ExpectAllow, ExpectDeny, c.Expect)
+		}
+	}
+	return suite, nil
+}
+
+// ConfigPath returns the path of the suite's configuration file, "" when it names none.
+func (s *Suite) ConfigPath() string {
+	return s.resolve(s.Config)
+}
+
+// resolve resolves path against the directory of the suite's file when it is relative.
+func (s *Suite) resolve(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(s.path), path)
+}
+
+// name returns the name of the case in the report.
+func (c Case) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Command
+}
+
+// Run checks every case of the suite against cfg. Rate limits are checked without being
+// consumed, so cases do not affect each other.
+func (s *Suite) Run(cfg *config.ShellCommandConfig) []Result {
+	policies := map[string]*policy{}
+	results := make([]Result, len(s.Tests))
+	for i, c := range s.Tests {
+		results[i] = Result{Case: c}
+		p, err := policyFor(policies, cfg, c.Profile)
+		if err != nil {
+			results[i].Failure = err.Error()
+			continue
+		}
+		dir := s.resolve(c.Dir)
+		if dir == "" {
+			dir = s.resolve(s.Dir)
+		}
+		if dir == "" {
+			dir = defaultDir(p.config)
+		}
+
+		verdict := p.validator.ValidateDirectory(dir)
+		if verdict.Allowed {
+			verdict = p.validator.CheckScript(context.Background(), c.Command, dir)
+		}
+		results[i].Verdict = verdict
+		results[i].Failure = c.compare(verdict)
+	}
+	return results
+}
+
+// policy is a configuration with its validator.
+type policy struct {
+	config    *config.ShellCommandConfig
+	validator *validator.CommandValidator
+}
+
+// policyFor returns the policy of the named profile of cfg, or of cfg itself for "",
+// creating it on first use.
+func policyFor(policies map[string]*policy, cfg *config.ShellCommandConfig, profile string) (*policy, error) {
+	if p, ok := policies[profile]; ok {
+		return p, nil
+	}
+	if profile != "" {
+		var err error
+		if cfg, err = cfg.GetProfile(profile); err != nil {
+			return nil, err
+		}
+	}
+	policies[profile] = &policy{config: cfg, validator: validator.New(cfg, logger.New())}
+	return policies[profile], nil
+}
+
+// defaultDir returns the directory commands of cfg run in when none is given.
+func defaultDir(cfg *config.ShellCommandConfig) string {
+	if cfg.WorkingDir != "" {
+		return cfg.WorkingDir
+	}
+	if len(cfg.AllowedDirectories) > 0 {
+		return cfg.AllowedDirectories[0]
+	}
+	return ""
+}
+
+// compare describes how verdict differs from the case's expectations, "" when it matches.
+func (c Case) compare(verdict validator.ValidationResult) string {
+	var diffs []string
+	if verdict.Allowed != (c.Expect == ExpectAllow) {
+		got := ExpectDeny
+		if verdict.Allowed {
+			got = ExpectAllow
+		}
+		diffs = append(diffs, fmt.Sprintf("expected %s, got %s", c.Expect, got))
+	}
+	if c.Rule != "" && c.Rule != verdict.Rule {
+		diffs = append(diffs, fmt.Sprintf("expected rule %s, got %s", c.Rule, orNone(verdict.Rule)))
+	}
+	if c.Code != "" && c.Code != string(verdict.Code) {
+		diffs = append(diffs, fmt.Sprintf("expected code %s, got %s", c.Code, orNone(string(verdict.Code))))
+	}
+	return strings.Join(diffs, "; ")
+}
+
+// orNone returns s, or "none" when it is empty.
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// Report writes one line per result, followed by the details of failures and a summary,
+// and returns the number of failed cases.
+func Report(w io.Writer, results []Result) int {
+	failed := 0
+	for _, r := range results {
+		if r.Passed() {
+			fmt.Fprintf(w, "PASS  %s\n", r.Case.name())
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "FAIL  %s\n", r.Case.name())
+		fmt.Fprintf(w, "      command: %s\n", r.Case.Command)
+		fmt.Fprintf(w, "      %s\n", r.Failure)
+		if r.Verdict.Message != "" {
+			fmt.Fprintf(w, "      message: %s\n", r.Verdict.Message)
+		}
+	}
+	fmt.Fprintf(w, "\n%d passed, %d failed\n", len(results)-failed, failed)
+	return failed
+}
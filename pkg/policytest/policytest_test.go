@@ -0,0 +1,107 @@
+package policytest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+func TestSuite(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	assert.NoError(t, os.Mkdir(project, 0o755))
+	writeFile := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	path := writeFile("suite.yaml", `
+config: policy.json
+dir: project
+tests:
+  - name: status is fine
+    command: git status
+    expect: allow
+  - command: git push --force
+    expect: deny
+    rule: allowCommands[git].denyFlags[--force]
+  - command: rm -rf /
+    expect: deny
+    code: COMMAND_DENIED
+  - name: wrong expectation
+    command: ls
+    expect: deny
+  - name: read-only profile
+    command: git status
+    profile: readonly
+    expect: deny
+    rule: denyCommands
+`)
+	suite, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "policy.json"), suite.ConfigPath())
+
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{dir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "ls"},
+			{Command: "git", DenyFlags: []string{"--force"}},
+		},
+		DenyCommands: []config.DenyCommand{{Command: "rm"}},
+		Profiles: map[string]*config.ShellCommandConfig{
+			"readonly": {AllowedDirectories: []string{dir}, AllowCommands: []config.AllowCommand{{Command: "ls"}}},
+		},
+	}
+	results := suite.Run(cfg)
+	assert.Equal(t, 5, len(results))
+	for i, want := range []string{
+		"",
+		"",
+		"",
+		"expected deny, got allow",
+		"expected rule denyCommands, got allowCommands",
+	} {
+		assert.Equal(t, want, results[i].Failure, "case %d", i+1)
+	}
+
+	var report strings.Builder
+	assert.Equal(t, 2, Report(&report, results))
+	assert.Contains(t, report.String(), "PASS  status is fine\n")
+	assert.Contains(t, report.String(), "FAIL  wrong expectation\n")
+	assert.Contains(t, report.String(), "3 passed, 2 failed")
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{"json", "suite.json", `{"tests": [{"command": "ls", "expect": "allow"}]}`, ""},
+		{"missing command", "suite.json", `{"tests": [{"expect": "allow"}]}`, "has no command"},
+		{"unknown expectation", "suite.yml", "tests:\n  - command: ls\n    expect: maybe\n", "expect must be"},
+		{"malformed", "suite.json", `{"tests": [`, "failed to parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			assert.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+			_, err := Load(path)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package runner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// auditLogPermissions are the permissions of a newly created audit log. Scripts can contain
+// secrets, so only the owner may read it.
+const auditLogPermissions = 0o600
+
+// recentRunsKept is the number of audit records kept in memory for RecentRuns.
+const recentRunsKept = 100
+
+// AuditRecord is the entry written to the audit log for every run.
+type AuditRecord struct {
+	ID string `json:"id"`
+	// Client identifies the client that requested the run, as in Request.
+	Client     string    `json:"client,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	WorkingDir string    `json:"workingDir"`
+	// Script is the shell script as requested.
+	Script string `json:"script"`
+	// Commands lists the commands that passed validation and were run, in order.
+	Commands []ExecutedCommand `json:"commands"`
+	// ExitCode is the script's exit code, or ExitCodeNotRun if it did not run to completion.
+	ExitCode int `json:"exitCode"`
+	// Processes is the resource usage of each external command, in the order they exited.
+	Processes []ProcessUsage `json:"processes"`
+	// Error is the reason the script did not run to completion or exited non-zero.
+	Error  string      `json:"error,omitempty"`
+	Stdout OutputStats `json:"stdout"`
+	Stderr OutputStats `json:"stderr"`
+	// StdoutLog and StderrLog are the files the complete output was written to, if any.
+	StdoutLog string `json:"stdoutLog,omitempty"`
+	StderrLog string `json:"stderrLog,omitempty"`
+}
+
+// newAuditRecord builds the audit record of a finished run.
+func newAuditRecord(req Request, workingDir string, startedAt time.Time, result RunResult) AuditRecord {
+	if abs, err := filepath.Abs(workingDir); err == nil {
+		workingDir = abs
+	}
+	record := AuditRecord{
+		ID:         result.ID,
+		Client:     req.Client,
+		StartedAt:  startedAt,
+		FinishedAt: time.Now(),
+		WorkingDir: workingDir,
+		Script:     req.Command,
+		Commands:   result.Commands,
+		ExitCode:   ExitCode(result.Err),
+		Processes:  result.Processes,
+		Stdout:     result.Stdout,
+		Stderr:     result.Stderr,
+		StdoutLog:  result.StdoutLog,
+		StderrLog:  result.StderrLog,
+	}
+	if record.Commands == nil {
+		record.Commands = []ExecutedCommand{}
+	}
+	if record.Processes == nil {
+		record.Processes = []ProcessUsage{}
+	}
+	if result.Err != nil {
+		record.Error = result.Err.Error()
+	}
+	return record
+}
+
+// rememberRun keeps record for RecentRuns, dropping the oldest beyond recentRunsKept.
+func (r *SafeRunner) rememberRun(record AuditRecord) {
+	r.recentMu.Lock()
+	defer r.recentMu.Unlock()
+	if len(r.recent) == recentRunsKept {
+		r.recent = slices.Delete(r.recent, 0, 1)
+	}
+	r.recent = append(r.recent, record)
+}
+
+// RecentRuns returns the audit records of the most recent runs requested by client, oldest
+// first. Runs are kept in memory whether or not an audit log is configured.
+func (r *SafeRunner) RecentRuns(client string) []AuditRecord {
+	r.recentMu.Lock()
+	defer r.recentMu.Unlock()
+	runs := []AuditRecord{}
+	for _, record := range r.recent {
+		if record.Client == client {
+			runs = append(runs, record)
+		}
+	}
+	return runs
+}
+
+// notifyObserver passes record to the function set with SetRunObserver, if any.
+func (r *SafeRunner) notifyObserver(record AuditRecord) {
+	r.mu.Lock()
+	observer := r.observer
+	r.mu.Unlock()
+	if observer != nil {
+		observer(record)
+	}
+}
+
+// writeAudit appends record to the audit log, if one is configured. Failures are logged
+// rather than failing the run.
+func (r *SafeRunner) writeAudit(record AuditRecord) {
+	if r.config.AuditLogPath == "" {
+		return
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		r.logger.LogErrorf("Failed to encode audit record: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	r.auditMu.Lock()
+	defer r.auditMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(r.config.AuditLogPath), workingDirPermissions); err != nil {
+		r.logger.LogErrorf("Failed to create directory for audit log: %v", err)
+		return
+	}
+	f, err := os.OpenFile(r.config.AuditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, auditLogPermissions)
+	if err != nil {
+		r.logger.LogErrorf("Failed to open audit log file: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(line); err != nil {
+		r.logger.LogErrorf("Failed to write to audit log file: %v", err)
+	}
+}
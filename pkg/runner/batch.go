@@ -0,0 +1,106 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"mvdan.cc/sh/v3/syntax"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+// ErrNotRun is the error of a batch request that was not run because another request of the
+// batch failed.
+var ErrNotRun = errors.New("not run because another request of the batch failed")
+
+// BatchOptions control how RunBatch runs its requests.
+type BatchOptions struct {
+	// FailFast runs none of the requests if any of them fails validation, and in sequential
+	// batches stops at the first request that fails; the requests that were skipped end with
+	// ErrNotRun. Otherwise every request that passes validation runs.
+	FailFast bool
+	// Concurrent runs the requests in parallel instead of one after another in order.
+	Concurrent bool
+}
+
+// RunBatch validates the working directory and every command of each request, then runs
+// the requests that passed and returns their results in the order of reqs. Requests that
+// fail validation end with an error without running. Each request is run like Run, so its
+// commands are validated again as they execute.
+func (r *SafeRunner) RunBatch(ctx context.Context, reqs []Request, opts BatchOptions) []RunResult {
+	results := make([]RunResult, len(reqs))
+
+	valid := true
+	for i, req := range reqs {
+		if err := r.validateRequest(ctx, req); err != nil {
+			r.logger.LogErrorf("Batch request %d rejected: %v", i, err)
+			results[i].Err = err
+			valid = false
+		}
+	}
+	if !valid && opts.FailFast {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = ErrNotRun
+			}
+		}
+		return results
+	}
+
+	if opts.Concurrent {
+		var wg sync.WaitGroup
+		for i, req := range reqs {
+			if results[i].Err != nil {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i] = r.Run(ctx, req)
+			}()
+		}
+		wg.Wait()
+		return results
+	}
+
+	failed := false
+	for i, req := range reqs {
+		if results[i].Err != nil {
+			continue
+		}
+		if failed {
+			results[i].Err = ErrNotRun
+			continue
+		}
+		results[i] = r.Run(ctx, req)
+		failed = opts.FailFast && results[i].Err != nil
+	}
+	return results
+}
+
+// validateRequest checks the working directory, the script limits and the commands of req
+// without running it. Parse errors are left to ValidateScript.
+func (r *SafeRunner) validateRequest(ctx context.Context, req Request) error {
+	workingDir := req.WorkingDir
+	if req.Session != nil {
+		workingDir = req.Session.Dir()
+	}
+	absWorkingDir, err := filepath.Abs(workingDir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for working directory: %w", err)
+	}
+	if allowed, message := r.validator.IsDirectoryAllowed(absWorkingDir); !allowed {
+		return fmt.Errorf("directory validation failed: %w", &DirectoryNotAllowedError{Dir: absWorkingDir, Message: message})
+	}
+	if prog, err := syntax.NewParser().Parse(strings.NewReader(req.Command), ""); err == nil {
+		if err := checkScriptLimits(prog, r.config.ScriptLimits); err != nil {
+			return err
+		}
+	}
+	// Run validates the commands again as they run, so the check must not use up rate limits
+	return r.preflight(validator.WithCaller(ctx, validator.Caller{Client: req.Client, RunID: req.ID, Approved: req.Approved}), req.Command, absWorkingDir)
+}
@@ -0,0 +1,95 @@
+package runner
+
+import (
+	"context"
+	"path/filepath"
+
+	"mvdan.cc/sh/v3/interp"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+// execMiddlewares returns the exec handler middlewares enabled by the configuration and the
+// hooks for a run requested by client, whose processes are placed in cgroup, if not nil, and
+// whose resource usage is recorded in usages. They only run for external commands, never for
+// shell builtins or functions.
+func (r *SafeRunner) execMiddlewares(cgroup *scriptCgroup, usages *processUsages, hooks []Hook, client string) []func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	var middlewares []func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc
+	if len(hooks) > 0 {
+		middlewares = append(middlewares, execHookMiddleware(hooks, client))
+	}
+	if r.config.HasCommandTimeouts() {
+		middlewares = append(middlewares, r.commandTimeoutMiddleware)
+	}
+	if r.config.ResolveCommandPath {
+		middlewares = append(middlewares, r.binaryCheckMiddleware)
+	}
+	if r.config.HasPinnedBinaries() {
+		middlewares = append(middlewares, r.checksumMiddleware)
+	}
+	// The handler spawning processes replaces the default exec handler, so it must come last
+	r.mu.Lock()
+	handler := r.execHandler
+	r.mu.Unlock()
+	if handler == nil && r.config.Container != nil {
+		handler = ContainerExecHandler(r.config.Container, r.config.AllowedDirectories, r.config.GetKillGracePeriod())
+	}
+	if handler != nil {
+		return append(middlewares, func(interp.ExecHandlerFunc) interp.ExecHandlerFunc { return handler })
+	}
+	return append(middlewares, r.processExecMiddleware(cgroup, usages))
+}
+
+// binaryCheckMiddleware resolves the command through the interpreter's PATH and
+// rejects it when the binary lives outside the trusted binary directories.
+func (r *SafeRunner) binaryCheckMiddleware(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	return func(ctx context.Context, args []string) error {
+		binaryPath, err := resolveBinary(ctx, args[0])
+		if err != nil {
+			// Let the default handler report "command not found"
+			return next(ctx, args)
+		}
+
+		if allowed, message := r.validator.ValidateBinaryPath(ctx, args[0], binaryPath); !allowed {
+			r.logger.LogCommandDecision(runIDFrom(ctx), args[0], args[1:], false)
+			return binaryDenied(args, validator.CodeUntrustedBinary, message)
+		}
+
+		return next(ctx, args)
+	}
+}
+
+// checksumMiddleware verifies the resolved binary against the SHA-256 digest pinned
+// in the command's allow rule before letting it run.
+func (r *SafeRunner) checksumMiddleware(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	return func(ctx context.Context, args []string) error {
+		binaryPath, err := resolveBinary(ctx, args[0])
+		if err != nil {
+			return next(ctx, args)
+		}
+
+		// Absolute path commands are validated by their basename, so look up the rule the same way
+		if allowed, message := r.validator.ValidateBinaryChecksum(ctx, filepath.Base(args[0]), binaryPath); !allowed {
+			r.logger.LogCommandDecision(runIDFrom(ctx), args[0], args[1:], false)
+			return binaryDenied(args, validator.CodeChecksumMismatch, message)
+		}
+
+		return next(ctx, args)
+	}
+}
+
+// binaryDenied returns the error refusing to run the binary of args for the reason code.
+func binaryDenied(args []string, code validator.Code, message string) error {
+	return &CommandDeniedError{
+		Command: args[0],
+		Args:    args[1:],
+		Result:  validator.ValidationResult{Command: args[0], Code: code, Message: message},
+	}
+}
+
+// resolveBinary looks up the executable for a command the same way the interpreter does,
+// using the interpreter's current directory and PATH.
+func resolveBinary(ctx context.Context, name string) (string, error) {
+	hc := interp.HandlerCtx(ctx)
+	return interp.LookPathDir(hc.Dir, hc.Env, name)
+}
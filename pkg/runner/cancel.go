@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ErrCanceled is the error of a run stopped with Cancel, or whose context was cancelled with
+// ErrCanceled as the cause.
+var ErrCanceled = errors.New("run canceled")
+
+// NewRunID returns a random run ID, a version 4 UUID.
+func NewRunID() string {
+	return uuid.NewString()
+}
+
+// runIDKey is the context key of the ID of the run a command belongs to.
+type runIDKey struct{}
+
+// runIDFrom returns the ID of the run ctx belongs to, or "" outside a run.
+func runIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
+
+// Cancel stops the active run with the given ID. The process group of its running command
+// receives SIGTERM, followed by SIGKILL once KillGracePeriod has passed, and the run ends with
+// ErrCanceled. It reports whether a run with the ID was active.
+func (r *SafeRunner) Cancel(id string) bool {
+	r.mu.Lock()
+	cancel, ok := r.active[id]
+	r.mu.Unlock()
+	if ok {
+		cancel(ErrCanceled)
+	}
+	return ok
+}
+
+// startRun registers an active run under id and returns its context, which carries the ID
+// for logging, and a function that unregisters it.
+func (r *SafeRunner) startRun(ctx context.Context, id string) (context.Context, func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.active[id]; ok {
+		return nil, nil, fmt.Errorf("run %q is already active", id)
+	}
+	if r.active == nil {
+		r.active = make(map[string]context.CancelCauseFunc)
+	}
+	ctx, cancel := context.WithCancelCause(context.WithValue(ctx, runIDKey{}, id))
+	r.active[id] = cancel
+	return ctx, func() {
+		r.mu.Lock()
+		delete(r.active, id)
+		r.mu.Unlock()
+		cancel(nil)
+	}, nil
+}
@@ -0,0 +1,14 @@
+package runner
+
+import "time"
+
+// CgroupUsage is the resource usage of a script measured through its transient cgroup.
+// Values the kernel does not report (e.g. memory.peak before Linux 5.19) are zero.
+type CgroupUsage struct {
+	// CPUTime is the total CPU time used by the script's processes (cpu.stat usage_usec).
+	CPUTime time.Duration
+	// MemoryPeakBytes is the peak memory usage (memory.peak).
+	MemoryPeakBytes uint64
+	// PidsPeak is the peak number of processes (pids.peak).
+	PidsPeak uint64
+}
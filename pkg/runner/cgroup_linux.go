@@ -0,0 +1,177 @@
+//go:build linux
+
+package runner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+// cgroupRemoveAttempts and cgroupRemoveInterval bound how long remove waits for killed
+// processes to leave the cgroup.
+const (
+	cgroupRemoveAttempts = 50
+	cgroupRemoveInterval = 10 * time.Millisecond
+)
+
+// scriptCgroup is a transient cgroup v2 holding the processes of one script execution.
+type scriptCgroup struct {
+	path string
+	dir  *os.File
+}
+
+// newScriptCgroup creates a transient cgroup under the configured parent, enables the
+// controllers needed for the configured limits and applies them.
+func newScriptCgroup(cfg *config.CgroupConfig) (*scriptCgroup, error) {
+	parent := cfg.GetParent()
+
+	limits := []struct {
+		controller string
+		file       string
+		value      string
+	}{
+		{"cpu", "cpu.max", cfg.CPUMax},
+		{"memory", "memory.max", formatCgroupLimit(cfg.MemoryMax)},
+		{"pids", "pids.max", formatCgroupLimit(cfg.PidsMax)},
+	}
+
+	for _, l := range limits {
+		if l.value == "" {
+			continue
+		}
+		if err := enableCgroupController(parent, l.controller); err != nil {
+			return nil, err
+		}
+	}
+
+	path, err := os.MkdirTemp(parent, "secure-shell-")
+	if err != nil {
+		return nil, fmt.Errorf("creating cgroup under %s: %w", parent, err)
+	}
+	cg := &scriptCgroup{path: path}
+
+	for _, l := range limits {
+		if l.value == "" {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(path, l.file), []byte(l.value), 0o644); err != nil {
+			_ = cg.remove()
+			return nil, fmt.Errorf("setting %s to %q: %w", l.file, l.value, err)
+		}
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		_ = cg.remove()
+		return nil, fmt.Errorf("opening cgroup %s: %w", path, err)
+	}
+	cg.dir = dir
+
+	return cg, nil
+}
+
+// enableCgroupController makes a controller available to the children of a cgroup.
+func enableCgroupController(parent, controller string) error {
+	content, err := os.ReadFile(filepath.Join(parent, "cgroup.subtree_control"))
+	if err != nil {
+		return fmt.Errorf("reading controllers of %s: %w", parent, err)
+	}
+	if strings.Contains(" "+strings.TrimSpace(string(content))+" ", " "+controller+" ") {
+		return nil
+	}
+
+	err = os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+"+controller), 0o644)
+	if err != nil {
+		return fmt.Errorf("enabling %s controller in %s: %w", controller, parent, err)
+	}
+	return nil
+}
+
+// formatCgroupLimit formats a numeric limit, returning "" for zero (not configured).
+func formatCgroupLimit(value uint64) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.FormatUint(value, 10)
+}
+
+// attach makes the command start directly inside the cgroup, so that it cannot run or
+// fork before being placed there.
+func (c *scriptCgroup) attach(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(c.dir.Fd())
+}
+
+// usage reads the resource usage accumulated in the cgroup.
+func (c *scriptCgroup) usage() *CgroupUsage {
+	usage := &CgroupUsage{}
+	if usec, ok := readCgroupStat(filepath.Join(c.path, "cpu.stat"), "usage_usec"); ok {
+		usage.CPUTime = time.Duration(usec) * time.Microsecond
+	}
+	usage.MemoryPeakBytes, _ = readCgroupValue(filepath.Join(c.path, "memory.peak"))
+	usage.PidsPeak, _ = readCgroupValue(filepath.Join(c.path, "pids.peak"))
+	return usage
+}
+
+// remove kills any processes left in the cgroup (e.g. background jobs) and deletes it.
+func (c *scriptCgroup) remove() error {
+	if c.dir != nil {
+		_ = c.dir.Close()
+	}
+	_ = os.WriteFile(filepath.Join(c.path, "cgroup.kill"), []byte("1"), 0o644)
+
+	var err error
+	for range cgroupRemoveAttempts {
+		err = os.Remove(c.path)
+		if err == nil || errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if !errors.Is(err, syscall.EBUSY) {
+			break
+		}
+		time.Sleep(cgroupRemoveInterval)
+	}
+	return fmt.Errorf("removing cgroup %s: %w", c.path, err)
+}
+
+// readCgroupValue reads a cgroup file holding a single number.
+func readCgroupValue(path string) (uint64, bool) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+	return value, err == nil
+}
+
+// readCgroupStat reads a key from a flat-keyed cgroup file such as cpu.stat.
+func readCgroupStat(path, key string) (uint64, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, value, found := strings.Cut(scanner.Text(), " ")
+		if found && name == key {
+			n, err := strconv.ParseUint(value, 10, 64)
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package runner
+
+import (
+	"errors"
+	"os/exec"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+// scriptCgroup is unavailable on platforms without cgroups.
+type scriptCgroup struct{}
+
+// newScriptCgroup fails on platforms without cgroups, so that configured limits are
+// never silently ignored.
+func newScriptCgroup(_ *config.CgroupConfig) (*scriptCgroup, error) {
+	return nil, errors.New("cgroups are only supported on Linux")
+}
+
+func (c *scriptCgroup) attach(_ *exec.Cmd) {}
+
+func (c *scriptCgroup) usage() *CgroupUsage { return &CgroupUsage{} }
+
+func (c *scriptCgroup) remove() error { return nil }
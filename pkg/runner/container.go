@@ -0,0 +1,97 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"mvdan.cc/sh/v3/interp"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+// ContainerExecHandler returns an exec handler that runs every external command in a new
+// container of cfg.Image, removed when the command exits. Each directory in mounts is
+// bind-mounted at the same path, and the command starts in the interpreter's directory with
+// its exported variables. PATH and HOME are left to the image.
+//
+// The runtime CLI leads its own process group like any other command, so cancellation and
+// timeouts stop it with SIGTERM and, after killGracePeriod, SIGKILL; the runtime forwards
+// SIGTERM to the container.
+func ContainerExecHandler(cfg *config.ContainerConfig, mounts []string, killGracePeriod time.Duration) interp.ExecHandlerFunc {
+	return func(ctx context.Context, args []string) error {
+		hc := interp.HandlerCtx(ctx)
+		if cfg.Image == "" {
+			return errors.New("container image is not configured")
+		}
+		runtime, err := exec.LookPath(cfg.GetRuntime())
+		if err != nil {
+			return fmt.Errorf("container runtime: %w", err)
+		}
+
+		env := ExecEnv(ctx)
+		cmd := &exec.Cmd{
+			Path:   runtime,
+			Args:   append([]string{runtime}, containerRunArgs(cfg, mounts, hc.Dir, env, args)...),
+			Env:    env,
+			Stdin:  hc.Stdin,
+			Stdout: hc.Stdout,
+			Stderr: hc.Stderr,
+		}
+		startInProcessGroup(cmd)
+		if err := cmd.Start(); err != nil {
+			fmt.Fprintf(hc.Stderr, "%v\n", err)
+			return interp.NewExitStatus(127)
+		}
+
+		stop := context.AfterFunc(ctx, func() {
+			_ = terminateProcessGroup(cmd.Process)
+			time.Sleep(killGracePeriod)
+			_ = killProcessGroup(cmd.Process)
+		})
+		defer stop()
+
+		return processExitError(ctx, cmd.Wait())
+	}
+}
+
+// containerRunArgs builds the arguments of the runtime's run command for args. Variables are
+// passed by name only, so the runtime takes their values from its own environment and they do
+// not appear on its command line.
+func containerRunArgs(cfg *config.ContainerConfig, mounts []string, dir string, env []string, args []string) []string {
+	runArgs := []string{"run", "--rm", "-i", "--init", "--network", cfg.GetNetwork(), "--workdir", dir}
+	if user := containerUser(cfg); user != "" {
+		runArgs = append(runArgs, "--user", user)
+	}
+	for _, mount := range mounts {
+		runArgs = append(runArgs, "--volume", mount+":"+mount)
+	}
+	for _, kv := range env {
+		name, _, ok := strings.Cut(kv, "=")
+		if !ok || name == "" || name == "PATH" || name == "HOME" {
+			continue
+		}
+		runArgs = append(runArgs, "--env", name)
+	}
+	runArgs = append(runArgs, cfg.ExtraArgs...)
+	runArgs = append(runArgs, cfg.Image)
+	return append(runArgs, args...)
+}
+
+// containerUser returns the user commands run as in the container: the configured user, or
+// the server's own uid:gid where the platform has them.
+func containerUser(cfg *config.ContainerConfig) string {
+	if cfg.User != "" {
+		return cfg.User
+	}
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid < 0 || gid < 0 {
+		return ""
+	}
+	return strconv.Itoa(uid) + ":" + strconv.Itoa(gid)
+}
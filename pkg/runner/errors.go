@@ -0,0 +1,97 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+// Sentinel errors for the failures of a run. The errors returned by the runner match them
+// with errors.Is, and carry the details in the types below, retrieved with errors.As.
+var (
+	// ErrCommandDenied matches a *CommandDeniedError.
+	ErrCommandDenied = errors.New("command denied")
+	// ErrDirectoryNotAllowed matches a *DirectoryNotAllowedError.
+	ErrDirectoryNotAllowed = errors.New("directory not allowed")
+	// ErrTimeout matches a *TimeoutError.
+	ErrTimeout = errors.New("timeout exceeded")
+	// ErrOutputTruncated matches an *OutputTruncatedError.
+	ErrOutputTruncated = errors.New("output truncated")
+)
+
+// CommandDeniedError reports a command of a script that the policy refused to run.
+type CommandDeniedError struct {
+	// Command and Args are the refused command and its arguments.
+	Command string
+	Args    []string
+	// Result is the verdict that refused it.
+	Result validator.ValidationResult
+}
+
+func (e *CommandDeniedError) Error() string { return e.Result.Message }
+
+func (e *CommandDeniedError) Unwrap() error { return ErrCommandDenied }
+
+// DirectoryNotAllowedError reports a working directory, or the target of cd, outside the
+// allowed directories.
+type DirectoryNotAllowedError struct {
+	Dir     string
+	Message string
+}
+
+func (e *DirectoryNotAllowedError) Error() string { return e.Message }
+
+func (e *DirectoryNotAllowedError) Unwrap() error { return ErrDirectoryNotAllowed }
+
+// TimeoutError reports a run or a command that exceeded its time limit. It also matches
+// context.DeadlineExceeded.
+type TimeoutError struct {
+	// Command is the command that exceeded the timeout of its allow rule, or "" when the
+	// script exceeded the time limit of the run.
+	Command string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Command == "" {
+		return fmt.Sprintf("script exceeded its timeout of %s", e.Timeout)
+	}
+	return fmt.Sprintf("command %q exceeded its timeout of %d seconds", e.Command, int(e.Timeout/time.Second))
+}
+
+func (e *TimeoutError) Unwrap() []error { return []error{ErrTimeout, context.DeadlineExceeded} }
+
+// OutputTruncatedError reports an output stream of a run that exceeded its size or line
+// limit. It is not a failure of the run, so it is returned by RunResult.TruncationErr
+// rather than in RunResult.Err.
+type OutputTruncatedError struct {
+	// Stream is StreamStdout or StreamStderr.
+	Stream string
+	// Bytes is the number of bytes produced and RemainingBytes the number dropped.
+	Bytes          int
+	RemainingBytes int
+}
+
+func (e *OutputTruncatedError) Error() string {
+	return fmt.Sprintf("%s truncated: %d of %d bytes dropped", e.Stream, e.RemainingBytes, e.Bytes)
+}
+
+func (e *OutputTruncatedError) Unwrap() error { return ErrOutputTruncated }
+
+// TruncationErr returns an *OutputTruncatedError for each output stream of the run that was
+// truncated, joined with errors.Join, or nil if none was.
+func (r RunResult) TruncationErr() error {
+	var errs []error
+	for _, s := range []struct {
+		stream string
+		stats  OutputStats
+	}{{StreamStdout, r.Stdout}, {StreamStderr, r.Stderr}} {
+		if s.stats.Truncated {
+			errs = append(errs, &OutputTruncatedError{Stream: s.stream, Bytes: s.stats.Bytes, RemainingBytes: s.stats.RemainingBytes})
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,111 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestRunErrors(t *testing.T) {
+	workDir := t.TempDir()
+	stdoutSize := 4
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+			{Command: "cd"},
+			{Command: "sleep"},
+			{Command: "timeout-sleep", Timeout: 1},
+		},
+		DenyCommands:        []config.DenyCommand{{Command: "rm", Message: "no rm"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxStdoutSize:       &stdoutSize,
+	}
+	log := logger.New()
+	r := New(cfg, validator.New(cfg, log), log)
+
+	t.Run("denied command", func(t *testing.T) {
+		result := r.Run(t.Context(), Request{Command: "echo ok; rm -rf build", WorkingDir: workDir})
+		assert.True(t, errors.Is(result.Err, ErrCommandDenied))
+		var denied *CommandDeniedError
+		assert.True(t, errors.As(result.Err, &denied))
+		assert.Equal(t, "rm", denied.Command)
+		assert.Equal(t, []string{"-rf", "build"}, denied.Args)
+		assert.Equal(t, "denyCommands[rm]", denied.Result.Rule)
+		assert.Equal(t, ExitCodeNotRun, ExitCode(result.Err))
+	})
+
+	t.Run("working directory not allowed", func(t *testing.T) {
+		dir := t.TempDir()
+		result := r.Run(t.Context(), Request{Command: "echo ok", WorkingDir: dir})
+		var notAllowed *DirectoryNotAllowedError
+		assert.True(t, errors.As(result.Err, &notAllowed))
+		assert.Equal(t, dir, notAllowed.Dir)
+		assert.Contains(t, result.Err.Error(), "directory validation failed")
+	})
+
+	t.Run("cd outside the allowed directories", func(t *testing.T) {
+		result := r.Run(t.Context(), Request{Command: "cd " + t.TempDir(), WorkingDir: workDir})
+		assert.True(t, errors.Is(result.Err, ErrCommandDenied))
+
+		// A symlink escaping the allowed directories passes validation but not cd
+		outside := t.TempDir()
+		assert.NoError(t, os.Symlink(outside, filepath.Join(workDir, "escape")))
+		result = r.Run(t.Context(), Request{Command: "cd escape", WorkingDir: workDir})
+		var notAllowed *DirectoryNotAllowedError
+		assert.True(t, errors.As(result.Err, &notAllowed))
+		resolved, err := filepath.EvalSymlinks(outside)
+		assert.NoError(t, err)
+		assert.Equal(t, resolved, notAllowed.Dir)
+	})
+
+	t.Run("run timeout", func(t *testing.T) {
+		result := r.Run(t.Context(), Request{Command: "sleep 10", WorkingDir: workDir, Timeout: 100 * time.Millisecond})
+		var timeout *TimeoutError
+		assert.True(t, errors.As(result.Err, &timeout))
+		assert.Equal(t, "", timeout.Command)
+		assert.Equal(t, 100*time.Millisecond, timeout.Timeout)
+		assert.True(t, errors.Is(result.Err, context.DeadlineExceeded))
+	})
+
+	t.Run("command timeout", func(t *testing.T) {
+		// A copy of sleep under a name with a timeout in its allow rule
+		sleep, err := os.ReadFile("/bin/sleep")
+		if err != nil {
+			t.Skip("no /bin/sleep")
+		}
+		binDir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(binDir, "timeout-sleep"), sleep, 0o700)) //nolint:gosec // test binary
+		result := r.Run(t.Context(), Request{
+			Command:    "timeout-sleep 10",
+			WorkingDir: workDir,
+			Env:        []string{"PATH=" + binDir},
+		})
+		var timeout *TimeoutError
+		assert.True(t, errors.As(result.Err, &timeout))
+		assert.Equal(t, "timeout-sleep", timeout.Command)
+		assert.Equal(t, time.Second, timeout.Timeout)
+	})
+
+	t.Run("output truncation", func(t *testing.T) {
+		result := r.Run(t.Context(), Request{Command: "echo truncated", WorkingDir: workDir})
+		assert.NoError(t, result.Err)
+		var truncated *OutputTruncatedError
+		assert.True(t, errors.As(result.TruncationErr(), &truncated))
+		assert.Equal(t, StreamStdout, truncated.Stream)
+		assert.Equal(t, 6, truncated.RemainingBytes)
+		assert.True(t, errors.Is(result.TruncationErr(), ErrOutputTruncated))
+
+		result = r.Run(t.Context(), Request{Command: "echo ok", WorkingDir: workDir})
+		assert.NoError(t, result.TruncationErr())
+	})
+}
@@ -0,0 +1,145 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// processKillTimeout is how long output of processes a terminal command left running is
+// still collected after the command exited.
+const processKillTimeout = 2 * time.Second
+
+// processExecMiddleware runs external commands itself instead of passing them to the
+// interpreter's default exec handler, so that the process can be restricted before the
+// command is exec'd (placed in the script's cgroup, or sandboxed, given resource limits and
+// filtered with seccomp by the exec helper), and commands that need a terminal can be run
+// on one.
+// Each command leads its own process group, which is stopped as a whole when the run is
+// cancelled or times out.
+// Processes are placed in cgroup unless it is nil, and their resource usage is recorded in usages.
+func (r *SafeRunner) processExecMiddleware(cgroup *scriptCgroup, usages *processUsages) func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	return func(_ interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+		return r.processExecHandler(cgroup, usages)
+	}
+}
+
+// processExecHandler starts and waits for an external command on behalf of processExecMiddleware.
+func (r *SafeRunner) processExecHandler(cgroup *scriptCgroup, usages *processUsages) interp.ExecHandlerFunc {
+	return func(ctx context.Context, args []string) error {
+		hc := interp.HandlerCtx(ctx)
+		path, err := interp.LookPathDir(hc.Dir, hc.Env, args[0])
+		if err != nil {
+			fmt.Fprintln(hc.Stderr, err)
+			return interp.NewExitStatus(127)
+		}
+
+		cmd := &exec.Cmd{
+			Path:   path,
+			Args:   args,
+			Env:    ExecEnv(ctx),
+			Dir:    hc.Dir,
+			Stdin:  hc.Stdin,
+			Stdout: hc.Stdout,
+			Stderr: hc.Stderr,
+		}
+
+		if cgroup != nil {
+			cgroup.attach(cmd)
+		}
+		isolated := r.config.Seccomp != nil || r.config.Sandbox != nil || r.config.ResourceLimits.IsSet()
+		if isolated {
+			cleanup, err := wrapExecHelper(cmd, r.config)
+			if err != nil {
+				r.logger.LogErrorf("Failed to isolate %q: %v", args[0], err)
+				return fmt.Errorf("failed to isolate command %q: %w", args[0], err)
+			}
+			defer cleanup()
+		}
+
+		var terminal *processTerminal
+		if rule := r.config.GetAllowCommand(filepath.Base(args[0])); rule != nil && rule.PTY {
+			terminal, err = openProcessTerminal(cmd, r.config.PTY)
+			if err != nil {
+				r.logger.LogErrorf("Failed to allocate a terminal for %q: %v", args[0], err)
+				return fmt.Errorf("failed to allocate a terminal for command %q: %w", args[0], err)
+			}
+		}
+
+		startInProcessGroup(cmd)
+
+		if err := cmd.Start(); err != nil {
+			if terminal != nil {
+				terminal.wait()
+			}
+			if isolated {
+				// Namespaces or the helper could not be set up; never fall back to running unisolated
+				r.logger.LogErrorf("Failed to start isolated %q: %v", args[0], err)
+				return fmt.Errorf("failed to start isolated command %q: %w", args[0], err)
+			}
+			fmt.Fprintf(hc.Stderr, "%v\n", err)
+			return interp.NewExitStatus(127)
+		}
+
+		// Stop the whole process group so that no grandchildren are left running
+		stop := context.AfterFunc(ctx, func() {
+			_ = terminateProcessGroup(cmd.Process)
+			time.Sleep(r.config.GetKillGracePeriod())
+			_ = killProcessGroup(cmd.Process)
+		})
+		defer stop()
+
+		err = cmd.Wait()
+		if terminal != nil {
+			terminal.wait()
+		}
+		if cmd.ProcessState != nil {
+			usages.record(args, cmd.ProcessState)
+		}
+		return processExitError(ctx, err)
+	}
+}
+
+// processExitError converts the result of waiting for a process into the error the
+// interpreter expects: an exit status, or the context error if the process was stopped
+// because the context was cancelled.
+func processExitError(ctx context.Context, err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return interp.NewExitStatus(uint8(128 + int(status.Signal())))
+	}
+	return interp.NewExitStatus(uint8(exitErr.ExitCode()))
+}
+
+// execEnv builds the environment for a process from the interpreter's exported variables.
+func execEnv(env expand.Environ) []string {
+	list := make([]string, 0, 64)
+	for name, vr := range env.Each {
+		if !vr.IsSet() {
+			// A variable set globally but unset in the interpreter must not be passed on
+			for i, kv := range list {
+				if strings.HasPrefix(kv, name+"=") {
+					list[i] = ""
+				}
+			}
+		}
+		if vr.Exported && vr.Kind == expand.String {
+			list = append(list, name+"="+vr.String())
+		}
+	}
+	return list
+}
@@ -0,0 +1,144 @@
+//go:build linux
+
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+// execHelperArg0 is the argv[0] the runner re-executes its own binary with to isolate a
+// command. Go cannot run code between fork and exec, so the helper sets up the sandbox, the
+// resource limits and the seccomp filter on itself and then execs the command in place.
+const execHelperArg0 = "secure-shell-exec-helper"
+
+// execHelperFailedStatus is the exit status of the helper when the command cannot be started.
+const execHelperFailedStatus = 126
+
+// execHelperOptions tells the helper how to isolate the command. It is passed as argv[1].
+type execHelperOptions struct {
+	// DenySyscalls are the system call numbers denied by the seccomp filter, if enabled
+	DenySyscalls []uint32 `json:"denySyscalls,omitempty"`
+	Seccomp      bool     `json:"seccomp,omitempty"`
+	// Sandbox describes the filesystem of the sandbox, if enabled
+	Sandbox *sandboxMounts `json:"sandbox,omitempty"`
+	// Limits are the rlimits of the command, if set
+	Limits *config.ResourceLimits `json:"limits,omitempty"`
+}
+
+func init() {
+	if len(os.Args) > 0 && os.Args[0] == execHelperArg0 {
+		os.Exit(runExecHelper(os.Args[1:]))
+	}
+}
+
+// wrapExecHelper rewrites a command to start through the exec helper. The returned cleanup
+// function must be called once the command has exited.
+func wrapExecHelper(cmd *exec.Cmd, cfg *config.ShellCommandConfig) (func(), error) {
+	var opts execHelperOptions
+	cleanup := func() {}
+
+	if cfg.Seccomp != nil {
+		numbers, err := resolveSyscalls(cfg.Seccomp.GetDenySyscalls())
+		if err != nil {
+			return nil, err
+		}
+		opts.Seccomp = true
+		opts.DenySyscalls = numbers
+	}
+
+	if cfg.Sandbox != nil {
+		root, err := os.MkdirTemp("", "secure-shell-sandbox-")
+		if err != nil {
+			return nil, fmt.Errorf("creating sandbox root: %w", err)
+		}
+		// The sandbox's mounts only exist in its own mount namespace, so the directory is empty again
+		cleanup = func() { _ = os.Remove(root) }
+
+		opts.Sandbox = &sandboxMounts{
+			Root:      root,
+			WorkDir:   cmd.Dir,
+			ReadOnly:  cfg.Sandbox.GetReadOnlyPaths(),
+			ReadWrite: cleanAbsPaths(cfg.AllowedDirectories),
+		}
+		sandboxSysProcAttr(cmd, cfg.Sandbox)
+	}
+
+	if cfg.ResourceLimits.IsSet() {
+		opts.Limits = cfg.ResourceLimits
+	}
+
+	encoded, err := json.Marshal(opts)
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("encoding exec helper options: %w", err)
+	}
+
+	cmd.Args = append([]string{execHelperArg0, string(encoded), cmd.Path}, cmd.Args...)
+	cmd.Path = "/proc/self/exe"
+	return cleanup, nil
+}
+
+// runExecHelper is the entry point of the helper process. args are the encoded options,
+// the command path and the command's argv.
+func runExecHelper(args []string) int {
+	// Mount changes, no_new_privs and the seccomp filter apply to the calling thread, which
+	// must be the one that execs
+	runtime.LockOSThread()
+
+	if len(args) < 3 {
+		fmt.Fprintln(os.Stderr, "exec helper: missing arguments")
+		return execHelperFailedStatus
+	}
+
+	var opts execHelperOptions
+	if err := json.Unmarshal([]byte(args[0]), &opts); err != nil {
+		fmt.Fprintf(os.Stderr, "exec helper: invalid options: %v\n", err)
+		return execHelperFailedStatus
+	}
+
+	if opts.Sandbox != nil {
+		if err := setupSandbox(opts.Sandbox); err != nil {
+			fmt.Fprintf(os.Stderr, "exec helper: setting up sandbox: %v\n", err)
+			return execHelperFailedStatus
+		}
+	}
+
+	// Limits are set after the sandbox, whose setup might exceed them
+	if opts.Limits != nil {
+		if err := setResourceLimits(opts.Limits); err != nil {
+			fmt.Fprintf(os.Stderr, "exec helper: setting resource limits: %v\n", err)
+			return execHelperFailedStatus
+		}
+	}
+
+	// The filter is installed last, since it may deny the system calls used to set up the sandbox
+	if opts.Seccomp {
+		if err := installSeccompFilter(opts.DenySyscalls); err != nil {
+			fmt.Fprintf(os.Stderr, "exec helper: %v\n", err)
+			return execHelperFailedStatus
+		}
+	}
+
+	err := syscall.Exec(args[1], args[2:], os.Environ())
+	fmt.Fprintf(os.Stderr, "%s: %v\n", args[1], err)
+	return execHelperFailedStatus
+}
+
+// cleanAbsPaths returns the absolute paths in the list, cleaned.
+func cleanAbsPaths(paths []string) []string {
+	result := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if filepath.IsAbs(p) {
+			result = append(result, filepath.Clean(p))
+		}
+	}
+	return result
+}
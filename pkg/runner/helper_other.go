@@ -0,0 +1,16 @@
+//go:build !linux
+
+package runner
+
+import (
+	"errors"
+	"os/exec"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+// wrapExecHelper fails on platforms without namespaces, seccomp and setrlimit, so that a
+// configured sandbox, filter or resource limit is never silently ignored.
+func wrapExecHelper(_ *exec.Cmd, _ *config.ShellCommandConfig) (func(), error) {
+	return nil, errors.New("sandbox, seccomp and resource limits are only supported on Linux")
+}
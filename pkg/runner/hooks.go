@@ -0,0 +1,163 @@
+package runner
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"mvdan.cc/sh/v3/interp"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+// Hook is a value implementing one or more of BeforeValidateHook, AfterValidateHook,
+// BeforeExecHook and AfterExecHook, registered with AddHook or WithHooks to add auditing,
+// metrics or changes to commands without replacing the execution path. Hooks are called in
+// the order they were registered, and concurrently for the commands of a pipeline.
+type Hook any
+
+// Command is a command of a script as hooks see it around its validation.
+type Command struct {
+	// RunID and Client identify the run and the client that requested it.
+	RunID  string
+	Client string
+	// Name and Args are the command and its arguments.
+	Name string
+	Args []string
+	// Dir is the directory the script started in, which the command is validated in.
+	Dir string
+}
+
+// BeforeValidateHook is called for every command of a script, builtins included, before it
+// is validated. It may rewrite cmd.Name and cmd.Args; the rewritten command is validated and
+// run. An error refuses the command.
+type BeforeValidateHook interface {
+	BeforeValidate(ctx context.Context, cmd *Command) error
+}
+
+// AfterValidateHook is called with the verdict on every command of a script that was
+// validated.
+type AfterValidateHook interface {
+	AfterValidate(ctx context.Context, cmd Command, result validator.ValidationResult)
+}
+
+// ExecCommand is an external command as hooks see it around its execution.
+type ExecCommand struct {
+	// RunID and Client identify the run and the client that requested it.
+	RunID  string
+	Client string
+	// Args are the command and its arguments, as validated.
+	Args []string
+	// Dir is the directory the command runs in.
+	Dir string
+	// Env is the environment of the command as "NAME=value" entries. BeforeExec hooks may
+	// change it, e.g. to inject variables; the EnvPolicy does not apply to their changes.
+	Env []string
+}
+
+// ExecStatus is the outcome of an external command.
+type ExecStatus struct {
+	// ExitCode is the command's exit code, or ExitCodeNotRun when it did not run to completion.
+	ExitCode int
+	Duration time.Duration
+	// Err is the error the command ended with, nil when it exited with 0.
+	Err error
+}
+
+// BeforeExecHook is called for every external command after it passed validation, before it
+// starts. It may change cmd.Env; changes to cmd.Args are ignored, since the arguments have
+// been validated. An error refuses the command.
+type BeforeExecHook interface {
+	BeforeExec(ctx context.Context, cmd *ExecCommand) error
+}
+
+// AfterExecHook is called for every external command that BeforeExec hooks let run, once it
+// finished.
+type AfterExecHook interface {
+	AfterExec(ctx context.Context, cmd ExecCommand, status ExecStatus)
+}
+
+// AddHook registers h to be called by later runs. A nil h is ignored.
+func (r *SafeRunner) AddHook(h Hook) {
+	if h == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, h)
+}
+
+// currentHooks returns the hooks registered so far, for one run.
+func (r *SafeRunner) currentHooks() []Hook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.hooks
+}
+
+// beforeValidate calls the BeforeValidate hooks of hooks on cmd until one fails.
+func beforeValidate(ctx context.Context, hooks []Hook, cmd *Command) error {
+	for _, h := range hooks {
+		if h, ok := h.(BeforeValidateHook); ok {
+			if err := h.BeforeValidate(ctx, cmd); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// afterValidate calls the AfterValidate hooks of hooks.
+func afterValidate(ctx context.Context, hooks []Hook, cmd Command, result validator.ValidationResult) {
+	for _, h := range hooks {
+		if h, ok := h.(AfterValidateHook); ok {
+			h.AfterValidate(ctx, cmd, result)
+		}
+	}
+}
+
+// execEnvKey is the context key of the environment set by BeforeExec hooks.
+type execEnvKey struct{}
+
+// ExecEnv returns the environment an exec handler should start the external command of ctx
+// with: the interpreter's exported variables with the changes of BeforeExec hooks. Handlers
+// set with SetExecHandler use it to honor those changes.
+func ExecEnv(ctx context.Context) []string {
+	if env, ok := ctx.Value(execEnvKey{}).([]string); ok {
+		return env
+	}
+	return execEnv(interp.HandlerCtx(ctx).Env)
+}
+
+// execHookMiddleware calls the BeforeExec and AfterExec hooks of hooks around every external
+// command of a run requested by client.
+func execHookMiddleware(hooks []Hook, client string) func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	return func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+		return func(ctx context.Context, args []string) error {
+			cmd := ExecCommand{
+				RunID:  runIDFrom(ctx),
+				Client: client,
+				Args:   slices.Clone(args),
+				Dir:    interp.HandlerCtx(ctx).Dir,
+				Env:    ExecEnv(ctx),
+			}
+			for _, h := range hooks {
+				if h, ok := h.(BeforeExecHook); ok {
+					if err := h.BeforeExec(ctx, &cmd); err != nil {
+						return err
+					}
+				}
+			}
+			cmd.Args = args
+
+			start := time.Now()
+			err := next(context.WithValue(ctx, execEnvKey{}, cmd.Env), args)
+			status := ExecStatus{ExitCode: ExitCode(err), Duration: time.Since(start), Err: err}
+			for _, h := range hooks {
+				if h, ok := h.(AfterExecHook); ok {
+					h.AfterExec(ctx, cmd, status)
+				}
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+// recordingHook records the calls of every hook and changes commands on the way.
+type recordingHook struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (h *recordingHook) record(call string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls = append(h.calls, call)
+}
+
+func (h *recordingHook) BeforeValidate(_ context.Context, cmd *Command) error {
+	h.record("before-validate " + cmd.Name)
+	switch cmd.Name {
+	case "greet":
+		// Rewrite an alias to the command it stands for
+		cmd.Name, cmd.Args = "echo", append([]string{"hello"}, cmd.Args...)
+	case "forbidden":
+		return errors.New("refused by hook")
+	}
+	return nil
+}
+
+func (h *recordingHook) AfterValidate(_ context.Context, cmd Command, result validator.ValidationResult) {
+	h.record("after-validate " + cmd.Name + " " + map[bool]string{true: "allowed", false: "blocked"}[result.Allowed])
+}
+
+func (h *recordingHook) BeforeExec(_ context.Context, cmd *ExecCommand) error {
+	h.record("before-exec " + cmd.Args[0])
+	cmd.Env = append(cmd.Env, "INJECTED=by-hook")
+	return nil
+}
+
+func (h *recordingHook) AfterExec(_ context.Context, cmd ExecCommand, status ExecStatus) {
+	h.record("after-exec " + cmd.Args[0] + " " + map[bool]string{true: "ok", false: "failed"}[status.ExitCode == 0])
+}
+
+func TestHooks(t *testing.T) {
+	conf := config.NewDefaultConfig()
+	conf.AddAllowedCommand("printenv")
+	dir := t.TempDir()
+	conf.AllowedDirectories = []string{dir}
+
+	hook := &recordingHook{}
+	var stdout, stderr bytes.Buffer
+	r := NewWithOptions(conf, WithOutputs(&stdout, &stderr), WithHooks(hook))
+
+	result := r.RunCommand(t.Context(), "greet world; printenv INJECTED", dir)
+	assert.NoError(t, result.Err)
+	assert.Equal(t, "hello world\nby-hook\n", stdout.String())
+	assert.Equal(t, []string{
+		"before-validate greet", "after-validate echo allowed",
+		"before-validate printenv", "after-validate printenv allowed",
+		"before-exec printenv", "after-exec printenv ok",
+	}, hook.calls)
+
+	hook.calls = nil
+	result = r.RunCommand(t.Context(), "forbidden; rm -rf build", dir)
+	assert.Error(t, result.Err)
+	assert.Contains(t, result.Err.Error(), "refused by hook")
+	assert.False(t, slices.ContainsFunc(hook.calls, func(call string) bool { return strings.HasPrefix(call, "after-validate") }))
+}
@@ -0,0 +1,94 @@
+package runner
+
+import (
+	"io"
+
+	"mvdan.cc/sh/v3/interp"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+// Option configures a SafeRunner created with NewWithOptions.
+type Option func(*options)
+
+// options are the settings of NewWithOptions; zero values keep the defaults of New.
+type options struct {
+	logger      *logger.Logger
+	validator   *validator.CommandValidator
+	execHandler interp.ExecHandlerFunc
+	stdout      io.Writer
+	stderr      io.Writer
+	env         []string
+	observer    func(AuditRecord)
+	hooks       []Hook
+}
+
+// WithLogger makes the runner, and the validator it creates without WithValidator, log to l.
+func WithLogger(l *logger.Logger) Option {
+	return func(o *options) { o.logger = l }
+}
+
+// WithValidator makes the runner validate commands with v instead of a validator of its
+// configuration.
+func WithValidator(v *validator.CommandValidator) Option {
+	return func(o *options) { o.validator = v }
+}
+
+// WithExecHandler substitutes h for the layer that spawns external commands, as
+// SetExecHandler does.
+func WithExecHandler(h interp.ExecHandlerFunc) Option {
+	return func(o *options) { o.execHandler = h }
+}
+
+// WithOutputs sets the stdout and stderr writers of RunCommand, as SetOutputs does.
+func WithOutputs(stdout, stderr io.Writer) Option {
+	return func(o *options) { o.stdout, o.stderr = stdout, stderr }
+}
+
+// WithEnv sets the environment RunCommand runs scripts with, filtered like SetEnv.
+func WithEnv(env []string) Option {
+	return func(o *options) { o.env = env }
+}
+
+// WithRunObserver sets fn to be called with the audit record of every finished run, as
+// SetRunObserver does.
+func WithRunObserver(fn func(AuditRecord)) Option {
+	return func(o *options) { o.observer = fn }
+}
+
+// WithHooks registers hooks to be called by every run, as AddHook does.
+func WithHooks(hooks ...Hook) Option {
+	return func(o *options) { o.hooks = append(o.hooks, hooks...) }
+}
+
+// NewWithOptions creates a SafeRunner enforcing cfg, configured by opts. Without WithLogger
+// it logs nothing, and without WithValidator it validates commands with a new validator of
+// cfg. It writes to os.Stdout and os.Stderr unless WithOutputs is given.
+func NewWithOptions(cfg *config.ShellCommandConfig, opts ...Option) *SafeRunner {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.logger == nil {
+		o.logger = logger.New()
+	}
+	if o.validator == nil {
+		o.validator = validator.New(cfg, o.logger)
+	}
+
+	r := New(cfg, o.validator, o.logger)
+	if o.stdout != nil || o.stderr != nil {
+		r.SetOutputs(o.stdout, o.stderr)
+	}
+	if o.env != nil {
+		r.SetEnv(o.env)
+	}
+	r.execHandler = o.execHandler
+	r.observer = o.observer
+	for _, h := range o.hooks {
+		r.AddHook(h)
+	}
+	return r
+}
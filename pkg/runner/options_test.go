@@ -0,0 +1,44 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"mvdan.cc/sh/v3/interp"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	conf := config.NewDefaultConfig()
+	conf.AddAllowedCommand("printenv")
+	dir := t.TempDir()
+	conf.AllowedDirectories = []string{dir}
+
+	var stdout, stderr bytes.Buffer
+	var execs []string
+	var records []AuditRecord
+	r := NewWithOptions(conf,
+		WithOutputs(&stdout, &stderr),
+		WithEnv([]string{"GREETING=hello"}),
+		WithExecHandler(func(ctx context.Context, args []string) error {
+			execs = append(execs, args[0])
+			hc := interp.HandlerCtx(ctx)
+			_, err := hc.Stdout.Write([]byte("handled\n"))
+			return err
+		}),
+		WithRunObserver(func(record AuditRecord) { records = append(records, record) }),
+	)
+
+	result := r.RunCommand(t.Context(), "echo $GREETING; printenv GREETING", dir)
+	assert.NoError(t, result.Err)
+	assert.Equal(t, "hello\nhandled\n", stdout.String())
+	assert.Equal(t, []string{"printenv"}, execs)
+	assert.Equal(t, 1, len(records))
+
+	// Without options the runner validates with a validator of its configuration
+	result = NewWithOptions(conf, WithOutputs(&stdout, &stderr)).RunCommand(t.Context(), "rm -rf build", dir)
+	assert.Error(t, result.Err)
+}
@@ -0,0 +1,94 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// outputLogPermissions are the permissions of output log files; output can contain secrets.
+const outputLogPermissions = 0o600
+
+// outputLogDir returns the directory the complete output of runs is written to, and whether
+// it is the spool directory, whose files are only kept for truncated output. It returns ""
+// when neither OutputLogDir nor SpoolDir is configured.
+func (r *SafeRunner) outputLogDir() (dir string, spool bool) {
+	if r.config.OutputLogDir != "" {
+		return r.config.OutputLogDir, false
+	}
+	return r.config.SpoolDir, r.config.SpoolDir != ""
+}
+
+// outputLogName returns the name of the file the given stream of run id is logged to.
+func outputLogName(id, stream string) (string, error) {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("run ID %q cannot be used as a file name", id)
+	}
+	return id + "." + stream + ".log", nil
+}
+
+// openOutputLog creates the log file of one stream of a run in dir and tees o into it. A
+// spooled log is only kept if the output is truncated, so it is not created for output
+// without limits. Failures are logged and the run continues without the file.
+func (r *SafeRunner) openOutputLog(o *output, dir string, spool bool, id, stream string) {
+	if spool && o.limiter == nil {
+		return
+	}
+	name, err := outputLogName(id, stream)
+	if err == nil {
+		err = os.MkdirAll(dir, workingDirPermissions)
+	}
+	path := filepath.Join(dir, name)
+	var f *os.File
+	if err == nil {
+		// O_EXCL keeps an existing file, or a symlink planted in its place, from being written
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, outputLogPermissions)
+	}
+	if err != nil {
+		r.logger.LogErrorf("Failed to create %s log of run %s: %v", stream, id, err)
+		return
+	}
+	o.log = f
+	o.logPath = path
+	o.spooled = spool
+	if o.limiter != nil {
+		o.limiter.FullOutput = path
+	}
+}
+
+// closeOutputLog closes the log file of o, if it has one. A spooled log of output that was
+// not truncated is removed.
+func (r *SafeRunner) closeOutputLog(o *output) {
+	if o.log == nil {
+		return
+	}
+	if err := o.log.Close(); err != nil {
+		r.logger.LogErrorf("Failed to close output log %s: %v", o.logPath, err)
+	}
+	if o.logErr != nil {
+		r.logger.LogErrorf("Failed to write output log %s: %v", o.logPath, o.logErr)
+	}
+	if o.spooled && !o.limiter.WasTruncated() {
+		if err := os.Remove(o.logPath); err != nil {
+			r.logger.LogErrorf("Failed to remove spooled output %s: %v", o.logPath, err)
+		}
+		o.logPath = ""
+	}
+}
+
+// OpenOutputLog opens a file holding the complete output of a run, given its name, the base
+// name of RunResult.StdoutLog or StderrLog. It serves as a handle to retrieve output that was
+// truncated without exposing other files.
+func (r *SafeRunner) OpenOutputLog(name string) (*os.File, error) {
+	dir, _ := r.outputLogDir()
+	if dir == "" {
+		return nil, errors.New("no output log or spool directory is configured")
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) ||
+		!strings.HasSuffix(name, ".log") {
+		return nil, fmt.Errorf("%q is not the name of an output log", name)
+	}
+	return os.Open(filepath.Join(dir, name))
+}
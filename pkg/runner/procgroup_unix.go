@@ -0,0 +1,31 @@
+//go:build !windows
+
+package runner
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// startInProcessGroup makes cmd the leader of a new process group, so that it can be stopped
+// together with every process it starts. Commands that start a new session, such as those run
+// on a pseudo-terminal, already lead their own group.
+func startInProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if !cmd.SysProcAttr.Setsid {
+		cmd.SysProcAttr.Setpgid = true
+	}
+}
+
+// terminateProcessGroup sends SIGTERM to the process group led by process.
+func terminateProcessGroup(process *os.Process) error {
+	return syscall.Kill(-process.Pid, syscall.SIGTERM)
+}
+
+// killProcessGroup sends SIGKILL to the process group led by process.
+func killProcessGroup(process *os.Process) error {
+	return syscall.Kill(-process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package runner
+
+import (
+	"os"
+	"os/exec"
+)
+
+// startInProcessGroup does nothing on Windows, where processes are stopped individually.
+func startInProcessGroup(_ *exec.Cmd) {}
+
+// terminateProcessGroup interrupts process; Windows has no SIGTERM.
+func terminateProcessGroup(process *os.Process) error {
+	return process.Signal(os.Interrupt)
+}
+
+// killProcessGroup kills process.
+func killProcessGroup(process *os.Process) error {
+	return process.Kill()
+}
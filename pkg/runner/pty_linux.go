@@ -0,0 +1,88 @@
+//go:build linux
+
+package runner
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+// processTerminal is the pseudo-terminal a command runs on. Output written to the terminal
+// is copied to the command's original stdout until the terminal is closed.
+type processTerminal struct {
+	pty  *os.File
+	tty  *os.File
+	done chan struct{}
+}
+
+// openProcessTerminal allocates a pseudo-terminal sized and named according to cfg and
+// connects cmd's stdin, stdout and stderr to it, making it the controlling terminal of a new
+// session. Output is not translated to "\r\n" line endings.
+func openProcessTerminal(cmd *exec.Cmd, cfg *config.PTYConfig) (*processTerminal, error) {
+	ptyFile, ttyFile, err := pty.Open()
+	if err != nil {
+		return nil, fmt.Errorf("opening pseudo-terminal: %w", err)
+	}
+	t := &processTerminal{pty: ptyFile, tty: ttyFile, done: make(chan struct{})}
+
+	if err := pty.Setsize(ptyFile, &pty.Winsize{Rows: cfg.GetRows(), Cols: cfg.GetCols()}); err != nil {
+		t.closeFiles()
+		return nil, fmt.Errorf("setting terminal size: %w", err)
+	}
+	termios, err := unix.IoctlGetTermios(int(ttyFile.Fd()), unix.TCGETS)
+	if err != nil {
+		t.closeFiles()
+		return nil, fmt.Errorf("reading terminal attributes: %w", err)
+	}
+	termios.Oflag &^= unix.ONLCR
+	if err := unix.IoctlSetTermios(int(ttyFile.Fd()), unix.TCSETS, termios); err != nil {
+		t.closeFiles()
+		return nil, fmt.Errorf("setting terminal attributes: %w", err)
+	}
+
+	output := cmd.Stdout
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = ttyFile, ttyFile, ttyFile
+	// exec.Cmd uses the last value of duplicated variables
+	cmd.Env = append(cmd.Env, "TERM="+cfg.GetTerm())
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0
+
+	go func() {
+		defer close(t.done)
+		// Reading fails with EIO once every process has closed the terminal
+		_, _ = io.Copy(output, ptyFile)
+	}()
+	return t, nil
+}
+
+// wait closes the server's end of the terminal after the command exited and waits for its
+// remaining output to be copied. Output of processes the command left running on the
+// terminal is dropped after processKillTimeout.
+func (t *processTerminal) wait() {
+	_ = t.tty.Close()
+	select {
+	case <-t.done:
+	case <-time.After(processKillTimeout):
+	}
+	_ = t.pty.Close()
+	<-t.done
+}
+
+// closeFiles releases the terminal without waiting for output.
+func (t *processTerminal) closeFiles() {
+	_ = t.tty.Close()
+	_ = t.pty.Close()
+}
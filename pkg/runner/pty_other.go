@@ -0,0 +1,21 @@
+//go:build !linux
+
+package runner
+
+import (
+	"errors"
+	"os/exec"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+// processTerminal is unavailable on platforms without pseudo-terminal support.
+type processTerminal struct{}
+
+// openProcessTerminal fails on platforms without pseudo-terminal support, so that commands
+// requiring a terminal are never run on pipes instead.
+func openProcessTerminal(_ *exec.Cmd, _ *config.PTYConfig) (*processTerminal, error) {
+	return nil, errors.New("pseudo-terminals are only supported on Linux")
+}
+
+func (t *processTerminal) wait() {}
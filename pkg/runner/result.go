@@ -0,0 +1,112 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"mvdan.cc/sh/v3/interp"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/hint"
+)
+
+// ExitCodeNotRun is the exit code reported when the script did not run to completion,
+// e.g. because a command was blocked, the script could not be parsed or it timed out.
+const ExitCodeNotRun = -1
+
+// ExecutedCommand is a command that passed validation and was run by the interpreter.
+type ExecutedCommand struct {
+	Name string   `json:"name"`
+	Args []string `json:"args"`
+}
+
+// ExecResult is the structured outcome of RunCommandResult.
+type ExecResult struct {
+	// ID is the run ID, also recorded in the audit log.
+	ID string
+	// ExitCode is the exit status of the script, or ExitCodeNotRun if it did not complete.
+	ExitCode int
+	// Duration is the wall-clock time spent running the script.
+	Duration time.Duration
+	// Stdout and Stderr hold the captured output, truncated to MaxOutputSize if set.
+	Stdout string
+	Stderr string
+	// StdoutBytes and StderrBytes are the number of bytes produced, including truncated bytes.
+	StdoutBytes int
+	StderrBytes int
+	// StdoutTruncated and StderrTruncated report whether the output exceeded MaxOutputSize.
+	StdoutTruncated bool
+	StderrTruncated bool
+	// StdoutRemainingBytes and StderrRemainingBytes are the number of bytes dropped by truncation.
+	StdoutRemainingBytes int
+	StderrRemainingBytes int
+	// StdoutLog and StderrLog are the files the complete output was written to, if any.
+	StdoutLog string
+	StderrLog string
+	// Commands lists the commands that were run, in order.
+	Commands []ExecutedCommand
+	// Steps holds the outcome of each top-level command of the script, in order.
+	Steps []StepResult
+	// CgroupUsage is the resource usage measured through the script's cgroup, if one was used.
+	CgroupUsage *CgroupUsage
+	// Processes is the resource usage of each external command, in the order they exited.
+	Processes []ProcessUsage
+	// NewWorkDir is the new working directory if cd was used (empty if unchanged).
+	NewWorkDir string
+	// WorkDir is the shell's working directory when the script finished.
+	WorkDir string
+	// Hints contains token-saving suggestions collected during execution.
+	Hints []hint.Hint
+}
+
+// RunCommandResult runs a shell command like RunCommand, capturing stdout and stderr separately.
+// A non-zero exit status is reported through ExitCode rather than as an error; the returned error
+// is set when the script did not run to completion. The result is returned in both cases.
+// Writers set with SetOutputs are not used.
+func (r *SafeRunner) RunCommandResult(ctx context.Context, command string, workingDir string) (*ExecResult, error) {
+	var stdout, stderr bytes.Buffer
+
+	start := time.Now()
+	runResult := r.runWithEnv(ctx, Request{Command: command, WorkingDir: workingDir, Stdout: &stdout, Stderr: &stderr}, r.defaultEnv())
+	duration := time.Since(start)
+
+	result := &ExecResult{
+		ID:                   runResult.ID,
+		Duration:             duration,
+		Stdout:               stdout.String(),
+		Stderr:               stderr.String(),
+		StdoutBytes:          runResult.Stdout.Bytes,
+		StderrBytes:          runResult.Stderr.Bytes,
+		StdoutTruncated:      runResult.Stdout.Truncated,
+		StderrTruncated:      runResult.Stderr.Truncated,
+		StdoutRemainingBytes: runResult.Stdout.RemainingBytes,
+		StderrRemainingBytes: runResult.Stderr.RemainingBytes,
+		StdoutLog:            runResult.StdoutLog,
+		StderrLog:            runResult.StderrLog,
+		Commands:             runResult.Commands,
+		Steps:                runResult.Steps,
+		CgroupUsage:          runResult.CgroupUsage,
+		Processes:            runResult.Processes,
+		NewWorkDir:           runResult.NewWorkDir,
+		WorkDir:              runResult.WorkDir,
+		Hints:                runResult.Hints,
+	}
+
+	result.ExitCode = ExitCode(runResult.Err)
+	if result.ExitCode == ExitCodeNotRun {
+		return result, runResult.Err
+	}
+	return result, nil
+}
+
+// ExitCode converts an error returned by RunCommand into an exit code: 0 for nil, the script's
+// exit status when it exited non-zero, or ExitCodeNotRun when it did not run to completion.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if status, ok := interp.IsExitStatus(err); ok {
+		return int(status)
+	}
+	return ExitCodeNotRun
+}
@@ -0,0 +1,86 @@
+package runner
+
+import (
+	"io"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func newResultTestRunner(t *testing.T, maxOutputSize int) (*SafeRunner, string) {
+	t.Helper()
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+			{Command: "false"},
+			{Command: "exit"},
+		},
+		DenyCommands: []config.DenyCommand{
+			{Command: "rm", Message: "Remove command is not allowed"},
+		},
+		DefaultErrorMessage: "Command not allowed by security policy",
+		MaxExecutionTime:    config.DefaultExecutionTimeout,
+		MaxOutputSize:       maxOutputSize,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	return New(cfg, validator.New(cfg, log), log), workDir
+}
+
+func TestRunCommandResult_SeparatesOutputs(t *testing.T) {
+	r, workDir := newResultTestRunner(t, 0)
+
+	result, err := r.RunCommandResult(t.Context(), "echo out; echo err >&2", workDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Equal(t, "out\n", result.Stdout)
+	assert.Equal(t, "err\n", result.Stderr)
+	assert.Equal(t, 4, result.StdoutBytes)
+	assert.Equal(t, 4, result.StderrBytes)
+	assert.False(t, result.StdoutTruncated)
+	assert.Equal(t, []ExecutedCommand{
+		{Name: "echo", Args: []string{"out"}},
+		{Name: "echo", Args: []string{"err"}},
+	}, result.Commands)
+	assert.True(t, result.Duration > 0)
+}
+
+func TestRunCommandResult_ExitCode(t *testing.T) {
+	r, workDir := newResultTestRunner(t, 0)
+
+	result, err := r.RunCommandResult(t.Context(), "false", workDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.ExitCode)
+
+	result, err = r.RunCommandResult(t.Context(), "echo before; exit 3", workDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, "before\n", result.Stdout)
+}
+
+func TestRunCommandResult_BlockedCommand(t *testing.T) {
+	r, workDir := newResultTestRunner(t, 0)
+
+	result, err := r.RunCommandResult(t.Context(), "echo first; rm file.txt; echo never", workDir)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Remove command is not allowed")
+	assert.Equal(t, ExitCodeNotRun, result.ExitCode)
+	assert.Equal(t, "first\n", result.Stdout)
+	assert.Equal(t, []ExecutedCommand{{Name: "echo", Args: []string{"first"}}}, result.Commands)
+}
+
+func TestRunCommandResult_Truncation(t *testing.T) {
+	r, workDir := newResultTestRunner(t, 10)
+
+	result, err := r.RunCommandResult(t.Context(), "echo 0123456789abcdef", workDir)
+	assert.NoError(t, err)
+	assert.True(t, result.StdoutTruncated)
+	assert.False(t, result.StderrTruncated)
+	assert.Equal(t, 17, result.StdoutBytes)
+	assert.Equal(t, 7, result.StdoutRemainingBytes)
+}
@@ -0,0 +1,33 @@
+//go:build linux
+
+package runner
+
+import (
+	"golang.org/x/sys/unix"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+// setResourceLimits sets the configured rlimits on the calling process with setrlimit(2).
+// The exec helper calls it before it execs the command, which inherits the limits along
+// with every process it starts.
+func setResourceLimits(limits *config.ResourceLimits) error {
+	settings := []struct {
+		resource int
+		value    uint64
+	}{
+		{unix.RLIMIT_CPU, limits.CPUSeconds},
+		{unix.RLIMIT_AS, limits.MemoryBytes},
+		{unix.RLIMIT_NOFILE, limits.OpenFiles},
+	}
+
+	for _, s := range settings {
+		if s.value == 0 {
+			continue
+		}
+		if err := unix.Setrlimit(s.resource, &unix.Rlimit{Cur: s.value, Max: s.value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -7,9 +7,12 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
+	"mvdan.cc/sh/v3/expand"
 	"mvdan.cc/sh/v3/interp"
 	"mvdan.cc/sh/v3/syntax"
 
@@ -20,102 +23,330 @@ import (
 	"github.com/shimizu1995/secure-shell-server/pkg/validator"
 )
 
-// SafeRunner executes shell commands securely.
+// SafeRunner executes shell commands securely. Run keeps all state of an execution to
+// itself, so a SafeRunner can run any number of scripts concurrently. The writers and
+// environment set with SetOutputs and SetEnv are defaults for RunCommand.
 type SafeRunner struct {
 	config    *config.ShellCommandConfig
 	validator *validator.CommandValidator
 	logger    *logger.Logger
-	stdout    io.Writer
-	stderr    io.Writer
-	// Output limiters to track truncation
-	stdoutLimiter *limiter.OutputLimiter
-	stderrLimiter *limiter.OutputLimiter
-	// hints collected during command execution, returned via RunResult
-	hints []hint.Hint
+
+	// mu protects the RunCommand defaults and the output stats of the last run
+	mu     sync.Mutex
+	stdout io.Writer
+	stderr io.Writer
+	// env is the environment set with SetEnv; nil means the server's own environment
+	env []string
+	// execHandler is the handler set with SetExecHandler; nil means the built-in one
+	execHandler interp.ExecHandlerFunc
+	// observer is the function set with SetRunObserver
+	observer func(AuditRecord)
+	// hooks are the hooks registered with AddHook, in order
+	hooks []Hook
+	// output stats of the most recent run, reported by WasOutputTruncated and friends
+	lastStdout OutputStats
+	lastStderr OutputStats
+	// active maps the IDs of running scripts to the functions cancelling them
+	active map[string]context.CancelCauseFunc
+
+	// auditMu serializes writes to the audit log
+	auditMu sync.Mutex
+	// recent holds the audit records of the latest runs, guarded by recentMu
+	recentMu sync.Mutex
+	recent   []AuditRecord
 }
 
 // New creates a new SafeRunner.
 func New(config *config.ShellCommandConfig, validator *validator.CommandValidator, logger *logger.Logger) *SafeRunner {
 	return &SafeRunner{
-		config:        config,
-		validator:     validator,
-		logger:        logger,
-		stdout:        os.Stdout,
-		stderr:        os.Stderr,
-		stdoutLimiter: nil,
-		stderrLimiter: nil,
+		config:    config,
+		validator: validator,
+		logger:    logger,
+		stdout:    os.Stdout,
+		stderr:    os.Stderr,
 	}
 }
 
-// SetOutputs sets the stdout and stderr writers.
+// SetOutputs sets the stdout and stderr writers used by RunCommand. Output beyond
+// MaxOutputSize is dropped.
 func (r *SafeRunner) SetOutputs(stdout, stderr io.Writer) {
-	// If MaxOutputSize is set, wrap the writers with limiters
-	if r.config.MaxOutputSize > 0 {
-		r.stdoutLimiter = limiter.NewOutputLimiter(stdout, r.config.MaxOutputSize)
-		r.stderrLimiter = limiter.NewOutputLimiter(stderr, r.config.MaxOutputSize)
-		r.stdout = r.stdoutLimiter
-		r.stderr = r.stderrLimiter
-	} else {
-		// Use the writers directly if no limit is set
-		r.stdout = stdout
-		r.stderr = stderr
-		r.stdoutLimiter = nil
-		r.stderrLimiter = nil
-	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stdout = stdout
+	r.stderr = stderr
 }
 
-// RunCommand runs a shell command in the specified working directory.
-// It enforces security constraints by validating commands and file access.
-// WasOutputTruncated returns whether stdout or stderr was truncated due to size limits.
-func (r *SafeRunner) WasOutputTruncated() bool {
-	if r.stdoutLimiter != nil && r.stdoutLimiter.WasTruncated() {
-		return true
+// SetEnv sets the environment RunCommand runs scripts with, as "NAME=value" entries. Later
+// entries override earlier ones with the same name. Entries whose variable is not allowed by
+// the EnvPolicy configuration are dropped and logged. A nil env restores the base
+// environment returned by BaseEnv.
+func (r *SafeRunner) SetEnv(env []string) {
+	filtered := r.filterEnv(env)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.env = filtered
+}
+
+// SetExecHandler substitutes h for the layer that spawns external commands, e.g. to run them
+// with ContainerExecHandler. h is called for every external command once it has passed
+// validation, with interp.HandlerCtx giving its directory, environment and standard streams.
+// Cgroups, resource limits, the sandbox, seccomp, pseudo-terminals and per-process resource
+// usage are features of the built-in layer and do not apply to h. A nil h restores the
+// built-in layer, or the container handler if Container is configured.
+func (r *SafeRunner) SetExecHandler(h interp.ExecHandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.execHandler = h
+}
+
+// SetRunObserver sets fn to be called with the audit record of every finished run, e.g. to
+// keep a persistent history. fn is called on the goroutine of the run and must not block for
+// long. A nil fn removes the observer.
+func (r *SafeRunner) SetRunObserver(fn func(AuditRecord)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observer = fn
+}
+
+// BaseEnv returns the environment scripts run with when none is set: PATH, HOME, LANG and the
+// variables listed in the EnvPolicy's passVars, taken from the server's environment, or the
+// whole server environment if the policy's inherit is set.
+func (r *SafeRunner) BaseEnv() []string {
+	return r.config.EnvPolicy.BaseEnv(os.Environ())
+}
+
+// defaultEnv returns the environment set with SetEnv.
+func (r *SafeRunner) defaultEnv() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.env
+}
+
+// filterEnv drops malformed entries and variables not allowed by the EnvPolicy configuration.
+func (r *SafeRunner) filterEnv(env []string) []string {
+	if env == nil {
+		return nil
 	}
-	if r.stderrLimiter != nil && r.stderrLimiter.WasTruncated() {
-		return true
+	filtered := make([]string, 0, len(env))
+	for _, entry := range env {
+		name, _, ok := strings.Cut(entry, "=")
+		if !ok || name == "" {
+			r.logger.LogErrorf("Ignoring malformed environment entry %q", entry)
+			continue
+		}
+		if !r.config.EnvPolicy.IsVarAllowed(name) {
+			r.logger.LogErrorf("Environment variable %s is not allowed by the env policy", name)
+			continue
+		}
+		filtered = append(filtered, entry)
 	}
-	return false
+	return filtered
 }
 
-// GetTruncationStatus returns detailed information about which outputs were truncated.
+// WasOutputTruncated returns whether stdout or stderr of the most recent run was truncated
+// due to size limits.
+func (r *SafeRunner) WasOutputTruncated() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastStdout.Truncated || r.lastStderr.Truncated
+}
+
+// GetTruncationStatus returns detailed information about which outputs of the most recent run
+// were truncated.
 func (r *SafeRunner) GetTruncationStatus() (stdoutTruncated bool, stderrTruncated bool) {
-	stdoutTruncated = r.stdoutLimiter != nil && r.stdoutLimiter.WasTruncated()
-	stderrTruncated = r.stderrLimiter != nil && r.stderrLimiter.WasTruncated()
-	return
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastStdout.Truncated, r.lastStderr.Truncated
 }
 
-// GetTruncationDetails returns detailed information about truncation, including which
-// outputs were truncated and how many bytes remained unwritten for each.
+// GetTruncationDetails returns detailed information about truncation of the most recent run,
+// including which outputs were truncated and how many bytes remained unwritten for each.
 func (r *SafeRunner) GetTruncationDetails() (stdoutTruncated bool, stderrTruncated bool, stdoutRemainingBytes int, stderrRemainingBytes int) {
-	stdoutTruncated = r.stdoutLimiter != nil && r.stdoutLimiter.WasTruncated()
-	stderrTruncated = r.stderrLimiter != nil && r.stderrLimiter.WasTruncated()
-
-	stdoutRemainingBytes = 0
-	if stdoutTruncated {
-		stdoutRemainingBytes = r.stdoutLimiter.GetRemainingBytes()
-	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastStdout.Truncated, r.lastStderr.Truncated,
+		r.lastStdout.RemainingBytes, r.lastStderr.RemainingBytes
+}
 
-	stderrRemainingBytes = 0
-	if stderrTruncated {
-		stderrRemainingBytes = r.stderrLimiter.GetRemainingBytes()
-	}
+// Request describes a single script execution by Run.
+type Request struct {
+	// ID identifies the run for Cancel while it is active; a random ID is generated when empty.
+	ID string
+	// Client identifies the client that sent the request, e.g. its MCP session ID. It is
+	// recorded in the block log.
+	Client string
+	// Command is the shell script to run.
+	Command string
+	// WorkingDir is the directory the script starts in; it must be an allowed directory.
+	WorkingDir string
+	// Stdin is the script's standard input. A nil reader reads as empty.
+	Stdin io.Reader
+	// Stdout and Stderr receive the script's output, truncated to MaxStdoutSize and MaxStderrSize.
+	// A nil writer discards the output.
+	Stdout io.Writer
+	Stderr io.Writer
+	// Env is the environment as "NAME=value" entries, filtered like SetEnv. Nil means the
+	// base environment returned by BaseEnv.
+	Env []string
+	// Args are the script's positional parameters, $1 onwards.
+	Args []string
+	// MaxOutputSize, if positive, limits stdout and stderr to this many bytes each. It only
+	// lowers the configured limits, never raises them.
+	MaxOutputSize int
+	// Timeout, if positive, replaces MaxExecutionTime as the time limit of the run. It is
+	// clamped to the configured MaxCallTimeout.
+	Timeout time.Duration
+	// CreateWorkingDir creates WorkingDir if it is inside an allowed directory but does not
+	// exist, as the CreateWorkingDir configuration does for every run.
+	CreateWorkingDir bool
+	// Preflight validates every command of the script before any of it runs and runs nothing
+	// if one is blocked, as the PreflightValidation configuration does for every run.
+	// Otherwise commands are validated as the script reaches them, after the commands before
+	// them ran.
+	Preflight bool
+	// StopOnError runs the script with set -e semantics, as the StopOnError configuration
+	// does for every run: the script stops at the first command that fails, outside of
+	// conditions such as if and &&. Otherwise it continues with the next command.
+	StopOnError bool
+	// Approved lets the script run commands listed in requireApproval, for requests a human
+	// approved.
+	Approved bool
+	// Session, if set, carries shell state between runs. The script starts in the session's
+	// directory instead of WorkingDir, with the variables exported and the functions defined
+	// by earlier runs of the session; Env is applied on top of those variables.
+	Session *Session
+}
 
-	return
+// OutputStats describes one output stream of a run.
+type OutputStats struct {
+	// Bytes is the number of bytes produced, including bytes dropped by truncation.
+	Bytes int `json:"bytes"`
+	// Truncated reports whether the output exceeded MaxOutputSize or MaxOutputLines.
+	Truncated bool `json:"truncated"`
+	// RemainingBytes is the number of bytes dropped by truncation.
+	RemainingBytes int `json:"remainingBytes"`
 }
 
 // RunResult holds the result of a command execution.
 type RunResult struct {
+	// ID is the ID the run was active under.
+	ID string
 	// NewWorkDir is the new working directory if cd was used (empty if unchanged).
 	NewWorkDir string
+	// WorkDir is the shell's working directory when the script finished, e.g. to keep a
+	// client's current directory in sync. It is empty if the script did not start.
+	WorkDir string
 	// Hints contains token-saving suggestions collected during execution.
 	Hints []hint.Hint
+	// Commands lists the commands that passed validation and were run, in order.
+	Commands []ExecutedCommand
+	// Steps holds the outcome of each top-level command of the script, in order. It is empty
+	// if the script did not start.
+	Steps []StepResult
+	// CgroupUsage is the resource usage measured through the script's cgroup, if one was used.
+	CgroupUsage *CgroupUsage
+	// Processes is the resource usage of each external command, in the order they exited.
+	Processes []ProcessUsage
+	// Stdout and Stderr describe the amount of output and its truncation.
+	Stdout OutputStats
+	Stderr OutputStats
+	// StdoutLog and StderrLog are the files the complete output was written to when
+	// OutputLogDir is configured, or when SpoolDir is configured and the output was truncated.
+	StdoutLog string
+	StderrLog string
 	// Err is the execution error, if any.
 	Err error
 }
 
-// RunCommand runs a shell command in the specified working directory.
+// RunCommand runs a shell command in the specified working directory, writing to the outputs
+// set with SetOutputs and using the environment set with SetEnv.
 // It enforces security constraints by validating commands and file access.
 func (r *SafeRunner) RunCommand(ctx context.Context, command string, workingDir string) RunResult {
+	r.mu.Lock()
+	req := Request{Command: command, WorkingDir: workingDir, Stdout: r.stdout, Stderr: r.stderr}
+	r.mu.Unlock()
+
+	return r.runWithEnv(ctx, req, r.defaultEnv())
+}
+
+// Run runs the script described by req. All state of the execution is local to the call, so
+// Run may be called concurrently.
+// It enforces security constraints by validating commands and file access.
+func (r *SafeRunner) Run(ctx context.Context, req Request) RunResult {
+	return r.runWithEnv(ctx, req, r.filterEnv(req.Env))
+}
+
+// runWithEnv runs req with an already filtered environment, records its output stats for
+// WasOutputTruncated and friends and writes it to the audit log.
+func (r *SafeRunner) runWithEnv(ctx context.Context, req Request, env []string) RunResult {
+	id := req.ID
+	if id == "" {
+		id = NewRunID()
+	}
+	if env == nil {
+		env = r.BaseEnv()
+	}
+	mode, err := outputMode(r.config.OutputMode)
+	if err != nil {
+		return RunResult{ID: id, Err: err}
+	}
+	ctx, done, err := r.startRun(ctx, id)
+	if err != nil {
+		return RunResult{ID: id, Err: err}
+	}
+	defer done()
+	ctx = validator.WithCaller(ctx, validator.Caller{Client: req.Client, RunID: id, Approved: req.Approved})
+
+	startedAt := time.Now()
+	workingDir := req.WorkingDir
+	if req.Session != nil {
+		req.Session.run.Lock()
+		defer req.Session.run.Unlock()
+		workingDir = req.Session.Dir()
+		env = req.Session.environment(env)
+	}
+
+	stdout := newOutput(req.Stdout, lowerLimit(r.config.GetMaxStdoutSize(), req.MaxOutputSize), r.config.MaxOutputLines, mode)
+	stderr := newOutput(req.Stderr, lowerLimit(r.config.GetMaxStderrSize(), req.MaxOutputSize), r.config.MaxOutputLines, mode)
+	if r.config.StripANSI {
+		stdout.stripANSI()
+		stderr.stripANSI()
+	}
+	if dir, spool := r.outputLogDir(); dir != "" {
+		r.openOutputLog(stdout, dir, spool, id, StreamStdout)
+		r.openOutputLog(stderr, dir, spool, id, StreamStderr)
+	}
+
+	result := r.run(ctx, req, workingDir, stdout, stderr, env)
+	for _, o := range []*output{stdout, stderr} {
+		if err := o.flush(); err != nil {
+			r.logger.LogErrorf("Failed to write output of run %s: %v", id, err)
+		}
+	}
+	r.closeOutputLog(stdout)
+	r.closeOutputLog(stderr)
+	result.ID = id
+	result.StdoutLog, result.StderrLog = stdout.logPath, stderr.logPath
+	if result.Err != nil && errors.Is(context.Cause(ctx), ErrCanceled) {
+		result.Err = ErrCanceled
+	}
+	result.Stdout = stdout.stats()
+	result.Stderr = stderr.stats()
+
+	r.mu.Lock()
+	r.lastStdout, r.lastStderr = result.Stdout, result.Stderr
+	r.mu.Unlock()
+
+	record := newAuditRecord(req, workingDir, startedAt, result)
+	r.rememberRun(record)
+	r.writeAudit(record)
+	r.notifyObserver(record)
+	return result
+}
+
+// run executes the script of req in workingDir with the given outputs and environment,
+// loading and saving the shell state of req.Session if it is set.
+func (r *SafeRunner) run(ctx context.Context, req Request, workingDir string, stdout, stderr io.Writer, env []string) RunResult {
 	// Get absolute path of the working directory
 	absWorkingDir, err := filepath.Abs(workingDir)
 	if err != nil {
@@ -127,28 +358,77 @@ func (r *SafeRunner) RunCommand(ctx context.Context, command string, workingDir
 	dirAllowed, dirMessage := r.validator.IsDirectoryAllowed(absWorkingDir)
 	if !dirAllowed {
 		r.logger.LogErrorf("Directory validation failed: %s", dirMessage)
-		return RunResult{Err: fmt.Errorf("directory validation failed: %s", dirMessage)}
+		return RunResult{Err: fmt.Errorf("directory validation failed: %w", &DirectoryNotAllowedError{Dir: absWorkingDir, Message: dirMessage})}
+	}
+
+	// Create a missing working directory if asked to
+	if req.CreateWorkingDir || r.config.CreateWorkingDir {
+		if err := r.createWorkingDir(absWorkingDir); err != nil {
+			r.logger.LogErrorf("Failed to create working directory: %v", err)
+			return RunResult{Err: fmt.Errorf("failed to create working directory: %w", err)}
+		}
 	}
 
 	// Parse the command
 	parser := syntax.NewParser()
-	prog, err := parser.Parse(strings.NewReader(command), "")
+	prog, err := parser.Parse(strings.NewReader(req.Command), "")
 	if err != nil {
 		r.logger.LogErrorf("Parse error: %v", err)
 		return RunResult{Err: fmt.Errorf("parse error: %w", err)}
 	}
+	if err := checkScriptLimits(prog, r.config.ScriptLimits); err != nil {
+		r.logger.LogErrorf("Script rejected: %v", err)
+		return RunResult{Err: err}
+	}
+	if req.Preflight || r.config.PreflightValidation {
+		if err := r.preflight(ctx, req.Command, absWorkingDir); err != nil {
+			r.logger.LogErrorf("Script rejected: %v", err)
+			return RunResult{Err: err}
+		}
+	}
 
-	// Create a timeout context if MaxExecutionTime is set
-	if r.config.MaxExecutionTime > 0 {
-		timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.config.MaxExecutionTime)*time.Second)
+	// Place the script's processes in a transient cgroup if configured
+	var cgroup *scriptCgroup
+	if r.config.Cgroup != nil {
+		cgroup, err = newScriptCgroup(r.config.Cgroup)
+		if err != nil {
+			r.logger.LogErrorf("Cgroup setup failed: %v", err)
+			return RunResult{Err: fmt.Errorf("cgroup setup failed: %w", err)}
+		}
+		defer func() {
+			if err := cgroup.remove(); err != nil {
+				r.logger.LogErrorf("Failed to remove cgroup: %v", err)
+			}
+		}()
+	}
+
+	// Create a timeout context if MaxExecutionTime or a timeout of the request is set
+	parentCtx := ctx
+	timeout := r.runTimeout(req)
+	if timeout > 0 {
+		timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
 		defer cancel()
 		ctx = timeoutCtx
 	}
 
-	// Track the last directory set by cd
+	// Track the last directory set by cd, the hints and the commands that were run. The call
+	// handler runs concurrently for the commands of a pipeline, so they are guarded by mu.
+	var mu sync.Mutex
 	var lastCdDir string
+	var hints []hint.Hint
+	var commands []ExecutedCommand
+	usages := &processUsages{}
+	hooks := r.currentHooks()
 
 	callFunc := func(callCtx context.Context, args []string) ([]string, error) {
+		if len(hooks) > 0 {
+			hooked := Command{RunID: runIDFrom(callCtx), Client: req.Client, Name: args[0], Args: slices.Clone(args[1:]), Dir: absWorkingDir}
+			if err := beforeValidate(callCtx, hooks, &hooked); err != nil {
+				r.logger.LogCommandDecision(runIDFrom(callCtx), args[0], args[1:], false)
+				return args, err
+			}
+			args = append([]string{hooked.Name}, hooked.Args...)
+		}
 		cmd := args[0]
 
 		// Normalize absolute path commands to basename for validation
@@ -159,21 +439,28 @@ func (r *SafeRunner) RunCommand(ctx context.Context, command string, workingDir
 		}
 
 		// Validate all commands (including cd) through the same pipeline
-		allowed, errMsg := r.validator.ValidateCommand(cmdForValidation, args[1:], absWorkingDir)
-		if !allowed {
-			r.logger.LogCommandAttempt(cmd, args[1:], false)
-			return args, fmt.Errorf("%s", errMsg)
+		result := r.validator.ValidateContext(callCtx, cmdForValidation, args[1:], absWorkingDir)
+		if len(hooks) > 0 {
+			afterValidate(callCtx, hooks, Command{RunID: runIDFrom(callCtx), Client: req.Client, Name: cmd, Args: args[1:], Dir: absWorkingDir}, result)
+		}
+		if !result.Allowed {
+			r.logger.LogCommandDecision(runIDFrom(callCtx), cmd, args[1:], false)
+			return args, &CommandDeniedError{Command: cmd, Args: args[1:], Result: result}
 		}
 
+		mu.Lock()
+		defer mu.Unlock()
+
 		// Collect token-saving hints
-		r.collectHints(cmdForValidation, args, absWorkingDir)
+		hints = append(hints, collectHints(cmdForValidation, args, absWorkingDir)...)
 
 		// Handle cd as a shell builtin after validation passes
 		if cmdForValidation == "cd" {
 			return r.handleCdCall(callCtx, args, &lastCdDir)
 		}
 
-		r.logger.LogCommandAttempt(cmd, args[1:], true)
+		r.logger.LogCommandDecision(runIDFrom(callCtx), cmd, args[1:], true)
+		commands = append(commands, ExecutedCommand{Name: cmd, Args: args[1:]})
 
 		return args, nil
 	}
@@ -181,42 +468,198 @@ func (r *SafeRunner) RunCommand(ctx context.Context, command string, workingDir
 	// Create interpreter
 	interpRunner, err := interp.New(
 		interp.CallHandler(callFunc),
-		interp.StdIO(nil, r.stdout, r.stderr),
-		interp.Env(nil),
+		interp.StdIO(req.Stdin, stdout, stderr),
+		interp.Env(expand.ListEnviron(env...)),
 		interp.Dir(absWorkingDir),
+		interp.Params(r.params(req)...),
 		interp.OpenHandler(r.secureOpenHandler),
+		interp.ExecHandlers(r.execMiddlewares(cgroup, usages, hooks, req.Client)...),
 	)
 	if err != nil {
 		r.logger.LogErrorf("Interpreter creation error: %v", err)
 		return RunResult{Err: fmt.Errorf("interpreter creation error: %w", err)}
 	}
 
-	err = interpRunner.Run(ctx, prog)
-	return RunResult{NewWorkDir: lastCdDir, Hints: r.hints, Err: err}
+	if req.Session != nil {
+		interpRunner.Reset()
+		req.Session.restore(interpRunner)
+	}
+	// runErr reports the end of the run's own deadline as a timeout; a deadline of the
+	// caller's context is its own error
+	runErr := func(err error) error {
+		if err != nil && timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) && parentCtx.Err() == nil {
+			return &TimeoutError{Timeout: timeout}
+		}
+		return err
+	}
+	steps, err := runSteps(ctx, interpRunner, prog, req.Command, runErr)
+	if errors.Is(err, ErrTimeout) {
+		r.logger.LogErrorf("Script exceeded its timeout of %v", timeout)
+	}
+	if req.Session != nil {
+		req.Session.save(interpRunner)
+	}
+	result := RunResult{NewWorkDir: lastCdDir, WorkDir: interpRunner.Dir, Hints: hints, Commands: commands, Steps: steps, Processes: usages.list(), Err: err}
+	if cgroup != nil {
+		result.CgroupUsage = cgroup.usage()
+	}
+	return result
+}
+
+// params returns the shell options and positional parameters of the run of req.
+func (r *SafeRunner) params(req Request) []string {
+	var params []string
+	if req.StopOnError || r.config.StopOnError {
+		params = append(params, "-e")
+	}
+	return append(append(params, "--"), req.Args...)
 }
 
-// secureOpenHandler validates file access against allowed directories before opening.
-func (r *SafeRunner) secureOpenHandler(ctx context.Context, path string, flag int, perm os.FileMode) (io.ReadWriteCloser, error) {
-	absPath, absErr := filepath.Abs(path)
-	if absErr != nil {
-		r.logger.LogErrorf("Failed to get absolute path for file %s: %v", path, absErr)
-		return nil, &os.PathError{Op: "open", Path: path, Err: absErr}
+// preflight validates every command and redirection of script before it runs. The commands
+// are validated again as they run, so the check consumes no rate limits; only a blocked
+// script is validated for real, to write it to the block log.
+func (r *SafeRunner) preflight(ctx context.Context, script, workingDir string) error {
+	if result := r.validator.CheckScript(ctx, script, workingDir); result.Allowed {
+		return nil
+	}
+	result := r.validator.ValidateScriptContext(ctx, script, workingDir)
+	if result.Allowed {
+		return nil
 	}
+	return fmt.Errorf("command validation failed: %w", &CommandDeniedError{Command: result.Command, Result: result})
+}
 
-	// Resolve symlinks to prevent directory escape via symlinks
-	if resolved, resolveErr := filepath.EvalSymlinks(absPath); resolveErr == nil {
-		absPath = resolved
+// workingDirPermissions are the permissions of working directories created for a run.
+const workingDirPermissions = 0o750
+
+// createWorkingDir creates dir and its missing parents if dir does not exist. The caller has
+// checked that dir is inside an allowed directory.
+func (r *SafeRunner) createWorkingDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
 	}
+	if err := os.MkdirAll(dir, workingDirPermissions); err != nil {
+		return err
+	}
+	r.logger.LogInfof("Created working directory %s", dir)
+	return nil
+}
 
-	// Check if file's directory is in the allowed list
-	fileDir := filepath.Dir(absPath)
-	allowed, msg := r.validator.IsDirectoryAllowed(fileDir)
-	if !allowed {
-		r.logger.LogErrorf("File access attempted outside allowed directories: %s", absPath)
+// output is one output stream of a run: the request's writer behind the MaxOutputSize and
+// MaxOutputLines limiter, counting the bytes produced and copying them in full to the output
+// log, if any.
+type output struct {
+	writer  io.Writer
+	limiter *limiter.OutputLimiter
+	bytes   int
+
+	log     *os.File
+	logPath string
+	logErr  error
+	spooled bool
+}
+
+// lowerLimit returns the lower of two size limits, where 0 means unlimited.
+func lowerLimit(limit, requested int) int {
+	if requested > 0 && (limit == 0 || requested < limit) {
+		return requested
+	}
+	return limit
+}
+
+// newOutput wraps w for a run, keeping the part of the output selected by mode. A nil w
+// discards the output.
+func newOutput(w io.Writer, maxSize int, maxLines int, mode limiter.Mode) *output {
+	if w == nil {
+		w = io.Discard
+	}
+	o := &output{writer: w}
+	if maxSize <= 0 && maxLines <= 0 {
+		return o
+	}
+	switch mode {
+	case limiter.ModeTail:
+		o.limiter = limiter.NewTailLimiter(w, maxSize, maxLines)
+	case limiter.ModeHeadTail:
+		o.limiter = limiter.NewHeadTailLimiter(w, maxSize, maxLines)
+	default:
+		o.limiter = limiter.NewLineLimiter(w, maxSize, maxLines)
+	}
+	o.writer = o.limiter
+	return o
+}
+
+// stripANSI removes ANSI escape sequences from the output before it is limited. The output
+// log keeps them.
+func (o *output) stripANSI() {
+	o.writer = limiter.NewANSIStripper(o.writer)
+}
+
+// outputMode returns the limiter mode of the OutputMode configuration.
+func outputMode(mode string) (limiter.Mode, error) {
+	switch mode {
+	case "", config.OutputModeHead:
+		return limiter.ModeHead, nil
+	case config.OutputModeTail:
+		return limiter.ModeTail, nil
+	case config.OutputModeHeadTail:
+		return limiter.ModeHeadTail, nil
+	default:
+		return "", fmt.Errorf("unknown output mode %q", mode)
+	}
+}
+
+// flush writes output the limiter keeps until the end of the run.
+func (o *output) flush() error {
+	if o.limiter == nil {
+		return nil
+	}
+	return o.limiter.Flush()
+}
+
+// Write writes p to the output log and through the limiter. Once writing the log fails, it
+// is no longer written, but the run goes on.
+func (o *output) Write(p []byte) (int, error) {
+	o.bytes += len(p)
+	if o.log != nil && o.logErr == nil {
+		_, o.logErr = o.log.Write(p)
+	}
+	return o.writer.Write(p)
+}
+
+// stats returns the output stats of the stream.
+func (o *output) stats() OutputStats {
+	stats := OutputStats{Bytes: o.bytes}
+	if o.limiter != nil && o.limiter.WasTruncated() {
+		stats.Truncated = true
+		stats.RemainingBytes = o.limiter.GetRemainingBytes()
+	}
+	return stats
+}
+
+// writeFlags are the open flags that make an open a write.
+const writeFlags = os.O_WRONLY | os.O_RDWR | os.O_APPEND | os.O_CREATE | os.O_TRUNC
+
+// secureOpenHandler validates the file itself against the path policy before opening it:
+// relative paths are resolved against the interpreter's directory, symlinks are followed,
+// denyPaths apply and files in read-only directories may not be opened for writing.
+func (r *SafeRunner) secureOpenHandler(ctx context.Context, path string, flag int, perm os.FileMode) (io.ReadWriteCloser, error) {
+	dir := interp.HandlerCtx(ctx).Dir
+	write := flag&writeFlags != 0
+	result := r.validator.ValidateFileAccess(path, dir, write)
+	if !result.Allowed {
+		r.logger.LogErrorf("File access denied (write=%t) for %s in %s: %s", write, path, dir, result.Message)
 		return nil, &os.PathError{
 			Op:   "open",
 			Path: path,
-			Err:  fmt.Errorf("access denied: file is outside allowed directories: %s", msg),
+			Err:  fmt.Errorf("access denied: %s", result.Message),
 		}
 	}
 
@@ -253,8 +696,8 @@ func (r *SafeRunner) handleCdCall(ctx context.Context, args []string, lastCdDir
 	// Validate against allowed directories
 	allowed, msg := r.validator.IsDirectoryAllowed(absTarget)
 	if !allowed {
-		r.logger.LogCommandAttempt("cd", args[1:], false)
-		return args, fmt.Errorf("cd: %s", msg)
+		r.logger.LogCommandDecision(runIDFrom(ctx), "cd", args[1:], false)
+		return args, fmt.Errorf("cd: %w", &DirectoryNotAllowedError{Dir: absTarget, Message: msg})
 	}
 
 	// Check directory exists
@@ -264,12 +707,13 @@ func (r *SafeRunner) handleCdCall(ctx context.Context, args []string, lastCdDir
 	}
 
 	*lastCdDir = absTarget
-	r.logger.LogCommandAttempt("cd", args[1:], true)
+	r.logger.LogCommandDecision(runIDFrom(ctx), "cd", args[1:], true)
 	return args, nil
 }
 
 // collectHints checks the parsed command and arguments for token-saving opportunities.
-func (r *SafeRunner) collectHints(cmd string, args []string, workingDir string) {
+func collectHints(cmd string, args []string, workingDir string) []hint.Hint {
+	var hints []hint.Hint
 	cleanWorking := filepath.Clean(workingDir)
 	prefix := cleanWorking + string(filepath.Separator)
 
@@ -280,7 +724,7 @@ func (r *SafeRunner) collectHints(cmd string, args []string, workingDir string)
 		cleanTarget := filepath.Clean(target)
 		if filepath.IsAbs(cleanTarget) && cleanTarget == cleanWorking {
 			redundantCdTarget = cleanTarget
-			r.hints = append(r.hints, hint.Hint{
+			hints = append(hints, hint.Hint{
 				Type: hint.RedundantCd,
 				Message: fmt.Sprintf(
 					"[Hint] The cd to %q is unnecessary — you are already in that directory.",
@@ -318,7 +762,7 @@ func (r *SafeRunner) collectHints(cmd string, args []string, workingDir string)
 		default:
 			continue
 		}
-		r.hints = append(r.hints, hint.Hint{
+		hints = append(hints, hint.Hint{
 			Type: hint.AbsolutePathConvertible,
 			Message: fmt.Sprintf(
 				"[Hint] %q can be shortened to %q (relative to current directory).",
@@ -326,4 +770,5 @@ func (r *SafeRunner) collectHints(cmd string, args []string, workingDir string)
 			),
 		})
 	}
+	return hints
 }
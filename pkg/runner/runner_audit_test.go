@@ -0,0 +1,126 @@
+package runner
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestRunAuditLog(t *testing.T) {
+	workDir := t.TempDir()
+	auditPath := filepath.Join(t.TempDir(), "audit", "runs.jsonl")
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+			{Command: "exit"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+		MaxOutputSize:       4,
+		AuditLogPath:        auditPath,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	results := []RunResult{
+		r.Run(t.Context(), Request{Command: "echo hello world; exit 3", WorkingDir: workDir}),
+		r.Run(t.Context(), Request{ID: "blocked-run", Command: "rm -rf /", WorkingDir: workDir}),
+	}
+
+	info, err := os.Stat(auditPath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	f, err := os.Open(auditPath)
+	assert.NoError(t, err)
+	defer f.Close()
+	var records []AuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record AuditRecord
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	assert.NoError(t, scanner.Err())
+	assert.Equal(t, 2, len(records))
+
+	completed := records[0]
+	assert.Equal(t, results[0].ID, completed.ID)
+	assert.Equal(t, workDir, completed.WorkingDir)
+	assert.Equal(t, "echo hello world; exit 3", completed.Script)
+	assert.Equal(t, []ExecutedCommand{{Name: "echo", Args: []string{"hello", "world"}}, {Name: "exit", Args: []string{"3"}}}, completed.Commands)
+	assert.Equal(t, 3, completed.ExitCode)
+	assert.Equal(t, "exit status 3", completed.Error)
+	assert.Equal(t, OutputStats{Bytes: 12, Truncated: true, RemainingBytes: 8}, completed.Stdout)
+	assert.False(t, completed.FinishedAt.Before(completed.StartedAt))
+
+	blocked := records[1]
+	assert.Equal(t, "blocked-run", blocked.ID)
+	assert.Equal(t, ExitCodeNotRun, blocked.ExitCode)
+	assert.Contains(t, blocked.Error, "Command not allowed")
+	assert.Equal(t, []ExecutedCommand{}, blocked.Commands)
+}
+
+func TestRecentRuns(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}},
+		DefaultErrorMessage: "Command not allowed",
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	// Runs are kept without an audit log, per client
+	r.Run(t.Context(), Request{ID: "first", Client: "alice", Command: "echo one", WorkingDir: workDir})
+	r.Run(t.Context(), Request{ID: "other", Client: "bob", Command: "echo two", WorkingDir: workDir})
+	r.Run(t.Context(), Request{ID: "second", Client: "alice", Command: "rm x", WorkingDir: workDir})
+
+	runs := r.RecentRuns("alice")
+	assert.Equal(t, 2, len(runs))
+	assert.Equal(t, "first", runs[0].ID)
+	assert.Equal(t, "alice", runs[0].Client)
+	assert.Equal(t, "echo one", runs[0].Script)
+	assert.Equal(t, "second", runs[1].ID)
+	assert.Equal(t, ExitCodeNotRun, runs[1].ExitCode)
+	assert.Equal(t, 0, len(r.RecentRuns("carol")))
+
+	// Only the latest runs are kept
+	for range recentRunsKept {
+		r.Run(t.Context(), Request{Client: "bob", Command: "echo again", WorkingDir: workDir})
+	}
+	assert.Equal(t, 0, len(r.RecentRuns("alice")))
+	assert.Equal(t, recentRunsKept, len(r.RecentRuns("bob")))
+}
+
+func TestRunObserver(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}},
+		DefaultErrorMessage: "Command not allowed",
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	var observed []AuditRecord
+	r.SetRunObserver(func(record AuditRecord) { observed = append(observed, record) })
+	r.Run(t.Context(), Request{ID: "seen", Client: "alice", Command: "echo hi", WorkingDir: workDir})
+	r.SetRunObserver(nil)
+	r.Run(t.Context(), Request{ID: "unseen", Command: "echo hi", WorkingDir: workDir})
+
+	assert.Equal(t, 1, len(observed))
+	assert.Equal(t, "seen", observed[0].ID)
+	assert.Equal(t, "alice", observed[0].Client)
+	assert.Equal(t, OutputStats{Bytes: 3}, observed[0].Stdout)
+}
@@ -0,0 +1,133 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestRunBatch(t *testing.T) {
+	workDir := t.TempDir()
+	outsideDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+			{Command: "sleep"},
+			{Command: "false"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	// requests returns a batch of four requests whose third one is blocked, and the buffers
+	// receiving their standard output.
+	requests := func() ([]Request, []*bytes.Buffer) {
+		commands := []string{"echo one", "false", "rm -rf x", "echo four"}
+		reqs := make([]Request, len(commands))
+		outputs := make([]*bytes.Buffer, len(commands))
+		for i, command := range commands {
+			outputs[i] = &bytes.Buffer{}
+			reqs[i] = Request{Command: command, WorkingDir: workDir, Stdout: outputs[i]}
+		}
+		return reqs, outputs
+	}
+
+	t.Run("runs every valid request", func(t *testing.T) {
+		reqs, outputs := requests()
+		results := r.RunBatch(t.Context(), reqs, BatchOptions{})
+		assert.Equal(t, 4, len(results))
+
+		assert.NoError(t, results[0].Err)
+		assert.Equal(t, "one\n", outputs[0].String())
+		assert.Equal(t, 1, ExitCode(results[1].Err))
+		assert.Error(t, results[2].Err)
+		assert.Contains(t, results[2].Err.Error(), `command "rm" is not permitted`)
+		assert.Equal(t, "", results[2].ID)
+		assert.NoError(t, results[3].Err)
+		assert.Equal(t, "four\n", outputs[3].String())
+	})
+
+	t.Run("fail fast runs nothing when a request is invalid", func(t *testing.T) {
+		reqs, outputs := requests()
+		results := r.RunBatch(t.Context(), reqs, BatchOptions{FailFast: true})
+
+		assert.Contains(t, results[2].Err.Error(), `command "rm" is not permitted`)
+		for _, i := range []int{0, 1, 3} {
+			assert.True(t, errors.Is(results[i].Err, ErrNotRun))
+			assert.Equal(t, "", outputs[i].String())
+		}
+	})
+
+	t.Run("fail fast stops at the first failing request", func(t *testing.T) {
+		reqs, outputs := requests()
+		reqs[2].Command = "echo three"
+		results := r.RunBatch(t.Context(), reqs, BatchOptions{FailFast: true})
+
+		assert.NoError(t, results[0].Err)
+		assert.Equal(t, 1, ExitCode(results[1].Err))
+		assert.True(t, errors.Is(results[2].Err, ErrNotRun))
+		assert.True(t, errors.Is(results[3].Err, ErrNotRun))
+		assert.Equal(t, "", outputs[2].String()+outputs[3].String())
+	})
+
+	t.Run("working directory is validated", func(t *testing.T) {
+		results := r.RunBatch(t.Context(), []Request{{Command: "echo x", WorkingDir: outsideDir}}, BatchOptions{})
+		assert.Error(t, results[0].Err)
+		assert.Contains(t, results[0].Err.Error(), "directory validation failed")
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		reqs := make([]Request, 4)
+		outputs := make([]*bytes.Buffer, len(reqs))
+		for i := range reqs {
+			outputs[i] = &bytes.Buffer{}
+			reqs[i] = Request{Command: "sleep 1; echo done", WorkingDir: workDir, Stdout: outputs[i]}
+		}
+
+		start := time.Now()
+		results := r.RunBatch(t.Context(), reqs, BatchOptions{Concurrent: true})
+		assert.True(t, time.Since(start) < 3*time.Second)
+		for i, result := range results {
+			assert.NoError(t, result.Err)
+			assert.Equal(t, "done\n", outputs[i].String())
+		}
+	})
+}
+
+func TestRunBatchRateLimit(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo", RateLimit: &config.RateLimit{Count: 1, Per: "1h"}},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	// The validation of the batch does not use up the rate limit of the commands it runs
+	var stdout bytes.Buffer
+	results := r.RunBatch(t.Context(), []Request{{Command: "echo hi", WorkingDir: workDir, Stdout: &stdout}}, BatchOptions{})
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, "hi\n", stdout.String())
+
+	// Once used up, the batch is refused before anything runs
+	stdout.Reset()
+	results = r.RunBatch(t.Context(), []Request{{Command: "echo again", WorkingDir: workDir, Stdout: &stdout}}, BatchOptions{})
+	assert.True(t, errors.Is(results[0].Err, ErrCommandDenied))
+	assert.Contains(t, results[0].Err.Error(), "rate limit")
+	assert.Equal(t, "", stdout.String())
+}
@@ -0,0 +1,103 @@
+package runner
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func newBinaryCheckRunner(t *testing.T, workDir string) (*SafeRunner, *bytes.Buffer) {
+	t.Helper()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "ls"}},
+		DefaultErrorMessage: "Command not allowed",
+		ResolveCommandPath:  true,
+	}
+	log := logger.New()
+	r := New(cfg, validator.New(cfg, log), log)
+	stdout := &bytes.Buffer{}
+	r.SetOutputs(stdout, &bytes.Buffer{})
+	return r, stdout
+}
+
+func TestResolveCommandPath(t *testing.T) {
+	workDir := t.TempDir()
+
+	// An attacker-controlled executable named like an allowlisted command
+	fakeLs := filepath.Join(workDir, "ls")
+	err := os.WriteFile(fakeLs, []byte("#!/bin/sh\necho impersonated\n"), 0o755) //nolint:gosec // test executable
+	assert.NoError(t, err)
+
+	t.Run("binary found through PATH outside trusted directories is blocked", func(t *testing.T) {
+		r, stdout := newBinaryCheckRunner(t, workDir)
+		result := r.RunCommand(t.Context(), "PATH="+workDir+" ls", workDir)
+		assert.Error(t, result.Err)
+		assert.NotContains(t, stdout.String(), "impersonated")
+	})
+
+	t.Run("binary in trusted directory runs", func(t *testing.T) {
+		r, stdout := newBinaryCheckRunner(t, workDir)
+		result := r.RunCommand(t.Context(), "ls", workDir)
+		assert.NoError(t, result.Err)
+		assert.Contains(t, stdout.String(), "ls")
+	})
+
+	t.Run("binary outside trusted directories is blocked", func(t *testing.T) {
+		r, stdout := newBinaryCheckRunner(t, workDir)
+		result := r.RunCommand(t.Context(), fakeLs, workDir)
+		assert.Error(t, result.Err)
+		assert.True(t, strings.Contains(result.Err.Error(), "outside of trusted binary directories"))
+		assert.NotContains(t, stdout.String(), "impersonated")
+	})
+}
+
+func TestBinaryChecksumPinning(t *testing.T) {
+	workDir := t.TempDir()
+	lsPath, err := exec.LookPath("ls")
+	assert.NoError(t, err)
+	lsContent, err := os.ReadFile(lsPath)
+	assert.NoError(t, err)
+	lsDigest := sha256.Sum256(lsContent)
+
+	tests := []struct {
+		name    string
+		digest  string
+		wantErr bool
+	}{
+		{name: "matching digest runs", digest: hex.EncodeToString(lsDigest[:]), wantErr: false},
+		{name: "mismatched digest is blocked", digest: strings.Repeat("0", 64), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.ShellCommandConfig{
+				AllowedDirectories:  []string{workDir},
+				AllowCommands:       []config.AllowCommand{{Command: "ls", Sha256: tt.digest}},
+				DefaultErrorMessage: "Command not allowed",
+			}
+			log := logger.New()
+			r := New(cfg, validator.New(cfg, log), log)
+			r.SetOutputs(&bytes.Buffer{}, &bytes.Buffer{})
+
+			result := r.RunCommand(t.Context(), "ls", workDir)
+			if tt.wantErr {
+				assert.Error(t, result.Err)
+				assert.Contains(t, result.Err.Error(), "checksum mismatch")
+			} else {
+				assert.NoError(t, result.Err)
+			}
+		})
+	}
+}
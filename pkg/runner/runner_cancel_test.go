@@ -0,0 +1,138 @@
+//go:build linux
+
+package runner
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/google/uuid"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestCancel(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "sh"}, {Command: "sleep"}, {Command: "echo"}, {Command: "wait"}, {Command: "trap"}, {Command: "true"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+		KillGracePeriod:     1,
+	}
+	log := logger.New()
+	r := New(cfg, validator.New(cfg, log), log)
+
+	// startBackground runs a script whose shell leaves a grandchild sleeping in the background
+	// and returns the grandchild's PID once it is known.
+	startBackground := func(t *testing.T, ctx context.Context, id, shellScript string) (int, <-chan RunResult) {
+		t.Helper()
+		pidFile := filepath.Join(workDir, id+".pid")
+		done := make(chan RunResult, 1)
+		go func() {
+			done <- r.Run(ctx, Request{
+				ID:         id,
+				Command:    `sh -c "` + shellScript + `; sleep 30 & echo \$! > ` + pidFile + `; wait"`,
+				WorkingDir: workDir,
+				Stdout:     &bytes.Buffer{},
+				Stderr:     &bytes.Buffer{},
+			})
+		}()
+		return waitForPID(t, pidFile), done
+	}
+
+	t.Run("cancel stops the process group", func(t *testing.T) {
+		pid, done := startBackground(t, t.Context(), "group", "true")
+
+		assert.True(t, r.Cancel("group"))
+		result := <-done
+		assert.Equal(t, "group", result.ID)
+		assert.Equal(t, ErrCanceled, result.Err)
+		waitForExit(t, pid, 5*time.Second)
+		assert.False(t, r.Cancel("group"))
+	})
+
+	t.Run("processes ignoring SIGTERM are killed after the grace period", func(t *testing.T) {
+		pid, done := startBackground(t, t.Context(), "ignore-term", "trap '' TERM")
+
+		start := time.Now()
+		assert.True(t, r.Cancel("ignore-term"))
+		result := <-done
+		assert.Equal(t, ErrCanceled, result.Err)
+		waitForExit(t, pid, 5*time.Second)
+		assert.True(t, time.Since(start) >= time.Second)
+	})
+
+	t.Run("context cancellation stops the process group", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		pid, done := startBackground(t, ctx, "context", "true")
+
+		cancel()
+		result := <-done
+		assert.Error(t, result.Err)
+		waitForExit(t, pid, 5*time.Second)
+	})
+
+	t.Run("active IDs cannot be reused", func(t *testing.T) {
+		_, done := startBackground(t, t.Context(), "duplicate", "true")
+
+		result := r.Run(t.Context(), Request{ID: "duplicate", Command: "echo", WorkingDir: workDir})
+		assert.Error(t, result.Err)
+		assert.Contains(t, result.Err.Error(), `run "duplicate" is already active`)
+
+		r.Cancel("duplicate")
+		<-done
+	})
+
+	t.Run("generated IDs are reported", func(t *testing.T) {
+		result := r.Run(t.Context(), Request{Command: "echo", WorkingDir: workDir})
+		assert.NoError(t, result.Err)
+		_, err := uuid.Parse(result.ID)
+		assert.NoError(t, err)
+	})
+}
+
+// waitForPID waits until the file contains a PID and returns it.
+func waitForPID(t *testing.T, path string) int {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if data, err := os.ReadFile(path); err == nil && strings.HasSuffix(string(data), "\n") {
+			pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+			assert.NoError(t, err)
+			return pid
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no PID written to %s", path)
+	return 0
+}
+
+// waitForExit waits until the process has exited, treating zombies as exited.
+func waitForExit(t *testing.T, pid int, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+		if err != nil {
+			return
+		}
+		// The state follows the parenthesized command name
+		if fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:])); len(fields) > 0 && fields[0] == "Z" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("process %d is still running", pid)
+}
@@ -0,0 +1,81 @@
+//go:build linux
+
+package runner
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+// writableCgroupParent returns a cgroup v2 directory the test can create cgroups in,
+// skipping the test when there is none.
+func writableCgroupParent(t *testing.T) string {
+	t.Helper()
+	for _, dir := range []string{"/sys/fs/cgroup", "/sys/fs/cgroup/unified"} {
+		if _, err := os.Stat(filepath.Join(dir, "cgroup.controllers")); err != nil {
+			continue
+		}
+		probe, err := os.MkdirTemp(dir, "secure-shell-probe-")
+		if err != nil {
+			continue
+		}
+		_ = os.Remove(probe)
+		return dir
+	}
+	t.Skip("no writable cgroup v2 hierarchy available")
+	return ""
+}
+
+func newCgroupTestRunner(t *testing.T, cgroup *config.CgroupConfig) (*SafeRunner, string) {
+	t.Helper()
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "sleep"},
+			{Command: "echo"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+		Cgroup:              cgroup,
+	}
+	log := logger.New()
+	r := New(cfg, validator.New(cfg, log), log)
+	r.SetOutputs(&bytes.Buffer{}, &bytes.Buffer{})
+	return r, workDir
+}
+
+func TestCgroup(t *testing.T) {
+	parent := writableCgroupParent(t)
+
+	t.Run("script runs in a transient cgroup that is removed afterwards", func(t *testing.T) {
+		r, workDir := newCgroupTestRunner(t, &config.CgroupConfig{Parent: parent})
+		before, _ := filepath.Glob(filepath.Join(parent, "secure-shell-*"))
+
+		result, err := r.RunCommandResult(t.Context(), "sleep 0; echo done", workDir)
+		assert.NoError(t, err)
+		assert.Equal(t, "done\n", result.Stdout)
+		assert.NotZero(t, result.CgroupUsage)
+		assert.True(t, result.CgroupUsage.CPUTime > 0)
+
+		after, _ := filepath.Glob(filepath.Join(parent, "secure-shell-*"))
+		assert.Equal(t, len(before), len(after))
+	})
+
+	t.Run("invalid limit fails before running the script", func(t *testing.T) {
+		r, workDir := newCgroupTestRunner(t, &config.CgroupConfig{Parent: parent, CPUMax: "bogus"})
+
+		result, err := r.RunCommandResult(t.Context(), "echo never", workDir)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "cgroup setup failed")
+		assert.Equal(t, "", result.Stdout)
+	})
+}
@@ -0,0 +1,117 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"mvdan.cc/sh/v3/interp"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestSetExecHandler(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+			{Command: "ls"},
+			{Command: "export"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	var calls []string
+	r.SetExecHandler(func(ctx context.Context, args []string) error {
+		hc := interp.HandlerCtx(ctx)
+		calls = append(calls, strings.Join(args, " "))
+		fmt.Fprintf(hc.Stdout, "%s in %s with NAME=%s\n", args[0], hc.Dir, hc.Env.Get("NAME").String())
+		return interp.NewExitStatus(4)
+	})
+
+	var stdout bytes.Buffer
+	result := r.Run(t.Context(), Request{
+		Command:    "export NAME=value; echo builtin; ls -l; rm -rf /",
+		WorkingDir: workDir,
+		Stdout:     &stdout,
+	})
+	// Builtins do not reach the handler, and blocked commands are rejected before it
+	assert.Error(t, result.Err)
+	assert.Contains(t, result.Err.Error(), "Command not allowed")
+	assert.Equal(t, []string{"ls -l"}, calls)
+	assert.Equal(t, "builtin\nls in "+workDir+" with NAME=value\n", stdout.String())
+	assert.Equal(t, 0, len(result.Processes))
+
+	// A nil handler restores the built-in one
+	r.SetExecHandler(nil)
+	result = r.Run(t.Context(), Request{Command: "ls", WorkingDir: workDir})
+	assert.NoError(t, result.Err)
+	assert.Equal(t, 1, len(calls))
+}
+
+func TestContainerExecHandler(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script as the container runtime")
+	}
+	workDir := t.TempDir()
+
+	// The fake runtime prints its arguments and the value of a variable passed by name
+	fakeRuntime := filepath.Join(t.TempDir(), "fake-runtime")
+	script := "#!/bin/sh\necho \"$@\"\necho \"NAME=$NAME\"\nexit 3\n"
+	assert.NoError(t, os.WriteFile(fakeRuntime, []byte(script), 0o755))
+
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "ls"},
+			{Command: "export"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+		Container: &config.ContainerConfig{
+			Runtime:   fakeRuntime,
+			Image:     "alpine:3",
+			User:      "1000:1000",
+			ExtraArgs: []string{"--memory=1g"},
+		},
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	var stdout bytes.Buffer
+	result := r.Run(t.Context(), Request{
+		Command:    "export NAME=value; ls -l",
+		WorkingDir: workDir,
+		Stdout:     &stdout,
+		Env:        []string{"PATH=/usr/bin:/bin"},
+	})
+	assert.Equal(t, 3, ExitCode(result.Err))
+
+	wantArgs := []string{
+		"run", "--rm", "-i", "--init", "--network", "none", "--workdir", workDir,
+		"--user", "1000:1000", "--volume", workDir + ":" + workDir, "--env", "NAME",
+		"--memory=1g", "alpine:3", "ls", "-l",
+	}
+	assert.Equal(t, strings.Join(wantArgs, " ")+"\nNAME=value\n", stdout.String())
+
+	t.Run("missing image", func(t *testing.T) {
+		cfg.Container.Image = ""
+		defer func() { cfg.Container.Image = "alpine:3" }()
+		result := r.Run(t.Context(), Request{Command: "ls", WorkingDir: workDir})
+		assert.Error(t, result.Err)
+		assert.Contains(t, result.Err.Error(), "container image is not configured")
+	})
+}
@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestSetEnv(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+			{Command: "printenv"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+	}
+	log := logger.New()
+
+	run := func(t *testing.T, r *SafeRunner, command string) string {
+		t.Helper()
+		stdout := &bytes.Buffer{}
+		r.SetOutputs(stdout, &bytes.Buffer{})
+		result := r.RunCommand(t.Context(), command, workDir)
+		assert.NoError(t, result.Err)
+		return stdout.String()
+	}
+
+	t.Run("injected variables reach builtins and external commands", func(t *testing.T) {
+		r := New(cfg, validator.New(cfg, log), log)
+		r.SetEnv([]string{"PATH=" + os.Getenv("PATH"), "GOFLAGS=-mod=mod", "LANG=C.UTF-8", "LANG=en_US.UTF-8"})
+
+		assert.Equal(t, "-mod=mod\n", run(t, r, "echo $GOFLAGS"))
+		assert.Equal(t, "en_US.UTF-8\n", run(t, r, "printenv LANG"))
+	})
+
+	t.Run("server environment is not inherited", func(t *testing.T) {
+		t.Setenv("SECURE_SHELL_TEST_VAR", "inherited")
+		t.Setenv("HOME", "/home/test")
+		r := New(cfg, validator.New(cfg, log), log)
+		assert.Equal(t, "\n", run(t, r, "echo $SECURE_SHELL_TEST_VAR"))
+		assert.Equal(t, "/home/test\n", run(t, r, "printenv HOME || echo"))
+
+		r.SetEnv([]string{"PATH=" + os.Getenv("PATH"), "SECURE_SHELL_TEST_VAR=set"})
+		assert.Equal(t, "set\n", run(t, r, "echo $SECURE_SHELL_TEST_VAR"))
+		assert.Equal(t, "\n", run(t, r, "printenv HOME || echo"))
+
+		r.SetEnv(nil)
+		assert.Equal(t, "\n", run(t, r, "echo $SECURE_SHELL_TEST_VAR"))
+	})
+
+	t.Run("passVars and inherit", func(t *testing.T) {
+		t.Setenv("SECURE_SHELL_TEST_VAR", "inherited")
+		t.Setenv("SECURE_SHELL_OTHER_VAR", "other")
+
+		passCfg := *cfg
+		passCfg.EnvPolicy = &config.EnvPolicy{PassVars: []string{"SECURE_SHELL_TEST_*"}}
+		r := New(&passCfg, validator.New(&passCfg, log), log)
+		assert.Equal(t, "inherited-\n", run(t, r, "echo $SECURE_SHELL_TEST_VAR-$SECURE_SHELL_OTHER_VAR"))
+
+		inheritCfg := *cfg
+		inheritCfg.EnvPolicy = &config.EnvPolicy{Inherit: true}
+		r = New(&inheritCfg, validator.New(&inheritCfg, log), log)
+		assert.Equal(t, "inherited-other\n", run(t, r, "echo $SECURE_SHELL_TEST_VAR-$SECURE_SHELL_OTHER_VAR"))
+	})
+
+	t.Run("default policy drops loader variables", func(t *testing.T) {
+		r := New(cfg, validator.New(cfg, log), log)
+		r.SetEnv([]string{"LD_PRELOAD=/tmp/evil.so", "FOO=bar", "malformed"})
+
+		assert.Equal(t, []string{"FOO=bar"}, r.env)
+	})
+
+	t.Run("allow list restricts variables", func(t *testing.T) {
+		policyCfg := *cfg
+		policyCfg.EnvPolicy = &config.EnvPolicy{AllowVars: []string{"PATH", "LC_*"}, DenyVars: []string{"LC_SECRET"}}
+		r := New(&policyCfg, validator.New(&policyCfg, log), log)
+		r.SetEnv([]string{"PATH=/usr/bin", "LC_ALL=C", "LC_SECRET=x", "GOPATH=/go", "LD_PRELOAD=/tmp/evil.so"})
+
+		assert.Equal(t, []string{"PATH=/usr/bin", "LC_ALL=C"}, r.env)
+	})
+}
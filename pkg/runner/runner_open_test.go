@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestRunRedirectionPolicy(t *testing.T) {
+	root := t.TempDir()
+	workDir := filepath.Join(root, "work")
+	siblingDir := filepath.Join(root, "work-other")
+	vendorDir := filepath.Join(workDir, "vendor")
+	for _, dir := range []string{vendorDir, siblingDir} {
+		assert.NoError(t, os.MkdirAll(dir, 0o755))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(vendorDir, "lib.txt"), []byte("vendored\n"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(workDir, ".env"), []byte("TOKEN=secret\n"), 0o644))
+
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+			{Command: "cd"},
+			{Command: "read"},
+		},
+		DenyPaths:           []string{filepath.Join(workDir, ".env")},
+		ReadOnlyDirectories: []string{vendorDir},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	run := func(command string) (string, error) {
+		var stdout, stderr bytes.Buffer
+		result := r.Run(t.Context(), Request{Command: command, WorkingDir: workDir, Stdout: &stdout, Stderr: &stderr})
+		return stdout.String() + stderr.String(), result.Err
+	}
+
+	tests := []struct {
+		name     string
+		command  string
+		wantErr  bool
+		contains string
+	}{
+		{name: "write in allowed directory", command: "echo ok > out.txt && read line < out.txt && echo $line", contains: "ok\n"},
+		{name: "relative path after cd", command: "cd vendor && read line < lib.txt && echo $line", contains: "vendored\n"},
+		{name: "write in read-only directory", command: "echo x > vendor/new.txt", wantErr: true, contains: "read-only directory"},
+		{name: "append in read-only directory", command: "cd vendor && echo x >> lib.txt", wantErr: true, contains: "read-only directory"},
+		{name: "read denied file", command: "read line < .env", wantErr: true, contains: "is denied by"},
+		{name: "sibling directory sharing a prefix", command: "echo x > ../work-other/out.txt", wantErr: true, contains: "outside of allowed directories"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := run(tt.command)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Contains(t, output, tt.contains)
+		})
+	}
+
+	_, err := os.Stat(filepath.Join(vendorDir, "new.txt"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(siblingDir, "out.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
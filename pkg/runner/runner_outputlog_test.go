@@ -0,0 +1,121 @@
+package runner
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestRunOutputLog(t *testing.T) {
+	workDir := t.TempDir()
+	logDir := filepath.Join(t.TempDir(), "output")
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxOutputSize:       16,
+		OutputLogDir:        logDir,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	long := strings.Repeat("x", 100)
+	var stdout, stderr bytes.Buffer
+	result := r.Run(t.Context(), Request{
+		ID:         "run-1",
+		Command:    "echo " + long + "; echo err >&2",
+		WorkingDir: workDir,
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	})
+	assert.NoError(t, result.Err)
+	assert.True(t, result.Stdout.Truncated)
+	assert.Equal(t, filepath.Join(logDir, "run-1.stdout.log"), result.StdoutLog)
+	assert.Equal(t, filepath.Join(logDir, "run-1.stderr.log"), result.StderrLog)
+
+	// The log holds the output the limiter dropped
+	data, err := os.ReadFile(result.StdoutLog)
+	assert.NoError(t, err)
+	assert.Equal(t, long+"\n", string(data))
+	data, err = os.ReadFile(result.StderrLog)
+	assert.NoError(t, err)
+	assert.Equal(t, "err\n", string(data))
+
+	info, err := os.Stat(result.StdoutLog)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(outputLogPermissions), info.Mode().Perm())
+
+	t.Run("existing files are not overwritten", func(t *testing.T) {
+		result := r.Run(t.Context(), Request{ID: "run-1", Command: "echo again", WorkingDir: workDir})
+		assert.NoError(t, result.Err)
+		assert.Equal(t, "", result.StdoutLog)
+		data, err := os.ReadFile(filepath.Join(logDir, "run-1.stdout.log"))
+		assert.NoError(t, err)
+		assert.Equal(t, long+"\n", string(data))
+	})
+
+	t.Run("run IDs that are not file names", func(t *testing.T) {
+		result := r.Run(t.Context(), Request{ID: "../escape", Command: "echo hi", WorkingDir: workDir})
+		assert.NoError(t, result.Err)
+		assert.Equal(t, "", result.StdoutLog)
+		_, err := os.Stat(filepath.Join(filepath.Dir(logDir), "escape.stdout.log"))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestRunSpool(t *testing.T) {
+	workDir := t.TempDir()
+	spoolDir := filepath.Join(t.TempDir(), "spool")
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxOutputSize:       16,
+		SpoolDir:            spoolDir,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	long := strings.Repeat("x", 100)
+	var stdout bytes.Buffer
+	result := r.Run(t.Context(), Request{
+		ID:         "run-1",
+		Command:    "echo " + long + "; echo err >&2",
+		WorkingDir: workDir,
+		Stdout:     &stdout,
+		Stderr:     io.Discard,
+	})
+	assert.NoError(t, result.Err)
+
+	// Only the truncated stream is kept, and the truncation message names it
+	assert.Equal(t, filepath.Join(spoolDir, "run-1.stdout.log"), result.StdoutLog)
+	assert.Equal(t, "", result.StderrLog)
+	assert.Contains(t, stdout.String(), "The complete output is saved in "+result.StdoutLog)
+	_, err := os.Stat(filepath.Join(spoolDir, "run-1.stderr.log"))
+	assert.True(t, os.IsNotExist(err))
+
+	f, err := r.OpenOutputLog(filepath.Base(result.StdoutLog))
+	assert.NoError(t, err)
+	data, err := io.ReadAll(f)
+	assert.NoError(t, f.Close())
+	assert.NoError(t, err)
+	assert.Equal(t, long+"\n", string(data))
+
+	for _, name := range []string{"", "..", "../run-1.stdout.log", "run-1.stdout"} {
+		_, err := r.OpenOutputLog(name)
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,77 @@
+//go:build linux
+
+package runner
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestPTY(t *testing.T) {
+	workDir := t.TempDir()
+	const probe = `sh -c "test -t 0 && test -t 1 && test -t 2 && echo terminal; printenv TERM; stty size; echo err >&2; exit 3"`
+
+	newRunner := func(pty bool, ptyConfig *config.PTYConfig) *SafeRunner {
+		cfg := &config.ShellCommandConfig{
+			AllowedDirectories: []string{workDir},
+			AllowCommands: []config.AllowCommand{
+				{Command: "sh", PTY: pty},
+				{Command: "echo"}, {Command: "printenv"}, {Command: "test"}, {Command: "stty"}, {Command: "exit"}, {Command: "sleep"},
+			},
+			DefaultErrorMessage: "Command not allowed",
+			MaxExecutionTime:    30,
+			PTY:                 ptyConfig,
+		}
+		log := logger.New()
+		return New(cfg, validator.New(cfg, log), log)
+	}
+
+	t.Run("command runs on a terminal with the default settings", func(t *testing.T) {
+		r := newRunner(true, nil)
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		r.SetOutputs(stdout, stderr)
+
+		result := r.RunCommand(t.Context(), probe, workDir)
+		assert.Equal(t, 3, ExitCode(result.Err))
+		assert.Equal(t, "terminal\nxterm-256color\n24 80\nerr\n", stdout.String())
+		assert.Equal(t, "", stderr.String())
+	})
+
+	t.Run("TERM and window size are configurable", func(t *testing.T) {
+		r := newRunner(true, &config.PTYConfig{Term: "dumb", Rows: 50, Cols: 132})
+		stdout := &bytes.Buffer{}
+		r.SetOutputs(stdout, &bytes.Buffer{})
+
+		r.RunCommand(t.Context(), probe, workDir)
+		assert.Equal(t, "terminal\ndumb\n50 132\nerr\n", stdout.String())
+	})
+
+	t.Run("command without pty runs on pipes", func(t *testing.T) {
+		r := newRunner(false, nil)
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		r.SetOutputs(stdout, stderr)
+
+		r.RunCommand(t.Context(), probe, workDir)
+		assert.NotContains(t, stdout.String(), "terminal")
+		assert.Contains(t, stderr.String(), "err\n")
+	})
+
+	t.Run("background processes do not keep the command running", func(t *testing.T) {
+		r := newRunner(true, nil)
+		stdout := &bytes.Buffer{}
+		r.SetOutputs(stdout, &bytes.Buffer{})
+
+		start := time.Now()
+		result := r.RunCommand(t.Context(), `sh -c "sleep 30 & echo started"`, workDir)
+		assert.NoError(t, result.Err)
+		assert.Equal(t, "started\n", stdout.String())
+		assert.True(t, time.Since(start) < 10*time.Second)
+	})
+}
@@ -0,0 +1,55 @@
+//go:build linux
+
+package runner
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestResourceLimits(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "sh"},
+			{Command: "sleep"},
+			{Command: "ulimit"},
+			{Command: "exit"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+		ResourceLimits:      &config.ResourceLimits{CPUSeconds: 5, OpenFiles: 64},
+	}
+	log := logger.New()
+	r := New(cfg, validator.New(cfg, log), log)
+
+	tests := []struct {
+		name     string
+		command  string
+		output   string
+		exitCode int
+	}{
+		// The limits are in place when the command starts
+		{name: "open files limit", command: `sh -c "ulimit -n"`, output: "64\n"},
+		{name: "cpu limit", command: `sh -c "ulimit -t"`, output: "5\n"},
+		{name: "exit status is preserved", command: `sh -c "exit 3"`, exitCode: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			r.SetOutputs(stdout, &bytes.Buffer{})
+
+			result := r.RunCommand(t.Context(), tt.command, workDir)
+			assert.Equal(t, tt.exitCode, ExitCode(result.Err))
+			assert.Equal(t, tt.output, stdout.String())
+		})
+	}
+}
@@ -0,0 +1,488 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestRunConcurrent(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+			{Command: "sh"},
+			{Command: "cd"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+		MaxOutputSize:       64,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	const runs = 20
+	results := make([]RunResult, runs)
+	stdouts := make([]bytes.Buffer, runs)
+	stderrs := make([]bytes.Buffer, runs)
+	var wg sync.WaitGroup
+	for i := range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Every other run produces more output than MaxOutputSize
+			repeat := 1
+			if i%2 == 1 {
+				repeat = 10
+			}
+			results[i] = r.Run(t.Context(), Request{
+				Command:    fmt.Sprintf(`cd %s; sh -c "echo run-$ID-%s"; echo err-$ID >&2`, workDir, strings.Repeat("x", 10*repeat)),
+				WorkingDir: workDir,
+				Stdout:     &stdouts[i],
+				Stderr:     &stderrs[i],
+				Env:        []string{fmt.Sprintf("ID=%d", i), "PATH=/usr/bin:/bin"},
+			})
+		}()
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		assert.NoError(t, result.Err)
+		assert.Equal(t, fmt.Sprintf("err-%d\n", i), stderrs[i].String())
+		assert.True(t, strings.HasPrefix(stdouts[i].String(), fmt.Sprintf("run-%d-", i)))
+		assert.Equal(t, i%2 == 1, result.Stdout.Truncated)
+		assert.False(t, result.Stderr.Truncated)
+		assert.Equal(t, workDir, result.NewWorkDir)
+		assert.Equal(t, 1, len(result.Hints))
+		assert.Equal(t, []ExecutedCommand{
+			{Name: "sh", Args: []string{"-c", fmt.Sprintf("echo run-%d-%s", i, strings.Repeat("x", 10*(1+9*(i%2))))}},
+			{Name: "echo", Args: []string{fmt.Sprintf("err-%d", i)}},
+		}, result.Commands)
+	}
+}
+
+func TestRunOutputStats(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+		MaxOutputSize:       5,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	result := r.Run(t.Context(), Request{Command: "echo 0123456789; echo err >&2", WorkingDir: workDir})
+	assert.NoError(t, result.Err)
+	assert.Equal(t, OutputStats{Bytes: 11, Truncated: true, RemainingBytes: 6}, result.Stdout)
+	assert.Equal(t, OutputStats{Bytes: 4}, result.Stderr)
+	assert.True(t, r.WasOutputTruncated())
+}
+
+func TestRunCreateWorkingDir(t *testing.T) {
+	workDir := t.TempDir()
+	outside := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "pwd"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	newDir := filepath.Join(workDir, "a", "b")
+
+	// Missing directories are not created by default
+	result := r.Run(t.Context(), Request{Command: "pwd", WorkingDir: newDir})
+	assert.Error(t, result.Err)
+	_, err := os.Stat(newDir)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	var stdout bytes.Buffer
+	result = r.Run(t.Context(), Request{Command: "pwd", WorkingDir: newDir, Stdout: &stdout, CreateWorkingDir: true})
+	assert.NoError(t, result.Err)
+	assert.Equal(t, newDir+"\n", stdout.String())
+	info, err := os.Stat(newDir)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0), info.Mode().Perm()&0o007)
+
+	// Directories outside the allowed directories are never created, even through a symlink
+	assert.NoError(t, os.Symlink(outside, filepath.Join(workDir, "link")))
+	for _, dir := range []string{filepath.Join(outside, "new"), filepath.Join(workDir, "link", "new")} {
+		result = r.Run(t.Context(), Request{Command: "pwd", WorkingDir: dir, CreateWorkingDir: true})
+		assert.Error(t, result.Err)
+		_, err = os.Stat(filepath.Join(outside, "new"))
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+	}
+
+	// The configuration enables it for every run
+	cfg.CreateWorkingDir = true
+	result = r.Run(t.Context(), Request{Command: "pwd", WorkingDir: filepath.Join(workDir, "c")})
+	assert.NoError(t, result.Err)
+}
+
+func TestRunWorkDir(t *testing.T) {
+	workDir := t.TempDir()
+	subDir := filepath.Join(workDir, "sub")
+	assert.NoError(t, os.Mkdir(subDir, 0o750))
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "cd"}, {Command: "false"}},
+		DefaultErrorMessage: "Command not allowed",
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{command: "true", want: workDir},
+		{command: "cd sub", want: subDir},
+		{command: "cd sub; cd " + workDir, want: workDir},
+		{command: "(cd sub)", want: workDir},
+		{command: "cd sub; false", want: subDir},
+	}
+	for _, tt := range tests {
+		result := r.Run(t.Context(), Request{Command: tt.command, WorkingDir: workDir})
+		assert.Equal(t, tt.want, result.WorkDir, tt.command)
+	}
+
+	result := r.Run(t.Context(), Request{Command: "echo x", WorkingDir: filepath.Join(t.TempDir(), "outside")})
+	assert.Equal(t, "", result.WorkDir)
+}
+
+func TestRunMaxOutputLines(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "seq"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxOutputSize:       1024,
+		MaxOutputLines:      3,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	var stdout bytes.Buffer
+	result := r.Run(t.Context(), Request{Command: "seq 10", WorkingDir: workDir, Stdout: &stdout})
+	assert.NoError(t, result.Err)
+	assert.True(t, result.Stdout.Truncated)
+	assert.Equal(t, 21, result.Stdout.Bytes)
+	assert.Equal(t, 15, result.Stdout.RemainingBytes)
+	assert.True(t, strings.HasPrefix(stdout.String(), "1\n2\n3\n\n\n[Output truncated, exceeded 3 lines limit."))
+}
+
+func TestRunStreamSizeLimits(t *testing.T) {
+	workDir := t.TempDir()
+	stdoutSize, stderrSize := 8, 64
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "seq"}, {Command: "echo"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxOutputSize:       1024,
+		MaxStdoutSize:       &stdoutSize,
+		MaxStderrSize:       &stderrSize,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	var stdout, stderr bytes.Buffer
+	result := r.Run(t.Context(), Request{
+		Command:    "seq 100; echo failed >&2",
+		WorkingDir: workDir,
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+	})
+	assert.NoError(t, result.Err)
+	assert.True(t, result.Stdout.Truncated)
+	assert.True(t, strings.HasPrefix(stdout.String(), "1\n2\n3\n4\n\n\n[Output truncated, exceeded 8 bytes limit."))
+	assert.False(t, result.Stderr.Truncated)
+	assert.Equal(t, "failed\n", stderr.String())
+}
+
+func TestRunStripANSI(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "printf"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxOutputSize:       4,
+		StripANSI:           true,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	var stdout bytes.Buffer
+	result := r.Run(t.Context(), Request{Command: `printf '\033[32mok\033[0m\n'`, WorkingDir: workDir, Stdout: &stdout})
+	assert.NoError(t, result.Err)
+	assert.False(t, result.Stdout.Truncated)
+	assert.Equal(t, "ok\n", stdout.String())
+}
+
+func TestRunLogsRunID(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}},
+		DefaultErrorMessage: "Command not allowed",
+	}
+	var logs bytes.Buffer
+	log := logger.NewWithWriter(&logs)
+	log.SetFormat(logger.FormatJSON)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	result := r.Run(t.Context(), Request{ID: "run-1", Command: "echo hi; rm x", WorkingDir: workDir})
+	assert.Error(t, result.Err)
+
+	var decisions []string
+	for line := range strings.Lines(logs.String()) {
+		var entry logger.Entry
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		if entry.Event == logger.EventCommand {
+			assert.Equal(t, "run-1", entry.RunID)
+			decisions = append(decisions, entry.Command+" "+entry.Decision)
+		}
+	}
+	assert.Equal(t, []string{"echo allowed", "rm blocked"}, decisions)
+}
+
+func TestRunBlockLog(t *testing.T) {
+	workDir := t.TempDir()
+	blockLog := filepath.Join(t.TempDir(), "blocked.log")
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}},
+		DefaultErrorMessage: "Command not allowed",
+		BlockLogPath:        blockLog,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	result := r.Run(t.Context(), Request{ID: "run-1", Client: "session-1", Command: "rm x", WorkingDir: workDir})
+	assert.Error(t, result.Err)
+
+	data, err := os.ReadFile(blockLog)
+	assert.NoError(t, err)
+	var record validator.BlockRecord
+	assert.NoError(t, json.Unmarshal(data, &record))
+	assert.Equal(t, "rm", record.Command)
+	assert.Equal(t, []string{"x"}, record.Args)
+	assert.Equal(t, validator.CodeCommandNotAllowed, record.Code)
+	assert.Equal(t, workDir, record.WorkDir)
+	assert.Equal(t, "session-1", record.Client)
+	assert.Equal(t, "run-1", record.RunID)
+}
+
+func TestRunOutputModes(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "seq"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxOutputLines:      2,
+		OutputMode:          config.OutputModeTail,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	var stdout bytes.Buffer
+	result := r.Run(t.Context(), Request{Command: "seq 10", WorkingDir: workDir, Stdout: &stdout})
+	assert.NoError(t, result.Err)
+	assert.True(t, result.Stdout.Truncated)
+	assert.Equal(t, 16, result.Stdout.RemainingBytes)
+	assert.Equal(t, "[Output truncated, exceeded 2 lines limit. The first 16 bytes were omitted]\n9\n10\n", stdout.String())
+
+	cfg.OutputMode = config.OutputModeHeadTail
+	stdout.Reset()
+	result = r.Run(t.Context(), Request{Command: "seq 10", WorkingDir: workDir, Stdout: &stdout})
+	assert.NoError(t, result.Err)
+	assert.Equal(t, 16, result.Stdout.RemainingBytes)
+	assert.Equal(t, "1\n[... 16 bytes omitted ...]\n10\n", stdout.String())
+
+	cfg.OutputMode = "middle"
+	result = r.Run(t.Context(), Request{Command: "seq 10", WorkingDir: workDir})
+	assert.EqualError(t, result.Err, `unknown output mode "middle"`)
+}
+
+func TestRunStdin(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "sort"}, {Command: "read"}, {Command: "echo"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	t.Run("external command reads stdin", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		result := r.Run(t.Context(), Request{Command: "sort", WorkingDir: workDir, Stdin: strings.NewReader("b\na\n"), Stdout: stdout})
+		assert.NoError(t, result.Err)
+		assert.Equal(t, "a\nb\n", stdout.String())
+	})
+
+	t.Run("builtins read stdin", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		result := r.Run(t.Context(), Request{Command: `read line; echo "got $line"`, WorkingDir: workDir, Stdin: strings.NewReader("hello\n"), Stdout: stdout})
+		assert.NoError(t, result.Err)
+		assert.Equal(t, "got hello\n", stdout.String())
+	})
+
+	t.Run("no stdin reads as empty", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		result := r.Run(t.Context(), Request{Command: "sort", WorkingDir: workDir, Stdout: stdout})
+		assert.NoError(t, result.Err)
+		assert.Equal(t, "", stdout.String())
+	})
+}
+
+func TestRunMaxOutputSize(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+		MaxOutputSize:       10,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	tests := []struct {
+		name      string
+		max       int
+		wantBytes int
+	}{
+		{name: "lower limit applies", max: 4, wantBytes: 4},
+		{name: "higher limit is ignored", max: 100, wantBytes: 10},
+		{name: "zero keeps the configured limit", max: 0, wantBytes: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := r.Run(t.Context(), Request{Command: "echo 0123456789abcdef", WorkingDir: workDir, MaxOutputSize: tt.max})
+			assert.NoError(t, result.Err)
+			assert.True(t, result.Stdout.Truncated)
+			assert.Equal(t, 17-tt.wantBytes, result.Stdout.RemainingBytes)
+		})
+	}
+}
+
+func TestRunPreflight(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+			{Command: "touch", RateLimit: &config.RateLimit{Count: 1, Per: "1h"}},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	// Without preflight, the commands before the blocked one run
+	var stdout bytes.Buffer
+	result := r.Run(t.Context(), Request{Command: "echo ok; rm -rf build", WorkingDir: workDir, Stdout: &stdout})
+	assert.True(t, errors.Is(result.Err, ErrCommandDenied))
+	assert.Equal(t, "ok\n", stdout.String())
+
+	stdout.Reset()
+	result = r.Run(t.Context(), Request{Command: "echo ok; rm -rf build", WorkingDir: workDir, Stdout: &stdout, Preflight: true})
+	var denied *CommandDeniedError
+	assert.True(t, errors.As(result.Err, &denied))
+	assert.Equal(t, "rm", denied.Result.Command)
+	assert.Equal(t, "", stdout.String())
+	assert.Equal(t, 0, len(result.Commands))
+
+	// The check does not use up the rate limits of the commands it lets run
+	result = r.Run(t.Context(), Request{Command: "touch a", WorkingDir: workDir, Preflight: true})
+	assert.NoError(t, result.Err)
+
+	// The configuration enables it for every run
+	cfg.PreflightValidation = true
+	stdout.Reset()
+	result = r.Run(t.Context(), Request{Command: "echo ok\nrm -rf build", WorkingDir: workDir, Stdout: &stdout})
+	assert.True(t, errors.Is(result.Err, ErrCommandDenied))
+	assert.Equal(t, "", stdout.String())
+}
+
+func TestRunSteps(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}, {Command: "false"}, {Command: "true"}, {Command: "exit"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	// statuses returns the command and status of each step of result
+	statuses := func(result RunResult) []string {
+		var out []string
+		for _, step := range result.Steps {
+			out = append(out, step.Command+": "+step.Status)
+		}
+		return out
+	}
+
+	t.Run("continues after a failing command by default", func(t *testing.T) {
+		var stdout bytes.Buffer
+		result := r.Run(t.Context(), Request{Command: "echo one\nfalse; echo two", WorkingDir: workDir, Stdout: &stdout})
+		assert.NoError(t, result.Err)
+		assert.Equal(t, "one\ntwo\n", stdout.String())
+		assert.Equal(t, []string{"echo one: succeeded", "false: failed", "echo two: succeeded"}, statuses(result))
+		assert.Equal(t, 1, result.Steps[1].ExitCode)
+	})
+
+	t.Run("stops at the first failing command", func(t *testing.T) {
+		var stdout bytes.Buffer
+		result := r.Run(t.Context(), Request{Command: "echo one\nfalse; echo two", WorkingDir: workDir, Stdout: &stdout, StopOnError: true})
+		assert.Equal(t, 1, ExitCode(result.Err))
+		assert.Equal(t, "one\n", stdout.String())
+		assert.Equal(t, []string{"echo one: succeeded", "false: failed", "echo two: skipped"}, statuses(result))
+		assert.Equal(t, ExitCodeNotRun, result.Steps[2].ExitCode)
+
+		// Conditions do not stop the script
+		result = r.Run(t.Context(), Request{Command: "false || echo handled\nif false; then true; fi", WorkingDir: workDir, StopOnError: true})
+		assert.NoError(t, result.Err)
+		assert.Equal(t, []string{"false || echo handled: succeeded", "if false; then true; fi: succeeded"}, statuses(result))
+	})
+
+	t.Run("the configuration stops every run", func(t *testing.T) {
+		cfg.StopOnError = true
+		defer func() { cfg.StopOnError = false }()
+		result := r.Run(t.Context(), Request{Command: "false; echo two", WorkingDir: workDir})
+		assert.Equal(t, []string{"false: failed", "echo two: skipped"}, statuses(result))
+	})
+
+	t.Run("a blocked command or exit stops the script", func(t *testing.T) {
+		result := r.Run(t.Context(), Request{Command: "echo one; rm -rf build; echo two", WorkingDir: workDir})
+		assert.True(t, errors.Is(result.Err, ErrCommandDenied))
+		assert.Equal(t, []string{"echo one: succeeded", "rm -rf build: error", "echo two: skipped"}, statuses(result))
+		assert.Equal(t, result.Err.Error(), result.Steps[1].Error)
+
+		result = r.Run(t.Context(), Request{Command: "exit 3; echo two", WorkingDir: workDir})
+		assert.Equal(t, 3, ExitCode(result.Err))
+		assert.Equal(t, []string{"exit 3: failed", "echo two: skipped"}, statuses(result))
+	})
+}
@@ -0,0 +1,53 @@
+package runner
+
+import (
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestRunProcessUsage(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses sh")
+	}
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+			{Command: "sh"},
+			{Command: "kill"},
+			{Command: "exit"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	result := r.Run(t.Context(), Request{
+		Command:    `echo builtin; sh -c 'exit 2'; sh -c 'kill -9 $$'`,
+		WorkingDir: workDir,
+		Env:        []string{"PATH=/usr/bin:/bin"},
+	})
+	assert.Error(t, result.Err)
+
+	// Builtins run no process
+	assert.Equal(t, 2, len(result.Processes))
+	exited, killed := result.Processes[0], result.Processes[1]
+	assert.Equal(t, "sh", exited.Name)
+	assert.Equal(t, []string{"-c", "exit 2"}, exited.Args)
+	assert.Equal(t, 2, exited.ExitCode)
+	assert.True(t, exited.PID > 0)
+	assert.True(t, exited.UserTime >= 0 && exited.SystemTime >= 0)
+	if runtime.GOOS == "linux" {
+		assert.True(t, exited.MaxRSSBytes > 0)
+	}
+	assert.Equal(t, -1, killed.ExitCode)
+}
@@ -0,0 +1,96 @@
+//go:build linux
+
+package runner
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+// sandboxProbeScript reports what a command can see from inside the sandbox.
+const sandboxProbeScript = `ls /
+echo "pid=$$"
+test -e /etc/passwd && echo "etc-visible"
+touch /usr/probe 2>/dev/null || echo "usr-read-only"
+grep -c : /proc/net/dev
+echo data > written.txt
+`
+
+func TestSandbox(t *testing.T) {
+	workDir := t.TempDir()
+
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+		Sandbox:             &config.SandboxConfig{},
+	}
+	// The probe looks outside the allowed directories on purpose: only the sandbox stops it
+	validatorCfg := *cfg
+	validatorCfg.AllowedDirectories = []string{"/"}
+	for _, command := range []string{"sh", "ls", "echo", "test", "touch", "grep"} {
+		validatorCfg.AllowCommands = append(validatorCfg.AllowCommands, config.AllowCommand{Command: command})
+	}
+	log := logger.New()
+	r := New(cfg, validator.New(&validatorCfg, log), log)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	r.SetOutputs(stdout, stderr)
+
+	result := r.RunCommand(t.Context(), "sh -c '"+sandboxProbeScript+"'", workDir)
+	if result.Err != nil && strings.Contains(result.Err.Error(), "failed to start isolated command") {
+		t.Skipf("namespaces are not available: %v", result.Err)
+	}
+	assert.NoError(t, result.Err, stderr.String())
+
+	output := stdout.String()
+	entries := strings.Fields(output[:strings.Index(output, "pid=")])
+	assert.NotSliceContains(t, entries, "etc")
+	assert.NotSliceContains(t, entries, "root")
+	assert.SliceContains(t, entries, "usr")
+	assert.SliceContains(t, entries, "tmp")
+
+	assert.Contains(t, output, "pid=1\n")
+	assert.NotContains(t, output, "etc-visible")
+	assert.Contains(t, output, "usr-read-only")
+	// Only the loopback interface exists in the new network namespace
+	assert.Contains(t, output, "usr-read-only\n1\n")
+
+	written, err := os.ReadFile(filepath.Join(workDir, "written.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "data\n", string(written))
+}
+
+func TestSandboxWithSeccomp(t *testing.T) {
+	workDir := t.TempDir()
+
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "ls"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+		Sandbox:             &config.SandboxConfig{},
+		// The default filter denies mount, which the sandbox needs before the filter is installed
+		Seccomp: &config.SeccompConfig{},
+	}
+	log := logger.New()
+	r := New(cfg, validator.New(cfg, log), log)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	r.SetOutputs(stdout, stderr)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(workDir, "file.txt"), nil, 0o644))
+	result := r.RunCommand(t.Context(), "ls", workDir)
+	if result.Err != nil && strings.Contains(result.Err.Error(), "failed to start isolated command") {
+		t.Skipf("namespaces are not available: %v", result.Err)
+	}
+	assert.NoError(t, result.Err, stderr.String())
+	assert.Equal(t, "file.txt\n", stdout.String())
+}
@@ -0,0 +1,137 @@
+//go:build linux
+
+package runner
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestRunScriptFile(t *testing.T) {
+	workDir := t.TempDir()
+	outsideDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+			{Command: "cat"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+		MaxScriptSize:       256,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	writeScript := func(dir, name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+	run := func(path string, args ...string) (string, error) {
+		t.Helper()
+		var stdout bytes.Buffer
+		r.SetOutputs(&stdout, &stdout)
+		result := r.RunScriptFile(t.Context(), path, args, workDir)
+		return stdout.String(), result.Err
+	}
+
+	writeScript(workDir, "greet.sh", "#!/bin/sh\necho \"hello $1 ($#)\"\n")
+	writeScript(workDir, "blocked.sh", "echo before\nrm -rf /\n")
+	writeScript(workDir, "large.sh", "echo "+strings.Repeat("x", 300)+"\n")
+	writeScript(workDir, "binary.sh", "echo \x00\n")
+	writeScript(workDir, "tool.py", "#!/usr/bin/env python3\nprint('hi')\n")
+	outside := writeScript(outsideDir, "outside.sh", "echo outside\n")
+
+	t.Run("runs with positional parameters", func(t *testing.T) {
+		output, err := run("greet.sh", "world", "again")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello world (2)\n", output)
+	})
+
+	t.Run("commands are validated", func(t *testing.T) {
+		output, err := run("blocked.sh")
+		assert.Error(t, err)
+		assert.Equal(t, "before\n", output)
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		contains string
+	}{
+		{name: "outside allowed directories", path: outside, contains: "outside of allowed directories"},
+		{name: "too large", path: "large.sh", contains: "more than the limit of 256"},
+		{name: "NUL bytes", path: "binary.sh", contains: "contains NUL bytes"},
+		{name: "directory", path: ".", contains: "not a regular file"},
+		{name: "missing", path: "missing.sh", contains: "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := run(tt.path)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.contains)
+		})
+	}
+
+	t.Run("FIFO is not read", func(t *testing.T) {
+		fifo := filepath.Join(workDir, "fifo.sh")
+		assert.NoError(t, syscall.Mkfifo(fifo, 0o600))
+		_, err := run(fifo)
+		assert.Error(t, err)
+	})
+
+	t.Run("shebang policies", func(t *testing.T) {
+		defer func() { cfg.Shebang = "" }()
+
+		// By default the shebang line is a comment
+		output, err := run("greet.sh", "default")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello default (1)\n", output)
+
+		cfg.Shebang = config.ShebangReject
+		_, err = run("greet.sh")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "starts with a shebang line")
+
+		// Honored shell shebangs run in the built-in shell, other interpreters must be allowed
+		cfg.Shebang = config.ShebangHonor
+		output, err = run("greet.sh", "honored")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello honored (1)\n", output)
+		_, err = run("tool.py")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Command not allowed")
+	})
+}
+
+func TestParseShebang(t *testing.T) {
+	tests := []struct {
+		script string
+		want   []string
+	}{
+		{script: "#!/bin/sh\necho", want: []string{"/bin/sh"}},
+		{script: "#! /bin/bash -e\n", want: []string{"/bin/bash", "-e"}},
+		{script: "#!/usr/bin/env python3\n", want: []string{"python3"}},
+		{script: "#!/usr/bin/env\n", want: []string{"/usr/bin/env"}},
+		{script: "#!\necho", want: nil},
+		{script: "echo\n#!/bin/sh", want: nil},
+	}
+	for _, tt := range tests {
+		got, ok := parseShebang(tt.script)
+		assert.Equal(t, tt.want != nil, ok)
+		assert.Equal(t, tt.want, got)
+	}
+}
@@ -0,0 +1,69 @@
+//go:build linux && (amd64 || arm64)
+
+package runner
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"golang.org/x/sys/unix"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestSeccomp(t *testing.T) {
+	workDir := t.TempDir()
+
+	tests := []struct {
+		name         string
+		denySyscalls []string
+		command      string
+		exitCode     int
+		stdout       string
+		stderr       string
+	}{
+		{
+			name:    "default filter runs ordinary commands",
+			command: "uname -s",
+			stdout:  "Linux\n",
+		},
+		{
+			name:         "denied system call fails with EPERM",
+			denySyscalls: []string{strconv.Itoa(unix.SYS_UNAME)},
+			command:      "uname -s",
+			exitCode:     1,
+			stderr:       "Operation not permitted",
+		},
+		{
+			name:         "unknown system call name is rejected",
+			denySyscalls: []string{"no_such_syscall"},
+			command:      "uname -s",
+			exitCode:     ExitCodeNotRun,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.ShellCommandConfig{
+				AllowedDirectories:  []string{workDir},
+				AllowCommands:       []config.AllowCommand{{Command: "uname"}},
+				DefaultErrorMessage: "Command not allowed",
+				MaxExecutionTime:    30,
+				Seccomp:             &config.SeccompConfig{DenySyscalls: tt.denySyscalls},
+			}
+			log := logger.New()
+			r := New(cfg, validator.New(cfg, log), log)
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			r.SetOutputs(stdout, stderr)
+
+			result := r.RunCommand(t.Context(), tt.command, workDir)
+			assert.Equal(t, tt.exitCode, ExitCode(result.Err))
+			assert.Equal(t, tt.stdout, stdout.String())
+			assert.Contains(t, stderr.String(), tt.stderr)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package runner
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestRunSession(t *testing.T) {
+	workDir := t.TempDir()
+	subDir := filepath.Join(workDir, "sub")
+	assert.NoError(t, os.Mkdir(subDir, 0o755))
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+			{Command: "cd"},
+			{Command: "pwd"},
+			{Command: "export"},
+			{Command: "unset"},
+			{Command: "greet"},
+			{Command: "sh"},
+			{Command: "printenv"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+	session := NewSession(workDir)
+
+	run := func(command string) string {
+		t.Helper()
+		var stdout bytes.Buffer
+		result := r.Run(t.Context(), Request{
+			Command:    command,
+			WorkingDir: "/nonexistent",
+			Stdout:     &stdout,
+			Env:        []string{"PATH=/usr/bin:/bin"},
+			Session:    session,
+		})
+		assert.NoError(t, result.Err)
+		return stdout.String()
+	}
+
+	run(`cd sub; export GREETING=hello; LOCAL=1; greet() { echo "$GREETING $1"; }`)
+	assert.Equal(t, subDir, session.Dir())
+
+	// The directory, exported variables and functions carry over; unexported variables do not
+	assert.Equal(t, subDir+"\n", run("pwd"))
+	assert.Equal(t, "hello world\n", run("greet world"))
+	assert.Equal(t, "[]\n", run(`echo "[$LOCAL]"`))
+	assert.Equal(t, "hello\n", run(`sh -c 'printenv GREETING'`))
+
+	// A subshell does not change the session's directory
+	run("(cd ..)")
+	assert.Equal(t, subDir, session.Dir())
+
+	run("unset GREETING")
+	assert.Equal(t, "[]\n", run(`echo "[$GREETING]"`))
+	assert.False(t, slices.Contains(session.Env(), "GREETING=hello"))
+}
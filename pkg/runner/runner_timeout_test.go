@@ -0,0 +1,73 @@
+package runner
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestCommandTimeout(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "sleep", Timeout: 1},
+			{Command: "echo"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+	}
+	log := logger.New()
+	r := New(cfg, validator.New(cfg, log), log)
+
+	t.Run("command exceeding its timeout is stopped", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		r.SetOutputs(stdout, &bytes.Buffer{})
+
+		start := time.Now()
+		result := r.RunCommand(t.Context(), "sleep 10; echo after", workDir)
+		assert.Error(t, result.Err)
+		assert.Contains(t, result.Err.Error(), `command "sleep" exceeded its timeout of 1 seconds`)
+		assert.True(t, time.Since(start) < 5*time.Second)
+		assert.NotContains(t, stdout.String(), "after")
+	})
+
+	t.Run("command within its timeout runs", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		r.SetOutputs(stdout, &bytes.Buffer{})
+
+		result := r.RunCommand(t.Context(), "sleep 0; echo after", workDir)
+		assert.NoError(t, result.Err)
+		assert.Equal(t, "after\n", stdout.String())
+	})
+}
+
+func TestRunTimeout(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "sleep"}, {Command: "echo"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+		MaxCallTimeout:      60,
+	}
+	log := logger.New()
+	r := New(cfg, validator.New(cfg, log), log)
+
+	assert.Equal(t, 30*time.Second, r.runTimeout(Request{}))
+	assert.Equal(t, 5*time.Second, r.runTimeout(Request{Timeout: 5 * time.Second}))
+	assert.Equal(t, 60*time.Second, r.runTimeout(Request{Timeout: time.Hour}))
+
+	stdout := &bytes.Buffer{}
+	start := time.Now()
+	result := r.Run(t.Context(), Request{Command: "sleep 10; echo after", WorkingDir: workDir, Stdout: stdout, Timeout: time.Second})
+	assert.Error(t, result.Err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.NotContains(t, stdout.String(), "after")
+}
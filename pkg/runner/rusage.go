@@ -0,0 +1,54 @@
+package runner
+
+import (
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ProcessUsage is the resource usage of one external command, measured when it exited.
+// Durations are encoded in JSON as nanoseconds.
+type ProcessUsage struct {
+	Name string   `json:"name"`
+	Args []string `json:"args"`
+	PID  int      `json:"pid"`
+	// ExitCode is the exit code of the process, or -1 if it was killed by a signal.
+	ExitCode int `json:"exitCode"`
+	// UserTime and SystemTime are the CPU time the process and the children it waited for spent
+	// in user and kernel mode.
+	UserTime   time.Duration `json:"userTime"`
+	SystemTime time.Duration `json:"systemTime"`
+	// MaxRSSBytes is the peak resident set size of the process (Linux only, zero elsewhere).
+	MaxRSSBytes uint64 `json:"maxRssBytes"`
+}
+
+// processUsages collects the resource usage of the external commands of a run. Commands of
+// a pipeline exit concurrently, so it is guarded by mu.
+type processUsages struct {
+	mu     sync.Mutex
+	usages []ProcessUsage
+}
+
+// record adds the usage of an exited process started with args.
+func (p *processUsages) record(args []string, state *os.ProcessState) {
+	usage := ProcessUsage{
+		Name:        args[0],
+		Args:        slices.Clone(args[1:]),
+		PID:         state.Pid(),
+		ExitCode:    state.ExitCode(),
+		UserTime:    state.UserTime(),
+		SystemTime:  state.SystemTime(),
+		MaxRSSBytes: maxRSSBytes(state),
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.usages = append(p.usages, usage)
+}
+
+// list returns the usages recorded so far, in the order the processes exited.
+func (p *processUsages) list() []ProcessUsage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.usages)
+}
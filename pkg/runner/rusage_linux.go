@@ -0,0 +1,20 @@
+//go:build linux
+
+package runner
+
+import (
+	"os"
+	"syscall"
+)
+
+// bytesPerKilobyte converts ru_maxrss, which Linux reports in kilobytes, to bytes.
+const bytesPerKilobyte = 1024
+
+// maxRSSBytes returns the peak resident set size of an exited process.
+func maxRSSBytes(state *os.ProcessState) uint64 {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok || rusage.Maxrss < 0 {
+		return 0
+	}
+	return uint64(rusage.Maxrss) * bytesPerKilobyte
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package runner
+
+import "os"
+
+// maxRSSBytes is not measured on this platform.
+func maxRSSBytes(_ *os.ProcessState) uint64 {
+	return 0
+}
@@ -0,0 +1,226 @@
+//go:build linux
+
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+// sandboxDevices are the device nodes bind-mounted into the sandbox's /dev.
+var sandboxDevices = []string{"null", "zero", "full", "random", "urandom", "tty"}
+
+// sandboxPreservedMountFlags are the flags a read-only remount must keep, since the kernel
+// refuses to clear them on mounts inherited from a more privileged namespace.
+const sandboxPreservedMountFlags = unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC |
+	unix.MS_NOATIME | unix.MS_NODIRATIME | unix.MS_RELATIME
+
+// sandboxMounts describes the filesystem the helper builds for a sandboxed command.
+type sandboxMounts struct {
+	// Root is an empty host directory the new root filesystem is mounted on
+	Root string `json:"root"`
+	// WorkDir is the directory the command runs in
+	WorkDir string `json:"workDir"`
+	// ReadOnly and ReadWrite are host paths bind-mounted at the same location in the sandbox
+	ReadOnly  []string `json:"readOnly,omitempty"`
+	ReadWrite []string `json:"readWrite,omitempty"`
+}
+
+// sandboxSysProcAttr makes the command start in new mount and PID namespaces, and a new
+// network namespace unless the host network is allowed. Without root, a user namespace
+// mapping the current user to root grants the privileges needed to set up the mounts.
+func sandboxSysProcAttr(cmd *exec.Cmd, cfg *config.SandboxConfig) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	attr := cmd.SysProcAttr
+
+	attr.Cloneflags |= syscall.CLONE_NEWNS | syscall.CLONE_NEWPID
+	if !cfg.AllowNetwork {
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+
+	if os.Geteuid() != 0 {
+		attr.Cloneflags |= syscall.CLONE_NEWUSER
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Geteuid(), Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getegid(), Size: 1}}
+		attr.GidMappingsEnableSetgroups = false
+	}
+}
+
+// setupSandbox builds the sandbox's root filesystem on m.Root and switches to it. It runs in
+// the helper, inside the new mount namespace.
+func setupSandbox(m *sandboxMounts) error {
+	// Keep every mount below private to this namespace
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("making mounts private: %w", err)
+	}
+
+	root := m.Root
+	if err := unix.Mount("tmpfs", root, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=755"); err != nil {
+		return fmt.Errorf("mounting root: %w", err)
+	}
+
+	tmp := filepath.Join(root, "tmp")
+	if err := os.Mkdir(tmp, 0o755); err != nil {
+		return err
+	}
+	if err := unix.Mount("tmpfs", tmp, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("mounting /tmp: %w", err)
+	}
+
+	if err := setupSandboxDev(root); err != nil {
+		return err
+	}
+
+	// Allowed directories are mounted last so that they are visible even below a read-only path
+	for _, p := range m.ReadOnly {
+		if err := bindIntoSandbox(root, p, true); err != nil {
+			return err
+		}
+	}
+	for _, p := range m.ReadWrite {
+		if err := bindIntoSandbox(root, p, false); err != nil {
+			return err
+		}
+	}
+
+	proc := filepath.Join(root, "proc")
+	if err := os.Mkdir(proc, 0o755); err != nil {
+		return err
+	}
+	if err := unix.Mount("proc", proc, "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mounting /proc: %w", err)
+	}
+
+	return pivotIntoSandbox(root, m.WorkDir)
+}
+
+// setupSandboxDev creates a minimal /dev with a few harmless device nodes.
+func setupSandboxDev(root string) error {
+	dev := filepath.Join(root, "dev")
+	if err := os.Mkdir(dev, 0o755); err != nil {
+		return err
+	}
+	if err := unix.Mount("tmpfs", dev, "tmpfs", unix.MS_NOSUID|unix.MS_NOEXEC, "mode=755"); err != nil {
+		return fmt.Errorf("mounting /dev: %w", err)
+	}
+
+	for _, name := range sandboxDevices {
+		source := filepath.Join("/dev", name)
+		if _, err := os.Stat(source); err != nil {
+			continue
+		}
+		target := filepath.Join(dev, name)
+		if err := os.WriteFile(target, nil, 0o666); err != nil {
+			return err
+		}
+		if err := unix.Mount(source, target, "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("mounting %s: %w", source, err)
+		}
+	}
+
+	links := map[string]string{
+		"fd":     "/proc/self/fd",
+		"stdin":  "/proc/self/fd/0",
+		"stdout": "/proc/self/fd/1",
+		"stderr": "/proc/self/fd/2",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dev, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindIntoSandbox bind-mounts a host path at the same location below root. Symbolic links
+// (e.g. /bin -> usr/bin) are recreated instead, and missing paths are skipped.
+func bindIntoSandbox(root, path string, readOnly bool) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	target := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(link, target); err != nil && !errors.Is(err, os.ErrExist) {
+			return err
+		}
+		return nil
+	case info.IsDir():
+		if err := os.MkdirAll(target, 0o755); err != nil {
+			return err
+		}
+	default:
+		if err := os.WriteFile(target, nil, 0o644); err != nil {
+			return err
+		}
+	}
+
+	if err := unix.Mount(path, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("mounting %s: %w", path, err)
+	}
+	if !readOnly {
+		return nil
+	}
+
+	var stat unix.Statfs_t
+	if err := unix.Statfs(target, &stat); err != nil {
+		return fmt.Errorf("inspecting %s: %w", path, err)
+	}
+	flags := uintptr(unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY) | uintptr(stat.Flags)&sandboxPreservedMountFlags
+	if err := unix.Mount("", target, "", flags, ""); err != nil {
+		return fmt.Errorf("making %s read-only: %w", path, err)
+	}
+	return nil
+}
+
+// pivotIntoSandbox makes root the root filesystem, detaches the host's filesystem and
+// changes to the working directory inside the sandbox.
+func pivotIntoSandbox(root, workDir string) error {
+	const oldRootName = ".old-root"
+
+	oldRoot := filepath.Join(root, oldRootName)
+	if err := os.Mkdir(oldRoot, 0o700); err != nil {
+		return err
+	}
+	if err := unix.PivotRoot(root, oldRoot); err != nil {
+		return fmt.Errorf("pivoting root: %w", err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+	if err := unix.Unmount("/"+oldRootName, unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("detaching host filesystem: %w", err)
+	}
+	if err := os.Remove("/" + oldRootName); err != nil {
+		return err
+	}
+
+	// The inherited working directory still refers to the host filesystem
+	if err := os.Chdir(workDir); err != nil {
+		return fmt.Errorf("changing to working directory: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+// RunScriptFile runs the script file at scriptPath with args as its positional parameters,
+// writing to the outputs set with SetOutputs and using the environment set with SetEnv like
+// RunCommand. A relative scriptPath is resolved against workingDir.
+//
+// The file must be a regular file inside the allowed directories, no larger than
+// MaxScriptSize, and must not contain NUL bytes. A shebang line is handled according to the
+// Shebang configuration. Every command of the script is validated as for RunCommand.
+func (r *SafeRunner) RunScriptFile(ctx context.Context, scriptPath string, args []string, workingDir string) RunResult {
+	path := scriptPath
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workingDir, path)
+	}
+
+	script, err := r.readScriptFile(path, workingDir)
+	if err != nil {
+		r.logger.LogErrorf("Script file %s rejected: %v", scriptPath, err)
+		return RunResult{Err: err}
+	}
+
+	command, err := r.scriptCommand(path, script)
+	if err != nil {
+		r.logger.LogErrorf("Script file %s rejected: %v", scriptPath, err)
+		return RunResult{Err: err}
+	}
+
+	r.mu.Lock()
+	req := Request{Command: command, WorkingDir: workingDir, Args: args, Stdout: r.stdout, Stderr: r.stderr}
+	r.mu.Unlock()
+
+	return r.runWithEnv(ctx, req, r.defaultEnv())
+}
+
+// readScriptFile validates and reads a script file.
+func (r *SafeRunner) readScriptFile(path, workingDir string) (string, error) {
+	if result := r.validator.ValidateFileAccess(path, workingDir, false); !result.Allowed {
+		return "", fmt.Errorf("script file: %s", result.Message)
+	}
+
+	// Opening a FIFO or a device could block or have side effects, so check the path first
+	pathInfo, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("script file: %w", err)
+	}
+	if !pathInfo.Mode().IsRegular() {
+		return "", fmt.Errorf("script file %s is not a regular file", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("script file: %w", err)
+	}
+	defer f.Close()
+
+	// Check the opened file too, so that it cannot be swapped in between
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("script file: %w", err)
+	}
+	if !os.SameFile(pathInfo, info) {
+		return "", fmt.Errorf("script file %s changed while it was opened", path)
+	}
+	maxSize := r.config.GetMaxScriptSize()
+	if info.Size() > int64(maxSize) {
+		return "", fmt.Errorf("script file %s is %d bytes, more than the limit of %d", path, info.Size(), maxSize)
+	}
+
+	// The file may grow after Stat; never read more than the limit
+	data, err := io.ReadAll(io.LimitReader(f, int64(maxSize)+1))
+	if err != nil {
+		return "", fmt.Errorf("script file: %w", err)
+	}
+	if len(data) > maxSize {
+		return "", fmt.Errorf("script file %s is larger than the limit of %d bytes", path, maxSize)
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return "", fmt.Errorf("script file %s contains NUL bytes and is not a shell script", path)
+	}
+	return string(data), nil
+}
+
+// scriptCommand returns the command that runs a script file according to the Shebang
+// configuration: the script itself, or a call of the interpreter named by its shebang.
+func (r *SafeRunner) scriptCommand(path, script string) (string, error) {
+	interpreter, ok := parseShebang(script)
+	if !ok {
+		return script, nil
+	}
+
+	switch r.config.Shebang {
+	case "", config.ShebangIgnore:
+		return script, nil
+	case config.ShebangReject:
+		return "", fmt.Errorf("script file %s starts with a shebang line, which is not allowed", path)
+	case config.ShebangHonor:
+		if validator.IsShellCommand(filepath.Base(interpreter[0])) {
+			return script, nil
+		}
+		// Run the interpreter like any other command, so that it is validated
+		words := make([]string, 0, len(interpreter)+2)
+		for _, word := range append(interpreter, path) {
+			quoted, err := syntax.Quote(word, syntax.LangPOSIX)
+			if err != nil {
+				return "", fmt.Errorf("script file %s: %w", path, err)
+			}
+			words = append(words, quoted)
+		}
+		return strings.Join(append(words, `"$@"`), " "), nil
+	default:
+		return "", fmt.Errorf("unknown shebang policy %q", r.config.Shebang)
+	}
+}
+
+// parseShebang returns the interpreter and its optional argument named by the script's
+// shebang line. "/usr/bin/env name" is reduced to name. ok is false when the script has no
+// shebang line.
+func parseShebang(script string) (interpreter []string, ok bool) {
+	line, found := strings.CutPrefix(script, "#!")
+	if !found {
+		return nil, false
+	}
+	line, _, _ = strings.Cut(line, "\n")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, false
+	}
+	if filepath.Base(fields[0]) == "env" && len(fields) > 1 {
+		fields = fields[1:]
+	}
+	return fields, true
+}
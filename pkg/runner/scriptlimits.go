@@ -0,0 +1,95 @@
+package runner
+
+import (
+	"fmt"
+
+	"mvdan.cc/sh/v3/syntax"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+// checkScriptLimits checks a parsed script against the configured limits on its number of
+// commands, pipeline stages and nesting depth. The script's text is measured, so a loop
+// counts its commands once however often it runs.
+func checkScriptLimits(prog *syntax.File, limits *config.ScriptLimits) error {
+	if limits == nil {
+		return nil
+	}
+
+	var commands, maxStages, maxDepth int
+	var stack []syntax.Node
+	depth := 0
+	syntax.Walk(prog, func(node syntax.Node) bool {
+		if node == nil {
+			if isNesting(stack) {
+				depth--
+			}
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, node)
+		if isNesting(stack) {
+			depth++
+			maxDepth = max(maxDepth, depth)
+		}
+
+		switch n := node.(type) {
+		case *syntax.CallExpr:
+			if len(n.Args) > 0 {
+				commands++
+			}
+		case *syntax.BinaryCmd:
+			if isPipe(n) {
+				maxStages = max(maxStages, pipelineStages(n))
+			}
+		}
+		return true
+	})
+
+	if limits.MaxCommands > 0 && commands > limits.MaxCommands {
+		return fmt.Errorf("script has %d commands, more than the limit of %d", commands, limits.MaxCommands)
+	}
+	if limits.MaxPipelineStages > 0 && maxStages > limits.MaxPipelineStages {
+		return fmt.Errorf("script has a pipeline of %d commands, more than the limit of %d", maxStages, limits.MaxPipelineStages)
+	}
+	if limits.MaxNestingDepth > 0 && maxDepth > limits.MaxNestingDepth {
+		return fmt.Errorf("script nests compound commands %d deep, more than the limit of %d", maxDepth, limits.MaxNestingDepth)
+	}
+	return nil
+}
+
+// isNesting reports whether the last node of stack opens a nesting level. The else branch
+// of an if clause is an if clause itself but stays on the level of the if.
+func isNesting(stack []syntax.Node) bool {
+	switch stack[len(stack)-1].(type) {
+	case *syntax.IfClause:
+		if len(stack) > 1 {
+			if _, ok := stack[len(stack)-2].(*syntax.IfClause); ok {
+				return false
+			}
+		}
+		return true
+	case *syntax.Block, *syntax.Subshell, *syntax.WhileClause, *syntax.ForClause, *syntax.CaseClause,
+		*syntax.FuncDecl, *syntax.CmdSubst, *syntax.ProcSubst:
+		return true
+	}
+	return false
+}
+
+// isPipe reports whether cmd is a pipe, with | or |&.
+func isPipe(cmd *syntax.BinaryCmd) bool {
+	return cmd.Op == syntax.Pipe || cmd.Op == syntax.PipeAll
+}
+
+// pipelineStages returns the number of commands of the pipeline starting at cmd.
+func pipelineStages(cmd *syntax.BinaryCmd) int {
+	stages := 0
+	for _, stmt := range []*syntax.Stmt{cmd.X, cmd.Y} {
+		if sub, ok := stmt.Cmd.(*syntax.BinaryCmd); ok && isPipe(sub) && !stmt.Negated && !stmt.Background {
+			stages += pipelineStages(sub)
+		} else {
+			stages++
+		}
+	}
+	return stages
+}
@@ -0,0 +1,87 @@
+package runner
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"mvdan.cc/sh/v3/syntax"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestCheckScriptLimits(t *testing.T) {
+	limits := &config.ScriptLimits{MaxCommands: 4, MaxPipelineStages: 3, MaxNestingDepth: 2}
+
+	tests := []struct {
+		name   string
+		script string
+		err    string
+	}{
+		{name: "within limits", script: "echo a | grep a | wc -l"},
+		{name: "elif stays on the level of if", script: "if a; then b; elif c; then { d; }; fi"},
+		{name: "assignments are not commands", script: "A=1; B=2; C=3; D=4; E=5"},
+		{name: "too many commands", script: "echo 1; echo 2; echo 3; echo 4; echo 5",
+			err: "script has 5 commands, more than the limit of 4"},
+		{name: "commands in substitutions count", script: "echo $(echo 1) $(echo 2) $(echo 3) $(echo 4)",
+			err: "script has 5 commands, more than the limit of 4"},
+		{name: "long pipeline", script: "cat a | grep b | sort | uniq",
+			err: "script has a pipeline of 4 commands, more than the limit of 3"},
+		{name: "pipes with stderr", script: "cat a |& grep b |& sort |& uniq",
+			err: "script has a pipeline of 4 commands, more than the limit of 3"},
+		{name: "separate pipelines", script: "a | b && c | d"},
+		{name: "deep nesting", script: "for i in 1; do while true; do { echo; }; done; done",
+			err: "script nests compound commands 3 deep, more than the limit of 2"},
+		{name: "nested substitutions", script: "echo $( (echo $(echo)) )",
+			err: "script nests compound commands 3 deep, more than the limit of 2"},
+		{name: "sibling blocks", script: "{ { echo; }; }; { { echo; }; }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, err := syntax.NewParser().Parse(strings.NewReader(tt.script), "")
+			assert.NoError(t, err)
+			err = checkScriptLimits(prog, limits)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+
+	t.Run("no limits", func(t *testing.T) {
+		prog, err := syntax.NewParser().Parse(strings.NewReader(strings.Repeat("echo; ", 1000)), "")
+		assert.NoError(t, err)
+		assert.NoError(t, checkScriptLimits(prog, nil))
+	})
+}
+
+func TestRunScriptLimits(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		ScriptLimits:        &config.ScriptLimits{MaxCommands: 2},
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	var stdout strings.Builder
+	result := r.Run(t.Context(), Request{Command: "echo 1; echo 2; echo 3", WorkingDir: workDir, Stdout: &stdout})
+	assert.EqualError(t, result.Err, "script has 3 commands, more than the limit of 2")
+	assert.Equal(t, "", stdout.String())
+
+	results := r.RunBatch(t.Context(), []Request{
+		{Command: "echo 1", WorkingDir: workDir},
+		{Command: "echo 1; echo 2; echo 3", WorkingDir: workDir},
+	}, BatchOptions{FailFast: true})
+	assert.IsError(t, results[0].Err, ErrNotRun)
+	assert.EqualError(t, results[1].Err, "script has 3 commands, more than the limit of 2")
+}
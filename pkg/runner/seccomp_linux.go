@@ -0,0 +1,99 @@
+//go:build linux && (amd64 || arm64)
+
+package runner
+
+import (
+	"fmt"
+	"strconv"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Offsets of the fields of struct seccomp_data the filter inspects.
+const (
+	seccompDataNrOffset   = 0
+	seccompDataArchOffset = 4
+)
+
+// seccompSyscalls maps the system call names accepted in denySyscalls to their numbers.
+var seccompSyscalls = map[string]uintptr{
+	"acct":              unix.SYS_ACCT,
+	"add_key":           unix.SYS_ADD_KEY,
+	"bpf":               unix.SYS_BPF,
+	"chroot":            unix.SYS_CHROOT,
+	"clock_settime":     unix.SYS_CLOCK_SETTIME,
+	"delete_module":     unix.SYS_DELETE_MODULE,
+	"finit_module":      unix.SYS_FINIT_MODULE,
+	"init_module":       unix.SYS_INIT_MODULE,
+	"kexec_file_load":   unix.SYS_KEXEC_FILE_LOAD,
+	"kexec_load":        unix.SYS_KEXEC_LOAD,
+	"keyctl":            unix.SYS_KEYCTL,
+	"mount":             unix.SYS_MOUNT,
+	"name_to_handle_at": unix.SYS_NAME_TO_HANDLE_AT,
+	"open_by_handle_at": unix.SYS_OPEN_BY_HANDLE_AT,
+	"perf_event_open":   unix.SYS_PERF_EVENT_OPEN,
+	"pivot_root":        unix.SYS_PIVOT_ROOT,
+	"process_vm_readv":  unix.SYS_PROCESS_VM_READV,
+	"process_vm_writev": unix.SYS_PROCESS_VM_WRITEV,
+	"ptrace":            unix.SYS_PTRACE,
+	"reboot":            unix.SYS_REBOOT,
+	"request_key":       unix.SYS_REQUEST_KEY,
+	"setdomainname":     unix.SYS_SETDOMAINNAME,
+	"sethostname":       unix.SYS_SETHOSTNAME,
+	"setns":             unix.SYS_SETNS,
+	"settimeofday":      unix.SYS_SETTIMEOFDAY,
+	"swapoff":           unix.SYS_SWAPOFF,
+	"swapon":            unix.SYS_SWAPON,
+	"umount2":           unix.SYS_UMOUNT2,
+	"unshare":           unix.SYS_UNSHARE,
+	"userfaultfd":       unix.SYS_USERFAULTFD,
+}
+
+// resolveSyscalls converts system call names (or numbers) to numbers.
+func resolveSyscalls(names []string) ([]uint32, error) {
+	numbers := make([]uint32, 0, len(names))
+	for _, name := range names {
+		if nr, ok := seccompSyscalls[name]; ok {
+			numbers = append(numbers, uint32(nr))
+			continue
+		}
+		nr, err := strconv.ParseUint(name, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("unknown system call %q", name)
+		}
+		numbers = append(numbers, uint32(nr))
+	}
+	return numbers, nil
+}
+
+// installSeccompFilter installs a filter on the calling thread that makes the given system
+// calls fail with EPERM and kills the process on a system call from a foreign architecture.
+func installSeccompFilter(numbers []uint32) error {
+	deny := unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)}
+
+	filter := []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: seccompDataArchOffset},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 1, K: seccompAuditArch},
+		{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_KILL_PROCESS},
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: seccompDataNrOffset},
+	}
+	if seccompX32SyscallBit != 0 {
+		// x32 system calls use different numbers and would bypass the checks below
+		filter = append(filter, unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, Jf: 1, K: seccompX32SyscallBit}, deny)
+	}
+	for _, nr := range numbers {
+		filter = append(filter, unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jf: 1, K: nr}, deny)
+	}
+	filter = append(filter, unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_ALLOW})
+
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("setting no_new_privs: %w", err)
+	}
+	if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0); err != nil {
+		return fmt.Errorf("installing seccomp filter: %w", err)
+	}
+	return nil
+}
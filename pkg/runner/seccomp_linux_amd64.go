@@ -0,0 +1,10 @@
+package runner
+
+import "golang.org/x/sys/unix"
+
+const (
+	// seccompAuditArch is the architecture the seccomp filter accepts system calls from.
+	seccompAuditArch = unix.AUDIT_ARCH_X86_64
+	// seccompX32SyscallBit marks x32 ABI system calls, which the filter denies.
+	seccompX32SyscallBit = 0x40000000
+)
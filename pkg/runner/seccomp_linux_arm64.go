@@ -0,0 +1,10 @@
+package runner
+
+import "golang.org/x/sys/unix"
+
+const (
+	// seccompAuditArch is the architecture the seccomp filter accepts system calls from.
+	seccompAuditArch = unix.AUDIT_ARCH_AARCH64
+	// seccompX32SyscallBit is unused on arm64, which has no x32-style ABI.
+	seccompX32SyscallBit = 0
+)
@@ -0,0 +1,17 @@
+//go:build linux && !(amd64 || arm64)
+
+package runner
+
+import "errors"
+
+// errSeccompUnsupported is returned when seccomp is configured on an architecture the
+// filter is not implemented for.
+var errSeccompUnsupported = errors.New("seccomp is only supported on Linux amd64 and arm64")
+
+func resolveSyscalls(_ []string) ([]uint32, error) {
+	return nil, errSeccompUnsupported
+}
+
+func installSeccompFilter(_ []uint32) error {
+	return errSeccompUnsupported
+}
@@ -0,0 +1,83 @@
+package runner
+
+import (
+	"maps"
+	"slices"
+	"sync"
+
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Session carries shell state from one run to the next: the working directory, exported
+// variables and shell functions. Runs using the same Session are serialized.
+type Session struct {
+	// run is held for the duration of a run using the session
+	run sync.Mutex
+
+	// mu protects the state below
+	mu    sync.Mutex
+	dir   string
+	env   []string
+	funcs map[string]*syntax.Stmt
+}
+
+// NewSession creates a Session whose first run starts in workingDir.
+func NewSession(workingDir string) *Session {
+	return &Session{dir: workingDir}
+}
+
+// Dir returns the directory the next run of the session starts in.
+func (s *Session) Dir() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dir
+}
+
+// Env returns the variables exported by earlier runs of the session, as "NAME=value" entries.
+// It is nil until the session has run.
+func (s *Session) Env() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.env)
+}
+
+// environment returns the environment of the session's next run: the variables exported by
+// earlier runs followed by env, or env alone until the session has run.
+func (s *Session) environment(env []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.env == nil {
+		return env
+	}
+	return append(slices.Clone(s.env), env...)
+}
+
+// restore loads the session's functions into an interpreter that has been reset.
+func (s *Session) restore(interpRunner *interp.Runner) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	interpRunner.Funcs = maps.Clone(s.funcs)
+}
+
+// save records the state an interpreter was left in by a run.
+func (s *Session) save(interpRunner *interp.Runner) {
+	var env []string
+	for name, vr := range interpRunner.Vars {
+		// PWD and OLDPWD follow the directory, which is restored separately
+		if name == "PWD" || name == "OLDPWD" {
+			continue
+		}
+		if vr.IsSet() && vr.Exported && vr.Kind == expand.String {
+			env = append(env, name+"="+vr.Str)
+		}
+	}
+	slices.Sort(env)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dir = interpRunner.Dir
+	s.env = env
+	s.funcs = maps.Clone(interpRunner.Funcs)
+}
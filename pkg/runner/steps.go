@@ -0,0 +1,83 @@
+package runner
+
+import (
+	"context"
+	"strings"
+
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Statuses of the steps of a script.
+const (
+	// StepSucceeded is the status of a step that exited with 0.
+	StepSucceeded = "succeeded"
+	// StepFailed is the status of a step that exited non-zero.
+	StepFailed = "failed"
+	// StepError is the status of a step that did not run to completion, e.g. because a
+	// command was blocked or the run timed out.
+	StepError = "error"
+	// StepSkipped is the status of a step that did not run because an earlier step stopped
+	// the script.
+	StepSkipped = "skipped"
+)
+
+// StepResult is the outcome of a top-level command of a script, such as "make build" or
+// "cd src && go test ./...", in the order of the script.
+type StepResult struct {
+	// Command is the source of the step.
+	Command string `json:"command"`
+	// Status is StepSucceeded, StepFailed, StepError or StepSkipped.
+	Status string `json:"status"`
+	// ExitCode is the exit status of the step, or ExitCodeNotRun if it did not complete.
+	ExitCode int `json:"exitCode"`
+	// Error is the reason a step with StepError did not complete.
+	Error string `json:"error,omitempty"`
+}
+
+// runSteps runs the top-level commands of prog, parsed from script, one at a time and
+// returns their outcomes and the error of the script, the same as running prog at once
+// would return. runErr classifies the errors of the interpreter. The script stops at a step
+// that does not complete or exits the shell, e.g. with exit or under set -e; the steps after
+// it are skipped.
+func runSteps(ctx context.Context, interpRunner *interp.Runner, prog *syntax.File, script string, runErr func(error) error) ([]StepResult, error) {
+	steps := make([]StepResult, len(prog.Stmts))
+	var stopErr error
+	stopped := false
+	for i, stmt := range prog.Stmts {
+		steps[i].Command = stepSource(script, stmt)
+		if stopped {
+			steps[i].Status, steps[i].ExitCode = StepSkipped, ExitCodeNotRun
+			continue
+		}
+
+		err := runErr(interpRunner.Run(ctx, stmt))
+		steps[i].ExitCode = ExitCode(err)
+		switch {
+		case err == nil:
+			steps[i].Status = StepSucceeded
+		case steps[i].ExitCode == ExitCodeNotRun:
+			steps[i].Status, steps[i].Error = StepError, err.Error()
+		default:
+			steps[i].Status = StepFailed
+		}
+		if steps[i].ExitCode == ExitCodeNotRun || interpRunner.Exited() {
+			stopped, stopErr = true, err
+		}
+	}
+	if stopped {
+		return steps, stopErr
+	}
+
+	// Run the exit trap and end with the status of the last step, as running prog at once does
+	return steps, runErr(interpRunner.Run(ctx, &syntax.File{}))
+}
+
+// stepSource returns the source of stmt in script, without the semicolon ending it.
+func stepSource(script string, stmt *syntax.Stmt) string {
+	start, end := int(stmt.Pos().Offset()), int(stmt.End().Offset())
+	if start > end || end > len(script) {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimSuffix(script[start:end], ";"))
+}
@@ -0,0 +1,52 @@
+package runner
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Stream names passed to a StreamFunc.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// StreamFunc receives output as it is written by the script. stream is StreamStdout or
+// StreamStderr. Calls are serialized, and chunk must not be retained after the call returns.
+type StreamFunc func(stream string, chunk []byte)
+
+// RunCommandStream runs a shell command like RunCommand, passing its output to fn as it is
+// produced instead of buffering it until the script completes. Output beyond MaxOutputSize is
+// dropped; with the tail output mode and a limit set, the kept output reaches fn only when the
+// script completes. Writers set with SetOutputs are not used.
+func (r *SafeRunner) RunCommandStream(ctx context.Context, command string, workingDir string, fn StreamFunc) RunResult {
+	stdout, stderr := StreamWriters(fn)
+	return r.runWithEnv(ctx, Request{Command: command, WorkingDir: workingDir, Stdout: stdout, Stderr: stderr}, r.defaultEnv())
+}
+
+// StreamWriters returns the stdout and stderr writers of a Request that pass the script's
+// output to fn as it is produced, as RunCommandStream does.
+func StreamWriters(fn StreamFunc) (stdout, stderr io.Writer) {
+	mu := &sync.Mutex{}
+	return &streamWriter{stream: StreamStdout, fn: fn, mu: mu}, &streamWriter{stream: StreamStderr, fn: fn, mu: mu}
+}
+
+// streamWriter forwards writes to a StreamFunc. Writers of the same script share mu because
+// external commands write stdout and stderr from separate goroutines.
+type streamWriter struct {
+	stream string
+	fn     StreamFunc
+	mu     *sync.Mutex
+}
+
+// Write passes p to the StreamFunc.
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.fn(w.stream, p)
+	return len(p), nil
+}
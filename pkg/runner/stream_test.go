@@ -0,0 +1,81 @@
+package runner
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func TestRunCommandStream(t *testing.T) {
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+			{Command: "sleep"},
+			{Command: "sh"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	r := New(cfg, validator.New(cfg, log), log)
+
+	t.Run("output is delivered before the script completes", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		var firstOutput time.Time
+		result := r.RunCommandStream(t.Context(), "echo first; sleep 1; echo second >&2", workDir,
+			func(stream string, p []byte) {
+				if firstOutput.IsZero() {
+					firstOutput = time.Now()
+				}
+				if stream == StreamStdout {
+					stdout.Write(p)
+				} else {
+					stderr.Write(p)
+				}
+			})
+		end := time.Now()
+		assert.NoError(t, result.Err)
+
+		assert.Equal(t, "first\n", stdout.String())
+		assert.Equal(t, "second\n", stderr.String())
+		assert.True(t, end.Sub(firstOutput) >= 900*time.Millisecond)
+	})
+
+	t.Run("external command output is streamed", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		result := r.RunCommandStream(t.Context(), `sh -c "echo out; echo err >&2"`, workDir,
+			func(stream string, p []byte) {
+				if stream == StreamStdout {
+					stdout.Write(p)
+				} else {
+					stderr.Write(p)
+				}
+			})
+		assert.NoError(t, result.Err)
+		assert.Equal(t, "out\n", stdout.String())
+		assert.Equal(t, "err\n", stderr.String())
+	})
+
+	t.Run("output beyond the limit is dropped", func(t *testing.T) {
+		limitedCfg := *cfg
+		limitedCfg.MaxOutputSize = 4
+		limited := New(&limitedCfg, validator.New(&limitedCfg, log), log)
+
+		var out strings.Builder
+		result := limited.RunCommandStream(t.Context(), "echo 0123456789", workDir,
+			func(_ string, p []byte) { out.Write(p) })
+		assert.NoError(t, result.Err)
+		assert.True(t, strings.HasPrefix(out.String(), "0123"))
+		assert.False(t, strings.Contains(out.String(), "456789"))
+		assert.True(t, limited.WasOutputTruncated())
+	})
+}
@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"time"
+
+	"mvdan.cc/sh/v3/interp"
+)
+
+// commandTimeoutMiddleware bounds each run of an external command by the timeout in its
+// allow rule. The script-wide MaxExecutionTime still applies on top of it.
+func (r *SafeRunner) commandTimeoutMiddleware(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	return func(ctx context.Context, args []string) error {
+		// Absolute path commands are validated by their basename, so look up the rule the same way
+		cmd := filepath.Base(args[0])
+		allowed := r.config.GetAllowCommand(cmd)
+		if allowed == nil || allowed.Timeout <= 0 {
+			return next(ctx, args)
+		}
+
+		timeout := time.Duration(allowed.Timeout) * time.Second
+		cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		err := next(cmdCtx, args)
+		// Only report the command's own deadline; the script deadline is reported by the caller
+		if errors.Is(cmdCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			r.logger.LogErrorf("Command %q exceeded its timeout of %v", cmd, timeout)
+			return &TimeoutError{Command: cmd, Timeout: timeout}
+		}
+		return err
+	}
+}
+
+// runTimeout returns the time limit of the run of req: its Timeout clamped to MaxCallTimeout,
+// or MaxExecutionTime when it has none. Zero means unlimited.
+func (r *SafeRunner) runTimeout(req Request) time.Duration {
+	if req.Timeout <= 0 {
+		return time.Duration(r.config.MaxExecutionTime) * time.Second
+	}
+	if limit := time.Duration(r.config.GetMaxCallTimeout()) * time.Second; limit > 0 && req.Timeout > limit {
+		return limit
+	}
+	return req.Timeout
+}
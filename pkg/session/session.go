@@ -0,0 +1,151 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/runner"
+)
+
+var (
+	// ErrNotFound is returned for session IDs that are unknown, closed or expired.
+	ErrNotFound = errors.New("session not found")
+	// ErrTooManySessions is returned by Create when the configured number of sessions is open.
+	ErrTooManySessions = errors.New("too many open sessions")
+)
+
+// Info describes a session.
+type Info struct {
+	ID string
+	// WorkingDir is the directory the session's next run starts in.
+	WorkingDir string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	// Runs is the number of runs the session has served.
+	Runs int
+}
+
+// session is an open session.
+type session struct {
+	state *runner.Session
+
+	// guarded by Manager.mu
+	info    Info
+	running int
+}
+
+// Manager keeps persistent shell sessions, so that the working directory, exported
+// variables and shell functions of a run carry over to the next run with the same session
+// ID. Sessions idle for longer than the configured idle timeout, or open for longer than
+// the configured lifetime, are closed.
+type Manager struct {
+	runner *runner.SafeRunner
+	config *config.SessionConfig
+	now    func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// NewManager creates a Manager that runs scripts with r, limited by cfg. A nil cfg uses the
+// default limits.
+func NewManager(r *runner.SafeRunner, cfg *config.SessionConfig) *Manager {
+	return &Manager{runner: r, config: cfg, now: time.Now, sessions: make(map[string]*session)}
+}
+
+// Create opens a session whose first run starts in workingDir and returns its ID.
+func (m *Manager) Create(workingDir string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+	if len(m.sessions) >= m.config.GetMaxSessions() {
+		return "", fmt.Errorf("%w (limit %d)", ErrTooManySessions, m.config.GetMaxSessions())
+	}
+
+	id := runner.NewRunID()
+	now := m.now()
+	m.sessions[id] = &session{
+		state: runner.NewSession(workingDir),
+		info:  Info{ID: id, WorkingDir: workingDir, CreatedAt: now, LastUsedAt: now},
+	}
+	return id, nil
+}
+
+// Run runs req in the session with the given ID; req.WorkingDir is ignored in favour of the
+// session's directory. Runs of the same session are serialized.
+func (m *Manager) Run(ctx context.Context, id string, req runner.Request) (runner.RunResult, error) {
+	m.mu.Lock()
+	m.expire()
+	s, ok := m.sessions[id]
+	if !ok {
+		m.mu.Unlock()
+		return runner.RunResult{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	s.running++
+	m.mu.Unlock()
+
+	req.Session = s.state
+	result := m.runner.Run(ctx, req)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.running--
+	s.info.Runs++
+	s.info.LastUsedAt = m.now()
+	s.info.WorkingDir = s.state.Dir()
+	return result, nil
+}
+
+// Info returns the current state of a session.
+func (m *Manager) Info(id string) (Info, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+	s, ok := m.sessions[id]
+	if !ok {
+		return Info{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return s.info, nil
+}
+
+// Close closes a session. A run in progress completes, but the session cannot be used again.
+func (m *Manager) Close(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	delete(m.sessions, id)
+	return nil
+}
+
+// List returns all open sessions in no particular order.
+func (m *Manager) List() []Info {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+	infos := make([]Info, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		infos = append(infos, s.info)
+	}
+	return infos
+}
+
+// expire closes the sessions that outlived the idle timeout or the lifetime. Sessions with a
+// run in progress are left alone until the run completes. m.mu must be held.
+func (m *Manager) expire() {
+	now := m.now()
+	for id, s := range m.sessions {
+		if s.running > 0 {
+			continue
+		}
+		if now.Sub(s.info.LastUsedAt) > m.config.GetIdleTimeout() ||
+			now.Sub(s.info.CreatedAt) > m.config.GetMaxLifetime() {
+			delete(m.sessions, id)
+		}
+	}
+}
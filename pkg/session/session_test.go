@@ -0,0 +1,99 @@
+package session
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/runner"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+func newTestManager(t *testing.T, sessionCfg *config.SessionConfig) (*Manager, string) {
+	t.Helper()
+	workDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+			{Command: "cd"},
+			{Command: "export"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+	}
+	log := logger.NewWithWriter(io.Discard)
+	return NewManager(runner.New(cfg, validator.New(cfg, log), log), sessionCfg), workDir
+}
+
+func TestSessionRun(t *testing.T) {
+	m, workDir := newTestManager(t, nil)
+	assert.NoError(t, os.Mkdir(filepath.Join(workDir, "sub"), 0o755))
+
+	id, err := m.Create(workDir)
+	assert.NoError(t, err)
+
+	result, err := m.Run(t.Context(), id, runner.Request{Command: "cd sub; export NAME=session"})
+	assert.NoError(t, err)
+	assert.NoError(t, result.Err)
+
+	var stdout bytes.Buffer
+	result, err = m.Run(t.Context(), id, runner.Request{Command: "echo $NAME", Stdout: &stdout})
+	assert.NoError(t, err)
+	assert.NoError(t, result.Err)
+	assert.Equal(t, "session\n", stdout.String())
+
+	info, err := m.Info(id)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(workDir, "sub"), info.WorkingDir)
+	assert.Equal(t, 2, info.Runs)
+
+	assert.NoError(t, m.Close(id))
+	_, err = m.Run(t.Context(), id, runner.Request{Command: "echo"})
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.True(t, errors.Is(m.Close(id), ErrNotFound))
+}
+
+func TestSessionLimits(t *testing.T) {
+	m, workDir := newTestManager(t, &config.SessionConfig{MaxSessions: 2, IdleTimeout: 60, MaxLifetime: 300})
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	first, err := m.Create(workDir)
+	assert.NoError(t, err)
+	second, err := m.Create(workDir)
+	assert.NoError(t, err)
+	_, err = m.Create(workDir)
+	assert.True(t, errors.Is(err, ErrTooManySessions))
+
+	// Using a session keeps it from going idle
+	now = now.Add(50 * time.Second)
+	_, err = m.Run(t.Context(), first, runner.Request{Command: "echo"})
+	assert.NoError(t, err)
+
+	now = now.Add(20 * time.Second)
+	_, err = m.Info(second)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	_, err = m.Info(first)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(m.List()))
+
+	// The lifetime applies however often a session is used
+	for range 7 {
+		now = now.Add(30 * time.Second)
+		_, err = m.Run(t.Context(), first, runner.Request{Command: "echo"})
+		assert.NoError(t, err)
+	}
+	now = now.Add(30 * time.Second)
+	_, err = m.Run(t.Context(), first, runner.Request{Command: "echo"})
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Equal(t, 0, len(m.List()))
+}
@@ -0,0 +1,41 @@
+package validator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkApproval blocks commands listed in requireApproval unless the run was approved.
+func (v *CommandValidator) checkApproval(cmd string, args []string) ValidationResult {
+	if v.approved {
+		return allowResult(cmd, allowRuleName(cmd))
+	}
+	for _, entry := range v.config.RequireApproval {
+		if matchesApprovalEntry(entry, cmd, args) {
+			return denyResult(cmd, CategoryApproval, CodeApprovalRequired,
+				fmt.Sprintf("requireApproval[%s]", entry),
+				fmt.Sprintf("command %q requires a human's approval", entry))
+		}
+	}
+	return allowResult(cmd, allowRuleName(cmd))
+}
+
+// matchesApprovalEntry reports whether cmd with args is covered by a requireApproval entry.
+// The words after the entry's command must appear among args in order, so "git push" also
+// matches "git -C repo push origin".
+func matchesApprovalEntry(entry string, cmd string, args []string) bool {
+	words := strings.Fields(entry)
+	if len(words) == 0 || words[0] != cmd {
+		return false
+	}
+	words = words[1:]
+	for _, arg := range args {
+		if len(words) == 0 {
+			break
+		}
+		if arg == words[0] {
+			words = words[1:]
+		}
+	}
+	return len(words) == 0
+}
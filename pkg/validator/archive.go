@@ -0,0 +1,168 @@
+package validator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// tarShortOptionsWithArg lists the tar short options that take a value.
+const tarShortOptionsWithArg = "bCfFgHIKLNTVX"
+
+// unzipShortOptionsWithArg lists the unzip short options that take a value.
+const unzipShortOptionsWithArg = "dP"
+
+// ArchivePath is a path argument of an archive command that must be within the allowed directories.
+type ArchivePath struct {
+	// Option is the option or role the path was given for, e.g. "-C", "-f" or "archive".
+	Option string
+	// Path is the path as it will be used by the command.
+	Path string
+}
+
+// IsTarCommand checks if the command is a tar variant.
+func IsTarCommand(cmd string) bool {
+	switch cmd {
+	case "tar", "gtar", "bsdtar":
+		return true
+	}
+	return false
+}
+
+// IsUnzipCommand checks if the command is unzip.
+func IsUnzipCommand(cmd string) bool {
+	return cmd == "unzip"
+}
+
+// ParseTarPaths extracts the extraction directories (-C, --directory) and archive files
+// (-f, --file) from tar arguments. It understands bundled short options (-xzf a.tar, -Cdir)
+// and the traditional form without a dash (tar xfC a.tar dir). A relative -C is resolved
+// against the preceding -C, since tar changes directory cumulatively.
+func ParseTarPaths(args []string) ([]ArchivePath, string) {
+	var paths []ArchivePath
+	currentDir := ""
+
+	addDirectory := func(dir string) {
+		if currentDir != "" && !filepath.IsAbs(dir) {
+			dir = filepath.Join(currentDir, dir)
+		}
+		currentDir = dir
+		paths = append(paths, ArchivePath{Option: "-C", Path: dir})
+	}
+	addOption := func(opt byte, value string) {
+		switch opt {
+		case 'C':
+			addDirectory(value)
+		case 'f':
+			paths = append(paths, ArchivePath{Option: "-f", Path: value})
+		}
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--" {
+			break
+		}
+
+		// Long options
+		if strings.HasPrefix(arg, "--") {
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+			var opt byte
+			switch {
+			case len(name) >= len("dir") && strings.HasPrefix("directory", name):
+				opt = 'C'
+			case name == "file":
+				opt = 'f'
+			default:
+				continue
+			}
+			if !hasValue {
+				if i+1 >= len(args) {
+					return nil, fmt.Sprintf("tar option %s requires an argument", arg)
+				}
+				i++
+				value = args[i]
+			}
+			addOption(opt, value)
+			continue
+		}
+
+		// Traditional options: the first argument may be a bundle without a leading dash,
+		// whose option values are taken from the following arguments in order
+		if i == 0 && !strings.HasPrefix(arg, "-") {
+			for j := range len(arg) {
+				if !strings.ContainsRune(tarShortOptionsWithArg, rune(arg[j])) {
+					continue
+				}
+				if i+1 >= len(args) {
+					return nil, fmt.Sprintf("tar option %c requires an argument", arg[j])
+				}
+				i++
+				addOption(arg[j], args[i])
+			}
+			continue
+		}
+
+		// Short option bundles: the first option taking a value consumes the rest of the bundle
+		// or, if the bundle ends there, the next argument
+		if strings.HasPrefix(arg, "-") && len(arg) > 1 {
+			for j := 1; j < len(arg); j++ {
+				if !strings.ContainsRune(tarShortOptionsWithArg, rune(arg[j])) {
+					continue
+				}
+				value := arg[j+1:]
+				if value == "" {
+					if i+1 >= len(args) {
+						return nil, fmt.Sprintf("tar option -%c requires an argument", arg[j])
+					}
+					i++
+					value = args[i]
+				}
+				addOption(arg[j], value)
+				break
+			}
+		}
+	}
+
+	return paths, ""
+}
+
+// ParseUnzipPaths extracts the archive file and the extraction directory (-d) from unzip arguments.
+// The first non-option argument is the archive; later ones are member and exclude patterns.
+func ParseUnzipPaths(args []string) ([]ArchivePath, string) {
+	var paths []ArchivePath
+	archiveFound := false
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if strings.HasPrefix(arg, "-") && len(arg) > 1 {
+			for j := 1; j < len(arg); j++ {
+				if !strings.ContainsRune(unzipShortOptionsWithArg, rune(arg[j])) {
+					continue
+				}
+				value := arg[j+1:]
+				if value == "" {
+					if i+1 >= len(args) {
+						return nil, fmt.Sprintf("unzip option -%c requires an argument", arg[j])
+					}
+					i++
+					value = args[i]
+				}
+				if arg[j] == 'd' {
+					paths = append(paths, ArchivePath{Option: "-d", Path: value})
+				}
+				break
+			}
+			continue
+		}
+
+		if !archiveFound {
+			archiveFound = true
+			paths = append(paths, ArchivePath{Option: "archive", Path: arg})
+		}
+	}
+
+	return paths, ""
+}
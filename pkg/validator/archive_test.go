@@ -0,0 +1,131 @@
+package validator
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseTarPaths tests the ParseTarPaths function.
+func TestParseTarPaths(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		want   []ArchivePath
+		errMsg string
+	}{
+		{
+			name: "NoPaths",
+			args: []string{"-tv"},
+			want: nil,
+		},
+		{
+			name: "SeparateOptions",
+			args: []string{"-x", "-f", "a.tar", "-C", "/tmp/out"},
+			want: []ArchivePath{{Option: "-f", Path: "a.tar"}, {Option: "-C", Path: "/tmp/out"}},
+		},
+		{
+			name: "BundledOptions",
+			args: []string{"-xzf", "a.tar.gz", "-C/tmp/out"},
+			want: []ArchivePath{{Option: "-f", Path: "a.tar.gz"}, {Option: "-C", Path: "/tmp/out"}},
+		},
+		{
+			name: "BundledValue",
+			args: []string{"-xfa.tar"},
+			want: []ArchivePath{{Option: "-f", Path: "a.tar"}},
+		},
+		{
+			name: "TraditionalBundle",
+			args: []string{"xfC", "a.tar", "/etc"},
+			want: []ArchivePath{{Option: "-f", Path: "a.tar"}, {Option: "-C", Path: "/etc"}},
+		},
+		{
+			name: "LongOptions",
+			args: []string{"--extract", "--file=a.tar", "--directory", "/etc"},
+			want: []ArchivePath{{Option: "-f", Path: "a.tar"}, {Option: "-C", Path: "/etc"}},
+		},
+		{
+			name: "AbbreviatedLongOption",
+			args: []string{"-xf", "a.tar", "--dir=/etc"},
+			want: []ArchivePath{{Option: "-f", Path: "a.tar"}, {Option: "-C", Path: "/etc"}},
+		},
+		{
+			name: "CumulativeDirectories",
+			args: []string{"-x", "-C", "/tmp/out", "-C", "../../etc", "-f", "a.tar"},
+			want: []ArchivePath{
+				{Option: "-C", Path: "/tmp/out"},
+				{Option: "-C", Path: "/etc"},
+				{Option: "-f", Path: "a.tar"},
+			},
+		},
+		{
+			name: "OtherOptionValueIsNotAPath",
+			args: []string{"-x", "-T", "list.txt", "-b", "20"},
+			want: nil,
+		},
+		{
+			name:   "MissingValue",
+			args:   []string{"-xf", "a.tar", "-C"},
+			errMsg: "tar option -C requires an argument",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errMsg := ParseTarPaths(tt.args)
+			if errMsg != tt.errMsg {
+				t.Fatalf("ParseTarPaths() errMsg = %q, want %q", errMsg, tt.errMsg)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTarPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseUnzipPaths tests the ParseUnzipPaths function.
+func TestParseUnzipPaths(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		want   []ArchivePath
+		errMsg string
+	}{
+		{
+			name: "ArchiveOnly",
+			args: []string{"-o", "a.zip"},
+			want: []ArchivePath{{Option: "archive", Path: "a.zip"}},
+		},
+		{
+			name: "DestinationAfterArchive",
+			args: []string{"a.zip", "docs/*", "-d", "/etc"},
+			want: []ArchivePath{{Option: "archive", Path: "a.zip"}, {Option: "-d", Path: "/etc"}},
+		},
+		{
+			name: "BundledDestination",
+			args: []string{"-qd/etc", "a.zip"},
+			want: []ArchivePath{{Option: "-d", Path: "/etc"}, {Option: "archive", Path: "a.zip"}},
+		},
+		{
+			name: "PasswordIsNotAPath",
+			args: []string{"-P", "secret", "a.zip", "-x", "skip.txt"},
+			want: []ArchivePath{{Option: "archive", Path: "a.zip"}},
+		},
+		{
+			name:   "MissingValue",
+			args:   []string{"a.zip", "-d"},
+			errMsg: "unzip option -d requires an argument",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errMsg := ParseUnzipPaths(tt.args)
+			if errMsg != tt.errMsg {
+				t.Fatalf("ParseUnzipPaths() errMsg = %q, want %q", errMsg, tt.errMsg)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseUnzipPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
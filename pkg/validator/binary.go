@@ -0,0 +1,92 @@
+package validator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ValidateBinaryPath checks that the executable a command resolved to lives in one of the
+// trusted binary directories. Only the directory holding the binary is resolved for symlinks,
+// so a symlink named like an allowed command in an untrusted directory is still rejected
+// even if it points at a trusted binary.
+func (v *CommandValidator) ValidateBinaryPath(ctx context.Context, cmd string, binaryPath string) (bool, string) {
+	absPath, err := filepath.Abs(binaryPath)
+	if err != nil {
+		return false, fmt.Sprintf("failed to resolve absolute path: %v", err)
+	}
+	binaryDir := resolveSymlinksPath(filepath.Dir(absPath))
+
+	for _, trustedDir := range v.config.GetTrustedBinaryDirectories() {
+		if isWithinDirectory(binaryDir, resolveSymlinksPath(trustedDir)) {
+			return true, ""
+		}
+	}
+
+	message := fmt.Sprintf("command %q resolves to %q, which is outside of trusted binary directories: %s",
+		cmd, binaryPath, v.config.DefaultErrorMessage)
+	v.logBlockedCommand(v.newBlockRecord(ctx,
+		denyResult(cmd, CategoryPath, CodeUntrustedBinary, "trustedBinaryDirectories", message), ""))
+	return false, message
+}
+
+// ValidateBinaryChecksum checks that the executable a command resolved to matches the
+// SHA-256 digest pinned in its allow rule. Commands without a pinned digest are always accepted.
+func (v *CommandValidator) ValidateBinaryChecksum(ctx context.Context, cmd string, binaryPath string) (bool, string) {
+	allowed := v.config.GetAllowCommand(cmd)
+	if allowed == nil || allowed.Sha256 == "" {
+		return true, ""
+	}
+
+	digest, err := fileSHA256(binaryPath)
+	if err != nil {
+		message := fmt.Sprintf("cannot verify checksum of %q for command %q: %v", binaryPath, cmd, err)
+		v.logBlockedCommand(v.newBlockRecord(ctx,
+			denyResult(cmd, CategoryConstraint, CodeChecksumMismatch, allowRuleName(cmd)+".sha256", message), ""))
+		return false, message
+	}
+
+	if !strings.EqualFold(digest, allowed.Sha256) {
+		message := fmt.Sprintf("checksum mismatch for command %q: binary %q has sha256 %s, expected %s",
+			cmd, binaryPath, digest, strings.ToLower(allowed.Sha256))
+		v.logBlockedCommand(v.newBlockRecord(ctx,
+			denyResult(cmd, CategoryConstraint, CodeChecksumMismatch, allowRuleName(cmd)+".sha256", message), ""))
+		return false, message
+	}
+
+	return true, ""
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 digest of a file's contents.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// isWithinDirectory reports whether path is dir itself or located below it.
+// Unlike a plain prefix check, "/usr/binx" is not considered to be within "/usr/bin".
+func isWithinDirectory(path string, dir string) bool {
+	path = filepath.Clean(path)
+	dir = filepath.Clean(dir)
+	if path == dir {
+		return true
+	}
+	if dir == string(filepath.Separator) {
+		return true
+	}
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
@@ -0,0 +1,139 @@
+package validator
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+)
+
+// Caller identifies whom a validation is done for. It is recorded in the block log.
+type Caller struct {
+	// Client identifies the client that sent the command, e.g. the name it authenticated as.
+	// Rate limits are kept per client.
+	Client string
+	// RunID is the ID of the run the command belongs to.
+	RunID string
+	// Approved reports that a human approved the run, so commands listed in requireApproval
+	// may run.
+	Approved bool
+}
+
+// callerKey is the context key of the Caller.
+type callerKey struct{}
+
+// WithCaller returns a copy of ctx that carries caller.
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// callerFrom returns the Caller carried by ctx, or the zero Caller.
+func callerFrom(ctx context.Context) Caller {
+	caller, _ := ctx.Value(callerKey{}).(Caller)
+	return caller
+}
+
+// forCaller returns the validator to validate with for the Caller carried by ctx: v itself,
+// or for an identified client or an approved run a copy that keeps the client's own rate
+// limits and lets approved commands run.
+func (v *CommandValidator) forCaller(ctx context.Context) *CommandValidator {
+	caller := callerFrom(ctx)
+	if caller.Client == "" && !caller.Approved {
+		return v
+	}
+	c := *v
+	c.client = caller.Client
+	c.approved = caller.Approved
+	return &c
+}
+
+// blockLog is the block log file, opened on the first blocked command.
+type blockLog struct {
+	mu   sync.Mutex
+	file *logger.RotatingFile
+}
+
+// BlockRecord is one line of the block log, which holds a JSON object per blocked command
+// (JSON Lines). Fields without a value are omitted.
+type BlockRecord struct {
+	// Time is when the command was blocked, in RFC 3339 format with fractional seconds in UTC.
+	Time time.Time `json:"time"`
+	// Command is the command that was blocked (for nested commands, the inner one).
+	Command string `json:"command"`
+	// Args are the arguments of the validated command.
+	Args []string `json:"args,omitempty"`
+	// Script is the script that was blocked, for scripts validated as a whole.
+	Script string `json:"script,omitempty"`
+	// Rule identifies the configuration rule that matched, as in ValidationResult.
+	Rule string `json:"rule,omitempty"`
+	// Code is the machine-readable reason.
+	Code Code `json:"code"`
+	// Category classifies the kind of rule that blocked the command.
+	Category Category `json:"category,omitempty"`
+	// Reason is the human-readable explanation returned to the client.
+	Reason string `json:"reason"`
+	// WorkDir is the directory the command was validated in.
+	WorkDir string `json:"workDir,omitempty"`
+	// Client identifies the client that sent the command.
+	Client string `json:"client,omitempty"`
+	// RunID is the ID of the run the command belongs to.
+	RunID string `json:"runId,omitempty"`
+}
+
+// newBlockRecord returns the block log record of a blocked result.
+func (v *CommandValidator) newBlockRecord(ctx context.Context, result ValidationResult, workDir string) BlockRecord {
+	caller := callerFrom(ctx)
+	return BlockRecord{
+		Time:     v.now().UTC(),
+		Command:  result.Command,
+		Rule:     result.Rule,
+		Code:     result.Code,
+		Category: result.Category,
+		Reason:   result.Message,
+		WorkDir:  workDir,
+		Client:   caller.Client,
+		RunID:    caller.RunID,
+	}
+}
+
+// logBlockedCommand appends record to the block log, if one is configured.
+func (v *CommandValidator) logBlockedCommand(record BlockRecord) {
+	if v.config.BlockLogPath == "" {
+		return
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		v.logger.LogErrorf("Failed to encode block log record: %v", err)
+		return
+	}
+
+	v.blockLog.mu.Lock()
+	defer v.blockLog.mu.Unlock()
+
+	if v.blockLog.file == nil {
+		// Ensure the directory exists
+		dir := filepath.Dir(v.config.BlockLogPath)
+		if err := os.MkdirAll(dir, DirPermissions); err != nil {
+			v.logger.LogErrorf("Failed to create directory for block log: %v", err)
+			return
+		}
+
+		// Open the log file in append mode, rotated like the server log
+		f, err := logger.OpenRotatingFile(v.config.BlockLogPath, FilePermissions, logger.Rotation(v.config.GetLogRotation()))
+		if err != nil {
+			v.logger.LogErrorf("Failed to open block log file: %v", err)
+			return
+		}
+		v.blockLog.file = f
+	}
+
+	// Write the record and its newline at once, so a rotation never splits them
+	if _, err := v.blockLog.file.Write(append(line, '\n')); err != nil {
+		v.logger.LogErrorf("Failed to write to block log file: %v", err)
+	}
+}
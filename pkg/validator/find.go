@@ -1,6 +1,7 @@
 package validator
 
 import (
+	"fmt"
 	"strings"
 )
 
@@ -12,13 +13,63 @@ func NewFindParser() *FindParser {
 	return &FindParser{}
 }
 
+// findSpecialOutputFiles are the output files GNU find writes to directly instead of opening them.
+var findSpecialOutputFiles = map[string]bool{
+	"/dev/stdout": true,
+	"/dev/stderr": true,
+}
+
+// ParseFindRoots returns the starting points of a find command: the operands before the first
+// expression, after the leading -H, -L, -P, -D and -O options. Without operands find searches the
+// working directory, and no roots are returned.
+func (f *FindParser) ParseFindRoots(args []string) []string {
+	var roots []string
+
+	i := 0
+	// Leading options
+	for i < len(args) {
+		arg := args[i]
+		if arg == "--" {
+			i++
+			break
+		}
+		if arg == "-H" || arg == "-L" || arg == "-P" || strings.HasPrefix(arg, "-O") {
+			i++
+			continue
+		}
+		if arg == "-D" {
+			i += 2
+			continue
+		}
+		break
+	}
+
+	// Starting points end at the first expression token
+	for ; i < len(args); i++ {
+		arg := args[i]
+		if strings.HasPrefix(arg, "-") || arg == "(" || arg == "\\(" || arg == "!" || arg == "," {
+			break
+		}
+		roots = append(roots, arg)
+	}
+
+	return roots
+}
+
+// FindOutputFile is a file written by a find action such as -fprint.
+type FindOutputFile struct {
+	Action string
+	Path   string
+}
+
 // ExecCommand represents a command extracted from find -exec with its arguments.
 type ExecCommand struct {
 	Name string
 	Args []string
 }
 
-// ParseFindExecArgs parses find command arguments to extract the command executed by -exec.
+// ParseFindExecArgs parses find command arguments to extract the commands executed by
+// -exec, -execdir, -ok and -okdir.
 // Returns:
 // - The extracted commands with their arguments.
 // - Whether any commands were successfully extracted.
@@ -29,7 +80,7 @@ func (f *FindParser) ParseFindExecArgs(args []string) ([]ExecCommand, bool, stri
 		return nil, false, ""
 	}
 
-	// Find all -exec or -execdir arguments and their associated commands
+	// Find all -exec, -execdir, -ok and -okdir arguments and their associated commands
 	commands := extractExecCommands(args)
 	if len(commands) == 0 {
 		return nil, false, ""
@@ -38,55 +89,120 @@ func (f *FindParser) ParseFindExecArgs(args []string) ([]ExecCommand, bool, stri
 	return commands, true, ""
 }
 
-// FilterFindSpecialArgs removes find's special arguments like \; and + from the args list
-// to prevent them from being interpreted as paths during validation.
+// FilterFindSpecialArgs removes find's special arguments like \; and + from the args list,
+// as well as /dev/stdout and /dev/stderr given to output actions, to prevent them from being
+// interpreted as paths during validation.
 func (f *FindParser) FilterFindSpecialArgs(args []string) []string {
 	filtered := make([]string, 0, len(args))
-	for _, arg := range args {
+	for i, arg := range args {
 		// Skip find's special terminators
 		if arg == ";" || arg == "\\;" || arg == "+" {
 			continue
 		}
+		// Skip standard streams given to output actions, which find does not open as files
+		if i > 0 && isFindOutputAction(args[i-1]) && findSpecialOutputFiles[arg] {
+			continue
+		}
 		filtered = append(filtered, arg)
 	}
 	return filtered
 }
 
-// extractExecCommands extracts all commands that follow -exec or -execdir in find arguments.
+// ParseFindOutputFiles extracts the files written by -fprint, -fprint0, -fprintf and -fls.
+// Arguments of -exec style actions are skipped, since they belong to the executed command.
+func (f *FindParser) ParseFindOutputFiles(args []string) ([]FindOutputFile, string) {
+	var files []FindOutputFile
+
+	for i := 0; i < len(args); i++ {
+		action := args[i]
+		switch {
+		case isFindExecAction(action):
+			// Skip to the end of this clause
+			for i+1 < len(args) && !isFindExecTerminator(args[i+1]) {
+				i++
+			}
+		case isFindOutputAction(action):
+			if i+1 >= len(args) {
+				return nil, fmt.Sprintf("find action %s requires a file argument", action)
+			}
+			i++
+			if !findSpecialOutputFiles[args[i]] {
+				files = append(files, FindOutputFile{Action: action, Path: args[i]})
+			}
+			// -fprintf also takes a format
+			if action == "-fprintf" {
+				i++
+			}
+		}
+	}
+
+	return files, ""
+}
+
+// isFindExecTerminator reports whether an argument ends an -exec style clause.
+func isFindExecTerminator(arg string) bool {
+	return arg == ";" || arg == "\\;" || arg == "+"
+}
+
+// isFindOutputAction reports whether an argument is an action that writes to a file.
+func isFindOutputAction(arg string) bool {
+	switch arg {
+	case "-fprint", "-fprint0", "-fprintf", "-fls":
+		return true
+	}
+	return false
+}
+
+// isFindExecAction reports whether an argument starts an action that executes a command.
+func isFindExecAction(arg string) bool {
+	switch arg {
+	case "-exec", "-execdir", "-ok", "-okdir":
+		return true
+	}
+	return false
+}
+
+// extractExecClauses returns the command and arguments of every -exec, -execdir, -ok and -okdir
+// action in find arguments, including the {} placeholders find replaces with file names.
+func extractExecClauses(args []string) [][]string {
+	var clauses [][]string
+	for i := 0; i < len(args)-1; i++ {
+		if !isFindExecAction(args[i]) {
+			continue
+		}
+		// Collect all arguments until \; or + is encountered
+		j := i + 1
+		for j < len(args) && !isFindExecTerminator(args[j]) {
+			j++
+		}
+		clauses = append(clauses, args[i+1:j])
+
+		// Skip to the end of this -exec clause
+		i = j
+	}
+	return clauses
+}
+
+// extractExecCommands extracts all commands that follow -exec, -execdir, -ok or -okdir in find arguments.
 func extractExecCommands(args []string) []ExecCommand {
 	var commands []ExecCommand
-	for i := 0; i < len(args)-1; i++ {
-		// Check for -exec or -execdir flags
-		if args[i] == "-exec" || args[i] == "-execdir" {
-			// Collect all arguments until \; or + is encountered
-			j := i + 1
-			var cmdParts []string
-			for j < len(args) {
-				// Check if we've reached the end of the command (\; or +)
-				if args[j] == ";" || args[j] == "\\;" || args[j] == "+" {
-					break
-				}
-
-				// Skip {} placeholder
-				if args[j] != "{}" {
-					cmdParts = append(cmdParts, args[j])
-				}
-
-				j++
+	for _, clause := range extractExecClauses(args) {
+		// Skip {} placeholder
+		var cmdParts []string
+		for _, arg := range clause {
+			if arg != "{}" {
+				cmdParts = append(cmdParts, arg)
 			}
+		}
 
-			if len(cmdParts) > 0 && !strings.HasPrefix(cmdParts[0], "{") {
-				cmd := ExecCommand{
-					Name: cmdParts[0],
-				}
-				if len(cmdParts) > 1 {
-					cmd.Args = cmdParts[1:]
-				}
-				commands = append(commands, cmd)
+		if len(cmdParts) > 0 && !strings.HasPrefix(cmdParts[0], "{") {
+			cmd := ExecCommand{
+				Name: cmdParts[0],
 			}
-
-			// Skip to the end of this -exec clause
-			i = j
+			if len(cmdParts) > 1 {
+				cmd.Args = cmdParts[1:]
+			}
+			commands = append(commands, cmd)
 		}
 	}
 
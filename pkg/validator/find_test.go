@@ -128,6 +128,20 @@ func testFindExecEdgeCases(t *testing.T, parser *FindParser) {
 			wantValid:  false,
 			wantErrMsg: "",
 		},
+		{
+			name:       "OkCommand",
+			args:       []string{"-name", "*.tmp", "-ok", "rm", "{}", ";"},
+			wantCmds:   []ExecCommand{{Name: "rm"}},
+			wantValid:  true,
+			wantErrMsg: "",
+		},
+		{
+			name:       "OkdirCommand",
+			args:       []string{"-okdir", "chmod", "600", "{}", ";"},
+			wantCmds:   []ExecCommand{{Name: "chmod", Args: []string{"600"}}},
+			wantValid:  true,
+			wantErrMsg: "",
+		},
 	}
 
 	runFindParserTests(t, parser, tests)
@@ -211,3 +225,69 @@ func TestFilterFindSpecialArgs(t *testing.T) {
 		})
 	}
 }
+
+// TestParseFindOutputFiles tests the ParseFindOutputFiles function.
+func TestParseFindOutputFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []FindOutputFile
+		wantErr string
+	}{
+		{"NoOutputFiles", []string{".", "-name", "*.go", "-print"}, nil, ""},
+		{
+			name: "AllActions",
+			args: []string{".", "-fprint", "a", "-fprint0", "b", "-fprintf", "c", "%p\\n", "-fls", "d"},
+			want: []FindOutputFile{
+				{Action: "-fprint", Path: "a"},
+				{Action: "-fprint0", Path: "b"},
+				{Action: "-fprintf", Path: "c"},
+				{Action: "-fls", Path: "d"},
+			},
+		},
+		{"StandardStreams", []string{".", "-fprint", "/dev/stdout", "-fls", "/dev/stderr"}, nil, ""},
+		{"InsideExecClause", []string{".", "-exec", "echo", "-fprint", "x", ";"}, nil, ""},
+		{"MissingFile", []string{".", "-fprint"}, nil, "find action -fprint requires a file argument"},
+	}
+
+	parser := NewFindParser()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errMsg := parser.ParseFindOutputFiles(tt.args)
+			if errMsg != tt.wantErr {
+				t.Fatalf("ParseFindOutputFiles() errMsg = %q, want %q", errMsg, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFindOutputFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseFindRoots tests the ParseFindRoots function.
+func TestParseFindRoots(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"NoArgs", []string{}, nil},
+		{"ExpressionOnly", []string{"-name", "*.go"}, nil},
+		{"SingleRoot", []string{"/etc", "-name", "shadow"}, []string{"/etc"}},
+		{"MultipleRoots", []string{"src", "docs", "-type", "f"}, []string{"src", "docs"}},
+		{"LeadingOptions", []string{"-L", "-O3", "/etc"}, []string{"/etc"}},
+		{"DebugOption", []string{"-D", "tree", "/etc", "-print"}, []string{"/etc"}},
+		{"ParenthesisEndsRoots", []string{".", "(", "-name", "a", ")"}, []string{"."}},
+		{"NegationEndsRoots", []string{".", "!", "-name", "a"}, []string{"."}},
+		{"DoubleDash", []string{"--", "/etc"}, []string{"/etc"}},
+	}
+
+	parser := NewFindParser()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parser.ParseFindRoots(tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFindRoots(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package validator
+
+import (
+	"strings"
+	"text/template"
+)
+
+// MessageData is the data available to message templates configured in messageTemplates.
+type MessageData struct {
+	// Cmd is the command that was blocked.
+	Cmd string
+	// Code is the machine-readable reason, e.g. "COMMAND_NOT_ALLOWED".
+	Code Code
+	// Category classifies the kind of rule that blocked the command.
+	Category Category
+	// Rule identifies the configuration rule that matched.
+	Rule string
+	// Message is the built-in error message.
+	Message string
+	// DocURL is the documentation link of the matched rule, if any.
+	DocURL string
+}
+
+// parseMessageTemplates parses the configured message templates keyed by validation code.
+// Invalid templates are reported and skipped so the built-in message is used instead.
+func (v *CommandValidator) parseMessageTemplates() map[Code]*template.Template {
+	templates := make(map[Code]*template.Template, len(v.config.MessageTemplates))
+	for code, text := range v.config.MessageTemplates {
+		tmpl, err := template.New(code).Option("missingkey=error").Parse(text)
+		if err != nil {
+			v.logger.LogErrorf("Invalid message template for %s: %v", code, err)
+			continue
+		}
+		templates[Code(code)] = tmpl
+	}
+	return templates
+}
+
+// renderMessage replaces the message of a blocked result with its configured template, if any,
+// and appends the matched rule's documentation link unless the template already includes it.
+func (v *CommandValidator) renderMessage(result ValidationResult) ValidationResult {
+	if result.Allowed {
+		return result
+	}
+
+	if tmpl, ok := v.templates[result.Code]; ok {
+		data := MessageData{
+			Cmd:      result.Command,
+			Code:     result.Code,
+			Category: result.Category,
+			Rule:     result.Rule,
+			Message:  result.Message,
+			DocURL:   result.DocURL,
+		}
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, data); err != nil {
+			v.logger.LogErrorf("Failed to render message template for %s: %v", result.Code, err)
+		} else {
+			result.Message = sb.String()
+		}
+	}
+
+	if result.DocURL != "" && !strings.Contains(result.Message, result.DocURL) {
+		result.Message += " (see " + result.DocURL + ")"
+	}
+
+	return result
+}
@@ -0,0 +1,96 @@
+package validator
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+// rateLimiter keeps a token bucket per command and client. It is safe for concurrent use
+// because parallel runs share one validator.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// tokenBucket holds the remaining tokens for a command and when they were last refilled.
+type tokenBucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+// newRateLimiter creates an empty rateLimiter.
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// TakeOverRateLimits makes v count executions against the rate limits of old, so the
+// executions counted by a validator it replaces, e.g. on a reload, still apply. It must be
+// called before v is used.
+func (v *CommandValidator) TakeOverRateLimits(old *CommandValidator) {
+	v.rateLimiter = old.rateLimiter
+}
+
+// take refills the bucket for key at count tokens per interval and consumes one token.
+// It returns false without consuming when the bucket is empty. With consume false, it only
+// reports whether a token is available.
+func (l *rateLimiter) take(key string, count int, interval time.Duration, now time.Time, consume bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	capacity := float64(count)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if !consume {
+			return capacity >= 1
+		}
+		bucket = &tokenBucket{tokens: capacity, lastRefill: now}
+		l.buckets[key] = bucket
+	}
+
+	// Refill proportionally to the time elapsed since the last refill
+	tokens, lastRefill := bucket.tokens, bucket.lastRefill
+	if elapsed := now.Sub(lastRefill); elapsed > 0 {
+		tokens = min(capacity, tokens+capacity*elapsed.Seconds()/interval.Seconds())
+		lastRefill = now
+	}
+	if !consume {
+		return tokens >= 1
+	}
+	bucket.tokens, bucket.lastRefill = tokens, lastRefill
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// checkRateLimit consumes one execution from the command's rate limit, if it has one.
+// Identified clients each have their own limit.
+// Invalid rate limit configuration denies the command rather than silently allowing it.
+func (v *CommandValidator) checkRateLimit(cmd string, allowed *config.AllowCommand) ValidationResult {
+	rule := allowRuleName(cmd)
+	limit := allowed.RateLimit
+	if limit == nil {
+		return allowResult(cmd, rule)
+	}
+
+	interval, err := time.ParseDuration(limit.Per)
+	if err != nil || interval <= 0 || limit.Count <= 0 {
+		return denyResult(cmd, CategoryConstraint, CodeInvalidRule, rule+".rateLimit",
+			fmt.Sprintf("command %q has an invalid rateLimit (count: %d, per: %q)", cmd, limit.Count, limit.Per))
+	}
+
+	key := cmd
+	if v.client != "" {
+		key = v.client + "\x00" + cmd
+	}
+	if !v.rateLimiter.take(key, limit.Count, interval, v.now(), !v.dryRun) {
+		return denyResult(cmd, CategoryConstraint, CodeRateLimited, rule+".rateLimit",
+			fmt.Sprintf("command %q exceeded its rate limit of %d per %s, try again later", cmd, limit.Count, limit.Per))
+	}
+	return allowResult(cmd, rule)
+}
@@ -0,0 +1,84 @@
+package validator
+
+import "fmt"
+
+// Category classifies the kind of rule that decided a validation.
+type Category string
+
+const (
+	// CategoryNone is used for allowed commands.
+	CategoryNone Category = ""
+	// CategoryDenied means the command matched an explicit deny rule.
+	CategoryDenied Category = "denied"
+	// CategoryNotListed means the command is not in the allow list.
+	CategoryNotListed Category = "not-listed"
+	// CategoryPath means a path or directory is outside the allowed directories.
+	CategoryPath Category = "path"
+	// CategorySubCommand means a subcommand or flag was rejected by a subcommand rule.
+	CategorySubCommand Category = "subcommand"
+	// CategoryConstraint means a constraint of the allow rule (time window, rate limit) was not met.
+	CategoryConstraint Category = "constraint"
+	// CategoryApproval means the command runs only once a human approves it.
+	CategoryApproval Category = "approval"
+	// CategoryDangerous means the arguments contain a pattern that executes other commands.
+	CategoryDangerous Category = "dangerous"
+)
+
+// Code is a machine-readable reason for a validation decision.
+type Code string
+
+// Validation codes.
+const (
+	CodeAllowed              Code = "ALLOWED"
+	CodeCommandDenied        Code = "COMMAND_DENIED"
+	CodeCommandNotAllowed    Code = "COMMAND_NOT_ALLOWED"
+	CodeDirectoryNotAllowed  Code = "DIRECTORY_NOT_ALLOWED"
+	CodePathNotAllowed       Code = "PATH_NOT_ALLOWED"
+	CodePathDenied           Code = "PATH_DENIED"
+	CodePathReadOnly         Code = "PATH_READ_ONLY"
+	CodeSubCommandDenied     Code = "SUBCOMMAND_DENIED"
+	CodeSubCommandNotAllowed Code = "SUBCOMMAND_NOT_ALLOWED"
+	CodeFlagDenied           Code = "FLAG_DENIED"
+	CodeOutsideTimeWindow    Code = "OUTSIDE_TIME_WINDOW"
+	CodeRateLimited          Code = "RATE_LIMITED"
+	CodeApprovalRequired     Code = "APPROVAL_REQUIRED"
+	CodeInvalidRule          Code = "INVALID_RULE"
+	CodeDangerousPattern     Code = "DANGEROUS_PATTERN"
+	CodeUnparsableCommand    Code = "UNPARSABLE_COMMAND"
+	CodeUntrustedBinary      Code = "UNTRUSTED_BINARY"
+	CodeChecksumMismatch     Code = "CHECKSUM_MISMATCH"
+)
+
+// ValidationResult is the structured outcome of validating a command, path or directory.
+type ValidationResult struct {
+	// Allowed is the decision.
+	Allowed bool `json:"allowed"`
+	// Command is the command the decision applies to (for nested commands, the inner one).
+	Command string `json:"command,omitempty"`
+	// Category classifies the kind of rule that blocked the command.
+	Category Category `json:"category,omitempty"`
+	// Code is a machine-readable reason.
+	Code Code `json:"code"`
+	// Rule identifies the configuration rule that matched, e.g. "denyCommands[rm]"
+	// or "allowCommands[git].subCommands[push].denyFlags[-f]".
+	Rule string `json:"rule,omitempty"`
+	// Message is the human-readable explanation, empty when allowed.
+	Message string `json:"message,omitempty"`
+	// DocURL links to documentation of the matched rule, if configured.
+	DocURL string `json:"docUrl,omitempty"`
+}
+
+// allowResult returns an allowed result for cmd.
+func allowResult(cmd string, rule string) ValidationResult {
+	return ValidationResult{Allowed: true, Command: cmd, Code: CodeAllowed, Rule: rule}
+}
+
+// denyResult returns a blocked result.
+func denyResult(cmd string, category Category, code Code, rule string, message string) ValidationResult {
+	return ValidationResult{Command: cmd, Category: category, Code: code, Rule: rule, Message: message}
+}
+
+// allowRuleName returns the rule identifier of an allowCommands entry.
+func allowRuleName(cmd string) string {
+	return fmt.Sprintf("allowCommands[%s]", cmd)
+}
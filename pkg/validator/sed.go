@@ -109,6 +109,9 @@ func containsSedSubstitutionEFlag(script string) bool {
 		delimiter := trimmed[1]
 		flags := extractSedSubstitutionFlags(trimmed[2:], delimiter)
 
+		// A 'w' flag ends the flags; the rest is the output file name
+		flags, _, _ = strings.Cut(flags, "w")
+
 		// Check if 'e' is among the flags
 		if strings.ContainsRune(flags, 'e') {
 			return true
@@ -245,3 +248,107 @@ func splitSedCommands(script string) []string {
 	}
 	return commands
 }
+
+// sedSpecialWriteFiles are the output files GNU sed treats specially instead of opening them.
+var sedSpecialWriteFiles = map[string]bool{
+	"/dev/stdout": true,
+	"/dev/stderr": true,
+}
+
+// SedWriteTargets returns the files that sed scripts in args would write to through the
+// 'w'/'W' commands or the 'w' flag of substitutions. Script files given with -f are read;
+// unreadable ones are skipped here since ValidateSedArgs already rejects them.
+func (s *SedValidator) SedWriteTargets(args []string) []string {
+	var targets []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "-e" || arg == "--expression" {
+			if i+1 < len(args) {
+				i++
+				targets = append(targets, sedScriptWriteTargets(args[i])...)
+			}
+			continue
+		}
+
+		if arg == "-f" || arg == flagLongFile {
+			if i+1 < len(args) {
+				i++
+				if content, err := os.ReadFile(args[i]); err == nil {
+					targets = append(targets, sedScriptWriteTargets(string(content))...)
+				}
+			}
+			continue
+		}
+
+		// Skip other flags
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		// First non-flag argument is the sed script
+		targets = append(targets, sedScriptWriteTargets(arg)...)
+		break
+	}
+
+	return targets
+}
+
+// sedScriptWriteTargets returns the file names written by a sed script.
+// A write file name extends to the end of the line, including any semicolons.
+func sedScriptWriteTargets(script string) []string {
+	var targets []string
+
+	for _, line := range strings.Split(script, "\n") {
+		rest := line
+		for rest != "" {
+			segment, next, _ := strings.Cut(rest, ";")
+
+			if target, ok := sedWriteTarget(segment); ok {
+				// The file name runs to the end of the line, so reattach what Cut split off
+				if next != "" || strings.HasSuffix(rest, ";") {
+					target += ";" + next
+				}
+				target = strings.TrimLeft(target, " \t")
+				if target != "" && !sedSpecialWriteFiles[target] {
+					targets = append(targets, target)
+				}
+				break
+			}
+
+			rest = next
+		}
+	}
+
+	return targets
+}
+
+// sedWriteTarget returns the beginning of the file name if the sed command writes to a file.
+func sedWriteTarget(cmd string) (string, bool) {
+	// Strip block braces, the address and negation in front of the command: /re/!{w file
+	trimmed := strings.TrimLeft(strings.TrimSpace(cmd), " \t{")
+	trimmed = strings.TrimLeft(skipSedAddress(trimmed), " \t!{")
+
+	if len(trimmed) == 0 {
+		return "", false
+	}
+
+	// 'w file' and 'W file' commands
+	if trimmed[0] == 'w' || trimmed[0] == 'W' {
+		if len(trimmed) > 1 && (trimmed[1] == ' ' || trimmed[1] == '\t') {
+			return trimmed[1:], true
+		}
+		return "", false
+	}
+
+	// 'w file' flag on substitutions: s/pattern/replacement/gw file
+	if trimmed[0] == 's' && len(trimmed) >= 2 {
+		flags := extractSedSubstitutionFlags(trimmed[2:], trimmed[1])
+		if idx := strings.IndexByte(flags, 'w'); idx != -1 {
+			return flags[idx+1:], true
+		}
+	}
+
+	return "", false
+}
@@ -3,6 +3,7 @@ package validator
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -64,6 +65,10 @@ func testSafeSedPatterns(t *testing.T, v *SedValidator) {
 			name: "CaseInsensitiveSubstitution",
 			args: []string{"s/foo/bar/gi", "input.txt"},
 		},
+		{
+			name: "WriteFlagFileNameContainingE",
+			args: []string{"-n", "s/foo/bar/w /dev/stderr", "input.txt"},
+		},
 		{
 			name: "DeleteLine",
 			args: []string{"/pattern/d", "input.txt"},
@@ -161,3 +166,42 @@ func testDangerousSedPatterns(t *testing.T, v *SedValidator) {
 		})
 	}
 }
+
+// TestSedWriteTargets tests the SedValidator.SedWriteTargets function.
+func TestSedWriteTargets(t *testing.T) {
+	tmpDir := t.TempDir()
+	scriptFile := filepath.Join(tmpDir, "write.sed")
+	if err := os.WriteFile(scriptFile, []byte("s/a/b/\nw /tmp/from-file\n"), 0o600); err != nil {
+		t.Fatalf("Failed to create sed script: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"NoWrite", []string{"s/foo/bar/g", "file.txt"}, nil},
+		{"WriteCommand", []string{"w /etc/out"}, []string{"/etc/out"}},
+		{"UppercaseWriteCommand", []string{"W out.txt"}, []string{"out.txt"}},
+		{"WriteWithAddress", []string{"/pattern/w /etc/out"}, []string{"/etc/out"}},
+		{"WriteInBlock", []string{"/pattern/!{w /etc/out"}, []string{"/etc/out"}},
+		{"WriteAfterSemicolon", []string{"s/a/b/;w /etc/out"}, []string{"/etc/out"}},
+		{"FileNameRunsToEndOfLine", []string{"w /tmp/a;p"}, []string{"/tmp/a;p"}},
+		{"SubstitutionWriteFlag", []string{"s/a/b/gw /etc/out"}, []string{"/etc/out"}},
+		{"StdoutIsNotAFile", []string{"-n", "s/a/b/w /dev/stdout"}, nil},
+		{"Expression", []string{"-e", "p", "-e", "w /etc/out"}, []string{"/etc/out"}},
+		{"ScriptFile", []string{"-f", scriptFile}, []string{"/tmp/from-file"}},
+		{"MultipleLines", []string{"w one\nw two"}, []string{"one", "two"}},
+		{"WordStartingWithW", []string{"s/w/x/"}, nil},
+	}
+
+	v := NewSedValidator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := v.SedWriteTargets(tt.args)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SedWriteTargets(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package validator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+const (
+	// clockLayout is the layout of the start and end of an allowedHours range.
+	clockLayout = "15:04"
+	// minutesPerHour converts clock hours into minutes since midnight.
+	minutesPerHour = 60
+)
+
+// checkTimeWindow checks that the current time falls within the allowed hours and days of a rule.
+// Invalid time window configuration denies the command rather than silently allowing it.
+func (v *CommandValidator) checkTimeWindow(cmd string, allowed *config.AllowCommand) ValidationResult {
+	if len(allowed.AllowedHours) == 0 && len(allowed.AllowedDays) == 0 {
+		return allowResult(cmd, allowRuleName(cmd))
+	}
+
+	rule := allowRuleName(cmd)
+
+	loc := time.Local
+	if v.config.Timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(v.config.Timezone)
+		if err != nil {
+			return denyResult(cmd, CategoryConstraint, CodeInvalidRule, "timezone",
+				fmt.Sprintf("command %q cannot be time-checked: invalid timezone %q", cmd, v.config.Timezone))
+		}
+	}
+	now := v.now().In(loc)
+
+	if len(allowed.AllowedDays) > 0 {
+		ok, err := isDayAllowed(now.Weekday(), allowed.AllowedDays)
+		if err != nil {
+			return denyResult(cmd, CategoryConstraint, CodeInvalidRule, rule+".allowedDays",
+				fmt.Sprintf("command %q cannot be time-checked: %v", cmd, err))
+		}
+		if !ok {
+			return denyResult(cmd, CategoryConstraint, CodeOutsideTimeWindow, rule+".allowedDays",
+				fmt.Sprintf("command %q is only allowed on %s (today is %s)",
+					cmd, strings.Join(allowed.AllowedDays, ", "), now.Weekday()))
+		}
+	}
+
+	if len(allowed.AllowedHours) > 0 {
+		ok, err := isTimeOfDayAllowed(now, allowed.AllowedHours)
+		if err != nil {
+			return denyResult(cmd, CategoryConstraint, CodeInvalidRule, rule+".allowedHours",
+				fmt.Sprintf("command %q cannot be time-checked: %v", cmd, err))
+		}
+		if !ok {
+			return denyResult(cmd, CategoryConstraint, CodeOutsideTimeWindow, rule+".allowedHours",
+				fmt.Sprintf("command %q is only allowed during %s (current time is %s %s)",
+					cmd, strings.Join(allowed.AllowedHours, ", "), now.Format(clockLayout), loc))
+		}
+	}
+
+	return allowResult(cmd, rule)
+}
+
+// isDayAllowed reports whether day matches one of the configured day names.
+// Both abbreviated ("Mon") and full ("Monday") names are accepted, case-insensitively.
+func isDayAllowed(day time.Weekday, allowedDays []string) (bool, error) {
+	for _, name := range allowedDays {
+		parsed, err := parseWeekday(name)
+		if err != nil {
+			return false, err
+		}
+		if parsed == day {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// parseWeekday parses an abbreviated or full English weekday name.
+func parseWeekday(name string) (time.Weekday, error) {
+	const abbrevLen = 3
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		full := d.String()
+		if strings.EqualFold(name, full) || strings.EqualFold(name, full[:abbrevLen]) {
+			return d, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("invalid day %q in allowedDays", name)
+}
+
+// isTimeOfDayAllowed reports whether the clock time of now falls into one of the "HH:MM-HH:MM" ranges.
+// The start is inclusive and the end exclusive; a range whose end is before its start wraps past midnight.
+func isTimeOfDayAllowed(now time.Time, ranges []string) (bool, error) {
+	minute := now.Hour()*minutesPerHour + now.Minute()
+	for _, r := range ranges {
+		start, end, err := parseClockRange(r)
+		if err != nil {
+			return false, err
+		}
+		if start <= end {
+			if minute >= start && minute < end {
+				return true, nil
+			}
+		} else if minute >= start || minute < end {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// parseClockRange parses "HH:MM-HH:MM" into minutes since midnight.
+func parseClockRange(r string) (int, int, error) {
+	startStr, endStr, found := strings.Cut(r, "-")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid range %q in allowedHours, expected HH:MM-HH:MM", r)
+	}
+	start, err := time.Parse(clockLayout, strings.TrimSpace(startStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range %q in allowedHours, expected HH:MM-HH:MM", r)
+	}
+	end, err := time.Parse(clockLayout, strings.TrimSpace(endStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range %q in allowedHours, expected HH:MM-HH:MM", r)
+	}
+	return start.Hour()*minutesPerHour + start.Minute(), end.Hour()*minutesPerHour + end.Minute(), nil
+}
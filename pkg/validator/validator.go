@@ -1,10 +1,12 @@
 package validator
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/shimizu1995/secure-shell-server/pkg/config"
@@ -22,65 +24,105 @@ const (
 type CommandValidator struct {
 	config *config.ShellCommandConfig
 	logger *logger.Logger
+	// now returns the current time; replaced in tests to evaluate time windows and rate limits
+	now func() time.Time
+	// rateLimiter tracks per-command rate limits across validations
+	rateLimiter *rateLimiter
+	// templates holds the parsed messageTemplates keyed by validation code
+	templates map[Code]*template.Template
+	// blockLog is the block log, shared by the copies made for callers
+	blockLog *blockLog
+	// client is the client validations are done for, set on the copy made by forCaller.
+	// Rate limits are kept per client.
+	client string
+	// approved is set on the copy made by forCaller for runs a human approved
+	approved bool
+	// dryRun is set on the copy made by CheckScript, which checks rate limits without
+	// consuming them
+	dryRun bool
 }
 
 // New creates a new CommandValidator.
 func New(config *config.ShellCommandConfig, logger *logger.Logger) *CommandValidator {
-	return &CommandValidator{
-		config: config,
-		logger: logger,
-	}
+	v := &CommandValidator{
+		config:      config,
+		logger:      logger,
+		now:         time.Now,
+		rateLimiter: newRateLimiter(),
+		blockLog:    &blockLog{},
+	}
+	v.templates = v.parseMessageTemplates()
+	return v
 }
 
 // IsDirectoryAllowed checks if a given directory is allowed to run commands in.
 func (v *CommandValidator) IsDirectoryAllowed(dir string) (bool, string) {
+	result := v.ValidateDirectory(dir)
+	return result.Allowed, result.Message
+}
+
+// ValidateDirectory checks if a given directory is allowed to run commands in
+// and returns a structured result.
+func (v *CommandValidator) ValidateDirectory(dir string) ValidationResult {
+	return v.renderMessage(v.validateDirectory(dir))
+}
+
+// validateDirectory implements ValidateDirectory without rendering message templates.
+func (v *CommandValidator) validateDirectory(dir string) ValidationResult {
 	// If the directory is empty, it cannot be validated
 	if dir == "" {
-		return false, "empty directory path is not allowed"
+		return denyResult("", CategoryPath, CodeDirectoryNotAllowed, "allowedDirectories", "empty directory path is not allowed")
 	}
 
 	// Resolve symlinks to get the real path
 	resolvedDir := resolveSymlinksPath(dir)
 
+	if denied, ok := v.deniedPath(resolvedDir); ok {
+		return denyResult("", CategoryPath, CodePathDenied, "denyPaths",
+			fmt.Sprintf("directory %q is denied by %q: %s", dir, denied, v.config.DefaultErrorMessage))
+	}
+
 	// Check if the directory is in the allowed directories list or is a subdirectory of an allowed directory
 	for _, allowedDir := range v.config.AllowedDirectories {
 		resolvedAllowed := resolveSymlinksPath(allowedDir)
-		if strings.HasPrefix(resolvedDir, resolvedAllowed) {
-			return true, ""
+		if isWithinDir(resolvedDir, resolvedAllowed) {
+			return allowResult("", "allowedDirectories")
 		}
 	}
 
-	return false, fmt.Sprintf("directory %q is not allowed: %s", dir, v.config.DefaultErrorMessage)
+	return denyResult("", CategoryPath, CodeDirectoryNotAllowed, "allowedDirectories",
+		fmt.Sprintf("directory %q is not allowed: %s", dir, v.config.DefaultErrorMessage))
 }
 
 // IsPathInAllowedDirectory checks if a given path (absolute or relative) is within any of the allowed directories.
 func (v *CommandValidator) IsPathInAllowedDirectory(path string, baseDir string) (bool, string) {
+	result := v.ValidatePath(path, baseDir)
+	return result.Allowed, result.Message
+}
+
+// ValidatePath checks if a given path (absolute or relative to baseDir) is within any of the
+// allowed directories and returns a structured result.
+func (v *CommandValidator) ValidatePath(path string, baseDir string) ValidationResult {
+	return v.renderMessage(v.validatePath(path, baseDir))
+}
+
+// validatePath implements ValidatePath without rendering message templates.
+func (v *CommandValidator) validatePath(path string, baseDir string) ValidationResult {
 	// Handle empty path
 	if path == "" {
-		return false, "empty path is not allowed"
+		return denyResult("", CategoryPath, CodePathNotAllowed, "allowedDirectories", "empty path is not allowed")
 	}
 
-	// Determine if the path is absolute or relative
-	var absPath string
-	var err error
-	if filepath.IsAbs(path) {
-		absPath = path
-	} else {
-		// For relative paths, join with the base directory
-		absPath = filepath.Join(baseDir, path)
-	}
-
-	// Clean the path to resolve any . or .. components
-	absPath = filepath.Clean(absPath)
-
-	// Get absolute path to ensure proper comparison
-	absPath, err = filepath.Abs(absPath)
+	absPath, err := resolvePath(path, baseDir)
 	if err != nil {
-		return false, fmt.Sprintf("failed to resolve absolute path: %v", err)
+		return denyResult("", CategoryPath, CodePathNotAllowed, "allowedDirectories",
+			fmt.Sprintf("failed to resolve absolute path: %v", err))
 	}
 
-	// Resolve symlinks to get the real path
-	absPath = resolveSymlinksPath(absPath)
+	if denied, ok := v.deniedPath(absPath); ok {
+		return denyResult("", CategoryPath, CodePathDenied, "denyPaths",
+			fmt.Sprintf("path %q is denied by %q: %s", path, denied, v.config.DefaultErrorMessage))
+	}
 
 	// Check if the resolved path is within any allowed directory
 	for _, allowedDir := range v.config.AllowedDirectories {
@@ -94,12 +136,78 @@ func (v *CommandValidator) IsPathInAllowedDirectory(path string, baseDir string)
 		allowedAbsDir = resolveSymlinksPath(allowedAbsDir)
 
 		// Check if path is within the allowed directory
-		if strings.HasPrefix(absPath, allowedAbsDir) {
-			return true, ""
+		if isWithinDir(absPath, allowedAbsDir) {
+			return allowResult("", "allowedDirectories")
 		}
 	}
 
-	return false, fmt.Sprintf("path %q is outside of allowed directories: %s", path, v.config.DefaultErrorMessage)
+	return denyResult("", CategoryPath, CodePathNotAllowed, "allowedDirectories",
+		fmt.Sprintf("path %q is outside of allowed directories: %s", path, v.config.DefaultErrorMessage))
+}
+
+// ValidateFileAccess checks if a file may be opened, for writing if write is set, and returns a
+// structured result. The file must pass ValidatePath, and files in ReadOnlyDirectories may
+// only be read.
+func (v *CommandValidator) ValidateFileAccess(path string, baseDir string, write bool) ValidationResult {
+	result := v.validatePath(path, baseDir)
+	if !result.Allowed || !write {
+		return v.renderMessage(result)
+	}
+
+	absPath, err := resolvePath(path, baseDir)
+	if err != nil {
+		return v.renderMessage(denyResult("", CategoryPath, CodePathNotAllowed, "allowedDirectories",
+			fmt.Sprintf("failed to resolve absolute path: %v", err)))
+	}
+	for _, dir := range v.config.ReadOnlyDirectories {
+		if isWithinDir(absPath, resolveSymlinksPath(dir)) {
+			return v.renderMessage(denyResult("", CategoryPath, CodePathReadOnly, "readOnlyDirectories",
+				fmt.Sprintf("path %q is in read-only directory %q: %s", path, dir, v.config.DefaultErrorMessage)))
+		}
+	}
+	return v.renderMessage(result)
+}
+
+// resolvePath returns the absolute, symlink-resolved form of a path relative to baseDir.
+func resolvePath(path string, baseDir string) (string, error) {
+	// Determine if the path is absolute or relative
+	absPath := path
+	if !filepath.IsAbs(path) {
+		// For relative paths, join with the base directory
+		absPath = filepath.Join(baseDir, path)
+	}
+
+	// Clean the path to resolve any . or .. components, and get the absolute path to ensure
+	// proper comparison
+	absPath, err := filepath.Abs(filepath.Clean(absPath))
+	if err != nil {
+		return "", err
+	}
+
+	// Resolve symlinks to get the real path
+	return resolveSymlinksPath(absPath), nil
+}
+
+// deniedPath returns the denyPaths entry that covers the resolved path, if any.
+func (v *CommandValidator) deniedPath(resolvedPath string) (string, bool) {
+	for _, denied := range v.config.DenyPaths {
+		if isWithinDir(resolvedPath, resolveSymlinksPath(filepath.Clean(denied))) {
+			return denied, true
+		}
+	}
+	return "", false
+}
+
+// isWithinDir reports whether path is dir or lies below it. Both must be clean absolute paths;
+// unlike a plain prefix check, "/tmp/foobar" is not within "/tmp/foo".
+func isWithinDir(path, dir string) bool {
+	if path == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, dir)
 }
 
 // resolveSymlinksPath resolves symlinks in a path.
@@ -135,7 +243,39 @@ func (v *CommandValidator) isPathLike(arg string) bool {
 }
 
 // ValidateCommand checks if a command is allowed based on the configuration.
+// It is a compatibility shim around Validate that only returns the decision and message.
 func (v *CommandValidator) ValidateCommand(cmd string, args []string, workDir string) (bool, string) {
+	result := v.Validate(cmd, args, workDir)
+	return result.Allowed, result.Message
+}
+
+// Validate checks if a command is allowed based on the configuration and returns a structured result.
+// Messages of blocked results are rendered with the configured message templates.
+func (v *CommandValidator) Validate(cmd string, args []string, workDir string) ValidationResult {
+	return v.ValidateContext(context.Background(), cmd, args, workDir)
+}
+
+// ValidateContext is like Validate, but records the Caller carried by ctx in the block log.
+func (v *CommandValidator) ValidateContext(ctx context.Context, cmd string, args []string, workDir string) ValidationResult {
+	result := v.renderMessage(v.forCaller(ctx).validate(cmd, args, workDir))
+	if v.logger.Enabled(logger.LevelDebug) {
+		v.logger.LogDebugf("Validated %s %q in %s: allowed=%t code=%s rule=%s",
+			cmd, args, workDir, result.Allowed, result.Code, result.Rule)
+	}
+	if !result.Allowed {
+		record := v.newBlockRecord(ctx, result, workDir)
+		if record.Command == "" {
+			record.Command = cmd
+		}
+		record.Args = args
+		v.logBlockedCommand(record)
+	}
+	return result
+}
+
+// validate implements Validate without rendering message templates, so nested commands
+// (xargs, find -exec) keep their built-in messages until the outermost result is rendered.
+func (v *CommandValidator) validate(cmd string, args []string, workDir string) ValidationResult {
 	// Special handling for xargs command
 	if cmd == "xargs" {
 		return v.validateXargsCommand(args, workDir)
@@ -156,39 +296,92 @@ func (v *CommandValidator) ValidateCommand(cmd string, args []string, workDir st
 		return v.validateSedCommand(cmd, args, workDir)
 	}
 
+	// Special handling for wrappers that run other commands (sh -c, env)
+	if IsShellCommand(cmd) {
+		return v.validateShellCommand(cmd, args, workDir)
+	}
+	if cmd == "env" {
+		return v.validateEnvCommand(args, workDir)
+	}
+
+	// Special handling for archive extraction targets (tar -C/-f, unzip -d)
+	if IsTarCommand(cmd) || IsUnzipCommand(cmd) {
+		return v.validateArchiveCommand(cmd, args, workDir)
+	}
+
+	// Check the deny list, the allow list and the allow rule's constraints
+	allowed, result := v.checkCommandAllowed(cmd, args)
+	if !result.Allowed {
+		return result
+	}
+
+	// If there are no subcommands specified, the command is allowed without restrictions
+	if len(allowed.SubCommands) == 0 && len(allowed.DenySubCommands) == 0 {
+		// Check path-like arguments even for fully allowed commands
+		return v.validatePathArguments(cmd, args, workDir)
+	}
+
+	// Check subcommand permissions
+	if result := v.checkSubCommandPermissions(cmd, args, *allowed); !result.Allowed {
+		return result
+	}
+
+	// If subcommand is allowed, also validate any path-like arguments
+	return v.validatePathArguments(cmd, args, workDir)
+}
+
+// checkCommandAllowed checks that a command is not explicitly denied, is present in the
+// allow list, and satisfies the constraints of its allow rule. It returns the matching rule.
+func (v *CommandValidator) checkCommandAllowed(cmd string, args []string) (*config.AllowCommand, ValidationResult) {
 	// Check if the command is explicitly denied
-	if denied, message := v.isCommandExplicitlyDenied(cmd); denied {
-		v.logBlockedCommand(cmd, args, message)
-		return false, message
+	if result := v.checkExplicitlyDenied(cmd); !result.Allowed {
+		return nil, result
 	}
 
 	// Check if the command is explicitly allowed
-	for _, allowed := range v.config.AllowCommands {
-		if allowed.Command == cmd {
-			// If there are no subcommands specified, the command is allowed without restrictions
-			if len(allowed.SubCommands) == 0 && len(allowed.DenySubCommands) == 0 {
-				// Check path-like arguments even for fully allowed commands
-				return v.validatePathArguments(cmd, args, workDir)
-			}
-
-			// Check subcommand permissions
-			if allowed, message := v.checkSubCommandPermissions(cmd, args, allowed); !allowed {
-				return false, message
-			}
+	allowed := v.config.GetAllowCommand(cmd)
+	if allowed == nil {
+		deniedMessage := fmt.Sprintf("command %q is not permitted: %s", cmd, v.config.DefaultErrorMessage)
+		return nil, denyResult(cmd, CategoryNotListed, CodeCommandNotAllowed, "allowCommands", deniedMessage)
+	}
 
-			// If subcommand is allowed, also validate any path-like arguments
-			return v.validatePathArguments(cmd, args, workDir)
+	// Check flags denied for the command as a whole
+	if len(allowed.DenyFlags) > 0 {
+		level := subCommandLevel{
+			cmdPath:   cmd,
+			rulePath:  allowRuleName(cmd),
+			denyFlags: allowed.DenyFlags,
+			message:   allowed.Message,
+			docURL:    allowed.DocURL,
 		}
+		if result := v.checkDenyFlags(cmd, level, args); !result.Allowed {
+			return nil, result
+		}
+	}
+
+	// Check if the command needs a human's approval
+	if result := v.checkApproval(cmd, args); !result.Allowed {
+		result.DocURL = allowed.DocURL
+		return nil, result
+	}
+
+	// Check if the command may run at the current time
+	if result := v.checkTimeWindow(cmd, allowed); !result.Allowed {
+		result.DocURL = allowed.DocURL
+		return nil, result
+	}
+
+	// Check if the command's rate limit has been exceeded
+	if result := v.checkRateLimit(cmd, allowed); !result.Allowed {
+		result.DocURL = allowed.DocURL
+		return nil, result
 	}
 
-	// If command was not found in the allow list, it's denied
-	deniedMessage := fmt.Sprintf("command %q is not permitted: %s", cmd, v.config.DefaultErrorMessage)
-	v.logBlockedCommand(cmd, args, deniedMessage)
-	return false, deniedMessage
+	return allowed, allowResult(cmd, allowRuleName(cmd))
 }
 
 // validatePathArguments checks if any path-like arguments are within allowed directories.
-func (v *CommandValidator) validatePathArguments(cmd string, args []string, workDir string) (bool, string) {
+func (v *CommandValidator) validatePathArguments(cmd string, args []string, workDir string) ValidationResult {
 	for _, arg := range args {
 		// Skip arguments that don't look like paths or that start with a dash (flags)
 		if strings.HasPrefix(arg, "-") || !v.isPathLike(arg) {
@@ -196,93 +389,132 @@ func (v *CommandValidator) validatePathArguments(cmd string, args []string, work
 		}
 
 		// Validate the path argument
-		allowed, message := v.IsPathInAllowedDirectory(arg, workDir)
-		if !allowed {
-			v.logBlockedCommand(cmd, args, message)
-			return false, message
+		if result := v.validatePath(arg, workDir); !result.Allowed {
+			result.Command = cmd
+			return result
 		}
 	}
 
-	return true, ""
+	return allowResult(cmd, allowRuleName(cmd))
 }
 
-// isCommandExplicitlyDenied checks if a command is explicitly denied in the configuration.
-func (v *CommandValidator) isCommandExplicitlyDenied(cmd string) (bool, string) {
+// checkExplicitlyDenied checks if a command is explicitly denied in the configuration.
+func (v *CommandValidator) checkExplicitlyDenied(cmd string) ValidationResult {
 	for _, denied := range v.config.DenyCommands {
 		if denied.Command == cmd {
 			message := v.config.DefaultErrorMessage
 			if denied.Message != "" {
 				message = denied.Message
 			}
-			return true, fmt.Sprintf("command %q is denied: %s", cmd, message)
+			result := denyResult(cmd, CategoryDenied, CodeCommandDenied,
+				fmt.Sprintf("denyCommands[%s]", cmd), fmt.Sprintf("command %q is denied: %s", cmd, message))
+			result.DocURL = denied.DocURL
+			return result
 		}
 	}
-	return false, ""
+	return allowResult(cmd, "")
 }
 
 // checkSubCommandPermissions checks if the subcommand is allowed for the specified command.
 // It delegates to the recursive checkSubCommandRule for the top-level AllowCommand.
-func (v *CommandValidator) checkSubCommandPermissions(cmd string, args []string, allowed config.AllowCommand) (bool, string) {
+func (v *CommandValidator) checkSubCommandPermissions(cmd string, args []string, allowed config.AllowCommand) ValidationResult {
 	// Convert top-level AllowCommand into a SubCommandRule-compatible check
-	return v.checkSubCommandRule(cmd, args, allowed.SubCommands, allowed.DenySubCommands, nil, "")
+	level := subCommandLevel{
+		cmdPath:         cmd,
+		rulePath:        allowRuleName(cmd),
+		subCommands:     allowed.SubCommands,
+		denySubCommands: allowed.DenySubCommands,
+		docURL:          allowed.DocURL,
+	}
+	return v.checkSubCommandRule(cmd, level, args)
+}
+
+// subCommandLevel describes the rules that apply at one level of a SubCommandRule tree.
+type subCommandLevel struct {
+	// cmdPath is the command path so far (e.g. "git" or "docker compose") for error messages.
+	cmdPath string
+	// rulePath identifies the rule in the configuration (e.g. "allowCommands[git].subCommands[push]").
+	rulePath string
+	// subCommands is the list of allowed sub-command rules at this level.
+	subCommands []config.SubCommandRule
+	// denySubCommands is the list of denied sub-commands at this level.
+	denySubCommands []string
+	// denyFlags is the list of denied flags at this level.
+	denyFlags []string
+	// message is a custom error message for denied flags at this level.
+	message string
+	// docURL is the documentation link reported for denials at this level.
+	docURL string
 }
 
 // checkSubCommandRule recursively validates args against a SubCommandRule tree.
-// cmdPath is the command path so far (e.g. "git" or "docker compose") for error messages.
-// subCommands is the list of allowed sub-command rules at this level.
-// denySubCommands is the list of denied sub-commands at this level.
-// denyFlags is the list of denied flags at this level.
-// message is a custom error message for denied flags at this level.
-func (v *CommandValidator) checkSubCommandRule(cmdPath string, args []string, subCommands []config.SubCommandRule, denySubCommands []string, denyFlags []string, message string) (bool, string) {
+func (v *CommandValidator) checkSubCommandRule(cmd string, level subCommandLevel, args []string) ValidationResult {
 	// If no more args, nothing to deny
 	if len(args) == 0 {
-		return true, ""
+		return allowResult(cmd, level.rulePath)
 	}
 
 	// Check denied subcommands at this level
-	for _, denied := range denySubCommands {
+	for _, denied := range level.denySubCommands {
 		if args[0] == denied {
-			deniedMessage := fmt.Sprintf("subcommand %q is denied for command %q", args[0], cmdPath)
-			v.logBlockedCommand(cmdPath, args, deniedMessage)
-			return false, deniedMessage
+			deniedMessage := fmt.Sprintf("subcommand %q is denied for command %q", args[0], level.cmdPath)
+			result := denyResult(cmd, CategorySubCommand, CodeSubCommandDenied,
+				fmt.Sprintf("%s.denySubCommands[%s]", level.rulePath, denied), deniedMessage)
+			result.DocURL = level.docURL
+			return result
 		}
 	}
 
 	// If there are subcommand rules, try to match args[0] against them
-	if len(subCommands) > 0 {
-		for _, rule := range subCommands {
+	if len(level.subCommands) > 0 {
+		for _, rule := range level.subCommands {
 			if rule.Name == args[0] {
-				// Found a matching rule — recurse into it
-				nextPath := cmdPath + " " + args[0]
-				return v.checkSubCommandRule(nextPath, args[1:], rule.SubCommands, rule.DenySubCommands, rule.DenyFlags, rule.Message)
+				// Found a matching rule — recurse into it, inheriting the parent's doc link
+				docURL := level.docURL
+				if rule.DocURL != "" {
+					docURL = rule.DocURL
+				}
+				next := subCommandLevel{
+					cmdPath:         level.cmdPath + " " + args[0],
+					rulePath:        fmt.Sprintf("%s.subCommands[%s]", level.rulePath, rule.Name),
+					subCommands:     rule.SubCommands,
+					denySubCommands: rule.DenySubCommands,
+					denyFlags:       rule.DenyFlags,
+					message:         rule.Message,
+					docURL:          docURL,
+				}
+				return v.checkSubCommandRule(cmd, next, args[1:])
 			}
 		}
 
 		// args[0] not found in allowed subcommands (allowlist mode) — deny
-		deniedMessage := fmt.Sprintf("subcommand %q is not allowed for command %q", args[0], cmdPath)
-		v.logBlockedCommand(cmdPath, args, deniedMessage)
-		return false, deniedMessage
+		deniedMessage := fmt.Sprintf("subcommand %q is not allowed for command %q", args[0], level.cmdPath)
+		result := denyResult(cmd, CategorySubCommand, CodeSubCommandNotAllowed, level.rulePath+".subCommands", deniedMessage)
+		result.DocURL = level.docURL
+		return result
 	}
 
 	// No subcommand rules at this level — check denyFlags against all remaining args
-	return v.checkDenyFlags(cmdPath, args, denyFlags, message)
+	return v.checkDenyFlags(cmd, level, args)
 }
 
-// checkDenyFlags scans args for any flag in denyFlags.
-func (v *CommandValidator) checkDenyFlags(cmdPath string, args []string, denyFlags []string, message string) (bool, string) {
+// checkDenyFlags scans args for any flag in the level's denyFlags.
+func (v *CommandValidator) checkDenyFlags(cmd string, level subCommandLevel, args []string) ValidationResult {
 	for _, arg := range args {
-		for _, denied := range denyFlags {
+		for _, denied := range level.denyFlags {
 			if isDenyFlagMatch(arg, denied) {
-				deniedMessage := fmt.Sprintf("flag %q is not allowed for command %q", denied, cmdPath)
-				if message != "" {
-					deniedMessage += ": " + message
+				deniedMessage := fmt.Sprintf("flag %q is not allowed for command %q", denied, level.cmdPath)
+				if level.message != "" {
+					deniedMessage += ": " + level.message
 				}
-				v.logBlockedCommand(cmdPath, args, deniedMessage)
-				return false, deniedMessage
+				result := denyResult(cmd, CategorySubCommand, CodeFlagDenied,
+					fmt.Sprintf("%s.denyFlags[%s]", level.rulePath, denied), deniedMessage)
+				result.DocURL = level.docURL
+				return result
 			}
 		}
 	}
-	return true, ""
+	return allowResult(cmd, level.rulePath)
 }
 
 // isDenyFlagMatch checks if an argument matches a denied flag.
@@ -318,18 +550,10 @@ func isDenyFlagMatch(arg, denied string) bool {
 }
 
 // validateXargsCommand checks if the command executed by xargs is allowed.
-func (v *CommandValidator) validateXargsCommand(args []string, workDir string) (bool, string) {
+func (v *CommandValidator) validateXargsCommand(args []string, workDir string) ValidationResult {
 	// First check if xargs itself is allowed
-	if denied, message := v.isCommandExplicitlyDenied("xargs"); denied {
-		v.logBlockedCommand("xargs", args, message)
-		return false, message
-	}
-
-	// Check if xargs is explicitly allowed
-	if !v.config.IsCommandAllowed("xargs") {
-		deniedMessage := fmt.Sprintf("command %q is not permitted: %s", "xargs", v.config.DefaultErrorMessage)
-		v.logBlockedCommand("xargs", args, deniedMessage)
-		return false, deniedMessage
+	if _, result := v.checkCommandAllowed("xargs", args); !result.Allowed {
+		return result
 	}
 
 	// Parse the xargs command to extract the actual command
@@ -337,44 +561,71 @@ func (v *CommandValidator) validateXargsCommand(args []string, workDir string) (
 	xargsCmd, xargsArgs, valid, errMsg := parser.ParseXargsCommand(args)
 
 	if !valid {
-		v.logBlockedCommand("xargs", args, errMsg)
-		return false, errMsg
+		return denyResult("xargs", CategoryDangerous, CodeUnparsableCommand, allowRuleName("xargs"), errMsg)
+	}
+
+	// Input files given with -a must be within allowed directories
+	for _, file := range parser.ParseXargsArgFiles(args) {
+		if result := v.validatePath(file, workDir); !result.Allowed {
+			result.Command = "xargs"
+			result.Message = "xargs -a path is not allowed: " + result.Message
+			return result
+		}
+	}
+
+	// A shell must run a fixed script: input items could be scripts themselves
+	if shell := inputScriptShell(xargsCmd, xargsArgs, parser.ParseXargsReplaceString(args)); shell != "" {
+		message := fmt.Sprintf("xargs would execute disallowed command: %s would run a script taken from the input of xargs", shell)
+		return denyResult(shell, CategoryDangerous, CodeUnparsableCommand, allowRuleName(shell), message)
 	}
 
 	// Now validate the command that xargs will execute
-	allowed, message := v.ValidateCommand(xargsCmd, xargsArgs, workDir)
-	if !allowed {
+	result := v.validate(xargsCmd, xargsArgs, workDir)
+	if !result.Allowed {
 		// Add context that this is from an xargs command
-		message = "xargs would execute disallowed command: " + message
-		v.logBlockedCommand("xargs", args, message)
-		return false, message
+		result.Message = "xargs would execute disallowed command: " + result.Message
+		return result
 	}
 
-	return true, ""
+	return allowResult("xargs", allowRuleName("xargs"))
 }
 
 // validateFindCommand checks if find command has -exec with allowed commands only.
-func (v *CommandValidator) validateFindCommand(args []string, workDir string) (bool, string) {
+func (v *CommandValidator) validateFindCommand(args []string, workDir string) ValidationResult {
 	// First check if find itself is allowed
-	if denied, message := v.isCommandExplicitlyDenied("find"); denied {
-		v.logBlockedCommand("find", args, message)
-		return false, message
+	if _, result := v.checkCommandAllowed("find", args); !result.Allowed {
+		return result
 	}
 
-	// Check if find is explicitly allowed
-	if !v.config.IsCommandAllowed("find") {
-		deniedMessage := fmt.Sprintf("command %q is not permitted: %s", "find", v.config.DefaultErrorMessage)
-		v.logBlockedCommand("find", args, deniedMessage)
-		return false, deniedMessage
+	parser := NewFindParser()
+
+	// Every starting point must be within allowed directories, whether or not it looks like a path
+	for _, root := range parser.ParseFindRoots(args) {
+		if result := v.validatePath(root, workDir); !result.Allowed {
+			result.Command = "find"
+			result.Message = "find search root is not allowed: " + result.Message
+			return result
+		}
 	}
 
 	// Check for -exec commands in find args
-	parser := NewFindParser()
 	execCommands, hasExec, errMsg := parser.ParseFindExecArgs(args)
 
 	if errMsg != "" {
-		v.logBlockedCommand("find", args, errMsg)
-		return false, errMsg
+		return denyResult("find", CategoryDangerous, CodeUnparsableCommand, allowRuleName("find"), errMsg)
+	}
+
+	// Files written by -fprint and similar actions must be within allowed directories
+	outputFiles, errMsg := parser.ParseFindOutputFiles(args)
+	if errMsg != "" {
+		return denyResult("find", CategoryDangerous, CodeUnparsableCommand, allowRuleName("find"), errMsg)
+	}
+	for _, file := range outputFiles {
+		if result := v.validatePath(file.Path, workDir); !result.Allowed {
+			result.Command = "find"
+			result.Message = fmt.Sprintf("find %s path is not allowed: %s", file.Action, result.Message)
+			return result
+		}
 	}
 
 	// If no -exec found, the find command is allowed (we still need to validate paths)
@@ -384,13 +635,23 @@ func (v *CommandValidator) validateFindCommand(args []string, workDir string) (b
 		return v.validatePathArguments("find", filteredArgs, workDir)
 	}
 
+	// A shell must run a fixed script: find replaces {} with file names, which could be scripts
+	for _, clause := range extractExecClauses(args) {
+		if len(clause) == 0 {
+			continue
+		}
+		if shell := inputScriptShell(clause[0], clause[1:], "{}"); shell != "" {
+			message := fmt.Sprintf("find command contains disallowed -exec: %s would run a script taken from the file names find passes", shell)
+			return denyResult(shell, CategoryDangerous, CodeUnparsableCommand, allowRuleName(shell), message)
+		}
+	}
+
 	// Validate each -exec command with its full arguments
 	for _, execCmd := range execCommands {
-		allowed, message := v.ValidateCommand(execCmd.Name, execCmd.Args, workDir)
-		if !allowed {
-			message = "find command contains disallowed -exec: " + message
-			v.logBlockedCommand("find", args, message)
-			return false, message
+		result := v.validate(execCmd.Name, execCmd.Args, workDir)
+		if !result.Allowed {
+			result.Message = "find command contains disallowed -exec: " + result.Message
+			return result
 		}
 	}
 
@@ -401,26 +662,22 @@ func (v *CommandValidator) validateFindCommand(args []string, workDir string) (b
 }
 
 // validateAwkCommand checks if an awk command contains dangerous patterns.
-func (v *CommandValidator) validateAwkCommand(cmd string, args []string, workDir string) (bool, string) {
-	// Check if the command is explicitly denied
-	if denied, message := v.isCommandExplicitlyDenied(cmd); denied {
-		v.logBlockedCommand(cmd, args, message)
-		return false, message
-	}
-
-	// Check if the command is explicitly allowed
-	if !v.config.IsCommandAllowed(cmd) {
-		deniedMessage := fmt.Sprintf("command %q is not permitted: %s", cmd, v.config.DefaultErrorMessage)
-		v.logBlockedCommand(cmd, args, deniedMessage)
-		return false, deniedMessage
-	}
-
-	// Check for dangerous patterns in awk script
-	awkValidator := NewAwkValidator()
-	if hasDanger, description := awkValidator.ValidateAwkArgs(args); hasDanger {
-		message := fmt.Sprintf("%s command blocked: %s", cmd, description)
-		v.logBlockedCommand(cmd, args, message)
-		return false, message
+func (v *CommandValidator) validateAwkCommand(cmd string, args []string, workDir string) ValidationResult {
+	// Check if the command itself is allowed
+	allowed, result := v.checkCommandAllowed(cmd, args)
+	if !result.Allowed {
+		return result
+	}
+
+	// Check for dangerous patterns in awk script unless inspection is disabled for the command
+	if allowed.ScriptInspectionEnabled() {
+		awkValidator := NewAwkValidator()
+		if hasDanger, description := awkValidator.ValidateAwkArgs(args); hasDanger {
+			message := fmt.Sprintf("%s command blocked: %s", cmd, description)
+			result := denyResult(cmd, CategoryDangerous, CodeDangerousPattern, allowRuleName(cmd), message)
+			result.DocURL = allowed.DocURL
+			return result
+		}
 	}
 
 	// Validate path arguments, filtering out the awk script and flags
@@ -429,26 +686,31 @@ func (v *CommandValidator) validateAwkCommand(cmd string, args []string, workDir
 }
 
 // validateSedCommand checks if a sed command contains dangerous patterns.
-func (v *CommandValidator) validateSedCommand(cmd string, args []string, workDir string) (bool, string) {
-	// Check if the command is explicitly denied
-	if denied, message := v.isCommandExplicitlyDenied(cmd); denied {
-		v.logBlockedCommand(cmd, args, message)
-		return false, message
-	}
-
-	// Check if the command is explicitly allowed
-	if !v.config.IsCommandAllowed(cmd) {
-		deniedMessage := fmt.Sprintf("command %q is not permitted: %s", cmd, v.config.DefaultErrorMessage)
-		v.logBlockedCommand(cmd, args, deniedMessage)
-		return false, deniedMessage
-	}
+func (v *CommandValidator) validateSedCommand(cmd string, args []string, workDir string) ValidationResult {
+	// Check if the command itself is allowed
+	allowed, result := v.checkCommandAllowed(cmd, args)
+	if !result.Allowed {
+		return result
+	}
+
+	// Check for dangerous patterns and writes in sed script unless inspection is disabled for the command
+	if allowed.ScriptInspectionEnabled() {
+		sedValidator := NewSedValidator()
+		if hasDanger, description := sedValidator.ValidateSedArgs(args); hasDanger {
+			message := fmt.Sprintf("%s command blocked: %s", cmd, description)
+			result := denyResult(cmd, CategoryDangerous, CodeDangerousPattern, allowRuleName(cmd), message)
+			result.DocURL = allowed.DocURL
+			return result
+		}
 
-	// Check for dangerous patterns in sed script
-	sedValidator := NewSedValidator()
-	if hasDanger, description := sedValidator.ValidateSedArgs(args); hasDanger {
-		message := fmt.Sprintf("%s command blocked: %s", cmd, description)
-		v.logBlockedCommand(cmd, args, message)
-		return false, message
+		// Files written with 'w' must be within allowed directories like any other path
+		for _, target := range sedValidator.SedWriteTargets(args) {
+			if result := v.validatePath(target, workDir); !result.Allowed {
+				result.Command = cmd
+				result.Message = fmt.Sprintf("%s script writes to a file that is not allowed: %s", cmd, result.Message)
+				return result
+			}
+		}
 	}
 
 	// Validate path arguments, filtering out sed scripts and expressions
@@ -456,33 +718,225 @@ func (v *CommandValidator) validateSedCommand(cmd string, args []string, workDir
 	return v.validatePathArguments(cmd, filteredArgs, workDir)
 }
 
-// logBlockedCommand logs blocked commands to the specified file.
-func (v *CommandValidator) logBlockedCommand(cmd string, args []string, reason string) {
-	if v.config.BlockLogPath == "" {
-		return
+// validateShellCommand checks every command and redirection of a script run with sh -c. Shells
+// running a script file or standard input are blocked, since their commands cannot be checked.
+func (v *CommandValidator) validateShellCommand(cmd string, args []string, workDir string) ValidationResult {
+	// Check if the shell itself is allowed
+	if _, result := v.checkCommandAllowed(cmd, args); !result.Allowed {
+		return result
 	}
 
-	// Ensure the directory exists
-	dir := filepath.Dir(v.config.BlockLogPath)
-	if err := os.MkdirAll(dir, DirPermissions); err != nil {
-		v.logger.LogErrorf("Failed to create directory for block log: %v", err)
-		return
+	script, operands, found := ParseShellScriptArg(args)
+	if !found {
+		// The shell runs a script file or reads standard input, whose commands are not known
+		message := fmt.Sprintf("%s can only run a script given with -c, not a script file or standard input", cmd)
+		return denyResult(cmd, CategoryDangerous, CodeUnparsableCommand, allowRuleName(cmd), message)
 	}
 
-	// Open the log file in append mode
-	f, err := os.OpenFile(v.config.BlockLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, FilePermissions)
-	if err != nil {
-		v.logger.LogErrorf("Failed to open block log file: %v", err)
-		return
+	parsed, errMsg := ParseShellScript(script)
+	if errMsg != "" {
+		message := fmt.Sprintf("%s -c %s", cmd, errMsg)
+		return denyResult(cmd, CategoryDangerous, CodeUnparsableCommand, allowRuleName(cmd), message)
+	}
+
+	if result, redirect := v.validateScript(parsed, workDir); !result.Allowed {
+		if redirect {
+			result.Command = cmd
+			result.Message = fmt.Sprintf("%s -c script redirects to a file that is not allowed: %s", cmd, result.Message)
+		} else {
+			result.Message = fmt.Sprintf("%s -c would execute disallowed command: %s", cmd, result.Message)
+		}
+		return result
+	}
+
+	// The shell expands the arguments of its commands without them being validated again,
+	// so arguments whose value is unknown here could name any path
+	for _, scriptCmd := range parsed.Commands {
+		if scriptCmd.Dynamic {
+			message := fmt.Sprintf("%s -c script passes %s an argument whose value cannot be determined statically", cmd, scriptCmd.Name)
+			return denyResult(cmd, CategoryDangerous, CodeUnparsableCommand, allowRuleName(cmd), message)
+		}
+	}
+
+	// Remaining operands are passed to the script as positional parameters
+	return v.validatePathArguments(cmd, operands, workDir)
+}
+
+// ValidateScript checks every command and redirection of a script before it runs, like the
+// script of sh -c. Commands whose name is not a static word cannot be checked and are
+// blocked. Rate limits are consumed as if the commands ran.
+func (v *CommandValidator) ValidateScript(script string, workDir string) ValidationResult {
+	return v.ValidateScriptContext(context.Background(), script, workDir)
+}
+
+// ValidateScriptContext is like ValidateScript, but records the Caller carried by ctx in the
+// block log.
+func (v *CommandValidator) ValidateScriptContext(ctx context.Context, script string, workDir string) ValidationResult {
+	result := v.forCaller(ctx).checkScript(script, workDir)
+	if !result.Allowed {
+		record := v.newBlockRecord(ctx, result, workDir)
+		record.Script = script
+		v.logBlockedCommand(record)
 	}
-	defer f.Close()
+	return result
+}
 
-	// Create log entry
-	timestamp := time.Now().Format(time.RFC3339)
-	logEntry := fmt.Sprintf("%s [BLOCKED] Command: %s %v, Reason: %s\n", timestamp, cmd, args, reason)
+// CheckScript returns the verdict ValidateScriptContext would return for script without
+// affecting later validations: rate limits are checked but not consumed, and blocked
+// scripts are not written to the block log.
+func (v *CommandValidator) CheckScript(ctx context.Context, script string, workDir string) ValidationResult {
+	c := *v.forCaller(ctx)
+	c.dryRun = true
+	return c.checkScript(script, workDir)
+}
+
+// checkScript parses and validates script and renders the message of the result.
+func (v *CommandValidator) checkScript(script string, workDir string) ValidationResult {
+	parsed, errMsg := ParseShellScript(script)
+	if errMsg != "" {
+		return v.renderMessage(denyResult("", CategoryDangerous, CodeUnparsableCommand, "", errMsg))
+	}
+	result, redirect := v.validateScript(parsed, workDir)
+	if !result.Allowed && redirect {
+		result.Message = "script redirects to a file that is not allowed: " + result.Message
+	}
+	return v.renderMessage(result)
+}
 
-	// Write to log file
-	if _, err := f.WriteString(logEntry); err != nil {
-		v.logger.LogErrorf("Failed to write to block log file: %v", err)
+// validateScript checks the redirections and commands of a parsed script. redirect reports
+// whether a blocked result comes from a redirection.
+func (v *CommandValidator) validateScript(parsed *ShellScript, workDir string) (result ValidationResult, redirect bool) {
+	for _, target := range parsed.Redirects {
+		if result := v.validatePath(target, workDir); !result.Allowed {
+			return result, true
+		}
 	}
+
+	// Validate each command, following cd so that relative paths are checked where they point
+	scriptDir, previousDir := workDir, workDir
+	for _, scriptCmd := range parsed.Commands {
+		name := scriptCmd.Name
+		if filepath.IsAbs(name) {
+			name = filepath.Base(name)
+		}
+
+		if result := v.validate(name, scriptCmd.Args, scriptDir); !result.Allowed {
+			return result, false
+		}
+
+		if name == "cd" {
+			scriptDir, previousDir = cdTarget(scriptDir, previousDir, scriptCmd.Args), scriptDir
+		}
+	}
+	return allowResult("", ""), false
+}
+
+// validateEnvCommand checks the command run by env, in the directory given with -C.
+func (v *CommandValidator) validateEnvCommand(args []string, workDir string) ValidationResult {
+	// Check if env itself is allowed
+	if _, result := v.checkCommandAllowed("env", args); !result.Allowed {
+		return result
+	}
+
+	envCmd, errMsg := ParseEnvCommand(args)
+	if errMsg != "" {
+		return denyResult("env", CategoryDangerous, CodeUnparsableCommand, allowRuleName("env"), errMsg)
+	}
+
+	if envCmd.Dir != "" {
+		if result := v.validatePath(envCmd.Dir, workDir); !result.Allowed {
+			result.Command = "env"
+			result.Message = "env -C path is not allowed: " + result.Message
+			return result
+		}
+		workDir = resolveWorkDir(workDir, envCmd.Dir)
+	}
+
+	// Without a command, env prints the environment
+	if envCmd.Cmd == "" {
+		return allowResult("env", allowRuleName("env"))
+	}
+
+	name := envCmd.Cmd
+	if filepath.IsAbs(name) {
+		name = filepath.Base(name)
+	}
+
+	result := v.validate(name, envCmd.Args, workDir)
+	if !result.Allowed {
+		result.Message = "env would execute disallowed command: " + result.Message
+		return result
+	}
+
+	return allowResult("env", allowRuleName("env"))
+}
+
+// cdTarget returns the directory a cd with args changes into from dir, given the previous
+// directory for "cd -". Without an operand, or with "~", cd changes into the home directory.
+func cdTarget(dir string, previousDir string, args []string) string {
+	target := ""
+	for _, arg := range args {
+		if arg == "-" || !strings.HasPrefix(arg, "-") {
+			target = arg
+		}
+	}
+
+	switch {
+	case target == "-":
+		return previousDir
+	case target == "" || target == "~" || strings.HasPrefix(target, "~/"):
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return dir
+		}
+		return filepath.Join(home, strings.TrimPrefix(strings.TrimPrefix(target, "~"), "/"))
+	}
+	return resolveWorkDir(dir, target)
+}
+
+// resolveWorkDir returns the directory dir refers to when changing into it from workDir.
+func resolveWorkDir(workDir string, dir string) string {
+	if filepath.IsAbs(dir) {
+		return filepath.Clean(dir)
+	}
+	return filepath.Join(workDir, dir)
+}
+
+// validateArchiveCommand checks that the archive and extraction directory of tar and unzip
+// are within allowed directories, whether or not they look like paths.
+func (v *CommandValidator) validateArchiveCommand(cmd string, args []string, workDir string) ValidationResult {
+	// Check if the command itself is allowed
+	allowed, result := v.checkCommandAllowed(cmd, args)
+	if !result.Allowed {
+		return result
+	}
+
+	// Check subcommand permissions if the rule has any
+	if len(allowed.SubCommands) > 0 || len(allowed.DenySubCommands) > 0 {
+		if result := v.checkSubCommandPermissions(cmd, args, *allowed); !result.Allowed {
+			return result
+		}
+	}
+
+	var paths []ArchivePath
+	var errMsg string
+	if IsTarCommand(cmd) {
+		paths, errMsg = ParseTarPaths(args)
+	} else {
+		paths, errMsg = ParseUnzipPaths(args)
+	}
+	if errMsg != "" {
+		return denyResult(cmd, CategoryPath, CodeUnparsableCommand, allowRuleName(cmd), errMsg)
+	}
+
+	for _, p := range paths {
+		if result := v.validatePath(p.Path, workDir); !result.Allowed {
+			result.Command = cmd
+			result.Message = fmt.Sprintf("%s %s path is not allowed: %s", cmd, p.Option, result.Message)
+			return result
+		}
+	}
+
+	// Validate the remaining path-like arguments (member names) as for any other command
+	return v.validatePathArguments(cmd, args, workDir)
 }
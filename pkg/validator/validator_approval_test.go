@@ -0,0 +1,48 @@
+package validator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+)
+
+func TestRequireApproval(t *testing.T) {
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{"/tmp"},
+		AllowCommands:       []config.AllowCommand{{Command: "git"}, {Command: "terraform"}, {Command: "sh"}},
+		DefaultErrorMessage: "Command not allowed",
+		RequireApproval:     []string{"git push", "terraform apply"},
+	}
+	v := New(cfg, logger.New())
+	approved := WithCaller(context.Background(), Caller{Client: "ci", Approved: true})
+
+	tests := []struct {
+		name     string
+		cmd      string
+		args     []string
+		approval bool
+	}{
+		{"listed subcommand", "git", []string{"push", "origin", "main"}, true},
+		{"flags before subcommand", "git", []string{"-C", "repo", "push"}, true},
+		{"other subcommand", "git", []string{"status"}, false},
+		{"word as later argument", "terraform", []string{"plan", "-out", "apply"}, true},
+		{"other command", "terraform", []string{"plan"}, false},
+		{"nested in sh -c", "sh", []string{"-c", "git push"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := v.ValidateContext(context.Background(), tt.cmd, tt.args, "/tmp")
+			if got := result.Code == CodeApprovalRequired; got != tt.approval {
+				t.Fatalf("Validate(%s %v) = %+v, want approval required %t", tt.cmd, tt.args, result, tt.approval)
+			}
+			if tt.approval && result.Category != CategoryApproval {
+				t.Errorf("Category = %q, want %q", result.Category, CategoryApproval)
+			}
+			if result := v.ValidateContext(approved, tt.cmd, tt.args, "/tmp"); !result.Allowed {
+				t.Errorf("approved Validate(%s %v) = %+v, want allowed", tt.cmd, tt.args, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package validator
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+)
+
+// TestValidateArchiveCommand tests tar and unzip validation through ValidateCommand.
+func TestValidateArchiveCommand(t *testing.T) {
+	workDir := t.TempDir()
+	outsideDir := t.TempDir()
+
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "tar"},
+			{Command: "unzip"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+	}
+	v := New(cfg, logger.NewWithWriter(io.Discard))
+
+	outsideMessage := func(cmd string, option string, path string) string {
+		return fmt.Sprintf("%s %s path is not allowed: path %q is outside of allowed directories: Command not allowed",
+			cmd, option, path)
+	}
+
+	tests := []struct {
+		name    string
+		cmd     string
+		args    []string
+		allowed bool
+		message string
+	}{
+		{
+			name:    "ExtractInWorkDir",
+			cmd:     "tar",
+			args:    []string{"-xzf", "a.tar.gz"},
+			allowed: true,
+		},
+		{
+			name:    "ExtractToSubdirectory",
+			cmd:     "tar",
+			args:    []string{"-xf", "a.tar", "-C", "out"},
+			allowed: true,
+		},
+		{
+			name:    "ExtractOutsideAllowedDirectories",
+			cmd:     "tar",
+			args:    []string{"-xf", "a.tar", "-C", outsideDir},
+			message: outsideMessage("tar", "-C", outsideDir),
+		},
+		{
+			name:    "BundledDirectoryOutsideAllowedDirectories",
+			cmd:     "tar",
+			args:    []string{"-xfa.tar", "-C" + outsideDir},
+			message: outsideMessage("tar", "-C", outsideDir),
+		},
+		{
+			name:    "TraditionalBundleOutsideAllowedDirectories",
+			cmd:     "tar",
+			args:    []string{"xfC", "a.tar", outsideDir},
+			message: outsideMessage("tar", "-C", outsideDir),
+		},
+		{
+			name:    "CumulativeDirectoryEscape",
+			cmd:     "tar",
+			args:    []string{"-C", workDir, "-C", "..", "-xf", "a.tar"},
+			message: outsideMessage("tar", "-C", filepath.Dir(workDir)),
+		},
+		{
+			name:    "ArchiveOutsideAllowedDirectories",
+			cmd:     "tar",
+			args:    []string{"--create", "--file", filepath.Join(outsideDir, "a.tar"), "src"},
+			message: outsideMessage("tar", "-f", filepath.Join(outsideDir, "a.tar")),
+		},
+		{
+			name:    "MissingDirectoryValue",
+			cmd:     "tar",
+			args:    []string{"-xf", "a.tar", "-C"},
+			message: "tar option -C requires an argument",
+		},
+		{
+			name:    "UnzipInWorkDir",
+			cmd:     "unzip",
+			args:    []string{"a.zip", "-d", "out"},
+			allowed: true,
+		},
+		{
+			name:    "UnzipOutsideAllowedDirectories",
+			cmd:     "unzip",
+			args:    []string{"-o", "a.zip", "-d" + outsideDir},
+			message: outsideMessage("unzip", "-d", outsideDir),
+		},
+		{
+			name:    "UnzipArchiveOutsideAllowedDirectories",
+			cmd:     "unzip",
+			args:    []string{filepath.Join(outsideDir, "a.zip")},
+			message: outsideMessage("unzip", "archive", filepath.Join(outsideDir, "a.zip")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, message := v.ValidateCommand(tt.cmd, tt.args, workDir)
+			if allowed != tt.allowed {
+				t.Errorf("ValidateCommand() allowed = %v, want %v (message: %q)", allowed, tt.allowed, message)
+			}
+			if message != tt.message {
+				t.Errorf("ValidateCommand() message = %q, want %q", message, tt.message)
+			}
+		})
+	}
+}
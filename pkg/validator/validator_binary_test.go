@@ -0,0 +1,116 @@
+package validator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+)
+
+func TestValidateBinaryPath(t *testing.T) {
+	trustedDir := t.TempDir()
+	untrustedDir := t.TempDir()
+
+	// A symlink in an untrusted directory pointing at a trusted binary must be rejected
+	trustedBinary := filepath.Join(trustedDir, "ls")
+	if err := os.WriteFile(trustedBinary, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatalf("Failed to create binary: %v", err)
+	}
+	symlinkBinary := filepath.Join(untrustedDir, "ls")
+	if err := os.Symlink(trustedBinary, symlinkBinary); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	cfg := &config.ShellCommandConfig{
+		TrustedBinaryDirectories: []string{trustedDir},
+		DefaultErrorMessage:      "Command not allowed",
+	}
+	v := New(cfg, logger.New())
+
+	tests := []struct {
+		name    string
+		path    string
+		allowed bool
+	}{
+		{name: "BinaryInTrustedDirectory", path: trustedBinary, allowed: true},
+		{name: "BinaryInUntrustedDirectory", path: filepath.Join(untrustedDir, "ls"), allowed: false},
+		{name: "SymlinkInUntrustedDirectory", path: symlinkBinary, allowed: false},
+		{name: "SiblingWithSharedPrefix", path: trustedDir + "x/ls", allowed: false},
+		{name: "DotDotEscape", path: filepath.Join(trustedDir, "..", "ls"), allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, message := v.ValidateBinaryPath(t.Context(), "ls", tt.path)
+			if allowed != tt.allowed {
+				t.Errorf("ValidateBinaryPath() allowed = %v, want %v (message: %q)", allowed, tt.allowed, message)
+			}
+			if !allowed && message == "" {
+				t.Error("ValidateBinaryPath() returned empty message for rejected binary")
+			}
+		})
+	}
+}
+
+func TestValidateBinaryPathDefaultDirectories(t *testing.T) {
+	cfg := &config.ShellCommandConfig{DefaultErrorMessage: "Command not allowed"}
+	v := New(cfg, logger.New())
+
+	if allowed, message := v.ValidateBinaryPath(t.Context(), "ls", "/usr/bin/ls"); !allowed {
+		t.Errorf("ValidateBinaryPath(/usr/bin/ls) = false, want true (message: %q)", message)
+	}
+	if allowed, _ := v.ValidateBinaryPath(t.Context(), "ls", "/opt/evil/ls"); allowed {
+		t.Error("ValidateBinaryPath(/opt/evil/ls) = true, want false")
+	}
+}
+
+func TestValidateBinaryChecksum(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "terraform")
+	if err := os.WriteFile(binary, []byte("reviewed binary"), 0o755); err != nil {
+		t.Fatalf("Failed to create binary: %v", err)
+	}
+	// A well-formed digest that does not match the binary
+	mismatched := strings.Repeat("ab", 32)
+
+	actual, err := fileSHA256(binary)
+	if err != nil {
+		t.Fatalf("fileSHA256() error = %v", err)
+	}
+
+	cfg := &config.ShellCommandConfig{
+		AllowCommands: []config.AllowCommand{
+			{Command: "terraform", Sha256: actual},
+			{Command: "tofu", Sha256: strings.ToUpper(actual)},
+			{Command: "packer", Sha256: mismatched},
+			{Command: "ls"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+	}
+	v := New(cfg, logger.New())
+
+	tests := []struct {
+		name    string
+		cmd     string
+		path    string
+		allowed bool
+	}{
+		{name: "MatchingDigest", cmd: "terraform", path: binary, allowed: true},
+		{name: "MatchingDigestUppercase", cmd: "tofu", path: binary, allowed: true},
+		{name: "MismatchedDigest", cmd: "packer", path: binary, allowed: false},
+		{name: "NoPinnedDigest", cmd: "ls", path: binary, allowed: true},
+		{name: "UnreadableBinary", cmd: "terraform", path: filepath.Join(dir, "missing"), allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, message := v.ValidateBinaryChecksum(t.Context(), tt.cmd, tt.path)
+			if allowed != tt.allowed {
+				t.Errorf("ValidateBinaryChecksum() allowed = %v, want %v (message: %q)", allowed, tt.allowed, message)
+			}
+		})
+	}
+}
@@ -2,7 +2,9 @@ package validator
 
 import (
 	"bytes"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/shimizu1995/secure-shell-server/pkg/config"
@@ -332,3 +334,154 @@ func TestFindWhenExplicitlyDenied(t *testing.T) {
 			expectedMsg, allowed, message)
 	}
 }
+
+// TestFindDestructiveActions tests validation of -ok, output file actions and denying -delete.
+func TestFindDestructiveActions(t *testing.T) {
+	workDir := t.TempDir()
+	outsideDir := t.TempDir()
+
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+			{Command: "find", DenyFlags: []string{"-delete"}, Message: "Use -print and review the files first"},
+		},
+		DenyCommands: []config.DenyCommand{
+			{Command: "rm", Message: "Remove command is not allowed"},
+		},
+		DefaultErrorMessage: "Command not allowed by security policy",
+	}
+	v := New(cfg, logger.NewWithWriter(&bytes.Buffer{}))
+
+	outsideFile := filepath.Join(outsideDir, "list.txt")
+	tests := []struct {
+		name    string
+		args    []string
+		allowed bool
+		message string
+	}{
+		{
+			name:    "FprintInWorkDir",
+			args:    []string{".", "-name", "*.go", "-fprint", "list.txt"},
+			allowed: true,
+		},
+		{
+			name:    "FprintToStdout",
+			args:    []string{".", "-fprint", "/dev/stdout"},
+			allowed: true,
+		},
+		{
+			name: "FprintOutsideAllowedDirectories",
+			args: []string{".", "-fprint", outsideFile},
+			message: fmt.Sprintf("find -fprint path is not allowed: path %q is outside of allowed directories: "+
+				"Command not allowed by security policy", outsideFile),
+		},
+		{
+			name: "FprintfOutsideAllowedDirectories",
+			args: []string{".", "-fprintf", outsideFile, "%p\\n"},
+			message: fmt.Sprintf("find -fprintf path is not allowed: path %q is outside of allowed directories: "+
+				"Command not allowed by security policy", outsideFile),
+		},
+		{
+			name: "FlsOutsideAllowedDirectories",
+			args: []string{".", "-fls", outsideFile},
+			message: fmt.Sprintf("find -fls path is not allowed: path %q is outside of allowed directories: "+
+				"Command not allowed by security policy", outsideFile),
+		},
+		{
+			name:    "OkWithDisallowedCommand",
+			args:    []string{".", "-ok", "rm", "{}", ";"},
+			message: "find command contains disallowed -exec: command \"rm\" is denied: Remove command is not allowed",
+		},
+		{
+			name:    "OkdirWithAllowedCommand",
+			args:    []string{".", "-okdir", "echo", "{}", ";"},
+			allowed: true,
+		},
+		{
+			name:    "DeleteDenied",
+			args:    []string{".", "-name", "*.tmp", "-delete"},
+			message: "flag \"-delete\" is not allowed for command \"find\": Use -print and review the files first",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, message := v.ValidateCommand("find", tt.args, workDir)
+			if allowed != tt.allowed {
+				t.Errorf("ValidateCommand() allowed = %v, want %v (message: %q)", allowed, tt.allowed, message)
+			}
+			if message != tt.message {
+				t.Errorf("ValidateCommand() message = %q, want %q", message, tt.message)
+			}
+		})
+	}
+}
+
+// TestFindSearchRoots tests that every find starting point must be within allowed directories.
+func TestFindSearchRoots(t *testing.T) {
+	workDir := t.TempDir()
+	outsideDir := t.TempDir()
+
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "find"}},
+		DefaultErrorMessage: "Command not allowed by security policy",
+	}
+	v := New(cfg, logger.NewWithWriter(&bytes.Buffer{}))
+
+	rootMessage := func(root string) string {
+		return fmt.Sprintf("find search root is not allowed: path %q is outside of allowed directories: "+
+			"Command not allowed by security policy", root)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		allowed bool
+		message string
+	}{
+		{
+			name:    "RelativeRoots",
+			args:    []string{"src", "docs", "-name", "*.md"},
+			allowed: true,
+		},
+		{
+			name:    "AbsoluteRootInWorkDir",
+			args:    []string{workDir, "-type", "f"},
+			allowed: true,
+		},
+		{
+			name:    "AbsoluteRootOutsideAllowedDirectories",
+			args:    []string{"/etc", "-name", "shadow"},
+			message: rootMessage("/etc"),
+		},
+		{
+			name:    "SecondRootOutsideAllowedDirectories",
+			args:    []string{".", outsideDir, "-name", "x"},
+			message: rootMessage(outsideDir),
+		},
+		{
+			name:    "RootAfterLeadingOptions",
+			args:    []string{"-L", "-D", "tree", "/etc"},
+			message: rootMessage("/etc"),
+		},
+		{
+			name:    "ParentDirectory",
+			args:    []string{"..", "-maxdepth", "1"},
+			message: rootMessage(".."),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, message := v.ValidateCommand("find", tt.args, workDir)
+			if allowed != tt.allowed {
+				t.Errorf("ValidateCommand() allowed = %v, want %v (message: %q)", allowed, tt.allowed, message)
+			}
+			if message != tt.message {
+				t.Errorf("ValidateCommand() message = %q, want %q", message, tt.message)
+			}
+		})
+	}
+}
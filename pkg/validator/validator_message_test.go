@@ -0,0 +1,98 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+)
+
+func TestMessageTemplates(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{tempDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "ls"},
+			{Command: "xargs"},
+			{
+				Command: "git",
+				DocURL:  "https://example.com/git",
+				SubCommands: []config.SubCommandRule{
+					{Name: "status"},
+					{Name: "push", DenyFlags: []string{"--force"}, DocURL: "https://example.com/git-push"},
+				},
+			},
+		},
+		DenyCommands: []config.DenyCommand{
+			{Command: "rm", Message: "Use trash instead", DocURL: "https://example.com/rm"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		MessageTemplates: map[string]string{
+			"COMMAND_NOT_ALLOWED":    "command {{.Cmd}} is blocked; ask an admin to add it to allowCommands",
+			"SUBCOMMAND_NOT_ALLOWED": "{{.Message}}. Allowed rule: {{.Rule}}, docs: {{.DocURL}}",
+			"PATH_NOT_ALLOWED":       "{{.Unknown}}",
+			"DIRECTORY_NOT_ALLOWED":  "{{.Cmd",
+		},
+	}
+	v := New(cfg, logger.New())
+
+	tests := []struct {
+		name    string
+		cmd     string
+		args    []string
+		message string
+	}{
+		{
+			name:    "template replaces built-in message",
+			cmd:     "curl",
+			message: "command curl is blocked; ask an admin to add it to allowCommands",
+		},
+		{
+			name:    "nested command renders with inner command",
+			cmd:     "xargs",
+			args:    []string{"curl"},
+			message: "command curl is blocked; ask an admin to add it to allowCommands",
+		},
+		{
+			name:    "doc link is appended without a template",
+			cmd:     "rm",
+			args:    []string{"foo"},
+			message: `command "rm" is denied: Use trash instead (see https://example.com/rm)`,
+		},
+		{
+			name:    "template that includes the doc link is not suffixed",
+			cmd:     "git",
+			args:    []string{"commit"},
+			message: `subcommand "commit" is not allowed for command "git". Allowed rule: allowCommands[git].subCommands, docs: https://example.com/git`,
+		},
+		{
+			name:    "subcommand doc link overrides the command's",
+			cmd:     "git",
+			args:    []string{"push", "--force"},
+			message: `flag "--force" is not allowed for command "git push" (see https://example.com/git-push)`,
+		},
+		{
+			name:    "failing template falls back to built-in message",
+			cmd:     "ls",
+			args:    []string{"/etc"},
+			message: `path "/etc" is outside of allowed directories: Command not allowed`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, message := v.ValidateCommand(tt.cmd, tt.args, tempDir)
+			if allowed {
+				t.Fatal("ValidateCommand() = true, want false")
+			}
+			if message != tt.message {
+				t.Errorf("ValidateCommand() message = %q, want %q", message, tt.message)
+			}
+		})
+	}
+
+	// A template that fails to parse is ignored
+	if _, message := v.IsDirectoryAllowed("/etc"); message != `directory "/etc" is not allowed: Command not allowed` {
+		t.Errorf("IsDirectoryAllowed() message = %q, want built-in message", message)
+	}
+}
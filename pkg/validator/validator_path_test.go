@@ -0,0 +1,72 @@
+package validator
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+)
+
+func TestValidatePathPolicy(t *testing.T) {
+	root := t.TempDir()
+	allowedDir := filepath.Join(root, "work")
+	siblingDir := filepath.Join(root, "workshop")
+	for _, dir := range []string{allowedDir, siblingDir, filepath.Join(allowedDir, "secrets"), filepath.Join(allowedDir, "vendor")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(allowedDir, "secrets"), filepath.Join(allowedDir, "shortcut")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{allowedDir},
+		DenyPaths:           []string{filepath.Join(allowedDir, "secrets"), filepath.Join(allowedDir, ".env")},
+		ReadOnlyDirectories: []string{filepath.Join(allowedDir, "vendor")},
+		DefaultErrorMessage: "Path not allowed",
+	}
+	v := New(cfg, logger.NewWithWriter(&bytes.Buffer{}))
+
+	tests := []struct {
+		name    string
+		path    string
+		write   bool
+		allowed bool
+		code    Code
+	}{
+		{name: "FileInAllowedDirectory", path: "main.go", write: true, allowed: true, code: CodeAllowed},
+		{name: "SiblingWithSharedPrefix", path: filepath.Join(siblingDir, "file"), allowed: false, code: CodePathNotAllowed},
+		{name: "DeniedFile", path: ".env", allowed: false, code: CodePathDenied},
+		{name: "FileInDeniedDirectory", path: "secrets/key.pem", allowed: false, code: CodePathDenied},
+		{name: "DeniedDirectoryThroughSymlink", path: "shortcut/key.pem", allowed: false, code: CodePathDenied},
+		{name: "ReadInReadOnlyDirectory", path: "vendor/lib.go", allowed: true, code: CodeAllowed},
+		{name: "WriteInReadOnlyDirectory", path: "vendor/lib.go", write: true, allowed: false, code: CodePathReadOnly},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := v.ValidateFileAccess(tt.path, allowedDir, tt.write)
+			if result.Allowed != tt.allowed || result.Code != tt.code {
+				t.Errorf("ValidateFileAccess(%q, write=%t) = %v %s (%s), want %v %s",
+					tt.path, tt.write, result.Allowed, result.Code, result.Message, tt.allowed, tt.code)
+			}
+		})
+	}
+
+	t.Run("Directories", func(t *testing.T) {
+		if allowed, msg := v.IsDirectoryAllowed(siblingDir); allowed {
+			t.Errorf("expected %s to be rejected despite sharing a prefix with an allowed directory", siblingDir)
+		} else if msg == "" {
+			t.Error("expected a message")
+		}
+		if result := v.ValidateDirectory(filepath.Join(allowedDir, "secrets")); result.Allowed || result.Code != CodePathDenied {
+			t.Errorf("expected denied directory to be rejected with %s, got %v %s", CodePathDenied, result.Allowed, result.Code)
+		}
+		if allowed, msg := v.IsDirectoryAllowed(allowedDir); !allowed {
+			t.Errorf("expected allowed directory to be accepted: %s", msg)
+		}
+	})
+}
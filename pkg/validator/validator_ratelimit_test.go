@@ -0,0 +1,161 @@
+package validator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+)
+
+func newRateLimitedValidator(limit *config.RateLimit) *CommandValidator {
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{"/tmp"},
+		AllowCommands: []config.AllowCommand{
+			{Command: "npm", RateLimit: limit},
+			{Command: "ls"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+	}
+	return New(cfg, logger.New())
+}
+
+func TestRateLimit(t *testing.T) {
+	v := newRateLimitedValidator(&config.RateLimit{Count: 2, Per: "1m"})
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	v.now = func() time.Time { return now }
+
+	// Burst up to the configured count
+	for i := range 2 {
+		if allowed, message := v.ValidateCommand("npm", []string{"install"}, "/tmp"); !allowed {
+			t.Fatalf("call %d: ValidateCommand() = false, want true (message: %q)", i, message)
+		}
+	}
+
+	allowed, message := v.ValidateCommand("npm", []string{"install"}, "/tmp")
+	if allowed {
+		t.Fatal("ValidateCommand() = true after exhausting the rate limit, want false")
+	}
+	if !strings.Contains(message, "exceeded its rate limit of 2 per 1m") {
+		t.Errorf("ValidateCommand() message = %q, want rate limit message", message)
+	}
+
+	// Commands without a rate limit are unaffected
+	if allowed, _ := v.ValidateCommand("ls", nil, "/tmp"); !allowed {
+		t.Error("ValidateCommand(ls) = false, want true")
+	}
+
+	// Half the interval refills one token
+	now = now.Add(30 * time.Second)
+	if allowed, message := v.ValidateCommand("npm", []string{"install"}, "/tmp"); !allowed {
+		t.Errorf("ValidateCommand() after refill = false, want true (message: %q)", message)
+	}
+	if allowed, _ := v.ValidateCommand("npm", []string{"install"}, "/tmp"); allowed {
+		t.Error("ValidateCommand() = true with empty bucket, want false")
+	}
+}
+
+func TestRateLimitPerClient(t *testing.T) {
+	v := newRateLimitedValidator(&config.RateLimit{Count: 1, Per: "1m"})
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	v.now = func() time.Time { return now }
+
+	alice := WithCaller(t.Context(), Caller{Client: "alice"})
+	bob := WithCaller(t.Context(), Caller{Client: "bob"})
+	if result := v.ValidateContext(alice, "npm", nil, "/tmp"); !result.Allowed {
+		t.Fatalf("alice: ValidateContext() = false, want true (message: %q)", result.Message)
+	}
+	if result := v.ValidateContext(alice, "npm", nil, "/tmp"); result.Code != CodeRateLimited {
+		t.Errorf("alice: ValidateContext() code = %s, want %s", result.Code, CodeRateLimited)
+	}
+
+	// Each client has its own limit, and so do unidentified callers
+	if result := v.ValidateContext(bob, "npm", nil, "/tmp"); !result.Allowed {
+		t.Errorf("bob: ValidateContext() = false, want true (message: %q)", result.Message)
+	}
+	if allowed, message := v.ValidateCommand("npm", nil, "/tmp"); !allowed {
+		t.Errorf("ValidateCommand() = false, want true (message: %q)", message)
+	}
+}
+
+func TestCheckScript(t *testing.T) {
+	v := newRateLimitedValidator(&config.RateLimit{Count: 1, Per: "1m"})
+	blockLog := filepath.Join(t.TempDir(), "blocked.log")
+	v.config.BlockLogPath = blockLog
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	v.now = func() time.Time { return now }
+
+	// Checking does not consume the rate limit
+	for i := range 3 {
+		if result := v.CheckScript(t.Context(), "ls && npm install", "/tmp"); !result.Allowed {
+			t.Fatalf("check %d: CheckScript() = false, want true (message: %q)", i, result.Message)
+		}
+	}
+	if result := v.ValidateScript("npm install", "/tmp"); !result.Allowed {
+		t.Fatalf("ValidateScript() = false after checks, want true (message: %q)", result.Message)
+	}
+
+	// An exhausted limit is reported, and blocked scripts are not logged
+	if result := v.CheckScript(t.Context(), "npm install", "/tmp"); result.Code != CodeRateLimited {
+		t.Errorf("CheckScript() code = %s, want %s", result.Code, CodeRateLimited)
+	}
+	result := v.CheckScript(t.Context(), "rm -rf /", "/tmp")
+	if result.Allowed || result.Rule == "" || result.Message == "" {
+		t.Errorf("CheckScript(rm) = %+v, want a blocked result with rule and message", result)
+	}
+	if _, err := os.Stat(blockLog); !os.IsNotExist(err) {
+		t.Errorf("CheckScript wrote the block log (stat error: %v)", err)
+	}
+}
+
+func TestRateLimitInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit *config.RateLimit
+	}{
+		{name: "InvalidDuration", limit: &config.RateLimit{Count: 1, Per: "soon"}},
+		{name: "ZeroCount", limit: &config.RateLimit{Count: 0, Per: "1m"}},
+		{name: "NegativeDuration", limit: &config.RateLimit{Count: 1, Per: "-1m"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newRateLimitedValidator(tt.limit)
+			allowed, message := v.ValidateCommand("npm", nil, "/tmp")
+			if allowed {
+				t.Error("ValidateCommand() = true with invalid rate limit, want false")
+			}
+			if !strings.Contains(message, "invalid rateLimit") {
+				t.Errorf("ValidateCommand() message = %q, want invalid rateLimit message", message)
+			}
+		})
+	}
+}
+
+func TestRateLimitConcurrent(t *testing.T) {
+	v := newRateLimitedValidator(&config.RateLimit{Count: 5, Per: "1h"})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowedCount := 0
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if allowed, _ := v.ValidateCommand("npm", nil, "/tmp"); allowed {
+				mu.Lock()
+				allowedCount++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowedCount != 5 {
+		t.Errorf("allowed %d concurrent calls, want 5", allowedCount)
+	}
+}
@@ -0,0 +1,207 @@
+package validator
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+)
+
+func TestValidateResult(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{tempDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "ls"},
+			{Command: "xargs"},
+			{Command: "sed"},
+			{
+				Command:         "git",
+				DenySubCommands: []string{"reset"},
+				SubCommands: []config.SubCommandRule{
+					{Name: "status"},
+					{Name: "push", DenyFlags: []string{"-f", "--force"}},
+				},
+			},
+			{Command: "npm", RateLimit: &config.RateLimit{Count: 0, Per: "1m"}},
+		},
+		DenyCommands: []config.DenyCommand{
+			{Command: "rm", Message: "Use trash instead"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+	}
+	v := New(cfg, logger.New())
+
+	tests := []struct {
+		name         string
+		cmd          string
+		args         []string
+		wantAllowed  bool
+		wantCommand  string
+		wantCategory Category
+		wantCode     Code
+		wantRule     string
+	}{
+		{
+			name:        "allowed command",
+			cmd:         "ls",
+			args:        []string{"-la"},
+			wantAllowed: true,
+			wantCommand: "ls",
+			wantCode:    CodeAllowed,
+			wantRule:    "allowCommands[ls]",
+		},
+		{
+			name:         "denied command",
+			cmd:          "rm",
+			args:         []string{"-rf", "foo"},
+			wantCommand:  "rm",
+			wantCategory: CategoryDenied,
+			wantCode:     CodeCommandDenied,
+			wantRule:     "denyCommands[rm]",
+		},
+		{
+			name:         "command not in allow list",
+			cmd:          "curl",
+			wantCommand:  "curl",
+			wantCategory: CategoryNotListed,
+			wantCode:     CodeCommandNotAllowed,
+			wantRule:     "allowCommands",
+		},
+		{
+			name:         "path outside allowed directories",
+			cmd:          "ls",
+			args:         []string{"/etc/passwd"},
+			wantCommand:  "ls",
+			wantCategory: CategoryPath,
+			wantCode:     CodePathNotAllowed,
+			wantRule:     "allowedDirectories",
+		},
+		{
+			name:         "denied subcommand",
+			cmd:          "git",
+			args:         []string{"reset", "--hard"},
+			wantCommand:  "git",
+			wantCategory: CategorySubCommand,
+			wantCode:     CodeSubCommandDenied,
+			wantRule:     "allowCommands[git].denySubCommands[reset]",
+		},
+		{
+			name:         "subcommand not allowed",
+			cmd:          "git",
+			args:         []string{"commit"},
+			wantCommand:  "git",
+			wantCategory: CategorySubCommand,
+			wantCode:     CodeSubCommandNotAllowed,
+			wantRule:     "allowCommands[git].subCommands",
+		},
+		{
+			name:         "denied flag",
+			cmd:          "git",
+			args:         []string{"push", "--force"},
+			wantCommand:  "git",
+			wantCategory: CategorySubCommand,
+			wantCode:     CodeFlagDenied,
+			wantRule:     "allowCommands[git].subCommands[push].denyFlags[--force]",
+		},
+		{
+			name:         "invalid rate limit",
+			cmd:          "npm",
+			args:         []string{"install"},
+			wantCommand:  "npm",
+			wantCategory: CategoryConstraint,
+			wantCode:     CodeInvalidRule,
+			wantRule:     "allowCommands[npm].rateLimit",
+		},
+		{
+			name:         "dangerous sed script",
+			cmd:          "sed",
+			args:         []string{"e ls"},
+			wantCommand:  "sed",
+			wantCategory: CategoryDangerous,
+			wantCode:     CodeDangerousPattern,
+			wantRule:     "allowCommands[sed]",
+		},
+		{
+			name:         "xargs reports the nested command's rule",
+			cmd:          "xargs",
+			args:         []string{"rm"},
+			wantCommand:  "rm",
+			wantCategory: CategoryDenied,
+			wantCode:     CodeCommandDenied,
+			wantRule:     "denyCommands[rm]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := v.Validate(tt.cmd, tt.args, tempDir)
+			if got.Allowed != tt.wantAllowed {
+				t.Errorf("Validate() allowed = %v, want %v (message: %q)", got.Allowed, tt.wantAllowed, got.Message)
+			}
+			if got.Command != tt.wantCommand {
+				t.Errorf("Validate() command = %q, want %q", got.Command, tt.wantCommand)
+			}
+			if got.Category != tt.wantCategory {
+				t.Errorf("Validate() category = %q, want %q", got.Category, tt.wantCategory)
+			}
+			if got.Code != tt.wantCode {
+				t.Errorf("Validate() code = %q, want %q", got.Code, tt.wantCode)
+			}
+			if got.Rule != tt.wantRule {
+				t.Errorf("Validate() rule = %q, want %q", got.Rule, tt.wantRule)
+			}
+
+			// The compatibility shim must agree with the structured result
+			allowed, message := v.ValidateCommand(tt.cmd, tt.args, tempDir)
+			if allowed != got.Allowed || message != got.Message {
+				t.Errorf("ValidateCommand() = (%v, %q), want (%v, %q)", allowed, message, got.Allowed, got.Message)
+			}
+		})
+	}
+}
+
+func TestValidateDirectoryResult(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{tempDir},
+		DefaultErrorMessage: "Command not allowed",
+	}
+	v := New(cfg, logger.New())
+
+	if got := v.ValidateDirectory(tempDir); !got.Allowed || got.Code != CodeAllowed {
+		t.Errorf("ValidateDirectory(%q) = %+v, want allowed", tempDir, got)
+	}
+
+	got := v.ValidateDirectory("/etc")
+	if got.Allowed || got.Category != CategoryPath || got.Code != CodeDirectoryNotAllowed {
+		t.Errorf("ValidateDirectory(/etc) = %+v, want DIRECTORY_NOT_ALLOWED", got)
+	}
+}
+
+func TestValidateDebugLog(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{tempDir},
+		AllowCommands:       []config.AllowCommand{{Command: "ls"}},
+		DenyCommands:        []config.DenyCommand{{Command: "rm"}},
+		DefaultErrorMessage: "Command not allowed",
+	}
+	var buf bytes.Buffer
+	log := logger.NewWithWriter(&buf)
+	v := New(cfg, log)
+
+	v.Validate("ls", []string{"-l"}, tempDir)
+	if buf.Len() != 0 {
+		t.Errorf("decision logged at the default level: %q", buf.String())
+	}
+
+	log.SetLevel(logger.LevelDebug)
+	v.Validate("rm", []string{"-rf", "x"}, tempDir)
+	want := `[DEBUG] Validated rm ["-rf" "x"] in ` + tempDir + ": allowed=false code=COMMAND_DENIED rule=denyCommands[rm]"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("log = %q, want to contain %q", buf.String(), want)
+	}
+}
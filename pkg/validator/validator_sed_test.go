@@ -319,3 +319,91 @@ func TestSedWhenExplicitlyDenied(t *testing.T) {
 			expectedMsg, allowed, message)
 	}
 }
+
+// TestSedWriteValidation tests that files written by sed scripts must be within allowed directories.
+func TestSedWriteValidation(t *testing.T) {
+	workDir := t.TempDir()
+	outsideDir := t.TempDir()
+
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{workDir},
+		AllowCommands:       []config.AllowCommand{{Command: "sed"}},
+		DefaultErrorMessage: "Command not allowed",
+	}
+	v := New(cfg, logger.NewWithWriter(io.Discard))
+
+	outsideFile := filepath.Join(outsideDir, "out.txt")
+	tests := []struct {
+		name    string
+		args    []string
+		allowed bool
+		message string
+	}{
+		{
+			name:    "WriteInWorkDir",
+			args:    []string{"-n", "/foo/w matches.txt", "input.txt"},
+			allowed: true,
+		},
+		{
+			name:    "WriteToStdout",
+			args:    []string{"-n", "s/a/b/w /dev/stdout", "input.txt"},
+			allowed: true,
+		},
+		{
+			name: "WriteOutsideAllowedDirectories",
+			args: []string{"-n", "/foo/w " + outsideFile, "input.txt"},
+			message: fmt.Sprintf("sed script writes to a file that is not allowed: "+
+				"path %q is outside of allowed directories: Command not allowed", outsideFile),
+		},
+		{
+			name: "SubstitutionWriteOutsideAllowedDirectories",
+			args: []string{"-e", "s/a/b/w " + outsideFile, "input.txt"},
+			message: fmt.Sprintf("sed script writes to a file that is not allowed: "+
+				"path %q is outside of allowed directories: Command not allowed", outsideFile),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, message := v.ValidateCommand("sed", tt.args, workDir)
+			if allowed != tt.allowed {
+				t.Errorf("ValidateCommand() allowed = %v, want %v (message: %q)", allowed, tt.allowed, message)
+			}
+			if message != tt.message {
+				t.Errorf("ValidateCommand() message = %q, want %q", message, tt.message)
+			}
+		})
+	}
+}
+
+// TestScriptInspectionDisabled tests that inspectScript: false skips awk and sed script inspection.
+func TestScriptInspectionDisabled(t *testing.T) {
+	workDir := t.TempDir()
+	disabled := false
+
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "sed", InspectScript: &disabled},
+			{Command: "awk", InspectScript: &disabled},
+			{Command: "gsed"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+	}
+	v := New(cfg, logger.NewWithWriter(io.Discard))
+
+	if allowed, message := v.ValidateCommand("sed", []string{"s/a/b/e", "input.txt"}, workDir); !allowed {
+		t.Errorf("ValidateCommand(sed) = false, want true with inspection disabled (message: %q)", message)
+	}
+	if allowed, message := v.ValidateCommand("awk", []string{`BEGIN { system("date") }`}, workDir); !allowed {
+		t.Errorf("ValidateCommand(awk) = false, want true with inspection disabled (message: %q)", message)
+	}
+	if allowed, _ := v.ValidateCommand("gsed", []string{"s/a/b/e", "input.txt"}, workDir); allowed {
+		t.Error("ValidateCommand(gsed) = true, want false with inspection enabled by default")
+	}
+
+	// Path arguments are still validated when inspection is disabled
+	if allowed, _ := v.ValidateCommand("sed", []string{"s/a/b/", "/etc/passwd"}, workDir); allowed {
+		t.Error("ValidateCommand(sed /etc/passwd) = true, want false")
+	}
+}
@@ -2,8 +2,10 @@ package validator
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
@@ -169,9 +171,9 @@ func TestValidatePathArguments(t *testing.T) {
 			// Reset log buffer for each test
 			logBuffer.Reset()
 
-			gotAllowed, _ := v.validatePathArguments(tt.cmd, tt.args, tt.workDir)
-			if gotAllowed != tt.allowed {
-				t.Errorf("validatePathArguments() allowed = %v, want %v", gotAllowed, tt.allowed)
+			got := v.validatePathArguments(tt.cmd, tt.args, tt.workDir)
+			if got.Allowed != tt.allowed {
+				t.Errorf("validatePathArguments() allowed = %v, want %v", got.Allowed, tt.allowed)
 			}
 		})
 	}
@@ -499,9 +501,38 @@ func TestCommandLogging(t *testing.T) {
 		t.Fatalf("Failed to read log file: %v", err)
 	}
 
-	logStr := string(logContent)
-	if !strings.Contains(logStr, "[BLOCKED] Command: rm [-rf ") || !strings.Contains(logStr, filepath.Base(tempWorkDir)) {
-		t.Errorf("Expected blocked command log entry, got: %s", logStr)
+	var record BlockRecord
+	if err := json.Unmarshal(logContent, &record); err != nil {
+		t.Fatalf("Block log is not a JSON record: %v: %s", err, logContent)
+	}
+	if record.Command != "rm" || !slices.Equal(record.Args, []string{"-rf", tempWorkDir}) {
+		t.Errorf("Expected a record of rm -rf %s, got: %s", tempWorkDir, logContent)
+	}
+	if record.Code != CodeCommandDenied || record.Rule != "denyCommands[rm]" || record.Reason == "" {
+		t.Errorf("Expected the deny rule and reason in the record, got: %s", logContent)
+	}
+	if record.WorkDir != wd || record.Time.IsZero() {
+		t.Errorf("Expected the work directory and time in the record, got: %s", logContent)
+	}
+
+	// Scripts and the caller carried by the context are recorded too
+	ctx := WithCaller(t.Context(), Caller{Client: "session-1", RunID: "run-1"})
+	v.ValidateScriptContext(ctx, "ls && rm x", wd)
+
+	logContent, err = os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(logContent), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 records, got: %s", logContent)
+	}
+	record = BlockRecord{}
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatalf("Block log is not a JSON record: %v: %s", err, lines[1])
+	}
+	if record.Command != "rm" || record.Script != "ls && rm x" || record.Client != "session-1" || record.RunID != "run-1" {
+		t.Errorf("Expected a record of the script with its caller, got: %s", lines[1])
 	}
 }
 
@@ -0,0 +1,83 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+)
+
+func TestTimeWindowRestrictions(t *testing.T) {
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{"/tmp"},
+		AllowCommands: []config.AllowCommand{
+			{Command: "deploy", AllowedHours: []string{"09:00-18:00"}, AllowedDays: []string{"Mon", "Tue", "Wednesday", "thu"}},
+			{Command: "backup", AllowedHours: []string{"22:00-06:00"}},
+			{Command: "broken", AllowedHours: []string{"nine-to-five"}},
+			{Command: "ls"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		Timezone:            "UTC",
+	}
+	v := New(cfg, logger.New())
+
+	tests := []struct {
+		name        string
+		cmd         string
+		now         string
+		allowed     bool
+		wantMessage string
+	}{
+		{name: "WithinHoursOnAllowedDay", cmd: "deploy", now: "2026-10-14T10:30:00Z", allowed: true},
+		{name: "AtStartOfRange", cmd: "deploy", now: "2026-10-14T09:00:00Z", allowed: true},
+		{name: "AtEndOfRange", cmd: "deploy", now: "2026-10-14T18:00:00Z", allowed: false, wantMessage: "only allowed during 09:00-18:00"},
+		{name: "Friday", cmd: "deploy", now: "2026-10-16T10:30:00Z", allowed: false, wantMessage: "today is Friday"},
+		{name: "WrapAroundLateEvening", cmd: "backup", now: "2026-10-16T23:15:00Z", allowed: true},
+		{name: "WrapAroundEarlyMorning", cmd: "backup", now: "2026-10-16T05:59:00Z", allowed: true},
+		{name: "WrapAroundDaytime", cmd: "backup", now: "2026-10-16T12:00:00Z", allowed: false},
+		{name: "InvalidRangeFailsClosed", cmd: "broken", now: "2026-10-16T12:00:00Z", allowed: false, wantMessage: "invalid range"},
+		{name: "NoWindow", cmd: "ls", now: "2026-10-18T03:00:00Z", allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, err := time.Parse(time.RFC3339, tt.now)
+			if err != nil {
+				t.Fatalf("Failed to parse time: %v", err)
+			}
+			v.now = func() time.Time { return now }
+
+			allowed, message := v.ValidateCommand(tt.cmd, nil, "/tmp")
+			if allowed != tt.allowed {
+				t.Errorf("ValidateCommand() allowed = %v, want %v (message: %q)", allowed, tt.allowed, message)
+			}
+			if tt.wantMessage != "" && !strings.Contains(message, tt.wantMessage) {
+				t.Errorf("ValidateCommand() message = %q, want to contain %q", message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestTimeWindowTimezone(t *testing.T) {
+	cfg := &config.ShellCommandConfig{
+		AllowCommands: []config.AllowCommand{
+			{Command: "deploy", AllowedHours: []string{"09:00-18:00"}},
+		},
+		DefaultErrorMessage: "Command not allowed",
+		Timezone:            "Asia/Tokyo",
+	}
+	v := New(cfg, logger.New())
+
+	// 01:00 UTC is 10:00 in Tokyo
+	v.now = func() time.Time { return time.Date(2026, 10, 14, 1, 0, 0, 0, time.UTC) }
+	if allowed, message := v.ValidateCommand("deploy", nil, "/tmp"); !allowed {
+		t.Errorf("ValidateCommand() = false, want true in Asia/Tokyo (message: %q)", message)
+	}
+
+	cfg.Timezone = "Not/AZone"
+	if allowed, _ := v.ValidateCommand("deploy", nil, "/tmp"); allowed {
+		t.Error("ValidateCommand() = true with invalid timezone, want false")
+	}
+}
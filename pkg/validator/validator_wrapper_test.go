@@ -0,0 +1,326 @@
+package validator
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+)
+
+// TestValidateWrapperCommands tests that commands nested in sh -c, env, xargs and find -exec
+// are validated recursively.
+func TestValidateWrapperCommands(t *testing.T) {
+	workDir := t.TempDir()
+	outsideDir := t.TempDir()
+
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "ls"},
+			{Command: "cat"},
+			{Command: "echo"},
+			{Command: "cd"},
+			{Command: "sh"},
+			{Command: "bash"},
+			{Command: "env"},
+			{Command: "xargs"},
+			{Command: "find"},
+		},
+		DenyCommands: []config.DenyCommand{
+			{Command: "rm", Message: "Use trash instead"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+	}
+	v := New(cfg, logger.NewWithWriter(io.Discard))
+
+	rmDenied := `command "rm" is denied: Use trash instead`
+	xargsInputScript := "xargs would execute disallowed command: sh would run a script taken from the input of xargs"
+	findInputScript := "find command contains disallowed -exec: sh would run a script taken from the file names find passes"
+	outsidePath := func(path string) string {
+		return fmt.Sprintf("path %q is outside of allowed directories: Command not allowed", path)
+	}
+
+	tests := []struct {
+		name    string
+		cmd     string
+		args    []string
+		allowed bool
+		message string
+	}{
+		{
+			name:    "ShellAllowedScript",
+			cmd:     "sh",
+			args:    []string{"-c", "ls -la | cat && echo done"},
+			allowed: true,
+		},
+		{
+			name:    "ShellDeniedCommand",
+			cmd:     "sh",
+			args:    []string{"-c", "ls; rm -rf foo"},
+			message: "sh -c would execute disallowed command: " + rmDenied,
+		},
+		{
+			name:    "ShellDeniedCommandInSubstitution",
+			cmd:     "bash",
+			args:    []string{"-ec", "echo $(rm foo)"},
+			message: "bash -c would execute disallowed command: " + rmDenied,
+		},
+		{
+			name:    "ShellAbsoluteCommandPath",
+			cmd:     "sh",
+			args:    []string{"-c", "/bin/rm foo"},
+			message: "sh -c would execute disallowed command: " + rmDenied,
+		},
+		{
+			name:    "ShellDynamicCommand",
+			cmd:     "sh",
+			args:    []string{"-c", `$0 foo`, "rm"},
+			message: "sh -c script runs a command whose name cannot be determined statically",
+		},
+		{
+			name:    "ShellVariableArgument",
+			cmd:     "sh",
+			args:    []string{"-c", `P=/etc/passwd; cat "$P"`},
+			message: "sh -c script passes cat an argument whose value cannot be determined statically",
+		},
+		{
+			name:    "ShellInheritedVariableArgument",
+			cmd:     "bash",
+			args:    []string{"-c", `ls "$HOME"`},
+			message: "bash -c script passes ls an argument whose value cannot be determined statically",
+		},
+		{
+			name:    "ShellCommandSubstitutionArgument",
+			cmd:     "sh",
+			args:    []string{"-c", "cat $(echo secret)"},
+			message: "sh -c script passes cat an argument whose value cannot be determined statically",
+		},
+		{
+			name:    "ShellPositionalParameters",
+			cmd:     "sh",
+			args:    []string{"-c", `cat "$1" "$@"`, "_", "file.txt"},
+			allowed: true,
+		},
+		{
+			name:    "ShellPositionalParameterOutsideAllowedDirectories",
+			cmd:     "sh",
+			args:    []string{"-c", `cat "$1"`, "_", filepath.Join(outsideDir, "secret")},
+			message: outsidePath(filepath.Join(outsideDir, "secret")),
+		},
+		{
+			name:    "ShellRedirectOutsideAllowedDirectories",
+			cmd:     "sh",
+			args:    []string{"-c", "echo x > " + filepath.Join(outsideDir, "out")},
+			message: "sh -c script redirects to a file that is not allowed: " + outsidePath(filepath.Join(outsideDir, "out")),
+		},
+		{
+			name: "ShellCdToHomeDirectory",
+			cmd:  "sh",
+			args: []string{"-c", "cd ~; cat ./secret"},
+			message: "sh -c would execute disallowed command: " +
+				outsidePath("./secret"),
+		},
+		{
+			name:    "ShellScriptFile",
+			cmd:     "sh",
+			args:    []string{"./script.sh"},
+			message: "sh can only run a script given with -c, not a script file or standard input",
+		},
+		{
+			name:    "ShellStandardInput",
+			cmd:     "bash",
+			args:    []string{"-s", "file.txt"},
+			message: "bash can only run a script given with -c, not a script file or standard input",
+		},
+		{
+			name:    "EnvAllowedCommand",
+			cmd:     "env",
+			args:    []string{"-i", "A=1", "ls"},
+			allowed: true,
+		},
+		{
+			name:    "EnvDeniedCommand",
+			cmd:     "env",
+			args:    []string{"A=1", "rm", "foo"},
+			message: "env would execute disallowed command: " + rmDenied,
+		},
+		{
+			name:    "EnvSplitStringDeniedCommand",
+			cmd:     "env",
+			args:    []string{"-S", "rm -rf foo"},
+			message: "env would execute disallowed command: " + rmDenied,
+		},
+		{
+			name:    "EnvChdirOutsideAllowedDirectories",
+			cmd:     "env",
+			args:    []string{"-C", outsideDir, "ls"},
+			message: "env -C path is not allowed: " + outsidePath(outsideDir),
+		},
+		{
+			name:    "EnvWithoutCommand",
+			cmd:     "env",
+			args:    []string{},
+			allowed: true,
+		},
+		{
+			name: "XargsShell",
+			cmd:  "xargs",
+			args: []string{"-I{}", "sh", "-c", "rm \"$1\"", "_", "{}"},
+			message: "xargs would execute disallowed command: sh -c would execute disallowed command: " +
+				rmDenied,
+		},
+		{
+			name:    "XargsShellPositionalParameter",
+			cmd:     "xargs",
+			args:    []string{"-I{}", "sh", "-c", `cat "$1"`, "_", "{}"},
+			allowed: true,
+		},
+		{
+			name:    "XargsShellReplaceStringInScript",
+			cmd:     "xargs",
+			args:    []string{"-I{}", "sh", "-c", "echo {}"},
+			message: xargsInputScript,
+		},
+		{
+			name:    "XargsShellCustomReplaceStringInScript",
+			cmd:     "xargs",
+			args:    []string{"-I", "%", "sh", "-c", "echo %"},
+			message: xargsInputScript,
+		},
+		{
+			name:    "XargsShellScriptFromInput",
+			cmd:     "xargs",
+			args:    []string{"sh", "-c"},
+			message: xargsInputScript,
+		},
+		{
+			name:    "XargsShellScriptFileFromInput",
+			cmd:     "xargs",
+			args:    []string{"sh"},
+			message: xargsInputScript,
+		},
+		{
+			name:    "XargsEnvShellReplaceStringInScript",
+			cmd:     "xargs",
+			args:    []string{"-I{}", "env", "sh", "-c", "echo {}"},
+			message: xargsInputScript,
+		},
+		{
+			name:    "XargsEnv",
+			cmd:     "xargs",
+			args:    []string{"env", "rm"},
+			message: "xargs would execute disallowed command: env would execute disallowed command: " + rmDenied,
+		},
+		{
+			name: "FindExecShell",
+			cmd:  "find",
+			args: []string{".", "-exec", "sh", "-c", "rm \"$1\"", "_", "{}", ";"},
+			message: "find command contains disallowed -exec: sh -c would execute disallowed command: " +
+				rmDenied,
+		},
+		{
+			name:    "FindExecShellPositionalParameter",
+			cmd:     "find",
+			args:    []string{".", "-exec", "sh", "-c", `cat "$1"`, "_", "{}", ";"},
+			allowed: true,
+		},
+		{
+			name:    "FindExecShellScriptFromFileName",
+			cmd:     "find",
+			args:    []string{".", "-exec", "sh", "-c", "{}", "\\;"},
+			message: findInputScript,
+		},
+		{
+			name:    "FindExecShellPlaceholderInScript",
+			cmd:     "find",
+			args:    []string{".", "-exec", "sh", "-c", "echo {}", "\\;"},
+			message: findInputScript,
+		},
+		{
+			name:    "FindExecShellScriptFileFromFileName",
+			cmd:     "find",
+			args:    []string{".", "-exec", "sh", "{}", "-c", "echo", ";"},
+			message: findInputScript,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, message := v.ValidateCommand(tt.cmd, tt.args, workDir)
+			if allowed != tt.allowed {
+				t.Errorf("ValidateCommand() allowed = %v, want %v (message: %q)", allowed, tt.allowed, message)
+			}
+			if message != tt.message {
+				t.Errorf("ValidateCommand() message = %q, want %q", message, tt.message)
+			}
+		})
+	}
+}
+
+// TestValidateScript tests that every command and redirection of a script is validated
+// before it runs.
+func TestValidateScript(t *testing.T) {
+	workDir := t.TempDir()
+	outsideDir := t.TempDir()
+
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "ls"},
+			{Command: "echo"},
+			{Command: "cd"},
+		},
+		DenyCommands: []config.DenyCommand{
+			{Command: "rm", Message: "Use trash instead"},
+		},
+		DefaultErrorMessage: "Command not allowed",
+	}
+	v := New(cfg, logger.NewWithWriter(io.Discard))
+
+	tests := []struct {
+		name    string
+		script  string
+		allowed bool
+		message string
+	}{
+		{name: "Allowed", script: "ls -la && echo done > out.txt", allowed: true},
+		{name: "NoCommands", script: "A=1", allowed: true},
+		{name: "DeniedCommand", script: "ls\nrm -rf foo", message: `command "rm" is denied: Use trash instead`},
+		{
+			name:    "CdOutsideAllowedDirectories",
+			script:  "cd " + outsideDir + " && ls",
+			message: fmt.Sprintf("path %q is outside of allowed directories: Command not allowed", outsideDir),
+		},
+		{
+			name:   "RedirectOutsideAllowedDirectories",
+			script: "echo x > " + filepath.Join(outsideDir, "out.txt"),
+			message: fmt.Sprintf("script redirects to a file that is not allowed: path %q is outside of allowed directories: Command not allowed",
+				filepath.Join(outsideDir, "out.txt")),
+		},
+		{
+			name:    "DynamicCommandName",
+			script:  "$CMD foo",
+			message: "script runs a command whose name cannot be determined statically",
+		},
+		{
+			name:    "ParseError",
+			script:  "echo 'unterminated",
+			message: "script cannot be parsed: 1:6: reached EOF without closing quote '",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := v.ValidateScript(tt.script, workDir)
+			if result.Allowed != tt.allowed {
+				t.Errorf("ValidateScript() allowed = %v, want %v (message: %q)", result.Allowed, tt.allowed, result.Message)
+			}
+			if result.Message != tt.message {
+				t.Errorf("ValidateScript() message = %q, want %q", result.Message, tt.message)
+			}
+		})
+	}
+}
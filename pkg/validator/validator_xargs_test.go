@@ -2,6 +2,7 @@ package validator
 
 import (
 	"bytes"
+	"fmt"
 	"os"
 	"testing"
 
@@ -173,12 +174,12 @@ func runXargsValidationTests(t *testing.T, v *CommandValidator, tests []struct {
 				t.Fatalf("Failed to get working directory: %v", err)
 			}
 
-			gotAllowed, gotMessage := v.validateXargsCommand(tt.args, wd)
-			if gotAllowed != tt.allowed {
-				t.Errorf("validateXargsCommand() allowed = %v, want %v", gotAllowed, tt.allowed)
+			got := v.validateXargsCommand(tt.args, wd)
+			if got.Allowed != tt.allowed {
+				t.Errorf("validateXargsCommand() allowed = %v, want %v", got.Allowed, tt.allowed)
 			}
-			if gotMessage != tt.message {
-				t.Errorf("validateXargsCommand() message = %q, want %q", gotMessage, tt.message)
+			if got.Message != tt.message {
+				t.Errorf("validateXargsCommand() message = %q, want %q", got.Message, tt.message)
 			}
 		})
 	}
@@ -321,3 +322,63 @@ func TestXargsWhenExplicitlyDenied(t *testing.T) {
 			expectedMsg, allowed, message)
 	}
 }
+
+// TestXargsArgFile tests that xargs input files must be within allowed directories.
+func TestXargsArgFile(t *testing.T) {
+	workDir := t.TempDir()
+
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{workDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "xargs"},
+			{Command: "echo"},
+		},
+		DefaultErrorMessage: "Command not allowed by security policy",
+	}
+	v := New(cfg, logger.NewWithWriter(&bytes.Buffer{}))
+
+	outsideMessage := func(path string) string {
+		return fmt.Sprintf("xargs -a path is not allowed: path %q is outside of allowed directories: "+
+			"Command not allowed by security policy", path)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		allowed bool
+		message string
+	}{
+		{
+			name:    "ArgFileInWorkDir",
+			args:    []string{"-a", "list.txt", "echo"},
+			allowed: true,
+		},
+		{
+			name:    "ArgFileOutsideAllowedDirectories",
+			args:    []string{"-a", "/etc/passwd", "echo"},
+			message: outsideMessage("/etc/passwd"),
+		},
+		{
+			name:    "LongArgFileOutsideAllowedDirectories",
+			args:    []string{"--arg-file=/etc/passwd", "echo"},
+			message: outsideMessage("/etc/passwd"),
+		},
+		{
+			name:    "ArgFileEscapingWorkDir",
+			args:    []string{"-0a", "../secret", "echo"},
+			message: outsideMessage("../secret"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, message := v.ValidateCommand("xargs", tt.args, workDir)
+			if allowed != tt.allowed {
+				t.Errorf("ValidateCommand() allowed = %v, want %v (message: %q)", allowed, tt.allowed, message)
+			}
+			if message != tt.message {
+				t.Errorf("ValidateCommand() message = %q, want %q", message, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,444 @@
+package validator
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// ScriptCommand is a command found in a shell script passed to a wrapper such as sh -c.
+type ScriptCommand struct {
+	Name string
+	Args []string
+	// Dynamic reports whether an argument depends on a parameter expansion or a command
+	// substitution, whose value is only known when the script runs; such arguments are
+	// expanded to empty strings in Args. Quoted positional parameters like "$1" and "$@" do
+	// not count, since they expand to the operands of the shell.
+	Dynamic bool
+}
+
+// ShellScript holds the commands and file redirections of a shell script passed to a wrapper.
+type ShellScript struct {
+	// Commands are the commands in the script, including those in command substitutions.
+	Commands []ScriptCommand
+	// Redirects are the files the script redirects from or to.
+	Redirects []string
+}
+
+// EnvCommand is the command run by env and the environment it is run in.
+type EnvCommand struct {
+	// Cmd is the command to run, empty when env only prints the environment.
+	Cmd  string
+	Args []string
+	// Dir is the directory given with -C/--chdir, if any.
+	Dir string
+}
+
+// envShortOptionsWithArg lists the env short options that take a value.
+const envShortOptionsWithArg = "uCS"
+
+// IsShellCommand checks if the command is a shell that can run a script given with -c.
+func IsShellCommand(cmd string) bool {
+	switch cmd {
+	case "sh", "bash", "dash", "zsh", "ksh":
+		return true
+	}
+	return false
+}
+
+// ParseShellScriptArg extracts the script given to a shell with -c and the operands that follow it
+// ($0, $1, ...). It returns found == false when the shell runs a script file or reads standard input.
+func ParseShellScriptArg(args []string) (string, []string, bool) {
+	hasC := false
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--" {
+			if hasC && i+1 < len(args) {
+				return args[i+1], args[i+2:], true
+			}
+			return "", nil, false
+		}
+
+		// Long options, some of which take a file argument
+		if strings.HasPrefix(arg, "--") {
+			if arg == "--rcfile" || arg == "--init-file" {
+				i++
+			}
+			continue
+		}
+
+		// Option bundles like -c, -ec or +x; -o and -O take an option name
+		if (strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, "+")) && len(arg) > 1 {
+			if arg[0] == '-' && strings.ContainsRune(arg[1:], 'c') {
+				hasC = true
+			}
+			if strings.ContainsAny(arg[1:], "oO") {
+				i++
+			}
+			continue
+		}
+
+		// First operand: the script with -c, otherwise a script file
+		if hasC {
+			return arg, args[i+1:], true
+		}
+		return "", nil, false
+	}
+
+	return "", nil, false
+}
+
+// inputScriptShell returns the shell a command run by xargs or find -exec runs with a script
+// taken from their input, following env, or "" if it runs none. Without a fixed script the
+// first input item is run as a script file or as the script itself, and a script containing
+// placeholder has it replaced with input items.
+func inputScriptShell(cmd string, args []string, placeholder string) string {
+	for cmd == "env" {
+		envCmd, errMsg := ParseEnvCommand(args)
+		if errMsg != "" {
+			return ""
+		}
+		cmd, args = envCmd.Cmd, envCmd.Args
+	}
+	if filepath.IsAbs(cmd) {
+		cmd = filepath.Base(cmd)
+	}
+	if !IsShellCommand(cmd) {
+		return ""
+	}
+
+	script, _, found := ParseShellScriptArg(args)
+	if !found || (placeholder != "" && strings.Contains(script, placeholder)) {
+		return cmd
+	}
+	return ""
+}
+
+// ParseShellScript parses a shell script and returns every command and redirection in it.
+// Commands whose name is not a static word (e.g. "$cmd" or "$(echo rm)") cannot be
+// validated and are reported as an error.
+func ParseShellScript(script string) (*ShellScript, string) {
+	file, err := syntax.NewParser().Parse(strings.NewReader(script), "")
+	if err != nil {
+		return nil, fmt.Sprintf("script cannot be parsed: %v", err)
+	}
+
+	// Expand words without running anything: variables and command substitutions expand to
+	// empty strings, brace expansion produces separate arguments like the shell would
+	cfg := &expand.Config{
+		CmdSubst: func(io.Writer, *syntax.CmdSubst) error { return nil },
+	}
+
+	result := &ShellScript{}
+	var errMsg string
+
+	syntax.Walk(file, func(node syntax.Node) bool {
+		if errMsg != "" {
+			return false
+		}
+
+		switch n := node.(type) {
+		case *syntax.CallExpr:
+			// Assignment-only statements run no command
+			if len(n.Args) == 0 {
+				return true
+			}
+			if !isStaticWord(n.Args[0]) {
+				errMsg = "script runs a command whose name cannot be determined statically"
+				return false
+			}
+			fields, err := expand.Fields(cfg, n.Args...)
+			if err != nil || len(fields) == 0 {
+				errMsg = "script runs a command whose name cannot be determined statically"
+				return false
+			}
+			dynamic := false
+			for _, arg := range n.Args[1:] {
+				dynamic = dynamic || (hasExpansion(arg) && !isOperandWord(arg))
+			}
+			result.Commands = append(result.Commands, ScriptCommand{Name: fields[0], Args: fields[1:], Dynamic: dynamic})
+
+		case *syntax.Redirect:
+			if !isFileRedirect(n) {
+				return true
+			}
+			if !isStaticWord(n.Word) {
+				errMsg = "script redirects to a file whose name cannot be determined statically"
+				return false
+			}
+			target, err := expand.Literal(cfg, n.Word)
+			if err != nil {
+				errMsg = "script redirects to a file whose name cannot be determined statically"
+				return false
+			}
+			result.Redirects = append(result.Redirects, target)
+		}
+
+		return true
+	})
+
+	if errMsg != "" {
+		return nil, errMsg
+	}
+	return result, ""
+}
+
+// isStaticWord reports whether a word has the same value however the script is run:
+// it contains only literal text and quotes, and no unquoted glob characters.
+func isStaticWord(word *syntax.Word) bool {
+	if word == nil {
+		return false
+	}
+	for _, part := range word.Parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			if strings.ContainsAny(p.Value, "*?[") {
+				return false
+			}
+		case *syntax.SglQuoted:
+		case *syntax.DblQuoted:
+			for _, inner := range p.Parts {
+				if _, ok := inner.(*syntax.Lit); !ok {
+					return false
+				}
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// hasExpansion reports whether a word contains a parameter expansion, an arithmetic
+// expansion or a command or process substitution. Special parameters like $$ and $?, which
+// expand to numbers or option letters, do not count.
+func hasExpansion(word *syntax.Word) bool {
+	found := false
+	syntax.Walk(word, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.ParamExp:
+			found = !isSpecialParam(n)
+		case *syntax.ArithmExp, *syntax.CmdSubst, *syntax.ProcSubst:
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// isSpecialParam reports whether exp is one of the special parameters $$, $!, $?, $# and $-
+// with no modifiers.
+func isSpecialParam(exp *syntax.ParamExp) bool {
+	return exp.Short && exp.Param != nil && strings.Contains("$!?#-", exp.Param.Value) && len(exp.Param.Value) == 1
+}
+
+// isOperandWord reports whether a word is a quoted positional parameter with no modifiers,
+// such as "$1", "${2}" or "$@", which expands to operands of the shell without word
+// splitting or globbing.
+func isOperandWord(word *syntax.Word) bool {
+	if len(word.Parts) != 1 {
+		return false
+	}
+	quoted, ok := word.Parts[0].(*syntax.DblQuoted)
+	if !ok || len(quoted.Parts) != 1 {
+		return false
+	}
+	exp, ok := quoted.Parts[0].(*syntax.ParamExp)
+	if !ok || exp.Excl || exp.Length || exp.Width || exp.Index != nil || exp.Slice != nil ||
+		exp.Repl != nil || exp.Names != 0 || exp.Exp != nil {
+		return false
+	}
+	name := exp.Param.Value
+	if name == "@" || name == "*" {
+		return true
+	}
+	for _, c := range name {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// isFileRedirect reports whether a redirection opens a file, as opposed to duplicating a
+// file descriptor (2>&1) or supplying a here-document.
+func isFileRedirect(r *syntax.Redirect) bool {
+	switch r.Op {
+	case syntax.RdrOut, syntax.AppOut, syntax.RdrIn, syntax.RdrInOut, syntax.ClbOut, syntax.RdrAll, syntax.AppAll:
+		return true
+	case syntax.DplIn, syntax.DplOut:
+		// >&file is a file redirection when the target is not a descriptor number or "-"
+		target := r.Word.Lit()
+		if target == "-" {
+			return false
+		}
+		for _, c := range target {
+			if c < '0' || c > '9' {
+				return true
+			}
+		}
+		return target == ""
+	}
+	return false
+}
+
+// ParseEnvCommand extracts the command env runs, skipping options and NAME=VALUE assignments.
+// A -S/--split-string value is split like a shell command line and placed before the operands.
+func ParseEnvCommand(args []string) (EnvCommand, string) {
+	var result EnvCommand
+
+	i := 0
+	for ; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--" {
+			i++
+			break
+		}
+		if arg == "-" {
+			continue
+		}
+
+		// Long options; --unset, --chdir and --split-string take a value
+		if strings.HasPrefix(arg, "--") {
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+			var opt byte
+			switch name {
+			case "unset":
+				opt = 'u'
+			case "chdir":
+				opt = 'C'
+			case "split-string":
+				opt = 'S'
+			default:
+				continue
+			}
+			if !hasValue {
+				if i+1 >= len(args) {
+					return EnvCommand{}, fmt.Sprintf("env option %s requires an argument", arg)
+				}
+				i++
+				value = args[i]
+			}
+			if errMsg := applyEnvOption(&result, opt, value, args[i+1:]); errMsg != "" {
+				return EnvCommand{}, errMsg
+			}
+			if opt == 'S' {
+				return result, ""
+			}
+			continue
+		}
+
+		// Short option bundles; the first option taking a value consumes the rest of the bundle
+		// or the next argument
+		if strings.HasPrefix(arg, "-") {
+			split := false
+			for j := 1; j < len(arg); j++ {
+				if !strings.ContainsRune(envShortOptionsWithArg, rune(arg[j])) {
+					continue
+				}
+				value := arg[j+1:]
+				if value == "" {
+					if i+1 >= len(args) {
+						return EnvCommand{}, fmt.Sprintf("env option -%c requires an argument", arg[j])
+					}
+					i++
+					value = args[i]
+				}
+				if errMsg := applyEnvOption(&result, arg[j], value, args[i+1:]); errMsg != "" {
+					return EnvCommand{}, errMsg
+				}
+				split = arg[j] == 'S'
+				break
+			}
+			if split {
+				return result, ""
+			}
+			continue
+		}
+
+		break
+	}
+
+	// Skip NAME=VALUE assignments before the command
+	for i < len(args) && isEnvAssignment(args[i]) {
+		i++
+	}
+	if i < len(args) {
+		result.Cmd = args[i]
+		result.Args = args[i+1:]
+	}
+	return result, ""
+}
+
+// applyEnvOption records the effect of an env option with a value. For -S the split words and
+// the remaining operands form the command, so the command is resolved here.
+func applyEnvOption(result *EnvCommand, opt byte, value string, rest []string) string {
+	switch opt {
+	case 'C':
+		result.Dir = value
+	case 'S':
+		words, errMsg := splitEnvString(value)
+		if errMsg != "" {
+			return errMsg
+		}
+		split, errMsg := ParseEnvCommand(append(words, rest...))
+		if errMsg != "" {
+			return errMsg
+		}
+		result.Cmd = split.Cmd
+		result.Args = split.Args
+		if split.Dir != "" {
+			result.Dir = split.Dir
+		}
+	}
+	return ""
+}
+
+// splitEnvString splits an env -S string into words using shell quoting rules.
+func splitEnvString(value string) ([]string, string) {
+	file, err := syntax.NewParser().Parse(strings.NewReader(value), "")
+	if err != nil || len(file.Stmts) > 1 {
+		return nil, "env -S string cannot be parsed"
+	}
+	if len(file.Stmts) == 0 {
+		return nil, ""
+	}
+
+	call, ok := file.Stmts[0].Cmd.(*syntax.CallExpr)
+	if !ok || len(file.Stmts[0].Redirs) > 0 {
+		return nil, "env -S string cannot be parsed"
+	}
+
+	words := make([]string, 0, len(call.Assigns)+len(call.Args))
+	for _, assign := range call.Assigns {
+		value, err := expand.Literal(nil, assign.Value)
+		if err != nil {
+			return nil, "env -S string cannot be parsed"
+		}
+		words = append(words, assign.Name.Value+"="+value)
+	}
+	for _, word := range call.Args {
+		if !isStaticWord(word) {
+			return nil, "env -S string cannot be parsed"
+		}
+		value, err := expand.Literal(nil, word)
+		if err != nil {
+			return nil, "env -S string cannot be parsed"
+		}
+		words = append(words, value)
+	}
+	return words, ""
+}
+
+// isEnvAssignment reports whether an env operand is a NAME=VALUE assignment.
+func isEnvAssignment(arg string) bool {
+	name, _, found := strings.Cut(arg, "=")
+	return found && name != ""
+}
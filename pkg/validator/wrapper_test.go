@@ -0,0 +1,204 @@
+package validator
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseShellScriptArg tests the ParseShellScriptArg function.
+func TestParseShellScriptArg(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		wantScript   string
+		wantOperands []string
+		wantFound    bool
+	}{
+		{"Script", []string{"-c", "ls"}, "ls", []string{}, true},
+		{"BundledOption", []string{"-ec", "ls", "name", "arg"}, "ls", []string{"name", "arg"}, true},
+		{"OptionWithValue", []string{"-o", "pipefail", "-c", "ls"}, "ls", []string{}, true},
+		{"DoubleDash", []string{"-c", "--", "ls"}, "ls", []string{}, true},
+		{"LongOptionWithValue", []string{"--rcfile", "rc", "-c", "ls"}, "ls", []string{}, true},
+		{"ScriptFile", []string{"script.sh", "-c"}, "", nil, false},
+		{"Stdin", []string{"-s"}, "", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, operands, found := ParseShellScriptArg(tt.args)
+			if script != tt.wantScript || found != tt.wantFound || !reflect.DeepEqual(operands, tt.wantOperands) {
+				t.Errorf("ParseShellScriptArg(%q) = (%q, %q, %v), want (%q, %q, %v)",
+					tt.args, script, operands, found, tt.wantScript, tt.wantOperands, tt.wantFound)
+			}
+		})
+	}
+}
+
+// TestParseShellScript tests the ParseShellScript function.
+func TestParseShellScript(t *testing.T) {
+	tests := []struct {
+		name          string
+		script        string
+		wantCommands  []ScriptCommand
+		wantRedirects []string
+		wantErr       string
+	}{
+		{
+			name:         "SimpleCommand",
+			script:       "rm -rf foo",
+			wantCommands: []ScriptCommand{{Name: "rm", Args: []string{"-rf", "foo"}}},
+		},
+		{
+			name:   "ListAndPipeline",
+			script: "ls | grep x && echo 'a b'",
+			wantCommands: []ScriptCommand{
+				{Name: "ls", Args: []string{}},
+				{Name: "grep", Args: []string{"x"}},
+				{Name: "echo", Args: []string{"a b"}},
+			},
+		},
+		{
+			name:   "CommandSubstitution",
+			script: "echo $(rm foo)",
+			wantCommands: []ScriptCommand{
+				{Name: "echo", Args: []string{}, Dynamic: true},
+				{Name: "rm", Args: []string{"foo"}},
+			},
+		},
+		{
+			name:   "VariableArgument",
+			script: `P=/etc/passwd; cat "$P"`,
+			wantCommands: []ScriptCommand{
+				{Name: "cat", Args: []string{""}, Dynamic: true},
+			},
+		},
+		{
+			name:   "InheritedVariableArgument",
+			script: `rm -rf "$HOME" ${TMPDIR:-/tmp}/x`,
+			wantCommands: []ScriptCommand{
+				{Name: "rm", Args: []string{"-rf", "", "/tmp/x"}, Dynamic: true},
+			},
+		},
+		{
+			name:   "ArithmeticArgument",
+			script: "echo $((1 + 2))",
+			wantCommands: []ScriptCommand{
+				{Name: "echo", Args: []string{"3"}, Dynamic: true},
+			},
+		},
+		{
+			name:   "SpecialParameters",
+			script: "echo $$ $? \"$!\"",
+			wantCommands: []ScriptCommand{
+				{Name: "echo", Args: []string{""}},
+			},
+		},
+		{
+			name:   "QuotedPositionalParameters",
+			script: `cat "$1" "${2}" "$@"`,
+			wantCommands: []ScriptCommand{
+				{Name: "cat", Args: []string{"", "", ""}},
+			},
+		},
+		{
+			name:   "UnquotedOrModifiedPositionalParameter",
+			script: `cat $1 "${1#x}" "$1/../secret"`,
+			wantCommands: []ScriptCommand{
+				{Name: "cat", Args: []string{"", "/../secret"}, Dynamic: true},
+			},
+		},
+		{
+			name:         "BraceExpansion",
+			script:       "cat {/etc/passwd,x}",
+			wantCommands: []ScriptCommand{{Name: "cat", Args: []string{"/etc/passwd", "x"}}},
+		},
+		{
+			name:         "QuotedName",
+			script:       `"r"'m' foo`,
+			wantCommands: []ScriptCommand{{Name: "rm", Args: []string{"foo"}}},
+		},
+		{
+			name:          "Redirects",
+			script:        "ls > out.txt 2>&1 < in.txt >&/tmp/log",
+			wantCommands:  []ScriptCommand{{Name: "ls", Args: []string{}}},
+			wantRedirects: []string{"out.txt", "in.txt", "/tmp/log"},
+		},
+		{
+			name:         "AssignmentOnly",
+			script:       "X=1; ls",
+			wantCommands: []ScriptCommand{{Name: "ls", Args: []string{}}},
+		},
+		{
+			name:    "VariableCommandName",
+			script:  "$CMD foo",
+			wantErr: "script runs a command whose name cannot be determined statically",
+		},
+		{
+			name:    "GlobCommandName",
+			script:  "/bin/r? foo",
+			wantErr: "script runs a command whose name cannot be determined statically",
+		},
+		{
+			name:    "VariableRedirect",
+			script:  "ls > $OUT",
+			wantErr: "script redirects to a file whose name cannot be determined statically",
+		},
+		{
+			name:    "SyntaxError",
+			script:  "ls 'unterminated",
+			wantErr: "script cannot be parsed: 1:4: reached EOF without closing quote '",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errMsg := ParseShellScript(tt.script)
+			if errMsg != tt.wantErr {
+				t.Fatalf("ParseShellScript(%q) errMsg = %q, want %q", tt.script, errMsg, tt.wantErr)
+			}
+			if tt.wantErr != "" {
+				return
+			}
+			if !reflect.DeepEqual(got.Commands, tt.wantCommands) {
+				t.Errorf("ParseShellScript(%q) commands = %+v, want %+v", tt.script, got.Commands, tt.wantCommands)
+			}
+			if !reflect.DeepEqual(got.Redirects, tt.wantRedirects) {
+				t.Errorf("ParseShellScript(%q) redirects = %q, want %q", tt.script, got.Redirects, tt.wantRedirects)
+			}
+		})
+	}
+}
+
+// TestParseEnvCommand tests the ParseEnvCommand function.
+func TestParseEnvCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    EnvCommand
+		wantErr string
+	}{
+		{"NoCommand", []string{"-i"}, EnvCommand{}, ""},
+		{"Command", []string{"rm", "foo"}, EnvCommand{Cmd: "rm", Args: []string{"foo"}}, ""},
+		{"Assignments", []string{"-i", "A=1", "B=2", "rm"}, EnvCommand{Cmd: "rm", Args: []string{}}, ""},
+		{"Unset", []string{"-u", "PATH", "--unset=HOME", "rm"}, EnvCommand{Cmd: "rm", Args: []string{}}, ""},
+		{"Chdir", []string{"-C", "/etc", "cat", "passwd"}, EnvCommand{Cmd: "cat", Args: []string{"passwd"}, Dir: "/etc"}, ""},
+		{"BundledChdir", []string{"-iC/etc", "cat"}, EnvCommand{Cmd: "cat", Args: []string{}, Dir: "/etc"}, ""},
+		{"SplitString", []string{"-S", "A=1 rm -rf", "foo"}, EnvCommand{Cmd: "rm", Args: []string{"-rf", "foo"}}, ""},
+		{"LongSplitString", []string{"--split-string=rm 'a b'"}, EnvCommand{Cmd: "rm", Args: []string{"a b"}}, ""},
+		{"DoubleDash", []string{"--", "rm"}, EnvCommand{Cmd: "rm", Args: []string{}}, ""},
+		{"MissingValue", []string{"-u"}, EnvCommand{}, "env option -u requires an argument"},
+		{"DynamicSplitString", []string{"-S", "$CMD foo"}, EnvCommand{}, "env -S string cannot be parsed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errMsg := ParseEnvCommand(tt.args)
+			if errMsg != tt.wantErr {
+				t.Fatalf("ParseEnvCommand(%q) errMsg = %q, want %q", tt.args, errMsg, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseEnvCommand(%q) = %+v, want %+v", tt.args, got, tt.want)
+			}
+		})
+	}
+}
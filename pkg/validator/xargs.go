@@ -33,6 +33,121 @@ func (x *XargsParser) ParseXargsCommand(args []string) (string, []string, bool,
 	return "", nil, false, "unable to determine command to be executed by xargs"
 }
 
+// xargsShortOptionsWithArg lists the xargs short options that take a value.
+const xargsShortOptionsWithArg = "adEILnPs"
+
+// ParseXargsArgFiles returns the input files given with -a/--arg-file, which xargs reads
+// its arguments from instead of standard input. Only options before the command are considered.
+func (x *XargsParser) ParseXargsArgFiles(args []string) []string {
+	var files []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		// The first non-flag argument is the command; the rest belongs to it
+		if !strings.HasPrefix(arg, "-") {
+			break
+		}
+
+		if strings.HasPrefix(arg, "--") {
+			switch {
+			case arg == "--arg-file":
+				if i+1 < len(args) {
+					i++
+					files = append(files, args[i])
+				}
+			case strings.HasPrefix(arg, "--arg-file="):
+				files = append(files, strings.TrimPrefix(arg, "--arg-file="))
+			case isFlagWithArg(arg) || arg == "--delimiter":
+				i++ // skip the value
+			}
+			continue
+		}
+
+		// Short option bundles like -0a FILE or -aFILE: the first option taking a value
+		// consumes the rest of the bundle or the next argument
+		for j := 1; j < len(arg); j++ {
+			c := arg[j]
+			if !strings.ContainsRune(xargsShortOptionsWithArg, rune(c)) {
+				// -e, -i and -l take an optional value that must be attached
+				if strings.ContainsRune("eil", rune(c)) {
+					break
+				}
+				continue
+			}
+			value := arg[j+1:]
+			if value == "" && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			if c == 'a' {
+				files = append(files, value)
+			}
+			break
+		}
+	}
+
+	return files
+}
+
+// ParseXargsReplaceString returns the string xargs replaces with input items in the command,
+// given with -I, -i or --replace, or "" when input items are appended to the command instead.
+// Only options before the command are considered.
+func (x *XargsParser) ParseXargsReplaceString(args []string) string {
+	replace := ""
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		// The first non-flag argument is the command; the rest belongs to it
+		if !strings.HasPrefix(arg, "-") {
+			break
+		}
+
+		if strings.HasPrefix(arg, "--") {
+			switch {
+			case arg == "--replace":
+				replace = "{}"
+			case strings.HasPrefix(arg, "--replace="):
+				replace = strings.TrimPrefix(arg, "--replace=")
+			case isFlagWithArg(arg) || arg == "--delimiter":
+				i++ // skip the value
+			}
+			continue
+		}
+
+		// Short option bundles: -i takes an optional attached value defaulting to {}, and
+		// the first option taking a value consumes the rest of the bundle or the next argument
+		for j := 1; j < len(arg); j++ {
+			c := arg[j]
+			if c == 'i' {
+				replace = arg[j+1:]
+				if replace == "" {
+					replace = "{}"
+				}
+				break
+			}
+			if !strings.ContainsRune(xargsShortOptionsWithArg, rune(c)) {
+				if c == 'e' || c == 'l' {
+					break
+				}
+				continue
+			}
+			value := arg[j+1:]
+			if value == "" && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			if c == 'I' {
+				replace = value
+			}
+			break
+		}
+	}
+
+	return replace
+}
+
 // findExecCommand looks for -exec or --exec flag and extracts the command that follows.
 func findExecCommand(args []string) (string, []string, bool) {
 	for i := 0; i < len(args)-1; i++ {
@@ -184,3 +184,62 @@ func runParserTests(t *testing.T, parser *XargsParser, tests []struct {
 		})
 	}
 }
+
+// TestParseXargsArgFiles tests the ParseXargsArgFiles function.
+func TestParseXargsArgFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"NoArgFile", []string{"-n", "1", "echo"}, nil},
+		{"ShortOption", []string{"-a", "/etc/passwd", "echo"}, []string{"/etc/passwd"}},
+		{"AttachedValue", []string{"-a/etc/passwd", "echo"}, []string{"/etc/passwd"}},
+		{"Bundled", []string{"-0a", "/etc/passwd", "echo"}, []string{"/etc/passwd"}},
+		{"LongOption", []string{"--arg-file", "list.txt", "echo"}, []string{"list.txt"}},
+		{"LongOptionWithValue", []string{"--arg-file=list.txt", "echo"}, []string{"list.txt"}},
+		{"AfterOtherOptions", []string{"-n", "1", "--delimiter", ",", "-a", "list.txt", "echo"}, []string{"list.txt"}},
+		{"Multiple", []string{"-a", "a.txt", "-a", "b.txt", "echo"}, []string{"a.txt", "b.txt"}},
+		{"CommandArgument", []string{"grep", "-a", "pattern"}, nil},
+		{"ValueOfOtherOption", []string{"-I", "-a", "echo"}, nil},
+	}
+
+	parser := NewXargsParser()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parser.ParseXargsArgFiles(tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseXargsArgFiles(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseXargsReplaceString tests the ParseXargsReplaceString function.
+func TestParseXargsReplaceString(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"NoReplace", []string{"-n", "1", "echo"}, ""},
+		{"ShortOption", []string{"-I", "%", "echo", "%"}, "%"},
+		{"AttachedValue", []string{"-I{}", "echo", "{}"}, "{}"},
+		{"OptionalValue", []string{"-i", "echo", "{}"}, "{}"},
+		{"OptionalAttachedValue", []string{"-i%", "echo", "%"}, "%"},
+		{"Bundled", []string{"-0I", "%", "echo", "%"}, "%"},
+		{"LongOption", []string{"--replace", "echo", "{}"}, "{}"},
+		{"LongOptionWithValue", []string{"--replace=%", "echo", "%"}, "%"},
+		{"AfterOtherOptions", []string{"-n", "1", "--delimiter", ",", "-I", "%", "echo"}, "%"},
+		{"CommandArgument", []string{"grep", "-I", "pattern"}, ""},
+		{"ValueOfOtherOption", []string{"-a", "-I", "echo"}, ""},
+	}
+
+	parser := NewXargsParser()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parser.ParseXargsReplaceString(tt.args); got != tt.want {
+				t.Errorf("ParseXargsReplaceString(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
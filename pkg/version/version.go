@@ -0,0 +1,78 @@
+// Package version identifies the build of the binaries. Release builds set the variables
+// with the linker:
+//
+//	go build -ldflags "-X github.com/shimizu1995/secure-shell-server/pkg/version.Version=v1.2.0 \
+//		-X github.com/shimizu1995/secure-shell-server/pkg/version.Commit=$(git rev-parse HEAD) \
+//		-X github.com/shimizu1995/secure-shell-server/pkg/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Variables left empty are taken from the build information Go embeds in the binary, when
+// it has them.
+package version
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+var (
+	// Version is the version of the release, "dev" for builds that are not releases.
+	Version = ""
+	// Commit is the git commit the binary was built from.
+	Commit = ""
+	// Date is the time the binary was built, in RFC 3339 format.
+	Date = ""
+)
+
+// Info is the build of the running binary.
+type Info struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+	Date    string `json:"date,omitempty"`
+}
+
+// Get returns the build of the running binary.
+var Get = sync.OnceValue(func() Info {
+	info := Info{Version: Version, Commit: Commit, Date: Date}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+			info.Version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.Date == "":
+				info.Date = setting.Value
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+})
+
+// String returns the version followed by the commit and build date that are known, e.g.
+// "v1.2.0 (commit 0a1b2c3, built 2026-10-15T08:00:00Z)".
+func (i Info) String() string {
+	s := i.Version
+	switch {
+	case i.Commit != "" && i.Date != "":
+		s += fmt.Sprintf(" (commit %s, built %s)", shortCommit(i.Commit), i.Date)
+	case i.Commit != "":
+		s += fmt.Sprintf(" (commit %s)", shortCommit(i.Commit))
+	case i.Date != "":
+		s += fmt.Sprintf(" (built %s)", i.Date)
+	}
+	return s
+}
+
+// shortCommit abbreviates a commit hash to the length git shows.
+func shortCommit(commit string) string {
+	const length = 7
+	if len(commit) > length {
+		return commit[:length]
+	}
+	return commit
+}
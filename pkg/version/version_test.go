@@ -0,0 +1,27 @@
+package version
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestInfoString(t *testing.T) {
+	tests := []struct {
+		info Info
+		want string
+	}{
+		{Info{Version: "v1.2.0"}, "v1.2.0"},
+		{Info{Version: "v1.2.0", Commit: "0a1b2c3d4e5f"}, "v1.2.0 (commit 0a1b2c3)"},
+		{Info{Version: "dev", Date: "2026-10-15T08:00:00Z"}, "dev (built 2026-10-15T08:00:00Z)"},
+		{Info{Version: "v1.2.0", Commit: "0a1b", Date: "2026-10-15T08:00:00Z"}, "v1.2.0 (commit 0a1b, built 2026-10-15T08:00:00Z)"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.info.String())
+	}
+}
+
+func TestGet(t *testing.T) {
+	// Test binaries are not releases and have no version set by the linker
+	assert.Equal(t, "dev", Get().Version)
+}
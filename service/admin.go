@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// adminHandler serves the admin endpoints: the approval endpoint at ApprovalPath, the reload
+// endpoint at ReloadPath and, with a history configured, the history endpoint at
+// HistoryPath. Every request must carry one of the AdminTokens.
+func (s *Server) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	s.registerApprovalRoutes(mux)
+	s.registerReloadRoute(mux)
+	if s.history != nil {
+		s.registerHistoryRoutes(mux)
+	}
+	return requireAuth(mux, s.logger, tokenAuthenticator(s.config.AdminTokens))
+}
+
+// mountAdmin adds the admin endpoints to mux.
+func (s *Server) mountAdmin(mux *http.ServeMux) {
+	admin := s.adminHandler()
+	mux.Handle(ApprovalPath, admin)
+	mux.Handle(ApprovalPath+"/", admin)
+	mux.Handle(ReloadPath, admin)
+	if s.history != nil {
+		mux.Handle(HistoryPath, admin)
+	}
+}
+
+// writeJSONResponse writes v as the JSON response of an admin or API endpoint.
+func writeJSONResponse(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// serveAdmin serves the admin endpoints on AdminAddr until ctx is done, for the stdio
+// transport.
+func (s *Server) serveAdmin(ctx context.Context) error {
+	if len(s.config.AdminTokens) == 0 {
+		return errors.New("adminAddr requires adminTokens")
+	}
+	listener, err := net.Listen("tcp", s.config.AdminAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for admin requests: %w", err)
+	}
+
+	const readTimeout = 10 * time.Second
+	mux := http.NewServeMux()
+	s.mountAdmin(mux)
+	httpServer := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: readTimeout,
+		ReadTimeout:       readTimeout,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = httpServer.Close()
+	}()
+	go func() {
+		if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.LogErrorf("Admin endpoint stopped: %v", err)
+		}
+	}()
+	s.logger.LogInfof("Serving admin endpoints on %s/admin", listener.Addr())
+	return nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+// toolAnnotations are the MCP tool annotations, hints clients use to decide which calls need
+// the user's confirmation. mcp-go does not support them yet, so they are added to tools/list
+// responses by the transports.
+type toolAnnotations struct {
+	ReadOnlyHint    bool `json:"readOnlyHint"`
+	DestructiveHint bool `json:"destructiveHint"`
+	IdempotentHint  bool `json:"idempotentHint"`
+	OpenWorldHint   bool `json:"openWorldHint"`
+}
+
+// annotatedTool is a tool as listed in tools/list, with its annotations if it has any.
+type annotatedTool struct {
+	mcp.Tool
+	Annotations *toolAnnotations
+}
+
+// MarshalJSON adds the annotations to the JSON of the tool.
+func (t annotatedTool) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(t.Tool)
+	if err != nil || t.Annotations == nil {
+		return data, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if fields["annotations"], err = json.Marshal(t.Annotations); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// annotatedToolList is a tools/list result whose tools carry annotations.
+type annotatedToolList struct {
+	mcp.ListToolsResult
+	Tools []annotatedTool `json:"tools"`
+}
+
+// policyAnnotations returns the annotations of the server's tools under the policy cfg.
+// Tools that only report state are read-only. Commands may change or delete files, and
+// reach the network unless the sandbox or container isolates them from it.
+func policyAnnotations(cfg *config.ShellCommandConfig) map[string]toolAnnotations {
+	readOnly := toolAnnotations{ReadOnlyHint: true, IdempotentHint: true}
+	commands := toolAnnotations{DestructiveHint: true, OpenWorldHint: commandsReachNetwork(cfg)}
+	return map[string]toolAnnotations{
+		"run":                   commands,
+		"run_script":            commands,
+		"start_job":             commands,
+		"pwd":                   readOnly,
+		"validate_command":      readOnly,
+		"get_policy":            readOnly,
+		"server_info":           readOnly,
+		"read_file":             readOnly,
+		"list_directory":        readOnly,
+		"job_status":            readOnly,
+		"job_output":            readOnly,
+		"approval_status":       readOnly,
+		"query_history":         readOnly,
+		"set_working_directory": {IdempotentHint: true},
+		"write_file":            {DestructiveHint: true, IdempotentHint: true},
+		"kill_job":              {DestructiveHint: true, IdempotentHint: true},
+	}
+}
+
+// commandsReachNetwork reports whether commands run under cfg may use the network.
+func commandsReachNetwork(cfg *config.ShellCommandConfig) bool {
+	if cfg.Container != nil {
+		return cfg.Container.GetNetwork() != "none"
+	}
+	if cfg.Sandbox != nil {
+		return cfg.Sandbox.AllowNetwork
+	}
+	return true
+}
+
+// annotateResponse adds the annotations of the policy of the client of ctx to a response
+// to tools/list. Other responses are returned unchanged.
+func (s *Server) annotateResponse(ctx context.Context, method string, response mcp.JSONRPCMessage) mcp.JSONRPCMessage {
+	if method != string(mcp.MethodToolsList) {
+		return response
+	}
+	resp, ok := response.(mcp.JSONRPCResponse)
+	if !ok {
+		return response
+	}
+	list, ok := resp.Result.(mcp.ListToolsResult)
+	if !ok {
+		return response
+	}
+
+	annotations := policyAnnotations(s.policyFor(ctx).config)
+	annotated := annotatedToolList{ListToolsResult: list, Tools: make([]annotatedTool, len(list.Tools))}
+	for i, tool := range list.Tools {
+		annotated.Tools[i] = annotatedTool{Tool: tool}
+		if a, ok := annotations[tool.Name]; ok {
+			annotated.Tools[i].Annotations = &a
+		}
+	}
+	resp.Result = annotated
+	return resp
+}
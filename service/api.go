@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// APIRunPath is the path of the REST API's run endpoint, served by Handler when RESTAPI is
+// configured.
+const APIRunPath = "/api/v1/run"
+
+// apiRunRequest is the body of a POST to APIRunPath. The fields are those of the run tool.
+type apiRunRequest struct {
+	Commands []string `json:"commands"`
+	// Mode is "parallel" (default) or "serial"
+	Mode string `json:"mode,omitempty"`
+	// Directory is the directory to run in, absolute or relative to the first allowed directory
+	Directory      string            `json:"directory,omitempty"`
+	TimeoutSeconds int               `json:"timeoutSeconds,omitempty"`
+	Stdin          string            `json:"stdin,omitempty"`
+	MaxOutput      int               `json:"maxOutput,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	// Preflight validates each script before any of it runs
+	Preflight bool `json:"preflight,omitempty"`
+	// StopOnError stops each script at its first failing command
+	StopOnError bool `json:"stopOnError,omitempty"`
+}
+
+// arguments returns the run tool arguments of r.
+func (r apiRunRequest) arguments() map[string]interface{} {
+	commands := make([]interface{}, len(r.Commands))
+	for i, command := range r.Commands {
+		commands[i] = command
+	}
+	args := map[string]interface{}{"commands": commands}
+	if r.Mode != "" {
+		args["mode"] = r.Mode
+	}
+	if r.Directory != "" {
+		args["directory"] = r.Directory
+	}
+	if r.TimeoutSeconds != 0 {
+		args["timeout_seconds"] = float64(r.TimeoutSeconds)
+	}
+	if r.Stdin != "" {
+		args["stdin"] = r.Stdin
+	}
+	if r.MaxOutput != 0 {
+		args["max_output"] = float64(r.MaxOutput)
+	}
+	if r.Preflight {
+		args["preflight"] = true
+	}
+	if r.StopOnError {
+		args["stop_on_error"] = true
+	}
+	if len(r.Env) > 0 {
+		env := make(map[string]interface{}, len(r.Env))
+		for name, value := range r.Env {
+			env[name] = value
+		}
+		args["env"] = env
+	}
+	return args
+}
+
+// apiRunResponse is the response of APIRunPath to commands that were run.
+type apiRunResponse struct {
+	// ExitCode is the exit code of the last command run
+	ExitCode int                `json:"exitCode"`
+	Results  []structuredResult `json:"results"`
+	Canceled bool               `json:"canceled,omitempty"`
+	// DeniedEnv lists the requested environment variables the policy did not set
+	DeniedEnv []string `json:"deniedEnv,omitempty"`
+}
+
+// apiErrorResponse is the response of APIRunPath to requests that ran nothing.
+type apiErrorResponse struct {
+	Error string `json:"error"`
+	// ApprovalID is the ticket of a request queued for a human's approval
+	ApprovalID string `json:"approvalId,omitempty"`
+	// RetryAfterSeconds is when a client that used up its quota may try again
+	RetryAfterSeconds int `json:"retryAfterSeconds,omitempty"`
+}
+
+// apiSession is the MCP session a REST request is handled in. Each request has its own,
+// so a cd in one request does not change the directory of others.
+type apiSession struct {
+	id            string
+	notifications chan mcp.JSONRPCNotification
+	initialized   atomic.Bool
+}
+
+var _ server.ClientSession = (*apiSession)(nil)
+
+// SessionID implements the server.ClientSession interface.
+func (s *apiSession) SessionID() string { return s.id }
+
+// NotificationChannel implements the server.ClientSession interface.
+func (s *apiSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return s.notifications }
+
+// Initialize implements the server.ClientSession interface.
+func (s *apiSession) Initialize() { s.initialized.Store(true) }
+
+// Initialized implements the server.ClientSession interface.
+func (s *apiSession) Initialized() bool { return s.initialized.Load() }
+
+// handleAPIRun serves POST APIRunPath: it runs the commands of an apiRunRequest as the run
+// tool would, under the same policy, approvals and quota, and responds with their results.
+// Commands that fail still respond with 200 OK; see the exit code and results. Requests
+// that run nothing get an error status: 400 for invalid requests, 202 when queued for
+// approval and 429 when the client's quota is used up.
+func (s *Server) handleAPIRun(w http.ResponseWriter, r *http.Request) {
+	var body apiRunRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMessageSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&body); err != nil {
+		writeJSONResponse(w, http.StatusBadRequest, apiErrorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+
+	result, err := s.callInSession(r.Context(), "api-", "run", body.arguments(), nil, s.HandleRunCommand)
+	if err != nil {
+		writeJSONResponse(w, http.StatusInternalServerError, apiErrorResponse{Error: err.Error()})
+		return
+	}
+	s.writeAPIResult(w, result)
+}
+
+// callInSession calls the tool handler with the given arguments in a session of its own,
+// as the REST API and the gRPC transport do for every request, under the client's quota.
+// Notifications sent during the call are passed to notify, or dropped when it is nil; all
+// of them have been passed when callInSession returns.
+func (s *Server) callInSession(
+	ctx context.Context, prefix, name string, args map[string]interface{},
+	notify func(mcp.JSONRPCNotification), handler server.ToolHandlerFunc,
+) (*mcp.CallToolResult, error) {
+	session := &apiSession{id: prefix + rand.Text(), notifications: make(chan mcp.JSONRPCNotification, notificationBufferSize)}
+	session.Initialize()
+	ctx, cancel := context.WithCancel(s.mcpServer.WithContext(ctx, session))
+	defer cancel()
+	defer s.endSession(session.id)
+
+	deliver := func(notification mcp.JSONRPCNotification) {
+		if notify != nil {
+			notify(notification)
+		}
+	}
+	finished := make(chan struct{})
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for {
+			select {
+			case notification := <-session.notifications:
+				deliver(notification)
+			case <-finished:
+				// Deliver what is left of the notifications sent before the call returned
+				for {
+					select {
+					case notification := <-session.notifications:
+						deliver(notification)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	var request mcp.CallToolRequest
+	request.Params.Name = name
+	request.Params.Arguments = args
+	result, err := s.quotaMiddleware(handler)(ctx, request)
+	close(finished)
+	<-drained
+	return result, err
+}
+
+// writeAPIResult writes the run tool result as the response of APIRunPath.
+func (s *Server) writeAPIResult(w http.ResponseWriter, result *mcp.CallToolResult) {
+	if results, ok := result.Meta["results"].([]structuredResult); ok {
+		response := apiRunResponse{Results: results}
+		response.ExitCode, _ = result.Meta["exitCode"].(int)
+		response.Canceled, _ = result.Meta["canceled"].(bool)
+		response.DeniedEnv, _ = result.Meta["deniedEnv"].([]string)
+		writeJSONResponse(w, http.StatusOK, response)
+		return
+	}
+
+	response := apiErrorResponse{Error: resultText(result)}
+	switch {
+	case result.Meta["approvalId"] != nil:
+		response.ApprovalID, _ = result.Meta["approvalId"].(string)
+		writeJSONResponse(w, http.StatusAccepted, response)
+	case result.Meta["quotaExceeded"] != nil:
+		response.RetryAfterSeconds, _ = result.Meta["retryAfterSeconds"].(int)
+		w.Header().Set("Retry-After", strconv.Itoa(response.RetryAfterSeconds))
+		writeJSONResponse(w, http.StatusTooManyRequests, response)
+	default:
+		writeJSONResponse(w, http.StatusBadRequest, response)
+	}
+}
+
+// resultText returns the text content of result.
+func resultText(result *mcp.CallToolResult) string {
+	text := ""
+	for _, content := range result.Content {
+		if c, ok := content.(mcp.TextContent); ok {
+			text += c.Text
+		}
+	}
+	return text
+}
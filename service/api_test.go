@@ -0,0 +1,119 @@
+package service_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/service"
+)
+
+func TestRESTAPI(t *testing.T) {
+	newAPIServer := func(t *testing.T, cfg *config.ShellCommandConfig) *httptest.Server {
+		t.Helper()
+		cfg.AllowedDirectories = []string{t.TempDir()}
+		cfg.AllowCommands = []config.AllowCommand{{Command: "echo"}, {Command: "cat"}}
+		cfg.DefaultErrorMessage = "Command not allowed"
+		cfg.MaxExecutionTime = 10
+		srv, err := service.NewServer(cfg, 0, "")
+		if err != nil {
+			t.Fatalf("Failed to create server: %v", err)
+		}
+		ts := httptest.NewServer(srv.Handler())
+		t.Cleanup(ts.Close)
+		return ts
+	}
+	post := func(t *testing.T, ts *httptest.Server, token, body string) (*http.Response, map[string]interface{}) {
+		t.Helper()
+		req, _ := http.NewRequestWithContext(t.Context(), http.MethodPost, ts.URL+service.APIRunPath, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var response map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&response)
+		return resp, response
+	}
+
+	t.Run("run", func(t *testing.T) {
+		ts := newAPIServer(t, &config.ShellCommandConfig{RESTAPI: true})
+		resp, response := post(t, ts, "", `{"commands":["echo hello","cat"],"mode":"serial","stdin":"from stdin"}`)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %v", resp.StatusCode, response)
+		}
+		results, _ := response["results"].([]interface{})
+		if len(results) != 2 {
+			t.Fatalf("results = %v, want two", response["results"])
+		}
+		if stdout := results[0].(map[string]interface{})["stdout"]; stdout != "hello\n" {
+			t.Errorf("stdout of echo = %q, want hello", stdout)
+		}
+		if stdout := results[1].(map[string]interface{})["stdout"]; stdout != "from stdin" {
+			t.Errorf("stdout of cat = %q, want the stdin", stdout)
+		}
+		if response["exitCode"] != float64(0) {
+			t.Errorf("exitCode = %v, want 0", response["exitCode"])
+		}
+	})
+
+	t.Run("blocked and invalid requests", func(t *testing.T) {
+		ts := newAPIServer(t, &config.ShellCommandConfig{RESTAPI: true})
+		_, response := post(t, ts, "", `{"commands":["rm -rf x"]}`)
+		results, _ := response["results"].([]interface{})
+		if len(results) != 1 || !strings.Contains(results[0].(map[string]interface{})["error"].(string), "Command not allowed") {
+			t.Errorf("blocked command: response = %v, want the policy error", response)
+		}
+
+		for _, body := range []string{`not json`, `{"commands":["echo"],"unknown":1}`, `{"commands":[]}`} {
+			if resp, response := post(t, ts, "", body); resp.StatusCode != http.StatusBadRequest || response["error"] == nil {
+				t.Errorf("%s: status = %d, response = %v, want 400 with an error", body, resp.StatusCode, response)
+			}
+		}
+	})
+
+	t.Run("quota", func(t *testing.T) {
+		// Each request is a session of its own, so quotas apply per authenticated client
+		ts := newAPIServer(t, &config.ShellCommandConfig{
+			RESTAPI:    true,
+			AuthTokens: []config.AuthToken{{Token: "secret", Client: "ci"}},
+			Quota:      &config.QuotaConfig{MaxCalls: 1},
+		})
+		post(t, ts, "secret", `{"commands":["echo one"]}`)
+		resp, response := post(t, ts, "secret", `{"commands":["echo two"]}`)
+		if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+			t.Errorf("over quota: status = %d, Retry-After = %q, want 429 with Retry-After",
+				resp.StatusCode, resp.Header.Get("Retry-After"))
+		}
+		if response["retryAfterSeconds"] == nil {
+			t.Errorf("over quota: response = %v, want retryAfterSeconds", response)
+		}
+	})
+
+	t.Run("authentication", func(t *testing.T) {
+		ts := newAPIServer(t, &config.ShellCommandConfig{
+			RESTAPI:    true,
+			AuthTokens: []config.AuthToken{{Token: "secret", Client: "ci"}},
+		})
+		if resp, _ := post(t, ts, "", `{"commands":["echo hi"]}`); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("without token: status = %d, want 401", resp.StatusCode)
+		}
+		if resp, _ := post(t, ts, "secret", `{"commands":["echo hi"]}`); resp.StatusCode != http.StatusOK {
+			t.Errorf("with token: status = %d, want 200", resp.StatusCode)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		ts := newAPIServer(t, &config.ShellCommandConfig{})
+		if resp, _ := post(t, ts, "", `{"commands":["echo hi"]}`); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("without restApi: status = %d, want 404", resp.StatusCode)
+		}
+	})
+}
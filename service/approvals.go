@@ -0,0 +1,328 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/job"
+	"github.com/shimizu1995/secure-shell-server/pkg/runner"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+// ApprovalPath is the path of the approval endpoint, where humans list the commands waiting
+// for approval and approve or reject them.
+const ApprovalPath = "/admin/approvals"
+
+// Limits of the approval queue.
+const (
+	// maxPendingApprovals is the number of tickets that may wait for a decision at once
+	maxPendingApprovals = 100
+	// maxDecidedApprovals is the number of decided tickets kept for approval_status; the
+	// oldest are forgotten beyond it
+	maxDecidedApprovals = 100
+	// maxRejectReasonSize is the largest request body the reject endpoint reads
+	maxRejectReasonSize = 1 << 16
+)
+
+// approvalStatus is the state of an approval ticket.
+type approvalStatus string
+
+// Approval ticket states.
+const (
+	approvalPending  approvalStatus = "pending"
+	approvalApproved approvalStatus = "approved"
+	approvalRejected approvalStatus = "rejected"
+)
+
+// errApprovalNotFound is returned for ticket IDs that are unknown or have been forgotten.
+var errApprovalNotFound = errors.New("approval not found")
+
+// approvalTicket is a call queued until a human approves or rejects it. Approved tickets run
+// as a background job.
+type approvalTicket struct {
+	ID          string         `json:"id"`
+	Status      approvalStatus `json:"status"`
+	Client      string         `json:"client,omitempty"`
+	Command     string         `json:"command"`
+	Args        []string       `json:"args,omitempty"`
+	WorkingDir  string         `json:"workingDir"`
+	Rule        string         `json:"rule"`
+	RequestedAt time.Time      `json:"requestedAt"`
+	DecidedAt   time.Time      `json:"decidedAt,omitzero"`
+	// DecidedBy is the name of the approval token the ticket was decided with
+	DecidedBy string `json:"decidedBy,omitempty"`
+	// Reason is the reason given for a rejection
+	Reason string `json:"reason,omitempty"`
+	// JobID is the background job an approved ticket runs as
+	JobID string `json:"jobId,omitempty"`
+
+	request runner.Request
+	jobs    *job.Manager
+}
+
+// approvalQueue holds the approval tickets of the server.
+type approvalQueue struct {
+	mu      sync.Mutex
+	tickets map[string]*approvalTicket
+	order   []string // IDs of all tickets, oldest first
+}
+
+// newApprovalQueue creates an empty approval queue.
+func newApprovalQueue() *approvalQueue {
+	return &approvalQueue{tickets: make(map[string]*approvalTicket)}
+}
+
+// add queues t as pending and returns a copy of it with its ID set.
+func (q *approvalQueue) add(t *approvalTicket) (approvalTicket, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pending := 0
+	for _, ticket := range q.tickets {
+		if ticket.Status == approvalPending {
+			pending++
+		}
+	}
+	if pending >= maxPendingApprovals {
+		return approvalTicket{}, fmt.Errorf("%d commands are already waiting for approval, try again later", pending)
+	}
+
+	t.ID = runner.NewRunID()
+	t.Status = approvalPending
+	t.RequestedAt = time.Now()
+	q.tickets[t.ID] = t
+	q.order = append(q.order, t.ID)
+	return *t, nil
+}
+
+// get returns a copy of the ticket with the given ID.
+func (q *approvalQueue) get(id string) (approvalTicket, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t, ok := q.tickets[id]
+	if !ok {
+		return approvalTicket{}, fmt.Errorf("%w: %s", errApprovalNotFound, id)
+	}
+	return *t, nil
+}
+
+// list returns copies of all known tickets, oldest first, optionally only those in status.
+func (q *approvalQueue) list(status approvalStatus) []approvalTicket {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	tickets := make([]approvalTicket, 0, len(q.order))
+	for _, id := range q.order {
+		if t := q.tickets[id]; status == "" || t.Status == status {
+			tickets = append(tickets, *t)
+		}
+	}
+	return tickets
+}
+
+// decide approves or rejects a pending ticket on behalf of approver and returns a copy of
+// it. Approved tickets start running as a background job.
+func (q *approvalQueue) decide(id string, approve bool, approver, reason string) (approvalTicket, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t, ok := q.tickets[id]
+	if !ok {
+		return approvalTicket{}, fmt.Errorf("%w: %s", errApprovalNotFound, id)
+	}
+	if t.Status != approvalPending {
+		return approvalTicket{}, fmt.Errorf("approval %s is already %s", id, t.Status)
+	}
+
+	t.DecidedAt = time.Now()
+	t.DecidedBy = approver
+	if approve {
+		t.Status = approvalApproved
+		req := t.request
+		req.Approved = true
+		t.JobID = t.jobs.StartRequest(req)
+	} else {
+		t.Status = approvalRejected
+		t.Reason = reason
+	}
+	decided := *t
+	q.forgetDecided()
+	return decided, nil
+}
+
+// forgetDecided forgets the oldest decided tickets beyond maxDecidedApprovals. The caller
+// holds q.mu.
+func (q *approvalQueue) forgetDecided() {
+	decided := 0
+	for _, t := range q.tickets {
+		if t.Status != approvalPending {
+			decided++
+		}
+	}
+	kept := q.order[:0]
+	for _, id := range q.order {
+		if decided > maxDecidedApprovals && q.tickets[id].Status != approvalPending {
+			delete(q.tickets, id)
+			decided--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	q.order = kept
+}
+
+// needsApproval reports whether the script of req runs a command listed in requireApproval
+// and would be allowed once approved, with the result that names the rule. Scripts blocked
+// for other reasons need no approval, so that they fail as usual.
+func needsApproval(ctx context.Context, p *policy, req runner.Request) (validator.ValidationResult, bool) {
+	if len(p.config.RequireApproval) == 0 {
+		return validator.ValidationResult{}, false
+	}
+	caller := validator.Caller{Client: req.Client}
+	check := p.validator.CheckScript(validator.WithCaller(ctx, caller), req.Command, req.WorkingDir)
+	if check.Code != validator.CodeApprovalRequired {
+		return validator.ValidationResult{}, false
+	}
+	caller.Approved = true
+	if !p.validator.CheckScript(validator.WithCaller(ctx, caller), req.Command, req.WorkingDir).Allowed {
+		return validator.ValidationResult{}, false
+	}
+	return check, true
+}
+
+// queueForApproval queues req, which needsApproval reported check for, until a human approves
+// or rejects it, and returns the result that tells the client about the ticket.
+func (s *Server) queueForApproval(p *policy, req runner.Request, check validator.ValidationResult) *mcp.CallToolResult {
+	ticket, err := s.approvals.add(&approvalTicket{
+		Client:     req.Client,
+		Command:    req.Command,
+		Args:       req.Args,
+		WorkingDir: req.WorkingDir,
+		Rule:       check.Rule,
+		request:    req,
+		jobs:       p.jobs,
+	})
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+	s.logger.LogInfof("Approval %s requested by %s for %s: %s", ticket.ID, ticket.Client, ticket.Rule, ticket.Command)
+
+	result := mcp.NewToolResultText(fmt.Sprintf("%s. Nothing has run yet: the call was queued as approval %s. "+
+		"Check it with approval_status; once a human approves it, it runs as a background job.",
+		check.Message, ticket.ID))
+	result.Meta = map[string]interface{}{"approvalId": ticket.ID, "status": string(ticket.Status)}
+	return result
+}
+
+// createApprovalStatusTool creates the approval_status tool for following a queued call.
+func createApprovalStatusTool() mcp.Tool {
+	return mcp.NewTool("approval_status",
+		mcp.WithDescription("Show whether a call queued for a human's approval was approved or rejected. "+
+			"Approved calls run as a background job; follow it with job_status and job_output."),
+		mcp.WithString("id", mcp.Required(), mcp.Description("Approval ID returned by the queued call.")),
+	)
+}
+
+// HandleApprovalStatus handles the approval_status tool execution. Clients only see their
+// own tickets.
+func (s *Server) HandleApprovalStatus(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, errResult := jobID(request)
+	if errResult != nil {
+		return errResult, nil
+	}
+	ticket, err := s.approvals.get(id)
+	if err == nil && ticket.Client != clientID(ctx) {
+		err = fmt.Errorf("%w: %s", errApprovalNotFound, id)
+	}
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "id: %s\n", ticket.ID)
+	fmt.Fprintf(&sb, "command: %s\n", ticket.Command)
+	fmt.Fprintf(&sb, "workingDir: %s\n", ticket.WorkingDir)
+	fmt.Fprintf(&sb, "rule: %s\n", ticket.Rule)
+	fmt.Fprintf(&sb, "status: %s\n", ticket.Status)
+	switch ticket.Status {
+	case approvalApproved:
+		fmt.Fprintf(&sb, "jobId: %s\n", ticket.JobID)
+	case approvalRejected:
+		if ticket.Reason != "" {
+			fmt.Fprintf(&sb, "reason: %s\n", ticket.Reason)
+		}
+	}
+
+	result := mcp.NewToolResultText(sb.String())
+	result.Meta = map[string]interface{}{"status": string(ticket.Status)}
+	if ticket.JobID != "" {
+		result.Meta["jobId"] = ticket.JobID
+	}
+	return result, nil
+}
+
+// registerApprovalRoutes adds the approval endpoint at ApprovalPath to the admin mux:
+//
+//	GET  /admin/approvals[?status=pending]  lists the tickets, oldest first
+//	GET  /admin/approvals/{id}              shows a ticket
+//	POST /admin/approvals/{id}/approve      approves a pending ticket, which starts its job
+//	POST /admin/approvals/{id}/reject       rejects a pending ticket, with an optional
+//	                                        {"reason": "..."} body
+//
+// The client name of the admin token is recorded as the ticket's approver.
+func (s *Server) registerApprovalRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+ApprovalPath, func(w http.ResponseWriter, r *http.Request) {
+		writeJSONResponse(w, http.StatusOK, s.approvals.list(approvalStatus(r.URL.Query().Get("status"))))
+	})
+	mux.HandleFunc("GET "+ApprovalPath+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ticket, err := s.approvals.get(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, ticket)
+	})
+	mux.HandleFunc("POST "+ApprovalPath+"/{id}/approve", func(w http.ResponseWriter, r *http.Request) {
+		s.decideApproval(w, r, true, "")
+	})
+	mux.HandleFunc("POST "+ApprovalPath+"/{id}/reject", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRejectReasonSize))
+		if err == nil && len(strings.TrimSpace(string(data))) > 0 {
+			err = json.Unmarshal(data, &body)
+		}
+		if err != nil {
+			http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.decideApproval(w, r, false, body.Reason)
+	})
+}
+
+// decideApproval approves or rejects the ticket named in the path of r and responds with it.
+func (s *Server) decideApproval(w http.ResponseWriter, r *http.Request, approve bool, reason string) {
+	approver := clientName(r.Context())
+	ticket, err := s.approvals.decide(r.PathValue("id"), approve, approver, reason)
+	switch {
+	case errors.Is(err, errApprovalNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if approve {
+		s.logger.LogInfof("Approval %s approved by %s, running as job %s", ticket.ID, approver, ticket.JobID)
+	} else {
+		s.logger.LogInfof("Approval %s rejected by %s: %s", ticket.ID, approver, reason)
+	}
+	writeJSONResponse(w, http.StatusOK, ticket)
+}
@@ -0,0 +1,175 @@
+package service_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/service"
+)
+
+func TestApprovals(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{dir},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    10,
+		RequireApproval:     []string{"echo deploy"},
+		AdminTokens:         []config.AuthToken{{Token: "secret-admin", Client: "alice"}},
+	}
+	srv, err := service.NewServer(cfg, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	ctx := t.Context()
+
+	admin := func(method, path, token, body string) (*http.Response, map[string]interface{}) {
+		t.Helper()
+		req, _ := http.NewRequestWithContext(ctx, method, ts.URL+service.ApprovalPath+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var ticket map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&ticket)
+		return resp, ticket
+	}
+	queue := func(command string) string {
+		t.Helper()
+		result, err := srv.HandleRunCommand(ctx, makeToolRequest(map[string]interface{}{"commands": []interface{}{command}}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, "requires a human's approval")
+		id, ok := result.Meta["approvalId"].(string)
+		if !ok || id == "" {
+			t.Fatalf("expected approvalId in result metadata, got %v", result.Meta)
+		}
+		return id
+	}
+
+	t.Run("commands without approval rule run", func(t *testing.T) {
+		result, err := srv.HandleRunCommand(ctx, makeToolRequest(map[string]interface{}{"commands": []interface{}{"echo hello"}}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, "hello")
+	})
+
+	t.Run("approved call runs as a job", func(t *testing.T) {
+		id := queue("echo deploy now")
+
+		status, err := srv.HandleApprovalStatus(ctx, makeToolRequest(map[string]interface{}{"id": id}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, status, "status: pending\n")
+
+		if resp, _ := admin(http.MethodPost, "/"+id+"/approve", "", ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("approve without token: status = %d, want 401", resp.StatusCode)
+		}
+		resp, ticket := admin(http.MethodPost, "/"+id+"/approve", "secret-admin", "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("approve: status = %d, want 200", resp.StatusCode)
+		}
+		if ticket["status"] != "approved" || ticket["decidedBy"] != "alice" {
+			t.Fatalf("approve: ticket = %v, want approved by alice", ticket)
+		}
+		jobID, _ := ticket["jobId"].(string)
+
+		assertToolSuccess(t, waitForJob(t, srv, jobID), "status: completed\nexitCode: 0\n")
+		output, err := srv.HandleJobOutput(ctx, makeToolRequest(map[string]interface{}{"id": jobID}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, output, "deploy now\n")
+
+		status, err = srv.HandleApprovalStatus(ctx, makeToolRequest(map[string]interface{}{"id": id}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, status, "jobId: "+jobID)
+
+		if resp, _ := admin(http.MethodPost, "/"+id+"/reject", "secret-admin", ""); resp.StatusCode != http.StatusConflict {
+			t.Fatalf("reject after approval: status = %d, want 409", resp.StatusCode)
+		}
+	})
+
+	t.Run("rejected call does not run", func(t *testing.T) {
+		id := queue("echo deploy later")
+
+		resp, ticket := admin(http.MethodPost, "/"+id+"/reject", "secret-admin", `{"reason":"not today"}`)
+		if resp.StatusCode != http.StatusOK || ticket["status"] != "rejected" || ticket["jobId"] != nil {
+			t.Fatalf("reject: status = %d, ticket = %v", resp.StatusCode, ticket)
+		}
+		status, err := srv.HandleApprovalStatus(ctx, makeToolRequest(map[string]interface{}{"id": id}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, status, "status: rejected\nreason: not today\n")
+	})
+
+	t.Run("pending tickets are listed", func(t *testing.T) {
+		id := queue("echo deploy soon")
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+service.ApprovalPath+"?status=pending", nil)
+		req.Header.Set("Authorization", "Bearer secret-admin")
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var tickets []map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&tickets); err != nil {
+			t.Fatalf("failed to decode tickets: %v", err)
+		}
+		if len(tickets) != 1 || tickets[0]["id"] != id || tickets[0]["rule"] != "requireApproval[echo deploy]" {
+			t.Fatalf("pending tickets = %v, want only %s", tickets, id)
+		}
+	})
+
+	t.Run("gated command must be sent alone", func(t *testing.T) {
+		result, err := srv.HandleRunCommand(ctx, makeToolRequest(map[string]interface{}{
+			"commands": []interface{}{"echo hello", "echo deploy"},
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolError(t, result, "send it in a call of its own")
+	})
+
+	t.Run("start_job and run_script are gated", func(t *testing.T) {
+		result, err := srv.HandleStartJob(ctx, makeToolRequest(map[string]interface{}{"command": "echo deploy"}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, "queued as approval")
+
+		result, err = srv.HandleRunScript(ctx, makeToolRequest(map[string]interface{}{"script": "echo ok\necho deploy"}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, "queued as approval")
+	})
+
+	t.Run("unknown ticket", func(t *testing.T) {
+		if resp, _ := admin(http.MethodPost, "/missing/approve", "secret-admin", ""); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("approve unknown: status = %d, want 404", resp.StatusCode)
+		}
+		result, err := srv.HandleApprovalStatus(ctx, makeToolRequest(map[string]interface{}{"id": "missing"}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolError(t, result, "approval not found")
+	})
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+)
+
+// defaultClientName is the client name of tokens configured without one.
+const defaultClientName = "default"
+
+// apiKeyHeader is the header an API key can be sent in instead of a bearer token.
+const apiKeyHeader = "X-API-Key"
+
+// clientNameKey is the context key of the name of the authenticated client.
+type clientNameKey struct{}
+
+// clientName returns the name of the client a request was authenticated as, or "" when
+// the request was not authenticated.
+func clientName(ctx context.Context) string {
+	name, _ := ctx.Value(clientNameKey{}).(string)
+	return name
+}
+
+// requestToken returns the token of a request, sent as "Authorization: Bearer <token>", in
+// the X-API-Key header or, by browsers opening a WebSocket, as a "bearer.<token>"
+// subprotocol.
+func requestToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if token := r.Header.Get(apiKeyHeader); token != "" {
+		return token
+	}
+	return webSocketToken(r)
+}
+
+// authenticator returns the name of the client a token belongs to, or an error when it
+// does not accept the token.
+type authenticator func(ctx context.Context, token string) (string, error)
+
+// tokenAuthenticator accepts the configured tokens. Tokens are compared in constant time,
+// so the timing reveals nothing about them.
+func tokenAuthenticator(tokens []config.AuthToken) authenticator {
+	return func(_ context.Context, token string) (string, error) {
+		name := ""
+		for _, t := range tokens {
+			if t.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 && name == "" {
+				name = t.Client
+				if name == "" {
+					name = defaultClientName
+				}
+			}
+		}
+		if name == "" {
+			return "", errors.New("unknown token")
+		}
+		return name, nil
+	}
+}
+
+// requireAuth wraps next so that only requests with a token accepted by one of
+// authenticators are served. The name of the token's client is added to the request's
+// context. Other requests are rejected with 401 Unauthorized.
+func requireAuth(next http.Handler, log *logger.Logger, authenticators ...authenticator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := requestToken(r)
+		name, err := "", errors.New("no token")
+		if token != "" {
+			for _, authenticate := range authenticators {
+				if name, err = authenticate(r.Context(), token); err == nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			log.LogWarnf("Rejected HTTP request from %s: %v", r.RemoteAddr, err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="secure-shell-server"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientNameKey{}, name)))
+	})
+}
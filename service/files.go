@@ -0,0 +1,527 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+// defaultMaxReadBytes is the most read_file returns at once when the policy does not limit
+// the output size.
+const defaultMaxReadBytes = 1 << 20
+
+// writeFilePermissions are the permissions of files created by write_file.
+const writeFilePermissions = 0o644
+
+// createReadFileTool creates the read_file tool for reading files without a shell.
+func createReadFileTool() mcp.Tool {
+	return mcp.NewTool("read_file",
+		mcp.WithDescription("Read a text file in the allowed directories. "+
+			"Large files are returned in parts; pass the returned next offset to read on."),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("File to read, absolute or relative to the current working directory."),
+		),
+		mcp.WithNumber("offset", mcp.Description("Byte offset to start from (default 0).")),
+		mcp.WithNumber("max_bytes", mcp.Description("Most bytes to return (default and upper bound: the output size limit).")),
+	)
+}
+
+// HandleReadFile handles the read_file tool execution. The file must be accessible under
+// the policy of the client, like a redirection from it in a command.
+func (s *Server) HandleReadFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok || path == "" {
+		return mcp.NewToolResultError("path parameter must be a non-empty string"), nil
+	}
+	offset, err := intArgument(request.Params.Arguments, "offset")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	p := s.policyFor(ctx)
+	limit := readLimit(p.config)
+	maxBytes, err := intArgument(request.Params.Arguments, "max_bytes")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if maxBytes == 0 || maxBytes > limit {
+		maxBytes = limit
+	}
+
+	workingDir, ok := s.currentWorkingDir(ctx)
+	if !ok {
+		return mcp.NewToolResultError(noWorkingDirMessage), nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workingDir, path)
+	}
+	check := s.fileAccessCheck("read_file", p, workingDir, false)
+	if err := check(path); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	f, info, err := openFile(path, check)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer f.Close()
+	data, size, err := readFileRange(f, info, offset, maxBytes)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("%s is a binary file", path)), nil
+	}
+
+	next := offset + len(data)
+	text := string(data)
+	if next < size {
+		text += fmt.Sprintf("\n[Read bytes %d-%d of %d. Call read_file with offset %d to read on.]\n", offset, next, size, next)
+	}
+	result := mcp.NewToolResultText(text)
+	result.Meta = map[string]interface{}{"path": path, "size": size, "nextOffset": next, "eof": next >= size}
+	return result, nil
+}
+
+// readLimit returns the most bytes read_file returns at once under cfg.
+func readLimit(cfg *config.ShellCommandConfig) int {
+	if limit := cfg.GetMaxStdoutSize(); limit > 0 {
+		return limit
+	}
+	return defaultMaxReadBytes
+}
+
+// fileAccessCheck returns a check that p allows the file at a path to be read, or written
+// when write is set, logging the paths it blocks for tool.
+func (s *Server) fileAccessCheck(tool string, p *policy, workingDir string, write bool) func(path string) error {
+	return func(path string) error {
+		if result := p.validator.ValidateFileAccess(path, workingDir, write); !result.Allowed {
+			s.logger.LogWarnf("%s blocked: %s", tool, result.Message)
+			return errors.New(result.Message)
+		}
+		return nil
+	}
+}
+
+// verifyOpened returns an error unless opened, the file or directory opened at path, is
+// still the one path resolves to, and check accepts that resolved path. Checking after the
+// open catches a symlink swapped in between validating path and opening it.
+func verifyOpened(opened fs.FileInfo, path string, check func(resolved string) error) error {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	if err := check(resolved); err != nil {
+		return err
+	}
+	current, err := os.Stat(resolved)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if !os.SameFile(opened, current) {
+		return fmt.Errorf("%s changed while it was opened", path)
+	}
+	return nil
+}
+
+// openFile opens the regular file path for reading once check accepts the path it resolves
+// to, and returns it with its info.
+func openFile(path string, check func(resolved string) error) (*os.File, fs.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if err := verifyOpened(info, path, check); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	return f, info, nil
+}
+
+// readFileRange reads at most maxBytes of the file f, whose info is info, from offset and
+// returns them with the size of the file.
+func readFileRange(f *os.File, info fs.FileInfo, offset, maxBytes int) ([]byte, int, error) {
+	size := int(info.Size())
+	if offset > size {
+		return nil, 0, fmt.Errorf("offset %d is beyond the end of %s (%d bytes)", offset, f.Name(), size)
+	}
+
+	data := make([]byte, min(maxBytes, size-offset))
+	n, err := f.ReadAt(data, int64(offset))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, 0, fmt.Errorf("failed to read %s: %w", f.Name(), err)
+	}
+	return data[:n], size, nil
+}
+
+// createWriteFileTool creates the write_file tool for writing files without a shell.
+func createWriteFileTool() mcp.Tool {
+	return mcp.NewTool("write_file",
+		mcp.WithDescription("Write a text file in the allowed directories, outside read-only directories. "+
+			"Use instead of echo or cat with a redirection."),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("File to write, absolute or relative to the current working directory. Its directory must exist."),
+		),
+		mcp.WithString("content", mcp.Required(), mcp.Description("Complete new content of the file.")),
+		mcp.WithBoolean("create", mcp.Description("Create the file if it does not exist (default true).")),
+		mcp.WithBoolean("overwrite", mcp.Description("Replace the file if it exists (default false).")),
+	)
+}
+
+// HandleWriteFile handles the write_file tool execution. The file must be writable under
+// the policy of the client, like a redirection to it in a command, and pass its writeFile
+// limits.
+func (s *Server) HandleWriteFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.Params.Arguments
+	path, ok := args["path"].(string)
+	if !ok || path == "" {
+		return mcp.NewToolResultError("path parameter must be a non-empty string"), nil
+	}
+	content, ok := args["content"].(string)
+	if !ok {
+		return mcp.NewToolResultError("content parameter must be a string"), nil
+	}
+	create, overwrite := true, false
+	if v, ok := args["create"].(bool); ok {
+		create = v
+	}
+	if v, ok := args["overwrite"].(bool); ok {
+		overwrite = v
+	}
+	if !create && !overwrite {
+		return mcp.NewToolResultError("create and overwrite cannot both be false"), nil
+	}
+
+	workingDir, ok := s.currentWorkingDir(ctx)
+	if !ok {
+		return mcp.NewToolResultError(noWorkingDirMessage), nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workingDir, path)
+	}
+	p := s.policyFor(ctx)
+	check := s.fileAccessCheck("write_file", p, workingDir, true)
+	if err := check(path); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	limits := p.config.WriteFile
+	if !limits.IsExtensionAllowed(path) {
+		s.logger.LogWarnf("write_file blocked: extension of %s is not allowed", path)
+		return mcp.NewToolResultError(fmt.Sprintf("files with the extension of %s may not be written; allowed extensions: %s",
+			path, strings.Join(limits.AllowedExtensions, ", "))), nil
+	}
+	if maxSize := limits.GetMaxFileSize(); len(content) > maxSize {
+		return mcp.NewToolResultError(fmt.Sprintf("content of %d bytes exceeds the limit of %d bytes", len(content), maxSize)), nil
+	}
+
+	created, err := writeFile(path, []byte(content), create, overwrite, check)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	s.logger.LogInfof("write_file wrote %d bytes to %s", len(content), path)
+
+	verb := "Replaced"
+	if created {
+		verb = "Created"
+	}
+	result := mcp.NewToolResultText(fmt.Sprintf("%s %s (%d bytes)", verb, path, len(content)))
+	result.Meta = map[string]interface{}{"path": path, "bytes": len(content), "created": created}
+	return result, nil
+}
+
+// writeFile writes data to path, creating the file only if create is set and replacing an
+// existing one only if overwrite is set. check must accept the path the file resolves to
+// once it is opened. It reports whether the file was created.
+func writeFile(path string, data []byte, create, overwrite bool, check func(resolved string) error) (bool, error) {
+	info, err := os.Stat(path)
+	exists := err == nil
+	switch {
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return false, fmt.Errorf("failed to stat %s: %w", path, err)
+	case exists && !info.Mode().IsRegular():
+		return false, fmt.Errorf("%s is not a regular file", path)
+	case exists && !overwrite:
+		return false, fmt.Errorf("%s already exists; set overwrite to replace it", path)
+	case !exists && !create:
+		return false, fmt.Errorf("%s does not exist; set create to create it", path)
+	}
+
+	var f *os.File
+	if exists {
+		f, err = openExisting(path, info, check)
+	} else {
+		f, err = createFile(path, check)
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return !exists, nil
+}
+
+// openExisting opens the existing file path, whose info is info, for writing and truncates
+// it once it is verified to be that file and check accepts it. The file is opened without
+// O_TRUNC, so a file swapped in after the validation is never truncated.
+func openExisting(path string, info fs.FileInfo, check func(resolved string) error) (*os.File, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	f, err := os.OpenFile(resolved, os.O_WRONLY|openNoFollow, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	opened, err := f.Stat()
+	if err == nil && !os.SameFile(info, opened) {
+		err = fmt.Errorf("%s changed while it was opened", path)
+	}
+	if err == nil {
+		err = verifyOpened(opened, resolved, check)
+	}
+	if err == nil {
+		err = f.Truncate(0)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// createFile creates the file path for writing. Its directory is opened and verified first
+// and the file created in the opened directory, with O_EXCL so a symlink planted at path is
+// not followed.
+func createFile(path string, check func(resolved string) error) (*os.File, error) {
+	dir, name := filepath.Split(path)
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer root.Close()
+	info, err := root.Stat(".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", dir, err)
+	}
+	err = verifyOpened(info, dir, func(resolvedDir string) error {
+		return check(filepath.Join(resolvedDir, name))
+	})
+	if err != nil {
+		return nil, err
+	}
+	f, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, writeFilePermissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// createListDirectoryTool creates the list_directory tool for listing directories without a shell.
+func createListDirectoryTool() mcp.Tool {
+	return mcp.NewTool("list_directory",
+		mcp.WithDescription("List the entries of a directory in the allowed directories as JSON, with their "+
+			"type, size and modification time. Use instead of ls; pass the returned next offset to list on."),
+		mcp.WithString("path",
+			mcp.Description("Directory to list, absolute or relative to the current working directory (default: the current working directory)."),
+		),
+		mcp.WithNumber("depth", mcp.Description("Levels to list: 1 (default) lists the directory's own entries.")),
+		mcp.WithNumber("offset", mcp.Description("Number of entries to skip (default 0).")),
+		mcp.WithNumber("limit", mcp.Description("Most entries to return (default and upper bound: the configured maximum).")),
+	)
+}
+
+// dirEntry is an entry returned by list_directory.
+type dirEntry struct {
+	// Name is the path of the entry relative to the listed directory, separated by slashes
+	Name string `json:"name"`
+	// Type is "file", "directory", "symlink" or "other"
+	Type string `json:"type"`
+	// Size is the size of a file in bytes, 0 for other types
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// dirListing is the result of list_directory.
+type dirListing struct {
+	Path    string     `json:"path"`
+	Entries []dirEntry `json:"entries"`
+	// NextOffset is the offset of the next page, omitted when the listing is complete
+	NextOffset int `json:"nextOffset,omitempty"`
+}
+
+// HandleListDirectory handles the list_directory tool execution. The directory must be
+// accessible under the policy of the client; entries in denyPaths are left out.
+func (s *Server) HandleListDirectory(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.Params.Arguments
+	p := s.policyFor(ctx)
+	limits := p.config.ListDirectory
+
+	depth, err := intArgument(args, "depth")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if depth == 0 {
+		depth = 1
+	}
+	if maxDepth := limits.GetMaxDepth(); depth > maxDepth {
+		return mcp.NewToolResultError(fmt.Sprintf("depth %d exceeds the limit of %d", depth, maxDepth)), nil
+	}
+	offset, err := intArgument(args, "offset")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	limit, err := intArgument(args, "limit")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if maxEntries := limits.GetMaxEntries(); limit == 0 || limit > maxEntries {
+		limit = maxEntries
+	}
+
+	workingDir, ok := s.currentWorkingDir(ctx)
+	if !ok {
+		return mcp.NewToolResultError(noWorkingDirMessage), nil
+	}
+	path, _ := args["path"].(string)
+	if path == "" {
+		path = workingDir
+	} else if !filepath.IsAbs(path) {
+		path = filepath.Join(workingDir, path)
+	}
+	if result := p.validator.ValidatePath(path, workingDir); !result.Allowed {
+		s.logger.LogWarnf("list_directory blocked: %s", result.Message)
+		return mcp.NewToolResultError(result.Message), nil
+	}
+
+	// Walk the directory a symlink points to; the validation above covered its target
+	root, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to open %s: %v", path, err)), nil
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return mcp.NewToolResultError(fmt.Sprintf("%s is not a directory", path)), nil
+	}
+	denied := func(entry string) bool {
+		return p.validator.ValidatePath(entry, root).Code == validator.CodePathDenied
+	}
+	listing := dirListing{Path: path}
+	listing.Entries, listing.NextOffset, err = listDirectory(root, depth, offset, limit, denied)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	data, err := json.Marshal(listing)
+	if err != nil {
+		return mcp.NewToolResultError("failed to encode the listing: " + err.Error()), nil
+	}
+	result := mcp.NewToolResultText(string(data))
+	result.Meta = map[string]interface{}{"entries": len(listing.Entries), "nextOffset": listing.NextOffset}
+	return result, nil
+}
+
+// listDirectory returns the entries of root up to depth levels deep in lexical order,
+// skipping offset entries and returning at most limit. Entries for which skip returns true
+// are left out, with their contents. The returned next offset is 0 when no entries remain.
+// Symlinks are listed but not followed, and unreadable directories are listed without
+// their contents.
+func listDirectory(root string, depth, offset, limit int, skip func(path string) bool) ([]dirEntry, int, error) {
+	entries := []dirEntry{}
+	index, next := 0, 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if path == root {
+			return err
+		}
+		if err != nil || skip(path) {
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if index == offset+limit {
+			next = index
+			return filepath.SkipAll
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if index >= offset {
+			info, err := d.Info()
+			if err != nil {
+				// The entry was removed while listing
+				return nil
+			}
+			entry := dirEntry{Name: filepath.ToSlash(rel), Type: entryType(info.Mode()), ModTime: info.ModTime().UTC()}
+			if info.Mode().IsRegular() {
+				entry.Size = info.Size()
+			}
+			entries = append(entries, entry)
+		}
+		index++
+
+		if d.IsDir() && strings.Count(rel, string(filepath.Separator))+1 >= depth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list %s: %w", root, err)
+	}
+	return entries, next, nil
+}
+
+// entryType returns the type of a directory entry as reported by list_directory.
+func entryType(mode fs.FileMode) string {
+	switch {
+	case mode.IsDir():
+		return "directory"
+	case mode.IsRegular():
+		return "file"
+	case mode&fs.ModeSymlink != 0:
+		return "symlink"
+	default:
+		return "other"
+	}
+}
+
+// intArgument returns the non-negative integer argument name, or 0 when it is not given.
+func intArgument(args map[string]interface{}, name string) (int, error) {
+	raw, ok := args[name]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+	value, ok := raw.(float64)
+	if !ok || value != float64(int(value)) || value < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return int(value), nil
+}
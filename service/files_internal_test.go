@@ -0,0 +1,120 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// within returns a check that only accepts paths in dir.
+func within(dir string) func(string) error {
+	return func(path string) error {
+		if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return errors.New("outside of allowed directories")
+		}
+		return nil
+	}
+}
+
+// swappableLink creates a symlink in an allowed directory pointing to an allowed file,
+// and returns it with a function that points it to a file outside and a check that only
+// accepts paths in the allowed directory.
+func swappableLink(t *testing.T) (link string, swap func(), check func(string) error) {
+	t.Helper()
+	allowedDir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to resolve directory: %v", err)
+	}
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+	allowed := filepath.Join(allowedDir, "allowed.txt")
+	for _, path := range []string{outside, allowed} {
+		if err := os.WriteFile(path, []byte("content of "+filepath.Base(path)), 0o600); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	link = filepath.Join(allowedDir, "link.txt")
+	if err := os.Symlink(allowed, link); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	swap = func() {
+		if err := os.Remove(link); err != nil {
+			t.Fatalf("Failed to remove symlink: %v", err)
+		}
+		if err := os.Symlink(outside, link); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+	}
+	return link, swap, within(allowedDir)
+}
+
+func TestOpenFileSymlinkSwap(t *testing.T) {
+	link, swap, check := swappableLink(t)
+
+	// The link is swapped before the open: the resolved path is rejected
+	swap()
+	if _, _, err := openFile(link, check); err == nil || !strings.Contains(err.Error(), "outside") {
+		t.Errorf("openFile() error = %v, want outside of allowed directories", err)
+	}
+
+	// The file opened through the link is not the one the link resolves to afterwards
+	f, err := os.Open(link)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatalf("Failed to stat: %v", err)
+	}
+	if err := os.Remove(link); err != nil {
+		t.Fatalf("Failed to remove symlink: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(filepath.Dir(link), "allowed.txt"), link); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := verifyOpened(info, link, check); err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Errorf("verifyOpened() error = %v, want the file to have changed", err)
+	}
+}
+
+func TestWriteFileSymlinkSwap(t *testing.T) {
+	t.Run("existing file", func(t *testing.T) {
+		link, swap, check := swappableLink(t)
+		info, err := os.Stat(link)
+		if err != nil {
+			t.Fatalf("Failed to stat: %v", err)
+		}
+		swap()
+		outside, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			t.Fatalf("Failed to resolve symlink: %v", err)
+		}
+
+		if _, err := openExisting(link, info, check); err == nil {
+			t.Fatal("openExisting() opened the file swapped in")
+		}
+		if data, _ := os.ReadFile(outside); string(data) != "content of outside.txt" {
+			t.Errorf("file outside = %q, want it unchanged", data)
+		}
+	})
+
+	t.Run("new file in a swapped directory", func(t *testing.T) {
+		outsideDir := t.TempDir()
+		allowedDir, err := filepath.EvalSymlinks(t.TempDir())
+		if err != nil {
+			t.Fatalf("Failed to resolve directory: %v", err)
+		}
+		sub := filepath.Join(allowedDir, "sub")
+		if err := os.Symlink(outsideDir, sub); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+		if _, err := writeFile(filepath.Join(sub, "new.txt"), []byte("x"), true, false, within(allowedDir)); err == nil {
+			t.Fatal("writeFile() created a file through the swapped directory")
+		}
+		if _, err := os.Stat(filepath.Join(outsideDir, "new.txt")); !os.IsNotExist(err) {
+			t.Errorf("file created outside: %v", err)
+		}
+	})
+}
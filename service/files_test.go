@@ -0,0 +1,324 @@
+package service_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/service"
+)
+
+func TestReadFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	secrets := filepath.Join(tmpDir, "secrets")
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{tmpDir},
+		DenyPaths:           []string{secrets},
+		DefaultErrorMessage: "Command not allowed",
+		MaxOutputSize:       16,
+	}
+	srv, err := service.NewServer(cfg, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ctx := t.Context()
+
+	writeFile := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	writeFile("short.txt", "hello\n")
+	writeFile("long.txt", "0123456789abcdefghijklmnopqrstuvwxyz")
+	writeFile("secrets/key", "secret")
+	writeFile("binary.bin", "a\x00b")
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+	if err := os.WriteFile(outside, []byte("outside"), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := os.Symlink(outside, filepath.Join(tmpDir, "link.txt")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	t.Run("relative path reads the whole file", func(t *testing.T) {
+		result, err := srv.HandleReadFile(ctx, makeToolRequest(map[string]interface{}{"path": "short.txt"}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, "hello")
+		if got := extractText(result); got != "hello\n" {
+			t.Errorf("text = %q, want %q", got, "hello\n")
+		}
+		if result.Meta["eof"] != true || result.Meta["nextOffset"] != 6 {
+			t.Errorf("Meta = %v, want eof at offset 6", result.Meta)
+		}
+	})
+
+	t.Run("large file is read in parts within the output limit", func(t *testing.T) {
+		result, err := srv.HandleReadFile(ctx, makeToolRequest(map[string]interface{}{"path": "long.txt", "max_bytes": float64(100)}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, "0123456789abcdef\n[Read bytes 0-16 of 36. Call read_file with offset 16")
+		if result.Meta["eof"] != false || result.Meta["nextOffset"] != 16 {
+			t.Errorf("Meta = %v, want next offset 16", result.Meta)
+		}
+
+		result, err = srv.HandleReadFile(ctx, makeToolRequest(map[string]interface{}{
+			"path": "long.txt", "offset": float64(32), "max_bytes": float64(10),
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := extractText(result); got != "wxyz" || result.Meta["eof"] != true {
+			t.Errorf("text = %q, Meta = %v, want the last 4 bytes", got, result.Meta)
+		}
+	})
+
+	for _, tt := range []struct{ name, path, want string }{
+		{"denied path", "secrets/key", "denied"},
+		{"outside the allowed directories", outside, "outside of allowed directories"},
+		{"escape with ..", "../" + filepath.Base(filepath.Dir(outside)) + "/outside.txt", "outside of allowed directories"},
+		{"symlink leaving the allowed directories", "link.txt", "outside of allowed directories"},
+		{"directory", "secrets", "denied"},
+		{"not a regular file", ".", "not a regular file"},
+		{"binary file", "binary.bin", "binary file"},
+		{"missing file", "missing.txt", "failed to open"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := srv.HandleReadFile(ctx, makeToolRequest(map[string]interface{}{"path": tt.path}))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertToolError(t, result, tt.want)
+		})
+	}
+
+	t.Run("invalid offset", func(t *testing.T) {
+		for _, offset := range []float64{-1, 1.5, 100} {
+			result, err := srv.HandleReadFile(ctx, makeToolRequest(map[string]interface{}{"path": "short.txt", "offset": offset}))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !result.IsError || !strings.Contains(extractText(result), "offset") {
+				t.Errorf("offset %v: result = %s, want an offset error", offset, extractText(result))
+			}
+		}
+	})
+}
+
+func TestWriteFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	docs := filepath.Join(tmpDir, "docs")
+	if err := os.Mkdir(docs, 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{tmpDir},
+		ReadOnlyDirectories: []string{docs},
+		DenyPaths:           []string{filepath.Join(tmpDir, ".env.txt")},
+		DefaultErrorMessage: "Command not allowed",
+		WriteFile:           &config.WriteFileConfig{MaxFileSize: 10, AllowedExtensions: []string{".txt", "md"}},
+	}
+	srv, err := service.NewServer(cfg, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ctx := t.Context()
+	write := func(args map[string]interface{}) string {
+		t.Helper()
+		result, err := srv.HandleWriteFile(ctx, makeToolRequest(args))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		text := extractText(result)
+		if result.IsError {
+			return "error: " + text
+		}
+		return text
+	}
+	readBack := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		return string(data)
+	}
+
+	if got := write(map[string]interface{}{"path": "notes.txt", "content": "first"}); !strings.HasPrefix(got, "Created") {
+		t.Fatalf("create: %s", got)
+	}
+	if got := readBack("notes.txt"); got != "first" {
+		t.Errorf("notes.txt = %q, want %q", got, "first")
+	}
+
+	// Existing files are only replaced with overwrite
+	if got := write(map[string]interface{}{"path": "notes.txt", "content": "second"}); !strings.Contains(got, "already exists") {
+		t.Errorf("write without overwrite: %s", got)
+	}
+	if got := write(map[string]interface{}{"path": "notes.txt", "content": "second", "overwrite": true}); !strings.HasPrefix(got, "Replaced") {
+		t.Errorf("overwrite: %s", got)
+	}
+	if got := readBack("notes.txt"); got != "second" {
+		t.Errorf("notes.txt = %q, want %q", got, "second")
+	}
+	if got := write(map[string]interface{}{"path": "new.md", "content": "x", "create": false, "overwrite": true}); !strings.Contains(got, "does not exist") {
+		t.Errorf("overwrite without create: %s", got)
+	}
+
+	for _, tt := range []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"read-only directory", map[string]interface{}{"path": "docs/readme.md", "content": "x"}, "read-only"},
+		{"denied path", map[string]interface{}{"path": ".env.txt", "content": "x"}, "denied"},
+		{"outside the allowed directories", map[string]interface{}{"path": "../escape.txt", "content": "x"}, "outside of allowed directories"},
+		{"extension not allowed", map[string]interface{}{"path": "run.sh", "content": "x"}, "allowed extensions: .txt, md"},
+		{"no extension", map[string]interface{}{"path": "Makefile", "content": "x"}, "allowed extensions"},
+		{"too large", map[string]interface{}{"path": "big.txt", "content": "01234567890"}, "exceeds the limit of 10 bytes"},
+		{"missing directory", map[string]interface{}{"path": "missing/a.txt", "content": "x"}, "failed to open"},
+		{"directory", map[string]interface{}{"path": "dir.txt", "content": "x", "overwrite": true}, "not a regular file"},
+		{"nothing allowed", map[string]interface{}{"path": "a.txt", "content": "x", "create": false}, "cannot both be false"},
+		{"missing content", map[string]interface{}{"path": "a.txt"}, "content parameter"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "directory" {
+				if err := os.Mkdir(filepath.Join(tmpDir, "dir.txt"), 0o755); err != nil {
+					t.Fatalf("Failed to create directory: %v", err)
+				}
+			}
+			if got := write(tt.args); !strings.HasPrefix(got, "error: ") || !strings.Contains(got, tt.want) {
+				t.Errorf("write(%v) = %s, want an error containing %q", tt.args, got, tt.want)
+			}
+		})
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "big.txt")); !os.IsNotExist(err) {
+		t.Error("write_file created a file beyond the size limit")
+	}
+}
+
+func TestListDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, dir := range []string{"src/pkg/deep", "secrets"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	for name, content := range map[string]string{
+		"README.md":            "# readme\n",
+		"src/main.go":          "package main\n",
+		"src/pkg/lib.go":       "package pkg\n",
+		"src/pkg/deep/x.go":    "package deep\n",
+		"secrets/key":          "secret",
+		"src/pkg/deep/y.go":    "package deep\n",
+		"src/pkg/deep/z.go":    "package deep\n",
+		"src/pkg/deep/zz.go":   "package deep\n",
+		"src/pkg/deep/zzz.go":  "package deep\n",
+		"src/pkg/deep/zzzz.go": "package deep\n",
+	} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	if err := os.Symlink("/etc", filepath.Join(tmpDir, "etc-link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{tmpDir},
+		DenyPaths:           []string{filepath.Join(tmpDir, "secrets")},
+		DefaultErrorMessage: "Command not allowed",
+		ListDirectory:       &config.ListDirectoryConfig{MaxDepth: 3, MaxEntries: 5},
+	}
+	srv, err := service.NewServer(cfg, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ctx := t.Context()
+
+	type entry struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+		Size int64  `json:"size"`
+	}
+	list := func(args map[string]interface{}) ([]entry, int) {
+		t.Helper()
+		result, err := srv.HandleListDirectory(ctx, makeToolRequest(args))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.IsError {
+			t.Fatalf("list_directory(%v) failed: %s", args, extractText(result))
+		}
+		var listing struct {
+			Entries    []entry `json:"entries"`
+			NextOffset int     `json:"nextOffset"`
+		}
+		if err := json.Unmarshal([]byte(extractText(result)), &listing); err != nil {
+			t.Fatalf("list_directory did not return JSON: %v", err)
+		}
+		return listing.Entries, listing.NextOffset
+	}
+	names := func(entries []entry) string {
+		parts := make([]string, len(entries))
+		for i, e := range entries {
+			parts[i] = e.Name + ":" + e.Type
+		}
+		return strings.Join(parts, " ")
+	}
+
+	// The working directory by default, one level deep, without denied entries
+	entries, next := list(map[string]interface{}{})
+	if got, want := names(entries), "README.md:file etc-link:symlink src:directory"; got != want {
+		t.Errorf("entries = %s, want %s", got, want)
+	}
+	if next != 0 || entries[0].Size != 9 || entries[2].Size != 0 {
+		t.Errorf("entries = %+v, next = %d, want sizes of files only and no next page", entries, next)
+	}
+
+	// Deeper listings are paginated
+	entries, next = list(map[string]interface{}{"path": "src", "depth": float64(3)})
+	if got, want := names(entries), "main.go:file pkg:directory pkg/deep:directory pkg/deep/x.go:file pkg/deep/y.go:file"; got != want {
+		t.Errorf("page 1 = %s, want %s", got, want)
+	}
+	if next != 5 {
+		t.Fatalf("next offset = %d, want 5", next)
+	}
+	entries, next = list(map[string]interface{}{"path": "src", "depth": float64(3), "offset": float64(next), "limit": float64(2)})
+	if got, want := names(entries), "pkg/deep/z.go:file pkg/deep/zz.go:file"; got != want {
+		t.Errorf("page 2 = %s, want %s", got, want)
+	}
+	entries, next = list(map[string]interface{}{"path": "src", "depth": float64(3), "offset": float64(next)})
+	if got, want := names(entries), "pkg/deep/zzz.go:file pkg/deep/zzzz.go:file pkg/lib.go:file"; got != want || next != 0 {
+		t.Errorf("page 3 = %s (next %d), want %s", got, next, want)
+	}
+
+	for _, tt := range []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"depth beyond the limit", map[string]interface{}{"depth": float64(4)}, "exceeds the limit of 3"},
+		{"denied directory", map[string]interface{}{"path": "secrets"}, "denied"},
+		{"outside the allowed directories", map[string]interface{}{"path": "etc-link"}, "outside of allowed directories"},
+		{"file", map[string]interface{}{"path": "README.md"}, "not a directory"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := srv.HandleListDirectory(ctx, makeToolRequest(tt.args))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertToolError(t, result, tt.want)
+		})
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package service
+
+import "syscall"
+
+// openNoFollow makes opening a file fail when its final component is a symlink.
+const openNoFollow = syscall.O_NOFOLLOW
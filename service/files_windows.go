@@ -0,0 +1,7 @@
+//go:build windows
+
+package service
+
+// openNoFollow is not applied on Windows, which has no O_NOFOLLOW; writes still verify the
+// opened file before changing it.
+const openNoFollow = 0
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/grpcapi"
+)
+
+// grpcService implements the SecureShell gRPC service with the handlers of the run and
+// validate_command tools. Every call runs in a session of its own.
+type grpcService struct {
+	grpcapi.UnimplementedSecureShellServer
+	server *Server
+}
+
+// GRPCServer returns the grpc.Server StartGRPC listens with, serving the SecureShell
+// service. With AuthTokens or OIDC configured, every call must carry one of the tokens or a
+// JWT issued by the OIDC provider in its authorization or x-api-key metadata. With TLS
+// configured, it serves TLS with the certificate and client CA of the HTTP transport.
+func (s *Server) GRPCServer() (*grpc.Server, error) {
+	var opts []grpc.ServerOption
+	if s.config.TLS != nil {
+		tlsConfig, err := newTLSConfig(*s.config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	if authenticators := s.authenticators(); len(authenticators) > 0 {
+		opts = append(opts,
+			grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				ctx, err := s.authenticateGRPC(ctx, authenticators)
+				if err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				ctx, err := s.authenticateGRPC(ss.Context(), authenticators)
+				if err != nil {
+					return err
+				}
+				return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+			}),
+		)
+	}
+
+	grpcServer := grpc.NewServer(opts...)
+	grpcapi.RegisterSecureShellServer(grpcServer, &grpcService{server: s})
+	return grpcServer, nil
+}
+
+// StartGRPC serves the gRPC transport on the socket named "grpc" passed by systemd socket
+// activation or else on the port of the GRPC configuration.
+func (s *Server) StartGRPC() error {
+	if s.config.GRPC == nil {
+		return errors.New("the gRPC transport is not configured")
+	}
+	grpcServer, err := s.GRPCServer()
+	if err != nil {
+		return err
+	}
+	listener, err := activatedListener(true)
+	if err != nil {
+		return err
+	}
+	if listener == nil {
+		if listener, err = net.Listen("tcp", fmt.Sprintf(":%d", s.config.GRPC.Port)); err != nil {
+			return fmt.Errorf("failed to listen for gRPC: %w", err)
+		}
+	}
+	s.logger.LogInfof("Starting gRPC server on %s", listener.Addr())
+	return grpcServer.Serve(listener)
+}
+
+// authenticatedStream is a server stream with the context of its authenticated client.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context of the authenticated client.
+func (s *authenticatedStream) Context() context.Context { return s.ctx }
+
+// authenticateGRPC adds the name of the client to ctx when the call carries a token
+// accepted by one of authenticators, and returns an Unauthenticated error otherwise.
+func (s *Server) authenticateGRPC(ctx context.Context, authenticators []authenticator) (context.Context, error) {
+	token := ""
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("authorization"); len(values) > 0 {
+		token, _ = strings.CutPrefix(values[0], "Bearer ")
+		token = strings.TrimSpace(token)
+	} else if values := md.Get(strings.ToLower(apiKeyHeader)); len(values) > 0 {
+		token = values[0]
+	}
+
+	name, err := "", errors.New("no token")
+	if token != "" {
+		for _, authenticate := range authenticators {
+			if name, err = authenticate(ctx, token); err == nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		addr := "unknown address"
+		if p, ok := peer.FromContext(ctx); ok {
+			addr = p.Addr.String()
+		}
+		s.logger.LogWarnf("Rejected gRPC call from %s: %v", addr, err)
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return context.WithValue(ctx, clientNameKey{}, name), nil
+}
+
+// RunCommand implements grpcapi.SecureShellServer.
+func (g *grpcService) RunCommand(ctx context.Context, req *grpcapi.RunRequest) (*grpcapi.RunResponse, error) {
+	result, err := g.server.callInSession(ctx, "grpc-", "run", runRequestArguments(req), nil, g.server.HandleRunCommand)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return runResponse(result)
+}
+
+// StreamOutput implements grpcapi.SecureShellServer.
+func (g *grpcService) StreamOutput(req *grpcapi.RunRequest, stream grpc.ServerStreamingServer[grpcapi.RunEvent]) error {
+	args := runRequestArguments(req)
+	args["stream"] = true
+	notify := func(notification mcp.JSONRPCNotification) {
+		data, _ := notification.Params.AdditionalFields["data"].(map[string]any)
+		if notification.Method != "notifications/message" || data == nil {
+			return
+		}
+		chunk := &grpcapi.OutputChunk{}
+		chunk.Command, _ = data["command"].(string)
+		chunk.Stream, _ = data["stream"].(string)
+		chunk.Text, _ = data["text"].(string)
+		// A client that went away stops the call through the stream's context
+		_ = stream.Send(&grpcapi.RunEvent{Event: &grpcapi.RunEvent_Output{Output: chunk}})
+	}
+
+	result, err := g.server.callInSession(stream.Context(), "grpc-", "run", args, notify, g.server.HandleRunCommand)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	response, err := runResponse(result)
+	if err != nil {
+		return err
+	}
+	return stream.Send(&grpcapi.RunEvent{Event: &grpcapi.RunEvent_Result{Result: response}})
+}
+
+// Validate implements grpcapi.SecureShellServer.
+func (g *grpcService) Validate(ctx context.Context, req *grpcapi.ValidateRequest) (*grpcapi.ValidateResponse, error) {
+	args := map[string]interface{}{"command": req.GetCommand()}
+	if req.GetDirectory() != "" {
+		args["directory"] = req.GetDirectory()
+	}
+	result, err := g.server.callInSession(ctx, "grpc-", "validate_command", args, nil, g.server.HandleValidateCommand)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if result.IsError {
+		return nil, toolError(result)
+	}
+
+	response := &grpcapi.ValidateResponse{}
+	response.Allowed, _ = result.Meta["allowed"].(bool)
+	response.Command, _ = result.Meta["command"].(string)
+	response.Code, _ = result.Meta["code"].(string)
+	response.Category, _ = result.Meta["category"].(string)
+	response.Rule, _ = result.Meta["rule"].(string)
+	response.Message, _ = result.Meta["message"].(string)
+	response.DocUrl, _ = result.Meta["docUrl"].(string)
+	response.WorkingDir, _ = result.Meta["workingDir"].(string)
+	return response, nil
+}
+
+// runRequestArguments returns the run tool arguments of req.
+func runRequestArguments(req *grpcapi.RunRequest) map[string]interface{} {
+	return apiRunRequest{
+		Commands:       req.GetCommands(),
+		Mode:           req.GetMode(),
+		Directory:      req.GetDirectory(),
+		TimeoutSeconds: int(req.GetTimeoutSeconds()),
+		Stdin:          req.GetStdin(),
+		MaxOutput:      int(req.GetMaxOutput()),
+		Env:            req.GetEnv(),
+	}.arguments()
+}
+
+// runResponse converts the run tool result to the response of RunCommand. Commands queued
+// for approval return only the ticket; calls that ran nothing otherwise return an error.
+func runResponse(result *mcp.CallToolResult) (*grpcapi.RunResponse, error) {
+	results, ok := result.Meta["results"].([]structuredResult)
+	if !ok {
+		if id, ok := result.Meta["approvalId"].(string); ok {
+			return &grpcapi.RunResponse{ApprovalId: id}, nil
+		}
+		return nil, toolError(result)
+	}
+
+	response := &grpcapi.RunResponse{Results: make([]*grpcapi.CommandResult, len(results))}
+	for i, r := range results {
+		response.Results[i] = &grpcapi.CommandResult{
+			RunId:                r.RunID,
+			Command:              r.Command,
+			Stdout:               r.Stdout,
+			Stderr:               r.Stderr,
+			ExitCode:             int32(r.ExitCode), //nolint:gosec // exit codes fit in 32 bits
+			DurationMs:           r.DurationMs,
+			StdoutTruncated:      r.StdoutTruncated,
+			StderrTruncated:      r.StderrTruncated,
+			StdoutRemainingBytes: int32(r.StdoutRemainingBytes), //nolint:gosec // bounded by the output limit
+			StderrRemainingBytes: int32(r.StderrRemainingBytes), //nolint:gosec // bounded by the output limit
+			Error:                r.Error,
+			Canceled:             r.Canceled,
+			Segments:             make([]*grpcapi.OutputSegment, len(r.Segments)),
+		}
+		for j, segment := range r.Segments {
+			response.Results[i].Segments[j] = &grpcapi.OutputSegment{
+				Stream: segment.Stream,
+				Offset: int32(segment.Offset), //nolint:gosec // bounded by the output limit
+				Length: int32(segment.Length), //nolint:gosec // bounded by the output limit
+				AtMs:   segment.AtMs,
+			}
+		}
+	}
+	exitCode, _ := result.Meta["exitCode"].(int)
+	response.ExitCode = int32(exitCode) //nolint:gosec // exit codes fit in 32 bits
+	response.Canceled, _ = result.Meta["canceled"].(bool)
+	response.DeniedEnv, _ = result.Meta["deniedEnv"].([]string)
+	return response, nil
+}
+
+// toolError converts the error result of a tool to a gRPC status: ResourceExhausted when
+// the client's quota is used up, InvalidArgument otherwise.
+func toolError(result *mcp.CallToolResult) error {
+	if result.Meta["quotaExceeded"] != nil {
+		return status.Error(codes.ResourceExhausted, resultText(result))
+	}
+	return status.Error(codes.InvalidArgument, resultText(result))
+}
@@ -0,0 +1,145 @@
+package service_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/grpcapi"
+	"github.com/shimizu1995/secure-shell-server/service"
+)
+
+// newGRPCClient serves the gRPC transport of a server with cfg and returns a client of it.
+func newGRPCClient(t *testing.T, cfg *config.ShellCommandConfig) grpcapi.SecureShellClient {
+	t.Helper()
+	cfg.AllowedDirectories = []string{t.TempDir()}
+	cfg.AllowCommands = []config.AllowCommand{{Command: "echo"}, {Command: "cat"}}
+	cfg.DefaultErrorMessage = "Command not allowed"
+	cfg.MaxExecutionTime = 10
+	srv, err := service.NewServer(cfg, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	grpcServer, err := srv.GRPCServer()
+	if err != nil {
+		t.Fatalf("Failed to create gRPC server: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go func() { _ = grpcServer.Serve(listener) }()
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return grpcapi.NewSecureShellClient(conn)
+}
+
+func TestGRPCTransport(t *testing.T) {
+	t.Run("run command", func(t *testing.T) {
+		client := newGRPCClient(t, &config.ShellCommandConfig{})
+		response, err := client.RunCommand(t.Context(), &grpcapi.RunRequest{
+			Commands: []string{"echo hello", "cat"}, Mode: "serial", Stdin: "from stdin",
+		})
+		if err != nil {
+			t.Fatalf("RunCommand failed: %v", err)
+		}
+		if len(response.GetResults()) != 2 {
+			t.Fatalf("results = %v, want two", response.GetResults())
+		}
+		if got := response.GetResults()[0].GetStdout(); got != "hello\n" {
+			t.Errorf("stdout of echo = %q, want hello", got)
+		}
+		if got := response.GetResults()[1].GetStdout(); got != "from stdin" {
+			t.Errorf("stdout of cat = %q, want the stdin", got)
+		}
+
+		response, err = client.RunCommand(t.Context(), &grpcapi.RunRequest{Commands: []string{"rm -rf x"}})
+		if err != nil {
+			t.Fatalf("RunCommand of a blocked command failed: %v", err)
+		}
+		if got := response.GetResults()[0].GetError(); !strings.Contains(got, "Command not allowed") {
+			t.Errorf("error of blocked command = %q, want the policy error", got)
+		}
+
+		_, err = client.RunCommand(t.Context(), &grpcapi.RunRequest{})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("RunCommand without commands: err = %v, want InvalidArgument", err)
+		}
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		client := newGRPCClient(t, &config.ShellCommandConfig{})
+		response, err := client.Validate(t.Context(), &grpcapi.ValidateRequest{Command: "echo hi"})
+		if err != nil || !response.GetAllowed() {
+			t.Errorf("Validate(echo) = %v, %v, want allowed", response, err)
+		}
+		response, err = client.Validate(t.Context(), &grpcapi.ValidateRequest{Command: "rm x"})
+		if err != nil || response.GetAllowed() || response.GetCommand() != "rm" {
+			t.Errorf("Validate(rm) = %v, %v, want blocked", response, err)
+		}
+	})
+
+	t.Run("stream output", func(t *testing.T) {
+		client := newGRPCClient(t, &config.ShellCommandConfig{})
+		stream, err := client.StreamOutput(t.Context(), &grpcapi.RunRequest{Commands: []string{"echo streamed"}})
+		if err != nil {
+			t.Fatalf("StreamOutput failed: %v", err)
+		}
+		var output strings.Builder
+		var result *grpcapi.RunResponse
+		for {
+			event, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Recv failed: %v", err)
+			}
+			if chunk := event.GetOutput(); chunk != nil {
+				output.WriteString(chunk.GetText())
+			}
+			if event.GetResult() != nil {
+				result = event.GetResult()
+			}
+		}
+		if output.String() != "streamed\n" {
+			t.Errorf("streamed output = %q, want the command output", output.String())
+		}
+		if result == nil || result.GetResults()[0].GetStdout() != "streamed\n" {
+			t.Errorf("result = %v, want the command result last", result)
+		}
+	})
+
+	t.Run("authentication and quota", func(t *testing.T) {
+		client := newGRPCClient(t, &config.ShellCommandConfig{
+			AuthTokens: []config.AuthToken{{Token: "secret", Client: "ci"}},
+			Quota:      &config.QuotaConfig{MaxCalls: 1},
+		})
+		request := &grpcapi.RunRequest{Commands: []string{"echo hi"}}
+		if _, err := client.RunCommand(t.Context(), request); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("without token: err = %v, want Unauthenticated", err)
+		}
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+		if _, err := client.RunCommand(ctx, request); err != nil {
+			t.Errorf("with token: err = %v", err)
+		}
+		if _, err := client.RunCommand(ctx, request); status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("over quota: err = %v, want ResourceExhausted", err)
+		}
+	})
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/history"
+	"github.com/shimizu1995/secure-shell-server/pkg/runner"
+)
+
+// HistoryPath is the path of the history endpoint, where admins query the executions of all
+// clients.
+const HistoryPath = "/admin/history"
+
+// Limits of history queries.
+const (
+	// defaultHistoryLimit is the number of records a query returns without a limit
+	defaultHistoryLimit = 100
+	// maxHistoryLimit is the largest limit a query may ask for
+	maxHistoryLimit = 1000
+	// defaultQueryHistoryLimit and maxQueryHistoryLimit are the default and largest limit of
+	// query_history, lower than the endpoint's to save the client's context
+	defaultQueryHistoryLimit = 20
+	maxQueryHistoryLimit     = 100
+)
+
+// openHistory opens the history of cfg and records the runs of every policy in it.
+func (s *Server) openHistory(cfg config.HistoryConfig) error {
+	if cfg.Path == "" {
+		return errors.New("history requires a path")
+	}
+	store, err := history.Open(cfg.Path, history.Retention{
+		MaxRecords: cfg.GetMaxRecords(),
+		MaxAge:     cfg.GetMaxAge(),
+	})
+	if err != nil {
+		return err
+	}
+	s.history = store
+	s.observeRuns(s.policies.Load())
+	return nil
+}
+
+// observeRuns records the runs of every policy of set in the history, if there is one.
+func (s *Server) observeRuns(set *policySet) {
+	if s.history == nil {
+		return
+	}
+	for _, p := range set.policies() {
+		p.runner.SetRunObserver(s.recordRun)
+	}
+}
+
+// recordRun records the run described by audit in the history.
+func (s *Server) recordRun(audit runner.AuditRecord) {
+	if err := s.history.Add(historyRecord(audit)); err != nil {
+		s.logger.LogErrorf("Failed to record run %s in the history: %v", audit.ID, err)
+	}
+}
+
+// historyRecord returns the history record of the run described by audit.
+func historyRecord(audit runner.AuditRecord) history.Record {
+	record := history.Record{
+		ID:          audit.ID,
+		Client:      audit.Client,
+		StartedAt:   audit.StartedAt,
+		FinishedAt:  audit.FinishedAt,
+		WorkingDir:  audit.WorkingDir,
+		Command:     audit.Script,
+		ExitCode:    audit.ExitCode,
+		Error:       audit.Error,
+		StdoutBytes: audit.Stdout.Bytes,
+		StderrBytes: audit.Stderr.Bytes,
+		StdoutLog:   audit.StdoutLog,
+		StderrLog:   audit.StderrLog,
+	}
+	switch {
+	case audit.Error == runner.ErrCanceled.Error():
+		record.Status = history.StatusCanceled
+	case audit.ExitCode == 0:
+		record.Status = history.StatusSucceeded
+	case audit.ExitCode == runner.ExitCodeNotRun:
+		record.Status = history.StatusError
+	default:
+		record.Status = history.StatusFailed
+	}
+	return record
+}
+
+// parseHistoryLimit returns the limit named by value, defaultHistoryLimit when it is empty.
+func parseHistoryLimit(value string) (int, error) {
+	if value == "" {
+		return defaultHistoryLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxHistoryLimit {
+		return 0, fmt.Errorf("invalid limit %q: must be between 1 and %d", value, maxHistoryLimit)
+	}
+	return limit, nil
+}
+
+// registerHistoryRoutes adds the history endpoint at HistoryPath to the admin mux:
+//
+//	GET /admin/history[?client=&command=&status=&since=&until=&limit=]
+//
+// lists the matching records, most recent first. since and until are RFC 3339 times or
+// durations before now.
+func (s *Server) registerHistoryRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+HistoryPath, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := history.Filter{Client: query.Get("client"), Command: query.Get("command")}
+		var err error
+		if filter.Status, err = history.ParseStatus(query.Get("status")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if filter.Limit, err = parseHistoryLimit(query.Get("limit")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+			if *t, err = history.ParseTime(name, query.Get(name)); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		records, err := s.history.Query(filter)
+		if err != nil {
+			s.logger.LogErrorf("Failed to query the history: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, records)
+	})
+}
+
+// createQueryHistoryTool creates the query_history tool for recalling the client's earlier
+// executions.
+func createQueryHistoryTool() mcp.Tool {
+	return mcp.NewTool("query_history",
+		mcp.WithDescription("List your earlier executions as JSON, most recent first: command, directory, "+
+			"status, exit code, times and output sizes. Use it to recall what already ran instead of running it again."),
+		mcp.WithString("since", mcp.Description("Only executions started at or after this RFC 3339 time, "+
+			"or this long ago, e.g. \"2h\".")),
+		mcp.WithString("until", mcp.Description("Only executions started before this RFC 3339 time, or this long ago.")),
+		mcp.WithString("command", mcp.Description("Only executions whose command contains this text.")),
+		mcp.WithString("status",
+			mcp.Description("Only executions that ended this way."),
+			mcp.Enum(string(history.StatusSucceeded), string(history.StatusFailed),
+				string(history.StatusError), string(history.StatusCanceled)),
+		),
+		mcp.WithNumber("limit", mcp.Description(fmt.Sprintf("Most executions to return (default %d, at most %d).",
+			defaultQueryHistoryLimit, maxQueryHistoryLimit))),
+	)
+}
+
+// HandleQueryHistory handles the query_history tool execution. Clients only see their own
+// executions.
+func (s *Server) HandleQueryHistory(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.Params.Arguments
+	filter := history.Filter{Client: clientID(ctx)}
+	filter.Command, _ = args["command"].(string)
+
+	status, _ := args["status"].(string)
+	var err error
+	if filter.Status, err = history.ParseStatus(status); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value, _ := args[name].(string)
+		if *t, err = history.ParseTime(name, value); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+	if filter.Limit, err = intArgument(args, "limit"); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultQueryHistoryLimit
+	}
+	filter.Limit = min(filter.Limit, maxQueryHistoryLimit)
+
+	records, err := s.history.Query(filter)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError("failed to encode the history: " + err.Error()), nil
+	}
+	result := mcp.NewToolResultText(string(data))
+	result.Meta = map[string]interface{}{"executions": len(records)}
+	return result, nil
+}
@@ -0,0 +1,174 @@
+package service_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/history"
+	"github.com/shimizu1995/secure-shell-server/service"
+)
+
+func TestHistoryEndpoint(t *testing.T) {
+	historyPath := filepath.Join(t.TempDir(), "history.db")
+	newHistoryServer := func(t *testing.T) *httptest.Server {
+		t.Helper()
+		cfg := &config.ShellCommandConfig{
+			AllowedDirectories:  []string{t.TempDir()},
+			AllowCommands:       []config.AllowCommand{{Command: "echo"}, {Command: "exit"}},
+			DefaultErrorMessage: "Command not allowed",
+			MaxExecutionTime:    10,
+			History:             &config.HistoryConfig{Path: historyPath},
+			AdminTokens:         []config.AuthToken{{Token: "secret-admin", Client: "alice"}},
+		}
+		srv, err := service.NewServer(cfg, 0, "")
+		if err != nil {
+			t.Fatalf("Failed to create server: %v", err)
+		}
+		ts := httptest.NewServer(srv.Handler())
+		t.Cleanup(ts.Close)
+		return ts
+	}
+	query := func(t *testing.T, ts *httptest.Server, token, params string) (int, []history.Record) {
+		t.Helper()
+		req, _ := http.NewRequestWithContext(t.Context(), http.MethodGet, ts.URL+service.HistoryPath+params, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var records []history.Record
+		_ = json.NewDecoder(resp.Body).Decode(&records)
+		return resp.StatusCode, records
+	}
+
+	ts := newHistoryServer(t)
+	sessionID := initializeSession(t, ts)
+	for i, command := range []string{"echo one", "exit 3", "rm -rf /"} {
+		callTool(t, ts, sessionID, i+2, "run", fmt.Sprintf(`{"commands":[%q]}`, command))
+	}
+
+	if status, _ := query(t, ts, "", ""); status != http.StatusUnauthorized {
+		t.Errorf("query without token: status = %d, want 401", status)
+	}
+	if status, _ := query(t, ts, "secret-admin", "?status=unknown"); status != http.StatusBadRequest {
+		t.Errorf("query with invalid status: status = %d, want 400", status)
+	}
+	if status, _ := query(t, ts, "secret-admin", "?since=yesterday"); status != http.StatusBadRequest {
+		t.Errorf("query with invalid since: status = %d, want 400", status)
+	}
+
+	status, records := query(t, ts, "secret-admin", "")
+	if status != http.StatusOK || len(records) != 3 {
+		t.Fatalf("query: status = %d, records = %+v, want 3 records", status, records)
+	}
+	want := []struct {
+		command string
+		status  history.Status
+	}{{"rm -rf /", history.StatusError}, {"exit 3", history.StatusFailed}, {"echo one", history.StatusSucceeded}}
+	for i, w := range want {
+		if records[i].Command != w.command || records[i].Status != w.status || records[i].Client != sessionID {
+			t.Errorf("record %d = %+v, want command %q with status %s of client %s", i, records[i], w.command, w.status, sessionID)
+		}
+	}
+	if records[2].StdoutBytes != 4 {
+		t.Errorf("stdoutBytes = %d, want 4", records[2].StdoutBytes)
+	}
+
+	if _, records := query(t, ts, "secret-admin", "?status=failed"); len(records) != 1 || records[0].ExitCode != 3 {
+		t.Errorf("query by status = %+v, want the exit 3 run", records)
+	}
+	if _, records := query(t, ts, "secret-admin", "?command=echo&client="+sessionID); len(records) != 1 {
+		t.Errorf("query by command = %+v, want the echo run", records)
+	}
+	if _, records := query(t, ts, "secret-admin", "?client=someone-else"); len(records) != 0 {
+		t.Errorf("query by other client = %+v, want none", records)
+	}
+	if _, records := query(t, ts, "secret-admin", "?limit=1"); len(records) != 1 {
+		t.Errorf("query with limit 1 returned %d records", len(records))
+	}
+
+	// The history outlives the server
+	ts.Close()
+	restarted := newHistoryServer(t)
+	if _, records := query(t, restarted, "secret-admin", ""); len(records) != 3 {
+		t.Errorf("after restart: %d records, want 3", len(records))
+	}
+}
+
+func TestQueryHistory(t *testing.T) {
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{t.TempDir()},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}, {Command: "exit"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    10,
+		History:             &config.HistoryConfig{Path: filepath.Join(t.TempDir(), "history.db")},
+	}
+	srv, err := service.NewServer(cfg, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+
+	sessionID := initializeSession(t, ts)
+	other := initializeSession(t, ts)
+	for i, command := range []string{"echo one", "exit 3", "echo two"} {
+		callTool(t, ts, sessionID, i+2, "run", fmt.Sprintf(`{"commands":[%q]}`, command))
+	}
+	callTool(t, ts, other, 2, "run", `{"commands":["echo other"]}`)
+
+	queryHistory := func(arguments string) []history.Record {
+		t.Helper()
+		text, isError, meta := callTool(t, ts, sessionID, 10, "query_history", arguments)
+		if isError {
+			t.Fatalf("query_history(%s): unexpected error: %s", arguments, text)
+		}
+		var records []history.Record
+		if err := json.Unmarshal([]byte(text), &records); err != nil {
+			t.Fatalf("query_history(%s) returned invalid JSON %q: %v", arguments, text, err)
+		}
+		if meta["executions"] != float64(len(records)) {
+			t.Errorf("query_history(%s) metadata = %v, want %d executions", arguments, meta, len(records))
+		}
+		return records
+	}
+	commands := func(records []history.Record) []string {
+		list := []string{}
+		for _, record := range records {
+			list = append(list, record.Command)
+		}
+		return list
+	}
+
+	// Clients only see their own executions
+	if got := commands(queryHistory(`{}`)); !slices.Equal(got, []string{"echo two", "exit 3", "echo one"}) {
+		t.Errorf("query_history() = %v", got)
+	}
+	if got := commands(queryHistory(`{"command":"echo"}`)); !slices.Equal(got, []string{"echo two", "echo one"}) {
+		t.Errorf("query_history(command echo) = %v", got)
+	}
+	if got := queryHistory(`{"status":"failed"}`); len(got) != 1 || got[0].ExitCode != 3 {
+		t.Errorf("query_history(status failed) = %+v, want the exit 3 run", got)
+	}
+	if got := commands(queryHistory(`{"since":"1h","limit":1}`)); !slices.Equal(got, []string{"echo two"}) {
+		t.Errorf("query_history(since 1h, limit 1) = %v", got)
+	}
+	if got := queryHistory(`{"until":"1h"}`); len(got) != 0 {
+		t.Errorf("query_history(until 1h) = %+v, want none", got)
+	}
+
+	for _, arguments := range []string{`{"status":"done"}`, `{"since":"yesterday"}`, `{"limit":-1}`} {
+		if text, isError, _ := callTool(t, ts, sessionID, 11, "query_history", arguments); !isError {
+			t.Errorf("query_history(%s) = %q, want an error", arguments, text)
+		}
+	}
+}
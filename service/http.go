@@ -0,0 +1,516 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/runner"
+)
+
+const (
+	// sessionIDHeader is the HTTP header carrying the MCP session ID.
+	sessionIDHeader = "Mcp-Session-Id"
+	// maxMessageSize is the largest request body accepted, in bytes.
+	maxMessageSize = 4 * 1024 * 1024
+	// notificationBufferSize is the number of notifications queued for a stream.
+	notificationBufferSize = 100
+)
+
+// httpSession is an MCP session of the Streamable HTTP transport. It lives from the
+// initialize request until the client deletes it or the server stops.
+type httpSession struct {
+	id string
+	// client is the name of the authenticated client that started the session, if any
+	client string
+	// notifications not related to a request, sent on the stream opened with GET
+	notifications chan mcp.JSONRPCNotification
+	initialized   atomic.Bool
+	// closed is closed when the session is deleted, ending its GET streams
+	closed chan struct{}
+	requestTracker
+}
+
+var _ server.ClientSession = (*httpSession)(nil)
+
+// SessionID implements the server.ClientSession interface.
+func (s *httpSession) SessionID() string { return s.id }
+
+// NotificationChannel implements the server.ClientSession interface.
+func (s *httpSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return s.notifications }
+
+// Initialize implements the server.ClientSession interface.
+func (s *httpSession) Initialize() { s.initialized.Store(true) }
+
+// Initialized implements the server.ClientSession interface.
+func (s *httpSession) Initialized() bool { return s.initialized.Load() }
+
+// requestTracker tracks the requests of a session being handled, so that a
+// notifications/cancelled message can cancel them.
+type requestTracker struct {
+	mu sync.Mutex
+	// requests holds the cancel functions of the requests being handled, by JSON-RPC ID
+	requests map[string]context.CancelCauseFunc
+}
+
+// track prepares the handling of message: a request gets a context that is canceled with
+// runner.ErrCanceled when the client cancels it, and a notifications/cancelled message
+// cancels the request it names. It returns the context to handle message in, a function to
+// call once it is handled, and the ID of the request canceled by message, if any.
+func (t *requestTracker) track(ctx context.Context, message json.RawMessage, header messageHeader) (context.Context, func(), json.RawMessage) {
+	switch {
+	case header.isRequest():
+		ctx, done := t.startRequest(ctx, header.ID)
+		return ctx, done, nil
+	case header.Method == "notifications/cancelled":
+		var notification struct {
+			Params struct {
+				RequestID json.RawMessage `json:"requestId"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(message, &notification); err == nil && len(notification.Params.RequestID) > 0 {
+			if t.cancelRequest(notification.Params.RequestID) {
+				return ctx, func() {}, notification.Params.RequestID
+			}
+		}
+	}
+	return ctx, func() {}, nil
+}
+
+// startRequest registers the request with the given JSON-RPC ID as being handled and
+// returns its context, which is canceled with runner.ErrCanceled when the client cancels
+// the request, and a function that unregisters it.
+func (t *requestTracker) startRequest(ctx context.Context, id json.RawMessage) (context.Context, func()) {
+	key := requestKey(id)
+	ctx, cancel := context.WithCancelCause(ctx)
+	t.mu.Lock()
+	if t.requests == nil {
+		t.requests = make(map[string]context.CancelCauseFunc)
+	}
+	t.requests[key] = cancel
+	t.mu.Unlock()
+	return ctx, func() {
+		t.mu.Lock()
+		delete(t.requests, key)
+		t.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// cancelRequest cancels the request with the given JSON-RPC ID. It reports whether the
+// request was being handled.
+func (t *requestTracker) cancelRequest(id json.RawMessage) bool {
+	t.mu.Lock()
+	cancel, ok := t.requests[requestKey(id)]
+	t.mu.Unlock()
+	if ok {
+		cancel(runner.ErrCanceled)
+	}
+	return ok
+}
+
+// cancelRequests cancels every request being handled.
+func (t *requestTracker) cancelRequests() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, cancel := range t.requests {
+		cancel(runner.ErrCanceled)
+	}
+}
+
+// requestKey returns the key of a JSON-RPC ID in requestTracker.requests, the same for IDs
+// that differ only in whitespace.
+func requestKey(id json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, id); err != nil {
+		return string(id)
+	}
+	return buf.String()
+}
+
+// requestSession is the session a POST request is handled in. Notifications sent while
+// handling it, such as streamed command output, go to the response of that request.
+type requestSession struct {
+	*httpSession
+	notifications chan mcp.JSONRPCNotification
+}
+
+// NotificationChannel implements the server.ClientSession interface.
+func (s *requestSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+// streamableHTTP serves an MCP server over the Streamable HTTP transport: clients POST
+// JSON-RPC messages to a single endpoint and receive the responses as JSON or as a stream
+// of server-sent events, which also carries the notifications sent while handling them.
+// A GET request opens a stream for notifications not related to a request, and DELETE
+// ends the session.
+type streamableHTTP struct {
+	mcpServer *server.MCPServer
+	logger    *logger.Logger
+	// onSessionEnd, if set, is called with the ID of each session ended by the client
+	onSessionEnd func(id string)
+	// onResponse, if set, may replace the response to each request, given its method
+	onResponse func(ctx context.Context, method string, response mcp.JSONRPCMessage) mcp.JSONRPCMessage
+
+	mu       sync.Mutex
+	sessions map[string]*httpSession
+}
+
+// newStreamableHTTP creates a Streamable HTTP handler for mcpServer.
+func newStreamableHTTP(mcpServer *server.MCPServer, logger *logger.Logger) *streamableHTTP {
+	return &streamableHTTP{mcpServer: mcpServer, logger: logger, sessions: make(map[string]*httpSession)}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *streamableHTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Browsers send an Origin header; rejecting foreign origins prevents DNS rebinding
+	// attacks on a server listening on localhost
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		h.handlePost(w, r)
+	case http.MethodGet:
+		h.handleGet(w, r)
+	case http.MethodDelete:
+		h.handleDelete(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// messageHeader holds the fields that tell JSON-RPC requests, notifications and responses apart.
+type messageHeader struct {
+	Method string          `json:"method"`
+	ID     json.RawMessage `json:"id"`
+}
+
+// isRequest reports whether the message expects a response.
+func (m messageHeader) isRequest() bool {
+	return m.Method != "" && len(m.ID) > 0 && string(m.ID) != "null"
+}
+
+// parseMessages splits a POST body into its JSON-RPC messages. batch reports whether the
+// body is a JSON array, whose responses are returned as an array as well.
+func parseMessages(body []byte) (messages []json.RawMessage, headers []messageHeader, batch bool, err error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		batch = true
+		if err := json.Unmarshal(body, &messages); err != nil {
+			return nil, nil, false, err
+		}
+		if len(messages) == 0 {
+			return nil, nil, false, errors.New("empty batch")
+		}
+	} else {
+		messages = []json.RawMessage{body}
+	}
+
+	headers = make([]messageHeader, len(messages))
+	for i, message := range messages {
+		if err := json.Unmarshal(message, &headers[i]); err != nil {
+			return nil, nil, false, err
+		}
+	}
+	return messages, headers, batch, nil
+}
+
+// handlePost handles the JSON-RPC messages posted by a client.
+func (h *streamableHTTP) handlePost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageSize))
+	if err != nil {
+		h.writeJSONRPCError(w, http.StatusRequestEntityTooLarge, mcp.INVALID_REQUEST, "request body too large")
+		return
+	}
+	messages, headers, batch, err := parseMessages(body)
+	if err != nil {
+		h.writeJSONRPCError(w, http.StatusBadRequest, mcp.PARSE_ERROR, fmt.Sprintf("parse error: %v", err))
+		return
+	}
+
+	// An initialize request starts a new session; every other message must name its session
+	var session *httpSession
+	if headers[0].Method == string(mcp.MethodInitialize) {
+		if batch {
+			h.writeJSONRPCError(w, http.StatusBadRequest, mcp.INVALID_REQUEST, "initialize must not be part of a batch")
+			return
+		}
+		if session, err = h.newSession(r.Context()); err != nil {
+			h.logger.LogErrorf("Failed to create HTTP session: %v", err)
+			http.Error(w, "failed to create session", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		var status int
+		if session, status = h.session(r); session == nil {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+	}
+	w.Header().Set(sessionIDHeader, session.id)
+
+	// Notifications and responses from the client are only acknowledged
+	hasRequests := false
+	for _, header := range headers {
+		hasRequests = hasRequests || header.isRequest()
+	}
+	if !hasRequests {
+		h.handleMessages(h.mcpServer.WithContext(r.Context(), session), session, messages, headers)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	reqSession := &requestSession{httpSession: session, notifications: make(chan mcp.JSONRPCNotification, notificationBufferSize)}
+	ctx := h.mcpServer.WithContext(r.Context(), reqSession)
+	if accepts(r, "text/event-stream") {
+		h.streamResponses(ctx, w, reqSession, messages, headers)
+		return
+	}
+
+	// Without a stream, notifications sent while handling the messages are dropped
+	go func() {
+		for range reqSession.notifications {
+			// Drop the notification
+		}
+	}()
+	responses := h.handleMessages(ctx, session, messages, headers)
+	close(reqSession.notifications)
+
+	w.Header().Set("Content-Type", "application/json")
+	if batch {
+		h.writeJSON(w, responses)
+	} else {
+		h.writeJSON(w, responses[0])
+	}
+}
+
+// handleMessages handles messages in order and returns the responses to its requests.
+// Requests can be canceled with a notifications/cancelled message while they are handled.
+func (h *streamableHTTP) handleMessages(ctx context.Context, session *httpSession, messages []json.RawMessage, headers []messageHeader) []mcp.JSONRPCMessage {
+	var responses []mcp.JSONRPCMessage
+	for i, message := range messages {
+		if response := h.handleMessage(ctx, session, message, headers[i]); response != nil {
+			responses = append(responses, response)
+		}
+	}
+	return responses
+}
+
+// handleMessage handles a single message of session.
+func (h *streamableHTTP) handleMessage(ctx context.Context, session *httpSession, message json.RawMessage, header messageHeader) mcp.JSONRPCMessage {
+	ctx, done, canceled := session.track(ctx, message, header)
+	defer done()
+	if canceled != nil {
+		h.logger.LogInfof("HTTP session %s: request %s canceled by the client", session.id, canceled)
+	}
+	response := h.mcpServer.HandleMessage(ctx, message)
+	if response != nil && h.onResponse != nil {
+		response = h.onResponse(ctx, header.Method, response)
+	}
+	return response
+}
+
+// streamResponses handles messages and sends the notifications sent meanwhile and then the
+// responses as server-sent events. The stream ends after the last response.
+func (h *streamableHTTP) streamResponses(ctx context.Context, w http.ResponseWriter, session *requestSession, messages []json.RawMessage, headers []messageHeader) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	done := make(chan []mcp.JSONRPCMessage, 1)
+	go func() {
+		done <- h.handleMessages(ctx, session.httpSession, messages, headers)
+	}()
+
+	for {
+		select {
+		case notification := <-session.notifications:
+			h.writeEvent(w, notification)
+			flusher.Flush()
+		case responses := <-done:
+			// Send the notifications queued before the handlers returned first
+			for len(session.notifications) > 0 {
+				h.writeEvent(w, <-session.notifications)
+			}
+			for _, response := range responses {
+				h.writeEvent(w, response)
+			}
+			flusher.Flush()
+			return
+		case <-ctx.Done():
+			// The client went away; the handlers see the canceled context and stop
+			return
+		}
+	}
+}
+
+// handleGet opens a stream of the notifications of a session that are not related to a request.
+func (h *streamableHTTP) handleGet(w http.ResponseWriter, r *http.Request) {
+	if !accepts(r, "text/event-stream") {
+		http.Error(w, "GET requires Accept: text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+	session, status := h.session(r)
+	if session == nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set(sessionIDHeader, session.id)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case notification := <-session.notifications:
+			h.writeEvent(w, notification)
+			flusher.Flush()
+		case <-session.closed:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handleDelete ends a session.
+func (h *streamableHTTP) handleDelete(w http.ResponseWriter, r *http.Request) {
+	session, status := h.session(r)
+	if session == nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	// Another request may have deleted the session meanwhile
+	h.mu.Lock()
+	_, ok := h.sessions[session.id]
+	delete(h.sessions, session.id)
+	h.mu.Unlock()
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	h.mcpServer.UnregisterSession(session.id)
+	session.cancelRequests()
+	if h.onSessionEnd != nil {
+		h.onSessionEnd(session.id)
+	}
+	close(session.closed)
+	h.logger.LogInfof("HTTP session %s ended", session.id)
+	w.WriteHeader(http.StatusOK)
+}
+
+// newSession creates and registers a session.
+func (h *streamableHTTP) newSession(ctx context.Context) (*httpSession, error) {
+	session := &httpSession{
+		id:            rand.Text(),
+		client:        clientName(ctx),
+		notifications: make(chan mcp.JSONRPCNotification, notificationBufferSize),
+		closed:        make(chan struct{}),
+	}
+	if err := h.mcpServer.RegisterSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	h.sessions[session.id] = session
+	h.mu.Unlock()
+	h.logger.LogInfof("HTTP session %s started", session.id)
+	return session, nil
+}
+
+// session returns the session named by the request's Mcp-Session-Id header. When there
+// is none it returns the HTTP status to respond with: 400 without a header and 404 for
+// unknown or ended sessions, which tells the client to initialize a new session. Sessions
+// started by another authenticated client are unknown to the request.
+func (h *streamableHTTP) session(r *http.Request) (*httpSession, int) {
+	id := r.Header.Get(sessionIDHeader)
+	if id == "" {
+		return nil, http.StatusBadRequest
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if session, ok := h.sessions[id]; ok && session.client == clientName(r.Context()) {
+		return session, 0
+	}
+	return nil, http.StatusNotFound
+}
+
+// accepts reports whether the request's Accept header lists mediaType.
+func accepts(r *http.Request, mediaType string) bool {
+	for _, value := range r.Header.Values("Accept") {
+		for part := range strings.SplitSeq(value, ",") {
+			if name, _, _ := strings.Cut(part, ";"); strings.TrimSpace(name) == mediaType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeEvent writes a JSON-RPC message as a server-sent event.
+func (h *streamableHTTP) writeEvent(w io.Writer, message any) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		h.logger.LogErrorf("Failed to encode event: %v", err)
+		return
+	}
+	if _, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", data); err != nil {
+		h.logger.LogErrorf("Failed to write event: %v", err)
+	}
+}
+
+// writeJSON writes v as the JSON body of a response.
+func (h *streamableHTTP) writeJSON(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		h.logger.LogErrorf("Failed to encode response: %v", err)
+		return
+	}
+	if _, err := w.Write(data); err != nil {
+		h.logger.LogErrorf("Failed to write response: %v", err)
+	}
+}
+
+// writeJSONRPCError writes a JSON-RPC error without an ID with the given HTTP status.
+func (h *streamableHTTP) writeJSONRPCError(w http.ResponseWriter, status int, code int, message string) {
+	response := mcp.JSONRPCError{JSONRPC: mcp.JSONRPC_VERSION}
+	response.Error.Code = code
+	response.Error.Message = message
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	h.writeJSON(w, response)
+}
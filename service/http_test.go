@@ -0,0 +1,590 @@
+package service_test
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/service"
+)
+
+// postMessage posts a JSON-RPC message to the MCP endpoint of ts.
+func postMessage(t *testing.T, ts *httptest.Server, sessionID, accept, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, ts.URL+service.HTTPPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
+	if sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", sessionID)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// initializeSession starts a session on ts and returns its ID.
+func initializeSession(t *testing.T, ts *httptest.Server) string {
+	t.Helper()
+	resp := postMessage(t, ts, "", "application/json, text/event-stream", `{"jsonrpc":"2.0","id":1,"method":"initialize",`+
+		`"params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1.0"}}}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("initialize status = %d, want 200", resp.StatusCode)
+	}
+	sessionID := resp.Header.Get("Mcp-Session-Id")
+	if sessionID == "" {
+		t.Fatal("initialize response has no Mcp-Session-Id header")
+	}
+
+	resp = postMessage(t, ts, sessionID, "application/json, text/event-stream", `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("notifications/initialized status = %d, want 202", resp.StatusCode)
+	}
+	return sessionID
+}
+
+func TestStreamableHTTP(t *testing.T) {
+	srv, _ := newTestServer(t)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	sessionID := initializeSession(t, ts)
+
+	t.Run("JSON response", func(t *testing.T) {
+		resp := postMessage(t, ts, sessionID, "application/json",
+			`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"run","arguments":{"commands":["echo hello"]}}}`)
+		if got := resp.Header.Get("Content-Type"); got != "application/json" {
+			t.Fatalf("Content-Type = %q, want application/json", got)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		var response struct {
+			ID     int `json:"id"`
+			Result struct {
+				Content []struct {
+					Text string `json:"text"`
+				} `json:"content"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			t.Fatalf("Invalid response %s: %v", body, err)
+		}
+		if response.ID != 2 || len(response.Result.Content) == 0 || !strings.Contains(response.Result.Content[0].Text, "hello") {
+			t.Errorf("Unexpected response: %s", body)
+		}
+	})
+
+	t.Run("event stream with notifications", func(t *testing.T) {
+		resp := postMessage(t, ts, sessionID, "application/json, text/event-stream",
+			`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"run","arguments":{"commands":["echo streamed"],"stream":true}}}`)
+		if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+			t.Fatalf("Content-Type = %q, want text/event-stream", got)
+		}
+
+		var events []string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				events = append(events, data)
+			}
+		}
+		if len(events) < 2 {
+			t.Fatalf("Expected a notification and a response, got: %v", events)
+		}
+		if !strings.Contains(events[0], "notifications/message") || !strings.Contains(events[0], "streamed") {
+			t.Errorf("First event is not the output notification: %s", events[0])
+		}
+		if last := events[len(events)-1]; !strings.Contains(last, `"id":3`) || !strings.Contains(last, "result") {
+			t.Errorf("Last event is not the response: %s", last)
+		}
+	})
+
+	t.Run("tools are annotated", func(t *testing.T) {
+		resp := postMessage(t, ts, sessionID, "application/json", `{"jsonrpc":"2.0","id":8,"method":"tools/list"}`)
+		body, _ := io.ReadAll(resp.Body)
+		if !strings.Contains(string(body), `"annotations":{"readOnlyHint":true,"destructiveHint":false,"idempotentHint":true,"openWorldHint":false}`) {
+			t.Errorf("tools/list response has no read-only annotations: %s", body)
+		}
+	})
+
+	t.Run("session required", func(t *testing.T) {
+		resp := postMessage(t, ts, "", "application/json", `{"jsonrpc":"2.0","id":4,"method":"tools/list"}`)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("status without session = %d, want 400", resp.StatusCode)
+		}
+		resp = postMessage(t, ts, "unknown", "application/json", `{"jsonrpc":"2.0","id":5,"method":"tools/list"}`)
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("status with unknown session = %d, want 404", resp.StatusCode)
+		}
+	})
+
+	t.Run("foreign origin rejected", func(t *testing.T) {
+		req, _ := http.NewRequestWithContext(t.Context(), http.MethodPost, ts.URL+service.HTTPPath,
+			strings.NewReader(`{"jsonrpc":"2.0","id":6,"method":"tools/list"}`))
+		req.Header.Set("Mcp-Session-Id", sessionID)
+		req.Header.Set("Origin", "http://evil.example.com")
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("status with foreign origin = %d, want 403", resp.StatusCode)
+		}
+	})
+
+	t.Run("delete ends the session", func(t *testing.T) {
+		req, _ := http.NewRequestWithContext(t.Context(), http.MethodDelete, ts.URL+service.HTTPPath, nil)
+		req.Header.Set("Mcp-Session-Id", sessionID)
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("DELETE status = %d, want 200", resp.StatusCode)
+		}
+
+		resp = postMessage(t, ts, sessionID, "application/json", `{"jsonrpc":"2.0","id":7,"method":"tools/list"}`)
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("status after DELETE = %d, want 404", resp.StatusCode)
+		}
+	})
+}
+
+// writeCert creates a certificate for name signed by parent (self-signed when parent is nil)
+// and writes it and its key as PEM files to dir.
+func writeCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return cert, key, certFile, keyFile
+}
+
+func TestHTTPServerTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, caFile, _ := writeCert(t, dir, "ca", nil, nil)
+	_, _, certFile, keyFile := writeCert(t, dir, "server", ca, caKey)
+	_, _, clientCert, clientKey := writeCert(t, dir, "client", ca, caKey)
+
+	cfg := config.NewDefaultConfig()
+	cfg.TLS = &config.TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}
+	srv, err := service.NewServer(cfg, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	httpServer, err := srv.HTTPServer()
+	if err != nil {
+		t.Fatalf("HTTPServer() error: %v", err)
+	}
+
+	ts := httptest.NewUnstartedServer(httpServer.Handler)
+	ts.TLS = httpServer.TLSConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	post := func(certs []tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs, MinVersion: tls.VersionTLS12},
+		}}
+		req, _ := http.NewRequestWithContext(t.Context(), http.MethodPost, ts.URL+service.HTTPPath,
+			strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+		return client.Do(req)
+	}
+
+	if resp, err := post(nil); err == nil {
+		resp.Body.Close()
+		t.Error("Request without a client certificate succeeded")
+	}
+
+	pair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("Failed to load client certificate: %v", err)
+	}
+	resp, err := post([]tls.Certificate{pair})
+	if err != nil {
+		t.Fatalf("Request with a client certificate failed: %v", err)
+	}
+	resp.Body.Close()
+	// The request reached the MCP endpoint, which requires a session
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", resp.StatusCode)
+	}
+
+	t.Run("missing key", func(t *testing.T) {
+		cfg := config.NewDefaultConfig()
+		cfg.TLS = &config.TLSConfig{CertFile: certFile}
+		srv, err := service.NewServer(cfg, 0, "")
+		if err != nil {
+			t.Fatalf("Failed to create server: %v", err)
+		}
+		if _, err := srv.HTTPServer(); err == nil {
+			t.Error("HTTPServer() without a key file succeeded")
+		}
+	})
+}
+
+func TestHTTPAuthTokens(t *testing.T) {
+	dir := t.TempDir()
+	blockLog := filepath.Join(t.TempDir(), "blocked.log")
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{dir},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}},
+		DefaultErrorMessage: "Command not allowed",
+		BlockLogPath:        blockLog,
+		AuthTokens:          []config.AuthToken{{Token: "secret-ci", Client: "ci"}, {Token: "secret-dev"}},
+	}
+	srv, err := service.NewServer(cfg, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	post := func(header, value, sessionID, body string) *http.Response {
+		req, _ := http.NewRequestWithContext(t.Context(), http.MethodPost, ts.URL+service.HTTPPath, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		if sessionID != "" {
+			req.Header.Set("Mcp-Session-Id", sessionID)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	const initialize = `{"jsonrpc":"2.0","id":1,"method":"initialize",` +
+		`"params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1.0"}}}`
+
+	for _, tt := range []struct{ name, header, value string }{
+		{"no token", "", ""},
+		{"wrong token", "Authorization", "Bearer wrong"},
+		{"empty bearer", "Authorization", "Bearer "},
+	} {
+		if resp := post(tt.header, tt.value, "", initialize); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want 401", tt.name, resp.StatusCode)
+		}
+	}
+
+	if resp := post("X-API-Key", "secret-dev", "", initialize); resp.StatusCode != http.StatusOK {
+		t.Errorf("API key: status = %d, want 200", resp.StatusCode)
+	}
+
+	resp := post("Authorization", "Bearer secret-ci", "", initialize)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("bearer token: status = %d, want 200", resp.StatusCode)
+	}
+	sessionID := resp.Header.Get("Mcp-Session-Id")
+	post("Authorization", "Bearer secret-ci", sessionID, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+	// Another client cannot use the session
+	if resp := post("X-API-Key", "secret-dev", sessionID, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("session of another client: status = %d, want 404", resp.StatusCode)
+	}
+
+	// Blocked commands are logged with the token's client name
+	post("Authorization", "Bearer secret-ci", sessionID,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"run","arguments":{"commands":["rm x"]}}}`)
+	data, err := os.ReadFile(blockLog)
+	if err != nil {
+		t.Fatalf("Failed to read block log: %v", err)
+	}
+	if !strings.Contains(string(data), `"client":"ci"`) {
+		t.Errorf("Block log does not name the client: %s", data)
+	}
+}
+
+func TestHTTPClientProfiles(t *testing.T) {
+	dir := t.TempDir()
+	ciDir := filepath.Join(dir, "ci")
+	if err := os.Mkdir(ciDir, 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{dir},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}},
+		DefaultErrorMessage: "Command not allowed",
+		AuthTokens:          []config.AuthToken{{Token: "secret-ci", Client: "ci"}, {Token: "secret-chat", Client: "chat"}},
+		Profiles: map[string]*config.ShellCommandConfig{
+			"build": {
+				AllowedDirectories:  []string{ciDir},
+				AllowCommands:       []config.AllowCommand{{Command: "echo"}, {Command: "pwd"}},
+				DefaultErrorMessage: "Command not allowed",
+			},
+		},
+		ClientProfiles: map[string]string{"ci": "build"},
+	}
+	srv, err := service.NewServer(cfg, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	// run calls pwd with the token of client and returns the tool result
+	run := func(token string) (string, bool) {
+		post := func(sessionID, body string) *http.Response {
+			req, _ := http.NewRequestWithContext(t.Context(), http.MethodPost, ts.URL+service.HTTPPath, strings.NewReader(body))
+			req.Header.Set("Accept", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			if sessionID != "" {
+				req.Header.Set("Mcp-Session-Id", sessionID)
+			}
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			t.Cleanup(func() { resp.Body.Close() })
+			return resp
+		}
+		resp := post("", `{"jsonrpc":"2.0","id":1,"method":"initialize",`+
+			`"params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1.0"}}}`)
+		sessionID := resp.Header.Get("Mcp-Session-Id")
+		post(sessionID, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+		resp = post(sessionID, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"run","arguments":{"commands":["pwd"]}}}`)
+		var msg struct {
+			Result struct {
+				Content []struct {
+					Text string `json:"text"`
+				} `json:"content"`
+				IsError bool `json:"isError"`
+			} `json:"result"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil || len(msg.Result.Content) == 0 {
+			t.Fatalf("Failed to decode tool result: %v", err)
+		}
+		return msg.Result.Content[0].Text, msg.Result.IsError
+	}
+
+	// The profile allows pwd and runs in its own directory
+	if text, isError := run("secret-ci"); isError || strings.TrimSpace(text) != ciDir {
+		t.Errorf("ci: pwd = %q (error %v), want %q", text, isError, ciDir)
+	}
+	// Other clients get the top-level policy, which does not allow pwd
+	if text, isError := run("secret-chat"); !isError || !strings.Contains(text, "not allowed") {
+		t.Errorf("chat: pwd = %q (error %v), want it to be blocked", text, isError)
+	}
+
+	// Clients cannot be mapped to a profile that does not exist
+	cfg.ClientProfiles = map[string]string{"ci": "missing"}
+	if _, err := service.NewServer(cfg, 0, ""); err == nil {
+		t.Error("NewServer succeeded with an unknown profile, want an error")
+	}
+}
+
+func TestHTTPSessionWorkingDirectory(t *testing.T) {
+	srv, tmpDir := newTestServer(t)
+	subDir := filepath.Join(tmpDir, "sub")
+	if err := os.Mkdir(subDir, 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	// call calls a tool in the session and returns the text of its result
+	call := func(sessionID, tool, arguments string) string {
+		resp := postMessage(t, ts, sessionID, "application/json",
+			`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"`+tool+`","arguments":`+arguments+`}}`)
+		var msg struct {
+			Result struct {
+				Content []struct {
+					Text string `json:"text"`
+				} `json:"content"`
+			} `json:"result"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil || len(msg.Result.Content) == 0 {
+			t.Fatalf("Failed to decode tool result: %v", err)
+		}
+		return msg.Result.Content[0].Text
+	}
+
+	first := initializeSession(t, ts)
+	second := initializeSession(t, ts)
+	call(first, "set_working_directory", `{"directory":"sub"}`)
+	if got := call(first, "run", `{"commands":["pwd"]}`); !strings.Contains(got, subDir) {
+		t.Errorf("first session: pwd = %q, want %s", got, subDir)
+	}
+
+	// cd in one session does not move the other
+	call(second, "run", `{"commands":["cd sub", "cd .."],"mode":"serial"}`)
+	if got := call(first, "run", `{"commands":["pwd"]}`); !strings.Contains(got, subDir) {
+		t.Errorf("first session after cd in second: pwd = %q, want %s", got, subDir)
+	}
+	if got := call(second, "run", `{"commands":["pwd"]}`); strings.Contains(got, subDir) {
+		t.Errorf("second session: pwd = %q, want %s", got, tmpDir)
+	}
+}
+
+func TestHTTPProgress(t *testing.T) {
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{t.TempDir()},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}, {Command: "sleep"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    10,
+	}
+	srv, err := service.NewServer(cfg, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	sessionID := initializeSession(t, ts)
+
+	resp := postMessage(t, ts, sessionID, "application/json, text/event-stream",
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"run",`+
+			`"arguments":{"commands":["echo building; sleep 1.5"]},"_meta":{"progressToken":"build-1"}}}`)
+	var events []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			events = append(events, data)
+		}
+	}
+	if len(events) < 2 {
+		t.Fatalf("Expected a progress notification and a response, got: %v", events)
+	}
+	var notification struct {
+		Method string `json:"method"`
+		Params struct {
+			ProgressToken string  `json:"progressToken"`
+			Progress      float64 `json:"progress"`
+			Message       string  `json:"message"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal([]byte(events[0]), &notification); err != nil {
+		t.Fatalf("Invalid notification %s: %v", events[0], err)
+	}
+	if notification.Method != "notifications/progress" || notification.Params.ProgressToken != "build-1" || notification.Params.Progress <= 0 {
+		t.Errorf("First event is not a progress notification: %s", events[0])
+	}
+	if !strings.Contains(notification.Params.Message, "9 bytes of output, last line: building") {
+		t.Errorf("Progress message = %q, want output size and last line", notification.Params.Message)
+	}
+	if last := events[len(events)-1]; !strings.Contains(last, `"id":2`) || !strings.Contains(last, "result") {
+		t.Errorf("Last event is not the response: %s", last)
+	}
+}
+
+func TestHTTPCancellation(t *testing.T) {
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{t.TempDir()},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}, {Command: "sleep"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+	}
+	srv, err := service.NewServer(cfg, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	sessionID := initializeSession(t, ts)
+
+	start := time.Now()
+	resp := postMessage(t, ts, sessionID, "application/json, text/event-stream",
+		`{"jsonrpc":"2.0","id":"call-1","method":"tools/call","params":{"name":"run",`+
+			`"arguments":{"commands":["echo started; sleep 20"],"stream":true}}}`)
+	scanner := bufio.NewScanner(resp.Body)
+	var last string
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if strings.Contains(data, "notifications/message") {
+			// The command is running; cancel the call
+			resp := postMessage(t, ts, sessionID, "application/json",
+				`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":"call-1","reason":"user"}}`)
+			if resp.StatusCode != http.StatusAccepted {
+				t.Fatalf("notifications/cancelled status = %d, want 202", resp.StatusCode)
+			}
+		}
+		last = data
+	}
+
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("canceled call took %v, want the command to be killed", elapsed)
+	}
+	var response struct {
+		Result struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+			IsError bool           `json:"isError"`
+			Meta    map[string]any `json:"_meta"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(last), &response); err != nil || len(response.Result.Content) == 0 {
+		t.Fatalf("Last event is not the response: %s", last)
+	}
+	if text := response.Result.Content[0].Text; !strings.Contains(text, "run canceled") || !strings.Contains(text, "started") {
+		t.Errorf("Result = %q, want the partial output marked as canceled", text)
+	}
+	if !response.Result.IsError || response.Result.Meta["canceled"] != true {
+		t.Errorf("Result isError = %v, _meta = %v, want a canceled error", response.Result.IsError, response.Result.Meta)
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/version"
+)
+
+// Name identifies the server to clients, with the version of its build, in the initialize
+// response and in server_info.
+const Name = "Secure Shell Server"
+
+// createServerInfoTool creates the server_info tool for discovering the server's state.
+func createServerInfoTool() mcp.Tool {
+	return mcp.NewTool("server_info",
+		mcp.WithDescription("Show the server's version, the calling client's policy profile, limits, "+
+			"isolation and transport as JSON, to adapt to the server and to include in bug reports."),
+	)
+}
+
+// serverInfo is the result of server_info.
+type serverInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Commit and BuildDate identify the build of the server, when known
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+	// Client is the authenticated name of the calling client, "" when unauthenticated
+	Client string `json:"client,omitempty"`
+	// Profile is the name of the client's policy profile, "" for the top-level policy
+	Profile string `json:"profile,omitempty"`
+	// Transport is the transport of the call: "stdio", "http", "websocket", "rest" or "grpc"
+	Transport string        `json:"transport"`
+	Limits    policyLimits  `json:"limits"`
+	Isolation isolationInfo `json:"isolation"`
+	// Network reports whether commands may reach the network
+	Network bool `json:"network"`
+	// History and Approvals report whether query_history is served and whether any commands
+	// are queued for approval
+	History   bool `json:"history"`
+	Approvals bool `json:"approvals"`
+}
+
+// isolationInfo is how the external commands of a policy are isolated from the host.
+type isolationInfo struct {
+	// Sandbox runs commands in their own namespaces (Linux only)
+	Sandbox bool `json:"sandbox"`
+	// Container is the runtime running commands in containers, "" without containers
+	Container      string `json:"container,omitempty"`
+	ContainerImage string `json:"containerImage,omitempty"`
+	Cgroup         bool   `json:"cgroup"`
+	Seccomp        bool   `json:"seccomp"`
+	ResourceLimits bool   `json:"resourceLimits"`
+}
+
+// newIsolationInfo returns the isolation of cfg.
+func newIsolationInfo(cfg *config.ShellCommandConfig) isolationInfo {
+	info := isolationInfo{
+		Sandbox:        cfg.Sandbox != nil,
+		Cgroup:         cfg.Cgroup != nil,
+		Seccomp:        cfg.Seccomp != nil,
+		ResourceLimits: cfg.ResourceLimits != nil,
+	}
+	if cfg.Container != nil {
+		info.Container = cfg.Container.GetRuntime()
+		info.ContainerImage = cfg.Container.Image
+	}
+	return info
+}
+
+// transportName returns the name of the transport of the session of ctx.
+func transportName(ctx context.Context) string {
+	switch session := server.ClientSessionFromContext(ctx).(type) {
+	case *stdioSession:
+		return "stdio"
+	case *httpSession, *requestSession:
+		return "http"
+	case *webSocketSession:
+		return "websocket"
+	case *apiSession:
+		if strings.HasPrefix(session.id, "grpc-") {
+			return "grpc"
+		}
+		return "rest"
+	}
+	return ""
+}
+
+// HandleServerInfo handles the server_info tool execution. It reports the policy of the
+// calling client, which may be a profile.
+func (s *Server) HandleServerInfo(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	cfg := s.policyFor(ctx).config
+	info := serverInfo{
+		Name:      Name,
+		Version:   version.Get().Version,
+		Commit:    version.Get().Commit,
+		BuildDate: version.Get().Date,
+		Client:    clientName(ctx),
+		Profile:   s.policies.Load().config.ClientProfiles[clientName(ctx)],
+		Transport: transportName(ctx),
+		Limits:    newPolicyView(cfg).Limits,
+		Isolation: newIsolationInfo(cfg),
+		Network:   commandsReachNetwork(cfg),
+		History:   s.history != nil,
+		Approvals: len(cfg.RequireApproval) > 0,
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError("failed to encode the server info: " + err.Error()), nil
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
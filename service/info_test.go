@@ -0,0 +1,75 @@
+package service_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/version"
+	"github.com/shimizu1995/secure-shell-server/service"
+)
+
+func TestServerInfo(t *testing.T) {
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{t.TempDir()},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}},
+		DenyCommands:        []config.DenyCommand{},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+		MaxOutputSize:       2048,
+		Container:           &config.ContainerConfig{Runtime: "podman", Image: "alpine:3"},
+	}
+	srv, err := service.NewServer(cfg, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	t.Run("reports version, limits and isolation", func(t *testing.T) {
+		result, err := srv.HandleServerInfo(t.Context(), makeToolRequest(nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, version.Get().Version)
+
+		var info struct {
+			Version string `json:"version"`
+			Limits  struct {
+				MaxExecutionTime int `json:"maxExecutionTime"`
+				MaxOutputSize    int `json:"maxOutputSize"`
+			} `json:"limits"`
+			Isolation struct {
+				Sandbox   bool   `json:"sandbox"`
+				Container string `json:"container"`
+			} `json:"isolation"`
+			Network bool `json:"network"`
+		}
+		if err := json.Unmarshal([]byte(extractText(result)), &info); err != nil {
+			t.Fatalf("server_info did not return JSON: %v", err)
+		}
+		if info.Limits.MaxExecutionTime != 30 || info.Limits.MaxOutputSize != 2048 {
+			t.Errorf("limits = %+v, want 30s and 2048 bytes", info.Limits)
+		}
+		if info.Isolation.Sandbox || info.Isolation.Container != "podman" || info.Network {
+			t.Errorf("isolation = %+v, network = %v, want podman without network", info.Isolation, info.Network)
+		}
+	})
+
+	t.Run("reports the transport", func(t *testing.T) {
+		ts := httptest.NewServer(srv.Handler())
+		defer ts.Close()
+		sessionID := initializeSession(t, ts)
+
+		resp := postMessage(t, ts, sessionID, "application/json",
+			`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"server_info","arguments":{}}}`)
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		if !strings.Contains(string(body), `\"transport\": \"http\"`) {
+			t.Errorf("server_info over HTTP = %s, want transport http", body)
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/job"
+	"github.com/shimizu1995/secure-shell-server/pkg/runner"
+)
+
+// createStartJobTool creates the start_job tool for running a command in the background.
+func createStartJobTool() mcp.Tool {
+	return mcp.NewTool("start_job",
+		mcp.WithDescription("Start a shell command in the background and return its job ID. "+
+			"Use for long builds and test suites; poll with job_status and job_output."),
+		mcp.WithString("command",
+			mcp.Required(),
+			mcp.Description("Command to execute. Runs in the current working directory; cd does not persist."),
+		),
+		mcp.WithObject("env",
+			mcp.Description("Environment variables to set, added to the server's environment."),
+			mcp.AdditionalProperties(map[string]interface{}{"type": "string"}),
+		),
+	)
+}
+
+// createJobStatusTool creates the job_status tool for querying the state of a job.
+func createJobStatusTool() mcp.Tool {
+	return mcp.NewTool("job_status",
+		mcp.WithDescription("Show the status of a background job."),
+		mcp.WithString("id", mcp.Required(), mcp.Description("Job ID returned by start_job.")),
+	)
+}
+
+// createJobOutputTool creates the job_output tool for fetching the output of a job.
+func createJobOutputTool() mcp.Tool {
+	return mcp.NewTool("job_output",
+		mcp.WithDescription("Fetch the output of a background job from a byte offset. "+
+			"Pass the returned next offset to fetch only new output."),
+		mcp.WithString("id", mcp.Required(), mcp.Description("Job ID returned by start_job.")),
+		mcp.WithNumber("offset", mcp.Description("Byte offset to start from (default 0).")),
+	)
+}
+
+// createKillJobTool creates the kill_job tool for stopping a job.
+func createKillJobTool() mcp.Tool {
+	return mcp.NewTool("kill_job",
+		mcp.WithDescription("Stop a running background job and the processes it started."),
+		mcp.WithString("id", mcp.Required(), mcp.Description("Job ID returned by start_job.")),
+	)
+}
+
+// HandleStartJob handles the start_job tool execution.
+func (s *Server) HandleStartJob(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	command, ok := request.Params.Arguments["command"].(string)
+	if !ok || command == "" {
+		return mcp.NewToolResultError("command parameter must be a non-empty string"), nil
+	}
+	p := s.policyFor(ctx)
+	env, err := parseEnv(request.Params.Arguments["env"], p.runner.BaseEnv())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	workingDir, ok := s.currentWorkingDir(ctx)
+	if !ok {
+		return mcp.NewToolResultError(noWorkingDirMessage), nil
+	}
+
+	// Commands that need a human's approval are queued instead of started
+	req := runner.Request{Client: clientID(ctx), Command: command, WorkingDir: workingDir, Env: env}
+	if check, ok := needsApproval(ctx, p, req); ok {
+		return s.queueForApproval(p, req, check), nil
+	}
+
+	id := p.jobs.StartRequest(req)
+	s.logger.LogInfof("Job %s started: %s in directory: %s", id, command, workingDir)
+
+	result := mcp.NewToolResultText("Started job " + id)
+	result.Meta = map[string]interface{}{"jobId": id}
+	return result, nil
+}
+
+// HandleJobStatus handles the job_status tool execution.
+func (s *Server) HandleJobStatus(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, errResult := jobID(request)
+	if errResult != nil {
+		return errResult, nil
+	}
+	info, err := s.policyFor(ctx).jobs.Status(id)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	result := mcp.NewToolResultText(formatJobInfo(info))
+	result.Meta = map[string]interface{}{"status": string(info.Status), "exitCode": info.ExitCode}
+	return result, nil
+}
+
+// HandleJobOutput handles the job_output tool execution.
+func (s *Server) HandleJobOutput(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, errResult := jobID(request)
+	if errResult != nil {
+		return errResult, nil
+	}
+	offset := 0
+	if raw, ok := request.Params.Arguments["offset"]; ok && raw != nil {
+		value, ok := raw.(float64)
+		if !ok || value != float64(int(value)) {
+			return mcp.NewToolResultError("offset must be an integer"), nil
+		}
+		offset = int(value)
+	}
+
+	// Read the status first so that output of a finished job is complete
+	jobs := s.policyFor(ctx).jobs
+	info, err := jobs.Status(id)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	output, next, err := jobs.Output(id, offset)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(output)
+	if output != "" && !strings.HasSuffix(output, "\n") {
+		sb.WriteString("\n")
+	}
+	fmt.Fprintf(&sb, "--- status: %s, next offset: %d ---\n", info.Status, next)
+
+	result := mcp.NewToolResultText(sb.String())
+	result.Meta = map[string]interface{}{"status": string(info.Status), "nextOffset": next}
+	return result, nil
+}
+
+// HandleKillJob handles the kill_job tool execution.
+func (s *Server) HandleKillJob(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, errResult := jobID(request)
+	if errResult != nil {
+		return errResult, nil
+	}
+	if err := s.policyFor(ctx).jobs.Kill(id); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	s.logger.LogInfof("Job %s killed", id)
+	return mcp.NewToolResultText("Stopping job " + id), nil
+}
+
+// jobID extracts the job ID from the request arguments, or returns an error result.
+func jobID(request mcp.CallToolRequest) (string, *mcp.CallToolResult) {
+	id, ok := request.Params.Arguments["id"].(string)
+	if !ok || id == "" {
+		return "", mcp.NewToolResultError("id parameter must be a non-empty string")
+	}
+	return id, nil
+}
+
+// formatJobInfo describes a job as one "key: value" line per field.
+func formatJobInfo(info job.Info) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "id: %s\n", info.ID)
+	fmt.Fprintf(&sb, "command: %s\n", info.Command)
+	fmt.Fprintf(&sb, "workingDir: %s\n", info.WorkingDir)
+	fmt.Fprintf(&sb, "status: %s\n", info.Status)
+	switch info.Status {
+	case job.StatusCompleted:
+		fmt.Fprintf(&sb, "exitCode: %d\n", info.ExitCode)
+	case job.StatusFailed:
+		fmt.Fprintf(&sb, "error: %s\n", info.Error)
+	}
+	end := info.FinishedAt
+	if end.IsZero() {
+		end = time.Now()
+	}
+	fmt.Fprintf(&sb, "elapsed: %s\n", end.Sub(info.StartedAt).Round(time.Millisecond))
+	fmt.Fprintf(&sb, "outputBytes: %d\n", info.OutputBytes)
+	return sb.String()
+}
@@ -0,0 +1,123 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/shimizu1995/secure-shell-server/service"
+)
+
+// startTestJob starts a job through the start_job tool and returns its ID.
+func startTestJob(t *testing.T, srv *service.Server, command string) string {
+	t.Helper()
+	result, err := srv.HandleStartJob(t.Context(), makeToolRequest(map[string]interface{}{"command": command}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertToolSuccess(t, result, "Started job ")
+	id, ok := result.Meta["jobId"].(string)
+	if !ok || id == "" {
+		t.Fatalf("expected jobId in result metadata, got %v", result.Meta)
+	}
+	return id
+}
+
+// waitForJob polls job_status until the job is no longer running and returns the last result.
+func waitForJob(t *testing.T, srv *service.Server, id string) *mcp.CallToolResult {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		result, err := srv.HandleJobStatus(t.Context(), makeToolRequest(map[string]interface{}{"id": id}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Meta["status"] != "running" {
+			return result
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s is still running", id)
+	return nil
+}
+
+func TestJobTools(t *testing.T) {
+	srv, _ := newTestServer(t)
+	ctx := t.Context()
+
+	t.Run("completed job reports status and output", func(t *testing.T) {
+		id := startTestJob(t, srv, "echo first; echo second; false")
+
+		status := waitForJob(t, srv, id)
+		assertToolSuccess(t, status, "status: completed\nexitCode: 1\n")
+		if got := status.Meta["exitCode"]; got != 1 {
+			t.Fatalf("expected exitCode 1 in result metadata, got %v", got)
+		}
+
+		output, err := srv.HandleJobOutput(ctx, makeToolRequest(map[string]interface{}{"id": id}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, output, "first\nsecond\n--- status: completed, next offset: 13 ---\n")
+
+		output, err = srv.HandleJobOutput(ctx, makeToolRequest(map[string]interface{}{"id": id, "offset": float64(6)}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if text := extractText(output); !strings.HasPrefix(text, "second\n---") {
+			t.Fatalf("expected output from offset 6, got: %s", text)
+		}
+	})
+
+	t.Run("blocked command fails the job", func(t *testing.T) {
+		id := startTestJob(t, srv, "rm -rf /")
+
+		status := waitForJob(t, srv, id)
+		assertToolSuccess(t, status, "status: failed\nerror: ")
+	})
+
+	t.Run("finished job cannot be killed", func(t *testing.T) {
+		id := startTestJob(t, srv, "echo done")
+		waitForJob(t, srv, id)
+
+		result, err := srv.HandleKillJob(ctx, makeToolRequest(map[string]interface{}{"id": id}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolError(t, result, "is not running")
+	})
+
+	t.Run("unknown job", func(t *testing.T) {
+		request := makeToolRequest(map[string]interface{}{"id": "missing"})
+		handlers := map[string]func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error){
+			"job_status": srv.HandleJobStatus,
+			"job_output": srv.HandleJobOutput,
+			"kill_job":   srv.HandleKillJob,
+		}
+		for name, handle := range handlers {
+			result, err := handle(ctx, request)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", name, err)
+			}
+			assertToolError(t, result, "job not found")
+		}
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		result, err := srv.HandleStartJob(ctx, makeToolRequest(map[string]interface{}{}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolError(t, result, "command parameter must be a non-empty string")
+
+		id := startTestJob(t, srv, "echo ok")
+		result, err = srv.HandleJobOutput(ctx, makeToolRequest(map[string]interface{}{"id": id, "offset": 1.5}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolError(t, result, "offset must be an integer")
+	})
+}
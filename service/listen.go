@@ -0,0 +1,85 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+)
+
+// grpcSocketName is the FileDescriptorName= of the socket systemd passes for the gRPC
+// transport.
+const grpcSocketName = "grpc"
+
+// Listen returns the listener of the HTTP transport: the socket passed by systemd socket
+// activation, the unix socket of UnixSocket when configured, or else the TCP port of the
+// server.
+func (s *Server) Listen() (net.Listener, error) {
+	if listener, err := activatedListener(false); listener != nil || err != nil {
+		return listener, err
+	}
+	if s.config.UnixSocket == nil {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen for HTTP: %w", err)
+		}
+		return listener, nil
+	}
+
+	path := s.config.UnixSocket.Path
+	if path == "" {
+		return nil, errors.New("unixSocket requires a path")
+	}
+	mode, err := s.config.UnixSocket.GetMode()
+	if err != nil {
+		return nil, err
+	}
+	// A socket left behind by a server that did not shut down cleanly would make Listen
+	// fail; anything else at the path is left alone
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on unix socket: %w", err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set the mode of the unix socket: %w", err)
+	}
+	return listener, nil
+}
+
+// activatedListeners are the listeners passed by systemd socket activation, read once since
+// reading them clears the environment that describes them.
+var activatedListeners = sync.OnceValues(systemdListeners)
+
+// namedListener is a listener passed by systemd with the name of its socket, its
+// FileDescriptorName= or the name of the socket unit.
+type namedListener struct {
+	name     string
+	listener net.Listener
+}
+
+// activatedListener returns the listener passed by systemd socket activation for a
+// transport: the one named grpcSocketName for the gRPC transport, and the first other one
+// for the HTTP transport. It returns nil when systemd passed none.
+func activatedListener(forGRPC bool) (net.Listener, error) {
+	listeners, err := activatedListeners()
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range listeners {
+		if (l.name == grpcSocketName) == forGRPC {
+			return l.listener, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,188 @@
+package service_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/service"
+)
+
+func TestUnixSocket(t *testing.T) {
+	// Socket paths are limited to about 100 bytes, which t.TempDir may exceed
+	dir, err := os.MkdirTemp("", "sock")
+	if err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socketPath := filepath.Join(dir, "mcp.sock")
+
+	newServer := func(socket *config.UnixSocketConfig) *service.Server {
+		t.Helper()
+		srv, err := service.NewServer(&config.ShellCommandConfig{
+			AllowedDirectories:  []string{t.TempDir()},
+			AllowCommands:       []config.AllowCommand{{Command: "echo"}},
+			DenyCommands:        []config.DenyCommand{},
+			DefaultErrorMessage: "Command not allowed",
+			UnixSocket:          socket,
+		}, 0, "")
+		if err != nil {
+			t.Fatalf("Failed to create server: %v", err)
+		}
+		return srv
+	}
+
+	t.Run("serves the HTTP transport with the configured mode", func(t *testing.T) {
+		// A stale socket is replaced
+		stale, err := net.Listen("unix", socketPath)
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		stale.Close()
+
+		srv := newServer(&config.UnixSocketConfig{Path: socketPath, Mode: "0660"})
+		listener, err := srv.Listen()
+		if err != nil {
+			t.Fatalf("Listen failed: %v", err)
+		}
+		httpServer, err := srv.HTTPServer()
+		if err != nil {
+			t.Fatalf("Failed to create HTTP server: %v", err)
+		}
+		go func() { _ = httpServer.Serve(listener) }()
+		t.Cleanup(func() { httpServer.Close() })
+
+		info, err := os.Stat(socketPath)
+		if err != nil {
+			t.Fatalf("Failed to stat socket: %v", err)
+		}
+		if info.Mode().Perm() != 0o660 {
+			t.Errorf("socket mode = %o, want 660", info.Mode().Perm())
+		}
+
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		}}
+		req, _ := http.NewRequestWithContext(t.Context(), http.MethodPost, "http://localhost"+service.HTTPPath,
+			strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize",`+
+				`"params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1.0"}}}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Mcp-Session-Id") == "" {
+			t.Errorf("initialize over the socket: status = %d, want 200 with a session", resp.StatusCode)
+		}
+	})
+
+	t.Run("other files at the path are left alone", func(t *testing.T) {
+		path := filepath.Join(dir, "file")
+		if err := os.WriteFile(path, []byte("keep"), 0o600); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if _, err := newServer(&config.UnixSocketConfig{Path: path}).Listen(); err == nil {
+			t.Error("Listen replaced a regular file")
+		}
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		if _, err := newServer(&config.UnixSocketConfig{Path: socketPath, Mode: "rw"}).Listen(); err == nil {
+			t.Error("Listen accepted an invalid mode")
+		}
+	})
+}
+
+func TestSystemdSocketActivation(t *testing.T) {
+	if os.Getenv("SECURE_SHELL_TEST_ACTIVATED") == "1" {
+		// In the process started below, as systemd would start the server. systemd sets
+		// LISTEN_PID once it knows the PID of the process.
+		t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		serveActivated(t)
+		return
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	file, err := listener.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("Failed to get the socket file: %v", err)
+	}
+	defer file.Close()
+
+	cmd := exec.CommandContext(t.Context(), os.Args[0], "-test.run=^TestSystemdSocketActivation$")
+	cmd.Env = append(os.Environ(), "SECURE_SHELL_TEST_ACTIVATED=1", "LISTEN_FDS=1", "LISTEN_FDNAMES=http")
+	cmd.ExtraFiles = []*os.File{file}
+	var output strings.Builder
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start the server: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	// The connection waits in the backlog of the passed socket until the server accepts it
+	url := "http://" + listener.Addr().String() + service.HTTPPath
+	req, _ := http.NewRequestWithContext(t.Context(), http.MethodPost, url,
+		strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize",`+
+			`"params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1.0"}}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v\n%s", err, output.String())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("initialize on the passed socket: status = %d, want 200\n%s", resp.StatusCode, output.String())
+	}
+}
+
+// serveActivated serves the HTTP transport on the socket passed by socket activation.
+func serveActivated(t *testing.T) {
+	t.Helper()
+	srv, err := service.NewServer(&config.ShellCommandConfig{
+		AllowedDirectories:  []string{t.TempDir()},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}},
+		DenyCommands:        []config.DenyCommand{},
+		DefaultErrorMessage: "Command not allowed",
+	}, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	listener, err := srv.Listen()
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	if _, ok := listener.(*net.TCPListener); !ok {
+		t.Fatalf("Listen returned %s, not the passed socket", listener.Addr())
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Fatal("LISTEN_FDS is left for commands to inherit")
+	}
+	httpServer, err := srv.HTTPServer()
+	if err != nil {
+		t.Fatalf("Failed to create HTTP server: %v", err)
+	}
+	_ = httpServer.Serve(listener)
+}
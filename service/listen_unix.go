@@ -0,0 +1,52 @@
+//go:build !windows
+
+package service
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation.
+const listenFDsStart = 3
+
+// systemdListeners returns the listeners passed by systemd socket activation, as
+// sd_listen_fds does: the LISTEN_FDS descriptors from 3 on when LISTEN_PID names this
+// process. It clears the LISTEN_ variables so commands do not inherit them.
+func systemdListeners() ([]namedListener, error) {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		_ = os.Unsetenv(name)
+	}
+	if pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(fds)
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fds)
+	}
+
+	listeners := make([]namedListener, count)
+	for i := range count {
+		fd := listenFDsStart + i
+		syscall.CloseOnExec(fd)
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		// FileListener duplicates the descriptor
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket %s passed by systemd is not a listening socket: %w", name, err)
+		}
+		listeners[i] = namedListener{name: name, listener: listener}
+	}
+	return listeners, nil
+}
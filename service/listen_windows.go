@@ -0,0 +1,8 @@
+//go:build windows
+
+package service
+
+// systemdListeners returns no listeners; there is no socket activation on Windows.
+func systemdListeners() ([]namedListener, error) {
+	return nil, nil
+}
@@ -0,0 +1,360 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+const (
+	// jwtLeeway is the clock skew tolerated when checking exp and nbf.
+	jwtLeeway = time.Minute
+	// jwksRefreshInterval is how long signing keys are cached.
+	jwksRefreshInterval = time.Hour
+	// jwksMinRefreshInterval limits refetching the keys for tokens signed with an unknown key.
+	jwksMinRefreshInterval = time.Minute
+	// oidcHTTPTimeout bounds requests to the provider.
+	oidcHTTPTimeout = 10 * time.Second
+)
+
+// oidcVerifier validates JWTs issued by an OpenID Connect provider and returns the
+// client they identify. The provider's signing keys are fetched on first use and cached.
+type oidcVerifier struct {
+	config config.OIDCConfig
+	client *http.Client
+	// now returns the current time; replaced in tests
+	now func() time.Time
+
+	mu        sync.Mutex
+	jwksURL   string
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// newOIDCVerifier creates a verifier for the provider of cfg.
+func newOIDCVerifier(cfg config.OIDCConfig) (*oidcVerifier, error) {
+	if cfg.Issuer == "" {
+		return nil, errors.New("oidc requires an issuer")
+	}
+	if cfg.Audience == "" {
+		return nil, errors.New("oidc requires an audience")
+	}
+	return &oidcVerifier{
+		config:  cfg,
+		client:  &http.Client{Timeout: oidcHTTPTimeout},
+		now:     time.Now,
+		jwksURL: cfg.JWKSURL,
+	}, nil
+}
+
+// jwtHeader is the JOSE header of a JWT.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// audience is the aud claim, a string or an array of strings.
+type audience []string
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("aud must be a string or an array of strings")
+	}
+	*a = list
+	return nil
+}
+
+// jwtClaims are the registered claims checked by the verifier.
+type jwtClaims struct {
+	Iss string   `json:"iss"`
+	Aud audience `json:"aud"`
+	Exp *float64 `json:"exp"`
+	Nbf *float64 `json:"nbf"`
+}
+
+// verify checks the signature and claims of token and returns the value of its client claim.
+func (o *oidcVerifier) verify(ctx context.Context, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("malformed token")
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", fmt.Errorf("malformed token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("malformed token signature: %w", err)
+	}
+
+	key, err := o.key(ctx, header.Kid)
+	if err != nil {
+		return "", err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return "", err
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", fmt.Errorf("malformed token claims: %w", err)
+	}
+	if err := o.checkClaims(claims); err != nil {
+		return "", err
+	}
+
+	var all map[string]any
+	if err := decodeSegment(parts[1], &all); err != nil {
+		return "", fmt.Errorf("malformed token claims: %w", err)
+	}
+	claim := o.config.GetClientClaim()
+	client, _ := all[claim].(string)
+	if client == "" {
+		return "", fmt.Errorf("token has no %s claim", claim)
+	}
+	return client, nil
+}
+
+// checkClaims checks the issuer, audience and validity period of a token.
+func (o *oidcVerifier) checkClaims(claims jwtClaims) error {
+	if claims.Iss != o.config.Issuer {
+		return fmt.Errorf("token issuer %q is not %q", claims.Iss, o.config.Issuer)
+	}
+	if !slices.Contains(claims.Aud, o.config.Audience) {
+		return fmt.Errorf("token is not issued for audience %q", o.config.Audience)
+	}
+	now := o.now()
+	if claims.Exp == nil {
+		return errors.New("token has no expiry")
+	}
+	if now.After(unixTime(*claims.Exp).Add(jwtLeeway)) {
+		return errors.New("token has expired")
+	}
+	if claims.Nbf != nil && now.Add(jwtLeeway).Before(unixTime(*claims.Nbf)) {
+		return errors.New("token is not valid yet")
+	}
+	return nil
+}
+
+// unixTime converts a NumericDate claim to a time.
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a token into v.
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verifySignature checks a JWS signature made with alg. Only asymmetric algorithms are
+// accepted, so a token cannot be signed with the public key or not at all.
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	if len(alg) != len("RS256") {
+		return fmt.Errorf("unsupported token algorithm %q", alg)
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported token algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not match token algorithm %q", alg)
+		}
+		if alg[0] == 'P' {
+			return rsa.VerifyPSS(rsaKey, hash, digest, signature, nil)
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature)
+	case strings.HasPrefix(alg, "ES"):
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not match token algorithm %q", alg)
+		}
+		// ES512 uses P-521; the others name the curve's size
+		bits := ecKey.Curve.Params().BitSize
+		if want := alg[2:]; bits != map[string]int{"256": 256, "384": 384, "512": 521}[want] {
+			return fmt.Errorf("key does not match token algorithm %q", alg)
+		}
+		// The signature is r and s, each as long as the curve's order
+		size := (bits + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported token algorithm %q", alg)
+	}
+}
+
+// key returns the signing key with the given ID, fetching the provider's keys when they
+// are not cached, are stale, or do not include it.
+func (o *oidcVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	age := o.now().Sub(o.fetchedAt)
+	if o.keys != nil && age < jwksRefreshInterval {
+		if key, ok := o.keys[kid]; ok {
+			return key, nil
+		}
+		// The provider may have rotated its keys, but do not let tokens trigger a fetch each
+		if age < jwksMinRefreshInterval {
+			return nil, fmt.Errorf("unknown token signing key %q", kid)
+		}
+	}
+
+	if err := o.fetchKeys(ctx); err != nil {
+		return nil, err
+	}
+	key, ok := o.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown token signing key %q", kid)
+	}
+	return key, nil
+}
+
+// fetchKeys fetches the provider's signing keys, discovering their URL first if needed.
+func (o *oidcVerifier) fetchKeys(ctx context.Context) error {
+	if o.jwksURL == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		url := strings.TrimSuffix(o.config.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := o.getJSON(ctx, url, &discovery); err != nil {
+			return fmt.Errorf("failed to discover the OIDC provider: %w", err)
+		}
+		if discovery.Issuer != o.config.Issuer || discovery.JWKSURI == "" {
+			return fmt.Errorf("OIDC discovery of %s returned issuer %q without matching keys", o.config.Issuer, discovery.Issuer)
+		}
+		o.jwksURL = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := o.getJSON(ctx, o.jwksURL, &jwks); err != nil {
+		return fmt.Errorf("failed to fetch the OIDC signing keys: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		// Keys of other types or for encryption are skipped
+		if key, err := jwk.publicKey(); err == nil && (jwk.Use == "" || jwk.Use == "sig") {
+			keys[jwk.Kid] = key
+		}
+	}
+	o.keys, o.fetchedAt = keys, o.now()
+	return nil
+}
+
+// getJSON fetches url and decodes its JSON body into v.
+func (o *oidcVerifier) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// jsonWebKey is an RSA or EC public key of a JWK set.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes the key.
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, errors.New("invalid key parameter")
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,148 @@
+package service_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/service"
+)
+
+// oidcProvider serves OIDC discovery and the JWKS of an RSA key, and signs tokens with it.
+type oidcProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+}
+
+func newOIDCProvider(t *testing.T) *oidcProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	p := &oidcProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": p.URL, "jwks_uri": p.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key-1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// token returns an RS256 token with claims signed by the provider's key.
+func (p *oidcProvider) token(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	encode := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Failed to encode token: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(map[string]string{"alg": "RS256", "kid": "key-1", "typ": "JWT"}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestHTTPOIDC(t *testing.T) {
+	provider := newOIDCProvider(t)
+	dir := t.TempDir()
+	blockLog := filepath.Join(t.TempDir(), "blocked.log")
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{dir},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}},
+		DefaultErrorMessage: "Command not allowed",
+		BlockLogPath:        blockLog,
+		OIDC:                &config.OIDCConfig{Issuer: provider.URL, Audience: "secure-shell"},
+	}
+	srv, err := service.NewServer(cfg, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	post := func(token, sessionID, body string) *http.Response {
+		req, _ := http.NewRequestWithContext(t.Context(), http.MethodPost, ts.URL+service.HTTPPath, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		if sessionID != "" {
+			req.Header.Set("Mcp-Session-Id", sessionID)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	const initialize = `{"jsonrpc":"2.0","id":1,"method":"initialize",` +
+		`"params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1.0"}}}`
+	now := time.Now().Unix()
+	valid := map[string]any{"iss": provider.URL, "aud": "secure-shell", "sub": "ci-agent", "exp": now + 300}
+
+	rejected := map[string]map[string]any{
+		"expired":        {"iss": provider.URL, "aud": "secure-shell", "sub": "ci-agent", "exp": now - 300},
+		"wrong audience": {"iss": provider.URL, "aud": "other", "sub": "ci-agent", "exp": now + 300},
+		"wrong issuer":   {"iss": "https://evil.example.com", "aud": "secure-shell", "sub": "ci-agent", "exp": now + 300},
+		"no subject":     {"iss": provider.URL, "aud": []string{"secure-shell"}, "exp": now + 300},
+	}
+	for name, claims := range rejected {
+		if resp := post(provider.token(t, claims), "", initialize); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want 401", name, resp.StatusCode)
+		}
+	}
+
+	// A token with a tampered payload fails the signature check
+	token := provider.token(t, valid)
+	parts := strings.Split(token, ".")
+	tampered, _ := json.Marshal(map[string]any{"iss": provider.URL, "aud": "secure-shell", "sub": "admin", "exp": now + 300})
+	parts[1] = base64.RawURLEncoding.EncodeToString(tampered)
+	if resp := post(strings.Join(parts, "."), "", initialize); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("tampered token: status = %d, want 401", resp.StatusCode)
+	}
+
+	resp := post(token, "", initialize)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("valid token: status = %d, want 200", resp.StatusCode)
+	}
+	sessionID := resp.Header.Get("Mcp-Session-Id")
+	post(token, sessionID, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+	// The subject identifies the client in the block log
+	post(token, sessionID, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"run","arguments":{"commands":["rm x"]}}}`)
+	data, err := os.ReadFile(blockLog)
+	if err != nil {
+		t.Fatalf("Failed to read block log: %v", err)
+	}
+	if !strings.Contains(string(data), `"client":"ci-agent"`) {
+		t.Errorf("Block log does not name the subject: %s", data)
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/runner"
+)
+
+// ServerOption configures a Server created with NewServerWithOptions.
+type ServerOption func(*serverOptions)
+
+// serverOptions are the settings of NewServerWithOptions.
+type serverOptions struct {
+	port          int
+	logPath       string
+	logger        *logger.Logger
+	configPath    string
+	runnerOptions []runner.Option
+}
+
+// WithPort sets the port Start listens on when neither a Unix socket nor systemd socket
+// activation is used.
+func WithPort(port int) ServerOption {
+	return func(o *serverOptions) { o.port = port }
+}
+
+// WithLogPath makes the server log to the file path, with the log target, format, level,
+// rotation and sinks of its configuration.
+func WithLogPath(path string) ServerOption {
+	return func(o *serverOptions) { o.logPath = path }
+}
+
+// WithLogger makes the server log to l instead of the logger of its configuration, which
+// WithLogPath is then ignored for.
+func WithLogger(l *logger.Logger) ServerOption {
+	return func(o *serverOptions) { o.logger = l }
+}
+
+// WithConfigPath sets the configuration file ReloadConfigFile reads, as SetConfigPath does.
+func WithConfigPath(path string) ServerOption {
+	return func(o *serverOptions) { o.configPath = path }
+}
+
+// WithHooks registers hooks with the runner of every policy, as WithRunnerOptions does with
+// runner.WithHooks.
+func WithHooks(hooks ...runner.Hook) ServerOption {
+	return WithRunnerOptions(runner.WithHooks(hooks...))
+}
+
+// WithRunnerOptions applies opts to the runner of every policy, including those of reloaded
+// configurations, after the server's own logger and validator. Run observers are replaced
+// by the server's when a history is configured.
+func WithRunnerOptions(opts ...runner.Option) ServerOption {
+	return func(o *serverOptions) { o.runnerOptions = append(o.runnerOptions, opts...) }
+}
@@ -0,0 +1,92 @@
+package service_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mvdan.cc/sh/v3/interp"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/runner"
+	"github.com/shimizu1995/secure-shell-server/service"
+)
+
+func TestNewServerWithOptions(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	writeConfig := func(commands string) {
+		t.Helper()
+		data := `{"allowedDirectories": ["` + tmpDir + `"], "allowCommands": [` + commands + `], "denyCommands": []}`
+		if err := os.WriteFile(configPath, []byte(data), 0o600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+	writeConfig(`"ls"`)
+	cfg, err := config.LoadConfigFromFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	handler := func(ctx context.Context, args []string) error {
+		_, err := interp.HandlerCtx(ctx).Stdout.Write([]byte("handled " + args[0] + "\n"))
+		return err
+	}
+	srv, err := service.NewServerWithOptions(cfg,
+		service.WithConfigPath(configPath),
+		service.WithRunnerOptions(runner.WithExecHandler(handler)),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	run := func(command string) {
+		t.Helper()
+		result, err := srv.HandleRunCommand(t.Context(), makeToolRequest(map[string]interface{}{
+			"commands": []interface{}{command}, "directory": tmpDir,
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, "handled "+command)
+	}
+	run("ls")
+
+	// Runners of reloaded configurations get the options too
+	writeConfig(`"ls", "whoami"`)
+	if err := srv.ReloadConfigFile(); err != nil {
+		t.Fatalf("ReloadConfigFile failed: %v", err)
+	}
+	run("whoami")
+}
+
+// envHook injects a variable into every external command.
+type envHook struct{}
+
+func (envHook) BeforeExec(_ context.Context, cmd *runner.ExecCommand) error {
+	cmd.Env = append(cmd.Env, "INJECTED=by-hook")
+	return nil
+}
+
+func TestServerHooks(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{tmpDir},
+		AllowCommands:       []config.AllowCommand{{Command: "printenv"}},
+		DenyCommands:        []config.DenyCommand{},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    10,
+		MaxOutputSize:       1024,
+	}
+	srv, err := service.NewServerWithOptions(cfg, service.WithHooks(envHook{}))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	result, err := srv.HandleRunCommand(t.Context(), makeToolRequest(map[string]interface{}{
+		"commands": []interface{}{"printenv INJECTED"}, "directory": tmpDir,
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertToolSuccess(t, result, "by-hook")
+}
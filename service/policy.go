@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+// createGetPolicyTool creates the get_policy tool for discovering what commands may do.
+func createGetPolicyTool() mcp.Tool {
+	return mcp.NewTool("get_policy",
+		mcp.WithDescription("Show the effective security policy as JSON: allowed and denied commands, "+
+			"allowed directories and limits. Check it before planning commands instead of learning from blocks."),
+	)
+}
+
+// policyView is the part of a policy get_policy returns: what commands may do, without the
+// server's logging, transport and authentication settings.
+type policyView struct {
+	AllowedDirectories  []string              `json:"allowedDirectories"`
+	ReadOnlyDirectories []string              `json:"readOnlyDirectories,omitempty"`
+	DenyPaths           []string              `json:"denyPaths,omitempty"`
+	AllowCommands       []config.AllowCommand `json:"allowCommands"`
+	DenyCommands        []config.DenyCommand  `json:"denyCommands"`
+	EnvPolicy           *config.EnvPolicy     `json:"envPolicy,omitempty"`
+	// RequireApproval lists the commands that are queued for a human's approval
+	RequireApproval []string `json:"requireApproval,omitempty"`
+	// WriteFile and ListDirectory hold the limits of write_file and list_directory, with
+	// defaults applied
+	WriteFile     config.WriteFileConfig     `json:"writeFile"`
+	ListDirectory config.ListDirectoryConfig `json:"listDirectory"`
+	Limits        policyLimits               `json:"limits"`
+}
+
+// policyLimits are the effective limits of a policy, with defaults applied. Zero means
+// unlimited.
+type policyLimits struct {
+	// MaxExecutionTime and MaxCallTimeout are in seconds
+	MaxExecutionTime int `json:"maxExecutionTime"`
+	MaxCallTimeout   int `json:"maxCallTimeout"`
+	// MaxOutputSize, MaxStdoutSize and MaxStderrSize are in bytes
+	MaxOutputSize  int                    `json:"maxOutputSize"`
+	MaxStdoutSize  int                    `json:"maxStdoutSize"`
+	MaxStderrSize  int                    `json:"maxStderrSize"`
+	MaxOutputLines int                    `json:"maxOutputLines"`
+	ScriptLimits   *config.ScriptLimits   `json:"scriptLimits,omitempty"`
+	ResourceLimits *config.ResourceLimits `json:"resourceLimits,omitempty"`
+	Quota          *config.QuotaConfig    `json:"quota,omitempty"`
+}
+
+// newPolicyView returns the view of cfg. Lists are never null, so clients can tell an empty
+// list from a missing one.
+func newPolicyView(cfg *config.ShellCommandConfig) policyView {
+	view := policyView{
+		AllowedDirectories:  cfg.AllowedDirectories,
+		ReadOnlyDirectories: cfg.ReadOnlyDirectories,
+		DenyPaths:           cfg.DenyPaths,
+		AllowCommands:       cfg.AllowCommands,
+		DenyCommands:        cfg.DenyCommands,
+		EnvPolicy:           cfg.EnvPolicy,
+		RequireApproval:     cfg.RequireApproval,
+		WriteFile: config.WriteFileConfig{
+			MaxFileSize: cfg.WriteFile.GetMaxFileSize(),
+		},
+		ListDirectory: config.ListDirectoryConfig{
+			MaxDepth:   cfg.ListDirectory.GetMaxDepth(),
+			MaxEntries: cfg.ListDirectory.GetMaxEntries(),
+		},
+		Limits: policyLimits{
+			MaxExecutionTime: cfg.MaxExecutionTime,
+			MaxCallTimeout:   cfg.GetMaxCallTimeout(),
+			MaxOutputSize:    cfg.MaxOutputSize,
+			MaxStdoutSize:    cfg.GetMaxStdoutSize(),
+			MaxStderrSize:    cfg.GetMaxStderrSize(),
+			MaxOutputLines:   cfg.MaxOutputLines,
+			ScriptLimits:     cfg.ScriptLimits,
+			ResourceLimits:   cfg.ResourceLimits,
+			Quota:            cfg.Quota,
+		},
+	}
+	if cfg.WriteFile != nil {
+		view.WriteFile.AllowedExtensions = cfg.WriteFile.AllowedExtensions
+	}
+	if view.AllowedDirectories == nil {
+		view.AllowedDirectories = []string{}
+	}
+	if view.AllowCommands == nil {
+		view.AllowCommands = []config.AllowCommand{}
+	}
+	if view.DenyCommands == nil {
+		view.DenyCommands = []config.DenyCommand{}
+	}
+	return view
+}
+
+// HandleGetPolicy handles the get_policy tool execution. It returns the policy of the
+// calling client, which may be a profile.
+func (s *Server) HandleGetPolicy(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	data, err := json.MarshalIndent(newPolicyView(s.policyFor(ctx).config), "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError("failed to encode the policy: " + err.Error()), nil
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
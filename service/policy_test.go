@@ -0,0 +1,74 @@
+package service_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/service"
+)
+
+func TestGetPolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	stdoutSize := 512
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories: []string{tmpDir},
+		AllowCommands: []config.AllowCommand{
+			{Command: "echo"},
+			{Command: "git", SubCommands: []config.SubCommandRule{{Name: "status"}}, RateLimit: &config.RateLimit{Count: 5, Per: "1m"}},
+		},
+		DenyCommands:        []config.DenyCommand{{Command: "rm", Message: "use trash instead"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    30,
+		MaxOutputSize:       1024,
+		MaxStdoutSize:       &stdoutSize,
+		ScriptLimits:        &config.ScriptLimits{MaxCommands: 10},
+		AuthTokens:          []config.AuthToken{{Token: "secret", Client: "ci"}},
+	}
+	srv, err := service.NewServer(cfg, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	result, err := srv.HandleGetPolicy(t.Context(), makeToolRequest(nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertToolSuccess(t, result, "allowCommands")
+	text := extractText(result)
+
+	var policy struct {
+		AllowedDirectories []string              `json:"allowedDirectories"`
+		AllowCommands      []config.AllowCommand `json:"allowCommands"`
+		DenyCommands       []config.DenyCommand  `json:"denyCommands"`
+		Limits             map[string]any        `json:"limits"`
+		AuthTokens         any                   `json:"authTokens"`
+	}
+	if err := json.Unmarshal([]byte(text), &policy); err != nil {
+		t.Fatalf("get_policy did not return JSON: %v\n%s", err, text)
+	}
+	if len(policy.AllowedDirectories) != 1 || policy.AllowedDirectories[0] != tmpDir {
+		t.Errorf("allowedDirectories = %v, want [%s]", policy.AllowedDirectories, tmpDir)
+	}
+	if len(policy.AllowCommands) != 2 || policy.AllowCommands[1].SubCommands[0].Name != "status" ||
+		policy.AllowCommands[1].RateLimit.Count != 5 {
+		t.Errorf("allowCommands = %+v, want echo and git with its rules", policy.AllowCommands)
+	}
+	if len(policy.DenyCommands) != 1 || policy.DenyCommands[0].Message != "use trash instead" {
+		t.Errorf("denyCommands = %+v, want rm with its message", policy.DenyCommands)
+	}
+	// Limits are effective values: maxStderrSize falls back to maxOutputSize, and
+	// maxCallTimeout to maxExecutionTime
+	for key, want := range map[string]float64{"maxExecutionTime": 30, "maxCallTimeout": 30, "maxOutputSize": 1024, "maxStdoutSize": 512, "maxStderrSize": 1024} {
+		if got := policy.Limits[key]; got != want {
+			t.Errorf("limits.%s = %v, want %v", key, got, want)
+		}
+	}
+	if policy.Limits["scriptLimits"] == nil {
+		t.Error("limits.scriptLimits is missing")
+	}
+	// Server settings such as tokens are not exposed
+	if policy.AuthTokens != nil {
+		t.Error("get_policy exposes authTokens")
+	}
+}
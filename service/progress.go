@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	// progressInterval is how often progress notifications are sent while commands run.
+	progressInterval = time.Second
+	// maxProgressLine is the number of bytes of the last output line reported in progress notifications.
+	maxProgressLine = 200
+)
+
+// progress tracks the output of a tool call's commands and reports it to the client in
+// notifications/progress messages until stopped. It is an io.Writer for the commands'
+// output; a nil *progress discards writes.
+type progress struct {
+	token mcp.ProgressToken
+	start time.Time
+	done  chan struct{}
+	wg    sync.WaitGroup
+
+	mu      sync.Mutex
+	bytes   int64
+	last    string // last non-empty output line, possibly incomplete
+	pending []byte // output after the last newline
+}
+
+// progressToken returns the progress token of the request, nil if the client did not ask for progress.
+func progressToken(request mcp.CallToolRequest) mcp.ProgressToken {
+	if request.Params.Meta == nil {
+		return nil
+	}
+	return request.Params.Meta.ProgressToken
+}
+
+// startProgress starts sending progress notifications for the request of ctx with token.
+// It returns nil when token is nil or the client cannot receive notifications.
+func (s *Server) startProgress(ctx context.Context, token mcp.ProgressToken) *progress {
+	mcpServer := server.ServerFromContext(ctx)
+	if token == nil || mcpServer == nil {
+		return nil
+	}
+	p := &progress{token: token, start: time.Now(), done: make(chan struct{})}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := mcpServer.SendNotificationToClient(ctx, "notifications/progress", p.params()); err != nil {
+					s.logger.LogErrorf("Failed to send progress notification: %v", err)
+					return
+				}
+			case <-p.done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// stop stops sending notifications, and returns once the last one has been sent.
+func (p *progress) stop() {
+	if p == nil {
+		return
+	}
+	close(p.done)
+	p.wg.Wait()
+}
+
+// Write counts p's bytes and remembers the last line of output.
+func (p *progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bytes += int64(len(b))
+
+	lines := bytes.Split(append(p.pending, b...), []byte("\n"))
+	for _, line := range lines {
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			p.last = lastBytes(line, maxProgressLine)
+		}
+	}
+	p.pending = []byte(lastBytes(lines[len(lines)-1], maxProgressLine))
+	return len(b), nil
+}
+
+// params returns the parameters of a progress notification: the seconds elapsed as the
+// progress, and a message with the elapsed time, the bytes of output and the last line.
+func (p *progress) params() map[string]any {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	elapsed := time.Since(p.start)
+	message := fmt.Sprintf("%s elapsed, %d bytes of output", elapsed.Round(time.Second), p.bytes)
+	if p.last != "" {
+		message += ", last line: " + p.last
+	}
+	return map[string]any{
+		"progressToken": p.token,
+		"progress":      elapsed.Seconds(),
+		"message":       message,
+	}
+}
+
+// lastBytes returns the last n bytes of b as a string, dropping a split UTF-8 sequence.
+func lastBytes(b []byte, n int) string {
+	if len(b) <= n {
+		return string(b)
+	}
+	return strings.ToValidUTF8(string(b[len(b)-n:]), "")
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+// promptTemplate is a prompt that guides the model through a common operation with a
+// sequence of commands. Only the steps the client's policy allows are offered.
+type promptTemplate struct {
+	name        string
+	description string
+	// task describes the operation to the model; %s is the directory it is about
+	task string
+	// steps are the commands the model may run, in order. Alternatives for the same step,
+	// e.g. the test commands of several languages, are separate entries.
+	steps []string
+	// argument is an optional argument whose value is offered as the first step, "" for none
+	argument            string
+	argumentDescription string
+}
+
+// promptTemplates are the prompts of the server.
+var promptTemplates = []promptTemplate{
+	{
+		name:        "investigate_failing_tests",
+		description: "Run the tests of a project and investigate the failures, with commands the policy allows.",
+		task: "Investigate why tests fail in %s. Run the tests, read the failures and the code they point to, " +
+			"and explain the cause before proposing a fix.",
+		steps:               []string{"go test ./...", "npm test", "make test", "pytest", "git status --short", "git diff"},
+		argument:            "test_command",
+		argumentDescription: "Command that runs the tests, e.g. \"go test ./pkg/...\" (default: the usual test commands the policy allows).",
+	},
+	{
+		name:        "summarize_git_status",
+		description: "Summarize the state of a git repository: branch, changes and recent commits.",
+		task: "Summarize the state of the git repository in %s: the current branch, uncommitted changes " +
+			"and the most recent commits. Do not change anything.",
+		steps: []string{"git status --short --branch", "git diff --stat", "git log --oneline -10"},
+	},
+	{
+		name:        "explore_directory",
+		description: "Get an overview of a directory's contents before working in it.",
+		task:        "Give an overview of %s: what it contains and what it is for. Do not change anything.",
+		steps:       []string{"ls -la", "cat README.md", "git log --oneline -5"},
+	},
+}
+
+// registerPrompts registers the server's prompts with the MCP server.
+func (s *Server) registerPrompts() {
+	for _, t := range promptTemplates {
+		opts := []mcp.PromptOption{
+			mcp.WithPromptDescription(t.description),
+			mcp.WithArgument("directory",
+				mcp.ArgumentDescription("Directory to work in (default: the current working directory)."),
+			),
+		}
+		if t.argument != "" {
+			opts = append(opts, mcp.WithArgument(t.argument, mcp.ArgumentDescription(t.argumentDescription)))
+		}
+		s.mcpServer.AddPrompt(mcp.NewPrompt(t.name, opts...), s.promptHandler(t))
+	}
+}
+
+// promptHandler returns the handler of the prompt t. The prompt lists the steps of t that
+// the client's policy allows in the requested directory, so the model is not led to
+// commands that would be blocked.
+func (s *Server) promptHandler(t promptTemplate) server.PromptHandlerFunc {
+	return func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		workingDir, ok := s.currentWorkingDir(ctx)
+		if !ok {
+			return nil, errors.New(noWorkingDirMessage)
+		}
+		if dir := request.Params.Arguments["directory"]; dir != "" {
+			workingDir = resolvePath(workingDir, dir)
+		}
+
+		steps := t.steps
+		if t.argument != "" && request.Params.Arguments[t.argument] != "" {
+			steps = append([]string{request.Params.Arguments[t.argument]}, steps...)
+		}
+		allowed := s.allowedSteps(ctx, steps, workingDir)
+
+		var sb strings.Builder
+		fmt.Fprintf(&sb, t.task, workingDir)
+		sb.WriteString("\n\n")
+		if len(allowed) == 0 {
+			sb.WriteString("None of the usual commands for this are allowed by the policy here. " +
+				"Read the policy with get_policy and tell the user what is missing instead of trying other commands.\n")
+		} else {
+			fmt.Fprintf(&sb, "Use the run tool with directory %q. These commands are allowed by the policy:\n", workingDir)
+			for _, step := range allowed {
+				fmt.Fprintf(&sb, "- %s\n", step)
+			}
+			sb.WriteString("\nCheck any other command with validate_command before running it, " +
+				"and do not try to work around commands the policy blocks.\n")
+		}
+		return mcp.NewGetPromptResult(t.description, []mcp.PromptMessage{
+			mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(sb.String())),
+		}), nil
+	}
+}
+
+// allowedSteps returns the steps the policy of the client of ctx allows in workingDir.
+func (s *Server) allowedSteps(ctx context.Context, steps []string, workingDir string) []string {
+	p := s.policyFor(ctx)
+	if !p.validator.ValidateDirectory(workingDir).Allowed {
+		return nil
+	}
+	ctx = validator.WithCaller(ctx, validator.Caller{Client: clientID(ctx)})
+	var allowed []string
+	for _, step := range steps {
+		if p.validator.CheckScript(ctx, step, workingDir).Allowed {
+			allowed = append(allowed, step)
+		}
+	}
+	return allowed
+}
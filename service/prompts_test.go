@@ -0,0 +1,88 @@
+package service_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestPrompts(t *testing.T) {
+	srv, tmpDir := newTestServer(t)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	sessionID := initializeSession(t, ts)
+
+	resp := postMessage(t, ts, sessionID, "application/json", `{"jsonrpc":"2.0","id":1,"method":"prompts/list"}`)
+	var list struct {
+		Result struct {
+			Prompts []mcp.Prompt `json:"prompts"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to list prompts: %v", err)
+	}
+	names := make([]string, len(list.Result.Prompts))
+	for i, p := range list.Result.Prompts {
+		names[i] = p.Name
+	}
+	for _, want := range []string{"investigate_failing_tests", "summarize_git_status", "explore_directory"} {
+		if !strings.Contains(strings.Join(names, ","), want) {
+			t.Errorf("prompts = %v, want %s", names, want)
+		}
+	}
+
+	// getPrompt gets the prompt name with arguments and returns the text of its message
+	getPrompt := func(name, arguments string) string {
+		t.Helper()
+		resp := postMessage(t, ts, sessionID, "application/json",
+			`{"jsonrpc":"2.0","id":2,"method":"prompts/get","params":{"name":"`+name+`","arguments":`+arguments+`}}`)
+		var msg struct {
+			Result struct {
+				Messages []struct {
+					Role    string `json:"role"`
+					Content struct {
+						Text string `json:"text"`
+					} `json:"content"`
+				} `json:"messages"`
+			} `json:"result"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil || len(msg.Result.Messages) != 1 {
+			t.Fatalf("Failed to get prompt %s: %v", name, err)
+		}
+		return msg.Result.Messages[0].Content.Text
+	}
+
+	t.Run("only allowed steps are offered", func(t *testing.T) {
+		text := getPrompt("explore_directory", `{}`)
+		if !strings.Contains(text, tmpDir) || !strings.Contains(text, "- ls -la\n") {
+			t.Errorf("explore_directory = %q, want ls -la in %s", text, tmpDir)
+		}
+		if strings.Contains(text, "cat README.md") || strings.Contains(text, "git log") {
+			t.Errorf("explore_directory = %q, offers commands the policy blocks", text)
+		}
+	})
+
+	t.Run("argument is the first step", func(t *testing.T) {
+		text := getPrompt("investigate_failing_tests", `{"test_command":"echo testing"}`)
+		if !strings.Contains(text, "- echo testing\n") || strings.Contains(text, "go test") {
+			t.Errorf("investigate_failing_tests = %q, want only the given test command", text)
+		}
+	})
+
+	t.Run("no allowed steps", func(t *testing.T) {
+		text := getPrompt("summarize_git_status", `{}`)
+		if !strings.Contains(text, "None of the usual commands") || strings.Contains(text, "- git") {
+			t.Errorf("summarize_git_status = %q, want no steps", text)
+		}
+	})
+
+	t.Run("directory outside the policy", func(t *testing.T) {
+		text := getPrompt("explore_directory", `{"directory":"/"}`)
+		if !strings.Contains(text, "None of the usual commands") {
+			t.Errorf("explore_directory of / = %q, want no steps", text)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+)
+
+// errExecutionQuota is the cause of the cancellation of calls that use up their client's
+// execution time quota.
+var errExecutionQuota = errors.New("execution time quota used up")
+
+// quotaTracker counts the tool calls and execution time of each client in its current
+// window. It is safe for concurrent use.
+type quotaTracker struct {
+	config config.QuotaConfig
+	window time.Duration
+
+	mu    sync.Mutex
+	usage map[string]*quotaUsage
+}
+
+// quotaUsage is the usage of a client in the window that started at start.
+type quotaUsage struct {
+	start time.Time
+	calls int
+	busy  time.Duration
+}
+
+// quotaError reports a call rejected because its client used up a quota.
+type quotaError struct {
+	// limit names the quota: "maxCalls" or "maxExecutionSeconds"
+	limit      string
+	message    string
+	retryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (e *quotaError) Error() string { return e.message }
+
+// newQuotaTracker creates the tracker of cfg, or returns nil when cfg sets no limit.
+func newQuotaTracker(cfg *config.QuotaConfig) *quotaTracker {
+	if cfg == nil || (cfg.MaxCalls <= 0 && cfg.MaxExecutionSeconds <= 0) {
+		return nil
+	}
+	return &quotaTracker{
+		config: *cfg,
+		window: cfg.GetWindow(),
+		usage:  make(map[string]*quotaUsage),
+	}
+}
+
+// begin counts a call of client. It returns the start of the client's window, to pass to
+// end, and the time the call may take at most (zero for unlimited), or a quotaError when the
+// client has used up a quota.
+func (q *quotaTracker) begin(client string) (time.Time, time.Duration, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	u := q.usage[client]
+	if u == nil || now.Sub(u.start) >= q.window {
+		q.forgetExpired(now)
+		u = &quotaUsage{start: now}
+		q.usage[client] = u
+	}
+	retryAfter := u.start.Add(q.window).Sub(now)
+
+	if q.config.MaxCalls > 0 && u.calls >= q.config.MaxCalls {
+		return time.Time{}, 0, &quotaError{
+			limit: "maxCalls",
+			message: fmt.Sprintf("quota exceeded: %d tool calls per %s, try again in %s",
+				q.config.MaxCalls, formatWindow(q.window), retryAfter.Round(time.Second)),
+			retryAfter: retryAfter,
+		}
+	}
+	var remaining time.Duration
+	if q.config.MaxExecutionSeconds > 0 {
+		remaining = time.Duration(q.config.MaxExecutionSeconds)*time.Second - u.busy
+		if remaining <= 0 {
+			return time.Time{}, 0, &quotaError{
+				limit: "maxExecutionSeconds",
+				message: fmt.Sprintf("quota exceeded: %d seconds of execution time per %s, try again in %s",
+					q.config.MaxExecutionSeconds, formatWindow(q.window), retryAfter.Round(time.Second)),
+				retryAfter: retryAfter,
+			}
+		}
+	}
+	u.calls++
+	return u.start, remaining, nil
+}
+
+// end adds the duration of a call that began in the window starting at start. Calls that
+// outlast their window count for it only.
+func (q *quotaTracker) end(client string, start time.Time, duration time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if u := q.usage[client]; u != nil && u.start.Equal(start) {
+		u.busy += duration
+	}
+}
+
+// forgetExpired drops the usage of windows that ended before now. The caller holds q.mu.
+func (q *quotaTracker) forgetExpired(now time.Time) {
+	for client, u := range q.usage {
+		if now.Sub(u.start) >= q.window {
+			delete(q.usage, client)
+		}
+	}
+}
+
+// formatWindow formats a window without trailing zero units, e.g. "1h" instead of "1h0m0s".
+func formatWindow(d time.Duration) string {
+	text := d.String()
+	if strings.HasSuffix(text, "m0s") {
+		text = strings.TrimSuffix(text, "0s")
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+	return text
+}
+
+// quotaMiddleware enforces the quota of the caller's policy on every tool call. Rejected
+// calls return an error result naming the quota and when it resets; calls that use up the
+// execution time quota are stopped.
+func (s *Server) quotaMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		quota := s.policyFor(ctx).quota
+		if quota == nil {
+			return next(ctx, request)
+		}
+
+		client := clientID(ctx)
+		window, limit, err := quota.begin(client)
+		var qerr *quotaError
+		if errors.As(err, &qerr) {
+			s.logger.LogWarnf("Rejected %s call of client %q: %v", request.Params.Name, client, err)
+			result := mcp.NewToolResultError(qerr.message)
+			result.Meta = map[string]interface{}{
+				"quotaExceeded":     qerr.limit,
+				"retryAfterSeconds": int(qerr.retryAfter.Round(time.Second).Seconds()),
+			}
+			return result, nil
+		}
+
+		if limit > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeoutCause(ctx, limit, errExecutionQuota)
+			defer cancel()
+		}
+		start := time.Now()
+		result, err := next(ctx, request)
+		quota.end(client, window, time.Since(start))
+
+		if result != nil && errors.Is(context.Cause(ctx), errExecutionQuota) {
+			result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf(
+				"Stopped: quota exceeded: %d seconds of execution time per %s",
+				quota.config.MaxExecutionSeconds, formatWindow(quota.window))))
+			if result.Meta == nil {
+				result.Meta = map[string]interface{}{}
+			}
+			result.Meta["quotaExceeded"] = "maxExecutionSeconds"
+		}
+		return result, err
+	}
+}
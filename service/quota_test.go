@@ -0,0 +1,101 @@
+package service_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/service"
+)
+
+// callTool calls a tool over the HTTP transport and returns the text, error flag and
+// metadata of its result.
+func callTool(t *testing.T, ts *httptest.Server, sessionID string, id int, name, arguments string) (string, bool, map[string]interface{}) {
+	t.Helper()
+	resp := postMessage(t, ts, sessionID, "application/json", fmt.Sprintf(
+		`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":%q,"arguments":%s}}`, id, name, arguments))
+	body, _ := io.ReadAll(resp.Body)
+	var response struct {
+		Result struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+			IsError bool                   `json:"isError"`
+			Meta    map[string]interface{} `json:"_meta"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("Invalid response %s: %v", body, err)
+	}
+	var texts []string
+	for _, content := range response.Result.Content {
+		texts = append(texts, content.Text)
+	}
+	return strings.Join(texts, "\n"), response.Result.IsError, response.Result.Meta
+}
+
+func TestQuota(t *testing.T) {
+	newQuotaServer := func(t *testing.T, quota *config.QuotaConfig) *httptest.Server {
+		t.Helper()
+		cfg := &config.ShellCommandConfig{
+			AllowedDirectories:  []string{t.TempDir()},
+			AllowCommands:       []config.AllowCommand{{Command: "echo"}, {Command: "sleep"}},
+			DefaultErrorMessage: "Command not allowed",
+			MaxExecutionTime:    10,
+			Quota:               quota,
+		}
+		srv, err := service.NewServer(cfg, 0, "")
+		if err != nil {
+			t.Fatalf("Failed to create server: %v", err)
+		}
+		ts := httptest.NewServer(srv.Handler())
+		t.Cleanup(ts.Close)
+		return ts
+	}
+
+	t.Run("tool calls", func(t *testing.T) {
+		ts := newQuotaServer(t, &config.QuotaConfig{MaxCalls: 2})
+		sessionID := initializeSession(t, ts)
+
+		for i := range 2 {
+			if text, isError, _ := callTool(t, ts, sessionID, i+2, "run", `{"commands":["echo hi"]}`); isError {
+				t.Fatalf("call %d: unexpected error: %s", i, text)
+			}
+		}
+		text, isError, meta := callTool(t, ts, sessionID, 4, "pwd", `{}`)
+		if !isError || !strings.Contains(text, "quota exceeded: 2 tool calls per 1h, try again in ") {
+			t.Fatalf("third call = %q (isError %t), want quota error", text, isError)
+		}
+		if meta["quotaExceeded"] != "maxCalls" || meta["retryAfterSeconds"] == nil {
+			t.Errorf("metadata = %v, want quotaExceeded maxCalls and retryAfterSeconds", meta)
+		}
+
+		// Clients are counted separately
+		other := initializeSession(t, ts)
+		if text, isError, _ := callTool(t, ts, other, 2, "get_policy", `{}`); isError {
+			t.Fatalf("other client: unexpected error: %s", text)
+		}
+	})
+
+	t.Run("execution time", func(t *testing.T) {
+		ts := newQuotaServer(t, &config.QuotaConfig{MaxExecutionSeconds: 1, Window: 60})
+		sessionID := initializeSession(t, ts)
+
+		text, _, meta := callTool(t, ts, sessionID, 2, "run", `{"commands":["sleep 5"]}`)
+		if !strings.Contains(text, "Stopped: quota exceeded: 1 seconds of execution time per 1m") {
+			t.Fatalf("long call = %q, want it stopped by the quota", text)
+		}
+		if meta["quotaExceeded"] != "maxExecutionSeconds" {
+			t.Errorf("metadata = %v, want quotaExceeded maxExecutionSeconds", meta)
+		}
+
+		text, isError, _ := callTool(t, ts, sessionID, 3, "run", `{"commands":["echo hi"]}`)
+		if !isError || !strings.Contains(text, "quota exceeded: 1 seconds of execution time per 1m") {
+			t.Fatalf("next call = %q (isError %t), want quota error", text, isError)
+		}
+	})
+}
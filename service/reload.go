@@ -0,0 +1,203 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/logger"
+	"github.com/shimizu1995/secure-shell-server/pkg/runner"
+)
+
+// ReloadPath is the path of the reload endpoint, where admins make the server re-read its
+// configuration file.
+const ReloadPath = "/admin/reload"
+
+// errNoConfigPath is returned by ReloadConfigFile when the server has no configuration file.
+var errNoConfigPath = errors.New("the server has no configuration file to reload")
+
+// policySet holds the policies of one configuration. Reload replaces it as a whole, so a
+// call uses either the old or the new policies, never a mix.
+type policySet struct {
+	config *config.ShellCommandConfig
+	// base applies to clients without a profile
+	base *policy
+	// clients are the policies of the clients mapped to a profile, by client name
+	clients map[string]*policy
+	// profiles are the policies of clients by the name of their profile
+	profiles map[string]*policy
+}
+
+// newPolicySet creates the policies of cfg, with runners configured by runnerOpts. The
+// policies that replace those of previous, which may be nil, take over their background
+// jobs, the executions counted against their rate limits and, when their quota is
+// unchanged, the usage counted against it.
+func newPolicySet(cfg *config.ShellCommandConfig, log *logger.Logger, runnerOpts []runner.Option, previous *policySet) (*policySet, error) {
+	set := &policySet{
+		config:   cfg,
+		base:     newPolicy(cfg, log, runnerOpts),
+		clients:  make(map[string]*policy, len(cfg.ClientProfiles)),
+		profiles: make(map[string]*policy),
+	}
+	if err := set.base.checkWorkingDir(); err != nil {
+		return nil, err
+	}
+	// Clients mapped to the same profile share its policy
+	for client, name := range cfg.ClientProfiles {
+		if set.profiles[name] == nil {
+			profileCfg, err := cfg.GetProfile(name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid profile of client %q: %w", client, err)
+			}
+			set.profiles[name] = newPolicy(profileCfg, log, runnerOpts)
+			if err := set.profiles[name].checkWorkingDir(); err != nil {
+				return nil, fmt.Errorf("invalid profile %q: %w", name, err)
+			}
+		}
+		set.clients[client] = set.profiles[name]
+	}
+
+	if previous != nil {
+		set.base.takeOver(previous.base)
+		for name, p := range set.profiles {
+			if old := previous.profiles[name]; old != nil {
+				p.takeOver(old)
+			}
+		}
+	}
+	return set, nil
+}
+
+// checkWorkingDir returns an error when the WorkingDir of p's configuration is not an
+// absolute path that p allows as a working directory.
+func (p *policy) checkWorkingDir() error {
+	dir := p.config.WorkingDir
+	if dir == "" {
+		return nil
+	}
+	if !filepath.IsAbs(dir) {
+		return fmt.Errorf("workingDir %q is not an absolute path", dir)
+	}
+	if result := p.validator.ValidateDirectory(dir); !result.Allowed {
+		return fmt.Errorf("workingDir %q: %s", dir, result.Message)
+	}
+	return nil
+}
+
+// policies returns every policy of the set.
+func (set *policySet) policies() []*policy {
+	policies := []*policy{set.base}
+	for _, p := range set.profiles {
+		policies = append(policies, p)
+	}
+	return policies
+}
+
+// takeOver makes p keep the background jobs of old, running later jobs with p's runner,
+// the rate limit usage of old, so a reload cannot reset it, and the quota usage of old when
+// their quotas are the same.
+func (p *policy) takeOver(old *policy) {
+	old.jobs.SetRunner(p.runner)
+	p.jobs = old.jobs
+	p.validator.TakeOverRateLimits(old.validator)
+	if p.quota != nil && old.quota != nil && p.quota.config == old.quota.config {
+		p.quota = old.quota
+	}
+}
+
+// SetConfigPath sets the configuration file ReloadConfigFile reads.
+func (s *Server) SetConfigPath(path string) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.configPath = path
+}
+
+// Reload replaces the policies of the server with those of cfg. Calls that already started
+// finish with the policies they started with. An invalid cfg is rejected, leaving the
+// policies unchanged. The transports, authentication and logging keep the configuration the
+// server was created with.
+func (s *Server) Reload(cfg *config.ShellCommandConfig) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	return s.reload(cfg)
+}
+
+// reload is Reload with s.reloadMu held.
+func (s *Server) reload(cfg *config.ShellCommandConfig) error {
+	set, err := newPolicySet(cfg, s.logger, s.runnerOptions, s.policies.Load())
+	if err != nil {
+		return err
+	}
+	s.observeRuns(set)
+	s.policies.Store(set)
+	return nil
+}
+
+// ReloadConfigFile re-reads the configuration file set with SetConfigPath and reloads the
+// policies from it. A file that cannot be read or decoded is rejected, leaving the policies
+// unchanged.
+func (s *Server) ReloadConfigFile() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	if s.configPath == "" {
+		return errNoConfigPath
+	}
+
+	cfg, err := config.LoadConfigFromFile(s.configPath)
+	if err == nil {
+		err = s.reload(cfg)
+	}
+	if err != nil {
+		s.logger.LogErrorf("Rejected reload of %s, keeping the current policy: %v", s.configPath, err)
+		return err
+	}
+	s.logger.LogInfof("Reloaded the policy from %s", s.configPath)
+	return nil
+}
+
+// ReloadOnHangup reloads the configuration file whenever the process receives SIGHUP,
+// until the returned function is called.
+func (s *Server) ReloadOnHangup() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-signals:
+				// Failures are logged, and the server keeps running with its current policy
+				_ = s.ReloadConfigFile()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// registerReloadRoute adds the reload endpoint to mux: POST ReloadPath reloads the
+// configuration file and responds with the time of the reload, or with 422 Unprocessable
+// Entity and the reason when the file is rejected.
+func (s *Server) registerReloadRoute(mux *http.ServeMux) {
+	mux.HandleFunc("POST "+ReloadPath, func(w http.ResponseWriter, r *http.Request) {
+		err := s.ReloadConfigFile()
+		switch {
+		case errors.Is(err, errNoConfigPath):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			s.logger.LogInfof("Reload requested by %s", clientName(r.Context()))
+			writeJSONResponse(w, http.StatusOK, map[string]any{"reloadedAt": time.Now()})
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package service_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/service"
+)
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	writeConfig := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+	policyAllowing := func(command string) string {
+		return fmt.Sprintf(`{"allowedDirectories": [%q], "allowCommands": [%q], "denyCommands": [],`+
+			` "defaultErrorMessage": "Command not allowed", "adminTokens": [{"token": "secret-admin", "client": "alice"}]}`, dir, command)
+	}
+
+	writeConfig(policyAllowing("echo"))
+	cfg, err := config.LoadConfigFromFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	srv, err := service.NewServer(cfg, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	ctx := t.Context()
+
+	reload := func(token string) int {
+		t.Helper()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, ts.URL+service.ReloadPath, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	run := func(command string) bool {
+		t.Helper()
+		result, err := srv.HandleRunCommand(ctx, makeToolRequest(map[string]interface{}{"commands": []interface{}{command}}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return !result.IsError
+	}
+
+	if status := reload("secret-admin"); status != http.StatusConflict {
+		t.Errorf("reload without a config path: status = %d, want 409", status)
+	}
+	srv.SetConfigPath(configPath)
+
+	writeConfig(policyAllowing("pwd"))
+	if status := reload(""); status != http.StatusUnauthorized {
+		t.Errorf("reload without token: status = %d, want 401", status)
+	}
+	if !run("echo before") {
+		t.Error("echo blocked before the reload")
+	}
+	if status := reload("secret-admin"); status != http.StatusOK {
+		t.Fatalf("reload: status = %d, want 200", status)
+	}
+	if run("echo after") {
+		t.Error("echo still allowed after the reload")
+	}
+	if !run("pwd") {
+		t.Error("pwd blocked after the reload")
+	}
+
+	// A broken file is rejected, keeping the policy
+	writeConfig(`{"allowCommands": [`)
+	if status := reload("secret-admin"); status != http.StatusUnprocessableEntity {
+		t.Errorf("reload of a broken file: status = %d, want 422", status)
+	}
+	if !run("pwd") {
+		t.Error("pwd blocked after a rejected reload")
+	}
+
+	// So is a configuration mapping clients to missing profiles
+	err = srv.Reload(&config.ShellCommandConfig{ClientProfiles: map[string]string{"ci": "missing"}})
+	if err == nil {
+		t.Error("Reload with a missing profile succeeded")
+	}
+	if !run("pwd") {
+		t.Error("pwd blocked after a rejected reload")
+	}
+}
+
+func TestReloadKeepsRateLimits(t *testing.T) {
+	dir := t.TempDir()
+	configJSON := fmt.Sprintf(`{"allowedDirectories": [%q], "denyCommands": [],
+		"allowCommands": [{"command": "echo", "rateLimit": {"count": 1, "per": "1h"}}]}`, dir)
+	newConfig := func() *config.ShellCommandConfig {
+		t.Helper()
+		var cfg config.ShellCommandConfig
+		if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+			t.Fatalf("Failed to unmarshal config: %v", err)
+		}
+		return &cfg
+	}
+	srv, err := service.NewServer(newConfig(), 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	run := func(command string) bool {
+		t.Helper()
+		result, err := srv.HandleRunCommand(t.Context(), makeToolRequest(map[string]interface{}{"commands": []interface{}{command}}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return !result.IsError
+	}
+
+	if !run("echo first") {
+		t.Fatal("echo blocked before reaching its rate limit")
+	}
+	if run("echo second") {
+		t.Fatal("echo allowed beyond its rate limit")
+	}
+	if err := srv.Reload(newConfig()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if run("echo third") {
+		t.Error("echo allowed after a reload reset its rate limit")
+	}
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Resource URIs of the server.
+const (
+	// policyResourceURI is the effective policy of the client, as returned by get_policy.
+	policyResourceURI = "policy://current"
+	// auditResourceURI lists the audit records of the client's most recent runs.
+	auditResourceURI = "audit://recent"
+)
+
+// registerResources registers the server's resources with the MCP server.
+func (s *Server) registerResources() {
+	s.mcpServer.AddResource(mcp.NewResource(policyResourceURI, "Current policy",
+		mcp.WithResourceDescription("Allowed and denied commands, allowed directories and limits in effect."),
+		mcp.WithMIMEType("application/json"),
+	), s.HandlePolicyResource)
+	s.mcpServer.AddResource(mcp.NewResource(auditResourceURI, "Recent runs",
+		mcp.WithResourceDescription("Audit records of the most recent runs: script, commands, exit code and output sizes."),
+		mcp.WithMIMEType("application/json"),
+	), s.HandleAuditResource)
+}
+
+// HandlePolicyResource reads the policy://current resource.
+func (s *Server) HandlePolicyResource(ctx context.Context, _ mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	return jsonResource(policyResourceURI, newPolicyView(s.policyFor(ctx).config))
+}
+
+// HandleAuditResource reads the audit://recent resource. Clients only see their own runs.
+func (s *Server) HandleAuditResource(ctx context.Context, _ mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	return jsonResource(auditResourceURI, s.policyFor(ctx).runner.RecentRuns(clientID(ctx)))
+}
+
+// jsonResource returns the contents of the resource uri, v encoded as indented JSON.
+func jsonResource(uri string, v any) ([]mcp.ResourceContents, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{mcp.TextResourceContents{URI: uri, MIMEType: "application/json", Text: string(data)}}, nil
+}
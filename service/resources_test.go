@@ -0,0 +1,81 @@
+package service_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestResources(t *testing.T) {
+	srv, tmpDir := newTestServer(t)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	sessionID := initializeSession(t, ts)
+
+	// readResource reads uri over the session and returns its text
+	readResource := func(uri string) string {
+		resp := postMessage(t, ts, sessionID, "application/json",
+			`{"jsonrpc":"2.0","id":2,"method":"resources/read","params":{"uri":"`+uri+`"}}`)
+		var msg struct {
+			Result struct {
+				Contents []mcp.TextResourceContents `json:"contents"`
+			} `json:"result"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil || len(msg.Result.Contents) != 1 {
+			t.Fatalf("Failed to read %s: %v", uri, err)
+		}
+		if got := msg.Result.Contents[0].MIMEType; got != "application/json" {
+			t.Errorf("%s MIME type = %q, want application/json", uri, got)
+		}
+		return msg.Result.Contents[0].Text
+	}
+
+	resp := postMessage(t, ts, sessionID, "application/json", `{"jsonrpc":"2.0","id":1,"method":"resources/list"}`)
+	var list struct {
+		Result struct {
+			Resources []mcp.Resource `json:"resources"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to list resources: %v", err)
+	}
+	uris := make([]string, len(list.Result.Resources))
+	for i, r := range list.Result.Resources {
+		uris[i] = r.URI
+	}
+	if got := strings.Join(uris, ","); !strings.Contains(got, "policy://current") || !strings.Contains(got, "audit://recent") {
+		t.Errorf("resources = %s, want policy://current and audit://recent", got)
+	}
+
+	var policy struct {
+		AllowedDirectories []string `json:"allowedDirectories"`
+	}
+	if err := json.Unmarshal([]byte(readResource("policy://current")), &policy); err != nil {
+		t.Fatalf("policy://current is not JSON: %v", err)
+	}
+	if len(policy.AllowedDirectories) != 1 || policy.AllowedDirectories[0] != tmpDir {
+		t.Errorf("policy://current allowedDirectories = %v, want [%s]", policy.AllowedDirectories, tmpDir)
+	}
+
+	// Runs of the session are listed; runs of other clients are not
+	if _, err := srv.HandleRunCommand(t.Context(), makeToolRequest(map[string]interface{}{
+		"commands": []interface{}{"echo not-mine"},
+	})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	postMessage(t, ts, sessionID, "application/json",
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"run","arguments":{"commands":["echo mine"]}}}`)
+	var runs []struct {
+		Script   string `json:"script"`
+		ExitCode int    `json:"exitCode"`
+	}
+	if err := json.Unmarshal([]byte(readResource("audit://recent")), &runs); err != nil {
+		t.Fatalf("audit://recent is not JSON: %v", err)
+	}
+	if len(runs) != 1 || runs[0].Script != "echo mine" || runs[0].ExitCode != 0 {
+		t.Errorf("audit://recent = %+v, want the session's run only", runs)
+	}
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// createRunScriptTool creates the run_script tool for running a multi-line script with
+// positional arguments.
+func createRunScriptTool() mcp.Tool {
+	return mcp.NewTool("run_script",
+		mcp.WithDescription("Run a multi-line shell script with arguments bound to $1..$n. "+
+			"Every command is checked before any runs. Pass values as args instead of building commands from strings. "+
+			"cd does not persist."),
+		mcp.WithString("script",
+			mcp.Required(),
+			mcp.Description("Script to run. Refer to the arguments as \"$1\", \"$2\" or \"$@\"."),
+		),
+		mcp.WithArray("args",
+			mcp.Description("Positional arguments of the script."),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithObject("env",
+			mcp.Description("Environment variables to set, added to the server's environment."),
+			mcp.AdditionalProperties(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithBoolean("stream",
+			mcp.Description("Send output as log notifications while the script runs."),
+		),
+		mcp.WithBoolean("separate_streams",
+			mcp.Description("Show stdout and stderr under separate headings instead of interleaved."),
+		),
+		mcp.WithBoolean("stop_on_error",
+			mcp.Description("Stop the script at its first failing command, like set -e, instead of continuing with the next one."),
+		),
+		mcp.WithNumber("timeout_seconds",
+			mcp.Description("Time limit of the script in seconds, up to the server's maximum (default: the server's maxExecutionTime)."),
+		),
+		mcp.WithString("stdin",
+			mcp.Description("Text fed to the standard input of the script."),
+		),
+		mcp.WithNumber("max_output",
+			mcp.Description("Maximum bytes of stdout and of stderr to return, below the server's limit (default: the server's maxOutputSize)."),
+		),
+	)
+}
+
+// HandleRunScript handles the run_script tool execution. The whole script is validated
+// before it runs, so a script with a blocked command has no effect.
+func (s *Server) HandleRunScript(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	script, ok := request.Params.Arguments["script"].(string)
+	if !ok || script == "" {
+		return mcp.NewToolResultError("script parameter must be a non-empty string"), nil
+	}
+
+	opts := runOptions{validate: true}
+	var err error
+	if opts.args, err = parseArgs(request.Params.Arguments["args"]); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if opts.env, err = parseEnv(request.Params.Arguments["env"], s.policyFor(ctx).runner.BaseEnv()); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if opts.timeout, err = timeoutArgument(request.Params.Arguments); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if opts.stdin, err = stdinArgument(request.Params.Arguments); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if opts.maxOutput, err = intArgument(request.Params.Arguments, "max_output"); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	opts.stream, _ = request.Params.Arguments["stream"].(bool)
+	opts.separateStreams, _ = request.Params.Arguments["separate_streams"].(bool)
+	opts.stopOnError, _ = request.Params.Arguments["stop_on_error"].(bool)
+
+	workingDir, ok := s.currentWorkingDir(ctx)
+	if !ok {
+		return mcp.NewToolResultError(noWorkingDirMessage), nil
+	}
+
+	// Scripts that need a human's approval are queued instead of run
+	req := opts.request(ctx, script, workingDir)
+	if check, ok := needsApproval(ctx, s.policyFor(ctx), req); ok {
+		return s.queueForApproval(s.policyFor(ctx), req, check), nil
+	}
+
+	opts.progress = s.startProgress(ctx, progressToken(request))
+	r := s.executeOne(ctx, script, workingDir, opts)
+	opts.progress.stop()
+	result := formatResultsWithHints([]commandResult{r}, r.hints, opts.separateStreams)
+	result.Meta["workingDir"] = workingDir
+	reportDeniedEnv(result, deniedEnv(request.Params.Arguments["env"], s.policyFor(ctx).config.EnvPolicy))
+	return result, nil
+}
+
+// parseArgs extracts the optional args array of strings from the request arguments.
+func parseArgs(raw interface{}) ([]string, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	arr, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("args parameter must be an array of strings")
+	}
+	args := make([]string, len(arr))
+	for i, v := range arr {
+		if args[i], ok = v.(string); !ok {
+			return nil, fmt.Errorf("args[%d] must be a string", i)
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,70 @@
+package service_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunScript(t *testing.T) {
+	srv, tmpDir := newTestServer(t)
+	ctx := t.Context()
+
+	t.Run("args are bound to positional parameters", func(t *testing.T) {
+		result, err := srv.HandleRunScript(ctx, makeToolRequest(map[string]interface{}{
+			"script": "echo \"first=$1\"\necho \"second=$2 count=$#\"",
+			"args":   []interface{}{"a b", "c"},
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, "first=a b")
+		assertToolSuccess(t, result, "second=c count=2")
+	})
+
+	t.Run("args are not parsed as code", func(t *testing.T) {
+		result, err := srv.HandleRunScript(ctx, makeToolRequest(map[string]interface{}{
+			"script": "echo \"$1\"",
+			"args":   []interface{}{"; rm -rf /"},
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, "; rm -rf /")
+	})
+
+	t.Run("blocked command anywhere prevents the whole script", func(t *testing.T) {
+		result, err := srv.HandleRunScript(ctx, makeToolRequest(map[string]interface{}{
+			"script": "echo first > first.txt\nrm \"$1\"",
+			"args":   []interface{}{"x"},
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolError(t, result, "command validation failed")
+		if _, err := os.Stat(filepath.Join(tmpDir, "first.txt")); !os.IsNotExist(err) {
+			t.Errorf("blocked script ran its first line (stat error: %v)", err)
+		}
+	})
+
+	t.Run("invalid args", func(t *testing.T) {
+		for _, args := range []interface{}{"a", []interface{}{1.0}} {
+			result, err := srv.HandleRunScript(ctx, makeToolRequest(map[string]interface{}{
+				"script": "echo \"$1\"",
+				"args":   args,
+			}))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertToolError(t, result, "args")
+		}
+	})
+
+	t.Run("empty script fails", func(t *testing.T) {
+		result, err := srv.HandleRunScript(ctx, makeToolRequest(map[string]interface{}{"script": ""}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolError(t, result, "non-empty string")
+	})
+}
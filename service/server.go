@@ -2,13 +2,19 @@ package service
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
@@ -16,9 +22,12 @@ import (
 
 	"github.com/shimizu1995/secure-shell-server/pkg/config"
 	"github.com/shimizu1995/secure-shell-server/pkg/hint"
+	"github.com/shimizu1995/secure-shell-server/pkg/history"
+	"github.com/shimizu1995/secure-shell-server/pkg/job"
 	"github.com/shimizu1995/secure-shell-server/pkg/logger"
 	"github.com/shimizu1995/secure-shell-server/pkg/runner"
 	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+	"github.com/shimizu1995/secure-shell-server/pkg/version"
 )
 
 // createRunTool creates the run tool for executing shell commands.
@@ -36,6 +45,34 @@ func createRunTool() mcp.Tool {
 		mcp.WithString("mode",
 			mcp.Description("\"parallel\" (default) or \"serial\" (stops on first error)."),
 		),
+		mcp.WithString("directory",
+			mcp.Description("Directory to run in, absolute or relative to the session's working directory (default: the session's working directory)."),
+		),
+		mcp.WithNumber("timeout_seconds",
+			mcp.Description("Time limit of each command in seconds, up to the server's maximum (default: the server's maxExecutionTime)."),
+		),
+		mcp.WithString("stdin",
+			mcp.Description("Text fed to the standard input of each command."),
+		),
+		mcp.WithNumber("max_output",
+			mcp.Description("Maximum bytes of stdout and of stderr to return, below the server's limit (default: the server's maxOutputSize)."),
+		),
+		mcp.WithObject("env",
+			mcp.Description("Environment variables to set, added to the server's environment."),
+			mcp.AdditionalProperties(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithBoolean("stream",
+			mcp.Description("Send output as log notifications while commands run."),
+		),
+		mcp.WithBoolean("separate_streams",
+			mcp.Description("Show stdout and stderr under separate headings instead of interleaved."),
+		),
+		mcp.WithBoolean("preflight",
+			mcp.Description("Validate every command of each script before any of it runs, so a script with a blocked command has no effect."),
+		),
+		mcp.WithBoolean("stop_on_error",
+			mcp.Description("Stop each script at its first failing command, like set -e, instead of continuing with the next one."),
+		),
 	)
 }
 
@@ -46,62 +83,195 @@ func createPwdTool() mcp.Tool {
 	)
 }
 
+// createSetWorkingDirectoryTool creates the set_working_directory tool for changing the
+// session's working directory without running a command.
+func createSetWorkingDirectoryTool() mcp.Tool {
+	return mcp.NewTool("set_working_directory",
+		mcp.WithDescription("Set the working directory of later calls in this session."),
+		mcp.WithString("directory",
+			mcp.Required(),
+			mcp.Description("Directory to change to, absolute or relative to the current working directory."),
+		),
+	)
+}
+
+// runOptions holds the per-call parameters of the run tool that apply to every command.
+type runOptions struct {
+	env    []string // environment to run with, nil for the server's environment
+	stream bool     // send output as log notifications while it is produced
+	args   []string // positional parameters of the script, $1 onwards
+	// validate checks every command of the script before any of it runs
+	validate bool
+	// stopOnError stops a script at its first failing command
+	stopOnError bool
+	// progress receives the output of every command, nil without progress notifications
+	progress *progress
+	// timeout is the time limit of each command, zero for the server's MaxExecutionTime
+	timeout time.Duration
+	// stdin is fed to the standard input of each command
+	stdin string
+	// maxOutput limits the stdout and stderr of each command, zero for the server's limits
+	maxOutput int
+	// separateStreams shows stdout and stderr apart in the text of the result
+	separateStreams bool
+}
+
+// request returns the runner request of command with the options of o, without outputs.
+func (o runOptions) request(ctx context.Context, command, workingDir string) runner.Request {
+	req := runner.Request{
+		Client: clientID(ctx), Command: command, WorkingDir: workingDir, Env: o.env,
+		Args: o.args, Timeout: o.timeout, MaxOutputSize: o.maxOutput, Preflight: o.validate,
+		StopOnError: o.stopOnError,
+	}
+	if o.stdin != "" {
+		req.Stdin = strings.NewReader(o.stdin)
+	}
+	return req
+}
+
 // Execution mode constants.
 const (
 	modeParallel = "parallel"
 	modeSerial   = "serial"
 )
 
-// Server is the MCP server for secure shell execution.
-type Server struct {
+// policy enforces one policy of the server: the top-level configuration or a profile.
+type policy struct {
 	config    *config.ShellCommandConfig
 	validator *validator.CommandValidator
 	runner    *runner.SafeRunner
+	jobs      *job.Manager
+	// quota limits the tool calls of each client, nil without limits
+	quota *quotaTracker
+}
+
+// newPolicy creates the validator, runner and job manager of cfg. The runner is configured
+// by runnerOpts after the validator and log.
+func newPolicy(cfg *config.ShellCommandConfig, log *logger.Logger, runnerOpts []runner.Option) *policy {
+	v := validator.New(cfg, log)
+	opts := append([]runner.Option{runner.WithLogger(log), runner.WithValidator(v)}, runnerOpts...)
+	r := runner.NewWithOptions(cfg, opts...)
+	return &policy{config: cfg, validator: v, runner: r, jobs: job.NewManager(r), quota: newQuotaTracker(cfg.Quota)}
+}
+
+// policyFor returns the policy of the client of ctx: its profile's, or the server's
+// top-level policy for clients without one.
+func (s *Server) policyFor(ctx context.Context) *policy {
+	set := s.policies.Load()
+	if p, ok := set.clients[clientName(ctx)]; ok {
+		return p
+	}
+	return set.base
+}
+
+// Server is the MCP server for secure shell execution.
+type Server struct {
+	config    *config.ShellCommandConfig
 	logger    *logger.Logger
 	mcpServer *server.MCPServer
 	port      int
-	// Mutex to protect shared resources (config, runner, validator) during command execution
-	cmdMutex sync.Mutex
-	// workingDir holds the session's current working directory. Empty means not yet set.
-	workingDir string
+	// policies are the policies of the current configuration, replaced by Reload
+	policies atomic.Pointer[policySet]
+	// reloadMu serializes reloads and guards configPath
+	reloadMu sync.Mutex
+	// configPath is the configuration file ReloadConfigFile reads, "" for none
+	configPath string
+	// runnerOptions are applied to the runner of every policy
+	runnerOptions []runner.Option
+	// oidc validates JWT bearer tokens on the HTTP transport, nil without OIDC configured
+	oidc *oidcVerifier
+	// mu guards workingDirs. Tool calls do not hold it while commands run, so they run in
+	// parallel, each with its own output buffers.
+	mu sync.Mutex
+	// defaultWorkingDir is the working directory of sessions that have not changed theirs.
+	// Empty means not set.
+	defaultWorkingDir string
+	// workingDirs holds the current working directory of each MCP session, by session ID
+	workingDirs map[string]string
+	// approvals holds the calls waiting for or decided by a human's approval
+	approvals *approvalQueue
+	// history records every execution, nil without a history configured
+	history *history.Store
 }
 
 // NewServer creates a new MCP server instance.
 func NewServer(cfg *config.ShellCommandConfig, port int, logPath string) (*Server, error) {
+	return NewServerWithOptions(cfg, WithPort(port), WithLogPath(logPath))
+}
+
+// NewServerWithOptions creates a new MCP server instance enforcing cfg, configured by opts.
+func NewServerWithOptions(cfg *config.ShellCommandConfig, opts ...ServerOption) (*Server, error) {
+	var o serverOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	// Create logger with optional path
-	loggerObj, err := logger.NewWithPath(logPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create logger: %w", err)
+	loggerObj := o.logger
+	if loggerObj == nil {
+		var err error
+		loggerObj, err = logger.Open(logger.Options{
+			Target:   cfg.LogTarget,
+			Path:     o.logPath,
+			Rotation: logger.Rotation(cfg.GetLogRotation()),
+			Syslog:   logger.SyslogOptions(cfg.GetSyslog()),
+			Format:   cfg.LogFormat,
+			Level:    cfg.LogLevel,
+			Sinks:    logSinks(cfg.LogSinks),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create logger: %w", err)
+		}
 	}
 
-	validatorObj := validator.New(cfg, loggerObj)
-	runnerObj := runner.New(cfg, validatorObj, loggerObj)
+	loggerObj.LogInfof("%s %s", Name, version.Get())
 
-	mcpServer := server.NewMCPServer(
-		"Secure Shell Server",
-		"1.0.0",
+	s := &Server{
+		config:        cfg,
+		logger:        loggerObj,
+		port:          o.port,
+		configPath:    o.configPath,
+		runnerOptions: o.runnerOptions,
+
+		workingDirs: make(map[string]string),
+		approvals:   newApprovalQueue(),
+	}
+	s.mcpServer = server.NewMCPServer(
+		Name,
+		version.Get().Version,
 		server.WithLogging(),
 		server.WithRecovery(),
+		server.WithToolHandlerMiddleware(s.quotaMiddleware),
+		server.WithResourceCapabilities(false, false),
 	)
 
-	s := &Server{
-		config:    cfg,
-		validator: validatorObj,
-		runner:    runnerObj,
-		logger:    loggerObj,
-		mcpServer: mcpServer,
-		port:      port,
+	policies, err := newPolicySet(cfg, loggerObj, s.runnerOptions, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.policies.Store(policies)
+
+	if cfg.History != nil {
+		if err := s.openHistory(*cfg.History); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.OIDC != nil {
+		if s.oidc, err = newOIDCVerifier(*cfg.OIDC); err != nil {
+			return nil, err
+		}
 	}
 
 	// Initialize working directory from PWD environment variable if configured
-	if cfg.UseEnvPwd {
+	if cfg.UseEnvPwd && cfg.WorkingDir == "" {
 		if pwd := os.Getenv("PWD"); pwd != "" {
 			absDir, err := filepath.Abs(pwd)
 			if err == nil {
-				if allowed, _ := validatorObj.IsDirectoryAllowed(absDir); allowed {
+				if allowed, _ := policies.base.validator.IsDirectoryAllowed(absDir); allowed {
 					info, statErr := os.Stat(absDir)
 					if statErr == nil && info.IsDir() {
-						s.workingDir = absDir
+						s.defaultWorkingDir = absDir
 						loggerObj.LogInfof("Default working directory set from PWD: %s", absDir)
 					}
 				}
@@ -112,49 +282,195 @@ func NewServer(cfg *config.ShellCommandConfig, port int, logPath string) (*Serve
 	return s, nil
 }
 
-// Start initializes and starts the MCP server.
-func (s *Server) Start() error {
-	// Register tools
+// logSinks converts the configured log sinks for logger.Open.
+func logSinks(sinks []config.LogSink) []logger.Sink {
+	converted := make([]logger.Sink, len(sinks))
+	for i, sink := range sinks {
+		converted[i] = logger.Sink(sink)
+	}
+	return converted
+}
+
+// registerTools registers the server's tools, resources and prompts with the MCP server.
+func (s *Server) registerTools() {
 	s.mcpServer.AddTool(createRunTool(), s.HandleRunCommand)
 	s.mcpServer.AddTool(createPwdTool(), s.HandlePwd)
+	s.mcpServer.AddTool(createSetWorkingDirectoryTool(), s.HandleSetWorkingDirectory)
+	s.mcpServer.AddTool(createRunScriptTool(), s.HandleRunScript)
+	s.mcpServer.AddTool(createValidateCommandTool(), s.HandleValidateCommand)
+	s.mcpServer.AddTool(createGetPolicyTool(), s.HandleGetPolicy)
+	s.mcpServer.AddTool(createServerInfoTool(), s.HandleServerInfo)
+	s.mcpServer.AddTool(createReadFileTool(), s.HandleReadFile)
+	s.mcpServer.AddTool(createWriteFileTool(), s.HandleWriteFile)
+	s.mcpServer.AddTool(createListDirectoryTool(), s.HandleListDirectory)
+	s.mcpServer.AddTool(createStartJobTool(), s.HandleStartJob)
+	s.mcpServer.AddTool(createJobStatusTool(), s.HandleJobStatus)
+	s.mcpServer.AddTool(createJobOutputTool(), s.HandleJobOutput)
+	s.mcpServer.AddTool(createKillJobTool(), s.HandleKillJob)
+	s.mcpServer.AddTool(createApprovalStatusTool(), s.HandleApprovalStatus)
+	if s.history != nil {
+		s.mcpServer.AddTool(createQueryHistoryTool(), s.HandleQueryHistory)
+	}
+	s.registerResources()
+	s.registerPrompts()
+}
 
-	// Start the server
-	address := fmt.Sprintf(":%d", s.port)
-	s.logger.LogInfof("Starting MCP server on %s", address)
+// HTTPPath is the path of the MCP endpoint served by Start.
+const HTTPPath = "/mcp"
 
-	// Create HTTP server to serve the MCP server
-	handler := http.NewServeMux()
-	handler.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-		// TODO: Implement proper HTTP handler for MCP
-		_, err := w.Write([]byte("MCP server running"))
-		if err != nil {
-			s.logger.LogErrorf("Failed to write response: %v", err)
-		}
-	}))
+// Handler returns an http.Handler that serves the MCP server over the Streamable HTTP
+// transport at HTTPPath. Each client gets its own session, identified by the
+// Mcp-Session-Id header. With AuthTokens or OIDC configured, every request must carry
+// one of the tokens or a JWT issued by the OIDC provider. With WebSocket configured, it also
+// serves the WebSocket transport at WebSocketPath, and with RESTAPI the REST API at
+// APIRunPath, both with the same authentication. With AdminTokens configured, it also
+// serves the admin endpoints at ApprovalPath, ReloadPath and HistoryPath.
+func (s *Server) Handler() http.Handler {
+	s.registerTools()
+
+	transport := newStreamableHTTP(s.mcpServer, s.logger)
+	transport.onSessionEnd = s.endSession
+	transport.onResponse = s.annotateResponse
+	var handler http.Handler = transport
+	authenticators := s.authenticators()
+	var webSocket http.Handler = http.HandlerFunc(s.serveWebSocket)
+	var api http.Handler = http.HandlerFunc(s.handleAPIRun)
+	if len(authenticators) > 0 {
+		handler = requireAuth(handler, s.logger, authenticators...)
+		webSocket = requireAuth(webSocket, s.logger, authenticators...)
+		api = requireAuth(api, s.logger, authenticators...)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(HTTPPath, handler)
+	if s.config.WebSocket != nil {
+		mux.Handle(WebSocketPath, webSocket)
+	}
+	if s.config.RESTAPI {
+		mux.Handle("POST "+APIRunPath, api)
+	}
+	if len(s.config.AdminTokens) > 0 {
+		s.mountAdmin(mux)
+	}
+	return mux
+}
+
+// authenticators returns the authenticators of the configured AuthTokens and OIDC provider,
+// none when every request is accepted.
+func (s *Server) authenticators() []authenticator {
+	var authenticators []authenticator
+	if len(s.config.AuthTokens) > 0 {
+		authenticators = append(authenticators, tokenAuthenticator(s.config.AuthTokens))
+	}
+	if s.oidc != nil {
+		authenticators = append(authenticators, s.oidc.verify)
+	}
+	return authenticators
+}
 
+// HTTPServer returns the http.Server Start listens with, serving Handler on the server's
+// port. With TLS configured, its TLSConfig holds the certificate and, if a client CA is
+// configured, requires clients to present a certificate signed by it.
+func (s *Server) HTTPServer() (*http.Server, error) {
 	// Timeout constants
 	const (
-		readTimeoutSeconds  = 10
-		writeTimeoutSeconds = 10
+		readTimeoutSeconds = 10
+		idleTimeoutSeconds = 120
 	)
 
-	// Create a server with timeouts
-	server := &http.Server{
-		Addr:         address,
-		Handler:      handler,
-		ReadTimeout:  readTimeoutSeconds * time.Second,
-		WriteTimeout: writeTimeoutSeconds * time.Second,
+	// Create a server with timeouts. Responses are not limited by a write timeout, since
+	// they are streamed for as long as a command runs.
+	httpServer := &http.Server{
+		Addr:              fmt.Sprintf(":%d", s.port),
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: readTimeoutSeconds * time.Second,
+		ReadTimeout:       readTimeoutSeconds * time.Second,
+		IdleTimeout:       idleTimeoutSeconds * time.Second,
 	}
 
-	return server.ListenAndServe()
+	if s.config.TLS != nil {
+		tlsConfig, err := newTLSConfig(*s.config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		httpServer.TLSConfig = tlsConfig
+	}
+	return httpServer, nil
 }
 
-// HandlePwd handles the pwd tool execution.
-func (s *Server) HandlePwd(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	s.cmdMutex.Lock()
-	workingDir := s.workingDir
-	s.cmdMutex.Unlock()
+// newTLSConfig loads the certificate and client CAs of cfg.
+func newTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("TLS requires both a certificate and a key file")
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// Start initializes and starts the MCP server, serving the Streamable HTTP transport and,
+// with GRPC configured, the gRPC transport. It returns when either of them fails.
+func (s *Server) Start() error {
+	httpServer, err := s.HTTPServer()
+	if err != nil {
+		return err
+	}
+	if len(s.config.AuthTokens) == 0 && s.oidc == nil {
+		s.logger.LogWarnf("The HTTP transport accepts unauthenticated requests; configure authTokens or oidc to require a token")
+	}
+
+	listener, err := s.Listen()
+	if err != nil {
+		return err
+	}
 
+	if s.config.GRPC != nil {
+		transports := []func() error{s.StartGRPC, func() error { return s.serveHTTP(httpServer, listener) }}
+		errs := make(chan error, len(transports))
+		for _, serve := range transports {
+			go func() { errs <- serve() }()
+		}
+		return <-errs
+	}
+	return s.serveHTTP(httpServer, listener)
+}
+
+// serveHTTP serves httpServer on listener, with TLS when its TLSConfig is set.
+func (s *Server) serveHTTP(httpServer *http.Server, listener net.Listener) error {
+	if s.config.WebSocket != nil {
+		s.logger.LogInfof("Serving the WebSocket transport on %s%s", listener.Addr(), WebSocketPath)
+	}
+	if httpServer.TLSConfig != nil {
+		s.logger.LogInfof("Starting MCP server on %s%s with TLS", listener.Addr(), HTTPPath)
+		// The certificate is already loaded into TLSConfig
+		return httpServer.ServeTLS(listener, "", "")
+	}
+	s.logger.LogInfof("Starting MCP server on %s%s", listener.Addr(), HTTPPath)
+	return httpServer.Serve(listener)
+}
+
+// HandlePwd handles the pwd tool execution.
+func (s *Server) HandlePwd(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	workingDir := s.sessionWorkingDir(ctx)
 	if workingDir == "" {
 		return mcp.NewToolResultError("No working directory set. Use the cd command via run to set a working directory."), nil
 	}
@@ -162,13 +478,131 @@ func (s *Server) HandlePwd(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallT
 	return mcp.NewToolResultText(workingDir), nil
 }
 
+// HandleSetWorkingDirectory handles the set_working_directory tool execution.
+func (s *Server) HandleSetWorkingDirectory(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dir, ok := request.Params.Arguments["directory"].(string)
+	if !ok || dir == "" {
+		return mcp.NewToolResultError("directory parameter must be a non-empty string"), nil
+	}
+	workingDir, ok := s.currentWorkingDir(ctx)
+	if !ok && !filepath.IsAbs(dir) {
+		return mcp.NewToolResultError(noWorkingDirMessage), nil
+	}
+	dir = resolvePath(workingDir, dir)
+
+	if result := s.policyFor(ctx).validator.ValidateDirectory(dir); !result.Allowed {
+		return mcp.NewToolResultError(result.Message), nil
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return mcp.NewToolResultError(fmt.Sprintf("%s is not a directory", dir)), nil
+	}
+
+	s.setWorkingDir(ctx, dir)
+	s.logger.LogInfof("Working directory set: %s", dir)
+	result := mcp.NewToolResultText(dir)
+	result.Meta = map[string]interface{}{"workingDir": dir}
+	return result, nil
+}
+
 // commandResult holds the output of a single command execution.
 type commandResult struct {
-	command    string
-	output     string
-	err        error
-	newWorkDir string // non-empty if cd changed the working directory
-	hints      []hint.Hint
+	runID   string
+	command string
+	output  string // stdout and stderr combined
+	stdout  string
+	stderr  string
+	// segments tell in which order and when stdout and stderr were written
+	segments []outputSegment
+	// stdoutStats and stderrStats describe the size and truncation of the output
+	stdoutStats runner.OutputStats
+	stderrStats runner.OutputStats
+	duration    time.Duration
+	err         error
+	exitCode    int    // script exit code, runner.ExitCodeNotRun if it did not complete
+	newWorkDir  string // non-empty if cd changed the working directory
+	hints       []hint.Hint
+	// steps are the outcomes of the top-level commands of the script
+	steps []runner.StepResult
+}
+
+// structuredResult is the result of a single command in the result metadata, so clients
+// can tell the streams apart and see why a command failed without parsing the text.
+type structuredResult struct {
+	RunID                string `json:"runId"`
+	Command              string `json:"command"`
+	Stdout               string `json:"stdout"`
+	Stderr               string `json:"stderr"`
+	ExitCode             int    `json:"exitCode"`
+	DurationMs           int64  `json:"durationMs"`
+	StdoutTruncated      bool   `json:"stdoutTruncated"`
+	StderrTruncated      bool   `json:"stderrTruncated"`
+	StdoutRemainingBytes int    `json:"stdoutRemainingBytes"`
+	StderrRemainingBytes int    `json:"stderrRemainingBytes"`
+	// Segments locate the output in Stdout and Stderr in the order it was written
+	Segments []outputSegment `json:"segments,omitempty"`
+	// Steps report the status of each top-level command of a script of several
+	Steps []runner.StepResult `json:"steps,omitempty"`
+	// Error is the reason a command did not run to completion, e.g. that it was blocked
+	Error string `json:"error,omitempty"`
+	// ErrorCode is the machine-readable reason for Error, e.g. "COMMAND_DENIED" or "TIMEOUT"
+	ErrorCode string `json:"errorCode,omitempty"`
+	Canceled  bool   `json:"canceled,omitempty"`
+}
+
+// outputSegment is output written to one stream without output to the other in between.
+// The segments of a command interleave its stdout and stderr as they were written.
+type outputSegment struct {
+	// Stream is "stdout" or "stderr"
+	Stream string `json:"stream"`
+	// Offset and Length locate the segment in the output of its stream
+	Offset int `json:"offset"`
+	Length int `json:"length"`
+	// AtMs is when the segment began, in milliseconds since the command started
+	AtMs int64 `json:"atMs"`
+}
+
+// structured returns the structured form of r.
+func (r commandResult) structured() structuredResult {
+	sr := structuredResult{
+		RunID:                r.runID,
+		Command:              r.command,
+		Stdout:               r.stdout,
+		Stderr:               r.stderr,
+		ExitCode:             r.exitCode,
+		DurationMs:           r.duration.Milliseconds(),
+		StdoutTruncated:      r.stdoutStats.Truncated,
+		StderrTruncated:      r.stderrStats.Truncated,
+		StdoutRemainingBytes: r.stdoutStats.RemainingBytes,
+		StderrRemainingBytes: r.stderrStats.RemainingBytes,
+		Segments:             r.segments,
+		Canceled:             errors.Is(r.err, runner.ErrCanceled),
+	}
+	if len(r.steps) > 1 {
+		sr.Steps = r.steps
+	}
+	if r.err != nil && r.exitCode == runner.ExitCodeNotRun {
+		sr.Error = r.err.Error()
+		sr.ErrorCode = errorCode(r.err)
+	}
+	return sr
+}
+
+// codeTimeout is the error code of runs and commands that exceeded their time limit.
+const codeTimeout = "TIMEOUT"
+
+// errorCode returns the machine-readable reason for err, a failure of a run, or "" when the
+// runner does not classify it.
+func errorCode(err error) string {
+	var denied *runner.CommandDeniedError
+	switch {
+	case errors.As(err, &denied):
+		return string(denied.Result.Code)
+	case errors.Is(err, runner.ErrDirectoryNotAllowed):
+		return string(validator.CodeDirectoryNotAllowed)
+	case errors.Is(err, runner.ErrTimeout):
+		return codeTimeout
+	}
+	return ""
 }
 
 // HandleRunCommand handles the run tool execution.
@@ -186,26 +620,54 @@ func (s *Server) HandleRunCommand(ctx context.Context, request mcp.CallToolReque
 		mode = m
 	}
 
-	s.cmdMutex.Lock()
-	workingDir := s.workingDir
-	s.cmdMutex.Unlock()
+	var opts runOptions
+	if opts.env, err = parseEnv(request.Params.Arguments["env"], s.policyFor(ctx).runner.BaseEnv()); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if opts.timeout, err = timeoutArgument(request.Params.Arguments); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if opts.stdin, err = stdinArgument(request.Params.Arguments); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if opts.maxOutput, err = intArgument(request.Params.Arguments, "max_output"); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	opts.stream, _ = request.Params.Arguments["stream"].(bool)
+	opts.separateStreams, _ = request.Params.Arguments["separate_streams"].(bool)
+	opts.validate, _ = request.Params.Arguments["preflight"].(bool)
+	opts.stopOnError, _ = request.Params.Arguments["stop_on_error"].(bool)
+
+	workingDir, ok := s.currentWorkingDir(ctx)
+	if !ok {
+		return mcp.NewToolResultError(noWorkingDirMessage), nil
+	}
+	if dir, _ := request.Params.Arguments["directory"].(string); dir != "" {
+		workingDir = resolvePath(workingDir, dir)
+	}
 
-	if workingDir == "" {
-		// Use the first allowed directory as default when no directory is set.
-		// This allows the initial cd command to work without a pre-set directory.
-		if len(s.config.AllowedDirectories) > 0 {
-			workingDir = s.config.AllowedDirectories[0]
-		} else {
-			return mcp.NewToolResultError(
-				"No working directory set and no allowed directories configured. Use cd command to set a working directory."), nil
+	// Commands that need a human's approval are queued instead of run
+	for _, command := range commands {
+		req := opts.request(ctx, command, workingDir)
+		check, ok := needsApproval(ctx, s.policyFor(ctx), req)
+		if !ok {
+			continue
 		}
+		if len(commands) > 1 {
+			return mcp.NewToolResultError(fmt.Sprintf(
+				"%s; send it in a call of its own. Nothing has run yet.", check.Message)), nil
+		}
+		return s.queueForApproval(s.policyFor(ctx), req, check), nil
 	}
 
+	opts.progress = s.startProgress(ctx, progressToken(request))
+	defer opts.progress.stop()
+
 	var results []commandResult
 	if mode == modeSerial {
-		results = s.runSerial(ctx, commands, workingDir)
+		results = s.runSerial(ctx, commands, workingDir, opts)
 	} else {
-		results = s.runParallel(ctx, commands, workingDir)
+		results = s.runParallel(ctx, commands, workingDir, opts)
 	}
 
 	// Persist cd directory changes from serial execution, or parallel with a single command.
@@ -213,9 +675,7 @@ func (s *Server) HandleRunCommand(ctx context.Context, request mcp.CallToolReque
 	if mode == modeSerial || len(commands) == 1 {
 		for i := len(results) - 1; i >= 0; i-- {
 			if results[i].newWorkDir != "" {
-				s.cmdMutex.Lock()
-				s.workingDir = results[i].newWorkDir
-				s.cmdMutex.Unlock()
+				s.setWorkingDir(ctx, results[i].newWorkDir)
 				s.logger.LogInfof("Working directory updated by cd: %s", results[i].newWorkDir)
 				break
 			}
@@ -228,7 +688,69 @@ func (s *Server) HandleRunCommand(ctx context.Context, request mcp.CallToolReque
 		allHints = append(allHints, r.hints...)
 	}
 
-	return formatResultsWithHints(results, allHints), nil
+	// Report the directory the next call runs in, so clients can keep track of cd
+	result := formatResultsWithHints(results, allHints, opts.separateStreams)
+	if dir, ok := s.currentWorkingDir(ctx); ok {
+		result.Meta["workingDir"] = dir
+	}
+	reportDeniedEnv(result, deniedEnv(request.Params.Arguments["env"], s.policyFor(ctx).config.EnvPolicy))
+	return result, nil
+}
+
+// noWorkingDirMessage is reported when commands cannot run because there is no directory to run them in.
+const noWorkingDirMessage = "No working directory set and no allowed directories configured. " +
+	"Use cd command to set a working directory."
+
+// currentWorkingDir returns the directory the commands of the client of ctx run in: the
+// session's working directory, or the first directory its policy allows when none is set
+// yet. This allows the initial cd command to work without a pre-set directory. It reports
+// false when neither is available.
+func (s *Server) currentWorkingDir(ctx context.Context) (string, bool) {
+	if workingDir := s.sessionWorkingDir(ctx); workingDir != "" {
+		return workingDir, true
+	}
+	if dirs := s.policyFor(ctx).config.AllowedDirectories; len(dirs) > 0 {
+		return dirs[0], true
+	}
+	return "", false
+}
+
+// sessionWorkingDir returns the working directory of the MCP session of ctx or, when the
+// session has not set one, the workingDir of its client's policy or the default working
+// directory. It returns "" when none is set.
+func (s *Server) sessionWorkingDir(ctx context.Context) string {
+	s.mu.Lock()
+	dir, ok := s.workingDirs[sessionID(ctx)]
+	s.mu.Unlock()
+	if ok {
+		return dir
+	}
+	if dir := s.policyFor(ctx).config.WorkingDir; dir != "" {
+		return dir
+	}
+	return s.defaultWorkingDir
+}
+
+// setWorkingDir sets the working directory of the MCP session of ctx.
+func (s *Server) setWorkingDir(ctx context.Context, dir string) {
+	s.mu.Lock()
+	s.workingDirs[sessionID(ctx)] = dir
+	s.mu.Unlock()
+}
+
+// endSession forgets the working directory of an ended MCP session.
+func (s *Server) endSession(id string) {
+	s.mu.Lock()
+	delete(s.workingDirs, id)
+	s.mu.Unlock()
+}
+
+// resolvePath resolves path against workingDir when it is relative.
+func resolvePath(workingDir, path string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workingDir, path)
+	}
+	return filepath.Clean(path)
 }
 
 // parseCommands extracts and validates the commands array from the request arguments.
@@ -248,13 +770,96 @@ func parseCommands(raw interface{}) ([]string, error) {
 	return commands, nil
 }
 
+// parseEnv converts the optional env object from the request arguments into "NAME=value"
+// entries appended to the base environment. It returns nil when no env is given.
+func parseEnv(raw interface{}, base []string) ([]string, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("env parameter must be an object of string values")
+	}
+	if len(obj) == 0 {
+		return nil, nil
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := slices.Clone(base)
+	for _, name := range names {
+		value, ok := obj[name].(string)
+		if !ok {
+			return nil, fmt.Errorf("env[%q] must be a string", name)
+		}
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return nil, fmt.Errorf("env name %q is invalid", name)
+		}
+		env = append(env, name+"="+value)
+	}
+	return env, nil
+}
+
+// timeoutArgument returns the optional timeout_seconds argument as a duration, zero when it
+// is not given.
+func timeoutArgument(args map[string]interface{}) (time.Duration, error) {
+	seconds, err := intArgument(args, "timeout_seconds")
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// deniedEnv returns the sorted names of the optional env object from the request arguments
+// that the env policy does not allow. The runner drops them from the environment.
+func deniedEnv(raw interface{}, envPolicy *config.EnvPolicy) []string {
+	obj, _ := raw.(map[string]interface{})
+	var denied []string
+	for name := range obj {
+		if !envPolicy.IsVarAllowed(name) {
+			denied = append(denied, name)
+		}
+	}
+	sort.Strings(denied)
+	return denied
+}
+
+// reportDeniedEnv tells the client which of the requested environment variables were not
+// set, in the text and in the metadata of result.
+func reportDeniedEnv(result *mcp.CallToolResult, denied []string) {
+	if len(denied) == 0 {
+		return
+	}
+	result.Meta["deniedEnv"] = denied
+	result.Content = append(result.Content, mcp.TextContent{
+		Type: "text",
+		Text: "\n\nNot set, denied by envPolicy: " + strings.Join(denied, ", ") + "\n",
+	})
+}
+
+// stdinArgument returns the optional stdin argument, "" when it is not given.
+func stdinArgument(args map[string]interface{}) (string, error) {
+	raw, ok := args["stdin"]
+	if !ok || raw == nil {
+		return "", nil
+	}
+	stdin, ok := raw.(string)
+	if !ok {
+		return "", errors.New("stdin parameter must be a string")
+	}
+	return stdin, nil
+}
+
 // runSerial executes commands one by one, stopping on first error.
 // Directory changes from cd are propagated to subsequent commands.
-func (s *Server) runSerial(ctx context.Context, commands []string, workingDir string) []commandResult {
+func (s *Server) runSerial(ctx context.Context, commands []string, workingDir string, opts runOptions) []commandResult {
 	results := make([]commandResult, 0, len(commands))
 	currentDir := workingDir
 	for _, cmd := range commands {
-		r := s.executeOne(ctx, cmd, currentDir)
+		r := s.executeOne(ctx, cmd, currentDir, opts)
 		results = append(results, r)
 		if r.newWorkDir != "" {
 			currentDir = r.newWorkDir
@@ -267,14 +872,14 @@ func (s *Server) runSerial(ctx context.Context, commands []string, workingDir st
 }
 
 // runParallel executes all commands concurrently.
-func (s *Server) runParallel(ctx context.Context, commands []string, workingDir string) []commandResult {
+func (s *Server) runParallel(ctx context.Context, commands []string, workingDir string, opts runOptions) []commandResult {
 	results := make([]commandResult, len(commands))
 	var wg sync.WaitGroup
 	for i, cmd := range commands {
 		wg.Add(1)
 		go func(idx int, c string) {
 			defer wg.Done()
-			results[idx] = s.executeOne(ctx, c, workingDir)
+			results[idx] = s.executeOne(ctx, c, workingDir, opts)
 		}(i, cmd)
 	}
 	wg.Wait()
@@ -282,23 +887,103 @@ func (s *Server) runParallel(ctx context.Context, commands []string, workingDir
 }
 
 // executeOne runs a single command and returns its result.
-func (s *Server) executeOne(ctx context.Context, command, workingDir string) commandResult {
-	s.logger.LogInfof("Command attempt: %s in directory: %s", command, workingDir)
+func (s *Server) executeOne(ctx context.Context, command, workingDir string, opts runOptions) commandResult {
+	runID := runner.NewRunID()
+	s.logger.LogInfof("Run %s: command attempt: %s in directory: %s", runID, command, workingDir)
 
-	r := runner.New(s.config, s.validator, s.logger)
-	buf := new(strings.Builder)
-	r.SetOutputs(buf, buf)
+	// Output is kept combined, in the order it was written, and per stream, with segments
+	// telling where in the streams the combined output came from
+	var output, stdout, stderr strings.Builder
+	var segments []outputSegment
+	start := time.Now()
+	req := opts.request(ctx, command, workingDir)
+	req.ID = runID
+	req.Stdout, req.Stderr = runner.StreamWriters(func(stream string, chunk []byte) {
+		output.Write(chunk)
+		streamOutput := &stdout
+		if stream == runner.StreamStderr {
+			streamOutput = &stderr
+		}
+		if n := len(segments); n > 0 && segments[n-1].Stream == stream {
+			segments[n-1].Length += len(chunk)
+		} else {
+			segments = append(segments, outputSegment{
+				Stream: stream, Offset: streamOutput.Len(), Length: len(chunk), AtMs: time.Since(start).Milliseconds(),
+			})
+		}
+		streamOutput.Write(chunk)
+		if opts.stream {
+			s.sendOutputNotification(ctx, command, stream, chunk)
+		}
+		if opts.progress != nil {
+			_, _ = opts.progress.Write(chunk)
+		}
+	})
 
-	result := r.RunCommand(ctx, command, workingDir)
+	result := s.policyFor(ctx).runner.Run(ctx, req)
 	if result.Err != nil {
-		s.logger.LogErrorf("Command execution failed: %v", result.Err)
+		s.logger.LogErrorf("Run %s: command execution failed: %v", runID, result.Err)
+	}
+	return commandResult{
+		runID:       runID,
+		command:     command,
+		output:      output.String(),
+		stdout:      stdout.String(),
+		stderr:      stderr.String(),
+		segments:    segments,
+		stdoutStats: result.Stdout,
+		stderrStats: result.Stderr,
+		duration:    time.Since(start),
+		err:         result.Err,
+		exitCode:    runner.ExitCode(result.Err),
+		newWorkDir:  result.NewWorkDir,
+		hints:       result.Hints,
+		steps:       result.Steps,
+	}
+}
+
+// clientID identifies the client of ctx: the name of its authentication token, or else
+// the ID of its MCP session. It is "" outside a session.
+func clientID(ctx context.Context) string {
+	if name := clientName(ctx); name != "" {
+		return name
+	}
+	return sessionID(ctx)
+}
+
+// sessionID returns the ID of the MCP session of ctx, or "" outside a session.
+func sessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// sendOutputNotification sends a chunk of a command's output to the client as a log message
+// notification. Chunks are dropped when the client cannot receive notifications. Calls
+// outside an MCP request, such as those of the gRPC transport, have a session but no
+// server in their context.
+func (s *Server) sendOutputNotification(ctx context.Context, command, stream string, chunk []byte) {
+	if server.ClientSessionFromContext(ctx) == nil {
+		return
+	}
+	err := s.mcpServer.SendNotificationToClient(ctx, "notifications/message", map[string]any{
+		"level":  mcp.LoggingLevelInfo,
+		"logger": "secure-shell",
+		"data": map[string]any{
+			"command": command,
+			"stream":  stream,
+			"text":    string(chunk),
+		},
+	})
+	if err != nil {
+		s.logger.LogErrorf("Failed to send output notification: %v", err)
 	}
-	return commandResult{command: command, output: buf.String(), err: result.Err, newWorkDir: result.NewWorkDir, hints: result.Hints}
 }
 
 // formatResultsWithHints builds a tool result from command results, appending any token-saving hints.
-func formatResultsWithHints(results []commandResult, hints []hint.Hint) *mcp.CallToolResult {
-	result := formatResults(results)
+func formatResultsWithHints(results []commandResult, hints []hint.Hint, separateStreams bool) *mcp.CallToolResult {
+	result := formatResults(results, separateStreams)
 
 	if len(hints) == 0 {
 		return result
@@ -321,9 +1006,25 @@ func formatResultsWithHints(results []commandResult, hints []hint.Hint) *mcp.Cal
 	return result
 }
 
-// formatResults builds a tool result from command results.
-func formatResults(results []commandResult) *mcp.CallToolResult {
-	hasError := false
+// writeStream writes the output of a stream under a heading naming it, if there is any.
+func writeStream(sb *strings.Builder, name, output string) {
+	if output == "" {
+		return
+	}
+	fmt.Fprintf(sb, "%s:\n%s", name, output)
+	if !strings.HasSuffix(output, "\n") {
+		sb.WriteString("\n")
+	}
+}
+
+// formatResults builds a tool result from command results. A command that exited non-zero is
+// reported with its exit code, other failures with the error. The exit code of the last command
+// run is also returned in the result metadata as "exitCode", and the run IDs of the commands,
+// which identify them in the audit log, as "runIds". "results" holds the structured result of
+// each command. With separateStreams, the text shows the stdout and stderr of each command
+// under separate headings instead of interleaved.
+func formatResults(results []commandResult, separateStreams bool) *mcp.CallToolResult {
+	hasError, canceled := false, false
 	var sb strings.Builder
 
 	for i, r := range results {
@@ -332,27 +1033,42 @@ func formatResults(results []commandResult) *mcp.CallToolResult {
 		}
 		if r.err != nil {
 			hasError = true
-			fmt.Fprintf(&sb, "Error: %v\n", r.err)
+			canceled = canceled || errors.Is(r.err, runner.ErrCanceled)
+			if r.exitCode == runner.ExitCodeNotRun {
+				fmt.Fprintf(&sb, "Error: %v\n", r.err)
+			}
+		}
+		if separateStreams {
+			writeStream(&sb, "stdout", r.stdout)
+			writeStream(&sb, "stderr", r.stderr)
+		} else {
+			sb.WriteString(r.output)
+		}
+		if r.exitCode > 0 {
+			fmt.Fprintf(&sb, "exitCode: %d\n", r.exitCode)
 		}
-		sb.WriteString(r.output)
 		if len(results) > 1 && i < len(results)-1 {
 			sb.WriteString("\n")
 		}
 	}
 
+	var result *mcp.CallToolResult
 	if hasError {
-		return mcp.NewToolResultError(sb.String())
+		result = mcp.NewToolResultError(sb.String())
+	} else {
+		result = mcp.NewToolResultText(sb.String())
 	}
-	return mcp.NewToolResultText(sb.String())
-}
-
-// ServeStdio starts an MCP server using stdin/stdout for communication.
-func (s *Server) ServeStdio() error {
-	// Register tools
-	s.mcpServer.AddTool(createRunTool(), s.HandleRunCommand)
-	s.mcpServer.AddTool(createPwdTool(), s.HandlePwd)
-
-	// Start the server using stdio
-	s.logger.LogInfof("Starting MCP server using stdin/stdout")
-	return server.ServeStdio(s.mcpServer)
+	if len(results) > 0 {
+		runIDs := make([]string, len(results))
+		structured := make([]structuredResult, len(results))
+		for i, r := range results {
+			runIDs[i] = r.runID
+			structured[i] = r.structured()
+		}
+		result.Meta = map[string]interface{}{"exitCode": results[len(results)-1].exitCode, "runIds": runIDs, "results": structured}
+		if canceled {
+			result.Meta["canceled"] = true
+		}
+	}
+	return result
 }
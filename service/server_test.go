@@ -1,13 +1,20 @@
 package service_test
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 
 	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/pkg/runner"
 	"github.com/shimizu1995/secure-shell-server/service"
 )
 
@@ -75,6 +82,7 @@ func newTestServer(t *testing.T) (*service.Server, string) {
 			{Command: "pwd"},
 			{Command: "ls"},
 			{Command: "cd"},
+			{Command: "false"},
 		},
 		DenyCommands:        []config.DenyCommand{},
 		DefaultErrorMessage: "Command not allowed",
@@ -301,6 +309,28 @@ func TestRunCommand(t *testing.T) {
 		assertToolError(t, result, "Mode must be")
 	})
 
+	t.Run("invalid timeout returns error", func(t *testing.T) {
+		result, err := srv.HandleRunCommand(ctx, makeToolRequest(map[string]interface{}{
+			"commands":        []interface{}{"echo hello"},
+			"timeout_seconds": -1.0,
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolError(t, result, "timeout_seconds must be a non-negative integer")
+	})
+
+	t.Run("timeout within the limit runs", func(t *testing.T) {
+		result, err := srv.HandleRunCommand(ctx, makeToolRequest(map[string]interface{}{
+			"commands":        []interface{}{"echo hello"},
+			"timeout_seconds": 5.0,
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, "hello")
+	})
+
 	t.Run("empty commands array fails", func(t *testing.T) {
 		result, err := srv.HandleRunCommand(ctx, makeToolRequest(map[string]interface{}{
 			"commands": []interface{}{},
@@ -483,6 +513,62 @@ func TestUseEnvPwd(t *testing.T) {
 	})
 }
 
+func TestConfiguredWorkingDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	subDir := filepath.Join(tmpDir, "project")
+	if err := os.Mkdir(subDir, 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	ctx := t.Context()
+	newConfig := func(workingDir string) *config.ShellCommandConfig {
+		return &config.ShellCommandConfig{
+			AllowedDirectories:  []string{tmpDir},
+			AllowCommands:       []config.AllowCommand{{Command: "pwd"}},
+			DenyCommands:        []config.DenyCommand{},
+			DefaultErrorMessage: "Command not allowed",
+			MaxExecutionTime:    10,
+			MaxOutputSize:       1024,
+			WorkingDir:          workingDir,
+			UseEnvPwd:           true,
+		}
+	}
+
+	t.Run("calls without directory run in workingDir", func(t *testing.T) {
+		// workingDir takes precedence over PWD
+		t.Setenv("PWD", tmpDir)
+		srv, err := service.NewServer(newConfig(subDir), 0, "")
+		if err != nil {
+			t.Fatalf("Failed to create server: %v", err)
+		}
+
+		result, err := srv.HandlePwd(ctx, makeToolRequest(nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, subDir)
+
+		result, err = srv.HandleRunCommand(ctx, makeToolRequest(map[string]interface{}{
+			"commands": []interface{}{"pwd"},
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, subDir)
+	})
+
+	t.Run("workingDir outside the allowed directories is rejected", func(t *testing.T) {
+		if _, err := service.NewServer(newConfig("/usr"), 0, ""); err == nil {
+			t.Error("NewServer succeeded with a workingDir outside the allowed directories")
+		}
+	})
+
+	t.Run("relative workingDir is rejected", func(t *testing.T) {
+		if _, err := service.NewServer(newConfig("project"), 0, ""); err == nil {
+			t.Error("NewServer succeeded with a relative workingDir")
+		}
+	})
+}
+
 func TestTokenSavingHints(t *testing.T) {
 	srv, tmpDir := newTestServer(t)
 	ctx := t.Context()
@@ -536,6 +622,165 @@ func TestTokenSavingHints(t *testing.T) {
 	})
 }
 
+func TestRunCommandExitCode(t *testing.T) {
+	srv, _ := newTestServer(t)
+	ctx := t.Context()
+
+	tests := []struct {
+		name     string
+		command  string
+		exitCode int
+		contains string
+		isError  bool
+	}{
+		{name: "success", command: "echo ok", exitCode: 0, contains: "ok"},
+		{name: "non-zero exit", command: "echo partial; false", exitCode: 1, contains: "partial\nexitCode: 1", isError: true},
+		{name: "blocked command", command: "rm forbidden", exitCode: runner.ExitCodeNotRun, contains: "Error:", isError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := srv.HandleRunCommand(ctx, makeToolRequest(map[string]interface{}{
+				"commands": []interface{}{tt.command},
+			}))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.isError {
+				assertToolError(t, result, tt.contains)
+			} else {
+				assertToolSuccess(t, result, tt.contains)
+			}
+			if got := result.Meta["exitCode"]; got != tt.exitCode {
+				t.Fatalf("expected exitCode %d in result metadata, got %v", tt.exitCode, got)
+			}
+		})
+	}
+
+	t.Run("non-zero exit is not reported as an error message", func(t *testing.T) {
+		result, err := srv.HandleRunCommand(ctx, makeToolRequest(map[string]interface{}{
+			"commands": []interface{}{"false"},
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if text := extractText(result); strings.Contains(text, "Error:") {
+			t.Fatalf("expected only the exit code, got: %s", text)
+		}
+	})
+}
+
+func TestRunCommandRunIDs(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	result, err := srv.HandleRunCommand(t.Context(), makeToolRequest(map[string]interface{}{
+		"commands": []interface{}{"echo one", "echo two"},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	runIDs, ok := result.Meta["runIds"].([]string)
+	if !ok || len(runIDs) != 2 {
+		t.Fatalf("expected two run IDs in result metadata, got %v", result.Meta["runIds"])
+	}
+	if runIDs[0] == "" || runIDs[0] == runIDs[1] {
+		t.Fatalf("expected distinct run IDs, got %v", runIDs)
+	}
+}
+
+func TestRunCommandWorkingDirMeta(t *testing.T) {
+	srv, tmpDir := newTestServer(t)
+	ctx := t.Context()
+	subDir := filepath.Join(tmpDir, "sub")
+	if err := os.Mkdir(subDir, 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	for _, command := range []string{"cd sub", "echo still in sub"} {
+		result, err := srv.HandleRunCommand(ctx, makeToolRequest(map[string]interface{}{
+			"commands": []interface{}{command},
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := result.Meta["workingDir"]; got != subDir {
+			t.Fatalf("%s: expected workingDir %q in result metadata, got %v", command, subDir, got)
+		}
+	}
+}
+
+func TestRunCommandEnv(t *testing.T) {
+	srv, _ := newTestServer(t)
+	ctx := t.Context()
+
+	t.Run("variables are visible to the commands", func(t *testing.T) {
+		result, err := srv.HandleRunCommand(ctx, makeToolRequest(map[string]interface{}{
+			"commands": []interface{}{"echo $LANG", "echo $SECURE_SHELL_MODE"},
+			"env":      map[string]interface{}{"LANG": "C.UTF-8", "SECURE_SHELL_MODE": "test"},
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, "C.UTF-8\n")
+		assertToolSuccess(t, result, "test\n")
+	})
+
+	t.Run("denied variables are dropped", func(t *testing.T) {
+		result, err := srv.HandleRunCommand(ctx, makeToolRequest(map[string]interface{}{
+			"commands": []interface{}{"echo \"[$LD_PRELOAD]\""},
+			"env":      map[string]interface{}{"LD_PRELOAD": "/tmp/evil.so"},
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, "[]")
+		assertToolSuccess(t, result, "Not set, denied by envPolicy: LD_PRELOAD")
+		if got, _ := result.Meta["deniedEnv"].([]string); len(got) != 1 || got[0] != "LD_PRELOAD" {
+			t.Errorf("Meta[deniedEnv] = %v, want [LD_PRELOAD]", result.Meta["deniedEnv"])
+		}
+	})
+
+	t.Run("allowed variables are not reported", func(t *testing.T) {
+		result, err := srv.HandleRunCommand(ctx, makeToolRequest(map[string]interface{}{
+			"commands": []interface{}{"echo $CI"},
+			"env":      map[string]interface{}{"CI": "true"},
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, "true\n")
+		if _, ok := result.Meta["deniedEnv"]; ok {
+			t.Errorf("Meta[deniedEnv] = %v, want none", result.Meta["deniedEnv"])
+		}
+	})
+
+	t.Run("non-string values are rejected", func(t *testing.T) {
+		result, err := srv.HandleRunCommand(ctx, makeToolRequest(map[string]interface{}{
+			"commands": []interface{}{"echo ok"},
+			"env":      map[string]interface{}{"COUNT": 1},
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolError(t, result, `env["COUNT"] must be a string`)
+	})
+}
+
+func TestRunCommandStream(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	// Without a client session the output cannot be sent as notifications, but it is
+	// still collected into the result.
+	result, err := srv.HandleRunCommand(t.Context(), makeToolRequest(map[string]interface{}{
+		"commands": []interface{}{"echo out; echo err >&2"},
+		"stream":   true,
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertToolSuccess(t, result, "out\nerr\n")
+}
+
 func assertToolError(t *testing.T, result *mcp.CallToolResult, contains string) {
 	t.Helper()
 	if !result.IsError {
@@ -571,3 +816,297 @@ func extractText(result *mcp.CallToolResult) string {
 func makeDir(path string) error {
 	return os.MkdirAll(path, 0o755)
 }
+
+func TestRunCommandConcurrent(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{tmpDir},
+		AllowCommands:       []config.AllowCommand{{Command: "echo"}, {Command: "sleep"}},
+		DenyCommands:        []config.DenyCommand{},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    10,
+		MaxOutputSize:       1024,
+	}
+	srv, err := service.NewServer(cfg, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	const calls = 4
+	results := make([]*mcp.CallToolResult, calls)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = srv.HandleRunCommand(t.Context(), makeToolRequest(map[string]interface{}{
+				"commands": []interface{}{fmt.Sprintf("echo before-%d; sleep 1; echo after-%d", i, i)},
+			}))
+		}()
+	}
+	wg.Wait()
+
+	// Calls do not wait for each other
+	if elapsed := time.Since(start); elapsed >= 3*time.Second {
+		t.Errorf("%d concurrent calls took %v, want them to run in parallel", calls, elapsed)
+	}
+	// Each call gets only its own output
+	for i, result := range results {
+		if result == nil {
+			t.Fatalf("call %d returned no result", i)
+		}
+		want := fmt.Sprintf("before-%d\nafter-%d\n", i, i)
+		if got := extractText(result); result.IsError || got != want {
+			t.Errorf("call %d output = %q (error %v), want %q", i, got, result.IsError, want)
+		}
+	}
+}
+
+func TestSetWorkingDirectory(t *testing.T) {
+	srv, tmpDir := newTestServer(t)
+	ctx := t.Context()
+	subDir := filepath.Join(tmpDir, "sub")
+	if err := makeDir(subDir); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	t.Run("relative directory is resolved and persists", func(t *testing.T) {
+		result, err := srv.HandleSetWorkingDirectory(ctx, makeToolRequest(map[string]interface{}{"directory": "sub"}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, subDir)
+		if got := result.Meta["workingDir"]; got != subDir {
+			t.Errorf("Meta[workingDir] = %v, want %q", got, subDir)
+		}
+
+		result, err = srv.HandleRunCommand(ctx, makeToolRequest(map[string]interface{}{"commands": []interface{}{"pwd"}}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, subDir)
+	})
+
+	t.Run("directory parameter of run applies to the call only", func(t *testing.T) {
+		result, err := srv.HandleRunCommand(ctx, makeToolRequest(map[string]interface{}{
+			"commands":  []interface{}{"pwd"},
+			"directory": "..",
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, tmpDir)
+		if got := result.Meta["workingDir"]; got != subDir {
+			t.Errorf("Meta[workingDir] = %v, want %q", got, subDir)
+		}
+	})
+
+	t.Run("disallowed or missing directory is rejected", func(t *testing.T) {
+		for _, dir := range []string{t.TempDir(), filepath.Join(tmpDir, "missing")} {
+			result, err := srv.HandleSetWorkingDirectory(ctx, makeToolRequest(map[string]interface{}{"directory": dir}))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !result.IsError {
+				t.Errorf("set_working_directory(%s) succeeded, want error", dir)
+			}
+		}
+		result, err := srv.HandlePwd(ctx, makeToolRequest(nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, subDir)
+	})
+}
+
+func TestRunCommandPreflight(t *testing.T) {
+	srv, tmpDir := newTestServer(t)
+
+	result, err := srv.HandleRunCommand(t.Context(), makeToolRequest(map[string]interface{}{
+		"commands":  []interface{}{"echo first > first.txt; rm -rf build"},
+		"preflight": true,
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertToolError(t, result, "command validation failed")
+	if _, err := os.Stat(filepath.Join(tmpDir, "first.txt")); !os.IsNotExist(err) {
+		t.Errorf("blocked script ran its first command (stat error: %v)", err)
+	}
+}
+
+func TestRunCommandStopOnError(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	for _, tt := range []struct {
+		stopOnError bool
+		wantStatus  []string
+	}{
+		{false, []string{"failed", "succeeded"}},
+		{true, []string{"failed", "skipped"}},
+	} {
+		result, err := srv.HandleRunCommand(t.Context(), makeToolRequest(map[string]interface{}{
+			"commands":      []interface{}{"ls missing-file\necho after"},
+			"stop_on_error": tt.stopOnError,
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		data, err := json.Marshal(result.Meta["results"])
+		if err != nil {
+			t.Fatalf("Failed to encode results: %v", err)
+		}
+		var results []struct {
+			Steps []struct {
+				Command string `json:"command"`
+				Status  string `json:"status"`
+			} `json:"steps"`
+		}
+		if err := json.Unmarshal(data, &results); err != nil || len(results) != 1 {
+			t.Fatalf("results = %s, want 1 structured result (error: %v)", data, err)
+		}
+		var status []string
+		for _, step := range results[0].Steps {
+			status = append(status, step.Status)
+		}
+		if !slices.Equal(status, tt.wantStatus) || results[0].Steps[1].Command != "echo after" {
+			t.Errorf("stop_on_error=%t: steps = %+v, want statuses %v", tt.stopOnError, results[0].Steps, tt.wantStatus)
+		}
+	}
+}
+
+func TestRunCommandStdin(t *testing.T) {
+	cfg := &config.ShellCommandConfig{
+		AllowedDirectories:  []string{t.TempDir()},
+		AllowCommands:       []config.AllowCommand{{Command: "sort"}, {Command: "echo"}},
+		DefaultErrorMessage: "Command not allowed",
+		MaxExecutionTime:    10,
+	}
+	srv, err := service.NewServer(cfg, 0, "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	result, err := srv.HandleRunCommand(t.Context(), makeToolRequest(map[string]interface{}{
+		"commands": []interface{}{"sort"},
+		"stdin":    "pear\napple\n",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertToolSuccess(t, result, "apple\npear\n")
+
+	result, err = srv.HandleRunCommand(t.Context(), makeToolRequest(map[string]interface{}{
+		"commands": []interface{}{"sort"},
+		"stdin":    42.0,
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertToolError(t, result, "stdin parameter must be a string")
+}
+
+func TestRunCommandStructuredResults(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	result, err := srv.HandleRunCommand(t.Context(), makeToolRequest(map[string]interface{}{
+		"commands": []interface{}{"echo out; echo err >&2", "ls missing-file", "rm x"},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Round-trip through JSON as a client would see the metadata
+	data, err := json.Marshal(result.Meta["results"])
+	if err != nil {
+		t.Fatalf("Failed to encode results: %v", err)
+	}
+	var results []struct {
+		RunID           string `json:"runId"`
+		Command         string `json:"command"`
+		Stdout          string `json:"stdout"`
+		Stderr          string `json:"stderr"`
+		ExitCode        int    `json:"exitCode"`
+		DurationMs      *int64 `json:"durationMs"`
+		StdoutTruncated *bool  `json:"stdoutTruncated"`
+		Error           string `json:"error"`
+		ErrorCode       string `json:"errorCode"`
+	}
+	if err := json.Unmarshal(data, &results); err != nil || len(results) != 3 {
+		t.Fatalf("results = %s, want 3 structured results (error: %v)", data, err)
+	}
+
+	if r := results[0]; r.Stdout != "out\n" || r.Stderr != "err\n" || r.ExitCode != 0 || r.RunID == "" || r.DurationMs == nil || r.StdoutTruncated == nil {
+		t.Errorf("results[0] = %+v, want separate streams, exit code 0, run ID and duration", r)
+	}
+	if r := results[1]; r.ExitCode == 0 || r.Stderr == "" || r.Error != "" {
+		t.Errorf("results[1] = %+v, want a non-zero exit code with stderr", r)
+	}
+	if r := results[2]; r.ExitCode != -1 || !strings.Contains(r.Error, "not allowed") || r.ErrorCode != "COMMAND_NOT_ALLOWED" {
+		t.Errorf("results[2] = %+v, want a blocked command with its error", r)
+	}
+}
+
+func TestRunCommandSeparateStreams(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	result, err := srv.HandleRunCommand(t.Context(), makeToolRequest(map[string]interface{}{
+		"commands":         []interface{}{"echo one; echo two >&2; echo three"},
+		"separate_streams": true,
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertToolSuccess(t, result, "stdout:\none\nthree\nstderr:\ntwo\n")
+
+	// The segments interleave the streams in the order they were written
+	data, _ := json.Marshal(result.Meta["results"])
+	var results []struct {
+		Segments []struct {
+			Stream string `json:"stream"`
+			Offset int    `json:"offset"`
+			Length int    `json:"length"`
+		} `json:"segments"`
+	}
+	if err := json.Unmarshal(data, &results); err != nil || len(results) != 1 {
+		t.Fatalf("results = %s, want one structured result (error: %v)", data, err)
+	}
+	var order []string
+	for _, segment := range results[0].Segments {
+		order = append(order, fmt.Sprintf("%s@%d+%d", segment.Stream, segment.Offset, segment.Length))
+	}
+	if got := strings.Join(order, " "); got != "stdout@0+4 stderr@0+4 stdout@4+6" {
+		t.Errorf("segments = %s, want stdout, stderr, stdout", got)
+	}
+}
+
+func TestRunCommandMaxOutput(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	result, err := srv.HandleRunCommand(t.Context(), makeToolRequest(map[string]interface{}{
+		"commands":   []interface{}{"echo hello world"},
+		"max_output": 5.0,
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertToolSuccess(t, result, "hello")
+	if text := extractText(result); strings.Contains(text, "world") {
+		t.Errorf("Output = %q, want it cut after 5 bytes", text)
+	}
+	data, _ := json.Marshal(result.Meta["results"])
+	if !strings.Contains(string(data), `"stdoutTruncated":true`) {
+		t.Errorf("results = %s, want stdout marked as truncated", data)
+	}
+
+	result, err = srv.HandleRunCommand(t.Context(), makeToolRequest(map[string]interface{}{
+		"commands":   []interface{}{"echo hello"},
+		"max_output": "5",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertToolError(t, result, "max_output must be a non-negative integer")
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// stdioSession is the single MCP session of the stdio transport.
+type stdioSession struct {
+	notifications chan mcp.JSONRPCNotification
+	initialized   atomic.Bool
+}
+
+var _ server.ClientSession = (*stdioSession)(nil)
+
+// SessionID implements the server.ClientSession interface.
+func (s *stdioSession) SessionID() string { return "stdio" }
+
+// NotificationChannel implements the server.ClientSession interface.
+func (s *stdioSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return s.notifications }
+
+// Initialize implements the server.ClientSession interface.
+func (s *stdioSession) Initialize() { s.initialized.Store(true) }
+
+// Initialized implements the server.ClientSession interface.
+func (s *stdioSession) Initialized() bool { return s.initialized.Load() }
+
+// ServeStdio starts an MCP server using stdin/stdout for communication, and the admin
+// endpoints on AdminAddr if it is set. It returns when stdin is closed or the process
+// receives SIGINT or SIGTERM.
+func (s *Server) ServeStdio() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if s.config.AdminAddr != "" {
+		if err := s.serveAdmin(ctx); err != nil {
+			return err
+		}
+	}
+
+	s.logger.LogInfof("Starting MCP server using stdin/stdout")
+	return s.ServeStdioStreams(ctx, os.Stdin, os.Stdout)
+}
+
+// ServeStdioStreams serves the MCP stdio transport on stdin and stdout: one JSON-RPC message
+// or batch per line in each direction. Messages are handled in order. It returns nil when
+// stdin ends, or the error of ctx when it is done first.
+func (s *Server) ServeStdioStreams(ctx context.Context, stdin io.Reader, stdout io.Writer) error {
+	s.registerTools()
+
+	session := &stdioSession{notifications: make(chan mcp.JSONRPCNotification, notificationBufferSize)}
+	if err := s.mcpServer.RegisterSession(ctx, session); err != nil {
+		return fmt.Errorf("register session: %w", err)
+	}
+	defer s.mcpServer.UnregisterSession(session.SessionID())
+	ctx, cancel := context.WithCancel(s.mcpServer.WithContext(ctx, session))
+	defer cancel()
+
+	var mu sync.Mutex
+	write := func(message any) {
+		data, err := json.Marshal(message)
+		if err != nil {
+			s.logger.LogErrorf("Failed to encode message: %v", err)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := stdout.Write(append(data, '\n')); err != nil {
+			s.logger.LogErrorf("Failed to write message: %v", err)
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case notification := <-session.notifications:
+				write(notification)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Lines are read in the background so that a done ctx ends serving while stdin blocks
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(stdin)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case line := <-lines:
+			s.handleStdioLine(ctx, line, write)
+		case err := <-readErr:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to read stdin: %w", err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// handleStdioLine handles the message or batch of one line and writes the responses.
+func (s *Server) handleStdioLine(ctx context.Context, line []byte, write func(any)) {
+	messages, headers, batch, err := parseMessages(line)
+	if err != nil {
+		response := mcp.JSONRPCError{JSONRPC: mcp.JSONRPC_VERSION}
+		response.Error.Code = mcp.PARSE_ERROR
+		response.Error.Message = fmt.Sprintf("parse error: %v", err)
+		write(response)
+		return
+	}
+
+	var responses []mcp.JSONRPCMessage
+	for i, message := range messages {
+		if response := s.mcpServer.HandleMessage(ctx, message); response != nil {
+			responses = append(responses, s.annotateResponse(ctx, headers[i].Method, response))
+		}
+	}
+	switch {
+	case len(responses) == 0:
+	case batch:
+		write(responses)
+	default:
+		write(responses[0])
+	}
+}
@@ -0,0 +1,71 @@
+package service_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestServeStdioStreams(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1.0"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`[{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"run","arguments":{"commands":["echo hello"]}}},{"jsonrpc":"2.0","id":4,"method":"ping"}]`,
+		`not json`,
+	}, "\n") + "\n"
+	var output bytes.Buffer
+	if err := srv.ServeStdioStreams(t.Context(), strings.NewReader(input), &output); err != nil {
+		t.Fatalf("ServeStdioStreams() error = %v", err)
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(&output)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want responses to initialize, tools/list, the batch and the parse error:\n%s", len(lines), output.String())
+	}
+
+	var list struct {
+		ID     int `json:"id"`
+		Result struct {
+			Tools []struct {
+				Name        string          `json:"name"`
+				Annotations map[string]bool `json:"annotations"`
+			} `json:"tools"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &list); err != nil || list.ID != 2 {
+		t.Fatalf("Invalid tools/list response %s: %v", lines[1], err)
+	}
+	annotations := make(map[string]map[string]bool)
+	for _, tool := range list.Result.Tools {
+		annotations[tool.Name] = tool.Annotations
+	}
+	if a := annotations["run"]; a == nil || !a["destructiveHint"] || a["readOnlyHint"] || !a["openWorldHint"] {
+		t.Errorf("run annotations = %v, want destructive and open-world", a)
+	}
+	if a := annotations["read_file"]; a == nil || !a["readOnlyHint"] || a["destructiveHint"] {
+		t.Errorf("read_file annotations = %v, want read-only", a)
+	}
+
+	var batch []struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(lines[2]), &batch); err != nil || len(batch) != 2 || batch[0].ID != 3 || batch[1].ID != 4 {
+		t.Errorf("Invalid batch response %s: %v", lines[2], err)
+	}
+	if !strings.Contains(lines[2], "hello") {
+		t.Errorf("Batch response does not contain the output of run: %s", lines[2])
+	}
+	if !strings.Contains(lines[3], `"code":-32700`) {
+		t.Errorf("Invalid line got %s, want a parse error", lines[3])
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/validator"
+)
+
+// createValidateCommandTool creates the validate_command tool for checking a command
+// against the policy without running it.
+func createValidateCommandTool() mcp.Tool {
+	return mcp.NewTool("validate_command",
+		mcp.WithDescription("Check whether a command would be allowed, without running it. "+
+			"Use to pre-check a plan and ask the user before attempting blocked operations."),
+		mcp.WithString("command",
+			mcp.Required(),
+			mcp.Description("Command to check, as it would be passed to run."),
+		),
+		mcp.WithString("directory",
+			mcp.Description("Directory to check the command in (default: the current working directory)."),
+		),
+	)
+}
+
+// HandleValidateCommand handles the validate_command tool execution. A blocked command is
+// a successful call: the verdict is the result.
+func (s *Server) HandleValidateCommand(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	command, ok := request.Params.Arguments["command"].(string)
+	if !ok || command == "" {
+		return mcp.NewToolResultError("command parameter must be a non-empty string"), nil
+	}
+	workingDir, ok := s.currentWorkingDir(ctx)
+	if !ok {
+		return mcp.NewToolResultError(noWorkingDirMessage), nil
+	}
+	if dir, _ := request.Params.Arguments["directory"].(string); dir != "" {
+		workingDir = resolvePath(workingDir, dir)
+	}
+
+	p := s.policyFor(ctx)
+	result := p.validator.ValidateDirectory(workingDir)
+	if result.Allowed {
+		ctx = validator.WithCaller(ctx, validator.Caller{Client: clientID(ctx)})
+		result = p.validator.CheckScript(ctx, command, workingDir)
+	}
+	return formatVerdict(result, workingDir), nil
+}
+
+// formatVerdict describes a validation result as one "key: value" line per field, which
+// are also returned in the result metadata.
+func formatVerdict(result validator.ValidationResult, workingDir string) *mcp.CallToolResult {
+	var sb strings.Builder
+	meta := map[string]interface{}{"allowed": result.Allowed, "workingDir": workingDir}
+	if result.Allowed {
+		sb.WriteString("verdict: allowed\n")
+	} else {
+		sb.WriteString("verdict: blocked\n")
+	}
+	for _, field := range []struct{ key, value string }{
+		{"command", result.Command},
+		{"code", string(result.Code)},
+		{"category", string(result.Category)},
+		{"rule", result.Rule},
+		{"message", result.Message},
+		{"docUrl", result.DocURL},
+	} {
+		if field.value != "" {
+			fmt.Fprintf(&sb, "%s: %s\n", field.key, field.value)
+			meta[field.key] = field.value
+		}
+	}
+	fmt.Fprintf(&sb, "workingDir: %s\n", workingDir)
+
+	verdict := mcp.NewToolResultText(sb.String())
+	verdict.Meta = meta
+	return verdict
+}
@@ -0,0 +1,74 @@
+package service_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateCommand(t *testing.T) {
+	srv, tmpDir := newTestServer(t)
+	ctx := t.Context()
+
+	t.Run("allowed command is not run", func(t *testing.T) {
+		result, err := srv.HandleValidateCommand(ctx, makeToolRequest(map[string]interface{}{
+			"command": "echo hello > out.txt",
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, "verdict: allowed")
+		if result.Meta["allowed"] != true {
+			t.Errorf("Meta[allowed] = %v, want true", result.Meta["allowed"])
+		}
+		if _, err := os.Stat(filepath.Join(tmpDir, "out.txt")); !os.IsNotExist(err) {
+			t.Errorf("validate_command ran the command (stat error: %v)", err)
+		}
+	})
+
+	t.Run("blocked command reports the rule", func(t *testing.T) {
+		result, err := srv.HandleValidateCommand(ctx, makeToolRequest(map[string]interface{}{
+			"command": "ls && rm -rf x",
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, "verdict: blocked")
+		if result.Meta["allowed"] != false || result.Meta["command"] != "rm" || result.Meta["message"] == nil {
+			t.Errorf("Meta = %v, want a blocked verdict for rm with a message", result.Meta)
+		}
+	})
+
+	t.Run("directory outside the allowed directories is blocked", func(t *testing.T) {
+		result, err := srv.HandleValidateCommand(ctx, makeToolRequest(map[string]interface{}{
+			"command":   "echo hello",
+			"directory": t.TempDir(),
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, "rule: allowedDirectories")
+	})
+
+	t.Run("relative directory is resolved against the working directory", func(t *testing.T) {
+		if err := os.Mkdir(filepath.Join(tmpDir, "sub"), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		result, err := srv.HandleValidateCommand(ctx, makeToolRequest(map[string]interface{}{
+			"command":   "ls",
+			"directory": "sub",
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolSuccess(t, result, "workingDir: "+filepath.Join(tmpDir, "sub"))
+	})
+
+	t.Run("missing command fails", func(t *testing.T) {
+		result, err := srv.HandleValidateCommand(ctx, makeToolRequest(map[string]interface{}{}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertToolError(t, result, "non-empty string")
+	})
+}
@@ -0,0 +1,476 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // SHA-1 is mandated by the WebSocket handshake
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// WebSocketPath is the path of the WebSocket transport served by Handler when it is
+// configured.
+const WebSocketPath = "/ws"
+
+const (
+	// webSocketGUID is appended to the client's key to compute the handshake's accept value.
+	webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// webSocketProtocol is the subprotocol of MCP over WebSocket, echoed when clients offer it.
+	webSocketProtocol = "mcp"
+	// webSocketTokenPrefix marks a subprotocol carrying the client's token, for browsers,
+	// which cannot set the Authorization header of a WebSocket request.
+	webSocketTokenPrefix = "bearer."
+	// webSocketPingInterval is how often the server pings an idle connection. Connections that
+	// send nothing, not even a pong, for two intervals are closed.
+	webSocketPingInterval = 30 * time.Second
+	// webSocketWriteTimeout limits the time a frame may take to write.
+	webSocketWriteTimeout = 10 * time.Second
+	// maxWebSocketRequests is the number of requests of a connection handled at once; further
+	// messages are read once one of them finishes.
+	maxWebSocketRequests = 16
+)
+
+// WebSocket opcodes.
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// WebSocket close codes.
+const (
+	wsCloseNormal         = 1000
+	wsCloseProtocolError  = 1002
+	wsCloseUnsupported    = 1003
+	wsCloseInvalidPayload = 1007
+	wsCloseTooBig         = 1009
+)
+
+// wsCloseError is a violation of the WebSocket protocol by the client, which closes the
+// connection with code.
+type wsCloseError struct {
+	code   uint16
+	reason string
+}
+
+// Error implements the error interface.
+func (e *wsCloseError) Error() string { return fmt.Sprintf("websocket: %s (%d)", e.reason, e.code) }
+
+// wsConn is the server end of a WebSocket connection. Messages are read by one goroutine;
+// frames may be written by any.
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+// upgradeWebSocket performs the WebSocket handshake of r and takes over its connection.
+// Requests from browser pages of other origins than the server's own are refused unless
+// allowedOrigins lists them. On failure it responds with an HTTP error and returns why.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, allowedOrigins []string) (*wsConn, error) {
+	fail := func(status int, message string) (*wsConn, error) {
+		http.Error(w, message, status)
+		return nil, errors.New(message)
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		return fail(http.StatusMethodNotAllowed, "method not allowed")
+	}
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		return fail(http.StatusUpgradeRequired, "expected a WebSocket upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return fail(http.StatusUpgradeRequired, "unsupported WebSocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return fail(http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+	if !originAllowed(r, allowedOrigins) {
+		return fail(http.StatusForbidden, fmt.Sprintf("origin %q not allowed", r.Header.Get("Origin")))
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return fail(http.StatusInternalServerError, "connection cannot be upgraded: "+err.Error())
+	}
+	// Drop the deadlines of the HTTP server, which would end the connection
+	_ = conn.SetDeadline(time.Time{})
+
+	accept := sha1.Sum([]byte(key + webSocketGUID)) //nolint:gosec // mandated by the handshake
+	response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(accept[:]) + "\r\n"
+	if headerHasToken(r.Header, "Sec-WebSocket-Protocol", webSocketProtocol) {
+		response += "Sec-WebSocket-Protocol: " + webSocketProtocol + "\r\n"
+	}
+	if _, err := rw.WriteString(response + "\r\n"); err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to complete the WebSocket handshake: %w", err)
+	}
+	return &wsConn{conn: conn, reader: rw.Reader}, nil
+}
+
+// headerHasToken reports whether the comma-separated values of header name include token,
+// ignoring case.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for part := range strings.SplitSeq(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// originAllowed reports whether the Origin of r may connect: requests without one, which
+// do not come from a browser, requests from the server's own host and allowed origins.
+func originAllowed(r *http.Request, allowedOrigins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// webSocketToken returns the token a client sent as a "bearer.<token>" subprotocol, or "".
+func webSocketToken(r *http.Request) string {
+	for _, value := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for part := range strings.SplitSeq(value, ",") {
+			if token, ok := strings.CutPrefix(strings.TrimSpace(part), webSocketTokenPrefix); ok {
+				return token
+			}
+		}
+	}
+	return ""
+}
+
+// readMessage returns the next text message. It answers pings and, when the client closes
+// the connection, replies and returns io.EOF. Protocol violations close the connection with
+// the matching code and are returned as a *wsCloseError.
+func (c *wsConn) readMessage(maxSize int) ([]byte, error) {
+	var message []byte
+	inMessage := false
+	for {
+		fin, opcode, payload, err := c.readFrame(maxSize - len(message))
+		if err != nil {
+			return nil, c.fail(err)
+		}
+		switch opcode {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			code := uint16(wsCloseNormal)
+			if len(payload) >= 2 {
+				code = binary.BigEndian.Uint16(payload)
+			}
+			_ = c.writeClose(code, "")
+			return nil, io.EOF
+		case wsOpBinary:
+			return nil, c.fail(&wsCloseError{code: wsCloseUnsupported, reason: "binary messages are not supported"})
+		case wsOpText:
+			if inMessage {
+				return nil, c.fail(&wsCloseError{code: wsCloseProtocolError, reason: "new message inside a fragmented one"})
+			}
+			inMessage = true
+		case wsOpContinuation:
+			if !inMessage {
+				return nil, c.fail(&wsCloseError{code: wsCloseProtocolError, reason: "continuation outside a message"})
+			}
+		}
+		message = append(message, payload...)
+		if fin {
+			if !utf8.Valid(message) {
+				return nil, c.fail(&wsCloseError{code: wsCloseInvalidPayload, reason: "text message is not valid UTF-8"})
+			}
+			return message, nil
+		}
+	}
+}
+
+// fail closes the connection with the code of err if it is a *wsCloseError, and returns err.
+func (c *wsConn) fail(err error) error {
+	var closeErr *wsCloseError
+	if errors.As(err, &closeErr) {
+		_ = c.writeClose(closeErr.code, closeErr.reason)
+	}
+	return err
+}
+
+// readFrame reads a frame of at most maxSize payload bytes and unmasks its payload.
+func (c *wsConn) readFrame(maxSize int) (bool, byte, []byte, error) {
+	_ = c.conn.SetReadDeadline(time.Now().Add(2 * webSocketPingInterval))
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0f
+	switch {
+	case header[0]&0x70 != 0:
+		return false, 0, nil, &wsCloseError{code: wsCloseProtocolError, reason: "reserved bits set"}
+	case opcode > wsOpBinary && opcode < wsOpClose, opcode > wsOpPong:
+		return false, 0, nil, &wsCloseError{code: wsCloseProtocolError, reason: fmt.Sprintf("unknown opcode %d", opcode)}
+	case header[1]&0x80 == 0:
+		return false, 0, nil, &wsCloseError{code: wsCloseProtocolError, reason: "client frames must be masked"}
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if opcode >= wsOpClose && (!fin || length > 125) {
+		return false, 0, nil, &wsCloseError{code: wsCloseProtocolError, reason: "invalid control frame"}
+	}
+	if opcode < wsOpClose && length > uint64(max(maxSize, 0)) {
+		return false, 0, nil, &wsCloseError{code: wsCloseTooBig, reason: "message too big"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame writes a single unfragmented frame.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, byte(length))
+	case length <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	frame = append(frame, payload...)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+	_, err := c.conn.Write(frame)
+	if opcode == wsOpClose {
+		c.closed = true
+	}
+	return err
+}
+
+// writeClose sends a close frame with code and reason. No frames are written after it.
+func (c *wsConn) writeClose(code uint16, reason string) error {
+	return c.writeFrame(wsOpClose, append(binary.BigEndian.AppendUint16(nil, code), reason...))
+}
+
+// writeJSON sends v as a text message.
+func (c *wsConn) writeJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(wsOpText, data)
+}
+
+// webSocketSession is the MCP session of a WebSocket connection. It lives as long as the
+// connection.
+type webSocketSession struct {
+	id            string
+	notifications chan mcp.JSONRPCNotification
+	initialized   atomic.Bool
+	requestTracker
+}
+
+var _ server.ClientSession = (*webSocketSession)(nil)
+
+// SessionID implements the server.ClientSession interface.
+func (s *webSocketSession) SessionID() string { return s.id }
+
+// NotificationChannel implements the server.ClientSession interface.
+func (s *webSocketSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+// Initialize implements the server.ClientSession interface.
+func (s *webSocketSession) Initialize() { s.initialized.Store(true) }
+
+// Initialized implements the server.ClientSession interface.
+func (s *webSocketSession) Initialized() bool { return s.initialized.Load() }
+
+// serveWebSocket serves the MCP server over a WebSocket connection: each text message
+// carries a JSON-RPC message or batch, and responses and notifications are sent back as
+// text messages. Requests are handled concurrently, so responses may arrive in another
+// order than their requests, and can be canceled with notifications/cancelled.
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgradeWebSocket(w, r, s.config.WebSocket.AllowedOrigins)
+	if err != nil {
+		s.logger.LogWarnf("Rejected WebSocket request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	defer conn.conn.Close()
+
+	session := &webSocketSession{
+		id:            rand.Text(),
+		notifications: make(chan mcp.JSONRPCNotification, notificationBufferSize),
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	if err := s.mcpServer.RegisterSession(ctx, session); err != nil {
+		s.logger.LogErrorf("Failed to register WebSocket session: %v", err)
+		_ = conn.writeClose(wsCloseNormal, "")
+		return
+	}
+	defer s.mcpServer.UnregisterSession(session.id)
+	defer s.endSession(session.id)
+	ctx = s.mcpServer.WithContext(ctx, session)
+	s.logger.LogInfof("WebSocket session %s started", session.id)
+
+	send := func(message any) {
+		if err := conn.writeJSON(message); err != nil && !errors.Is(err, net.ErrClosed) {
+			s.logger.LogErrorf("WebSocket session %s: failed to send message: %v", session.id, err)
+		}
+	}
+	go func() {
+		ping := time.NewTicker(webSocketPingInterval)
+		defer ping.Stop()
+		for {
+			select {
+			case notification := <-session.notifications:
+				send(notification)
+			case <-ping.C:
+				_ = conn.writeFrame(wsOpPing, nil)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var handlers sync.WaitGroup
+	slots := make(chan struct{}, maxWebSocketRequests)
+	defer func() {
+		session.cancelRequests()
+		handlers.Wait()
+	}()
+	for {
+		data, err := conn.readMessage(maxMessageSize)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				s.logger.LogInfof("WebSocket session %s ended", session.id)
+			} else {
+				s.logger.LogWarnf("WebSocket session %s ended: %v", session.id, err)
+			}
+			return
+		}
+		messages, headers, batch, err := parseMessages(data)
+		if err != nil {
+			response := mcp.JSONRPCError{JSONRPC: mcp.JSONRPC_VERSION}
+			response.Error.Code = mcp.PARSE_ERROR
+			response.Error.Message = fmt.Sprintf("parse error: %v", err)
+			send(response)
+			continue
+		}
+
+		// Notifications are handled right away, so that they can cancel running requests
+		if !batch && !headers[0].isRequest() {
+			s.handleWebSocketMessage(ctx, session, messages[0], headers[0])
+			continue
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		handlers.Add(1)
+		go func() {
+			defer handlers.Done()
+			defer func() { <-slots }()
+			var responses []mcp.JSONRPCMessage
+			for i, message := range messages {
+				if response := s.handleWebSocketMessage(ctx, session, message, headers[i]); response != nil {
+					responses = append(responses, response)
+				}
+			}
+			switch {
+			case len(responses) == 0:
+			case batch:
+				send(responses)
+			default:
+				send(responses[0])
+			}
+		}()
+	}
+}
+
+// handleWebSocketMessage handles a single message of session.
+func (s *Server) handleWebSocketMessage(ctx context.Context, session *webSocketSession, message json.RawMessage, header messageHeader) mcp.JSONRPCMessage {
+	ctx, done, canceled := session.track(ctx, message, header)
+	defer done()
+	if canceled != nil {
+		s.logger.LogInfof("WebSocket session %s: request %s canceled by the client", session.id, canceled)
+	}
+	response := s.mcpServer.HandleMessage(ctx, message)
+	if response != nil {
+		response = s.annotateResponse(ctx, header.Method, response)
+	}
+	return response
+}
@@ -0,0 +1,272 @@
+package service_test
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shimizu1995/secure-shell-server/pkg/config"
+	"github.com/shimizu1995/secure-shell-server/service"
+)
+
+// wsClient is a minimal WebSocket client for the tests.
+type wsClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialWebSocket opens a WebSocket connection to the server's WebSocket transport with the
+// given extra request headers. It returns the handshake response, and the client when the
+// server switched protocols.
+func dialWebSocket(t *testing.T, ts *httptest.Server, headers map[string]string) (*http.Response, *wsClient) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	req, _ := http.NewRequestWithContext(t.Context(), http.MethodGet, ts.URL+service.WebSocketPath, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("Failed to send handshake: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		t.Fatalf("Failed to read handshake response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return resp, nil
+	}
+	return resp, &wsClient{t: t, conn: conn, reader: reader}
+}
+
+// writeFrame sends a masked frame.
+func (c *wsClient) writeFrame(fin bool, opcode byte, payload []byte) {
+	c.t.Helper()
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	switch {
+	case len(payload) <= 125:
+		frame = append(frame, 0x80|byte(len(payload)))
+	default:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	}
+	mask := make([]byte, 4)
+	_, _ = rand.Read(mask)
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.t.Fatalf("Failed to write frame: %v", err)
+	}
+}
+
+// readFrame reads an unmasked frame.
+func (c *wsClient) readFrame() (byte, []byte) {
+	c.t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		c.t.Fatalf("Failed to read frame: %v", err)
+	}
+	length := int(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		_, _ = io.ReadFull(c.reader, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, _ = io.ReadFull(c.reader, ext[:])
+		length = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		c.t.Fatalf("Failed to read frame payload: %v", err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+// response returns the next text message that is not a notification, the response to a
+// request.
+func (c *wsClient) response() map[string]interface{} {
+	c.t.Helper()
+	for {
+		opcode, payload := c.readFrame()
+		if opcode != 0x1 {
+			c.t.Fatalf("Expected a text message, got opcode %d: %q", opcode, payload)
+		}
+		var response map[string]interface{}
+		if err := json.Unmarshal(payload, &response); err != nil {
+			c.t.Fatalf("Invalid message %s: %v", payload, err)
+		}
+		if _, ok := response["method"]; !ok {
+			return response
+		}
+	}
+}
+
+// call sends a JSON-RPC message and returns the response.
+func (c *wsClient) call(message string) map[string]interface{} {
+	c.t.Helper()
+	c.writeFrame(true, 0x1, []byte(message))
+	return c.response()
+}
+
+func TestWebSocketTransport(t *testing.T) {
+	newWebSocketServer := func(t *testing.T, cfg *config.ShellCommandConfig) *httptest.Server {
+		t.Helper()
+		cfg.AllowedDirectories = []string{t.TempDir()}
+		cfg.AllowCommands = []config.AllowCommand{{Command: "echo"}}
+		cfg.DefaultErrorMessage = "Command not allowed"
+		cfg.MaxExecutionTime = 10
+		srv, err := service.NewServer(cfg, 0, "")
+		if err != nil {
+			t.Fatalf("Failed to create server: %v", err)
+		}
+		ts := httptest.NewServer(srv.Handler())
+		t.Cleanup(ts.Close)
+		return ts
+	}
+	initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize",` +
+		`"params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1.0"}}}`
+
+	t.Run("tool calls", func(t *testing.T) {
+		ts := newWebSocketServer(t, &config.ShellCommandConfig{WebSocket: &config.WebSocketConfig{}})
+		resp, client := dialWebSocket(t, ts, map[string]string{"Sec-WebSocket-Protocol": "mcp"})
+		if client == nil {
+			t.Fatalf("handshake status = %d, want 101", resp.StatusCode)
+		}
+		if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+			t.Errorf("Sec-WebSocket-Accept = %q", got)
+		}
+		if got := resp.Header.Get("Sec-WebSocket-Protocol"); got != "mcp" {
+			t.Errorf("Sec-WebSocket-Protocol = %q, want mcp", got)
+		}
+
+		if response := client.call(initialize); response["result"] == nil {
+			t.Fatalf("initialize response = %v", response)
+		}
+		client.writeFrame(true, 0x1, []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+
+		// A message may arrive in fragments, with a ping in between
+		call := `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"run","arguments":{"commands":["echo over websocket"]}}}`
+		client.writeFrame(false, 0x1, []byte(call[:20]))
+		client.writeFrame(true, 0x9, []byte("are you there"))
+		if opcode, payload := client.readFrame(); opcode != 0xA || string(payload) != "are you there" {
+			t.Fatalf("ping answered with opcode %d %q, want the pong", opcode, payload)
+		}
+		client.writeFrame(true, 0x0, []byte(call[20:]))
+		response := client.response()
+		data, _ := json.Marshal(response)
+		if response["id"] != float64(2) || !strings.Contains(string(data), "over websocket") {
+			t.Errorf("tools/call response = %s, want the command output", data)
+		}
+	})
+
+	t.Run("batches and errors", func(t *testing.T) {
+		ts := newWebSocketServer(t, &config.ShellCommandConfig{WebSocket: &config.WebSocketConfig{}})
+		_, client := dialWebSocket(t, ts, nil)
+		client.writeFrame(true, 0x1, []byte(`[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","id":2,"method":"ping"}]`))
+		_, payload := client.readFrame()
+		var batch []map[string]interface{}
+		if err := json.Unmarshal(payload, &batch); err != nil || len(batch) != 2 {
+			t.Errorf("batch response = %s, want two responses", payload)
+		}
+
+		if response := client.call(`not json`); response["error"] == nil {
+			t.Errorf("response to invalid JSON = %v, want a parse error", response)
+		}
+
+		client.writeFrame(true, 0x2, []byte{1, 2, 3})
+		if opcode, payload := client.readFrame(); opcode != 0x8 || binary.BigEndian.Uint16(payload) != 1003 {
+			t.Errorf("binary message answered with opcode %d %q, want close 1003", opcode, payload)
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		ts := newWebSocketServer(t, &config.ShellCommandConfig{WebSocket: &config.WebSocketConfig{}})
+		_, client := dialWebSocket(t, ts, nil)
+		client.writeFrame(true, 0x8, binary.BigEndian.AppendUint16(nil, 1000))
+		if opcode, payload := client.readFrame(); opcode != 0x8 || binary.BigEndian.Uint16(payload) != 1000 {
+			t.Errorf("close answered with opcode %d %q, want close 1000", opcode, payload)
+		}
+		if _, err := client.reader.ReadByte(); err == nil {
+			t.Error("connection still open after close")
+		}
+	})
+
+	t.Run("handshake", func(t *testing.T) {
+		ts := newWebSocketServer(t, &config.ShellCommandConfig{
+			WebSocket: &config.WebSocketConfig{AllowedOrigins: []string{"https://app.example.com"}},
+		})
+		tests := []struct {
+			name    string
+			headers map[string]string
+			status  int
+		}{
+			{"same origin", map[string]string{"Origin": ts.URL}, http.StatusSwitchingProtocols},
+			{"allowed origin", map[string]string{"Origin": "https://app.example.com"}, http.StatusSwitchingProtocols},
+			{"other origin", map[string]string{"Origin": "https://evil.example.com"}, http.StatusForbidden},
+			{"old version", map[string]string{"Sec-WebSocket-Version": "8"}, http.StatusUpgradeRequired},
+			{"invalid key", map[string]string{"Sec-WebSocket-Key": "short"}, http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			if resp, _ := dialWebSocket(t, ts, tt.headers); resp.StatusCode != tt.status {
+				t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.status)
+			}
+		}
+
+		// Without webSocket the path is not served
+		plain := newWebSocketServer(t, &config.ShellCommandConfig{})
+		if resp, _ := dialWebSocket(t, plain, nil); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("without webSocket: status = %d, want 404", resp.StatusCode)
+		}
+	})
+
+	t.Run("authentication", func(t *testing.T) {
+		ts := newWebSocketServer(t, &config.ShellCommandConfig{
+			WebSocket:  &config.WebSocketConfig{},
+			AuthTokens: []config.AuthToken{{Token: "secret", Client: "browser"}},
+		})
+		if resp, _ := dialWebSocket(t, ts, nil); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("without token: status = %d, want 401", resp.StatusCode)
+		}
+		if resp, _ := dialWebSocket(t, ts, map[string]string{"Authorization": "Bearer secret"}); resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Errorf("with Authorization header: status = %d, want 101", resp.StatusCode)
+		}
+		resp, client := dialWebSocket(t, ts, map[string]string{"Sec-WebSocket-Protocol": "mcp, bearer.secret"})
+		if client == nil {
+			t.Fatalf("with token subprotocol: status = %d, want 101", resp.StatusCode)
+		}
+		if got := resp.Header.Get("Sec-WebSocket-Protocol"); got != "mcp" {
+			t.Errorf("Sec-WebSocket-Protocol = %q, want mcp", got)
+		}
+		if response := client.call(initialize); response["result"] == nil {
+			t.Errorf("initialize response = %v", response)
+		}
+	})
+}